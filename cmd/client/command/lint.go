@@ -0,0 +1,226 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/texttemplate"
+)
+
+const httpPipelineKind = "HTTPPipeline"
+
+type (
+	lintPipeline struct {
+		Filters []map[string]interface{} `yaml:"filters"`
+	}
+
+	lintIssue struct {
+		object   string
+		filter   string
+		template string
+		message  string
+	}
+)
+
+// LintCmd defines lint command.
+func LintCmd() *cobra.Command {
+	var specFile string
+
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Check the templates of HTTP pipelines against the meta templates",
+		Example: `  # Lint the pipelines in a yaml file.
+  egctl lint -f <pipeline_spec.yaml>
+
+  # Lint the pipelines from stdin.
+  cat <pipeline_spec.yaml> | egctl lint`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			metaTemplates := context.MetaTemplates()
+			engine, err := texttemplate.NewDefault(metaTemplates)
+			if err != nil {
+				ExitWithErrorf("%s failed: %v", cmd.Short, err)
+			}
+
+			issues := []*lintIssue{}
+			visitor := buildVisitorFromFileOrStdin(specFile, cmd)
+			visitor.Visit(func(s *spec) {
+				if s.Kind != httpPipelineKind {
+					return
+				}
+				issues = append(issues, lintHTTPPipeline(engine, metaTemplates, s)...)
+			})
+
+			for _, issue := range issues {
+				fmt.Printf("%s/%s: [[%s]] %s\n", issue.object, issue.filter, issue.template, issue.message)
+			}
+			if len(issues) != 0 {
+				ExitWithErrorf("%d template issues found", len(issues))
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file specifying the objects.")
+
+	return cmd
+}
+
+// lintHTTPPipeline checks the templates of every filter, the filters can
+// only reference the filters defined in the same pipeline.
+func lintHTTPPipeline(engine texttemplate.TemplateEngine, metaTemplates []string, s *spec) []*lintIssue {
+	pipeline := &lintPipeline{}
+	if err := yaml.Unmarshal([]byte(s.doc), pipeline); err != nil {
+		ExitWithErrorf("error parsing %s: %v", s.doc, err)
+	}
+
+	filterNames := map[string]bool{}
+	for _, filter := range pipeline.Filters {
+		if name, ok := filter["name"].(string); ok {
+			filterNames[name] = true
+		}
+	}
+
+	issues := []*lintIssue{}
+	for _, filter := range pipeline.Filters {
+		name, _ := filter["name"].(string)
+		buff, err := yaml.Marshal(filter)
+		if err != nil {
+			ExitWithErrorf("BUG: marshal filter %s failed: %v", name, err)
+		}
+
+		templates := engine.ExtractRawTemplateRuleMap(string(buff))
+		keys := make([]string, 0, len(templates))
+		for template := range templates {
+			keys = append(keys, template)
+		}
+		sort.Strings(keys)
+
+		for _, template := range keys {
+			issue := &lintIssue{object: s.Name, filter: name, template: template}
+			if templates[template] == "" {
+				issue.message = "matched none meta template"
+				if suggestion := suggestTemplate(metaTemplates, template); suggestion != "" {
+					issue.message += fmt.Sprintf(", did you mean [[%s]]?", suggestion)
+				}
+			} else if tags := strings.Split(template, texttemplate.DefaultSeparator); tags[0] == "filter" && !filterNames[tags[1]] {
+				issue.message = fmt.Sprintf("references filter %s not found in the pipeline", tags[1])
+			} else {
+				continue
+			}
+			issues = append(issues, issue)
+		}
+	}
+
+	return issues
+}
+
+// suggestTemplate returns the template rendered from the meta template
+// nearest to the template, the wildcard tags of meta templates are filled
+// by the tags of the template at the same positions. The one sharing more
+// characters in order wins the tie, e.g. "hdr" is nearer to "header" than
+// "body". It returns empty if none is near enough.
+func suggestTemplate(metaTemplates []string, template string) string {
+	tags := strings.Split(template, texttemplate.DefaultSeparator)
+
+	suggestion, minDistance, maxCommon := "", len(template)/2+1, 0
+	for _, mt := range metaTemplates {
+		metaTags := strings.Split(mt, texttemplate.DefaultSeparator)
+		candidate := make([]string, len(metaTags))
+		for i, tag := range metaTags {
+			switch {
+			case !strings.HasPrefix(tag, "{"):
+				candidate[i] = tag
+			case i >= len(tags):
+				candidate[i] = tag
+			case i == len(metaTags)-1 && tag != "{}":
+				// {gjson}, {jsonpath} and {regexp} take the rest tags
+				candidate[i] = strings.Join(tags[i:], texttemplate.DefaultSeparator)
+			default:
+				candidate[i] = tags[i]
+			}
+		}
+
+		s := strings.Join(candidate, texttemplate.DefaultSeparator)
+		d, common := editDistance(template, s), commonSubsequence(template, s)
+		if d < minDistance || (d == minDistance && suggestion != "" && common > maxCommon) {
+			suggestion, minDistance, maxCommon = s, d, common
+		}
+	}
+
+	return suggestion
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+// commonSubsequence returns the length of the longest common subsequence of a and b.
+func commonSubsequence(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			if a[i-1] == b[j-1] {
+				curr[j] = prev[j-1] + 1
+			} else if prev[j] > curr[j-1] {
+				curr[j] = prev[j]
+			} else {
+				curr[j] = curr[j-1]
+			}
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
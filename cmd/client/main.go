@@ -70,6 +70,9 @@ var exampleUsage = `  # List APIs.
 
   # Get object status
   egctl object status get <object_name>
+
+  # Check the templates of pipelines in a yaml file.
+  egctl lint -f <pipeline_spec.yaml>
 `
 
 func main() {
@@ -110,6 +113,7 @@ func main() {
 		command.ObjectCmd(),
 		command.MemberCmd(),
 		command.WasmCmd(),
+		command.LintCmd(),
 		completionCmd,
 	)
 
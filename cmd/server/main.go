@@ -18,6 +18,8 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
 	"os"
 	"sync"
@@ -30,6 +32,7 @@ import (
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/option"
 	"github.com/megaease/easegress/pkg/pidfile"
+	"github.com/megaease/easegress/pkg/plugin"
 	"github.com/megaease/easegress/pkg/profile"
 	_ "github.com/megaease/easegress/pkg/registry"
 	"github.com/megaease/easegress/pkg/supervisor"
@@ -46,6 +49,20 @@ func main() {
 		common.Exit(0, msg)
 	}
 
+	// The plugins are loaded before validating specs, so the specs
+	// of the external filters are validated too.
+	var pluginKinds []string
+	if opt.PluginDir != "" {
+		pluginKinds, err = plugin.Load(opt.PluginDir)
+		if err != nil {
+			common.Exit(1, err.Error())
+		}
+	}
+
+	if opt.ValidateOnly != "" {
+		validateOnly(opt.ValidateOnly)
+	}
+
 	err = env.InitServerDir(opt)
 	if err != nil {
 		log.Printf("failed to init env: %v", err)
@@ -55,6 +72,9 @@ func main() {
 	logger.Init(opt)
 	defer logger.Sync()
 	logger.Infof("%s", version.Long)
+	if len(pluginKinds) != 0 {
+		logger.Infof("filters loaded from plugins: %v", pluginKinds)
+	}
 
 	if opt.SignalUpgrade {
 		pid, err := pidfile.Read(opt)
@@ -141,3 +161,23 @@ func main() {
 	profile.Close(wg)
 	wg.Wait()
 }
+
+func validateOnly(dir string) {
+	logger.InitNop()
+
+	report, err := supervisor.ValidateDir(dir)
+	if err != nil {
+		common.Exit(1, err.Error())
+	}
+
+	buff, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		common.Exit(1, fmt.Sprintf("marshal report to json failed: %v", err))
+	}
+	fmt.Fprintf(os.Stdout, "%s\n", buff)
+
+	if !report.Valid {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
@@ -98,6 +98,10 @@ func (s *Server) registerAPIs() {
 	group.Entries = append(group.Entries, s.memberAPIEntries()...)
 	group.Entries = append(group.Entries, s.objectAPIEntries()...)
 	group.Entries = append(group.Entries, s.metadataAPIEntries()...)
+	group.Entries = append(group.Entries, s.topTalkersAPIEntries()...)
+	group.Entries = append(group.Entries, s.drainAPIEntries()...)
+	group.Entries = append(group.Entries, s.proxyMetricsAPIEntries()...)
+	group.Entries = append(group.Entries, s.capabilityAPIEntries()...)
 	group.Entries = append(group.Entries, s.healthAPIEntries()...)
 	group.Entries = append(group.Entries, s.aboutAPIEntries()...)
 
@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/util/capability"
+	"github.com/megaease/easegress/pkg/version"
+)
+
+// CapabilitiesPrefix is the prefix of the capabilities of this binary.
+const CapabilitiesPrefix = "/capabilities"
+
+type (
+	// Capabilities is the capabilities of this binary, the specs could
+	// require them by requires in the form of category/name.
+	Capabilities struct {
+		Release      string              `yaml:"release"`
+		APIVersion   string              `yaml:"apiVersion"`
+		Capabilities map[string][]string `yaml:"capabilities"`
+	}
+)
+
+func (s *Server) capabilityAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    CapabilitiesPrefix,
+			Method:  "GET",
+			Handler: s.getCapabilities,
+		},
+	}
+}
+
+func (s *Server) getCapabilities(w http.ResponseWriter, r *http.Request) {
+	capabilities := &Capabilities{
+		Release:      version.RELEASE,
+		APIVersion:   version.API,
+		Capabilities: capability.List(),
+	}
+
+	buff, err := yaml.Marshal(capabilities)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", capabilities, err))
+	}
+
+	w.Header().Set("Content-Type", "text/vnd.yaml")
+	w.Write(buff)
+}
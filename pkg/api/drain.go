@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/filter/proxy"
+)
+
+// DrainingServersPrefix is the prefix of the servers of proxies being
+// drained, the server is specified by the query parameter url.
+const DrainingServersPrefix = "/draining-servers"
+
+func (s *Server) drainAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    DrainingServersPrefix,
+			Method:  "GET",
+			Handler: s.listDrainingServers,
+		},
+		{
+			Path:    DrainingServersPrefix,
+			Method:  "POST",
+			Handler: s.drainServer,
+		},
+		{
+			Path:    DrainingServersPrefix,
+			Method:  "DELETE",
+			Handler: s.undrainServer,
+		},
+	}
+}
+
+func (s *Server) listDrainingServers(w http.ResponseWriter, r *http.Request) {
+	writeDrainYAML(w, proxy.DrainingServers())
+}
+
+func (s *Server) drainServer(w http.ResponseWriter, r *http.Request) {
+	url := r.URL.Query().Get("url")
+	if url == "" {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("url is required"))
+		return
+	}
+
+	writeDrainYAML(w, proxy.DrainServer(url))
+}
+
+func (s *Server) undrainServer(w http.ResponseWriter, r *http.Request) {
+	url := r.URL.Query().Get("url")
+	if url == "" {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("url is required"))
+		return
+	}
+
+	if !proxy.UndrainServer(url) {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+	}
+}
+
+func writeDrainYAML(w http.ResponseWriter, v interface{}) {
+	buff, err := yaml.Marshal(v)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", v, err))
+	}
+
+	w.Header().Set("Content-Type", "text/vnd.yaml")
+	w.Write(buff)
+}
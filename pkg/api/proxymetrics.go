@@ -0,0 +1,43 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/megaease/easegress/pkg/filter/proxy"
+)
+
+// ProxyMetricsPath is the path of the metrics of proxies in the text
+// format of Prometheus.
+const ProxyMetricsPath = "/proxy-metrics"
+
+func (s *Server) proxyMetricsAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    ProxyMetricsPath,
+			Method:  "GET",
+			Handler: s.proxyMetrics,
+		},
+	}
+}
+
+func (s *Server) proxyMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(proxy.Metrics())
+}
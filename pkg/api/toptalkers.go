@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/util/toptalkers"
+)
+
+// TopTalkersPrefix is the prefix of the top talkers of HTTPServers.
+const TopTalkersPrefix = "/toptalkers"
+
+func (s *Server) topTalkersAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    TopTalkersPrefix,
+			Method:  "GET",
+			Handler: s.listTopTalkers,
+		},
+		{
+			Path:    TopTalkersPrefix + "/{name}",
+			Method:  "GET",
+			Handler: s.getTopTalkers,
+		},
+	}
+}
+
+// listTopTalkers returns the top talkers of all HTTPServers of this member.
+func (s *Server) listTopTalkers(w http.ResponseWriter, r *http.Request) {
+	snapshots := map[string]*toptalkers.Snapshot{}
+	for _, owner := range toptalkers.Owners() {
+		if tracker, exists := toptalkers.Get(owner); exists {
+			snapshots[owner] = tracker.Snapshot()
+		}
+	}
+
+	buff, err := yaml.Marshal(snapshots)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", snapshots, err))
+	}
+
+	w.Header().Set("Content-Type", "text/vnd.yaml")
+	w.Write(buff)
+}
+
+func (s *Server) getTopTalkers(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	tracker, exists := toptalkers.Get(name)
+	if !exists {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	snapshot := tracker.Snapshot()
+	buff, err := yaml.Marshal(snapshot)
+	if err != nil {
+		panic(fmt.Errorf("marshal %#v to yaml failed: %v", snapshot, err))
+	}
+
+	w.Header().Set("Content-Type", "text/vnd.yaml")
+	w.Write(buff)
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package discovery discovers the peer URLs of cluster members at bootstrap,
+// so that members of an autoscaling group could form or join the cluster
+// without static member lists.
+//
+// The discovered URLs are sorted, so every member gets the same list, and the
+// member whose advertised peer URL is the first one starts the new cluster,
+// the others join it.
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ModeDNSSRV discovers peers by DNS SRV records.
+	ModeDNSSRV = "dns-srv"
+	// ModeEC2 discovers peers by tags of AWS EC2 instances.
+	ModeEC2 = "ec2"
+	// ModeGCE discovers peers by labels of GCE instances.
+	ModeGCE = "gce"
+
+	retryInterval = 3 * time.Second
+	httpTimeout   = 10 * time.Second
+)
+
+type (
+	// Spec describes how to discover peers.
+	Spec struct {
+		Mode string
+		// SRVName is the full SRV record name for dns-srv mode,
+		// e.g. _eg-peer._tcp.example.com
+		SRVName string
+		// Tag is the key=value pair to filter instances for ec2/gce mode.
+		Tag string
+		// PeerScheme and PeerPort are used to build peer URLs from
+		// addresses of instances for ec2/gce mode.
+		PeerScheme string
+		PeerPort   int
+		// Timeout is the max duration to wait for at least one peer.
+		Timeout time.Duration
+	}
+
+	discoverer interface {
+		discover() ([]string, error)
+	}
+)
+
+var httpClient = &http.Client{Timeout: httpTimeout}
+
+// Validate validates Spec.
+func (s *Spec) Validate() error {
+	switch s.Mode {
+	case ModeDNSSRV:
+		if s.SRVName == "" {
+			return fmt.Errorf("dns-srv discovery needs srv name")
+		}
+		return nil
+	case ModeEC2, ModeGCE:
+		if _, _, err := s.tagKeyValue(); err != nil {
+			return err
+		}
+		if s.PeerPort <= 0 || s.PeerPort > 65535 {
+			return fmt.Errorf("invalid peer port %d", s.PeerPort)
+		}
+		if s.PeerScheme != "http" && s.PeerScheme != "https" {
+			return fmt.Errorf("invalid peer scheme %s", s.PeerScheme)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported discovery mode %s (support %s, %s, %s)",
+			s.Mode, ModeDNSSRV, ModeEC2, ModeGCE)
+	}
+}
+
+func (s *Spec) tagKeyValue() (string, string, error) {
+	kv := strings.SplitN(s.Tag, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return "", "", fmt.Errorf("invalid discovery tag %q, want key=value", s.Tag)
+	}
+	return kv[0], kv[1], nil
+}
+
+func (s *Spec) peerURL(host string) string {
+	return s.PeerScheme + "://" + net.JoinHostPort(host, strconv.Itoa(s.PeerPort))
+}
+
+// Discover returns the sorted peer URLs, it retries until at least one peer
+// is found or the timeout is reached.
+func Discover(spec *Spec) ([]string, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	var d discoverer
+	switch spec.Mode {
+	case ModeDNSSRV:
+		d = &dnsSRV{spec: spec}
+	case ModeEC2:
+		d = &ec2{spec: spec}
+	case ModeGCE:
+		d = &gce{spec: spec}
+	}
+
+	deadline := time.Now().Add(spec.Timeout)
+	for {
+		urls, err := d.discover()
+		if err == nil && len(urls) != 0 {
+			sort.Strings(urls)
+			return dedup(urls), nil
+		}
+		if err == nil {
+			err = fmt.Errorf("no peer found")
+		}
+
+		if time.Now().Add(retryInterval).After(deadline) {
+			return nil, fmt.Errorf("%s discovery failed: %v", spec.Mode, err)
+		}
+		time.Sleep(retryInterval)
+	}
+}
+
+func dedup(sorted []string) []string {
+	result := sorted[:0]
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	invalid := []*Spec{
+		{Mode: "unknown"},
+		{Mode: ModeDNSSRV},
+		{Mode: ModeEC2, Tag: "novalue", PeerScheme: "http", PeerPort: 2380},
+		{Mode: ModeGCE, Tag: "k=v", PeerScheme: "ftp", PeerPort: 2380},
+		{Mode: ModeGCE, Tag: "k=v", PeerScheme: "http", PeerPort: 0},
+	}
+	for _, s := range invalid {
+		if err := s.Validate(); err == nil {
+			t.Errorf("spec %+v should be invalid", s)
+		}
+	}
+}
+
+func TestDNSSRV(t *testing.T) {
+	lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		if name != "_eg-peer._tcp.example.com" {
+			return "", nil, fmt.Errorf("no such host")
+		}
+		return "", []*net.SRV{
+			{Target: "node2.example.com.", Port: 2380},
+			{Target: "node1.example.com.", Port: 2380},
+			{Target: "node1.example.com.", Port: 2380},
+		}, nil
+	}
+	defer func() { lookupSRV = net.LookupSRV }()
+
+	urls, err := Discover(&Spec{Mode: ModeDNSSRV, SRVName: "_eg-peer._tcp.example.com"})
+	if err != nil {
+		t.Fatalf("discover failed: %v", err)
+	}
+
+	expected := []string{"http://node1.example.com:2380", "http://node2.example.com:2380"}
+	if !reflect.DeepEqual(urls, expected) {
+		t.Errorf("expect %v, got %v", expected, urls)
+	}
+
+	if _, err := Discover(&Spec{Mode: ModeDNSSRV, SRVName: "unknown"}); err == nil {
+		t.Errorf("discover should fail")
+	}
+}
+
+func TestGCE(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/computeMetadata/v1/project/project-id":
+			w.Write([]byte("demo"))
+		case "/computeMetadata/v1/instance/service-accounts/default/token":
+			w.Write([]byte(`{"access_token":"token"}`))
+		case "/compute/v1/projects/demo/aggregated/instances":
+			if r.Header.Get("Authorization") != "Bearer token" ||
+				r.URL.Query().Get("filter") != "labels.role=gateway" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`{"items":{"zones/a":{"instances":[
+				{"status":"RUNNING","networkInterfaces":[{"networkIP":"10.0.0.2"}]},
+				{"status":"STOPPED","networkInterfaces":[{"networkIP":"10.0.0.3"}]},
+				{"status":"RUNNING","networkInterfaces":[{"networkIP":"10.0.0.1"}]}
+			]}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	gceMetadataEndpoint, gceComputeEndpoint = server.URL, server.URL
+
+	urls, err := Discover(&Spec{Mode: ModeGCE, Tag: "role=gateway", PeerScheme: "http", PeerPort: 2380})
+	if err != nil {
+		t.Fatalf("discover failed: %v", err)
+	}
+
+	expected := []string{"http://10.0.0.1:2380", "http://10.0.0.2:2380"}
+	if !reflect.DeepEqual(urls, expected) {
+		t.Errorf("expect %v, got %v", expected, urls)
+	}
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// lookupSRV is a variable for testing.
+var lookupSRV = net.LookupSRV
+
+type dnsSRV struct {
+	spec *Spec
+}
+
+func (d *dnsSRV) discover() ([]string, error) {
+	_, records, err := lookupSRV("", "", d.spec.SRVName)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := d.spec.PeerScheme
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	var urls []string
+	for _, r := range records {
+		host := strings.TrimSuffix(r.Target, ".")
+		urls = append(urls, scheme+"://"+net.JoinHostPort(host, strconv.Itoa(int(r.Port))))
+	}
+
+	return urls, nil
+}
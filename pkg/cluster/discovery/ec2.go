@@ -0,0 +1,192 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/signer"
+)
+
+// ec2MetadataEndpoint is a variable for testing.
+var ec2MetadataEndpoint = "http://169.254.169.254"
+
+var awsLiteral = &signer.Literal{
+	ScopeSuffix:      "aws4_request",
+	AlgorithmName:    "X-Amz-Algorithm",
+	AlgorithmValue:   "AWS4-HMAC-SHA256",
+	SignedHeaders:    "X-Amz-SignedHeaders",
+	Signature:        "X-Amz-Signature",
+	Date:             "X-Amz-Date",
+	Expires:          "X-Amz-Expires",
+	Credential:       "X-Amz-Credential",
+	ContentSHA256:    "X-Amz-Content-Sha256",
+	SigningKeyPrefix: "AWS4",
+}
+
+type (
+	ec2 struct {
+		spec *Spec
+	}
+
+	ec2Credentials struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string `json:"SecretAccessKey"`
+		Token           string `json:"Token"`
+	}
+
+	ec2DescribeInstancesResponse struct {
+		Reservations []struct {
+			Instances []struct {
+				PrivateIPAddress string `xml:"privateIpAddress"`
+			} `xml:"instancesSet>item"`
+		} `xml:"reservationSet>item"`
+	}
+)
+
+// metadata gets the value of path from instance metadata service with IMDSv2.
+func (e *ec2) metadata(token, path string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, ec2MetadataEndpoint+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	return doRequest(req)
+}
+
+func (e *ec2) metadataToken() (string, error) {
+	req, err := http.NewRequest(http.MethodPut, ec2MetadataEndpoint+"/latest/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	return doRequest(req)
+}
+
+func (e *ec2) credentials(token string) (*ec2Credentials, error) {
+	const path = "/latest/meta-data/iam/security-credentials/"
+
+	roles, err := e.metadata(token, path)
+	if err != nil {
+		return nil, err
+	}
+	role := strings.TrimSpace(strings.Split(roles, "\n")[0])
+	if role == "" {
+		return nil, fmt.Errorf("no iam role attached to the instance")
+	}
+
+	body, err := e.metadata(token, path+role)
+	if err != nil {
+		return nil, err
+	}
+
+	cred := &ec2Credentials{}
+	if err := json.Unmarshal([]byte(body), cred); err != nil {
+		return nil, fmt.Errorf("unmarshal credentials failed: %v", err)
+	}
+	return cred, nil
+}
+
+func (e *ec2) discover() ([]string, error) {
+	token, err := e.metadataToken()
+	if err != nil {
+		return nil, fmt.Errorf("get metadata token failed: %v", err)
+	}
+
+	region, err := e.metadata(token, "/latest/meta-data/placement/region")
+	if err != nil {
+		return nil, fmt.Errorf("get region failed: %v", err)
+	}
+
+	cred, err := e.credentials(token)
+	if err != nil {
+		return nil, fmt.Errorf("get credentials failed: %v", err)
+	}
+
+	key, value, _ := e.spec.tagKeyValue()
+	query := url.Values{}
+	query.Set("Action", "DescribeInstances")
+	query.Set("Version", "2016-11-15")
+	query.Set("Filter.1.Name", "tag:"+key)
+	query.Set("Filter.1.Value.1", value)
+	query.Set("Filter.2.Name", "instance-state-name")
+	query.Set("Filter.2.Value.1", "running")
+
+	endpoint := fmt.Sprintf("https://ec2.%s.amazonaws.com/?%s", region, query.Encode())
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cred.Token != "" {
+		req.Header.Set("X-Amz-Security-Token", cred.Token)
+	}
+
+	s := signer.New().SetLiteral(awsLiteral).SetCredential(cred.AccessKeyID, cred.SecretAccessKey)
+	if err := s.NewContext(time.Now(), region, "ec2").Sign(req); err != nil {
+		return nil, fmt.Errorf("sign request failed: %v", err)
+	}
+
+	body, err := doRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("describe instances failed: %v", err)
+	}
+
+	resp := &ec2DescribeInstancesResponse{}
+	if err := xml.Unmarshal([]byte(body), resp); err != nil {
+		return nil, fmt.Errorf("unmarshal describe instances response failed: %v", err)
+	}
+
+	var urls []string
+	for _, r := range resp.Reservations {
+		for _, i := range r.Instances {
+			if i.PrivateIPAddress != "" {
+				urls = append(urls, e.spec.peerURL(i.PrivateIPAddress))
+			}
+		}
+	}
+
+	return urls, nil
+}
+
+func doRequest(req *http.Request) (string, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 16*1024*1024))
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s %s: status code %d: %s",
+			req.Method, req.URL.Path, resp.StatusCode, body)
+	}
+
+	return string(body), nil
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// gceMetadataEndpoint and gceComputeEndpoint are variables for testing.
+var (
+	gceMetadataEndpoint = "http://metadata.google.internal"
+	gceComputeEndpoint  = "https://compute.googleapis.com"
+)
+
+type (
+	gce struct {
+		spec *Spec
+	}
+
+	gceToken struct {
+		AccessToken string `json:"access_token"`
+	}
+
+	gceAggregatedInstances struct {
+		Items map[string]struct {
+			Instances []struct {
+				Status            string `json:"status"`
+				NetworkInterfaces []struct {
+					NetworkIP string `json:"networkIP"`
+				} `json:"networkInterfaces"`
+			} `json:"instances"`
+		} `json:"items"`
+		NextPageToken string `json:"nextPageToken"`
+	}
+)
+
+func (g *gce) metadata(path string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, gceMetadataEndpoint+"/computeMetadata/v1"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	return doRequest(req)
+}
+
+func (g *gce) discover() ([]string, error) {
+	project, err := g.metadata("/project/project-id")
+	if err != nil {
+		return nil, fmt.Errorf("get project id failed: %v", err)
+	}
+
+	body, err := g.metadata("/instance/service-accounts/default/token")
+	if err != nil {
+		return nil, fmt.Errorf("get access token failed: %v", err)
+	}
+	token := &gceToken{}
+	if err := json.Unmarshal([]byte(body), token); err != nil {
+		return nil, fmt.Errorf("unmarshal access token failed: %v", err)
+	}
+
+	key, value, _ := g.spec.tagKeyValue()
+	query := url.Values{}
+	query.Set("filter", fmt.Sprintf("labels.%s=%s", key, value))
+
+	var urls []string
+	for {
+		endpoint := fmt.Sprintf("%s/compute/v1/projects/%s/aggregated/instances?%s",
+			gceComputeEndpoint, url.PathEscape(project), query.Encode())
+		req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+		body, err := doRequest(req)
+		if err != nil {
+			return nil, fmt.Errorf("list instances failed: %v", err)
+		}
+
+		resp := &gceAggregatedInstances{}
+		if err := json.Unmarshal([]byte(body), resp); err != nil {
+			return nil, fmt.Errorf("unmarshal instances failed: %v", err)
+		}
+
+		for _, item := range resp.Items {
+			for _, instance := range item.Instances {
+				if instance.Status != "RUNNING" || len(instance.NetworkInterfaces) == 0 {
+					continue
+				}
+				ip := instance.NetworkInterfaces[0].NetworkIP
+				if ip != "" {
+					urls = append(urls, g.spec.peerURL(ip))
+				}
+			}
+		}
+
+		if resp.NextPageToken == "" {
+			return urls, nil
+		}
+		query.Set("pageToken", resp.NextPageToken)
+	}
+}
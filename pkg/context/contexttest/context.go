@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/tracing"
 	"github.com/megaease/easegress/pkg/util/httpstat"
 	"github.com/megaease/easegress/pkg/util/texttemplate"
@@ -34,6 +35,7 @@ type MockedHTTPContext struct {
 	MockedLock               func()
 	MockedUnlock             func()
 	MockedSpan               func() tracing.Span
+	MockedBaggage            func() *tracing.Baggage
 	MockedRequest            MockedHTTPRequest
 	MockedResponse           MockedHTTPResponse
 	MockedDeadline           func() (time.Time, bool)
@@ -43,9 +45,13 @@ type MockedHTTPContext struct {
 	MockedCancel             func(err error)
 	MockedCancelled          func() bool
 	MockedClientDisconnected func() bool
+	MockedLogger             func() *logger.ContextLogger
 	MockedDuration           func() time.Duration
 	MockedOnFinish           func(func())
 	MockedAddTag             func(tag string)
+	MockedTags               func() []string
+	MockedSetKV              func(key string, value interface{})
+	MockedKVs                func() map[string]interface{}
 	MockedStatMetric         func() *httpstat.Metric
 	MockedLog                func() string
 	MockedFinish             func()
@@ -79,6 +85,14 @@ func (c *MockedHTTPContext) Span() tracing.Span {
 	return tracing.NewSpan(tracing.NoopTracing, "mocked")
 }
 
+// Baggage mocks the Baggage function of HTTPContext
+func (c *MockedHTTPContext) Baggage() *tracing.Baggage {
+	if c.MockedBaggage != nil {
+		return c.MockedBaggage()
+	}
+	return tracing.NewBaggage()
+}
+
 // Request mocks the Request function of HTTPContext
 func (c *MockedHTTPContext) Request() context.HTTPRequest {
 	return &c.MockedRequest
@@ -144,6 +158,14 @@ func (c *MockedHTTPContext) ClientDisconnected() bool {
 	return false
 }
 
+// Logger mocks the Logger function of HTTPContext
+func (c *MockedHTTPContext) Logger() *logger.ContextLogger {
+	if c.MockedLogger != nil {
+		return c.MockedLogger()
+	}
+	return nil
+}
+
 // Duration mocks the Duration function of HTTPContext
 func (c *MockedHTTPContext) Duration() time.Duration {
 	if c.MockedDuration != nil {
@@ -169,6 +191,29 @@ func (c *MockedHTTPContext) AddTag(tag string) {
 	}
 }
 
+// Tags mocks the Tags function of HTTPContext
+func (c *MockedHTTPContext) Tags() []string {
+	if c.MockedTags != nil {
+		return c.MockedTags()
+	}
+	return nil
+}
+
+// SetKV mocks the SetKV function of HTTPContext
+func (c *MockedHTTPContext) SetKV(key string, value interface{}) {
+	if c.MockedSetKV != nil {
+		c.MockedSetKV(key, value)
+	}
+}
+
+// KVs mocks the KVs function of HTTPContext
+func (c *MockedHTTPContext) KVs() map[string]interface{} {
+	if c.MockedKVs != nil {
+		return c.MockedKVs()
+	}
+	return nil
+}
+
 // StatMetric mocks the StatMetric function of HTTPContext
 func (c *MockedHTTPContext) StatMetric() *httpstat.Metric {
 	if c.MockedStatMetric != nil {
@@ -18,7 +18,10 @@
 package contexttest
 
 import (
+	"bufio"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 
@@ -34,6 +37,7 @@ type MockedHTTPResponse struct {
 	MockedSetBody       func(body io.Reader)
 	MockedBody          func() io.Reader
 	MockedOnFlushBody   func(func(body []byte, complete bool) (newBody []byte))
+	MockedHijack        func() (net.Conn, *bufio.ReadWriter, error)
 	MockedStd           func() http.ResponseWriter
 	MockedSize          func() uint64
 }
@@ -90,6 +94,14 @@ func (r *MockedHTTPResponse) OnFlushBody(fn func(body []byte, complete bool) (ne
 	}
 }
 
+// Hijack takes over the connection of the client
+func (r *MockedHTTPResponse) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if r.MockedHijack != nil {
+		return r.MockedHijack()
+	}
+	return nil, nil, fmt.Errorf("hijacking not supported")
+}
+
 // Std returns the standard response
 func (r *MockedHTTPResponse) Std() http.ResponseWriter {
 	if r.MockedStd != nil {
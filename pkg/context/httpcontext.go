@@ -18,9 +18,11 @@
 package context
 
 import (
+	"bufio"
 	stdcontext "context"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"runtime/debug"
 	"strings"
@@ -38,6 +40,15 @@ import (
 	"github.com/megaease/easegress/pkg/util/timetool"
 )
 
+const (
+	// KeyBackend is the key of the structured tag of the last server
+	// tried by the proxies.
+	KeyBackend = "backend"
+	// KeyBackendDuration is the key of the structured tag of the
+	// duration of the last request to the backend.
+	KeyBackendDuration = "backendDuration"
+)
+
 type (
 	// HandlerCaller is a helper function to call the handler
 	HandlerCaller func(lastResult string) string
@@ -50,6 +61,9 @@ type (
 		Unlock()
 
 		Span() tracing.Span
+		// Baggage returns the W3C Baggage parsed from the request, the
+		// changes of filters are propagated to upstream by Proxy.
+		Baggage() *tracing.Baggage
 
 		Request() HTTPRequest
 		Response() HTTPResponse
@@ -59,9 +73,21 @@ type (
 		Cancelled() bool
 		ClientDisconnected() bool
 
+		// Logger returns the logger attaching the trace_id and span_id
+		// of the request to the log lines if the tracing is enabled.
+		Logger() *logger.ContextLogger
+
 		Duration() time.Duration // For log, sample, etc.
 		OnFinish(func())         // For setting final client statistics, etc.
 		AddTag(tag string)       // For debug, log, etc.
+		// Tags returns the tags added by AddTag.
+		Tags() []string
+		// SetKV sets the structured tag, the value of the same key is
+		// overwritten, it's cheaper than AddTag since nothing is
+		// formatted until the tags are logged.
+		SetKV(key string, value interface{})
+		// KVs returns a copy of the structured tags set by SetKV.
+		KVs() map[string]interface{}
 
 		StatMetric() *httpstat.Metric
 		Log() string
@@ -122,6 +148,10 @@ type (
 		Body() io.Reader
 		OnFlushBody(func(body []byte, complete bool) (newBody []byte))
 
+		// Hijack takes over the connection of the client, the status
+		// code, header and body are not written after that.
+		Hijack() (net.Conn, *bufio.ReadWriter, error)
+
 		Std() http.ResponseWriter
 
 		Size() uint64 // bytes
@@ -138,6 +168,8 @@ type (
 		endTime     *time.Time
 		finishFuncs []FinishFunc
 		tags        []string
+		kvs         map[string]interface{}
+		kvKeys      []string // in the order of the first setting
 		caller      HandlerCaller
 
 		r *httpRequest
@@ -146,6 +178,8 @@ type (
 		ht             *HTTPTemplate
 		tracer         opentracing.Tracer
 		span           tracing.Span
+		logger         *logger.ContextLogger
+		baggage        *tracing.Baggage
 		originalReqCtx stdcontext.Context
 		stdctx         stdcontext.Context
 		cancelFunc     stdcontext.CancelFunc
@@ -163,10 +197,12 @@ func New(stdw http.ResponseWriter, stdr *http.Request,
 	stdr = stdr.WithContext(stdctx)
 
 	startTime := time.Now()
+	span := tracing.NewSpan(tracer, spanName)
 	return &httpContext{
 		startTime:      &startTime,
 		tracer:         tracer,
-		span:           tracing.NewSpan(tracer, spanName),
+		span:           span,
+		logger:         newContextLogger(span),
 		originalReqCtx: originalReqCtx,
 		stdctx:         stdctx,
 		cancelFunc:     cancelFunc,
@@ -176,6 +212,18 @@ func New(stdw http.ResponseWriter, stdr *http.Request,
 	}
 }
 
+func newContextLogger(span tracing.Span) *logger.ContextLogger {
+	traceID, spanID := tracing.SpanIDs(span)
+	if traceID == "" {
+		return nil
+	}
+	return logger.WithFields("trace_id", traceID, "span_id", spanID)
+}
+
+func (ctx *httpContext) Logger() *logger.ContextLogger {
+	return ctx.logger
+}
+
 func (ctx *httpContext) CallNextHandler(lastResult string) string {
 	return ctx.caller(lastResult)
 }
@@ -196,10 +244,45 @@ func (ctx *httpContext) Span() tracing.Span {
 	return ctx.span
 }
 
+func (ctx *httpContext) Baggage() *tracing.Baggage {
+	// NOTE: It's parsed lazily because most requests don't carry baggage.
+	if ctx.baggage == nil {
+		baggage, err := tracing.ParseBaggage(ctx.r.Header().GetAll(httpheader.KeyBaggage))
+		if err != nil {
+			ctx.AddTag(err.Error())
+		}
+		ctx.baggage = baggage
+	}
+
+	return ctx.baggage
+}
+
 func (ctx *httpContext) AddTag(tag string) {
 	ctx.tags = append(ctx.tags, tag)
 }
 
+func (ctx *httpContext) Tags() []string {
+	return ctx.tags
+}
+
+func (ctx *httpContext) SetKV(key string, value interface{}) {
+	if ctx.kvs == nil {
+		ctx.kvs = make(map[string]interface{})
+	}
+	if _, exists := ctx.kvs[key]; !exists {
+		ctx.kvKeys = append(ctx.kvKeys, key)
+	}
+	ctx.kvs[key] = value
+}
+
+func (ctx *httpContext) KVs() map[string]interface{} {
+	kvs := make(map[string]interface{}, len(ctx.kvs))
+	for k, v := range ctx.kvs {
+		kvs[k] = v
+	}
+	return kvs
+}
+
 func (ctx *httpContext) Request() HTTPRequest {
 	return ctx.r
 }
@@ -273,7 +356,7 @@ func (ctx *httpContext) Finish() {
 		func() {
 			defer func() {
 				if err := recover(); err != nil {
-					logger.Errorf("failed to handle finish actions for %s: %v, stack trace: \n%s\n",
+					ctx.logger.Errorf("failed to handle finish actions for %s: %v, stack trace: \n%s\n",
 						ctx.Request().Path(), err, debug.Stack())
 				}
 			}()
@@ -306,7 +389,16 @@ func (ctx *httpContext) Log() string {
 	// [$startTime]
 	// [$remoteAddr $realIP $method $requestURL $proto $statusCode]
 	// [$contextDuration $readBytes $writeBytes]
-	// [$tags]
+	// [$tags | $key: $value]
+	tags := ctx.tags
+	if len(ctx.kvKeys) != 0 {
+		tags = make([]string, 0, len(ctx.tags)+len(ctx.kvKeys))
+		tags = append(tags, ctx.tags...)
+		for _, k := range ctx.kvKeys {
+			tags = append(tags, fmt.Sprintf("%s: %v", k, ctx.kvs[k]))
+		}
+	}
+
 	return fmt.Sprintf("[%s] "+
 		"[%s %s %s %s %s %d] "+
 		"[%v rx:%dB tx:%dB] "+
@@ -314,7 +406,7 @@ func (ctx *httpContext) Log() string {
 		ctx.startTime.Format(timetool.RFC3339Milli),
 		stdr.RemoteAddr, ctx.r.RealIP(), stdr.Method, stdr.RequestURI, stdr.Proto, ctx.w.code,
 		ctx.Duration(), ctx.r.Size(), ctx.w.Size(),
-		strings.Join(ctx.tags, " | "))
+		strings.Join(tags, " | "))
 }
 
 // Template returns the template engine
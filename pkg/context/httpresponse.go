@@ -18,8 +18,11 @@
 package context
 
 import (
+	"bufio"
 	"bytes"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
@@ -46,6 +49,8 @@ type (
 		body           io.Reader
 		bodyWritten    uint64
 		bodyFlushFuncs []BodyFlushFunc
+
+		hijacked bool
 	}
 )
 
@@ -159,7 +164,27 @@ func (w *httpResponse) FlushedBodyBytes() uint64 {
 	return w.bodyWritten
 }
 
+// Hijack takes over the connection of the client.
+func (w *httpResponse) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.std.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer is not a hijacker")
+	}
+
+	conn, brw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.hijacked = true
+	return conn, brw, nil
+}
+
 func (w *httpResponse) finish() {
+	// NOTE: The hijacked connection is owned by the caller of Hijack.
+	if w.hijacked {
+		return
+	}
+
 	// NOTE: WriteHeader must be called at most one time.
 	w.std.WriteHeader(w.StatusCode())
 	w.flushBody()
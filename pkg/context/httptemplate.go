@@ -21,7 +21,6 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"strconv"
 	"strings"
 
 	"github.com/megaease/easegress/pkg/logger"
@@ -38,6 +37,9 @@ const (
 	filterReqheader     = "filter.%s.req.header.%s"
 	filterRspStatusCode = "filter.%s.rsp.statuscode"
 	filterRspBody       = "filter.%s.rsp.body"
+	filterResult        = "filter.%s.result"
+
+	filterResultTag = "result"
 
 	defaultMaxBodySize = 10240
 	defaultTagNum      = 4
@@ -59,6 +61,9 @@ type (
 
 		// the dependency order array of filters
 		filtersOrder []string
+
+		// the filters whose results are referenced
+		resultFilters map[string]bool
 	}
 
 	setDictFunc func(*HTTPTemplate, string, HTTPContext) error
@@ -81,12 +86,15 @@ var (
 		"filter.{}.req.body",
 		"filter.{}.req.scheme",
 		"filter.{}.req.path",
+		"filter.{}.req.path.{regexp}",
 		"filter.{}.req.proto",
 		"filter.{}.req.host",
 		"filter.{}.req.body.{gjson}",
 		"filter.{}.req.header.{}",
+		"filter.{}.req.header.{}.{regexp}",
 		"filter.{}.rsp.statuscode",
 		"filter.{}.rsp.body.{gjson}",
+		"filter.{}.result",
 	}
 
 	tagsFuncMap = map[string]setDictFunc{
@@ -104,7 +112,8 @@ var (
 
 // NewHTTPTemplate returns a default HTTPTemplate
 func NewHTTPTemplate(filterBuffs []FilterBuff) (*HTTPTemplate, error) {
-	engine, err := texttemplate.NewDefault(metaTemplates)
+	allTemplates := allMetaTemplates()
+	engine, err := texttemplate.NewDefault(allTemplates)
 	if err != nil {
 		logger.Errorf("init http template fail [%v]", err)
 		return nil, err
@@ -112,11 +121,13 @@ func NewHTTPTemplate(filterBuffs []FilterBuff) (*HTTPTemplate, error) {
 
 	e := HTTPTemplate{
 		Engine:          engine,
-		metaTemplates:   metaTemplates,
+		metaTemplates:   allTemplates,
 		filterExecFuncs: map[string]filterDictFuncs{},
+		resultFilters:   map[string]bool{},
 	}
 
 	filterFuncTags := map[string][]string{}
+	filterProviderFuncs := map[string][]setDictFunc{}
 	// validates the filter's YAML spec for dependency checking
 	// and template format,e.g., if filter1 has a template said '[[filter.filter2.rsp.data]],
 	// but it appears before filter2, then it's an invalidated dependency cause we can't get
@@ -137,6 +148,25 @@ func NewHTTPTemplate(filterBuffs []FilterBuff) (*HTTPTemplate, error) {
 			}
 
 			tags := strings.Split(renderMeta, texttemplate.DefaultSeparator)
+			// builtin templates are resolved by the engine itself
+			if tags[0] == texttemplate.BuiltinNamespace {
+				continue
+			}
+
+			// templates of providers are set before the filter referencing them
+			if p, exists := tagProviders[tags[0]]; exists {
+				filterProviderFuncs[filterBuff.Name] = append(filterProviderFuncs[filterBuff.Name],
+					providerDictFunc(p, template))
+				continue
+			}
+
+			// the result of a filter is set after it called the next handler
+			if len(tags) == defaultTagNum-1 && tags[filterReqRspTagIndex] == filterResultTag {
+				dependFilters = append(dependFilters, tags[filterNameTagIndex])
+				e.resultFilters[tags[filterNameTagIndex]] = true
+				continue
+			}
+
 			if len(tags) < defaultTagNum {
 				err = fmt.Errorf("filter %s template [[%s]] check failed,its render metaTemplate [[%s]] is invalid",
 					filterBuff.Name, template, renderMeta)
@@ -171,6 +201,7 @@ func NewHTTPTemplate(filterBuffs []FilterBuff) (*HTTPTemplate, error) {
 	}
 
 	e.storeFilterExecFuncs(filterFuncTags)
+	e.storeProviderFuncs(filterProviderFuncs)
 
 	return &e, nil
 }
@@ -180,6 +211,7 @@ func NewHTTPTemplateDummy() *HTTPTemplate {
 	return &HTTPTemplate{
 		Engine:          texttemplate.NewDummyTemplate(),
 		filterExecFuncs: map[string]filterDictFuncs{},
+		resultFilters:   map[string]bool{},
 	}
 }
 
@@ -253,6 +285,16 @@ func (e *HTTPTemplate) SaveResponse(filterName string, ctx HTTPContext) error {
 	return nil
 }
 
+// SaveResult stores the result of the filter into template engine's dictionary,
+// the result is empty if the filter succeeded. It's only stored if some filter
+// references it.
+func (e *HTTPTemplate) SaveResult(filterName, result string) error {
+	if !e.resultFilters[filterName] {
+		return nil
+	}
+	return e.Engine.SetDict(fmt.Sprintf(filterResult, filterName), result)
+}
+
 // Render using engine to render template
 func (e *HTTPTemplate) Render(input string) (string, error) {
 	return e.Engine.Render(input)
@@ -305,8 +347,16 @@ func (e *HTTPTemplate) storeFilterExecFuncs(filterFuncTags map[string][]string)
 	}
 }
 
+func (e *HTTPTemplate) storeProviderFuncs(filterProviderFuncs map[string][]setDictFunc) {
+	for filterName, funcs := range filterProviderFuncs {
+		execFuncs := e.filterExecFuncs[filterName]
+		execFuncs.reqFuncs = append(execFuncs.reqFuncs, funcs...)
+		e.filterExecFuncs[filterName] = execFuncs
+	}
+}
+
 func saveRspStatuscode(e *HTTPTemplate, filterName string, ctx HTTPContext) error {
-	return e.Engine.SetDict(fmt.Sprintf(filterRspStatusCode, filterName), strconv.Itoa(ctx.Response().StatusCode()))
+	return e.Engine.SetDict(fmt.Sprintf(filterRspStatusCode, filterName), ctx.Response().StatusCode())
 }
 
 func saveReqHost(e *HTTPTemplate, filterName string, ctx HTTPContext) error {
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package context
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/valyala/fasttemplate"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/texttemplate"
+)
+
+type (
+	// TagProvider contributes the templates under its namespace, e.g. the
+	// provider of namespace "geo" could provide [[geo.country]].
+	// The value of a template is computed at rendering, and only if the
+	// template is referenced by the filters of the pipeline.
+	TagProvider interface {
+		// Namespace returns the first tag of the templates, e.g. "geo".
+		Namespace() string
+
+		// MetaTemplates returns the meta templates of the provider,
+		// e.g. "geo.country", "geo.{}". {gjson}, {jsonpath} and {regexp} are not supported.
+		MetaTemplates() []string
+
+		// Provide returns the value of the template for the HTTPContext.
+		Provide(ctx HTTPContext, template string) (string, error)
+	}
+)
+
+var tagProviders = map[string]TagProvider{}
+
+// RegisterTagProvider registers a TagProvider, it must be called in init
+// of the component, because the templates are checked while building pipelines.
+func RegisterTagProvider(p TagProvider) {
+	namespace := p.Namespace()
+	if namespace == "" || strings.Contains(namespace, texttemplate.DefaultSeparator) {
+		panic(fmt.Errorf("%T: invalid namespace %q", p, namespace))
+	}
+	if namespace == "filter" || namespace == texttemplate.BuiltinNamespace ||
+		namespace == texttemplate.ItemTag || namespace == texttemplate.IndexTag {
+		panic(fmt.Errorf("%T: namespace %s is reserved", p, namespace))
+	}
+	if existed, exists := tagProviders[namespace]; exists {
+		panic(fmt.Errorf("%T and %T got same namespace: %s", p, existed, namespace))
+	}
+
+	if len(p.MetaTemplates()) == 0 {
+		panic(fmt.Errorf("%T: empty meta templates", p))
+	}
+	for _, mt := range p.MetaTemplates() {
+		if !strings.HasPrefix(mt, namespace+texttemplate.DefaultSeparator) {
+			panic(fmt.Errorf("%T: meta template %s not in namespace %s", p, mt, namespace))
+		}
+		if strings.Contains(mt, texttemplate.GJSONTag) || strings.Contains(mt, texttemplate.JSONPathTag) ||
+			strings.Contains(mt, texttemplate.RegexpTag) {
+			panic(fmt.Errorf("%T: meta template %s got unsupported syntax tag", p, mt))
+		}
+	}
+
+	tagProviders[namespace] = p
+}
+
+// MetaTemplates returns the meta templates of HTTP pipelines, including
+// the ones of the registered providers.
+func MetaTemplates() []string {
+	return allMetaTemplates()
+}
+
+// allMetaTemplates returns the builtin meta templates and the ones of providers.
+func allMetaTemplates() []string {
+	all := append([]string{}, metaTemplates...)
+	for _, p := range tagProviders {
+		all = append(all, p.MetaTemplates()...)
+	}
+	return all
+}
+
+// providerDictFunc returns the function setting a lazy value of the template
+// into dictionary, the provider is called when the template is being rendered.
+func providerDictFunc(p TagProvider, template string) setDictFunc {
+	return func(e *HTTPTemplate, filterName string, ctx HTTPContext) error {
+		tagFunc := func(w io.Writer, tag string) (int, error) {
+			value, err := p.Provide(ctx, template)
+			if err != nil {
+				// NOTE: fasttemplate panics on errors of TagFunc,
+				// so we render it empty.
+				logger.Errorf("filter %s provide template %s failed: %v", filterName, template, err)
+				return 0, nil
+			}
+			return io.WriteString(w, value)
+		}
+
+		return e.Engine.SetDict(template, fasttemplate.TagFunc(tagFunc))
+	}
+}
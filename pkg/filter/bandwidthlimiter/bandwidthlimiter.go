@@ -0,0 +1,206 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bandwidthlimiter
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/rejection"
+)
+
+const (
+	// Kind is the kind of BandwidthLimiter.
+	Kind                = "BandwidthLimiter"
+	resultQuotaExceeded = "quotaExceeded"
+
+	megabyte = 1024 * 1024
+)
+
+var results = []string{resultQuotaExceeded}
+
+func init() {
+	httppipeline.Register(&BandwidthLimiter{})
+}
+
+type (
+	// Spec is the configuration of a bandwidth limiter.
+	Spec struct {
+		// ConsumerHeader is the header identifying consumers, the real IP is used if it's empty.
+		ConsumerHeader string `yaml:"consumerHeader" jsonschema:"omitempty"`
+		// DailyQuota is the megabytes of response bodies sent to a consumer per day.
+		DailyQuota uint64 `yaml:"dailyQuota" jsonschema:"omitempty"`
+		// Rate is the bytes per second of response bodies sent to a consumer.
+		Rate  uint64 `yaml:"rate" jsonschema:"omitempty"`
+		Burst uint64 `yaml:"burst" jsonschema:"omitempty"`
+		// RejectionResponse is the name of the RejectionResponse
+		// responded when the requests are over the quota.
+		RejectionResponse string `yaml:"rejectionResponse,omitempty" jsonschema:"omitempty,format=rejectionresponse"`
+	}
+
+	// BandwidthLimiter accounts the bytes of response bodies sent to
+	// consumers, and limits them by a daily quota and a transfer rate.
+	BandwidthLimiter struct {
+		filterSpec *httppipeline.FilterSpec
+		spec       *Spec
+		quota      uint64
+		usage      *usage
+		buckets    *buckets
+	}
+
+	// Status is the status of BandwidthLimiter.
+	Status struct {
+		// BytesSent is the bytes sent to all consumers by the filter.
+		BytesSent uint64 `yaml:"bytesSent"`
+		// Day is the UTC date of Consumers.
+		Day string `yaml:"day"`
+		// Consumers is the bytes sent to every consumer in Day.
+		Consumers map[string]uint64 `yaml:"consumers"`
+	}
+)
+
+// Validate implements custom validation for Spec
+func (spec Spec) Validate() error {
+	if spec.Burst != 0 && spec.Rate == 0 {
+		return fmt.Errorf("burst needs rate")
+	}
+	return nil
+}
+
+// Kind returns the kind of BandwidthLimiter.
+func (bl *BandwidthLimiter) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of BandwidthLimiter.
+func (bl *BandwidthLimiter) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Description returns the description of BandwidthLimiter
+func (bl *BandwidthLimiter) Description() string {
+	return "BandwidthLimiter limits the bytes of responses sent to consumers."
+}
+
+// Results returns the results of BandwidthLimiter.
+func (bl *BandwidthLimiter) Results() []string {
+	return results
+}
+
+// Init initializes BandwidthLimiter.
+func (bl *BandwidthLimiter) Init(filterSpec *httppipeline.FilterSpec) {
+	bl.filterSpec, bl.spec = filterSpec, filterSpec.FilterSpec().(*Spec)
+	bl.reload(nil)
+}
+
+// Inherit inherits previous generation of BandwidthLimiter.
+func (bl *BandwidthLimiter) Inherit(filterSpec *httppipeline.FilterSpec, previousGeneration httppipeline.Filter) {
+	bl.filterSpec, bl.spec = filterSpec, filterSpec.FilterSpec().(*Spec)
+	bl.reload(previousGeneration.(*BandwidthLimiter))
+}
+
+// reload always inherits the usage, so updating the spec doesn't reset
+// the quotas, the buckets are inherited if the rate is not changed.
+func (bl *BandwidthLimiter) reload(previousGeneration *BandwidthLimiter) {
+	bl.quota = bl.spec.DailyQuota * megabyte
+
+	if previousGeneration == nil {
+		bl.usage = newUsage()
+	} else {
+		bl.usage = previousGeneration.usage
+	}
+
+	if bl.spec.Rate == 0 {
+		return
+	}
+	if previousGeneration != nil && previousGeneration.buckets != nil &&
+		previousGeneration.spec.Rate == bl.spec.Rate && previousGeneration.spec.Burst == bl.spec.Burst {
+		bl.buckets = previousGeneration.buckets
+		return
+	}
+	bl.buckets = newBuckets(bl.spec.Rate, bl.spec.Burst)
+}
+
+func (bl *BandwidthLimiter) consumerKey(ctx context.HTTPContext) string {
+	if bl.spec.ConsumerHeader != "" {
+		if key := ctx.Request().Header().Get(bl.spec.ConsumerHeader); key != "" {
+			return key
+		}
+	}
+	return ctx.Request().RealIP()
+}
+
+// Handle handles HTTP request
+func (bl *BandwidthLimiter) Handle(ctx context.HTTPContext) string {
+	now := time.Now()
+	key := bl.consumerKey(ctx)
+	counter := bl.usage.consumer(key, now)
+
+	if bl.quota != 0 && atomic.LoadUint64(counter) >= bl.quota {
+		tomorrow := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		ctx.AddTag("bandwidthLimiter: quota exceeded")
+		ctx.Response().SetStatusCode(http.StatusTooManyRequests)
+		ctx.Response().Header().Set("Retry-After", strconv.Itoa(int(tomorrow.Sub(now).Seconds())+1))
+		ctx.Response().Header().Set("X-EG-Bandwidth-Limiter", "quota-exceeded")
+		rejection.Respond(ctx, bl.spec.RejectionResponse, "quota exceeded")
+		return ctx.CallNextHandler(resultQuotaExceeded)
+	}
+
+	result := ctx.CallNextHandler("")
+
+	// NOTE: It's registered after the following filters, so it counts
+	// the bytes after their flushing functions.
+	buckets := bl.buckets
+	ctx.Response().OnFlushBody(func(body []byte, complete bool) []byte {
+		if buckets != nil && len(body) != 0 {
+			bl.wait(ctx, buckets.reserve(key, len(body), time.Now()))
+		}
+		bl.usage.add(counter, len(body))
+		return body
+	})
+
+	return result
+}
+
+func (bl *BandwidthLimiter) wait(ctx context.HTTPContext, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// Status returns Status generated by Runtime.
+func (bl *BandwidthLimiter) Status() interface{} {
+	return bl.usage.status()
+}
+
+// Close closes BandwidthLimiter.
+func (bl *BandwidthLimiter) Close() {
+}
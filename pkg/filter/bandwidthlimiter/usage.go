@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bandwidthlimiter
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// bucketPruneInterval is the min interval of removing the full buckets.
+const bucketPruneInterval = time.Minute
+
+type (
+	// usage accounts the bytes sent to consumers, the daily bytes are
+	// reset at 00:00 UTC.
+	usage struct {
+		// bytesSent is the bytes sent to all consumers, it must be
+		// accessed atomically.
+		bytesSent uint64
+
+		mutex     sync.Mutex
+		day       string
+		consumers map[string]*uint64
+	}
+
+	// buckets holds the token buckets limiting the transfer rate of consumers.
+	buckets struct {
+		rate  float64
+		burst float64
+
+		mutex     sync.Mutex
+		buckets   map[string]*bucket
+		lastPrune time.Time
+	}
+
+	bucket struct {
+		tokens    float64
+		updatedAt time.Time
+	}
+)
+
+func newUsage() *usage {
+	return &usage{consumers: map[string]*uint64{}}
+}
+
+// consumer returns the counter of the bytes sent to the consumer today.
+func (u *usage) consumer(key string, now time.Time) *uint64 {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if day := now.UTC().Format("2006-01-02"); day != u.day {
+		u.day = day
+		u.consumers = map[string]*uint64{}
+	}
+
+	counter := u.consumers[key]
+	if counter == nil {
+		counter = new(uint64)
+		u.consumers[key] = counter
+	}
+	return counter
+}
+
+// add adds n bytes sent to the consumer, whose counter is got by consumer.
+func (u *usage) add(counter *uint64, n int) {
+	atomic.AddUint64(counter, uint64(n))
+	atomic.AddUint64(&u.bytesSent, uint64(n))
+}
+
+func (u *usage) status() *Status {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	s := &Status{
+		BytesSent: atomic.LoadUint64(&u.bytesSent),
+		Day:       u.day,
+		Consumers: make(map[string]uint64, len(u.consumers)),
+	}
+	for key, counter := range u.consumers {
+		s.Consumers[key] = atomic.LoadUint64(counter)
+	}
+	return s
+}
+
+func newBuckets(rate, burst uint64) *buckets {
+	if burst == 0 {
+		burst = rate
+	}
+	return &buckets{
+		rate:      float64(rate),
+		burst:     float64(burst),
+		buckets:   map[string]*bucket{},
+		lastPrune: time.Now(),
+	}
+}
+
+// reserve takes n tokens from the bucket of the consumer, it returns
+// how long to wait before sending the n bytes. The tokens could go
+// negative, so a chunk larger than burst is delayed instead of rejected.
+func (bs *buckets) reserve(key string, n int, now time.Time) time.Duration {
+	bs.mutex.Lock()
+	defer bs.mutex.Unlock()
+
+	bs.prune(now)
+
+	b := bs.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: bs.burst, updatedAt: now}
+		bs.buckets[key] = b
+	}
+
+	b.tokens = bs.refill(b, now) - float64(n)
+	b.updatedAt = now
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / bs.rate * float64(time.Second))
+}
+
+func (bs *buckets) refill(b *bucket, now time.Time) float64 {
+	elapsed := now.Sub(b.updatedAt)
+	if elapsed <= 0 {
+		return b.tokens
+	}
+
+	tokens := b.tokens + elapsed.Seconds()*bs.rate
+	if tokens > bs.burst {
+		tokens = bs.burst
+	}
+	return tokens
+}
+
+// prune removes the buckets which are full, they are the same as
+// the new ones, it must be called with the lock held.
+func (bs *buckets) prune(now time.Time) {
+	if now.Sub(bs.lastPrune) < bucketPruneInterval {
+		return
+	}
+	bs.lastPrune = now
+
+	for key, b := range bs.buckets {
+		if bs.refill(b, now) >= bs.burst {
+			delete(bs.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bandwidthlimiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUsage(t *testing.T) {
+	u := newUsage()
+	now := time.Date(2021, 6, 1, 23, 0, 0, 0, time.UTC)
+
+	alice := u.consumer("alice", now)
+	u.add(alice, 100)
+	u.add(u.consumer("alice", now), 50)
+	u.add(u.consumer("bob", now), 10)
+
+	s := u.status()
+	if s.BytesSent != 160 || s.Day != "2021-06-01" {
+		t.Fatalf("unexpected status %+v", s)
+	}
+	if s.Consumers["alice"] != 150 || s.Consumers["bob"] != 10 {
+		t.Fatalf("unexpected consumers %v", s.Consumers)
+	}
+
+	// the daily bytes are reset on the next day, but not the total bytes
+	now = now.Add(2 * time.Hour)
+	u.add(u.consumer("alice", now), 20)
+	s = u.status()
+	if s.BytesSent != 180 || s.Day != "2021-06-02" {
+		t.Fatalf("unexpected status %+v", s)
+	}
+	if len(s.Consumers) != 1 || s.Consumers["alice"] != 20 {
+		t.Fatalf("unexpected consumers %v", s.Consumers)
+	}
+}
+
+func TestBuckets(t *testing.T) {
+	bs := newBuckets(1000, 2000)
+	now := time.Now()
+
+	if d := bs.reserve("alice", 2000, now); d != 0 {
+		t.Fatalf("burst should not be delayed, but got %s", d)
+	}
+	if d := bs.reserve("alice", 500, now); d != 500*time.Millisecond {
+		t.Fatalf("expected 500ms, but got %s", d)
+	}
+	if d := bs.reserve("bob", 1000, now); d != 0 {
+		t.Fatalf("other consumers should not be delayed, but got %s", d)
+	}
+
+	// the tokens are refilled by rate, and capped by burst
+	now = now.Add(time.Second)
+	if d := bs.reserve("alice", 1000, now); d != 500*time.Millisecond {
+		t.Fatalf("expected 500ms, but got %s", d)
+	}
+	now = now.Add(time.Hour)
+	if d := bs.reserve("alice", 3000, now); d != time.Second {
+		t.Fatalf("expected 1s, but got %s", d)
+	}
+
+	// burst defaults to rate
+	bs = newBuckets(1000, 0)
+	if d := bs.reserve("alice", 1500, now); d != 500*time.Millisecond {
+		t.Fatalf("expected 500ms, but got %s", d)
+	}
+}
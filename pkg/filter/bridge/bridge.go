@@ -128,7 +128,7 @@ func (b *Bridge) handle(ctx context.HTTPContext) (result string) {
 	dest := r.Header().Get(bridgeDestHeader)
 	found := false
 	if dest == "" {
-		logger.Warnf("destination not defined, will choose the first dest: %s", b.spec.Destinations[0])
+		ctx.Logger().Warnf("destination not defined, will choose the first dest: %s", b.spec.Destinations[0])
 		dest = b.spec.Destinations[0]
 		found = true
 	} else {
@@ -142,7 +142,7 @@ func (b *Bridge) handle(ctx context.HTTPContext) (result string) {
 	}
 
 	if !found {
-		logger.Errorf("dest not found: %s", dest)
+		ctx.Logger().Errorf("dest not found: %s", dest)
 		ctx.Response().SetStatusCode(http.StatusServiceUnavailable)
 		return resultDestinationNotFound
 	}
@@ -150,7 +150,7 @@ func (b *Bridge) handle(ctx context.HTTPContext) (result string) {
 	handler, exists := b.muxMapper.GetHandler(dest)
 
 	if !exists {
-		logger.Errorf("failed to get running object %s", b.spec.Destinations[0])
+		ctx.Logger().Errorf("failed to get running object %s", b.spec.Destinations[0])
 		ctx.Response().SetStatusCode(http.StatusServiceUnavailable)
 		return resultDestinationNotFound
 	}
@@ -22,7 +22,6 @@ import (
 	"time"
 
 	"github.com/megaease/easegress/pkg/context"
-	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
 )
 
@@ -129,10 +128,10 @@ func (m *Mock) handle(ctx context.HTTPContext) (result string) {
 			return
 		}
 
-		logger.Debugf("delay for %v ...", rule.delay)
+		ctx.Logger().Debugf("delay for %v ...", rule.delay)
 		select {
 		case <-ctx.Done():
-			logger.Debugf("request cancelled in the middle of delay mocking")
+			ctx.Logger().Debugf("request cancelled in the middle of delay mocking")
 		case <-time.After(rule.delay):
 		}
 	}
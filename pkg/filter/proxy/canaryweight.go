@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+// canaryWeights holds the weights of candidate pools overridden at runtime,
+// e.g. by canary analysis, keyed by the pipeline, the filter and the index.
+var canaryWeights sync.Map
+
+// CanaryWeight returns the per-mill weight overriding the probability of
+// the filter of the candidate pool, the weight is shared by all generations
+// of the proxy. It's not overridden if the weight is negative.
+func CanaryWeight(pipeline, filter string, index int) *int32 {
+	key := fmt.Sprintf("%s/%s/%d", pipeline, filter, index)
+	if w, exists := canaryWeights.Load(key); exists {
+		return w.(*int32)
+	}
+
+	notOverridden := int32(-1)
+	w, _ := canaryWeights.LoadOrStore(key, &notOverridden)
+	return w.(*int32)
+}
+
+// chosen reports whether the candidate pool is chosen for the request.
+func (p *pool) chosen(ctx context.HTTPContext) bool {
+	if p.canaryWeight != nil {
+		if w := atomic.LoadInt32(p.canaryWeight); w >= 0 {
+			return p.filter.FilterPerMill(ctx, uint32(w))
+		}
+	}
+	return p.filter.Filter(ctx)
+}
@@ -0,0 +1,200 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	libcb "github.com/megaease/easegress/pkg/util/circuitbreaker"
+)
+
+type (
+	// CircuitBreakerSpec describes the circuit breakers of a pool, every
+	// server has its own one, so a degraded server is short-circuited
+	// without affecting the others.
+	CircuitBreakerSpec struct {
+		SlidingWindowType                string `yaml:"slidingWindowType,omitempty" jsonschema:"omitempty,enum=COUNT_BASED,enum=TIME_BASED"`
+		FailureRateThreshold             uint8  `yaml:"failureRateThreshold,omitempty" jsonschema:"omitempty,minimum=1,maximum=100"`
+		SlowCallRateThreshold            uint8  `yaml:"slowCallRateThreshold,omitempty" jsonschema:"omitempty,minimum=1,maximum=100"`
+		SlidingWindowSize                uint32 `yaml:"slidingWindowSize,omitempty" jsonschema:"omitempty,minimum=1"`
+		PermittedNumberOfCallsInHalfOpen uint32 `yaml:"permittedNumberOfCallsInHalfOpenState" jsonschema:"omitempty"`
+		MinimumNumberOfCalls             uint32 `yaml:"minimumNumberOfCalls" jsonschema:"omitempty"`
+		SlowCallDurationThreshold        string `yaml:"slowCallDurationThreshold" jsonschema:"omitempty,format=duration"`
+		MaxWaitDurationInHalfOpen        string `yaml:"maxWaitDurationInHalfOpenState" jsonschema:"omitempty,format=duration"`
+		WaitDurationInOpen               string `yaml:"waitDurationInOpenState" jsonschema:"omitempty,format=duration"`
+
+		// FailureStatusCodes are the failures besides the network errors, default is all 5xx.
+		FailureStatusCodes []int `yaml:"failureStatusCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
+		// FallbackStatusCode is the status code of the short-circuited requests.
+		FallbackStatusCode int `yaml:"fallbackStatusCode,omitempty" jsonschema:"omitempty,format=httpcode"`
+	}
+
+	// serverBreakers holds the circuit breakers of the servers by URL.
+	serverBreakers struct {
+		spec      *CircuitBreakerSpec
+		policy    *libcb.Policy
+		tagPrefix string
+
+		mutex    sync.Mutex
+		breakers map[string]*libcb.CircuitBreaker
+	}
+
+	// breakerPermit is the permission of a call to a server, a nil one
+	// records nothing.
+	breakerPermit struct {
+		cb      *libcb.CircuitBreaker
+		stateID uint32
+	}
+)
+
+func newServerBreakers(spec *CircuitBreakerSpec, tagPrefix string) *serverBreakers {
+	return &serverBreakers{
+		spec:      spec,
+		policy:    spec.policy(),
+		tagPrefix: tagPrefix,
+		breakers:  map[string]*libcb.CircuitBreaker{},
+	}
+}
+
+func (spec *CircuitBreakerSpec) policy() *libcb.Policy {
+	policy := libcb.Policy{
+		FailureRateThreshold:             spec.FailureRateThreshold,
+		SlowCallRateThreshold:            spec.SlowCallRateThreshold,
+		SlidingWindowType:                libcb.CountBased,
+		SlidingWindowSize:                spec.SlidingWindowSize,
+		PermittedNumberOfCallsInHalfOpen: spec.PermittedNumberOfCallsInHalfOpen,
+		MinimumNumberOfCalls:             spec.MinimumNumberOfCalls,
+	}
+
+	if policy.FailureRateThreshold == 0 {
+		policy.FailureRateThreshold = 50
+	}
+
+	if policy.SlowCallRateThreshold == 0 {
+		policy.SlowCallRateThreshold = 100
+	}
+
+	if strings.ToUpper(spec.SlidingWindowType) == "TIME_BASED" {
+		policy.SlidingWindowType = libcb.TimeBased
+	}
+
+	if policy.SlidingWindowSize == 0 {
+		policy.SlidingWindowSize = 100
+	}
+
+	if policy.PermittedNumberOfCallsInHalfOpen == 0 {
+		policy.PermittedNumberOfCallsInHalfOpen = 10
+	}
+
+	if policy.MinimumNumberOfCalls == 0 {
+		policy.MinimumNumberOfCalls = 100
+	}
+
+	if d := spec.SlowCallDurationThreshold; d != "" {
+		policy.SlowCallDurationThreshold, _ = time.ParseDuration(d)
+	} else {
+		policy.SlowCallDurationThreshold = time.Minute
+	}
+
+	if d := spec.MaxWaitDurationInHalfOpen; d != "" {
+		policy.MaxWaitDurationInHalfOpen, _ = time.ParseDuration(d)
+	}
+
+	if d := spec.WaitDurationInOpen; d != "" {
+		policy.WaitDurationInOpen, _ = time.ParseDuration(d)
+	} else {
+		policy.WaitDurationInOpen = time.Minute
+	}
+
+	return &policy
+}
+
+// get returns the circuit breaker of the server, it's created at the
+// first time, so the servers discovered dynamically are covered.
+func (sb *serverBreakers) get(url string) *libcb.CircuitBreaker {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+
+	cb := sb.breakers[url]
+	if cb == nil {
+		cb = libcb.New(sb.policy)
+		cb.SetStateListener(func(event *libcb.Event) {
+			logger.Infof("state of circuit breaker of %s in %s transited from %s to %s at %d, reason: %s",
+				url, sb.tagPrefix, event.OldState, event.NewState,
+				event.Time.UnixNano()/1e6, event.Reason)
+		})
+		sb.breakers[url] = cb
+	}
+
+	return cb
+}
+
+// acquire acquires the permission of a call to the server.
+func (sb *serverBreakers) acquire(url string) (*breakerPermit, bool) {
+	cb := sb.get(url)
+	permitted, stateID := cb.AcquirePermission()
+	return &breakerPermit{cb: cb, stateID: stateID}, permitted
+}
+
+func (bp *breakerPermit) record(failed bool, d time.Duration) {
+	if bp != nil {
+		bp.cb.RecordResult(bp.stateID, failed, d)
+	}
+}
+
+// failure reports whether the status code is a failure.
+func (sb *serverBreakers) failure(code int) bool {
+	if len(sb.spec.FailureStatusCodes) == 0 {
+		return code >= 500
+	}
+
+	for _, c := range sb.spec.FailureStatusCodes {
+		if code == c {
+			return true
+		}
+	}
+	return false
+}
+
+func (sb *serverBreakers) fallbackStatusCode() int {
+	if sb.spec.FallbackStatusCode != 0 {
+		return sb.spec.FallbackStatusCode
+	}
+	return http.StatusServiceUnavailable
+}
+
+// states returns the states of the circuit breakers which are not closed.
+func (sb *serverBreakers) states() map[string]string {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+
+	var states map[string]string
+	for url, cb := range sb.breakers {
+		if state := cb.State(); state != libcb.StateClosed {
+			if states == nil {
+				states = map[string]string{}
+			}
+			states[url] = state.String()
+		}
+	}
+	return states
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/yamltool"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	const yamlSpec = `
+name: proxy
+kind: Proxy
+mainPool:
+  servers:
+  - url: http://127.0.0.1:9095
+  - url: http://127.0.0.2:9095
+  loadBalance:
+    policy: roundRobin
+  circuitBreaker:
+    slidingWindowSize: 2
+    minimumNumberOfCalls: 2
+    permittedNumberOfCallsInHalfOpenState: 1
+    waitDurationInOpenState: 50ms
+    fallbackStatusCode: 502
+`
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, e := httppipeline.NewFilterSpec(rawSpec, nil)
+	if e != nil {
+		t.Fatalf("unexpected error: %v", e)
+	}
+
+	proxy := &Proxy{}
+	proxy.Init(spec)
+	defer proxy.Close()
+
+	degraded := true
+	var lastHost string
+	oldSendRequest := fnSendRequest
+	defer func() { fnSendRequest = oldSendRequest }()
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		lastHost = r.URL.Host
+		code := http.StatusOK
+		if degraded && r.URL.Host == "127.0.0.1:9095" {
+			code = http.StatusServiceUnavailable
+		}
+		return &http.Response{
+			StatusCode: code,
+			Body:       io.NopCloser(strings.NewReader("this is the body")),
+		}, nil
+	}
+
+	statusCode := 0
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(http.Header{})
+	}
+	ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(http.Header{})
+	}
+	ctx.MockedResponse.MockedSetStatusCode = func(code int) {
+		statusCode = code
+	}
+
+	handle := func() (string, string) {
+		lastHost = ""
+		return proxy.handle(ctx), lastHost
+	}
+
+	// two failures open the circuit breaker of the first server
+	for i := 0; i < 4; i++ {
+		if result, _ := handle(); result != "" {
+			t.Fatalf("request %d should not be short-circuited, but got %s", i, result)
+		}
+	}
+
+	if result, host := handle(); result != resultShortCircuited || host != "" || statusCode != http.StatusBadGateway {
+		t.Fatalf("request should be short-circuited, but got %q, %q, %d", result, host, statusCode)
+	}
+	if result, host := handle(); result != "" || host != "127.0.0.2:9095" {
+		t.Fatalf("request to the healthy server should pass, but got %q, %q", result, host)
+	}
+
+	status := proxy.Status().(*Status)
+	if status.MainPool.CircuitBreakers["http://127.0.0.1:9095"] != "Open" {
+		t.Errorf("unexpected circuit breakers: %v", status.MainPool.CircuitBreakers)
+	}
+
+	// the call in half open state succeeds, so the circuit breaker closes
+	degraded = false
+	time.Sleep(60 * time.Millisecond)
+	if result, host := handle(); result != "" || host != "127.0.0.1:9095" {
+		t.Fatalf("request should be permitted in half open state, but got %q, %q", result, host)
+	}
+
+	status = proxy.Status().(*Status)
+	if len(status.MainPool.CircuitBreakers) != 0 {
+		t.Errorf("circuit breakers should be closed, but got %v", status.MainPool.CircuitBreakers)
+	}
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/egress"
+)
+
+type (
+	// ClientSpec describes the dedicated client of the proxy, the
+	// settings of globalClient are used for the zero values.
+	ClientSpec struct {
+		MaxIdleConns        int  `yaml:"maxIdleConns,omitempty" jsonschema:"omitempty,minimum=1"`
+		MaxIdleConnsPerHost int  `yaml:"maxIdleConnsPerHost,omitempty" jsonschema:"omitempty,minimum=1"`
+		DisableCompression  bool `yaml:"disableCompression" jsonschema:"omitempty"`
+		DisableKeepAlives   bool `yaml:"disableKeepAlives" jsonschema:"omitempty"`
+		// HTTP2 enables HTTP/2 to the servers supporting it by TLS ALPN.
+		HTTP2 bool `yaml:"http2" jsonschema:"omitempty"`
+	}
+)
+
+// dedicatedClient reports whether the proxy needs its own client
+// instead of globalClient.
+func (s *Spec) dedicatedClient() bool {
+	return s.Client != nil || s.TLS != nil || len(s.HostAliases) > 0 ||
+		s.Timeout.transportCustomized()
+}
+
+// newClient returns a client which shares the settings of globalClient
+// except the ones in the spec. If there are hostAliases, it dials the
+// IPs of them instead of resolving the hostnames by system DNS. The
+// URL of requests is untouched, so the Host header and TLS SNI are
+// still the hostnames.
+func newClient(spec *Spec) *http.Client {
+	transport := globalClient.Transport.(*http.Transport).Clone()
+
+	if spec.TLS != nil {
+		// NOTE: It has been validated.
+		tlsConfig, _ := spec.TLS.tlsConfig()
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	// NOTE: They have been validated by format=duration.
+	if timeout := spec.Timeout; timeout != nil {
+		if timeout.TLSHandshake != "" {
+			transport.TLSHandshakeTimeout, _ = time.ParseDuration(timeout.TLSHandshake)
+		}
+		if timeout.ResponseHeader != "" {
+			transport.ResponseHeaderTimeout, _ = time.ParseDuration(timeout.ResponseHeader)
+		}
+		if timeout.Idle != "" {
+			transport.IdleConnTimeout, _ = time.ParseDuration(timeout.Idle)
+		}
+	}
+
+	if client := spec.Client; client != nil {
+		if client.MaxIdleConns > 0 {
+			transport.MaxIdleConns = client.MaxIdleConns
+		}
+		if client.MaxIdleConnsPerHost > 0 {
+			transport.MaxIdleConnsPerHost = client.MaxIdleConnsPerHost
+		}
+		transport.DisableCompression = client.DisableCompression
+		transport.DisableKeepAlives = client.DisableKeepAlives
+		// NOTE: HTTP/2 is not attempted by default with the customized
+		// dialer and TLS config.
+		transport.ForceAttemptHTTP2 = client.HTTP2
+	}
+
+	transport.DialContext = newDialContext(spec)
+
+	return &http.Client{
+		Timeout:       globalClient.Timeout,
+		Transport:     transport,
+		CheckRedirect: globalClient.CheckRedirect,
+	}
+}
+
+// newDialContext returns the dial function checked by egress, which
+// dials the IPs of hostAliases instead of resolving the hostnames.
+func newDialContext(spec *Spec) func(ctx stdcontext.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   defaultDialTimeout,
+		KeepAlive: 60 * time.Second,
+		DualStack: true,
+	}
+	// NOTE: It has been validated by format=duration.
+	if spec.Timeout != nil && spec.Timeout.Dial != "" {
+		dialer.Timeout, _ = time.ParseDuration(spec.Timeout.Dial)
+	}
+
+	dial := trackConns(egress.Dialer(dialer.DialContext))
+	if len(spec.HostAliases) == 0 {
+		return dial
+	}
+
+	hostAliases := make(map[string]string, len(spec.HostAliases))
+	for host, ip := range spec.HostAliases {
+		hostAliases[strings.ToLower(host)] = ip
+	}
+	return func(ctx stdcontext.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err == nil {
+			if ip, exists := hostAliases[strings.ToLower(host)]; exists {
+				addr = net.JoinHostPort(ip, port)
+			}
+		}
+		return dial(ctx, network, addr)
+	}
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientSpec(t *testing.T) {
+	if (&Spec{}).dedicatedClient() {
+		t.Error("empty spec should use globalClient")
+	}
+	if !(&Spec{Client: &ClientSpec{}}).dedicatedClient() {
+		t.Error("spec with client should use the dedicated client")
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	for _, http2 := range []bool{false, true} {
+		client := newClient(&Spec{
+			TLS:    &TLSSpec{InsecureSkipVerify: true},
+			Client: &ClientSpec{HTTP2: http2},
+		})
+
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		client.CloseIdleConnections()
+
+		if (resp.ProtoMajor == 2) != http2 {
+			t.Errorf("http2 is %v, but got protocol %s", http2, resp.Proto)
+		}
+	}
+
+	client := newClient(&Spec{Client: &ClientSpec{
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 2,
+		DisableCompression:  true,
+		DisableKeepAlives:   true,
+	}})
+	transport := client.Transport.(*http.Transport)
+	if transport.MaxIdleConns != 10 || transport.MaxIdleConnsPerHost != 2 ||
+		!transport.DisableCompression || !transport.DisableKeepAlives {
+		t.Errorf("unexpected transport %+v", transport)
+	}
+
+	transport = newClient(&Spec{Client: &ClientSpec{}}).Transport.(*http.Transport)
+	global := globalClient.Transport.(*http.Transport)
+	if transport.MaxIdleConns != global.MaxIdleConns || transport.MaxIdleConnsPerHost != global.MaxIdleConnsPerHost {
+		t.Errorf("zero values should use the settings of globalClient")
+	}
+}
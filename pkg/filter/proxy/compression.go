@@ -141,7 +141,7 @@ func newGzipBody(body io.Reader) *gzipBody {
 
 // body -> gw -> p
 func (gb *gzipBody) Read(p []byte) (int, error) {
-	if gb.complete {
+	if gb.complete && gb.buff.Len() == 0 {
 		return 0, io.EOF
 	}
 
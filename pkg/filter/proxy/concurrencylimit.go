@@ -0,0 +1,295 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+const (
+	// OverflowQueue queues the requests beyond the max concurrency of
+	// the server until it has a free slot.
+	OverflowQueue = "queue"
+	// OverflowSpill sends the requests beyond the max concurrency of the
+	// server to other servers.
+	OverflowSpill = "spill"
+)
+
+var (
+	errServerBusy   = fmt.Errorf("server reaches max concurrency")
+	errQueueTimeout = fmt.Errorf("queue timeout")
+)
+
+type (
+	// ConcurrencyLimitSpec describes the max concurrent requests of each
+	// server of a pool.
+	ConcurrencyLimitSpec struct {
+		MaxConcurrency int `yaml:"maxConcurrency" jsonschema:"required,minimum=1"`
+		// Overflow is how to handle the requests beyond the limit, it's
+		// OverflowQueue if empty.
+		Overflow string `yaml:"overflow,omitempty" jsonschema:"omitempty,enum=,enum=queue,enum=spill"`
+		// QueueDepth is the max number of the queued requests of each
+		// server, the requests beyond it are rejected.
+		QueueDepth int `yaml:"queueDepth,omitempty" jsonschema:"omitempty,minimum=0"`
+		// QueueTimeout is the max duration of a request in the queue, the
+		// request waits until the request timeout if it's empty.
+		QueueTimeout string `yaml:"queueTimeout,omitempty" jsonschema:"omitempty,format=duration"`
+	}
+
+	// ConcurrencyLimitStatus is the status of the concurrency limit.
+	ConcurrencyLimitStatus struct {
+		// Queued and Spilled are the numbers of the requests queued and
+		// spilled to other servers, Rejected is the number of the ones
+		// rejected for full queues, queue timeouts or no server to spill.
+		Queued   uint64 `yaml:"queued"`
+		Spilled  uint64 `yaml:"spilled"`
+		Rejected uint64 `yaml:"rejected"`
+	}
+
+	concurrencyLimit struct {
+		max          int64
+		spill        bool
+		queueDepth   int
+		queueTimeout time.Duration
+
+		// mutex guards the waiters and the in-flight requests of the
+		// servers beyond the limit.
+		mutex   sync.Mutex
+		waiters map[*Server][]chan struct{}
+
+		queued   uint64
+		spilled  uint64
+		rejected uint64
+	}
+)
+
+// Validate validates ConcurrencyLimitSpec.
+func (spec ConcurrencyLimitSpec) Validate() error {
+	if spec.Overflow == OverflowSpill && (spec.QueueDepth > 0 || spec.QueueTimeout != "") {
+		return fmt.Errorf("queueDepth and queueTimeout are only for overflow %s", OverflowQueue)
+	}
+
+	return nil
+}
+
+func newConcurrencyLimit(spec *ConcurrencyLimitSpec) *concurrencyLimit {
+	// NOTE: It has been validated by format=duration.
+	queueTimeout, _ := time.ParseDuration(spec.QueueTimeout)
+
+	return &concurrencyLimit{
+		max:          int64(spec.MaxConcurrency),
+		spill:        spec.Overflow == OverflowSpill,
+		queueDepth:   spec.QueueDepth,
+		queueTimeout: queueTimeout,
+		waiters:      make(map[*Server][]chan struct{}),
+	}
+}
+
+// tryAcquire counts a request sent to the server if the server doesn't
+// reach the limit.
+func (cl *concurrencyLimit) tryAcquire(server *Server) bool {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	if server.inflightRequests() >= cl.max {
+		return false
+	}
+	server.acquire()
+	return true
+}
+
+// acquire counts a request sent to the server, the request is queued if
+// the server reaches the limit. It returns errServerBusy if the request
+// should be spilled or the queue is full.
+func (cl *concurrencyLimit) acquire(ctx stdcontext.Context, server *Server, deadline time.Time) error {
+	cl.mutex.Lock()
+	if server.inflightRequests() < cl.max {
+		server.acquire()
+		cl.mutex.Unlock()
+		return nil
+	}
+	if cl.spill || len(cl.waiters[server]) >= cl.queueDepth {
+		cl.mutex.Unlock()
+		return errServerBusy
+	}
+	waiter := make(chan struct{})
+	cl.waiters[server] = append(cl.waiters[server], waiter)
+	cl.mutex.Unlock()
+	atomic.AddUint64(&cl.queued, 1)
+
+	if cl.queueTimeout > 0 {
+		d := time.Now().Add(cl.queueTimeout)
+		if deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+	select {
+	case <-waiter:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeout:
+		err = errQueueTimeout
+	}
+
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+	waiters := cl.waiters[server]
+	for i, w := range waiters {
+		if w == waiter {
+			cl.removeWaiter(server, i)
+			return err
+		}
+	}
+
+	// NOTE: The slot has been handed over before the removal.
+	cl.release(server)
+	return err
+}
+
+// release counts a request of the server finished, the slot is handed
+// over to the first queued request of the server if there is one.
+// NOTE: The caller must hold the mutex.
+func (cl *concurrencyLimit) release(server *Server) {
+	if len(cl.waiters[server]) == 0 {
+		server.release()
+		return
+	}
+	waiter := cl.waiters[server][0]
+	cl.removeWaiter(server, 0)
+	close(waiter)
+}
+
+func (cl *concurrencyLimit) removeWaiter(server *Server, i int) {
+	waiters := cl.waiters[server]
+	if len(waiters) == 1 {
+		delete(cl.waiters, server)
+		return
+	}
+	cl.waiters[server] = append(waiters[:i:i], waiters[i+1:]...)
+}
+
+func (cl *concurrencyLimit) status() *ConcurrencyLimitStatus {
+	return &ConcurrencyLimitStatus{
+		Queued:   atomic.LoadUint64(&cl.queued),
+		Spilled:  atomic.LoadUint64(&cl.spilled),
+		Rejected: atomic.LoadUint64(&cl.rejected),
+	}
+}
+
+// acquire counts a request sent to the server, it's limited by the max
+// concurrency of the servers if there is one.
+func (p *pool) acquire(ctx stdcontext.Context, server *Server, deadline time.Time) error {
+	if p.concurrency == nil {
+		server.acquire()
+		return nil
+	}
+	return p.concurrency.acquire(ctx, server, deadline)
+}
+
+// release counts a request of the server finished.
+func (p *pool) release(server *Server) {
+	if p.concurrency == nil {
+		server.release()
+		return
+	}
+	p.concurrency.mutex.Lock()
+	p.concurrency.release(server)
+	p.concurrency.mutex.Unlock()
+}
+
+// nextServer picks the next server of the traffic group which is not
+// tried, and counts a request sent to it. The servers reaching the max
+// concurrency are skipped if the overflow is spill, and the backup ones
+// are used if all of them reach the max concurrency.
+func (p *pool) nextServer(ctx context.HTTPContext, group int, tried map[*Server]bool,
+	deadline time.Time) (*Server, error) {
+
+	var busy map[*Server]bool
+	excluded := tried
+	for {
+		server, err := p.servers.nextExcept(ctx, group, excluded)
+		if err != nil {
+			return nil, err
+		}
+		if busy[server] {
+			if server = p.acquireBackup(ctx, excluded); server != nil {
+				atomic.AddUint64(&p.concurrency.spilled, 1)
+				return server, nil
+			}
+			atomic.AddUint64(&p.concurrency.rejected, 1)
+			return nil, errServerBusy
+		}
+
+		err = p.acquire(ctx, server, deadline)
+		if err == nil {
+			if busy != nil {
+				atomic.AddUint64(&p.concurrency.spilled, 1)
+			}
+			return server, nil
+		}
+		if err != errServerBusy || !p.concurrency.spill {
+			if err == errServerBusy || err == errQueueTimeout {
+				atomic.AddUint64(&p.concurrency.rejected, 1)
+			}
+			return nil, err
+		}
+
+		if busy == nil {
+			busy = make(map[*Server]bool)
+			excluded = make(map[*Server]bool, len(tried)+1)
+			for s := range tried {
+				excluded[s] = true
+			}
+		}
+		busy[server] = true
+		excluded[server] = true
+	}
+}
+
+// acquireBackup counts a request sent to a backup server not excluded,
+// which doesn't reach the max concurrency. The backups are tried in the
+// order of priority, it returns nil if none of them is free.
+func (p *pool) acquireBackup(ctx context.HTTPContext, excluded map[*Server]bool) *Server {
+	for _, backup := range p.servers.backupServers() {
+		first := backup.next(ctx)
+		if !excluded[first] && p.concurrency.tryAcquire(first) {
+			return first
+		}
+		for _, server := range backup.servers {
+			if server != first && !excluded[server] && p.concurrency.tryAcquire(server) {
+				return server
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+)
+
+func TestConcurrencyLimitQueue(t *testing.T) {
+	cl := newConcurrencyLimit(&ConcurrencyLimitSpec{
+		MaxConcurrency: 1,
+		QueueDepth:     1,
+		QueueTimeout:   "50ms",
+	})
+	server := &Server{URL: "http://127.0.0.1:9091"}
+	ctx := stdcontext.Background()
+
+	if err := cl.acquire(ctx, server, time.Time{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the queued request gets the slot released by the first one
+	acquired := make(chan error)
+	go func() {
+		acquired <- cl.acquire(ctx, server, time.Time{})
+	}()
+	for {
+		cl.mutex.Lock()
+		n := len(cl.waiters[server])
+		cl.mutex.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the queue is full
+	if err := cl.acquire(ctx, server, time.Time{}); err != errServerBusy {
+		t.Errorf("want %v, got %v", errServerBusy, err)
+	}
+
+	cl.mutex.Lock()
+	cl.release(server)
+	cl.mutex.Unlock()
+	if err := <-acquired; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := server.inflightRequests(); n != 1 {
+		t.Errorf("want 1 in-flight request, got %d", n)
+	}
+
+	// the queued request times out
+	start := time.Now()
+	if err := cl.acquire(ctx, server, time.Time{}); err != errQueueTimeout {
+		t.Errorf("want %v, got %v", errQueueTimeout, err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("the request should be queued for 50ms, but only %s", d)
+	}
+
+	// the queued request is canceled
+	cancelCtx, cancel := stdcontext.WithCancel(ctx)
+	cancel()
+	if err := cl.acquire(cancelCtx, server, time.Time{}); err != stdcontext.Canceled {
+		t.Errorf("want %v, got %v", stdcontext.Canceled, err)
+	}
+
+	cl.mutex.Lock()
+	cl.release(server)
+	cl.mutex.Unlock()
+	if n := server.inflightRequests(); n != 0 {
+		t.Errorf("want no in-flight request, got %d", n)
+	}
+	if len(cl.waiters) != 0 {
+		t.Errorf("want no queued request, got %d", len(cl.waiters))
+	}
+	if status := cl.status(); status.Queued != 3 {
+		t.Errorf("want 3 queued requests, got %+v", status)
+	}
+}
+
+func TestConcurrencyLimitSpill(t *testing.T) {
+	spec := &PoolSpec{
+		LoadBalance: &LoadBalance{Policy: PolicyRoundRobin},
+		Servers: []*Server{
+			{URL: "http://127.0.0.1:9091"},
+			{URL: "http://127.0.0.1:9092"},
+		},
+		ConcurrencyLimit: &ConcurrencyLimitSpec{
+			MaxConcurrency: 1,
+			Overflow:       OverflowSpill,
+		},
+	}
+	if err := spec.ConcurrencyLimit.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p := &pool{
+		servers:     newServers(nil, spec),
+		concurrency: newConcurrencyLimit(spec.ConcurrencyLimit),
+	}
+	defer p.servers.close()
+
+	ctx := &contexttest.MockedHTTPContext{}
+	if _, err := p.nextServer(ctx, -1, nil, time.Time{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := p.nextServer(ctx, -1, nil, time.Time{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the request to the busy server spills to the other one
+	p.release(second)
+	for i := 0; i < 2; i++ {
+		server, err := p.nextServer(ctx, -1, nil, time.Time{})
+		if i == 0 {
+			if err != nil || server != second {
+				t.Errorf("want server %s, got %v, %v", second.URL, server, err)
+			}
+			continue
+		}
+		if err != errServerBusy {
+			t.Errorf("want %v, got %v", errServerBusy, err)
+		}
+	}
+
+	status := p.concurrency.status()
+	if status.Spilled != 1 || status.Rejected != 1 {
+		t.Errorf("want 1 spilled and 1 rejected, got %+v", status)
+	}
+
+	// the backup server is used if all the servers are busy
+	backupSpec := &PoolSpec{
+		LoadBalance: spec.LoadBalance,
+		Servers: []*Server{
+			{URL: "http://127.0.0.1:9091"},
+			{URL: "http://127.0.0.1:9092"},
+			{URL: "http://127.0.0.1:9093", Priority: 1},
+		},
+		ConcurrencyLimit: spec.ConcurrencyLimit,
+	}
+	p = &pool{
+		servers:     newServers(nil, backupSpec),
+		concurrency: newConcurrencyLimit(spec.ConcurrencyLimit),
+	}
+	defer p.servers.close()
+	busy := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		server, err := p.nextServer(ctx, -1, nil, time.Time{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		busy[server.URL] = true
+	}
+	if !busy["http://127.0.0.1:9093"] {
+		t.Errorf("want the backup server used, got %v", busy)
+	}
+	if _, err := p.nextServer(ctx, -1, nil, time.Time{}); err != errServerBusy {
+		t.Errorf("want %v, got %v", errServerBusy, err)
+	}
+
+	spec.ConcurrencyLimit.QueueDepth = 1
+	if err := spec.ConcurrencyLimit.Validate(); err == nil {
+		t.Errorf("queueDepth should be invalid for spill")
+	}
+}
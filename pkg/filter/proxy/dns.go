@@ -0,0 +1,203 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	defaultDNSRefreshInterval = 30 * time.Second
+	dnsLookupTimeout          = 5 * time.Second
+)
+
+type (
+	// DNSSpec describes resolving the hostnames of the static servers,
+	// every server is expanded to one server per resolved address,
+	// which inherits its tags and weight. The hostnames beginning with
+	// an underscore like _http._tcp.example.com are SRV names expanded
+	// to the targets and ports of the records.
+	DNSSpec struct {
+		// RefreshInterval is the interval of resolving the hostnames
+		// again, since the system resolver doesn't expose the TTLs.
+		RefreshInterval string `yaml:"refreshInterval,omitempty" jsonschema:"omitempty,format=duration"`
+	}
+
+	dnsResolver interface {
+		LookupIPAddr(ctx stdcontext.Context, host string) ([]net.IPAddr, error)
+		LookupSRV(ctx stdcontext.Context, service, proto, name string) (string, []*net.SRV, error)
+	}
+)
+
+// defaultDNSResolver is a variable for testing.
+var defaultDNSResolver dnsResolver = net.DefaultResolver
+
+func (spec *DNSSpec) refreshInterval() time.Duration {
+	if spec.RefreshInterval == "" {
+		return defaultDNSRefreshInterval
+	}
+	// NOTE: It has been validated by format=duration.
+	d, _ := time.ParseDuration(spec.RefreshInterval)
+	return d
+}
+
+// watchDNS resolves the static servers at once, and then every refresh
+// interval until the servers are closed.
+func (s *servers) watchDNS(resolver dnsResolver) {
+	interval := s.spec().DNS.refreshInterval()
+	cache := map[string][]string{}
+	var last []string
+	var lastSpec *PoolSpec
+
+	for {
+		poolSpec := s.spec()
+		servers := resolveServers(resolver, poolSpec.Servers, cache)
+		if urls := serverURLs(servers); poolSpec != lastSpec || !equalStrings(urls, last) {
+			last, lastSpec = urls, poolSpec
+			s.useResolved(servers)
+		}
+
+		select {
+		case <-s.done:
+			return
+		case <-s.updated:
+		case <-time.After(interval):
+		}
+	}
+}
+
+// useResolved uses the resolved servers, it falls back to the static
+// servers if none of them satisfies the tags.
+func (s *servers) useResolved(servers []*Server) {
+	poolSpec := s.spec()
+	resolved := newStaticServers(servers, poolSpec.ServersTags, poolSpec.LoadBalance)
+	if resolved.len() == 0 {
+		logger.Warnf("no resolved server satisfy tags: %v", poolSpec.ServersTags)
+		s.useStaticServers()
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.static = resolved
+	s.updateAvailable()
+}
+
+// resolveServers expands the servers by the addresses of their
+// hostnames. The last addresses in the cache are used if the lookup
+// fails, and the server is kept as it is if there are none.
+func resolveServers(resolver dnsResolver, servers []*Server, cache map[string][]string) []*Server {
+	var result []*Server
+	for _, server := range servers {
+		u, err := url.Parse(server.URL)
+		if err != nil || u.Hostname() == "" || net.ParseIP(u.Hostname()) != nil {
+			result = append(result, server)
+			continue
+		}
+
+		hosts, err := lookupHosts(resolver, u)
+		if err != nil {
+			logger.Warnf("resolve %s failed: %v", server.URL, err)
+			hosts = cache[server.URL]
+		} else {
+			cache[server.URL] = hosts
+		}
+
+		if len(hosts) == 0 {
+			result = append(result, server)
+			continue
+		}
+
+		for _, host := range hosts {
+			expanded := *u
+			expanded.Host = host
+			result = append(result, &Server{
+				URL:      expanded.String(),
+				Tags:     server.Tags,
+				Weight:   server.Weight,
+				Priority: server.Priority,
+			})
+		}
+	}
+
+	return result
+}
+
+// lookupHosts returns the sorted hosts of the URL, in the form of
+// host:port if the URL has port or the record is SRV.
+func lookupHosts(resolver dnsResolver, u *url.URL) ([]string, error) {
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), dnsLookupTimeout)
+	defer cancel()
+
+	var hosts []string
+	if hostname := u.Hostname(); strings.HasPrefix(hostname, "_") {
+		_, records, err := resolver.LookupSRV(ctx, "", "", hostname)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			target := strings.TrimSuffix(record.Target, ".")
+			hosts = append(hosts, net.JoinHostPort(target, strconv.Itoa(int(record.Port))))
+		}
+	} else {
+		addrs, err := resolver.LookupIPAddr(ctx, hostname)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			host := addr.IP.String()
+			if port := u.Port(); port != "" {
+				host = net.JoinHostPort(host, port)
+			} else if addr.IP.To4() == nil {
+				host = "[" + host + "]"
+			}
+			hosts = append(hosts, host)
+		}
+	}
+
+	sort.Strings(hosts)
+	return hosts, nil
+}
+
+func serverURLs(servers []*Server) []string {
+	urls := make([]string, 0, len(servers))
+	for _, server := range servers {
+		urls = append(urls, server.URL)
+	}
+	return urls
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
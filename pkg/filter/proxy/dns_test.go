@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeDNSResolver struct {
+	mutex sync.Mutex
+	ips   map[string][]string
+	srvs  map[string][]*net.SRV
+}
+
+func (r *fakeDNSResolver) LookupIPAddr(ctx stdcontext.Context, host string) ([]net.IPAddr, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ips, exists := r.ips[host]
+	if !exists {
+		return nil, fmt.Errorf("no such host %s", host)
+	}
+	var addrs []net.IPAddr
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+func (r *fakeDNSResolver) LookupSRV(ctx stdcontext.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	srvs, exists := r.srvs[name]
+	if !exists {
+		return "", nil, fmt.Errorf("no such host %s", name)
+	}
+	return name, srvs, nil
+}
+
+func (r *fakeDNSResolver) setIPs(host string, ips ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if ips == nil {
+		delete(r.ips, host)
+	} else {
+		r.ips[host] = ips
+	}
+}
+
+func TestResolveServers(t *testing.T) {
+	resolver := &fakeDNSResolver{
+		ips: map[string][]string{
+			"web.example.com": {"10.0.0.2", "10.0.0.1"},
+			"v6.example.com":  {"fd00::1"},
+		},
+		srvs: map[string][]*net.SRV{
+			"_http._tcp.api.example.com": {
+				{Target: "api-1.example.com.", Port: 8080},
+				{Target: "api-0.example.com.", Port: 8081},
+			},
+		},
+	}
+
+	servers := []*Server{
+		{URL: "http://web.example.com:8080", Tags: []string{"web"}, Weight: 3},
+		{URL: "https://v6.example.com"},
+		{URL: "http://_http._tcp.api.example.com"},
+		{URL: "http://127.0.0.1:9090"},
+		{URL: "http://missing.example.com:80"},
+	}
+
+	cache := map[string][]string{}
+	result := resolveServers(resolver, servers, cache)
+
+	want := []string{
+		"http://10.0.0.1:8080",
+		"http://10.0.0.2:8080",
+		"https://[fd00::1]",
+		"http://api-0.example.com:8081",
+		"http://api-1.example.com:8080",
+		"http://127.0.0.1:9090",
+		"http://missing.example.com:80",
+	}
+	if got := serverURLs(result); !reflect.DeepEqual(got, want) {
+		t.Fatalf("servers want %v, got %v", want, got)
+	}
+	if !reflect.DeepEqual(result[0].Tags, []string{"web"}) || result[1].Weight != 3 {
+		t.Errorf("expanded servers should inherit tags and weight")
+	}
+
+	// the last addresses are used if the lookup fails
+	resolver.setIPs("web.example.com")
+	result = resolveServers(resolver, servers[:1], cache)
+	if got := serverURLs(result); !reflect.DeepEqual(got, want[:2]) {
+		t.Errorf("servers want %v, got %v", want[:2], got)
+	}
+}
+
+func TestDNSServers(t *testing.T) {
+	resolver := &fakeDNSResolver{
+		ips: map[string][]string{"web.example.com": {"10.0.0.1"}},
+	}
+	defaultDNSResolver = resolver
+	defer func() { defaultDNSResolver = net.DefaultResolver }()
+
+	s := newServers(nil, &PoolSpec{
+		LoadBalance: &LoadBalance{Policy: PolicyRoundRobin},
+		Servers:     []*Server{{URL: "http://web.example.com:8080"}},
+		DNS:         &DNSSpec{RefreshInterval: "10ms"},
+	})
+	defer s.close()
+
+	waitURLs := func(want ...string) {
+		for i := 0; i < 100; i++ {
+			if reflect.DeepEqual(serverURLs(s.snapshot().servers), want) {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("servers want %v, got %v", want, serverURLs(s.snapshot().servers))
+	}
+
+	waitURLs("http://10.0.0.1:8080")
+
+	resolver.setIPs("web.example.com", "10.0.0.1", "10.0.0.3")
+	waitURLs("http://10.0.0.1:8080", "http://10.0.0.3:8080")
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// drainRegistry holds the servers being drained, which are keyed by URL
+// and shared by all proxies of this member, and the servers of the pools
+// to be notified.
+var drainRegistry = struct {
+	mutex    sync.Mutex
+	draining map[string]time.Time
+	pools    map[*servers]struct{}
+}{
+	draining: make(map[string]time.Time),
+	pools:    make(map[*servers]struct{}),
+}
+
+// DrainStatus is the status of a server being drained.
+type DrainStatus struct {
+	URL   string    `yaml:"url"`
+	Since time.Time `yaml:"since"`
+	// InFlight is the number of the requests to the server which are
+	// not finished yet, it's drained if there is none.
+	InFlight int64 `yaml:"inFlight"`
+	Drained  bool  `yaml:"drained"`
+}
+
+// DrainServer stops sending new requests to the server of the URL in all
+// proxies, while the in-flight ones are allowed to finish.
+func DrainServer(url string) *DrainStatus {
+	drainRegistry.mutex.Lock()
+	defer drainRegistry.mutex.Unlock()
+
+	if _, exists := drainRegistry.draining[url]; !exists {
+		drainRegistry.draining[url] = time.Now()
+		notifyDraining()
+	}
+	return drainStatus(url)
+}
+
+// UndrainServer sends the requests to the server of the URL again, it
+// returns false if the server is not being drained.
+func UndrainServer(url string) bool {
+	drainRegistry.mutex.Lock()
+	defer drainRegistry.mutex.Unlock()
+
+	if _, exists := drainRegistry.draining[url]; !exists {
+		return false
+	}
+	delete(drainRegistry.draining, url)
+	notifyDraining()
+	return true
+}
+
+// DrainingServers returns the status of the servers being drained in
+// order of URL.
+func DrainingServers() []*DrainStatus {
+	drainRegistry.mutex.Lock()
+	defer drainRegistry.mutex.Unlock()
+
+	statuses := make([]*DrainStatus, 0, len(drainRegistry.draining))
+	for url := range drainRegistry.draining {
+		statuses = append(statuses, drainStatus(url))
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].URL < statuses[j].URL
+	})
+	return statuses
+}
+
+// drainStatus must be called with the lock held.
+func drainStatus(url string) *DrainStatus {
+	status := &DrainStatus{URL: url, Since: drainRegistry.draining[url]}
+	for s := range drainRegistry.pools {
+		for _, server := range s.snapshot().servers {
+			if server.URL == url {
+				status.InFlight += server.inflightRequests()
+			}
+		}
+	}
+	status.Drained = status.InFlight == 0
+	return status
+}
+
+// notifyDraining must be called with the lock held.
+func notifyDraining() {
+	for s := range drainRegistry.pools {
+		s.setDraining(drainingURLs())
+	}
+}
+
+// drainingURLs must be called with the lock held.
+func drainingURLs() map[string]bool {
+	urls := make(map[string]bool, len(drainRegistry.draining))
+	for url := range drainRegistry.draining {
+		urls[url] = true
+	}
+	return urls
+}
+
+// watchDraining registers the servers of a pool to exclude the servers
+// being drained.
+func watchDraining(s *servers) {
+	drainRegistry.mutex.Lock()
+	defer drainRegistry.mutex.Unlock()
+
+	drainRegistry.pools[s] = struct{}{}
+	s.setDraining(drainingURLs())
+}
+
+func unwatchDraining(s *servers) {
+	drainRegistry.mutex.Lock()
+	defer drainRegistry.mutex.Unlock()
+
+	delete(drainRegistry.pools, s)
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+)
+
+func TestDrainServer(t *testing.T) {
+	s := newServers(nil, &PoolSpec{
+		LoadBalance: &LoadBalance{Policy: PolicyRoundRobin},
+		Servers: []*Server{
+			{URL: "http://127.0.0.1:9091"},
+			{URL: "http://127.0.0.1:9092"},
+		},
+	})
+	defer s.close()
+
+	ctx := &contexttest.MockedHTTPContext{}
+	next := func() *Server {
+		server, err := s.next(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return server
+	}
+
+	// a request in flight to the server to be drained
+	var busy *Server
+	for busy == nil {
+		if server := next(); server.URL == "http://127.0.0.1:9091" {
+			busy = server
+		}
+	}
+	busy.acquire()
+
+	status := DrainServer("http://127.0.0.1:9091")
+	defer UndrainServer("http://127.0.0.1:9091")
+	if status.InFlight != 1 || status.Drained {
+		t.Errorf("want 1 request in flight, got %+v", status)
+	}
+
+	for i := 0; i < 10; i++ {
+		if server := next(); server.URL == "http://127.0.0.1:9091" {
+			t.Fatal("draining server should not be chosen")
+		}
+	}
+
+	busy.release()
+	statuses := DrainingServers()
+	if len(statuses) != 1 || !statuses[0].Drained {
+		t.Errorf("want the server drained, got %+v", statuses)
+	}
+
+	if !UndrainServer("http://127.0.0.1:9091") {
+		t.Error("server should be undrained")
+	}
+	if UndrainServer("http://127.0.0.1:9091") {
+		t.Error("server is not draining")
+	}
+
+	chosen := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		chosen[next().URL] = true
+	}
+	if len(chosen) != 2 {
+		t.Errorf("want both servers chosen, got %v", chosen)
+	}
+}
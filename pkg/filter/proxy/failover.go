@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	defaultMaxFailures     = 5
+	defaultRecoverInterval = 10 * time.Second
+)
+
+type (
+	// FailoverSpec describes the secondary pools tried in priority order
+	// when mainPool is unhealthy or has no server.
+	FailoverSpec struct {
+		Pools []*PoolSpec `yaml:"pools" jsonschema:"required,minItems=1"`
+		// MaxFailures is the number of consecutive failures marking a pool unhealthy.
+		MaxFailures int `yaml:"maxFailures" jsonschema:"omitempty,minimum=1"`
+		// RecoverInterval is the interval of probing an unhealthy pool with
+		// a real request, the traffic fails back if the probe succeeds.
+		RecoverInterval string `yaml:"recoverInterval" jsonschema:"omitempty,format=duration"`
+	}
+
+	// PoolHealthStatus is the health status of a pool in failover.
+	PoolHealthStatus struct {
+		Healthy             bool `yaml:"healthy"`
+		ConsecutiveFailures int  `yaml:"consecutiveFailures"`
+	}
+
+	failover struct {
+		// pools are in priority order, the first one is mainPool.
+		pools []*pool
+	}
+
+	// poolHealth tracks the consecutive failures of a pool passively.
+	poolHealth struct {
+		name            string
+		maxFailures     int32
+		recoverInterval time.Duration
+
+		failures int32
+		// retryAt is the unix nano time when the unhealthy pool could be probed.
+		retryAt int64
+	}
+)
+
+// Validate validates FailoverSpec.
+func (s FailoverSpec) Validate() error {
+	for _, p := range s.Pools {
+		if p.Filter != nil {
+			return fmt.Errorf("filter must be empty in failover pools")
+		}
+	}
+	return nil
+}
+
+func newFailover(spec *FailoverSpec, mainPool *pool, pools []*pool) *failover {
+	maxFailures := spec.MaxFailures
+	if maxFailures <= 0 {
+		maxFailures = defaultMaxFailures
+	}
+	recoverInterval := defaultRecoverInterval
+	if spec.RecoverInterval != "" {
+		// NOTE: It has been validated by format=duration.
+		recoverInterval, _ = time.ParseDuration(spec.RecoverInterval)
+	}
+
+	f := &failover{pools: append([]*pool{mainPool}, pools...)}
+	for _, p := range f.pools {
+		p.health = &poolHealth{
+			name:            p.tagPrefix,
+			maxFailures:     int32(maxFailures),
+			recoverInterval: recoverInterval,
+		}
+	}
+
+	return f
+}
+
+// choose returns the first available pool in priority order, it falls
+// back to the first pool having servers if all of them are unhealthy.
+func (f *failover) choose() *pool {
+	var withServers *pool
+	for _, p := range f.pools {
+		if p.servers.len() == 0 {
+			continue
+		}
+		if p.health.available() {
+			return p
+		}
+		if withServers == nil {
+			withServers = p
+		}
+	}
+
+	if withServers != nil {
+		return withServers
+	}
+	return f.pools[0]
+}
+
+// available reports whether the pool could serve the request, an unhealthy
+// pool is available for one probing request every recoverInterval.
+func (h *poolHealth) available() bool {
+	if atomic.LoadInt32(&h.failures) < h.maxFailures {
+		return true
+	}
+
+	retryAt := atomic.LoadInt64(&h.retryAt)
+	now := time.Now().UnixNano()
+	if now < retryAt {
+		return false
+	}
+	return atomic.CompareAndSwapInt64(&h.retryAt, retryAt, now+int64(h.recoverInterval))
+}
+
+func (h *poolHealth) record(failed bool) {
+	if !failed {
+		if atomic.SwapInt32(&h.failures, 0) >= h.maxFailures {
+			logger.Infof("%s recovered, failing back to it", h.name)
+		}
+		return
+	}
+
+	if atomic.AddInt32(&h.failures, 1) == h.maxFailures {
+		atomic.StoreInt64(&h.retryAt, time.Now().Add(h.recoverInterval).UnixNano())
+		logger.Warnf("%s is unhealthy after %d consecutive failures, failing over",
+			h.name, h.maxFailures)
+	}
+}
+
+func (h *poolHealth) status() *PoolHealthStatus {
+	failures := atomic.LoadInt32(&h.failures)
+	return &PoolHealthStatus{
+		Healthy:             failures < h.maxFailures,
+		ConsecutiveFailures: int(failures),
+	}
+}
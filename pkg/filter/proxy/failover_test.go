@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/httpfilter"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/yamltool"
+)
+
+func TestFailover(t *testing.T) {
+	const yamlSpec = `
+name: proxy
+kind: Proxy
+mainPool:
+  servers:
+  - url: http://127.0.0.1:9095
+  loadBalance:
+    policy: roundRobin
+failover:
+  maxFailures: 2
+  recoverInterval: 50ms
+  pools:
+  - servers:
+    - url: http://127.0.0.2:9095
+    loadBalance:
+      policy: roundRobin
+`
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, e := httppipeline.NewFilterSpec(rawSpec, nil)
+	if e != nil {
+		t.Fatalf("unexpected error: %v", e)
+	}
+
+	proxy := &Proxy{}
+	proxy.Init(spec)
+	defer proxy.Close()
+
+	mainDown := true
+	var lastHost string
+	oldSendRequest := fnSendRequest
+	defer func() { fnSendRequest = oldSendRequest }()
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		lastHost = r.URL.Host
+		if mainDown && r.URL.Host == "127.0.0.1:9095" {
+			return nil, fmt.Errorf("mocked error")
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("this is the body")),
+		}, nil
+	}
+
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(http.Header{})
+	}
+	ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(http.Header{})
+	}
+
+	handle := func() string {
+		proxy.handle(ctx)
+		return lastHost
+	}
+
+	for i := 0; i < 2; i++ {
+		if host := handle(); host != "127.0.0.1:9095" {
+			t.Fatalf("request %d should go to main pool, but got %s", i, host)
+		}
+	}
+	if host := handle(); host != "127.0.0.2:9095" {
+		t.Fatalf("request should fail over, but got %s", host)
+	}
+
+	status := proxy.Status().(*Status)
+	if status.MainPool.Health.Healthy || len(status.FailoverPools) != 1 ||
+		!status.FailoverPools[0].Health.Healthy {
+		t.Errorf("unexpected status: main %+v, failover %+v", status.MainPool.Health, status.FailoverPools)
+	}
+
+	// the probe fails, so the main pool keeps unhealthy
+	time.Sleep(60 * time.Millisecond)
+	if host := handle(); host != "127.0.0.1:9095" {
+		t.Fatalf("request should probe main pool, but got %s", host)
+	}
+	if host := handle(); host != "127.0.0.2:9095" {
+		t.Fatalf("request should fail over, but got %s", host)
+	}
+
+	// the probe succeeds, so the traffic fails back
+	mainDown = false
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if host := handle(); host != "127.0.0.1:9095" {
+			t.Fatalf("request %d should fail back, but got %s", i, host)
+		}
+	}
+}
+
+func TestFailoverSpecValidate(t *testing.T) {
+	spec := FailoverSpec{Pools: []*PoolSpec{{}}}
+	if spec.Validate() != nil {
+		t.Error("validate should succeed")
+	}
+
+	spec.Pools[0].Filter = &httpfilter.Spec{}
+	if spec.Validate() == nil {
+		t.Error("validate should fail")
+	}
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+const (
+	// ForwardedPassThrough forwards the headers of the clients untouched.
+	ForwardedPassThrough = "passThrough"
+	// ForwardedAppend appends the client to the headers from the trusted
+	// proxies, and replaces the ones from others.
+	ForwardedAppend = "append"
+	// ForwardedOverwrite replaces the headers with the client.
+	ForwardedOverwrite = "overwrite"
+)
+
+type (
+	// ForwardedHeadersSpec describes how the X-Forwarded-For,
+	// X-Forwarded-Proto, X-Forwarded-Host and Forwarded headers are sent
+	// to the servers.
+	ForwardedHeadersSpec struct {
+		Policy string `yaml:"policy" jsonschema:"required,enum=passThrough,enum=append,enum=overwrite"`
+		// TrustedProxies are the IPs or CIDRs of the proxies in front
+		// of this one, whose headers are kept by the append policy.
+		TrustedProxies []string `yaml:"trustedProxies,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+		// Forwarded sends the Forwarded header of RFC 7239 too.
+		Forwarded bool `yaml:"forwarded,omitempty" jsonschema:"omitempty"`
+	}
+
+	forwardedHeaders struct {
+		policy    string
+		trusted   []*net.IPNet
+		forwarded bool
+	}
+)
+
+// Validate validates ForwardedHeadersSpec.
+func (spec ForwardedHeadersSpec) Validate() error {
+	_, err := spec.trustedProxies()
+	return err
+}
+
+func (spec *ForwardedHeadersSpec) trustedProxies() ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range spec.TrustedProxies {
+		if ip := net.ParseIP(s); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %s", s)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func newForwardedHeaders(spec *ForwardedHeadersSpec) *forwardedHeaders {
+	// NOTE: It has been validated.
+	trusted, _ := spec.trustedProxies()
+
+	return &forwardedHeaders{
+		policy:    spec.Policy,
+		trusted:   trusted,
+		forwarded: spec.Forwarded,
+	}
+}
+
+// trusts reports whether the headers from the peer are trusted.
+func (fh *forwardedHeaders) trusts(peer string) bool {
+	ip := net.ParseIP(peer)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range fh.trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareRequest sets the forwarded headers of the request to the server
+// by the request from the client, the header must not be shared.
+func (fh *forwardedHeaders) prepareRequest(header http.Header, client *http.Request) {
+	if fh.policy == ForwardedPassThrough {
+		return
+	}
+
+	peer := client.RemoteAddr
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+	proto := "http"
+	if client.TLS != nil {
+		proto = "https"
+	}
+
+	keep := fh.policy == ForwardedAppend && fh.trusts(peer)
+
+	// NOTE: The peer may have been appended by xForwardedFor of HTTPServer.
+	xff := peer
+	if prior := header.Values(httpheader.KeyXForwardedFor); keep && len(prior) > 0 {
+		xff = strings.Join(prior, ", ")
+		if i := strings.LastIndex(xff, ","); strings.TrimSpace(xff[i+1:]) != peer {
+			xff += ", " + peer
+		}
+	}
+	header.Set(httpheader.KeyXForwardedFor, xff)
+
+	if !keep || header.Get(httpheader.KeyXForwardedProto) == "" {
+		header.Set(httpheader.KeyXForwardedProto, proto)
+	}
+	if !keep || header.Get(httpheader.KeyXForwardedHost) == "" {
+		header.Set(httpheader.KeyXForwardedHost, client.Host)
+	}
+
+	if !fh.forwarded {
+		if !keep {
+			header.Del(httpheader.KeyForwarded)
+		}
+		return
+	}
+	element := fmt.Sprintf("for=%s;proto=%s;host=%s", forwardedNode(peer), proto, forwardedValue(client.Host))
+	if prior := header.Values(httpheader.KeyForwarded); keep && len(prior) > 0 {
+		element = strings.Join(prior, ", ") + ", " + element
+	}
+	header.Set(httpheader.KeyForwarded, element)
+}
+
+// forwardedNode returns the node of the Forwarded header, the IPv6
+// addresses are bracketed and quoted.
+func forwardedNode(ip string) string {
+	if strings.Contains(ip, ":") {
+		return `"[` + ip + `]"`
+	}
+	return ip
+}
+
+// forwardedValue quotes the value of the Forwarded header if it's not a
+// token, e.g. the host with a port.
+func forwardedValue(value string) string {
+	if strings.ContainsAny(value, `:"[]`) {
+		return `"` + strings.Replace(value, `"`, `\"`, -1) + `"`
+	}
+	return value
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForwardedHeaders(t *testing.T) {
+	spec := &ForwardedHeadersSpec{Policy: ForwardedAppend, TrustedProxies: []string{"10.0.0.0/8", "abc"}}
+	if spec.Validate() == nil {
+		t.Errorf("invalid trusted proxy should be invalid")
+	}
+	spec.TrustedProxies = []string{"10.0.0.0/8", "192.168.1.1", "::1"}
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	newClient := func(remoteAddr string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		r.RemoteAddr = remoteAddr
+		return r
+	}
+	spoofed := func() http.Header {
+		return http.Header{
+			"X-Forwarded-For":   {"1.1.1.1"},
+			"X-Forwarded-Proto": {"https"},
+			"X-Forwarded-Host":  {"evil.com"},
+			"Forwarded":         {"for=1.1.1.1"},
+		}
+	}
+
+	fh := newForwardedHeaders(spec)
+
+	// The headers from a trusted proxy are kept and appended.
+	header := spoofed()
+	fh.prepareRequest(header, newClient("10.1.2.3:1234"))
+	if got := header.Get("X-Forwarded-For"); got != "1.1.1.1, 10.1.2.3" {
+		t.Errorf("want the peer appended, got %s", got)
+	}
+	if header.Get("X-Forwarded-Proto") != "https" || header.Get("X-Forwarded-Host") != "evil.com" {
+		t.Errorf("want proto and host kept, got %v", header)
+	}
+	if header.Get("Forwarded") != "for=1.1.1.1" {
+		t.Errorf("want Forwarded kept, got %s", header.Get("Forwarded"))
+	}
+
+	// The peer appended by HTTPServer isn't appended again.
+	header = http.Header{"X-Forwarded-For": {"1.1.1.1, 192.168.1.1"}}
+	fh.prepareRequest(header, newClient("192.168.1.1:1234"))
+	if got := header.Get("X-Forwarded-For"); got != "1.1.1.1, 192.168.1.1" {
+		t.Errorf("want the peer not duplicated, got %s", got)
+	}
+
+	// The headers from others are replaced.
+	header = spoofed()
+	fh.prepareRequest(header, newClient("8.8.8.8:1234"))
+	if got := header.Get("X-Forwarded-For"); got != "8.8.8.8" {
+		t.Errorf("want the spoofed IP replaced, got %s", got)
+	}
+	if header.Get("X-Forwarded-Proto") != "http" || header.Get("X-Forwarded-Host") != "example.com" {
+		t.Errorf("want proto and host replaced, got %v", header)
+	}
+	if header.Get("Forwarded") != "" {
+		t.Errorf("want Forwarded removed, got %s", header.Get("Forwarded"))
+	}
+
+	// Overwrite ignores the trusted proxies and sends Forwarded.
+	fh = newForwardedHeaders(&ForwardedHeadersSpec{
+		Policy:         ForwardedOverwrite,
+		TrustedProxies: []string{"10.0.0.0/8"},
+		Forwarded:      true,
+	})
+	header = spoofed()
+	client := newClient("[::1]:1234")
+	client.Host = "example.com:8443"
+	client.TLS = &tls.ConnectionState{}
+	fh.prepareRequest(header, client)
+	if got := header.Get("X-Forwarded-For"); got != "::1" {
+		t.Errorf("want the peer only, got %s", got)
+	}
+	if header.Get("X-Forwarded-Proto") != "https" || header.Get("X-Forwarded-Host") != "example.com:8443" {
+		t.Errorf("want proto and host of the client, got %v", header)
+	}
+	if got, want := header.Get("Forwarded"), `for="[::1]";proto=https;host="example.com:8443"`; got != want {
+		t.Errorf("want Forwarded %s, got %s", want, got)
+	}
+
+	// PassThrough keeps everything.
+	fh = newForwardedHeaders(&ForwardedHeadersSpec{Policy: ForwardedPassThrough})
+	header = spoofed()
+	fh.prepareRequest(header, newClient("8.8.8.8:1234"))
+	if header.Get("X-Forwarded-For") != "1.1.1.1" || header.Get("Forwarded") != "for=1.1.1.1" {
+		t.Errorf("want the headers untouched, got %v", header)
+	}
+}
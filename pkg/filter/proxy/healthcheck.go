@@ -0,0 +1,423 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/egress"
+)
+
+const (
+	// HealthCheckHTTP checks servers by HTTP GET.
+	HealthCheckHTTP = "http"
+	// HealthCheckTCP checks servers by TCP connect.
+	HealthCheckTCP = "tcp"
+	// HealthCheckGRPC checks servers by grpc.health.v1.Health/Check.
+	HealthCheckGRPC = "grpc"
+
+	// maxHealthCheckBodySize is the maximum size of the body read for
+	// the assertions of HTTP checks.
+	maxHealthCheckBodySize = 64 * 1024
+
+	defaultHealthCheckPath               = "/"
+	defaultHealthCheckTimeout            = 3 * time.Second
+	defaultHealthCheckHealthyThreshold   = 2
+	defaultHealthCheckUnhealthyThreshold = 3
+)
+
+type (
+	// HealthCheckSpec describes the active health check of the servers of
+	// a pool, the servers marked down are skipped by load balance until
+	// they are up again. The servers responding 2xx or 3xx to HTTP checks,
+	// accepting TCP connections, or serving gRPC checks are healthy.
+	HealthCheckSpec struct {
+		Protocol string `yaml:"protocol,omitempty" jsonschema:"omitempty,enum=http,enum=tcp,enum=grpc"`
+		Path     string `yaml:"path" jsonschema:"omitempty,pattern=^/"`
+		Interval string `yaml:"interval" jsonschema:"required,format=duration"`
+		Timeout  string `yaml:"timeout" jsonschema:"omitempty,format=duration"`
+		// HealthyThreshold is the number of consecutive successes marking
+		// a down server up, UnhealthyThreshold is the number of
+		// consecutive failures marking an up server down.
+		HealthyThreshold   int `yaml:"healthyThreshold" jsonschema:"omitempty,minimum=0"`
+		UnhealthyThreshold int `yaml:"unhealthyThreshold" jsonschema:"omitempty,minimum=0"`
+
+		// ExpectedBody is the regular expression the body of HTTP checks
+		// must match, JSONFields are the values the fields of the JSON
+		// body must equal, keyed by their dot-separated paths.
+		ExpectedBody string            `yaml:"expectedBody,omitempty" jsonschema:"omitempty,format=regexp"`
+		JSONFields   map[string]string `yaml:"jsonFields,omitempty" jsonschema:"omitempty"`
+		// GRPCService is the service of gRPC checks, the overall health
+		// of the server is checked if it's empty.
+		GRPCService string `yaml:"grpcService,omitempty" jsonschema:"omitempty"`
+	}
+
+	healthCheck struct {
+		name               string
+		protocol           string
+		path               string
+		expectedBody       *regexp.Regexp
+		jsonFields         map[string]string
+		grpcService        string
+		interval           time.Duration
+		timeout            time.Duration
+		healthyThreshold   int
+		unhealthyThreshold int
+
+		servers *servers
+		client  *http.Client
+
+		// states are the health states of the servers keyed by their
+		// URLs, they are only accessed by the goroutine of checking.
+		states map[string]*serverHealth
+		done   chan struct{}
+	}
+
+	serverHealth struct {
+		down      bool
+		successes int
+		failures  int
+	}
+)
+
+// Validate validates HealthCheckSpec.
+func (spec HealthCheckSpec) Validate() error {
+	protocol := spec.Protocol
+	if protocol == "" {
+		protocol = HealthCheckHTTP
+	}
+
+	if protocol != HealthCheckHTTP &&
+		(spec.Path != "" || spec.ExpectedBody != "" || len(spec.JSONFields) != 0) {
+		return fmt.Errorf("path, expectedBody and jsonFields are only for http")
+	}
+	if protocol != HealthCheckGRPC && spec.GRPCService != "" {
+		return fmt.Errorf("grpcService is only for grpc")
+	}
+
+	for path := range spec.JSONFields {
+		if path == "" {
+			return fmt.Errorf("empty path in jsonFields")
+		}
+	}
+
+	return nil
+}
+
+func newHealthCheck(spec *HealthCheckSpec, name string, servers *servers, client *http.Client) *healthCheck {
+	// NOTE: They have been validated by format=duration.
+	interval, _ := time.ParseDuration(spec.Interval)
+	timeout, _ := time.ParseDuration(spec.Timeout)
+
+	hc := &healthCheck{
+		name:               name,
+		protocol:           spec.Protocol,
+		path:               spec.Path,
+		jsonFields:         spec.JSONFields,
+		grpcService:        spec.GRPCService,
+		interval:           interval,
+		timeout:            timeout,
+		healthyThreshold:   spec.HealthyThreshold,
+		unhealthyThreshold: spec.UnhealthyThreshold,
+		servers:            servers,
+		client:             client,
+		states:             map[string]*serverHealth{},
+		done:               make(chan struct{}),
+	}
+	if hc.protocol == "" {
+		hc.protocol = HealthCheckHTTP
+	}
+	if hc.path == "" {
+		hc.path = defaultHealthCheckPath
+	}
+	if spec.ExpectedBody != "" {
+		// NOTE: It has been validated by format=regexp.
+		hc.expectedBody = regexp.MustCompile(spec.ExpectedBody)
+	}
+	if hc.timeout <= 0 {
+		hc.timeout = defaultHealthCheckTimeout
+	}
+	if hc.healthyThreshold <= 0 {
+		hc.healthyThreshold = defaultHealthCheckHealthyThreshold
+	}
+	if hc.unhealthyThreshold <= 0 {
+		hc.unhealthyThreshold = defaultHealthCheckUnhealthyThreshold
+	}
+
+	go hc.run()
+
+	return hc
+}
+
+func (hc *healthCheck) run() {
+	ticker := time.NewTicker(hc.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hc.done:
+			return
+		case <-ticker.C:
+			hc.check()
+		}
+	}
+}
+
+// check probes all servers concurrently and marks them up or down, the
+// servers of service registry are changing, so they are taken from the
+// latest snapshot every time.
+func (hc *healthCheck) check() {
+	all := hc.servers.snapshot().servers
+
+	results := make([]bool, len(all))
+	wg := &sync.WaitGroup{}
+	for i, server := range all {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			results[i] = hc.probe(url)
+		}(i, server.URL)
+	}
+	wg.Wait()
+
+	states := make(map[string]*serverHealth, len(all))
+	down := map[string]bool{}
+	for i, server := range all {
+		state, exists := hc.states[server.URL]
+		if !exists {
+			state = &serverHealth{}
+		}
+		states[server.URL] = state
+		hc.update(server.URL, state, results[i])
+
+		if state.down {
+			down[server.URL] = true
+		}
+	}
+	hc.states = states
+
+	hc.servers.setDown(down)
+}
+
+func (hc *healthCheck) update(url string, state *serverHealth, healthy bool) {
+	if healthy {
+		state.successes, state.failures = state.successes+1, 0
+		if state.down && state.successes >= hc.healthyThreshold {
+			state.down = false
+			logger.Infof("%s: server %s is up", hc.name, url)
+		}
+		return
+	}
+
+	state.successes, state.failures = 0, state.failures+1
+	if !state.down && state.failures >= hc.unhealthyThreshold {
+		state.down = true
+		logger.Warnf("%s: server %s is down", hc.name, url)
+	}
+}
+
+func (hc *healthCheck) probe(url string) bool {
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), hc.timeout)
+	defer cancel()
+
+	switch hc.protocol {
+	case HealthCheckTCP:
+		return hc.probeTCP(ctx, url)
+	case HealthCheckGRPC:
+		return hc.probeGRPC(ctx, url)
+	default:
+		return hc.probeHTTP(ctx, url)
+	}
+}
+
+func (hc *healthCheck) probeHTTP(ctx stdcontext.Context, url string) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+hc.path, nil)
+	if err != nil {
+		logger.Errorf("%s: new health check request to %s failed: %v", hc.name, url, err)
+		return false
+	}
+
+	resp, err := hc.client.Do(req)
+	if err != nil {
+		return false
+	}
+
+	// NOTE: The body must be read to completion to reuse the connection.
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return false
+	}
+	if hc.expectedBody == nil && len(hc.jsonFields) == 0 {
+		return true
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxHealthCheckBodySize))
+	if err != nil {
+		return false
+	}
+	if hc.expectedBody != nil && !hc.expectedBody.Match(body) {
+		return false
+	}
+	if len(hc.jsonFields) != 0 {
+		return matchJSONFields(body, hc.jsonFields)
+	}
+
+	return true
+}
+
+// matchJSONFields reports whether the fields of the JSON body equal the
+// values, the elements of arrays are indexed by numbers in the paths.
+func matchJSONFields(body []byte, fields map[string]string) bool {
+	decoder := json.NewDecoder(strings.NewReader(string(body)))
+	decoder.UseNumber()
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return false
+	}
+
+	for path, expected := range fields {
+		v := doc
+		for _, key := range strings.Split(path, ".") {
+			switch node := v.(type) {
+			case map[string]interface{}:
+				v = node[key]
+			case []interface{}:
+				i, err := strconv.Atoi(key)
+				if err != nil || i < 0 || i >= len(node) {
+					return false
+				}
+				v = node[i]
+			default:
+				return false
+			}
+		}
+
+		if v == nil || fmt.Sprint(v) != expected {
+			return false
+		}
+	}
+
+	return true
+}
+
+// serverAddress returns the host and port of the server URL, the default
+// port of the scheme is used if the port is missing.
+func serverAddress(rawURL string) (addr string, https bool, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false, err
+	}
+
+	https = u.Scheme == "https"
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if https {
+			port = "443"
+		}
+	}
+
+	return net.JoinHostPort(u.Hostname(), port), https, nil
+}
+
+func (hc *healthCheck) probeTCP(ctx stdcontext.Context, url string) bool {
+	addr, _, err := serverAddress(url)
+	if err != nil {
+		logger.Errorf("%s: invalid server url %s: %v", hc.name, url, err)
+		return false
+	}
+
+	dial := egress.Dialer((&net.Dialer{}).DialContext)
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+
+	return true
+}
+
+func (hc *healthCheck) probeGRPC(ctx stdcontext.Context, url string) bool {
+	addr, https, err := serverAddress(url)
+	if err != nil {
+		logger.Errorf("%s: invalid server url %s: %v", hc.name, url, err)
+		return false
+	}
+
+	dial := egress.Dialer((&net.Dialer{}).DialContext)
+	opts := []grpc.DialOption{
+		grpc.WithBlock(),
+		grpc.WithContextDialer(func(ctx stdcontext.Context, addr string) (net.Conn, error) {
+			return dial(ctx, "tcp", addr)
+		}),
+	}
+	if https {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(hc.tlsConfig())))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+
+	conn, err := grpc.DialContext(ctx, addr, opts...)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx,
+		&healthpb.HealthCheckRequest{Service: hc.grpcService})
+	if err != nil {
+		return false
+	}
+
+	return resp.Status == healthpb.HealthCheckResponse_SERVING
+}
+
+// tlsConfig returns the TLS config of the client of the pool.
+func (hc *healthCheck) tlsConfig() *tls.Config {
+	if transport, ok := hc.client.Transport.(*http.Transport); ok && transport.TLSClientConfig != nil {
+		return transport.TLSClientConfig.Clone()
+	}
+	return &tls.Config{}
+}
+
+func (hc *healthCheck) close() {
+	close(hc.done)
+}
@@ -0,0 +1,223 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+)
+
+func TestHealthCheck(t *testing.T) {
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer good.Close()
+
+	var failing int32 = 1
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer bad.Close()
+
+	s := &servers{poolSpec: &PoolSpec{
+		LoadBalance: &LoadBalance{Policy: PolicyRoundRobin},
+		Servers:     []*Server{{URL: good.URL}, {URL: bad.URL}},
+	}}
+	s.useStaticServers()
+
+	hc := newHealthCheck(&HealthCheckSpec{
+		Path:               "/healthz",
+		Interval:           "1h",
+		UnhealthyThreshold: 2,
+	}, "proxy#main", s, http.DefaultClient)
+	defer hc.close()
+
+	ctx := &contexttest.MockedHTTPContext{}
+	picked := func(url string) bool {
+		for i := 0; i < 4; i++ {
+			if server, _ := s.next(ctx); server.URL == url {
+				return true
+			}
+		}
+		return false
+	}
+
+	hc.check()
+	if len(s.downServers()) != 0 || !picked(bad.URL) {
+		t.Fatalf("server should not be down before reaching the threshold")
+	}
+
+	hc.check()
+	if down := s.downServers(); len(down) != 1 || down[0] != bad.URL {
+		t.Fatalf("expect %s down, got %v", bad.URL, down)
+	}
+	if picked(bad.URL) {
+		t.Fatalf("down server should be skipped")
+	}
+
+	atomic.StoreInt32(&failing, 0)
+	hc.check()
+	if picked(bad.URL) {
+		t.Fatalf("server should not be up before reaching the threshold")
+	}
+	hc.check()
+	if len(s.downServers()) != 0 || !picked(bad.URL) {
+		t.Fatalf("server should be up again")
+	}
+
+	// all servers are available if all of them are down
+	s.setDown(map[string]bool{good.URL: true, bad.URL: true})
+	if !picked(good.URL) || !picked(bad.URL) {
+		t.Fatalf("all servers should be available if all of them are down")
+	}
+}
+
+func TestHealthCheckSpecValidate(t *testing.T) {
+	valid := []HealthCheckSpec{
+		{},
+		{Path: "/healthz", ExpectedBody: "ok", JSONFields: map[string]string{"status": "UP"}},
+		{Protocol: HealthCheckTCP},
+		{Protocol: HealthCheckGRPC, GRPCService: "foo"},
+	}
+	for i, spec := range valid {
+		if err := spec.Validate(); err != nil {
+			t.Errorf("spec %d: unexpected error: %v", i, err)
+		}
+	}
+
+	invalid := []HealthCheckSpec{
+		{Protocol: HealthCheckTCP, Path: "/healthz"},
+		{Protocol: HealthCheckGRPC, ExpectedBody: "ok"},
+		{GRPCService: "foo"},
+		{JSONFields: map[string]string{"": "UP"}},
+	}
+	for i, spec := range invalid {
+		if err := spec.Validate(); err == nil {
+			t.Errorf("spec %d: expect an error", i)
+		}
+	}
+}
+
+func TestHealthCheckHTTPAssertions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"UP","checks":[{"name":"db","count":3}]}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		spec    HealthCheckSpec
+		healthy bool
+	}{
+		{HealthCheckSpec{ExpectedBody: `"status":"UP"`}, true},
+		{HealthCheckSpec{ExpectedBody: `"status":"DOWN"`}, false},
+		{HealthCheckSpec{JSONFields: map[string]string{"status": "UP", "checks.0.count": "3"}}, true},
+		{HealthCheckSpec{JSONFields: map[string]string{"status": "DOWN"}}, false},
+		{HealthCheckSpec{JSONFields: map[string]string{"checks.1.name": "db"}}, false},
+		{HealthCheckSpec{JSONFields: map[string]string{"missing": ""}}, false},
+	}
+
+	for i, test := range tests {
+		test.spec.Interval = "1h"
+		hc := newHealthCheck(&test.spec, "proxy#main", &servers{}, http.DefaultClient)
+		if got := hc.probe(server.URL); got != test.healthy {
+			t.Errorf("case %d: expect healthy %v, got %v", i, test.healthy, got)
+		}
+		hc.close()
+	}
+}
+
+func TestHealthCheckTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := "http://" + ln.Addr().String()
+	defer ln.Close()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedURL := "http://" + closed.Addr().String()
+	closed.Close()
+
+	hc := newHealthCheck(&HealthCheckSpec{
+		Protocol: HealthCheckTCP,
+		Interval: "1h",
+		Timeout:  "1s",
+	}, "proxy#main", &servers{}, http.DefaultClient)
+	defer hc.close()
+
+	if !hc.probe(open) {
+		t.Errorf("expect %s healthy", open)
+	}
+	if hc.probe(closedURL) {
+		t.Errorf("expect %s unhealthy", closedURL)
+	}
+}
+
+func TestHealthCheckGRPC(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hs := health.NewServer()
+	hs.SetServingStatus("foo", healthpb.HealthCheckResponse_SERVING)
+	hs.SetServingStatus("bar", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	gs := grpc.NewServer()
+	healthpb.RegisterHealthServer(gs, hs)
+	go gs.Serve(ln)
+	defer gs.Stop()
+
+	url := "http://" + ln.Addr().String()
+	probe := func(service string) bool {
+		hc := newHealthCheck(&HealthCheckSpec{
+			Protocol:    HealthCheckGRPC,
+			Interval:    "1h",
+			Timeout:     "1s",
+			GRPCService: service,
+		}, "proxy#main", &servers{}, http.DefaultClient)
+		defer hc.close()
+		return hc.probe(url)
+	}
+
+	if !probe("") || !probe("foo") {
+		t.Errorf("expect serving services healthy")
+	}
+	if probe("bar") || probe("unknown") {
+		t.Errorf("expect not serving services unhealthy")
+	}
+
+	gs.Stop()
+	time.Sleep(10 * time.Millisecond)
+	if probe("") {
+		t.Errorf("expect stopped server unhealthy")
+	}
+}
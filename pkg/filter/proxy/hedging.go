@@ -0,0 +1,235 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+type (
+	// HedgingSpec describes the request hedging of a pool. A duplicate
+	// request is sent to another server if the first one hasn't got the
+	// response header within the delay, the first response wins and the
+	// other request is canceled.
+	HedgingSpec struct {
+		Delay string `yaml:"delay" jsonschema:"required,format=duration"`
+		// Methods are the methods of the requests to hedge, which must
+		// be idempotent, default is GET and HEAD.
+		Methods []string `yaml:"methods,omitempty" jsonschema:"omitempty,uniqueItems=true,format=httpmethod-array"`
+	}
+
+	// HedgingStatus is the status of the request hedging.
+	HedgingStatus struct {
+		// Hedged is the number of the requests hedged, and Won is the
+		// number of them responded by the hedged requests.
+		Hedged uint64 `yaml:"hedged"`
+		Won    uint64 `yaml:"won"`
+	}
+
+	hedgingPolicy struct {
+		delay   time.Duration
+		methods []string
+
+		hedged uint64
+		won    uint64
+	}
+
+	// hedgedTry is a request sent to a server, which may be hedged.
+	hedgedTry struct {
+		server *Server
+		permit *breakerPermit
+		req    *request
+		cancel stdcontext.CancelFunc
+
+		resp *http.Response
+		span tracing.Span
+		err  error
+	}
+)
+
+func newHedgingPolicy(spec *HedgingSpec) *hedgingPolicy {
+	// NOTE: It has been validated by format=duration.
+	delay, _ := time.ParseDuration(spec.Delay)
+
+	methods := spec.Methods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead}
+	}
+
+	return &hedgingPolicy{delay: delay, methods: methods}
+}
+
+// hedgeable reports whether the request could be hedged, the WebSocket
+// requests are never hedged.
+func (hp *hedgingPolicy) hedgeable(ctx context.HTTPContext) bool {
+	return stringtool.StrInSlice(ctx.Request().Method(), hp.methods) && !isWebSocketRequest(ctx)
+}
+
+func (hp *hedgingPolicy) status() *HedgingStatus {
+	return &HedgingStatus{
+		Hedged: atomic.LoadUint64(&hp.hedged),
+		Won:    atomic.LoadUint64(&hp.won),
+	}
+}
+
+// doHedgedRequest sends the first request, and a hedged one to another
+// server if the first one doesn't respond within the delay. It returns
+// the winner, the other one is canceled and cleaned up in background.
+// If one of them fails, the other one is returned whether it fails too.
+func (p *pool) doHedgedRequest(ctx context.HTTPContext, group int, tried map[*Server]bool,
+	reqBody io.Reader, deadline time.Time, first *hedgedTry) *hedgedTry {
+
+	// NOTE: The header of the context is not shared by the requests
+	// sent at the same time, and the first one must be cancellable.
+	first.req.std.Header = first.req.std.Header.Clone()
+	reqCtx, cancel := stdcontext.WithCancel(first.req.std.Context())
+	first.req.std = first.req.std.WithContext(reqCtx)
+	tryCancel := first.cancel
+	first.cancel = func() {
+		cancel()
+		tryCancel()
+	}
+
+	results := make(chan *hedgedTry, 2)
+	send := func(t *hedgedTry) {
+		t.resp, t.span, t.err = p.doRequest(ctx, t.req)
+		results <- t
+	}
+	go send(first)
+
+	timer := time.NewTimer(p.hedging.delay)
+	defer timer.Stop()
+	select {
+	case t := <-results:
+		return t
+	case <-timer.C:
+	}
+
+	second := p.newHedgedTry(ctx, group, tried, reqBody, deadline, first.server)
+	if second == nil {
+		return <-results
+	}
+	atomic.AddUint64(&p.hedging.hedged, 1)
+	ctx.Lock()
+	ctx.SetKV(stringtool.Cat(p.tagPrefix, "#hedge"), second.server.URL)
+	ctx.Unlock()
+	go send(second)
+
+	winner := <-results
+	if winner.err != nil {
+		p.abandonHedgedTry(winner)
+		winner = <-results
+	} else {
+		loser := first
+		if winner == first {
+			loser = second
+		}
+		loser.cancel()
+		go func() {
+			p.abandonHedgedTry(<-results)
+		}()
+	}
+
+	if winner == second {
+		atomic.AddUint64(&p.hedging.won, 1)
+	}
+	return winner
+}
+
+// newHedgedTry prepares the hedged request to a server other than the
+// tried ones, it returns nil if there is no such server available.
+func (p *pool) newHedgedTry(ctx context.HTTPContext, group int, tried map[*Server]bool,
+	reqBody io.Reader, deadline time.Time, first *Server) *hedgedTry {
+
+	excluded := map[*Server]bool{first: true}
+	for server := range tried {
+		excluded[server] = true
+	}
+	server, err := p.servers.nextExcept(ctx, group, excluded)
+	if err != nil || excluded[server] {
+		return nil
+	}
+
+	// NOTE: The hedged request is never queued or spilled.
+	if p.concurrency == nil {
+		server.acquire()
+	} else if !p.concurrency.tryAcquire(server) {
+		return nil
+	}
+
+	var permit *breakerPermit
+	if p.breakers != nil {
+		var permitted bool
+		if permit, permitted = p.breakers.acquire(server.URL); !permitted {
+			p.release(server)
+			return nil
+		}
+	}
+	if p.keepAlive != nil {
+		p.keepAlive.touch(server.URL)
+	}
+
+	req, err := p.prepareRequest(ctx, server, reqBody)
+	if err != nil {
+		p.release(server)
+		permit.record(false, 0)
+		return nil
+	}
+	req.std.Header = req.std.Header.Clone()
+	// NOTE: Only the first attempt is hedged.
+	req.attempt, req.hedged = 1, true
+
+	var reqCtx stdcontext.Context
+	var cancel stdcontext.CancelFunc
+	if deadline.IsZero() {
+		reqCtx, cancel = stdcontext.WithCancel(req.std.Context())
+	} else {
+		reqCtx, cancel = stdcontext.WithDeadline(req.std.Context(), deadline)
+	}
+	req.std = req.std.WithContext(reqCtx)
+
+	if tried != nil {
+		tried[server] = true
+	}
+
+	return &hedgedTry{server: server, permit: permit, req: req, cancel: cancel}
+}
+
+// abandonHedgedTry cleans up the request which doesn't win, it isn't
+// counted as a failure of the server since it may be canceled.
+func (p *pool) abandonHedgedTry(t *hedgedTry) {
+	t.cancel()
+	if t.err == nil {
+		io.Copy(ioutil.Discard, t.resp.Body)
+		t.resp.Body.Close()
+		t.req.finish()
+		t.span.SetTag("abandoned", true)
+		t.span.Finish()
+	}
+	p.release(t.server)
+	t.permit.record(false, time.Since(t.req.startTime()))
+}
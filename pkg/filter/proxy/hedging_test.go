@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/yamltool"
+)
+
+func TestHedging(t *testing.T) {
+	const yamlSpec = `
+name: proxy
+kind: Proxy
+mainPool:
+  servers:
+  - url: http://127.0.0.1:9095
+  - url: http://127.0.0.2:9095
+  loadBalance:
+    policy: roundRobin
+  hedging:
+    delay: 10ms
+`
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, e := httppipeline.NewFilterSpec(rawSpec, nil)
+	if e != nil {
+		t.Fatalf("unexpected error: %v", e)
+	}
+
+	proxy := &Proxy{}
+	proxy.Init(spec)
+	defer proxy.Close()
+
+	var canceled int32
+	oldSendRequest := fnSendRequest
+	defer func() { fnSendRequest = oldSendRequest }()
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		if r.URL.Host == "127.0.0.1:9095" {
+			select {
+			case <-r.Context().Done():
+				atomic.AddInt32(&canceled, 1)
+				return nil, r.Context().Err()
+			case <-time.After(5 * time.Second):
+			}
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader(r.URL.Host)),
+		}, nil
+	}
+
+	method := http.MethodGet
+	newContext := func(body *string) *contexttest.MockedHTTPContext {
+		ctx := &contexttest.MockedHTTPContext{}
+		ctx.MockedRequest.MockedMethod = func() string {
+			return method
+		}
+		ctx.MockedRequest.MockedStd = func() *http.Request {
+			return httptest.NewRequest(method, "/", nil)
+		}
+		ctx.MockedRequest.MockedBody = func() io.Reader {
+			return strings.NewReader("")
+		}
+		ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+			return httpheader.New(http.Header{})
+		}
+		ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader {
+			return httpheader.New(http.Header{})
+		}
+		ctx.MockedResponse.MockedSetBody = func(r io.Reader) {
+			data, _ := io.ReadAll(r)
+			*body = string(data)
+		}
+		return ctx
+	}
+
+	for i := 0; i < 2; i++ {
+		var body string
+		start := time.Now()
+		proxy.handle(newContext(&body))
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("the request should be responded by the hedged one, but took %s", d)
+		}
+		if body != "127.0.0.2:9095" {
+			t.Errorf("want the response of the fast server, got %q", body)
+		}
+	}
+
+	status := proxy.mainPool.status().Hedging
+	if status.Hedged == 0 || status.Won != status.Hedged {
+		t.Errorf("every hedged request should win, got %+v", status)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&canceled); uint64(n) != status.Hedged {
+		t.Errorf("want %d slow requests canceled, got %d", status.Hedged, n)
+	}
+
+	var body string
+	ctx := newContext(&body)
+	if !proxy.mainPool.hedging.hedgeable(ctx) {
+		t.Errorf("GET requests should be hedged")
+	}
+	method = http.MethodPost
+	if proxy.mainPool.hedging.hedgeable(ctx) {
+		t.Errorf("POST requests should not be hedged by default")
+	}
+}
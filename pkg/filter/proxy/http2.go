@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http2"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+const (
+	// ProtocolHTTP is HTTP/1.1, or HTTP/2 negotiated by TLS ALPN if
+	// http2 of the client is enabled.
+	ProtocolHTTP = "http"
+	// ProtocolH2C is HTTP/2 over cleartext TCP with prior knowledge.
+	ProtocolH2C = "h2c"
+	// ProtocolGRPC is HTTP/2 for gRPC, it's over cleartext TCP for the
+	// http URLs, and over TLS for the https ones.
+	ProtocolGRPC = "grpc"
+)
+
+type (
+	// http2Transport sends the requests by HTTP/2 without negotiation,
+	// the http URLs are sent over cleartext TCP.
+	http2Transport struct {
+		h2c *http2.Transport
+		h2  *http2.Transport
+	}
+
+	// streamBody flushes the response to the client once the data of
+	// the server has been written, so the gRPC streams aren't delayed,
+	// and passes the trailers of the server to the client at the end.
+	streamBody struct {
+		r       io.Reader
+		resp    *http.Response
+		w       http.ResponseWriter
+		pending bool
+	}
+)
+
+// http2Required reports whether the server requires HTTP/2.
+func (s *Server) http2Required() bool {
+	return s.Protocol == ProtocolH2C || s.Protocol == ProtocolGRPC
+}
+
+// usesHTTP2 reports whether any static server of the proxy requires HTTP/2.
+func (s *Spec) usesHTTP2() bool {
+	for _, pool := range s.poolSpecs() {
+		for _, server := range pool.Servers {
+			if server.http2Required() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newHTTP2Client returns the client for the servers requiring HTTP/2, it
+// dials and verifies the servers as the client of the proxy does.
+func newHTTP2Client(spec *Spec) *http.Client {
+	dial := newDialContext(spec)
+
+	tlsConfig := globalClient.Transport.(*http.Transport).TLSClientConfig.Clone()
+	if spec.TLS != nil {
+		// NOTE: It has been validated.
+		tlsConfig, _ = spec.TLS.tlsConfig()
+	}
+
+	transport := &http2Transport{
+		h2c: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return dial(stdcontext.Background(), network, addr)
+			},
+		},
+		h2: &http2.Transport{
+			TLSClientConfig: tlsConfig,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				conn, err := dial(stdcontext.Background(), network, addr)
+				if err != nil {
+					return nil, err
+				}
+				tlsConn := tls.Client(conn, cfg)
+				if err := tlsConn.Handshake(); err != nil {
+					conn.Close()
+					return nil, err
+				}
+				return tlsConn, nil
+			},
+		},
+	}
+
+	return &http.Client{
+		Timeout:       globalClient.Timeout,
+		Transport:     transport,
+		CheckRedirect: globalClient.CheckRedirect,
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *http2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "https" {
+		return t.h2.RoundTrip(req)
+	}
+	return t.h2c.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of both transports.
+func (t *http2Transport) CloseIdleConnections() {
+	t.h2c.CloseIdleConnections()
+	t.h2.CloseIdleConnections()
+}
+
+// isGRPC reports whether the content type is of gRPC.
+func isGRPC(contentType string) bool {
+	return strings.HasPrefix(contentType, "application/grpc")
+}
+
+// isGRPCRequest reports whether the request is a gRPC call, whose body
+// is a stream which can't be buffered.
+func isGRPCRequest(ctx context.HTTPContext) bool {
+	return isGRPC(ctx.Request().Header().Get(httpheader.KeyContentType))
+}
+
+// newStreamBody wraps the body of the response if it's a gRPC stream or
+// has trailers, otherwise it returns the body as is.
+func newStreamBody(ctx context.HTTPContext, resp *http.Response, body io.Reader) io.Reader {
+	if !isGRPC(resp.Header.Get(httpheader.KeyContentType)) && len(resp.Trailer) == 0 {
+		return body
+	}
+	return &streamBody{r: body, resp: resp, w: ctx.Response().Std()}
+}
+
+func (sb *streamBody) Read(p []byte) (int, error) {
+	// NOTE: The data of the last read has been written to the client
+	// when it's called again, flush it before waiting for more data.
+	if sb.pending {
+		if f, ok := sb.w.(http.Flusher); ok {
+			f.Flush()
+		}
+		sb.pending = false
+	}
+
+	n, err := sb.r.Read(p)
+	sb.pending = n > 0
+	if err == io.EOF {
+		// NOTE: The trailers are filled after the body is read to EOF,
+		// the keys with the prefix are sent as trailers by net/http.
+		header := sb.w.Header()
+		for key, values := range sb.resp.Trailer {
+			for _, value := range values {
+				header.Add(http.TrailerPrefix+key, value)
+			}
+		}
+	}
+	return n, err
+}
+
+// Close closes the wrapped body.
+func (sb *streamBody) Close() error {
+	if c, ok := sb.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
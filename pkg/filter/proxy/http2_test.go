@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/yamltool"
+)
+
+func TestH2CServer(t *testing.T) {
+	server := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			w.WriteHeader(http.StatusHTTPVersionNotSupported)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write([]byte("hello"))
+		w.Header().Set("Grpc-Status", "0")
+	}), &http2.Server{}))
+	defer server.Close()
+
+	yamlSpec := fmt.Sprintf(`
+name: proxy
+kind: Proxy
+mainPool:
+  servers:
+  - url: %s
+    protocol: grpc
+  loadBalance:
+    policy: roundRobin
+`, server.URL)
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, e := httppipeline.NewFilterSpec(rawSpec, nil)
+	if e != nil {
+		t.Fatalf("unexpected error: %v", e)
+	}
+
+	proxy := &Proxy{}
+	proxy.Init(spec)
+	defer proxy.Close()
+	if proxy.h2Client == nil {
+		t.Fatal("HTTP/2 client should be created")
+	}
+
+	var body io.Reader
+	statusCode := 0
+	w := httptest.NewRecorder()
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedMethod = func() string {
+		return http.MethodPost
+	}
+	ctx.MockedRequest.MockedPath = func() string {
+		return "/helloworld.Greeter/SayHello"
+	}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(http.Header{"Content-Type": []string{"application/grpc"}})
+	}
+	ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(w.Header())
+	}
+	ctx.MockedResponse.MockedSetStatusCode = func(code int) {
+		statusCode = code
+	}
+	ctx.MockedResponse.MockedSetBody = func(reader io.Reader) {
+		body = reader
+	}
+	ctx.MockedResponse.MockedStd = func() http.ResponseWriter {
+		return w
+	}
+
+	proxy.handle(ctx)
+	if statusCode != http.StatusOK {
+		t.Fatalf("want %d, got %d", http.StatusOK, statusCode)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("unexpected body: %q, %v", data, err)
+	}
+	if got := w.Header().Get(http.TrailerPrefix + "Grpc-Status"); got != "0" {
+		t.Errorf("want trailer Grpc-Status 0, got %q", got)
+	}
+
+	// h2c is only for http URLs
+	poolSpec := &PoolSpec{
+		Servers:     []*Server{{URL: "https://127.0.0.1:9090", Protocol: ProtocolH2C}},
+		LoadBalance: &LoadBalance{Policy: PolicyRoundRobin},
+	}
+	if poolSpec.Validate() == nil {
+		t.Error("h2c with https URL should be invalid")
+	}
+}
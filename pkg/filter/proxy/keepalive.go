@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	defaultKeepAlivePath   = "/"
+	defaultKeepAliveMethod = http.MethodHead
+
+	keepAliveTimeout = 5 * time.Second
+)
+
+type (
+	// KeepAliveSpec describes the synthetic requests sent to the idle
+	// servers of a pool, which keep the states of NAT, firewalls and the
+	// connections in the transport warm.
+	KeepAliveSpec struct {
+		// Interval is the idle duration of a server before sending a
+		// keep-alive request, and the interval between them.
+		Interval string `yaml:"interval" jsonschema:"required,format=duration"`
+		Path     string `yaml:"path" jsonschema:"omitempty,pattern=^/"`
+		Method   string `yaml:"method" jsonschema:"omitempty,enum=GET,enum=HEAD,enum=OPTIONS"`
+	}
+
+	keepAlive struct {
+		name     string
+		interval time.Duration
+		path     string
+		method   string
+
+		servers *servers
+		client  *http.Client
+
+		// lastActive is the unix nano time of the last request of the
+		// servers keyed by their URLs.
+		lastActive sync.Map
+		done       chan struct{}
+	}
+)
+
+func newKeepAlive(spec *KeepAliveSpec, name string, servers *servers, client *http.Client) *keepAlive {
+	// NOTE: It has been validated by format=duration.
+	interval, _ := time.ParseDuration(spec.Interval)
+
+	ka := &keepAlive{
+		name:     name,
+		interval: interval,
+		path:     spec.Path,
+		method:   spec.Method,
+		servers:  servers,
+		client:   client,
+		done:     make(chan struct{}),
+	}
+	if ka.path == "" {
+		ka.path = defaultKeepAlivePath
+	}
+	if ka.method == "" {
+		ka.method = defaultKeepAliveMethod
+	}
+
+	go ka.run()
+
+	return ka
+}
+
+// touch records the server is active now.
+func (ka *keepAlive) touch(url string) {
+	ka.lastActive.Store(url, time.Now().UnixNano())
+}
+
+func (ka *keepAlive) run() {
+	ticker := time.NewTicker(ka.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ka.done:
+			return
+		case now := <-ticker.C:
+			ka.probeIdleServers(now)
+		}
+	}
+}
+
+// probeIdleServers sends keep-alive requests to the servers idle for an
+// interval, the servers of service registry are changing, so they are
+// taken from the latest snapshot every time.
+func (ka *keepAlive) probeIdleServers(now time.Time) {
+	active := map[string]bool{}
+	for _, server := range ka.servers.snapshot().servers {
+		active[server.URL] = true
+
+		if lastActive, ok := ka.lastActive.Load(server.URL); ok &&
+			now.Sub(time.Unix(0, lastActive.(int64))) < ka.interval {
+			continue
+		}
+
+		ka.touch(server.URL)
+		go ka.probe(server.URL)
+	}
+
+	ka.lastActive.Range(func(url, _ interface{}) bool {
+		if !active[url.(string)] {
+			ka.lastActive.Delete(url)
+		}
+		return true
+	})
+}
+
+func (ka *keepAlive) probe(url string) {
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), keepAliveTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, ka.method, url+ka.path, nil)
+	if err != nil {
+		logger.Errorf("%s: new keep-alive request to %s failed: %v", ka.name, url, err)
+		return
+	}
+
+	resp, err := ka.client.Do(req)
+	if err != nil {
+		logger.Warnf("%s: keep-alive request to %s failed: %v", ka.name, url, err)
+		return
+	}
+
+	// NOTE: The body must be read to completion to reuse the connection.
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+func (ka *keepAlive) close() {
+	close(ka.done)
+}
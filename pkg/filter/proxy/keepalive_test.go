@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestKeepAlive(t *testing.T) {
+	probes := make(chan string, 10)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes <- r.Method + " " + r.URL.Path
+	}))
+	defer backend.Close()
+
+	s := &servers{poolSpec: &PoolSpec{
+		LoadBalance: &LoadBalance{Policy: PolicyRoundRobin},
+		Servers:     []*Server{{URL: backend.URL}},
+	}}
+	s.useStaticServers()
+
+	ka := newKeepAlive(&KeepAliveSpec{Interval: "1h", Path: "/ping"}, "proxy#main", s, http.DefaultClient)
+	defer ka.close()
+
+	waitProbe := func() string {
+		select {
+		case probe := <-probes:
+			return probe
+		case <-time.After(time.Second):
+			return ""
+		}
+	}
+
+	// the server is idle since the beginning
+	now := time.Now()
+	ka.probeIdleServers(now)
+	if probe := waitProbe(); probe != "HEAD /ping" {
+		t.Fatalf("expect keep-alive request HEAD /ping, got %q", probe)
+	}
+
+	ka.touch(backend.URL)
+	ka.probeIdleServers(now.Add(30 * time.Minute))
+	if probe := waitProbe(); probe != "" {
+		t.Fatalf("active server should not be probed, got %q", probe)
+	}
+
+	ka.probeIdleServers(now.Add(2 * time.Hour))
+	if probe := waitProbe(); probe != "HEAD /ping" {
+		t.Fatalf("expect keep-alive request HEAD /ping, got %q", probe)
+	}
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/codecounter"
+	"github.com/megaease/easegress/pkg/util/exposition"
+)
+
+// metricsRegistry holds the proxies of this member whose metrics are
+// exported, a proxy is registered by Init and unregistered by Close.
+var metricsRegistry = struct {
+	mutex   sync.Mutex
+	proxies map[*Proxy]struct{}
+}{
+	proxies: make(map[*Proxy]struct{}),
+}
+
+func registerMetrics(b *Proxy) {
+	metricsRegistry.mutex.Lock()
+	defer metricsRegistry.mutex.Unlock()
+
+	metricsRegistry.proxies[b] = struct{}{}
+}
+
+func unregisterMetrics(b *Proxy) {
+	metricsRegistry.mutex.Lock()
+	defer metricsRegistry.mutex.Unlock()
+
+	delete(metricsRegistry.proxies, b)
+}
+
+// Metrics returns the metrics of the pools and the servers of all proxies
+// in the text format of Prometheus, they are labeled by the pipeline, the
+// name of the proxy, i.e. the backend, and the pool.
+func Metrics() []byte {
+	metricsRegistry.mutex.Lock()
+	proxies := make([]*Proxy, 0, len(metricsRegistry.proxies))
+	for b := range metricsRegistry.proxies {
+		proxies = append(proxies, b)
+	}
+	metricsRegistry.mutex.Unlock()
+
+	sort.Slice(proxies, func(i, j int) bool {
+		pi, pj := proxies[i].filterSpec, proxies[j].filterSpec
+		if pi.Pipeline() != pj.Pipeline() {
+			return pi.Pipeline() < pj.Pipeline()
+		}
+		return pi.Name() < pj.Name()
+	})
+
+	e := exposition.New()
+	for _, b := range proxies {
+		addProxyMetrics(e, []exposition.Label{
+			{Name: "pipeline", Value: b.filterSpec.Pipeline()},
+			{Name: "backend", Value: b.filterSpec.Name()},
+		}, b.Status().(*Status))
+	}
+	return e.Bytes()
+}
+
+func addProxyMetrics(e *exposition.Exposition, labels []exposition.Label, s *Status) {
+	addPool := func(pool string, ps *PoolStatus) {
+		if ps != nil {
+			addPoolMetrics(e, exposition.WithLabel(labels, "pool", pool), ps)
+		}
+	}
+
+	addPool("mainPool", s.MainPool)
+	for i, ps := range s.CandidatePools {
+		addPool(fmt.Sprintf("candidatePool%d", i), ps)
+	}
+	addPool("mirrorPool", s.MirrorPool)
+	for i, ps := range s.FailoverPools {
+		addPool(fmt.Sprintf("failoverPool%d", i), ps)
+	}
+}
+
+func addPoolMetrics(e *exposition.Exposition, labels []exposition.Label, s *PoolStatus) {
+	if s.Stat != nil {
+		e.AddHTTPStat(labels, s.Stat)
+		addStatusClasses(e, "easegress_proxy_responses_total", labels, s.Stat.Codes)
+	}
+	e.Add("easegress_proxy_retries_total", exposition.TypeCounter, labels, float64(s.Retries))
+	e.Add("easegress_proxy_ejections_total", exposition.TypeCounter, labels, float64(s.Ejections))
+
+	urls := make([]string, 0, len(s.Servers))
+	for url := range s.Servers {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	for _, url := range urls {
+		addServerMetrics(e, exposition.WithLabel(labels, "server", url), s.Servers[url])
+	}
+}
+
+func addServerMetrics(e *exposition.Exposition, labels []exposition.Label, s *codecounter.Stats) {
+	addStatusClasses(e, "easegress_proxy_server_responses_total", labels, s.Codes)
+
+	classes := make([]string, 0, len(s.Errors))
+	for class := range s.Errors {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		e.Add("easegress_proxy_server_errors_total", exposition.TypeCounter,
+			exposition.WithLabel(labels, "error", class), float64(s.Errors[class]))
+	}
+
+	addDurationHistogram(e, "easegress_proxy_server_request_duration_seconds", labels, s.Durations)
+
+	phases := make([]string, 0, len(s.Phases))
+	for phase := range s.Phases {
+		phases = append(phases, phase)
+	}
+	sort.Strings(phases)
+	for _, phase := range phases {
+		addDurationHistogram(e, "easegress_proxy_server_phase_duration_seconds",
+			exposition.WithLabel(labels, "phase", phase), s.Phases[phase])
+	}
+}
+
+func addDurationHistogram(e *exposition.Exposition, name string,
+	labels []exposition.Label, buckets []*codecounter.DurationBucket) {
+
+	if len(buckets) == 0 {
+		return
+	}
+	les := make([]string, 0, len(buckets))
+	counts := make([]uint64, 0, len(buckets))
+	for _, bucket := range buckets {
+		le := bucket.LE
+		if d, err := time.ParseDuration(le); err == nil {
+			le = strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+		}
+		les = append(les, le)
+		counts = append(counts, bucket.Count)
+	}
+	e.AddHistogram(name, labels, les, counts)
+}
+
+// addStatusClasses adds the counts of the codes by their classes, i.e.
+// 2xx, 3xx, 4xx and 5xx.
+func addStatusClasses(e *exposition.Exposition, name string, labels []exposition.Label, codes map[int]uint64) {
+	classes := map[int]uint64{}
+	for code, count := range codes {
+		classes[code/100] += count
+	}
+	for class := 1; class <= 5; class++ {
+		if count, exists := classes[class]; exists {
+			e.Add(name, exposition.TypeCounter,
+				exposition.WithLabel(labels, "class", fmt.Sprintf("%dxx", class)), float64(count))
+		}
+	}
+}
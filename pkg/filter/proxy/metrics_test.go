@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/codecounter"
+	"github.com/megaease/easegress/pkg/util/exposition"
+	"github.com/megaease/easegress/pkg/util/httpstat"
+	"github.com/megaease/easegress/pkg/util/yamltool"
+)
+
+func TestMetrics(t *testing.T) {
+	e := exposition.New()
+	addProxyMetrics(e, []exposition.Label{{Name: "pipeline", Value: "p"}, {Name: "backend", Value: "b"}}, &Status{
+		MainPool: &PoolStatus{
+			Stat:      &httpstat.Status{Count: 4, Codes: map[int]uint64{200: 2, 204: 1, 503: 1}},
+			Retries:   3,
+			Ejections: 1,
+			Servers: map[string]*codecounter.Stats{
+				"http://127.0.0.1:9095": {
+					Codes: map[int]uint64{200: 2},
+					Durations: []*codecounter.DurationBucket{
+						{LE: "10ms", Count: 1}, {LE: "100ms", Count: 1}, {LE: "+Inf", Count: 1},
+					},
+					Errors: map[string]uint64{codecounter.ErrorDial: 1},
+				},
+			},
+		},
+		FailoverPools: []*PoolStatus{{Stat: &httpstat.Status{Count: 1}}},
+	})
+
+	text := string(e.Bytes())
+	for _, want := range []string{
+		`easegress_http_requests_total{pipeline="p",backend="b",pool="mainPool"} 4`,
+		`easegress_http_requests_total{pipeline="p",backend="b",pool="failoverPool0"} 1`,
+		`easegress_proxy_responses_total{pipeline="p",backend="b",pool="mainPool",class="2xx"} 3`,
+		`easegress_proxy_responses_total{pipeline="p",backend="b",pool="mainPool",class="5xx"} 1`,
+		`easegress_proxy_retries_total{pipeline="p",backend="b",pool="mainPool"} 3`,
+		`easegress_proxy_ejections_total{pipeline="p",backend="b",pool="mainPool"} 1`,
+		`easegress_proxy_server_responses_total{pipeline="p",backend="b",pool="mainPool",server="http://127.0.0.1:9095",class="2xx"} 2`,
+		`easegress_proxy_server_errors_total{pipeline="p",backend="b",pool="mainPool",server="http://127.0.0.1:9095",error="dial"} 1`,
+		`easegress_proxy_server_request_duration_seconds_bucket{pipeline="p",backend="b",pool="mainPool",server="http://127.0.0.1:9095",le="0.01"} 1`,
+		`easegress_proxy_server_request_duration_seconds_bucket{pipeline="p",backend="b",pool="mainPool",server="http://127.0.0.1:9095",le="0.1"} 2`,
+		`easegress_proxy_server_request_duration_seconds_count{pipeline="p",backend="b",pool="mainPool",server="http://127.0.0.1:9095"} 3`,
+	} {
+		if !strings.Contains(text, want+"\n") {
+			t.Errorf("want %q in metrics:\n%s", want, text)
+		}
+	}
+}
+
+func TestMetricsRegistry(t *testing.T) {
+	const yamlSpec = `
+name: metricsProxy
+kind: Proxy
+mainPool:
+  servers:
+  - url: http://127.0.0.1:9095
+  loadBalance:
+    policy: roundRobin
+  serverStats: {}
+`
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, e := httppipeline.NewFilterSpec(rawSpec, nil)
+	if e != nil {
+		t.Fatalf("unexpected error: %v", e)
+	}
+
+	proxy := &Proxy{}
+	proxy.Init(spec)
+	if !strings.Contains(string(Metrics()), `backend="metricsProxy"`) {
+		t.Errorf("want the metrics of the proxy after init")
+	}
+
+	inherited := &Proxy{}
+	inherited.Inherit(spec, proxy)
+	metricsRegistry.mutex.Lock()
+	_, prevExists := metricsRegistry.proxies[proxy]
+	_, exists := metricsRegistry.proxies[inherited]
+	metricsRegistry.mutex.Unlock()
+	if prevExists || !exists {
+		t.Errorf("want the previous generation replaced in the registry")
+	}
+
+	inherited.Close()
+	if strings.Contains(string(Metrics()), `backend="metricsProxy"`) {
+		t.Errorf("want no metrics of the proxy after close")
+	}
+}
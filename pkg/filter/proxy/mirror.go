@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	librl "github.com/megaease/easegress/pkg/util/ratelimiter"
+)
+
+type (
+	// MirrorSamplingSpec limits the traffic shadowed to the mirror pool,
+	// full mirroring of the production traffic may overwhelm the staging
+	// environments. The requests not sampled are only sent to the
+	// serving pool.
+	MirrorSamplingSpec struct {
+		// Percentage is the percentage of the matched requests to be
+		// mirrored, all of them are mirrored if it's zero.
+		Percentage float64 `yaml:"percentage,omitempty" jsonschema:"omitempty,minimum=0,maximum=100"`
+		// MaxRPS is the max requests per second sent to the mirror pool,
+		// it's unlimited if it's zero.
+		MaxRPS int `yaml:"maxRPS,omitempty" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// MirrorSamplingStatus is the status of the mirror sampling.
+	MirrorSamplingStatus struct {
+		Sampled uint64 `yaml:"sampled"`
+		Skipped uint64 `yaml:"skipped"`
+	}
+
+	mirrorSampler struct {
+		spec    *MirrorSamplingSpec
+		limiter *librl.RateLimiter
+
+		sampled uint64
+		skipped uint64
+	}
+)
+
+// Validate validates MirrorSamplingSpec.
+func (spec MirrorSamplingSpec) Validate() error {
+	if spec.Percentage < 0 || spec.Percentage > 100 {
+		return fmt.Errorf("percentage must be in [0, 100]")
+	}
+	if spec.MaxRPS < 0 {
+		return fmt.Errorf("maxRPS must not be negative")
+	}
+	return nil
+}
+
+func newMirrorSampler(spec *MirrorSamplingSpec) *mirrorSampler {
+	ms := &mirrorSampler{spec: spec}
+	if spec.MaxRPS > 0 {
+		// No timeout, the requests beyond the limit are skipped
+		// rather than delayed.
+		ms.limiter = librl.New(&librl.Policy{
+			LimitRefreshPeriod: time.Second,
+			LimitForPeriod:     spec.MaxRPS,
+		})
+	}
+	return ms
+}
+
+// sample reports whether the request should be mirrored, the percentage
+// is checked before the rate limit to keep the limit for the sampled ones.
+func (ms *mirrorSampler) sample() bool {
+	if ms.spec.Percentage > 0 && rand.Float64()*100 >= ms.spec.Percentage {
+		atomic.AddUint64(&ms.skipped, 1)
+		return false
+	}
+	if ms.limiter != nil {
+		if permitted, _ := ms.limiter.AcquirePermission(); !permitted {
+			atomic.AddUint64(&ms.skipped, 1)
+			return false
+		}
+	}
+	atomic.AddUint64(&ms.sampled, 1)
+	return true
+}
+
+func (ms *mirrorSampler) status() *MirrorSamplingStatus {
+	return &MirrorSamplingStatus{
+		Sampled: atomic.LoadUint64(&ms.sampled),
+		Skipped: atomic.LoadUint64(&ms.skipped),
+	}
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"testing"
+)
+
+func TestMirrorSamplingSpec(t *testing.T) {
+	for _, spec := range []MirrorSamplingSpec{{Percentage: -1}, {Percentage: 101}, {MaxRPS: -1}} {
+		if spec.Validate() == nil {
+			t.Errorf("spec %+v should be invalid", spec)
+		}
+	}
+
+	spec := &Spec{
+		MainPool:       &PoolSpec{},
+		MirrorSampling: &MirrorSamplingSpec{Percentage: 10},
+	}
+	if spec.Validate() == nil {
+		t.Error("mirrorSampling without mirrorPool should be invalid")
+	}
+}
+
+func TestMirrorSampler(t *testing.T) {
+	ms := newMirrorSampler(&MirrorSamplingSpec{})
+	for i := 0; i < 100; i++ {
+		if !ms.sample() {
+			t.Fatal("all requests should be sampled")
+		}
+	}
+
+	ms = newMirrorSampler(&MirrorSamplingSpec{MaxRPS: 10})
+	sampled := 0
+	for i := 0; i < 100; i++ {
+		if ms.sample() {
+			sampled++
+		}
+	}
+	if sampled != 10 {
+		t.Errorf("want 10 sampled requests, got %d", sampled)
+	}
+	if s := ms.status(); s.Sampled != 10 || s.Skipped != 90 {
+		t.Errorf("unexpected status: %+v", s)
+	}
+
+	ms = newMirrorSampler(&MirrorSamplingSpec{Percentage: 20})
+	sampled = 0
+	for i := 0; i < 10000; i++ {
+		if ms.sample() {
+			sampled++
+		}
+	}
+	if sampled < 1500 || sampled > 2500 {
+		t.Errorf("want about 2000 sampled requests, got %d", sampled)
+	}
+}
@@ -0,0 +1,305 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codecounter"
+)
+
+const (
+	defaultOutlierMinRequests        = 20
+	defaultOutlierMaxErrorRate       = 50
+	defaultOutlierBaseEjectionTime   = 30 * time.Second
+	defaultOutlierMaxEjectionPercent = 50
+)
+
+type (
+	// OutlierDetectionSpec describes the passive outlier detection of the
+	// servers of a pool, the servers with too many 5xx responses or
+	// connection errors are ejected from load balance for a while.
+	OutlierDetectionSpec struct {
+		// Interval is the interval of evaluating the servers by the
+		// requests since the last evaluation.
+		Interval    string `yaml:"interval" jsonschema:"required,format=duration"`
+		MinRequests uint64 `yaml:"minRequests" jsonschema:"omitempty"`
+		// MaxErrorRate is in percentage, e.g. 50 means 50%.
+		MaxErrorRate float64 `yaml:"maxErrorRate" jsonschema:"omitempty,minimum=0,maximum=100"`
+		// BaseEjectionTime is multiplied by the times a server has been
+		// ejected, which decreases by one every interval it serves requests
+		// without exceeding the error rate.
+		BaseEjectionTime   string `yaml:"baseEjectionTime" jsonschema:"omitempty,format=duration"`
+		MaxEjectionPercent int    `yaml:"maxEjectionPercent" jsonschema:"omitempty,minimum=0,maximum=100"`
+		// Window is the sliding window of the requests to evaluate the
+		// servers by, instead of the requests since the last evaluation.
+		Window string `yaml:"window,omitempty" jsonschema:"omitempty,format=duration"`
+	}
+
+	outlierDetection struct {
+		name               string
+		interval           time.Duration
+		minRequests        uint64
+		maxErrorRate       float64
+		baseEjectionTime   time.Duration
+		maxEjectionPercent int
+		window             time.Duration
+
+		servers *servers
+
+		mutex sync.Mutex
+		// counters count the status codes of the servers since the last
+		// evaluation keyed by their URLs.
+		counters map[string]*codecounter.CodeCounter
+		// buckets count the status codes of the servers in the time
+		// buckets if the window is set, they are not reset by evaluation.
+		buckets map[string]*codecounter.BucketCounter
+		// states are only accessed by the goroutine of evaluating.
+		states map[string]*outlierState
+		// ejections is the number of the ejections of all servers.
+		ejections uint64
+		done      chan struct{}
+	}
+
+	outlierState struct {
+		ejections   int
+		ejectedTill time.Time
+	}
+)
+
+// Validate validates OutlierDetectionSpec.
+func (spec OutlierDetectionSpec) Validate() error {
+	if spec.Window == "" {
+		return nil
+	}
+
+	// NOTE: It has been validated by format=duration.
+	window, _ := time.ParseDuration(spec.Window)
+	span := codecounter.DefaultBucketWidth * codecounter.DefaultBucketCount
+	if window <= 0 || window > span {
+		return fmt.Errorf("window must be in (0, %s]", span)
+	}
+	return nil
+}
+
+func newOutlierDetection(spec *OutlierDetectionSpec, name string, servers *servers) *outlierDetection {
+	// NOTE: They have been validated by format=duration.
+	interval, _ := time.ParseDuration(spec.Interval)
+	baseEjectionTime, _ := time.ParseDuration(spec.BaseEjectionTime)
+	window, _ := time.ParseDuration(spec.Window)
+
+	od := &outlierDetection{
+		name:               name,
+		interval:           interval,
+		minRequests:        spec.MinRequests,
+		maxErrorRate:       spec.MaxErrorRate,
+		baseEjectionTime:   baseEjectionTime,
+		maxEjectionPercent: spec.MaxEjectionPercent,
+		window:             window,
+		servers:            servers,
+		counters:           map[string]*codecounter.CodeCounter{},
+		buckets:            map[string]*codecounter.BucketCounter{},
+		states:             map[string]*outlierState{},
+		done:               make(chan struct{}),
+	}
+	if od.minRequests == 0 {
+		od.minRequests = defaultOutlierMinRequests
+	}
+	if od.maxErrorRate == 0 {
+		od.maxErrorRate = defaultOutlierMaxErrorRate
+	}
+	if od.baseEjectionTime <= 0 {
+		od.baseEjectionTime = defaultOutlierBaseEjectionTime
+	}
+	if od.maxEjectionPercent == 0 {
+		od.maxEjectionPercent = defaultOutlierMaxEjectionPercent
+	}
+
+	go od.run()
+
+	return od
+}
+
+// count counts the status code of the response of the server, the
+// connection errors are counted as 503 like the response of the pool.
+func (od *outlierDetection) count(url string, code int) {
+	od.mutex.Lock()
+	defer od.mutex.Unlock()
+
+	if od.window > 0 {
+		bc, exists := od.buckets[url]
+		if !exists {
+			bc = codecounter.NewBuckets(codecounter.DefaultBucketWidth, codecounter.DefaultBucketCount)
+			od.buckets[url] = bc
+		}
+		bc.Count(code)
+		return
+	}
+
+	cc, exists := od.counters[url]
+	if !exists {
+		cc = codecounter.New()
+		od.counters[url] = cc
+	}
+	cc.Count(code)
+}
+
+func (od *outlierDetection) run() {
+	ticker := time.NewTicker(od.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-od.done:
+			return
+		case now := <-ticker.C:
+			od.evaluate(now)
+		}
+	}
+}
+
+// evaluate ejects the servers exceeding the error rate, and re-admits the
+// ejected ones whose ejection time is over.
+func (od *outlierDetection) evaluate(now time.Time) {
+	all := od.servers.snapshot().servers
+	counters := od.takeCodes(all)
+
+	maxEjected := len(all) * od.maxEjectionPercent / 100
+
+	states := make(map[string]*outlierState, len(all))
+	ejected := map[string]bool{}
+	candidates := []string{}
+	for _, server := range all {
+		state, exists := od.states[server.URL]
+		if !exists {
+			state = &outlierState{}
+		}
+		states[server.URL] = state
+
+		if now.Before(state.ejectedTill) {
+			ejected[server.URL] = true
+			continue
+		}
+
+		codes, exists := counters[server.URL]
+		if !exists {
+			continue
+		}
+		if od.outlier(codes) {
+			candidates = append(candidates, server.URL)
+		} else if state.ejections > 0 {
+			state.ejections--
+		}
+	}
+	od.states = states
+
+	// NOTE: The order makes the ejections stable if they are limited.
+	sort.Strings(candidates)
+	for _, url := range candidates {
+		if len(ejected) >= maxEjected {
+			break
+		}
+
+		state := states[url]
+		state.ejections++
+		state.ejectedTill = now.Add(od.baseEjectionTime * time.Duration(state.ejections))
+		ejected[url] = true
+		atomic.AddUint64(&od.ejections, 1)
+		logger.Warnf("%s: server %s is ejected till %s", od.name, url, state.ejectedTill.Format(time.RFC3339))
+	}
+
+	// NOTE: The codes before the ejection are dropped, otherwise the
+	// re-admitted servers are ejected again by them within the window.
+	if od.window > 0 && len(candidates) > 0 {
+		od.mutex.Lock()
+		for _, url := range candidates {
+			if ejected[url] {
+				delete(od.buckets, url)
+			}
+		}
+		od.mutex.Unlock()
+	}
+
+	od.servers.setEjected(ejected)
+}
+
+// takeCodes returns the codes of the servers to evaluate, the counters
+// are reset unless the window is set, and the buckets of the removed
+// servers are dropped.
+func (od *outlierDetection) takeCodes(all []*Server) map[string]map[int]uint64 {
+	od.mutex.Lock()
+	defer od.mutex.Unlock()
+
+	codes := make(map[string]map[int]uint64, len(all))
+	if od.window == 0 {
+		for url, cc := range od.counters {
+			codes[url] = cc.Codes()
+		}
+		od.counters = map[string]*codecounter.CodeCounter{}
+		return codes
+	}
+
+	buckets := make(map[string]*codecounter.BucketCounter, len(all))
+	for _, server := range all {
+		if bc, exists := od.buckets[server.URL]; exists {
+			buckets[server.URL] = bc
+			codes[server.URL] = bc.Codes(od.window)
+		}
+	}
+	od.buckets = buckets
+	return codes
+}
+
+// errorRates returns the per second rates of 5xx of the servers in the
+// window, it returns nil if the window is not set.
+func (od *outlierDetection) errorRates() map[string]float64 {
+	if od.window == 0 {
+		return nil
+	}
+
+	od.mutex.Lock()
+	defer od.mutex.Unlock()
+
+	rates := make(map[string]float64, len(od.buckets))
+	for url, bc := range od.buckets {
+		rates[url] = bc.Rate(od.window, 500, 599)
+	}
+	return rates
+}
+
+// outlier reports whether the error rate of the codes exceeds the limit.
+func (od *outlierDetection) outlier(codes map[int]uint64) bool {
+	var total, errors uint64
+	for code, count := range codes {
+		total += count
+		if code >= 500 {
+			errors += count
+		}
+	}
+
+	return total >= od.minRequests && float64(errors)*100/float64(total) > od.maxErrorRate
+}
+
+func (od *outlierDetection) close() {
+	close(od.done)
+}
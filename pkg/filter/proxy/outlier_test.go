@@ -0,0 +1,149 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutlierDetection(t *testing.T) {
+	urls := []string{"http://127.0.0.1:9090", "http://127.0.0.1:9091", "http://127.0.0.1:9092"}
+	s := &servers{poolSpec: &PoolSpec{
+		LoadBalance: &LoadBalance{Policy: PolicyRoundRobin},
+		Servers:     []*Server{{URL: urls[0]}, {URL: urls[1]}, {URL: urls[2]}},
+	}}
+	s.useStaticServers()
+
+	od := newOutlierDetection(&OutlierDetectionSpec{
+		Interval:         "1h",
+		MinRequests:      10,
+		MaxErrorRate:     50,
+		BaseEjectionTime: "1m",
+	}, "proxy#main", s)
+	defer od.close()
+
+	countRequests := func(url string, ok, failed int) {
+		for i := 0; i < ok; i++ {
+			od.count(url, 200)
+		}
+		for i := 0; i < failed; i++ {
+			od.count(url, 503)
+		}
+	}
+	ejected := func(want ...string) {
+		t.Helper()
+		got := s.ejectedServers()
+		if len(got) != len(want) {
+			t.Fatalf("want ejected %v, got %v", want, got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("want ejected %v, got %v", want, got)
+			}
+		}
+	}
+
+	now := time.Now()
+
+	// not enough requests
+	countRequests(urls[0], 0, 5)
+	od.evaluate(now)
+	ejected()
+
+	// at most 50% of servers are ejected
+	countRequests(urls[0], 4, 6)
+	countRequests(urls[1], 0, 10)
+	countRequests(urls[2], 6, 4)
+	od.evaluate(now)
+	ejected(urls[0])
+	if s.available.len() != 2 {
+		t.Fatalf("ejected server should be skipped")
+	}
+
+	now = now.Add(time.Minute)
+	od.evaluate(now)
+	ejected()
+
+	// the ejection time grows with the ejections
+	countRequests(urls[0], 0, 10)
+	od.evaluate(now)
+	ejected(urls[0])
+	od.evaluate(now.Add(time.Minute))
+	ejected(urls[0])
+	now = now.Add(2 * time.Minute)
+	od.evaluate(now)
+	ejected()
+	countRequests(urls[0], 10, 0)
+	od.evaluate(now)
+	if od.states[urls[0]].ejections != 1 {
+		t.Fatalf("ejections should decrease after serving well, got %d", od.states[urls[0]].ejections)
+	}
+}
+
+func TestOutlierDetectionWindow(t *testing.T) {
+	if (OutlierDetectionSpec{Interval: "1s", Window: "10m"}).Validate() == nil {
+		t.Error("window longer than 5m should be invalid")
+	}
+
+	urls := []string{"http://127.0.0.1:9090", "http://127.0.0.1:9091"}
+	s := &servers{poolSpec: &PoolSpec{
+		LoadBalance: &LoadBalance{Policy: PolicyRoundRobin},
+		Servers:     []*Server{{URL: urls[0]}, {URL: urls[1]}},
+	}}
+	s.useStaticServers()
+
+	od := newOutlierDetection(&OutlierDetectionSpec{
+		Interval:           "1h",
+		MinRequests:        10,
+		MaxErrorRate:       50,
+		BaseEjectionTime:   "1m",
+		MaxEjectionPercent: 100,
+		Window:             "1m",
+	}, "proxy#main", s)
+	defer od.close()
+
+	// the requests are accumulated in the window across evaluations
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		od.count(urls[0], 503)
+	}
+	od.evaluate(now)
+	if got := s.ejectedServers(); len(got) != 0 {
+		t.Fatalf("want no ejected servers, got %v", got)
+	}
+	for i := 0; i < 5; i++ {
+		od.count(urls[0], 503)
+		od.count(urls[1], 200)
+	}
+
+	rates := od.errorRates()
+	if rates[urls[0]] != 10.0/60 || rates[urls[1]] != 0 {
+		t.Errorf("unexpected error rates: %v", rates)
+	}
+
+	od.evaluate(now)
+	if got := s.ejectedServers(); len(got) != 1 || got[0] != urls[0] {
+		t.Fatalf("want %s ejected, got %v", urls[0], got)
+	}
+
+	// the codes before the ejection are dropped
+	if _, exists := od.errorRates()[urls[0]]; exists {
+		t.Errorf("codes of the ejected server should be dropped")
+	}
+}
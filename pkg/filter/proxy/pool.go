@@ -18,19 +18,26 @@
 package proxy
 
 import (
+	stdcontext "context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/opentracing/opentracing-go"
 
 	"github.com/megaease/easegress/pkg/context"
-	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/tracing"
 	"github.com/megaease/easegress/pkg/util/callbackreader"
+	"github.com/megaease/easegress/pkg/util/codecounter"
+	"github.com/megaease/easegress/pkg/util/gatewaychain"
 	"github.com/megaease/easegress/pkg/util/httpfilter"
 	"github.com/megaease/easegress/pkg/util/httpheader"
 	"github.com/megaease/easegress/pkg/util/httpstat"
@@ -50,6 +57,36 @@ type (
 		servers     *servers
 		httpStat    *httpstat.HTTPStat
 		memoryCache *memorycache.MemoryCache
+		// health is only for the pools in failover.
+		health *poolHealth
+		// canaryWeight is only for the candidate pools.
+		canaryWeight *int32
+		keepAlive    *keepAlive
+		healthCheck  *healthCheck
+		outlier      *outlierDetection
+		retry        *retryPolicy
+		hedging      *hedgingPolicy
+		breakers     *serverBreakers
+		concurrency  *concurrencyLimit
+		serverStats  *serverStats
+		groups       *trafficGroups
+		// chain and requestTimeout are shared by all pools of the proxy.
+		chain          *gatewaychain.Chain
+		requestTimeout time.Duration
+		requestBody    *RequestBodySpec
+		webSocket      *webSocket
+		// forwardedHeaders is shared by all pools of the proxy.
+		forwardedHeaders *forwardedHeaders
+
+		upstreamCompression *UpstreamCompressionSpec
+
+		client *http.Client
+		// h2Client is for the servers requiring HTTP/2.
+		h2Client *http.Client
+		// ppClient is for the servers requiring the PROXY protocol.
+		ppClient *http.Client
+		// sniClients are for the servers overriding the TLS server name.
+		sniClients *sniClients
 	}
 
 	// PoolSpec describes a pool of servers.
@@ -62,18 +99,71 @@ type (
 		ServiceName     string            `yaml:"serviceName" jsonschema:"omitempty"`
 		LoadBalance     *LoadBalance      `yaml:"loadBalance" jsonschema:"required"`
 		MemoryCache     *memorycache.Spec `yaml:"memoryCache,omitempty" jsonschema:"omitempty"`
+		KeepAlive       *KeepAliveSpec    `yaml:"keepAlive,omitempty" jsonschema:"omitempty"`
+		HealthCheck     *HealthCheckSpec  `yaml:"healthCheck,omitempty" jsonschema:"omitempty"`
+
+		OutlierDetection *OutlierDetectionSpec `yaml:"outlierDetection,omitempty" jsonschema:"omitempty"`
+		Retry            *RetrySpec            `yaml:"retry,omitempty" jsonschema:"omitempty"`
+		Hedging          *HedgingSpec          `yaml:"hedging,omitempty" jsonschema:"omitempty"`
+		CircuitBreaker   *CircuitBreakerSpec   `yaml:"circuitBreaker,omitempty" jsonschema:"omitempty"`
+		ConcurrencyLimit *ConcurrencyLimitSpec `yaml:"concurrencyLimit,omitempty" jsonschema:"omitempty"`
+		ServerStats      *ServerStatsSpec      `yaml:"serverStats,omitempty" jsonschema:"omitempty"`
+
+		// ServerGroup is the name of the ServerGroup providing the
+		// servers, servers are used until the group is available.
+		ServerGroup string `yaml:"serverGroup,omitempty" jsonschema:"omitempty,format=servergroup"`
+		// DNS expands the static servers by resolving their hostnames.
+		DNS *DNSSpec `yaml:"dns,omitempty" jsonschema:"omitempty"`
+		// TrafficGroups splits the traffic among the named groups of
+		// the servers.
+		TrafficGroups []*TrafficGroupSpec `yaml:"trafficGroups,omitempty" jsonschema:"omitempty"`
 	}
 
 	// PoolStatus is the status of Pool.
 	PoolStatus struct {
-		Stat *httpstat.Status `yaml:"stat"`
+		Stat        *httpstat.Status    `yaml:"stat"`
+		Health      *PoolHealthStatus   `yaml:"health,omitempty"`
+		MemoryCache *memorycache.Status `yaml:"memoryCache,omitempty"`
+		// DownServers are the URLs of the servers marked down by health check.
+		DownServers []string `yaml:"downServers,omitempty"`
+		// EjectedServers are the URLs of the servers ejected by outlier detection.
+		EjectedServers []string `yaml:"ejectedServers,omitempty"`
+		// ServerErrorRates are the per second rates of 5xx of the servers
+		// in the window of outlier detection.
+		ServerErrorRates map[string]float64 `yaml:"serverErrorRates,omitempty"`
+		// CircuitBreakers are the states of the circuit breakers which are not closed.
+		CircuitBreakers map[string]string `yaml:"circuitBreakers,omitempty"`
+		// TrafficGroups are the counts of the status codes of the traffic groups.
+		TrafficGroups map[string]map[int]uint64 `yaml:"trafficGroups,omitempty"`
+		// Transport are the statistics of the connections to the servers.
+		Transport map[string]*TransportStatus `yaml:"transport,omitempty"`
+		Hedging   *HedgingStatus              `yaml:"hedging,omitempty"`
+
+		ConcurrencyLimit *ConcurrencyLimitStatus `yaml:"concurrencyLimit,omitempty"`
+		// Servers are the statistics of the servers, i.e. the codes, the
+		// duration histogram and the classes of errors.
+		Servers map[string]*codecounter.Stats `yaml:"servers,omitempty"`
+		// Retries is the number of the retries of the requests.
+		Retries uint64 `yaml:"retries,omitempty"`
+		// Ejections is the number of the ejections by outlier detection.
+		Ejections uint64 `yaml:"ejections,omitempty"`
 	}
 )
 
 // Validate validates poolSpec.
 func (s PoolSpec) Validate() error {
-	if s.ServiceName == "" && len(s.Servers) == 0 {
-		return fmt.Errorf("both serviceName and servers are empty")
+	if s.ServiceName == "" && s.ServerGroup == "" && len(s.Servers) == 0 {
+		return fmt.Errorf("serviceName, serverGroup and servers are all empty")
+	}
+	if s.ServiceName != "" && s.ServerGroup != "" {
+		return fmt.Errorf("serviceName and serverGroup are exclusive")
+	}
+	if s.DNS != nil && (s.ServiceName != "" || s.ServerGroup != "") {
+		return fmt.Errorf("dns is only for static servers")
+	}
+
+	if err := validateTrafficGroups(s.TrafficGroups); err != nil {
+		return err
 	}
 
 	serversGotWeight := 0
@@ -81,24 +171,41 @@ func (s PoolSpec) Validate() error {
 		if server.Weight > 0 {
 			serversGotWeight++
 		}
+		if server.Protocol == ProtocolH2C && strings.HasPrefix(server.URL, "https://") {
+			return fmt.Errorf("server %s: h2c is only for http URLs", server.URL)
+		}
+		if server.ProxyProtocol != "" && server.http2Required() {
+			return fmt.Errorf("server %s: proxyProtocol is not supported by %s", server.URL, server.Protocol)
+		}
+		if server.SNI != "" && server.http2Required() {
+			return fmt.Errorf("server %s: sni is not supported by %s", server.URL, server.Protocol)
+		}
+		if server.SNI != "" && server.ProxyProtocol != "" {
+			return fmt.Errorf("server %s: sni and proxyProtocol are exclusive", server.URL)
+		}
 	}
 	if serversGotWeight > 0 && serversGotWeight < len(s.Servers) {
 		return fmt.Errorf("not all servers have weight(%d/%d)",
 			serversGotWeight, len(s.Servers))
 	}
 
-	if s.ServiceName == "" {
+	if s.ServiceName == "" && s.ServerGroup == "" {
 		servers := newStaticServers(s.Servers, s.ServersTags, s.LoadBalance)
 		if servers.len() == 0 {
 			return fmt.Errorf("serversTags picks none of servers")
 		}
+		for _, group := range s.TrafficGroups {
+			if newStaticServers(servers.servers, group.ServersTags, nil).len() == 0 {
+				return fmt.Errorf("serversTags of traffic group %s picks none of servers", group.Name)
+			}
+		}
 	}
 
 	return nil
 }
 
 func newPool(super *supervisor.Supervisor, spec *PoolSpec, tagPrefix string,
-	writeResponse bool, failureCodes []int) *pool {
+	writeResponse bool, failureCodes []int, client *http.Client) *pool {
 
 	var filter *httpfilter.HTTPFilter
 	if spec.Filter != nil {
@@ -110,7 +217,7 @@ func newPool(super *supervisor.Supervisor, spec *PoolSpec, tagPrefix string,
 		memoryCache = memorycache.New(spec.MemoryCache)
 	}
 
-	return &pool{
+	p := &pool{
 		spec: spec,
 
 		tagPrefix:     tagPrefix,
@@ -120,19 +227,88 @@ func newPool(super *supervisor.Supervisor, spec *PoolSpec, tagPrefix string,
 		servers:     newServers(super, spec),
 		httpStat:    httpstat.New(),
 		memoryCache: memoryCache,
+		client:      client,
+	}
+
+	if spec.KeepAlive != nil {
+		p.keepAlive = newKeepAlive(spec.KeepAlive, tagPrefix, p.servers, client)
+	}
+	if spec.HealthCheck != nil {
+		p.healthCheck = newHealthCheck(spec.HealthCheck, tagPrefix, p.servers, client)
 	}
+	if spec.OutlierDetection != nil {
+		p.outlier = newOutlierDetection(spec.OutlierDetection, tagPrefix, p.servers)
+	}
+	if spec.Retry != nil {
+		p.retry = newRetryPolicy(spec.Retry)
+	}
+	if spec.Hedging != nil {
+		p.hedging = newHedgingPolicy(spec.Hedging)
+	}
+	if spec.CircuitBreaker != nil {
+		p.breakers = newServerBreakers(spec.CircuitBreaker, tagPrefix)
+	}
+	if spec.ConcurrencyLimit != nil {
+		p.concurrency = newConcurrencyLimit(spec.ConcurrencyLimit)
+	}
+	if spec.ServerStats != nil {
+		p.serverStats = newServerStats(spec.ServerStats)
+	}
+	if len(spec.TrafficGroups) > 0 {
+		p.groups = newTrafficGroups(spec.TrafficGroups)
+	}
+
+	return p
 }
 
 func (p *pool) status() *PoolStatus {
 	s := &PoolStatus{Stat: p.httpStat.Status()}
+	if p.health != nil {
+		s.Health = p.health.status()
+	}
+	if p.memoryCache != nil {
+		s.MemoryCache = p.memoryCache.Status()
+	}
+	if p.healthCheck != nil {
+		s.DownServers = p.servers.downServers()
+	}
+	if p.outlier != nil {
+		s.EjectedServers = p.servers.ejectedServers()
+		s.ServerErrorRates = p.outlier.errorRates()
+		s.Ejections = atomic.LoadUint64(&p.outlier.ejections)
+	}
+	if p.retry != nil {
+		s.Retries = atomic.LoadUint64(&p.retry.retries)
+	}
+	if p.breakers != nil {
+		s.CircuitBreakers = p.breakers.states()
+	}
+	if p.groups != nil {
+		s.TrafficGroups = p.groups.status()
+	}
+	if p.hedging != nil {
+		s.Hedging = p.hedging.status()
+	}
+	if p.concurrency != nil {
+		s.ConcurrencyLimit = p.concurrency.status()
+	}
+	if p.serverStats != nil {
+		s.Servers = p.serverStats.status()
+	}
+	for _, server := range p.servers.snapshot().servers {
+		if s.Transport == nil {
+			s.Transport = make(map[string]*TransportStatus)
+		}
+		s.Transport[server.URL] = transportStatsOf(server.URL).status()
+	}
 	return s
 }
 
 func (p *pool) handle(ctx context.HTTPContext, reqBody io.Reader) string {
-	addTag := func(subPrefix, msg string) {
-		tag := stringtool.Cat(p.tagPrefix, "#", subPrefix, ": ", msg)
+	setKV := func(subKey string, value interface{}) {
+		key := stringtool.Cat(p.tagPrefix, "#", subKey)
 		ctx.Lock()
-		ctx.AddTag(tag)
+		ctx.SetKV(key, value)
 		ctx.Unlock()
 	}
 
@@ -142,52 +318,255 @@ func (p *pool) handle(ctx context.HTTPContext, reqBody io.Reader) string {
 		ctx.Unlock()
 	}
 
-	server, err := p.servers.next(ctx)
-	if err != nil {
-		addTag("serverErr", err.Error())
-		setStatusCode(http.StatusServiceUnavailable)
-		return resultInternalError
+	retry := p.retry
+	if retry != nil && !retry.retriable(ctx.Request().Method()) {
+		retry = nil
 	}
-	addTag("addr", server.URL)
 
-	req, err := p.prepareRequest(ctx, server, reqBody)
-	if err != nil {
-		msg := stringtool.Cat("prepare request failed: ", err.Error())
-		logger.Errorf("BUG: %s", msg)
-		addTag("bug", msg)
-		setStatusCode(http.StatusInternalServerError)
-		return resultInternalError
+	// NOTE: The gRPC calls are always streamed, since the streams of
+	// both directions are sent at the same time.
+	buffering := p.requestBody.buffering()
+	if isGRPCRequest(ctx) {
+		buffering = BodyBufferingStream
+	}
+	hedging := p.hedging
+	if hedging != nil && !hedging.hedgeable(ctx) {
+		hedging = nil
 	}
 
-	resp, span, err := p.doRequest(ctx, req)
-	if err != nil {
-		// NOTE: May add option to cancel the tracing if failed here.
-		// ctx.Span().Cancel()
-
-		addTag("doRequestErr", fmt.Sprintf("%v", err))
-		addTag("trace", req.detail())
-		if ctx.ClientDisconnected() {
-			// NOTE: The HTTPContext will set 499 by itself if client is Disconnected.
-			// w.SetStatusCode((499)
+	if buffering == BodyBufferingStream && reqBody != nil && ctx.Request().Std().ContentLength != 0 {
+		retry, hedging = nil, nil
+	}
+	// NOTE: The requests sent at the same time can't share the empty body.
+	if hedging != nil && ctx.Request().Std().ContentLength == 0 {
+		reqBody = http.NoBody
+	}
+
+	// NOTE: The body must be buffered to be sent again in retries and hedging.
+	var body *bodyBuffer
+	if reqBody != nil && reqBody != http.NoBody && (buffering == BodyBufferingBuffer ||
+		buffering == BodyBufferingAuto && (retry != nil || hedging != nil)) {
+		var err error
+		body, err = newBodyBuffer(reqBody, p.requestBody.maxMemoryBytes())
+		if err == errBodyTooLarge {
+			setKV("readBodyErr", err.Error())
+			setStatusCode(http.StatusRequestEntityTooLarge)
+			return resultClientError
+		}
+		if err != nil {
+			setKV("readBodyErr", err.Error())
+			setStatusCode(http.StatusBadRequest)
 			return resultClientError
 		}
+		ctx.Lock()
+		ctx.OnFinish(body.close)
+		ctx.Unlock()
+	}
 
-		setStatusCode(http.StatusServiceUnavailable)
-		return resultServerError
+	var deadline time.Time
+	if p.requestTimeout > 0 {
+		deadline = time.Now().Add(p.requestTimeout)
+	}
+	expired := func() bool {
+		return !deadline.IsZero() && !time.Now().Before(deadline)
 	}
 
-	addTag("code", strconv.Itoa(resp.StatusCode))
+	group := -1
+	if p.groups != nil {
+		group = p.groups.pick(ctx)
+		setKV("trafficGroup", p.groups.name(group))
+	}
+
+	var (
+		req    *request
+		resp   *http.Response
+		span   tracing.Span
+		cancel stdcontext.CancelFunc
+		tried  map[*Server]bool
+		server *Server
+	)
+	for attempt := 1; ; attempt++ {
+		// NOTE: The server is released on failures here, or at the finish
+		// of the context after the response is sent.
+		var err error
+		server, err = p.nextServer(ctx, group, tried, deadline)
+		if err != nil {
+			setKV("serverErr", err.Error())
+			if ctx.ClientDisconnected() {
+				return resultClientError
+			}
+			setStatusCode(http.StatusServiceUnavailable)
+			if err == errServerBusy || err == errQueueTimeout {
+				return resultServerBusy
+			}
+			return resultInternalError
+		}
+		setKV("addr", server.URL)
+		ctx.Lock()
+		ctx.SetKV(context.KeyBackend, server.URL)
+		ctx.Unlock()
+		if retry != nil {
+			if tried == nil {
+				tried = make(map[*Server]bool)
+			}
+			tried[server] = true
+		}
+
+		var permit *breakerPermit
+		if p.breakers != nil {
+			var permitted bool
+			permit, permitted = p.breakers.acquire(server.URL)
+			if !permitted {
+				p.release(server)
+				setKV("shortCircuited", server.URL)
+				if retry != nil && retry.retryOnError(attempt) {
+					continue
+				}
+				setStatusCode(p.breakers.fallbackStatusCode())
+				return resultShortCircuited
+			}
+		}
+
+		if p.keepAlive != nil {
+			p.keepAlive.touch(server.URL)
+		}
+
+		if body != nil {
+			reqBody = body.reader()
+		}
+
+		req, err = p.prepareRequest(ctx, server, reqBody)
+		if err != nil {
+			p.release(server)
+			msg := stringtool.Cat("prepare request failed: ", err.Error())
+			ctx.Logger().Errorf("BUG: %s", msg)
+			setKV("bug", msg)
+			setStatusCode(http.StatusInternalServerError)
+			return resultInternalError
+		}
+		req.attempt = attempt
+
+		cancel = func() {}
+		tryDeadline := deadline
+		if retry != nil && retry.perTryTimeout > 0 {
+			d := time.Now().Add(retry.perTryTimeout)
+			if tryDeadline.IsZero() || d.Before(tryDeadline) {
+				tryDeadline = d
+			}
+		}
+		if !tryDeadline.IsZero() {
+			var tryCtx stdcontext.Context
+			tryCtx, cancel = stdcontext.WithDeadline(req.std.Context(), tryDeadline)
+			req.std = req.std.WithContext(tryCtx)
+		}
+
+		if hedging != nil && attempt == 1 {
+			hedgedBody := reqBody
+			if body != nil {
+				hedgedBody = body.reader()
+			}
+			t := p.doHedgedRequest(ctx, group, tried, hedgedBody, tryDeadline,
+				&hedgedTry{server: server, permit: permit, req: req, cancel: cancel})
+			server, permit, req, cancel = t.server, t.permit, t.req, t.cancel
+			resp, span, err = t.resp, t.span, t.err
+		} else {
+			resp, span, err = p.doRequest(ctx, req)
+		}
+		if err != nil {
+			cancel()
+			p.release(server)
+
+			// NOTE: May add option to cancel the tracing if failed here.
+			// ctx.Span().Cancel()
+
+			setKV("doRequestErr", err.Error())
+			setKV("trace", req.detail())
+			if ctx.ClientDisconnected() {
+				// NOTE: The HTTPContext will set 499 by itself if client is Disconnected.
+				// w.SetStatusCode((499)
+				return resultClientError
+			}
+			if errors.Is(err, errBodyTooLarge) {
+				setStatusCode(http.StatusRequestEntityTooLarge)
+				return resultClientError
+			}
+
+			if p.outlier != nil {
+				p.outlier.count(server.URL, http.StatusServiceUnavailable)
+			}
+			if p.serverStats != nil {
+				p.serverStats.countError(server.URL, err, time.Since(req.startTime()))
+			}
+			permit.record(true, time.Since(req.startTime()))
+
+			if retry != nil && retry.retryOnError(attempt) && !expired() {
+				setKV("retry", attempt)
+				if !retry.wait(ctx, attempt) {
+					return resultClientError
+				}
+				continue
+			}
+
+			if e, ok := err.(net.Error); ok && e.Timeout() {
+				setStatusCode(http.StatusGatewayTimeout)
+			} else {
+				setStatusCode(http.StatusServiceUnavailable)
+			}
+			return resultServerError
+		}
+
+		setKV("code", resp.StatusCode)
+		if p.outlier != nil {
+			p.outlier.count(server.URL, resp.StatusCode)
+		}
+		if p.serverStats != nil {
+			p.serverStats.count(server.URL, resp.StatusCode, time.Since(req.startTime()))
+		}
+		if permit != nil {
+			permit.record(p.breakers.failure(resp.StatusCode), time.Since(req.startTime()))
+		}
+
+		if retry != nil && retry.retryOnStatus(attempt, resp.StatusCode) && !expired() {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			req.finish()
+			span.Finish()
+			cancel()
+			p.release(server)
+
+			setKV("retry", attempt)
+			if !retry.wait(ctx, attempt) {
+				return resultClientError
+			}
+			continue
+		}
+
+		break
+	}
+
+	if p.writeResponse && resp.StatusCode == http.StatusSwitchingProtocols {
+		if upstream, ok := resp.Body.(io.ReadWriteCloser); ok {
+			defer cancel()
+			return p.serveWebSocket(ctx, group, req, resp, upstream, span)
+		}
+	}
 
 	ctx.Lock()
 	defer ctx.Unlock()
-	// NOTE: The code below can't use addTag and setStatusCode in case of deadlock.
+	// NOTE: The code below can't use setKV and setStatusCode in case of deadlock.
 
-	respBody := p.statRequestResponse(ctx, req, resp, span)
+	// NOTE: The per-try timeout covers reading the response body too.
+	ctx.OnFinish(cancel)
+	respBody := p.statRequestResponse(ctx, group, req, resp, span)
 
 	if p.writeResponse {
+		callResponseGot(ctx, resp)
 		ctx.Response().SetStatusCode(resp.StatusCode)
 		ctx.Response().Header().AddFromStd(resp.Header)
-		ctx.Response().SetBody(respBody)
+		ctx.Response().SetBody(newStreamBody(ctx, resp, respBody))
+		if sticky := p.servers.spec().LoadBalance.StickySession; sticky != nil {
+			setStickyCookie(ctx, sticky, server)
+		}
 
 		return ""
 	}
@@ -217,18 +596,54 @@ func (p *pool) doRequest(ctx context.HTTPContext, req *request) (*http.Response,
 	}
 
 	span := ctx.Span().NewChildWithStart(spanName, req.startTime())
+	span.SetTag("attempt", req.attempt)
+	if req.hedged {
+		span.SetTag("hedged", true)
+	}
 	span.Tracer().Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.std.Header))
+	injectTraceParent(req.std.Header, span)
+	req.std = req.std.WithContext(withSpanEvents(req.std.Context(), span))
+
+	ctx.Lock()
+	baggage := ctx.Baggage().String()
+	ctx.Unlock()
+	if baggage != "" {
+		req.std.Header.Set(httpheader.KeyBaggage, baggage)
+	} else {
+		req.std.Header.Del(httpheader.KeyBaggage)
+	}
 
-	resp, err := fnSendRequest(req.std)
+	client := p.client
+	if req.server.http2Required() && p.h2Client != nil {
+		client = p.h2Client
+	}
+	if req.sni != "" && p.sniClients != nil {
+		client = p.sniClients.get(req.sni)
+	}
+	if req.server.ProxyProtocol != "" && p.ppClient != nil {
+		client = p.ppClient
+		reqCtx := withProxyProtocol(ctx, req.std.Context(), req.server.ProxyProtocol)
+		req.std = req.std.WithContext(reqCtx)
+	}
+	resp, err := fnSendRequest(req.std, client)
 	if err != nil {
+		span.SetTag("error", true)
+		span.LogKV("event", "error", "message", err.Error())
+		span.Finish()
 		return nil, nil, err
 	}
+	if p.upstreamCompression != nil {
+		p.upstreamCompression.prepareResponse(resp)
+	}
 	return resp, span, nil
 }
 
-func (p *pool) statRequestResponse(ctx context.HTTPContext,
+func (p *pool) statRequestResponse(ctx context.HTTPContext, group int,
 	req *request, resp *http.Response, span tracing.Span) io.Reader {
 
+	// NOTE: The code may be changed by the callbacks of OnResponseGot,
+	// but the statistics are of the servers.
+	code := resp.StatusCode
 	var count int
 
 	callbackBody := callbackreader.New(resp.Body)
@@ -243,15 +658,23 @@ func (p *pool) statRequestResponse(ctx context.HTTPContext,
 	})
 
 	ctx.OnFinish(func() {
+		p.release(req.server)
+
 		if !p.writeResponse {
 			req.finish()
 			span.Finish()
 		}
 
-		ctx.AddTag(stringtool.Cat(p.tagPrefix, fmt.Sprintf("#duration: %s", req.total())))
+		ctx.SetKV(stringtool.Cat(p.tagPrefix, "#duration"), req.total())
+		ctx.SetKV(context.KeyBackendDuration, req.total())
+		t := req.timing()
+		t.each(func(phase string, d time.Duration) {
+			ctx.SetKV(stringtool.Cat(p.tagPrefix, "#", phase), d)
+		})
+		p.serverStats.countTiming(req.server.URL, t)
 
 		metric := &httpstat.Metric{
-			StatusCode: resp.StatusCode,
+			StatusCode: code,
 			Duration:   req.total(),
 			ReqSize:    ctx.Request().Size(),
 			RespSize:   uint64(responseMetaSize(resp) + count),
@@ -260,6 +683,9 @@ func (p *pool) statRequestResponse(ctx context.HTTPContext,
 			metric.RespSize = 0
 		}
 		p.httpStat.Stat(metric)
+		if group >= 0 {
+			p.groups.count(group, code)
+		}
 	})
 
 	return callbackBody
@@ -284,4 +710,13 @@ func responseMetaSize(resp *http.Response) int {
 
 func (p *pool) close() {
 	p.servers.close()
+	if p.keepAlive != nil {
+		p.keepAlive.close()
+	}
+	if p.healthCheck != nil {
+		p.healthCheck.close()
+	}
+	if p.outlier != nil {
+		p.outlier.close()
+	}
 }
@@ -27,7 +27,10 @@ import (
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/capability"
+	"github.com/megaease/easegress/pkg/util/egress"
 	"github.com/megaease/easegress/pkg/util/fallback"
+	"github.com/megaease/easegress/pkg/util/gatewaychain"
 )
 
 const (
@@ -38,6 +41,10 @@ const (
 	resultInternalError = "internalError"
 	resultClientError   = "clientError"
 	resultServerError   = "serverError"
+	// resultShortCircuited is for the requests rejected by the circuit breakers of servers.
+	resultShortCircuited = "shortCircuited"
+	// resultServerBusy is for the requests rejected by the concurrency limit of servers.
+	resultServerBusy = "serverBusy"
 )
 
 var results = []string{
@@ -45,10 +52,17 @@ var results = []string{
 	resultInternalError,
 	resultClientError,
 	resultServerError,
+	resultShortCircuited,
+	resultServerBusy,
 }
 
 func init() {
 	httppipeline.Register(&Proxy{})
+
+	for _, policy := range []string{PolicyRoundRobin, PolicyRandom, PolicyWeightedRandom,
+		PolicyWeightedRoundRobin, PolicyLeastConnections, PolicyIPHash, PolicyHeaderHash} {
+		capability.Register(capability.LoadBalance, policy)
+	}
 }
 
 // All Proxy instances use one globalClient in order to reuse
@@ -58,14 +72,14 @@ var globalClient = &http.Client{
 	Timeout: 0,
 	Transport: &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
+		DialContext: trackConns(egress.Dialer((&net.Dialer{
+			Timeout:   defaultDialTimeout,
 			KeepAlive: 60 * time.Second,
 			DualStack: true,
-		}).DialContext,
+		}).DialContext)),
 		TLSClientConfig: &tls.Config{
-			// NOTE: Could make it an paramenter,
-			// when the requests need cross WAN.
+			// NOTE: Servers are not verified for compatibility,
+			// the Proxy with TLSSpec verifies them by default.
 			InsecureSkipVerify: true,
 		},
 		DisableCompression: false,
@@ -82,8 +96,8 @@ var globalClient = &http.Client{
 	},
 }
 
-var fnSendRequest = func(r *http.Request) (*http.Response, error) {
-	return globalClient.Do(r)
+var fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+	return client.Do(r)
 }
 
 type (
@@ -97,8 +111,19 @@ type (
 		mainPool       *pool
 		candidatePools []*pool
 		mirrorPool     *pool
+		mirrorSampler  *mirrorSampler
+		failoverPools  []*pool
+		failover       *failover
 
 		compression *compression
+		webSocket   *webSocket
+
+		client   *http.Client
+		h2Client *http.Client
+		ppClient *http.Client
+		tlsStats *tlsStats
+
+		sniClients *sniClients
 	}
 
 	// Spec describes the Proxy.
@@ -107,8 +132,35 @@ type (
 		MainPool       *PoolSpec        `yaml:"mainPool" jsonschema:"required"`
 		CandidatePools []*PoolSpec      `yaml:"candidatePools,omitempty" jsonschema:"omitempty"`
 		MirrorPool     *PoolSpec        `yaml:"mirrorPool,omitempty" jsonschema:"omitempty"`
+		Failover       *FailoverSpec    `yaml:"failover,omitempty" jsonschema:"omitempty"`
 		FailureCodes   []int            `yaml:"failureCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
 		Compression    *CompressionSpec `yaml:"compression,omitempty" jsonschema:"omitempty"`
+		// UpstreamCompression controls the compression between the proxy
+		// and the servers.
+		UpstreamCompression *UpstreamCompressionSpec `yaml:"upstreamCompression,omitempty" jsonschema:"omitempty"`
+
+		// MirrorSampling limits the requests shadowed to the mirror
+		// pool by percentage and rate.
+		MirrorSampling *MirrorSamplingSpec `yaml:"mirrorSampling,omitempty" jsonschema:"omitempty"`
+		// RequestBody limits the size of the request body and controls
+		// whether it's buffered before forwarding.
+		RequestBody *RequestBodySpec `yaml:"requestBody,omitempty" jsonschema:"omitempty"`
+		// WebSocket limits the WebSocket connections tunneled to the
+		// servers.
+		WebSocket *WebSocketSpec `yaml:"webSocket,omitempty" jsonschema:"omitempty"`
+		// ForwardedHeaders controls the X-Forwarded-* and Forwarded
+		// headers to the servers, they're forwarded untouched if nil.
+		ForwardedHeaders *ForwardedHeadersSpec `yaml:"forwardedHeaders,omitempty" jsonschema:"omitempty"`
+
+		// HostAliases maps hostnames to IPs for dialing servers, it
+		// bypasses system DNS for split-horizon or staging setups.
+		HostAliases map[string]string `yaml:"hostAliases,omitempty" jsonschema:"omitempty"`
+		// GatewayChain signs the claims about the requests for the
+		// downstream Easegress tiers.
+		GatewayChain *gatewaychain.Spec `yaml:"gatewayChain,omitempty" jsonschema:"omitempty"`
+		Timeout      *TimeoutSpec       `yaml:"timeout,omitempty" jsonschema:"omitempty"`
+		TLS          *TLSSpec           `yaml:"tls,omitempty" jsonschema:"omitempty"`
+		Client       *ClientSpec        `yaml:"client,omitempty" jsonschema:"omitempty"`
 	}
 
 	// FallbackSpec describes the fallback policy.
@@ -122,6 +174,11 @@ type (
 		MainPool       *PoolStatus   `yaml:"mainPool"`
 		CandidatePools []*PoolStatus `yaml:"candidatePools,omitempty"`
 		MirrorPool     *PoolStatus   `yaml:"mirrorPool,omitempty"`
+		FailoverPools  []*PoolStatus `yaml:"failoverPools,omitempty"`
+		TLS            *TLSStatus    `yaml:"tls,omitempty"`
+
+		MirrorSampling *MirrorSamplingStatus `yaml:"mirrorSampling,omitempty"`
+		WebSocket      *WebSocketStatus      `yaml:"webSocket,omitempty"`
 	}
 )
 
@@ -151,6 +208,8 @@ func (s Spec) Validate() error {
 		if s.MirrorPool.MemoryCache != nil {
 			return fmt.Errorf("memoryCache must be empty in mirrorPool")
 		}
+	} else if s.MirrorSampling != nil {
+		return fmt.Errorf("mirrorSampling needs mirrorPool")
 	}
 
 	if len(s.FailureCodes) == 0 {
@@ -159,6 +218,18 @@ func (s Spec) Validate() error {
 		}
 	}
 
+	for host, ip := range s.HostAliases {
+		if host == "" {
+			return fmt.Errorf("empty hostname in hostAliases")
+		}
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid ip %s of host %s in hostAliases", ip, host)
+		}
+		if err := egress.Check(ip, 0); err != nil {
+			return fmt.Errorf("ip %s of host %s in hostAliases: %v", ip, host, err)
+		}
+	}
+
 	return nil
 }
 
@@ -186,10 +257,22 @@ func (b *Proxy) Results() []string {
 func (b *Proxy) Init(filterSpec *httppipeline.FilterSpec) {
 	b.filterSpec, b.spec = filterSpec, filterSpec.FilterSpec().(*Spec)
 	b.reload()
+	registerMetrics(b)
 }
 
-// Inherit inherits previous generation of Proxy.
+// Inherit inherits previous generation of Proxy. The previous generation
+// is updated in place and taken over if only the servers or the load
+// balance changed, so the connections and statistics are kept.
 func (b *Proxy) Inherit(filterSpec *httppipeline.FilterSpec, previousGeneration httppipeline.Filter) {
+	spec := filterSpec.FilterSpec().(*Spec)
+	if prev, ok := previousGeneration.(*Proxy); ok && prev.Update(spec) == nil {
+		unregisterMetrics(prev)
+		*b = *prev
+		b.filterSpec, b.spec = filterSpec, spec
+		registerMetrics(b)
+		return
+	}
+
 	previousGeneration.Close()
 	b.Init(filterSpec)
 }
@@ -197,8 +280,25 @@ func (b *Proxy) Inherit(filterSpec *httppipeline.FilterSpec, previousGeneration
 func (b *Proxy) reload() {
 	super := b.filterSpec.Super()
 
+	b.client = globalClient
+	if b.spec.dedicatedClient() {
+		b.client = newClient(b.spec)
+	}
+	if b.spec.TLS != nil {
+		b.tlsStats = newTLSStats(b.client.Transport.(*http.Transport).TLSClientConfig)
+	}
+	if b.spec.usesHTTP2() {
+		b.h2Client = newHTTP2Client(b.spec)
+	}
+	if b.spec.usesProxyProtocol() {
+		b.ppClient = newProxyProtocolClient(b.spec, b.client)
+	}
+	if b.spec.usesSNI() {
+		b.sniClients = newSNIClients(b.client)
+	}
+
 	b.mainPool = newPool(super, b.spec.MainPool, "proxy#main",
-		true /*writeResponse*/, b.spec.FailureCodes)
+		true /*writeResponse*/, b.spec.FailureCodes, b.client)
 
 	if b.spec.Fallback != nil {
 		b.fallback = fallback.New(&b.spec.Fallback.Spec)
@@ -207,15 +307,53 @@ func (b *Proxy) reload() {
 	if len(b.spec.CandidatePools) > 0 {
 		var candidatePools []*pool
 		for k := range b.spec.CandidatePools {
-			candidatePools = append(candidatePools,
-				newPool(super, b.spec.CandidatePools[k], fmt.Sprintf("proxy#candidate#%d", k),
-					true, b.spec.FailureCodes))
+			p := newPool(super, b.spec.CandidatePools[k], fmt.Sprintf("proxy#candidate#%d", k),
+				true, b.spec.FailureCodes, b.client)
+			p.canaryWeight = CanaryWeight(b.filterSpec.Pipeline(), b.filterSpec.Name(), k)
+			candidatePools = append(candidatePools, p)
 		}
 		b.candidatePools = candidatePools
 	}
 	if b.spec.MirrorPool != nil {
 		b.mirrorPool = newPool(super, b.spec.MirrorPool, "proxy#mirror",
-			false /*writeResponse*/, b.spec.FailureCodes)
+			false /*writeResponse*/, b.spec.FailureCodes, b.client)
+		if b.spec.MirrorSampling != nil {
+			b.mirrorSampler = newMirrorSampler(b.spec.MirrorSampling)
+		}
+	}
+
+	if b.spec.Failover != nil {
+		var failoverPools []*pool
+		for k := range b.spec.Failover.Pools {
+			failoverPools = append(failoverPools,
+				newPool(super, b.spec.Failover.Pools[k], fmt.Sprintf("proxy#failover#%d", k),
+					true, b.spec.FailureCodes, b.client))
+		}
+		b.failoverPools = failoverPools
+		b.failover = newFailover(b.spec.Failover, b.mainPool, failoverPools)
+	}
+
+	b.webSocket = newWebSocket(b.spec.WebSocket)
+	var fh *forwardedHeaders
+	if b.spec.ForwardedHeaders != nil {
+		fh = newForwardedHeaders(b.spec.ForwardedHeaders)
+	}
+
+	timeout := b.spec.Timeout.requestTimeout()
+	var chain *gatewaychain.Chain
+	if b.spec.GatewayChain != nil {
+		chain = gatewaychain.New(b.spec.GatewayChain)
+	}
+	for _, p := range b.pools() {
+		p.requestTimeout = timeout
+		p.chain = chain
+		p.requestBody = b.spec.RequestBody
+		p.h2Client = b.h2Client
+		p.ppClient = b.ppClient
+		p.sniClients = b.sniClients
+		p.webSocket = b.webSocket
+		p.forwardedHeaders = fh
+		p.upstreamCompression = b.spec.UpstreamCompression
 	}
 
 	if b.spec.Compression != nil {
@@ -223,6 +361,16 @@ func (b *Proxy) reload() {
 	}
 }
 
+// pools returns all pools of the proxy.
+func (b *Proxy) pools() []*pool {
+	pools := []*pool{b.mainPool}
+	pools = append(pools, b.candidatePools...)
+	if b.mirrorPool != nil {
+		pools = append(pools, b.mirrorPool)
+	}
+	return append(pools, b.failoverPools...)
+}
+
 // Status returns Proxy status.
 func (b *Proxy) Status() interface{} {
 	s := &Status{
@@ -236,11 +384,24 @@ func (b *Proxy) Status() interface{} {
 	if b.mirrorPool != nil {
 		s.MirrorPool = b.mirrorPool.status()
 	}
+	if b.mirrorSampler != nil {
+		s.MirrorSampling = b.mirrorSampler.status()
+	}
+	if b.spec.WebSocket != nil {
+		s.WebSocket = b.webSocket.status()
+	}
+	for _, p := range b.failoverPools {
+		s.FailoverPools = append(s.FailoverPools, p.status())
+	}
+	if b.tlsStats != nil {
+		s.TLS = b.tlsStats.status()
+	}
 	return s
 }
 
 // Close closes Proxy.
 func (b *Proxy) Close() {
+	unregisterMetrics(b)
 	b.mainPool.close()
 
 	if b.candidatePools != nil {
@@ -252,6 +413,20 @@ func (b *Proxy) Close() {
 	if b.mirrorPool != nil {
 		b.mirrorPool.close()
 	}
+
+	for _, p := range b.failoverPools {
+		p.close()
+	}
+
+	if b.client != globalClient {
+		b.client.CloseIdleConnections()
+	}
+	if b.h2Client != nil {
+		b.h2Client.CloseIdleConnections()
+	}
+	if b.sniClients != nil {
+		b.sniClients.close()
+	}
 }
 
 func (b *Proxy) fallbackForCodes(ctx context.HTTPContext) bool {
@@ -266,6 +441,25 @@ func (b *Proxy) fallbackForCodes(ctx context.HTTPContext) bool {
 	return false
 }
 
+// failed reports whether the pool failed to serve the request, the errors
+// caused by clients are not failures of the pool.
+func (b *Proxy) failed(ctx context.HTTPContext, result string) bool {
+	switch result {
+	case resultServerError, resultInternalError, resultShortCircuited, resultServerBusy:
+		return true
+	case resultClientError:
+		return false
+	}
+
+	code := ctx.Response().StatusCode()
+	for _, c := range b.spec.FailureCodes {
+		if code == c {
+			return true
+		}
+	}
+	return false
+}
+
 // Handle handles HTTPContext.
 func (b *Proxy) Handle(ctx context.HTTPContext) (result string) {
 	result = b.handle(ctx)
@@ -273,7 +467,29 @@ func (b *Proxy) Handle(ctx context.HTTPContext) (result string) {
 }
 
 func (b *Proxy) handle(ctx context.HTTPContext) (result string) {
-	if b.mirrorPool != nil && b.mirrorPool.filter.Filter(ctx) {
+	if rb := b.spec.RequestBody; rb != nil && rb.MaxBytes > 0 {
+		if ctx.Request().Std().ContentLength > rb.MaxBytes {
+			ctx.AddTag(fmt.Sprintf("proxy: request body exceeds %dB", rb.MaxBytes))
+			ctx.Response().SetStatusCode(http.StatusRequestEntityTooLarge)
+			return resultClientError
+		}
+		// NOTE: The chunked body is checked while it's being read.
+		ctx.Request().SetBody(newLimitedBody(ctx.Request().Body(), rb.MaxBytes))
+	}
+
+	// NOTE: The WebSocket connections are neither mirrored nor cached.
+	webSocket := isWebSocketRequest(ctx)
+	if webSocket {
+		if !b.webSocket.acquire() {
+			ctx.AddTag("proxy: too many websocket connections")
+			ctx.Response().SetStatusCode(http.StatusServiceUnavailable)
+			return resultServerError
+		}
+		defer b.webSocket.release()
+	}
+
+	if !webSocket && b.mirrorPool != nil && b.mirrorPool.filter.Filter(ctx) &&
+		(b.mirrorSampler == nil || b.mirrorSampler.sample()) {
 		master, slave := newMasterSlaveReader(ctx.Request().Body())
 		ctx.Request().SetBody(master)
 
@@ -290,7 +506,7 @@ func (b *Proxy) handle(ctx context.HTTPContext) (result string) {
 	var p *pool
 	if len(b.candidatePools) > 0 {
 		for k, v := range b.candidatePools {
-			if v.filter.Filter(ctx) {
+			if v.chosen(ctx) {
 				p = b.candidatePools[k]
 				break
 			}
@@ -299,17 +515,32 @@ func (b *Proxy) handle(ctx context.HTTPContext) (result string) {
 
 	if p == nil {
 		p = b.mainPool
+		if b.failover != nil {
+			p = b.failover.choose()
+		}
 	}
 
-	if p.memoryCache != nil && p.memoryCache.Load(ctx) {
+	if !webSocket && p.memoryCache != nil && p.memoryCache.Load(ctx) {
 		return ""
 	}
 
+	startTime := time.Now()
 	result = p.handle(ctx, ctx.Request().Body())
+	if p.health != nil {
+		p.health.record(b.failed(ctx, result))
+	}
+	if !webSocket && p.memoryCache != nil {
+		p.memoryCache.Observe(ctx, time.Since(startTime), b.failed(ctx, result))
+	}
 	if result != "" {
 		return result
 	}
 
+	// The connection has been tunneled to the server.
+	if ctx.Response().StatusCode() == http.StatusSwitchingProtocols {
+		return ""
+	}
+
 	if b.fallbackForCodes(ctx) {
 		return resultFallback
 	}
@@ -20,7 +20,9 @@ package proxy
 import (
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -122,7 +124,7 @@ failureCodes: [503, 504]
 		t.Error("fallback for 500 should be false")
 	}
 
-	fnSendRequest = func(r *http.Request) (*http.Response, error) {
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
 		return &http.Response{
 			Body: io.NopCloser(strings.NewReader("this is the body")),
 		}, nil
@@ -133,7 +135,7 @@ failureCodes: [503, 504]
 	}
 	ctx.Finish()
 
-	fnSendRequest = func(r *http.Request) (*http.Response, error) {
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
 		return nil, fmt.Errorf("mocked error")
 	}
 	result = proxy.Handle(ctx)
@@ -199,6 +201,38 @@ func TestSpecValidate(t *testing.T) {
 	if spec.Validate() != nil {
 		t.Error("validate should succeed")
 	}
+
+	spec.HostAliases = map[string]string{"api.example.com": "not-an-ip"}
+	if spec.Validate() == nil {
+		t.Error("validate should fail")
+	}
+
+	spec.HostAliases = map[string]string{"api.example.com": "127.0.0.1"}
+	if spec.Validate() != nil {
+		t.Error("validate should succeed")
+	}
+}
+
+func TestHostAliasesClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer server.Close()
+
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	client := newClient(&Spec{HostAliases: map[string]string{"api.example.com": "127.0.0.1"}})
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get("http://api.example.com:" + port + "/")
+	if err != nil {
+		t.Fatalf("request via host alias failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "api.example.com:"+port {
+		t.Errorf("host should be kept, but got %s", body)
+	}
 }
 
 func TestPoolSpecValidate(t *testing.T) {
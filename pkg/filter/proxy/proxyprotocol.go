@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"bytes"
+	stdcontext "context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+const (
+	// ProxyProtocolV1 is the human-readable PROXY protocol.
+	ProxyProtocolV1 = "v1"
+	// ProxyProtocolV2 is the binary PROXY protocol.
+	ProxyProtocolV2 = "v2"
+)
+
+// proxyProtocolSignature is the signature of the PROXY protocol v2.
+var proxyProtocolSignature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+type proxyProtocolKey struct{}
+
+// usesProxyProtocol reports whether any static server of the proxy
+// requires the PROXY protocol.
+func (s *Spec) usesProxyProtocol() bool {
+	for _, pool := range s.poolSpecs() {
+		for _, server := range pool.Servers {
+			if server.ProxyProtocol != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newProxyProtocolClient returns the client for the servers requiring
+// the PROXY protocol, which is the same as the client of the proxy but
+// sends the PROXY protocol header once connected. The connections are
+// not reused, since the header is only for the client of one request.
+func newProxyProtocolClient(spec *Spec, client *http.Client) *http.Client {
+	transport := client.Transport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = true
+	transport.ForceAttemptHTTP2 = false
+
+	dial := newDialContext(spec)
+	transport.DialContext = func(ctx stdcontext.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		header, _ := ctx.Value(proxyProtocolKey{}).([]byte)
+		if len(header) == 0 {
+			return conn, nil
+		}
+		if _, err = conn.Write(header); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+
+	return &http.Client{
+		Timeout:       client.Timeout,
+		Transport:     transport,
+		CheckRedirect: client.CheckRedirect,
+	}
+}
+
+// withProxyProtocol returns the context carrying the PROXY protocol
+// header of the connection of the client.
+func withProxyProtocol(ctx context.HTTPContext, reqCtx stdcontext.Context, version string) stdcontext.Context {
+	var src, dst *net.TCPAddr
+	if std := ctx.Request().Std(); std != nil {
+		src, _ = net.ResolveTCPAddr("tcp", std.RemoteAddr)
+		dst, _ = std.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr)
+	}
+
+	return stdcontext.WithValue(reqCtx, proxyProtocolKey{}, proxyProtocolHeader(version, src, dst))
+}
+
+// proxyProtocolHeader returns the PROXY protocol header, the addresses are
+// unknown if either of them is nil or they are of different families.
+func proxyProtocolHeader(version string, src, dst *net.TCPAddr) []byte {
+	known := src != nil && dst != nil && (src.IP.To4() == nil) == (dst.IP.To4() == nil)
+	ipv4 := known && src.IP.To4() != nil
+
+	if version == ProxyProtocolV1 {
+		if !known {
+			return []byte("PROXY UNKNOWN\r\n")
+		}
+		family := "TCP6"
+		if ipv4 {
+			family = "TCP4"
+		}
+		return []byte(fmt.Sprintf("PROXY %s %s %s %s %s\r\n", family,
+			src.IP, dst.IP, strconv.Itoa(src.Port), strconv.Itoa(dst.Port)))
+	}
+
+	buff := &bytes.Buffer{}
+	buff.Write(proxyProtocolSignature)
+	if !known {
+		// NOTE: The command LOCAL makes the receiver use the real
+		// addresses of the connection.
+		buff.Write([]byte{0x20, 0x00, 0x00, 0x00})
+		return buff.Bytes()
+	}
+
+	srcIP, dstIP := src.IP.To16(), dst.IP.To16()
+	family := byte(0x21)
+	if ipv4 {
+		srcIP, dstIP = src.IP.To4(), dst.IP.To4()
+		family = 0x11
+	}
+	buff.Write([]byte{0x21, family})
+	binary.Write(buff, binary.BigEndian, uint16(2*len(srcIP)+4))
+	buff.Write(srcIP)
+	buff.Write(dstIP)
+	binary.Write(buff, binary.BigEndian, uint16(src.Port))
+	binary.Write(buff, binary.BigEndian, uint16(dst.Port))
+	return buff.Bytes()
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	stdcontext "context"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestProxyProtocolHeader(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 56324}
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443}
+
+	header := string(proxyProtocolHeader(ProxyProtocolV1, src, dst))
+	if want := "PROXY TCP4 192.168.1.1 10.0.0.1 56324 443\r\n"; header != want {
+		t.Errorf("want %q, got %q", want, header)
+	}
+	header = string(proxyProtocolHeader(ProxyProtocolV1, src, nil))
+	if want := "PROXY UNKNOWN\r\n"; header != want {
+		t.Errorf("want %q, got %q", want, header)
+	}
+	src6 := &net.TCPAddr{IP: net.ParseIP("::1"), Port: 56324}
+	header = string(proxyProtocolHeader(ProxyProtocolV1, src6, &net.TCPAddr{IP: net.ParseIP("::1"), Port: 80}))
+	if want := "PROXY TCP6 ::1 ::1 56324 80\r\n"; header != want {
+		t.Errorf("want %q, got %q", want, header)
+	}
+
+	want := append([]byte{}, proxyProtocolSignature...)
+	want = append(want, 0x21, 0x11, 0x00, 0x0c,
+		192, 168, 1, 1, 10, 0, 0, 1, 0xdc, 0x04, 0x01, 0xbb)
+	if got := proxyProtocolHeader(ProxyProtocolV2, src, dst); !bytes.Equal(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	want = append(want[:len(proxyProtocolSignature)], 0x20, 0x00, 0x00, 0x00)
+	if got := proxyProtocolHeader(ProxyProtocolV2, src6, dst); !bytes.Equal(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestProxyProtocolClient(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer ln.Close()
+
+	headers := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		header, _ := r.ReadString('\n')
+		headers <- header
+		http.ReadRequest(r)
+		conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"))
+	}()
+
+	spec := &Spec{}
+	client := newProxyProtocolClient(spec, globalClient)
+	src := &net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 56324}
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 80}
+	ctx := stdcontext.WithValue(stdcontext.Background(), proxyProtocolKey{},
+		proxyProtocolHeader(ProxyProtocolV1, src, dst))
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+ln.Addr().String(), nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if header, want := <-headers, "PROXY TCP4 192.168.1.1 10.0.0.1 56324 80\r\n"; header != want {
+		t.Errorf("want %q, got %q", want, header)
+	}
+	if !client.Transport.(*http.Transport).DisableKeepAlives {
+		t.Errorf("the connections with PROXY protocol should not be reused")
+	}
+}
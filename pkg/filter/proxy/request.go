@@ -28,12 +28,20 @@ import (
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/gatewaychain"
+	"github.com/megaease/easegress/pkg/util/httpheader"
 )
 
 type (
 	request struct {
-		server     *Server
-		std        *http.Request
+		server *Server
+		std    *http.Request
+		// sni is the rendered TLS server name of the server.
+		sni string
+		// attempt is the number of the attempt, and hedged is true if
+		// the request is hedged, they're tagged on the span.
+		attempt    int
+		hedged     bool
 		statResult *httpstat.Result
 		createTime time.Time
 		_startTime *time.Time
@@ -43,6 +51,16 @@ type (
 	resultState struct {
 		buff *bytes.Buffer
 	}
+
+	// timing is the durations of the phases of a request, the phases
+	// skipped are zero, e.g. dns, connect and tls of reused connections.
+	timing struct {
+		dns       time.Duration
+		connect   time.Duration
+		tls       time.Duration
+		firstByte time.Duration
+		bodyRead  time.Duration
+	}
 )
 
 func (p *pool) newRequest(ctx context.HTTPContext, server *Server, reqBody io.Reader) (*request, error) {
@@ -60,6 +78,7 @@ func (p *pool) newRequest(ctx context.HTTPContext, server *Server, reqBody io.Re
 	}
 
 	newCtx := httpstat.WithHTTPStat(ctx, req.statResult)
+	newCtx = withTransportTrace(newCtx, transportStatsOf(server.URL))
 	stdr, err := http.NewRequestWithContext(newCtx, r.Method(), url, reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("BUG: new request failed: %v", err)
@@ -67,12 +86,69 @@ func (p *pool) newRequest(ctx context.HTTPContext, server *Server, reqBody io.Re
 
 	stdr.Header = r.Header().Std()
 	stdr.Host = r.Host()
+	if p.forwardedHeaders != nil {
+		stdr.Header = stdr.Header.Clone()
+		p.forwardedHeaders.prepareRequest(stdr.Header, r.Std())
+	}
+	if server.HostHeader != "" {
+		stdr.Host = renderServerOption(ctx, server.HostHeader)
+	}
+	if server.SNI != "" {
+		req.sni = renderServerOption(ctx, server.SNI)
+	}
+
+	// NOTE: Fetch the full response to fill the cache,
+	// the memory cache slices the range for the client.
+	if p.memoryCache != nil && p.memoryCache.CoalesceRange(ctx) {
+		stdr.Header = stdr.Header.Clone()
+		stdr.Header.Del(httpheader.KeyRange)
+	}
+
+	// NOTE: Revalidate the stale entry of the cache instead of fetching
+	// the full response again.
+	if p.memoryCache != nil {
+		if conditions := p.memoryCache.ConditionalHeader(ctx); conditions != nil {
+			stdr.Header = stdr.Header.Clone()
+			for key, values := range conditions {
+				stdr.Header[key] = values
+			}
+		}
+	}
+
+	if p.chain != nil {
+		stdr.Header = stdr.Header.Clone()
+		p.chain.Sign(stdr.Header, stdr.Method, stdr.URL.Path, chainClaims(ctx, p.chain), time.Now())
+	}
+
+	if uc := p.upstreamCompression; uc != nil {
+		stdr.Header = stdr.Header.Clone()
+		uc.prepareRequest(stdr, r.Std().ContentLength != 0)
+	}
 
 	req.std = stdr
 
 	return req, nil
 }
 
+// chainClaims returns the claims verified from the upstream tier, so
+// they're passed through the chain, or the claims of this tier.
+func chainClaims(ctx context.HTTPContext, chain *gatewaychain.Chain) *gatewaychain.Claims {
+	r := ctx.Request()
+
+	// NOTE: The signature covers the original method and path.
+	std := r.Std()
+	claims, err := chain.Verify(std.Header, std.Method, std.URL.Path, time.Now())
+	if err == nil {
+		return claims
+	}
+
+	claims = &gatewaychain.Claims{RealIP: r.RealIP()}
+	if header := chain.IdentityHeader(); header != "" {
+		claims.Identity = r.Header().Get(header)
+	}
+	return claims
+}
+
 func (r *request) start() {
 	if r._startTime != nil {
 		logger.Errorf("BUG: started already")
@@ -119,6 +195,42 @@ func (r *request) total() time.Duration {
 	return r.statResult.Total(*r._endTime)
 }
 
+// timing returns the durations of the phases, firstByte is from the
+// request written to the first byte of the response, and bodyRead is
+// from the first byte to the end of the request.
+func (r *request) timing() *timing {
+	sr := r.statResult
+	t := &timing{
+		dns:       sr.DNSLookup,
+		connect:   sr.TCPConnection,
+		tls:       sr.TLSHandshake,
+		firstByte: sr.ServerProcessing,
+	}
+	if sr.StartTransfer > 0 {
+		t.bodyRead = sr.ContentTransfer(r.endTime())
+	}
+	return t
+}
+
+// each calls fn with the names and the durations of the phases not
+// skipped.
+func (t *timing) each(fn func(phase string, d time.Duration)) {
+	for _, phase := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"dns", t.dns},
+		{"connect", t.connect},
+		{"tls", t.tls},
+		{"firstByte", t.firstByte},
+		{"bodyRead", t.bodyRead},
+	} {
+		if phase.d > 0 {
+			fn(phase.name, phase.d)
+		}
+	}
+}
+
 func (r *request) detail() string {
 	rs := &resultState{buff: bytes.NewBuffer(nil)}
 	r.statResult.Format(rs, 's')
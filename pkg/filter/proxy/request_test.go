@@ -19,12 +19,18 @@ package proxy
 
 import (
 	"bytes"
+	stdcontext "context"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
+	httpstat "github.com/tcnksm/go-httpstat"
+
 	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/util/gatewaychain"
 	"github.com/megaease/easegress/pkg/util/httpheader"
 )
 
@@ -93,3 +99,101 @@ func TestResultState(t *testing.T) {
 		t.Error("implementation changed, this case should be updated")
 	}
 }
+
+func TestRequestTiming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("body"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{}
+	defer client.CloseIdleConnections()
+	send := func() *timing {
+		req := &request{createTime: time.Now(), statResult: &httpstat.Result{}}
+		stdr, _ := http.NewRequestWithContext(httpstat.WithHTTPStat(stdcontext.Background(), req.statResult),
+			http.MethodGet, server.URL, nil)
+		req.start()
+		resp, err := client.Do(stdr)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+		req.finish()
+		return req.timing()
+	}
+
+	first := send()
+	if first.connect <= 0 || first.firstByte < 20*time.Millisecond || first.tls != 0 {
+		t.Errorf("unexpected timing of the new connection: %+v", first)
+	}
+	second := send()
+	if second.connect != 0 || second.firstByte < 20*time.Millisecond {
+		t.Errorf("unexpected timing of the reused connection: %+v", second)
+	}
+
+	ss := newServerStats(&ServerStatsSpec{})
+	ss.countTiming(server.URL, first)
+	ss.countTiming(server.URL, second)
+	phases := ss.status()[server.URL].Phases
+	if len(phases["connect"]) == 0 || len(phases["firstByte"]) == 0 || phases["tls"] != nil {
+		t.Errorf("unexpected phases: %v", phases)
+	}
+}
+
+func TestRequestGatewayChain(t *testing.T) {
+	chain := gatewaychain.New(&gatewaychain.Spec{
+		KeyID:          "k1",
+		Keys:           map[string]string{"k1": "secret"},
+		IdentityHeader: "X-User",
+	})
+
+	incoming, _ := http.NewRequest(http.MethodGet, "http://megaease.com/abc", nil)
+	incoming.Header.Set("X-User", "alice")
+
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedPath = func() string {
+		return "/abc"
+	}
+	ctx.MockedRequest.MockedMethod = func() string {
+		return http.MethodGet
+	}
+	ctx.MockedRequest.MockedRealIP = func() string {
+		return "5.6.7.8"
+	}
+	ctx.MockedRequest.MockedStd = func() *http.Request {
+		return incoming
+	}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(incoming.Header)
+	}
+
+	p := pool{chain: chain}
+	server := &Server{URL: "http://192.168.1.2"}
+
+	// the first tier signs its own claims
+	req, _ := p.newRequest(ctx, server, nil)
+	claims, err := chain.Verify(req.std.Header, http.MethodGet, "/abc", time.Now())
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if claims.RealIP != "5.6.7.8" || claims.Identity != "alice" {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+	if incoming.Header.Get(gatewaychain.HeaderSignature) != "" {
+		t.Error("header of the incoming request should not be changed")
+	}
+
+	// the next tiers pass the verified claims through
+	upstream := &gatewaychain.Claims{RealIP: "1.2.3.4", Identity: "bob"}
+	chain.Sign(incoming.Header, http.MethodGet, "/abc", upstream, time.Now())
+	req, _ = p.newRequest(ctx, server, nil)
+	claims, err = chain.Verify(req.std.Header, http.MethodGet, "/abc", time.Now())
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if *claims != *upstream {
+		t.Errorf("claims should be passed through, but got %+v", claims)
+	}
+}
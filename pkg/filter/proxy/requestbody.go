@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	// BodyBufferingAuto buffers the request body only for retries.
+	BodyBufferingAuto = "auto"
+	// BodyBufferingStream never buffers the request body, which is for
+	// the uploads, the requests with bodies are not retried.
+	BodyBufferingStream = "stream"
+	// BodyBufferingBuffer always buffers the whole request body before
+	// forwarding it, so the slow clients don't hold the servers.
+	BodyBufferingBuffer = "buffer"
+
+	defaultMaxMemoryBytes = 4 << 20
+)
+
+var errBodyTooLarge = errors.New("request body too large")
+
+type (
+	// RequestBodySpec describes the safeguards of the request body.
+	RequestBodySpec struct {
+		// MaxBytes is the max size of the request body, the larger ones
+		// are rejected with 413, it's unlimited if it's zero.
+		MaxBytes  int64  `yaml:"maxBytes,omitempty" jsonschema:"omitempty,minimum=0"`
+		Buffering string `yaml:"buffering,omitempty" jsonschema:"omitempty,enum=,enum=auto,enum=stream,enum=buffer"`
+		// MaxMemoryBytes is the max size of a buffered body kept in
+		// memory, the larger ones spill to a temporary file.
+		MaxMemoryBytes int64 `yaml:"maxMemoryBytes,omitempty" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// limitedBody fails the reading once the body exceeds the limit.
+	limitedBody struct {
+		r         io.Reader
+		remaining int64
+	}
+
+	// bodyBuffer is the buffered request body, which can be read again
+	// and again.
+	bodyBuffer struct {
+		data []byte
+		file *os.File
+		size int64
+	}
+)
+
+func (spec *RequestBodySpec) buffering() string {
+	if spec == nil || spec.Buffering == "" {
+		return BodyBufferingAuto
+	}
+	return spec.Buffering
+}
+
+func (spec *RequestBodySpec) maxMemoryBytes() int64 {
+	if spec == nil || spec.MaxMemoryBytes == 0 {
+		return defaultMaxMemoryBytes
+	}
+	return spec.MaxMemoryBytes
+}
+
+func newLimitedBody(r io.Reader, max int64) *limitedBody {
+	return &limitedBody{r: r, remaining: max}
+}
+
+func (lb *limitedBody) Read(p []byte) (int, error) {
+	if int64(len(p)) > lb.remaining+1 {
+		p = p[:lb.remaining+1]
+	}
+
+	n, err := lb.r.Read(p)
+	if int64(n) > lb.remaining {
+		n, lb.remaining = int(lb.remaining), 0
+		return n, errBodyTooLarge
+	}
+	lb.remaining -= int64(n)
+	return n, err
+}
+
+// newBodyBuffer reads the whole body, the body is kept in memory if it
+// isn't larger than maxMemory, otherwise it's written to a temporary file.
+func newBodyBuffer(r io.Reader, maxMemory int64) (*bodyBuffer, error) {
+	buff := bytes.NewBuffer(nil)
+	_, err := io.CopyN(buff, r, maxMemory+1)
+	if err == io.EOF {
+		return &bodyBuffer{data: buff.Bytes(), size: int64(buff.Len())}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := ioutil.TempFile("", "easegress-body-")
+	if err != nil {
+		return nil, err
+	}
+	bb := &bodyBuffer{file: f}
+	if bb.size, err = io.Copy(f, io.MultiReader(buff, r)); err != nil {
+		bb.close()
+		return nil, err
+	}
+	return bb, nil
+}
+
+func (bb *bodyBuffer) reader() io.Reader {
+	if bb.file == nil {
+		return bytes.NewReader(bb.data)
+	}
+	return io.NewSectionReader(bb.file, 0, bb.size)
+}
+
+func (bb *bodyBuffer) close() {
+	if bb.file != nil {
+		bb.file.Close()
+		os.Remove(bb.file.Name())
+	}
+}
@@ -0,0 +1,178 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/yamltool"
+)
+
+func TestLimitedBody(t *testing.T) {
+	data, err := io.ReadAll(newLimitedBody(strings.NewReader("0123456789"), 10))
+	if err != nil || string(data) != "0123456789" {
+		t.Errorf("unexpected result: %q, %v", data, err)
+	}
+
+	data, err = io.ReadAll(newLimitedBody(strings.NewReader("0123456789"), 9))
+	if err != errBodyTooLarge || string(data) != "012345678" {
+		t.Errorf("unexpected result: %q, %v", data, err)
+	}
+}
+
+func TestBodyBuffer(t *testing.T) {
+	bb, err := newBodyBuffer(strings.NewReader("0123456789"), 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bb.file != nil {
+		t.Error("body should be kept in memory")
+	}
+	for i := 0; i < 2; i++ {
+		if data, _ := io.ReadAll(bb.reader()); string(data) != "0123456789" {
+			t.Errorf("unexpected body: %q", data)
+		}
+	}
+	bb.close()
+
+	bb, err = newBodyBuffer(strings.NewReader("0123456789"), 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bb.file == nil {
+		t.Fatal("body should spill to a file")
+	}
+	for i := 0; i < 2; i++ {
+		if data, _ := io.ReadAll(bb.reader()); string(data) != "0123456789" {
+			t.Errorf("unexpected body: %q", data)
+		}
+	}
+	name := bb.file.Name()
+	bb.close()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("file should be removed: %v", err)
+	}
+
+	_, err = newBodyBuffer(newLimitedBody(strings.NewReader("0123456789"), 5), 4)
+	if err != errBodyTooLarge {
+		t.Errorf("want errBodyTooLarge, got %v", err)
+	}
+}
+
+func TestRequestBody(t *testing.T) {
+	const yamlSpec = `
+name: proxy
+kind: Proxy
+mainPool:
+  servers:
+  - url: http://127.0.0.1:9095
+  - url: http://127.0.0.2:9095
+  loadBalance:
+    policy: roundRobin
+  retry:
+    maxAttempts: 2
+    baseInterval: 1ms
+    maxInterval: 2ms
+requestBody:
+  maxBytes: 10
+  buffering: stream
+`
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, e := httppipeline.NewFilterSpec(rawSpec, nil)
+	if e != nil {
+		t.Fatalf("unexpected error: %v", e)
+	}
+
+	proxy := &Proxy{}
+	proxy.Init(spec)
+	defer proxy.Close()
+
+	attempts := 0
+	oldSendRequest := fnSendRequest
+	defer func() { fnSendRequest = oldSendRequest }()
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		attempts++
+		if _, err := io.ReadAll(r.Body); err != nil {
+			return nil, &url.Error{Op: r.Method, URL: r.URL.String(), Err: err}
+		}
+		return &http.Response{
+			StatusCode: http.StatusBadGateway,
+			Body:       io.NopCloser(strings.NewReader("bad gateway")),
+		}, nil
+	}
+
+	var body io.Reader
+	contentLength := int64(-1)
+	statusCode := 0
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedMethod = func() string {
+		return http.MethodPut
+	}
+	ctx.MockedRequest.MockedBody = func() io.Reader {
+		return body
+	}
+	ctx.MockedRequest.MockedSetBody = func(reader io.Reader) {
+		body = reader
+	}
+	ctx.MockedRequest.MockedStd = func() *http.Request {
+		return &http.Request{ContentLength: contentLength}
+	}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(http.Header{})
+	}
+	ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(http.Header{})
+	}
+	ctx.MockedResponse.MockedSetStatusCode = func(code int) {
+		statusCode = code
+	}
+
+	// the streamed body is not retried
+	body = strings.NewReader("payload")
+	proxy.handle(ctx)
+	if statusCode != http.StatusBadGateway || attempts != 1 {
+		t.Errorf("want 1 attempt with %d, got %d attempts with %d", http.StatusBadGateway, attempts, statusCode)
+	}
+
+	// the chunked body is checked while it's being read
+	attempts = 0
+	body = strings.NewReader("payload payload")
+	proxy.handle(ctx)
+	if statusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("want %d, got %d", http.StatusRequestEntityTooLarge, statusCode)
+	}
+
+	// the body with a large content length is rejected without forwarding
+	attempts = 0
+	contentLength = 15
+	body = strings.NewReader("payload payload")
+	proxy.handle(ctx)
+	if statusCode != http.StatusRequestEntityTooLarge || attempts != 0 {
+		t.Errorf("want %d without attempts, got %d with %d attempts", http.StatusRequestEntityTooLarge, statusCode, attempts)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"sync"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+type (
+	// ResponseGotFunc is called with the response got from the server
+	// before it's written to the client, it may change the status code
+	// and the header of the response. It's called with the context
+	// locked, so it must not lock the context.
+	ResponseGotFunc func(ctx context.HTTPContext, resp *http.Response)
+
+	responseGotCallback struct {
+		name     string
+		priority int
+		seq      uint64
+		fn       ResponseGotFunc
+	}
+)
+
+// responseGotRegistry holds the callbacks called by all proxies of this
+// member, they are sorted and replaced as a whole on changes.
+var responseGotRegistry = struct {
+	mutex     sync.Mutex
+	seq       uint64
+	callbacks []*responseGotCallback
+}{}
+
+// OnResponseGot registers the callback by the name, which replaces the
+// one of the same name. The callbacks are called in the ascending order
+// of the priorities, and in the order of registration for the same one.
+func OnResponseGot(name string, priority int, fn ResponseGotFunc) {
+	responseGotRegistry.mutex.Lock()
+	defer responseGotRegistry.mutex.Unlock()
+
+	responseGotRegistry.seq++
+	callbacks := withoutResponseGot(responseGotRegistry.callbacks, name)
+	callbacks = append(callbacks, &responseGotCallback{
+		name:     name,
+		priority: priority,
+		seq:      responseGotRegistry.seq,
+		fn:       fn,
+	})
+	sort.Slice(callbacks, func(i, j int) bool {
+		if callbacks[i].priority != callbacks[j].priority {
+			return callbacks[i].priority < callbacks[j].priority
+		}
+		return callbacks[i].seq < callbacks[j].seq
+	})
+	responseGotRegistry.callbacks = callbacks
+}
+
+// RemoveResponseGot unregisters the callback of the name, it returns
+// false if there is no such callback.
+func RemoveResponseGot(name string) bool {
+	responseGotRegistry.mutex.Lock()
+	defer responseGotRegistry.mutex.Unlock()
+
+	callbacks := withoutResponseGot(responseGotRegistry.callbacks, name)
+	if len(callbacks) == len(responseGotRegistry.callbacks) {
+		return false
+	}
+	responseGotRegistry.callbacks = callbacks
+	return true
+}
+
+// withoutResponseGot returns a copy of the callbacks without the name.
+func withoutResponseGot(callbacks []*responseGotCallback, name string) []*responseGotCallback {
+	result := make([]*responseGotCallback, 0, len(callbacks)+1)
+	for _, c := range callbacks {
+		if c.name != name {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// callResponseGot calls the callbacks with the response, the changes of
+// a panicking callback are discarded and the subsequent ones are still
+// called.
+func callResponseGot(ctx context.HTTPContext, resp *http.Response) {
+	responseGotRegistry.mutex.Lock()
+	callbacks := responseGotRegistry.callbacks
+	responseGotRegistry.mutex.Unlock()
+
+	for _, c := range callbacks {
+		c.call(ctx, resp)
+	}
+}
+
+func (c *responseGotCallback) call(ctx context.HTTPContext, resp *http.Response) {
+	code, header := resp.StatusCode, resp.Header.Clone()
+	defer func() {
+		if err := recover(); err != nil {
+			resp.StatusCode, resp.Header = code, header
+			ctx.AddTag(fmt.Sprintf("responseGot %s panicked: %v", c.name, err))
+			ctx.Logger().Errorf("responseGot callback %s panicked: %v, stack trace: \n%s\n",
+				c.name, err, debug.Stack())
+		}
+	}()
+
+	c.fn(ctx, resp)
+}
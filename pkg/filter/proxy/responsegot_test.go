@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/context/contexttest"
+)
+
+func TestResponseGot(t *testing.T) {
+	defer func() {
+		for _, name := range []string{"a", "b", "c", "panic"} {
+			RemoveResponseGot(name)
+		}
+	}()
+
+	var calls []string
+	record := func(name string) ResponseGotFunc {
+		return func(ctx context.HTTPContext, resp *http.Response) {
+			calls = append(calls, name)
+		}
+	}
+
+	OnResponseGot("a", 10, record("a"))
+	OnResponseGot("b", 10, record("b"))
+	OnResponseGot("c", -1, func(ctx context.HTTPContext, resp *http.Response) {
+		calls = append(calls, "c")
+		resp.StatusCode = http.StatusTeapot
+		resp.Header.Set("X-Rewritten", "true")
+	})
+	OnResponseGot("panic", 5, func(ctx context.HTTPContext, resp *http.Response) {
+		calls = append(calls, "panic")
+		resp.StatusCode = http.StatusInternalServerError
+		resp.Header.Set("X-Panicked", "true")
+		panic("boom")
+	})
+	// NOTE: Registering again replaces the callback and its position.
+	OnResponseGot("a", 10, record("a"))
+
+	var tags []string
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedAddTag = func(tag string) {
+		tags = append(tags, tag)
+	}
+
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+	callResponseGot(ctx, resp)
+
+	if got := strings.Join(calls, ","); got != "c,panic,b,a" {
+		t.Errorf("want the callbacks called by priority, got %s", got)
+	}
+	if resp.StatusCode != http.StatusTeapot || resp.Header.Get("X-Rewritten") != "true" {
+		t.Errorf("want the response rewritten, got %d %v", resp.StatusCode, resp.Header)
+	}
+	if resp.Header.Get("X-Panicked") != "" {
+		t.Errorf("want the changes of the panicking callback discarded")
+	}
+	if len(tags) != 1 || !strings.Contains(tags[0], "panic") {
+		t.Errorf("want the panic tagged, got %v", tags)
+	}
+
+	if !RemoveResponseGot("panic") || RemoveResponseGot("panic") {
+		t.Errorf("want the callback removed once")
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// RetryOnConnectFailure retries the requests failed without responses,
+	// e.g. connection refused, reset or timeout.
+	RetryOnConnectFailure = "connectFailure"
+	// RetryOn5xx retries the requests responded with 5xx.
+	RetryOn5xx = "5xx"
+
+	defaultRetryBaseInterval = 25 * time.Millisecond
+	defaultRetryMaxInterval  = 250 * time.Millisecond
+)
+
+// idempotentMethods are the idempotent methods defined by RFC 7231.
+var idempotentMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodOptions,
+	http.MethodTrace, http.MethodPut, http.MethodDelete,
+}
+
+type (
+	// RetrySpec describes the retry of the requests of a pool, every
+	// attempt chooses a different server if possible.
+	RetrySpec struct {
+		// MaxAttempts includes the first attempt.
+		MaxAttempts int      `yaml:"maxAttempts" jsonschema:"required,minimum=2"`
+		RetryOn     []string `yaml:"retryOn" jsonschema:"omitempty,uniqueItems=true,enum=connectFailure,enum=5xx"`
+		// NonIdempotent retries the requests of non-idempotent methods
+		// like POST, which are not retried by default.
+		NonIdempotent bool   `yaml:"nonIdempotent" jsonschema:"omitempty"`
+		PerTryTimeout string `yaml:"perTryTimeout" jsonschema:"omitempty,format=duration"`
+		// BaseInterval and MaxInterval are the intervals of exponential
+		// backoff with full jitter.
+		BaseInterval string `yaml:"baseInterval" jsonschema:"omitempty,format=duration"`
+		MaxInterval  string `yaml:"maxInterval" jsonschema:"omitempty,format=duration"`
+	}
+
+	retryPolicy struct {
+		maxAttempts    int
+		connectFailure bool
+		status5xx      bool
+		nonIdempotent  bool
+		perTryTimeout  time.Duration
+		baseInterval   time.Duration
+		maxInterval    time.Duration
+
+		// retries is the number of the retries.
+		retries uint64
+	}
+)
+
+func newRetryPolicy(spec *RetrySpec) *retryPolicy {
+	// NOTE: They have been validated by format=duration.
+	perTryTimeout, _ := time.ParseDuration(spec.PerTryTimeout)
+	baseInterval, _ := time.ParseDuration(spec.BaseInterval)
+	maxInterval, _ := time.ParseDuration(spec.MaxInterval)
+
+	rp := &retryPolicy{
+		maxAttempts:   spec.MaxAttempts,
+		nonIdempotent: spec.NonIdempotent,
+		perTryTimeout: perTryTimeout,
+		baseInterval:  baseInterval,
+		maxInterval:   maxInterval,
+	}
+
+	if len(spec.RetryOn) == 0 {
+		rp.connectFailure, rp.status5xx = true, true
+	}
+	for _, on := range spec.RetryOn {
+		switch on {
+		case RetryOnConnectFailure:
+			rp.connectFailure = true
+		case RetryOn5xx:
+			rp.status5xx = true
+		}
+	}
+
+	if rp.baseInterval <= 0 {
+		rp.baseInterval = defaultRetryBaseInterval
+	}
+	if rp.maxInterval <= 0 {
+		rp.maxInterval = defaultRetryMaxInterval
+	}
+	if rp.maxInterval < rp.baseInterval {
+		rp.maxInterval = rp.baseInterval
+	}
+
+	return rp
+}
+
+// retriable reports whether the requests of the method could be retried.
+func (rp *retryPolicy) retriable(method string) bool {
+	return rp.nonIdempotent || stringtool.StrInSlice(method, idempotentMethods)
+}
+
+// retryOnError reports whether to retry after the attempt failed without response.
+func (rp *retryPolicy) retryOnError(attempt int) bool {
+	return rp.connectFailure && attempt < rp.maxAttempts
+}
+
+// retryOnStatus reports whether to retry after the attempt responded with the code.
+func (rp *retryPolicy) retryOnStatus(attempt int, code int) bool {
+	return rp.status5xx && code >= 500 && attempt < rp.maxAttempts
+}
+
+// backoff returns the interval before the next attempt, it's random in
+// [0, min(maxInterval, baseInterval * 2^(attempt-1))].
+func (rp *retryPolicy) backoff(attempt int) time.Duration {
+	interval := rp.maxInterval
+	if shift := uint(attempt - 1); shift < 32 {
+		if d := rp.baseInterval << shift; d > 0 && d < interval {
+			interval = d
+		}
+	}
+	return time.Duration(rand.Int63n(int64(interval) + 1))
+}
+
+// wait counts the retry and waits for the backoff of the attempt, it
+// returns false if the context is done before.
+func (rp *retryPolicy) wait(ctx stdcontext.Context, attempt int) bool {
+	atomic.AddUint64(&rp.retries, 1)
+
+	timer := time.NewTimer(rp.backoff(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/yamltool"
+)
+
+func TestRetry(t *testing.T) {
+	const yamlSpec = `
+name: proxy
+kind: Proxy
+mainPool:
+  servers:
+  - url: http://127.0.0.1:9095
+  - url: http://127.0.0.2:9095
+  - url: http://127.0.0.3:9095
+  loadBalance:
+    policy: roundRobin
+  retry:
+    maxAttempts: 3
+    baseInterval: 1ms
+    maxInterval: 2ms
+`
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, e := httppipeline.NewFilterSpec(rawSpec, nil)
+	if e != nil {
+		t.Fatalf("unexpected error: %v", e)
+	}
+
+	proxy := &Proxy{}
+	proxy.Init(spec)
+	defer proxy.Close()
+
+	var hosts, bodies []string
+	oldSendRequest := fnSendRequest
+	defer func() { fnSendRequest = oldSendRequest }()
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		hosts = append(hosts, r.URL.Host)
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+
+		switch r.URL.Host {
+		case "127.0.0.1:9095":
+			return nil, fmt.Errorf("mocked error")
+		case "127.0.0.2:9095":
+			return &http.Response{
+				StatusCode: http.StatusBadGateway,
+				Body:       io.NopCloser(strings.NewReader("bad gateway")),
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("this is the body")),
+		}, nil
+	}
+
+	method := http.MethodPut
+	statusCode := 0
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedMethod = func() string {
+		return method
+	}
+	ctx.MockedRequest.MockedBody = func() io.Reader {
+		return strings.NewReader("payload")
+	}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(http.Header{})
+	}
+	ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(http.Header{})
+	}
+	ctx.MockedResponse.MockedSetStatusCode = func(code int) {
+		statusCode = code
+	}
+	kvs := map[string]interface{}{}
+	ctx.MockedSetKV = func(key string, value interface{}) {
+		kvs[key] = value
+	}
+
+	proxy.handle(ctx)
+	if statusCode != http.StatusOK {
+		t.Errorf("status code should be %d, but got %d", http.StatusOK, statusCode)
+	}
+	if backend := kvs[context.KeyBackend]; backend != "http://"+hosts[len(hosts)-1] {
+		t.Errorf("backend should be the last server tried, but got %v", backend)
+	}
+	if _, ok := kvs[proxy.mainPool.tagPrefix+"#retry"].(int); !ok {
+		t.Errorf("retry should be tagged as an int, but got %v", kvs)
+	}
+	if len(hosts) != 3 || hosts[0] == hosts[1] || hosts[1] == hosts[2] || hosts[0] == hosts[2] {
+		t.Errorf("every attempt should go to a different server, but got %v", hosts)
+	}
+	for _, body := range bodies {
+		if body != "payload" {
+			t.Errorf("every attempt should send the whole body, but got %q", body)
+		}
+	}
+
+	// non-idempotent requests are not retried
+	method = http.MethodPost
+	for i := 0; i < 3; i++ {
+		hosts = nil
+		proxy.handle(ctx)
+		if len(hosts) != 1 {
+			t.Fatalf("request %d should not be retried, but got %v", i, hosts)
+		}
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	rp := newRetryPolicy(&RetrySpec{
+		MaxAttempts:  3,
+		RetryOn:      []string{RetryOn5xx},
+		BaseInterval: "10ms",
+		MaxInterval:  "30ms",
+	})
+
+	if rp.retryOnError(1) {
+		t.Error("should not retry on connect failure")
+	}
+	if !rp.retryOnStatus(1, http.StatusServiceUnavailable) || rp.retryOnStatus(1, http.StatusNotFound) {
+		t.Error("should retry on 5xx only")
+	}
+	if rp.retryOnStatus(3, http.StatusServiceUnavailable) {
+		t.Error("should not retry after max attempts")
+	}
+	if !rp.retriable(http.MethodGet) || rp.retriable(http.MethodPost) {
+		t.Error("should retry idempotent methods only")
+	}
+
+	for attempt, max := range map[int]time.Duration{1: 10, 2: 20, 3: 30, 10: 30, 100: 30} {
+		for i := 0; i < 100; i++ {
+			if d := rp.backoff(attempt); d < 0 || d > max*time.Millisecond {
+				t.Fatalf("backoff of attempt %d should be in [0, %dms], but got %v", attempt, max, d)
+			}
+		}
+	}
+}
@@ -18,8 +18,12 @@
 package proxy
 
 import (
+	"crypto/md5"
+	"encoding/binary"
 	"fmt"
 	"math/rand"
+	"sort"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -30,6 +34,7 @@ import (
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/util/hashtool"
 	"github.com/megaease/easegress/pkg/util/stringtool"
+	"github.com/megaease/easegress/pkg/util/upstream"
 )
 
 const (
@@ -39,11 +44,23 @@ const (
 	PolicyRandom = "random"
 	// PolicyWeightedRandom is the policy of weighted random.
 	PolicyWeightedRandom = "weightedRandom"
+	// PolicyWeightedRoundRobin is the policy of smooth weighted round-robin.
+	PolicyWeightedRoundRobin = "weightedRoundRobin"
+	// PolicyLeastConnections is the policy of least in-flight requests.
+	PolicyLeastConnections = "leastConnections"
 	// PolicyIPHash is the policy of ip hash.
 	PolicyIPHash = "ipHash"
 	// PolicyHeaderHash is the policy of header hash.
 	PolicyHeaderHash = "headerHash"
 
+	// defaultVirtualNodes is the default number of virtual nodes per
+	// server in the hash ring, the same as ketama.
+	defaultVirtualNodes = 160
+
+	// slowStartScale scales the weights in slow start to ramp them up
+	// smoothly.
+	slowStartScale = 100
+
 	retryTimeout = 3 * time.Second
 )
 
@@ -55,8 +72,28 @@ type (
 		mutex           sync.Mutex
 		serviceRegistry *serviceregistry.ServiceRegistry
 		serviceWatcher  serviceregistry.ServiceWatcher
+		groupWatcher    *upstream.Watcher
 		static          *staticServers
 		done            chan struct{}
+		// updated wakes up the DNS watcher when the pool spec is updated.
+		updated chan struct{}
+
+		// down holds the URLs of the servers marked down by health check,
+		// ejected holds the ones ejected by outlier detection, draining
+		// holds the ones being drained by the admin, available is static
+		// without them.
+		down      map[string]bool
+		ejected   map[string]bool
+		draining  map[string]bool
+		available *staticServers
+		// groups are the available servers of the traffic groups.
+		groups []*staticServers
+		// backups are the up servers of lower priorities than the
+		// available ones, in the order of priority.
+		backups []*staticServers
+		// warming maps the URLs of the servers in slow start to the
+		// time they became available.
+		warming map[string]time.Time
 	}
 
 	staticServers struct {
@@ -64,19 +101,74 @@ type (
 		weightsSum int
 		servers    []*Server
 		lb         LoadBalance
+
+		// currentWeights are the current weights of servers for weighted
+		// round-robin, they are created at the first pick.
+		mutex          sync.Mutex
+		currentWeights []int
+
+		// ring is the consistent hash ring for ipHash and headerHash,
+		// it is created at the first pick.
+		ringOnce sync.Once
+		ring     *hashRing
+
+		// stickyServers maps the affinity cookies to the servers, it is
+		// created at the first request carrying the cookie.
+		stickyOnce    sync.Once
+		stickyServers map[string]*Server
+
+		// warming maps the URLs of the servers in slow start to the time
+		// they became available, all of them are warmed up at warmedUp.
+		slowStart time.Duration
+		warming   map[string]time.Time
+		warmedUp  time.Time
+	}
+
+	// hashRing is a ketama-style consistent hash ring, adding or removing
+	// a server only remaps about 1/N of keys.
+	hashRing struct {
+		points  []uint32
+		servers []*Server
 	}
 
 	// Server is proxy server.
 	Server struct {
-		URL    string   `yaml:"url" jsonschema:"required,format=url"`
+		// inflight is the number of in-flight requests of the server.
+		// NOTE: It must be the first field to be 64-bit aligned for atomic.
+		inflight int64
+
+		URL    string   `yaml:"url" jsonschema:"required,format=egress-url"`
 		Tags   []string `yaml:"tags" jsonschema:"omitempty,uniqueItems=true"`
 		Weight int      `yaml:"weight" jsonschema:"omitempty,minimum=0,maximum=100"`
+		// Protocol is the protocol to the server, it's ProtocolHTTP
+		// if empty.
+		Protocol string `yaml:"protocol,omitempty" jsonschema:"omitempty,enum=,enum=http,enum=h2c,enum=grpc"`
+		// Priority is the priority of the server, 0 is the highest. The
+		// servers of lower priorities are backups, which are used only if
+		// all the servers of higher priorities are not available.
+		Priority int `yaml:"priority,omitempty" jsonschema:"omitempty,minimum=0"`
+		// ProxyProtocol is the version of the PROXY protocol header sent
+		// to the server to pass the address of the client.
+		ProxyProtocol string `yaml:"proxyProtocol,omitempty" jsonschema:"omitempty,enum=,enum=v1,enum=v2"`
+		// HostHeader overrides the Host header sent to the server, and
+		// SNI overrides the TLS server name, both support templates.
+		HostHeader string `yaml:"hostHeader,omitempty" jsonschema:"omitempty"`
+		SNI        string `yaml:"sni,omitempty" jsonschema:"omitempty"`
 	}
 
 	// LoadBalance is load balance for multiple servers.
 	LoadBalance struct {
-		Policy        string `yaml:"policy" jsonschema:"required,enum=roundRobin,enum=random,enum=weightedRandom,enum=ipHash,enum=headerHash"`
+		Policy        string `yaml:"policy" jsonschema:"required,enum=roundRobin,enum=random,enum=weightedRandom,enum=weightedRoundRobin,enum=leastConnections,enum=ipHash,enum=headerHash"`
 		HeaderHashKey string `yaml:"headerHashKey" jsonschema:"omitempty"`
+		// VirtualNodes is the number of virtual nodes per server in the
+		// hash ring of ipHash and headerHash.
+		VirtualNodes int `yaml:"virtualNodes" jsonschema:"omitempty,minimum=0"`
+		// StickySession makes the requests of a client go to the same
+		// server, it takes precedence over the policy.
+		StickySession *StickySessionSpec `yaml:"stickySession,omitempty" jsonschema:"omitempty"`
+		// SlowStart is the window to ramp up the weights of the servers
+		// added or returning to available, from 0 to full linearly.
+		SlowStart string `yaml:"slowStart,omitempty" jsonschema:"omitempty,format=duration"`
 	}
 )
 
@@ -84,23 +176,65 @@ func (s *Server) String() string {
 	return fmt.Sprintf("%s,%v,%d", s.URL, s.Tags, s.Weight)
 }
 
+// acquire counts a request sent to the server.
+func (s *Server) acquire() {
+	atomic.AddInt64(&s.inflight, 1)
+}
+
+// release counts a request of the server finished.
+func (s *Server) release() {
+	atomic.AddInt64(&s.inflight, -1)
+}
+
+func (s *Server) inflightRequests() int64 {
+	return atomic.LoadInt64(&s.inflight)
+}
+
 // Validate validates LoadBalance.
 func (lb LoadBalance) Validate() error {
 	if lb.Policy == PolicyHeaderHash && len(lb.HeaderHashKey) == 0 {
 		return fmt.Errorf("headerHash needs to specify headerHashKey")
 	}
+	if lb.SlowStart != "" && !lb.supportsSlowStart() {
+		return fmt.Errorf("slowStart is not supported by %s", lb.Policy)
+	}
 
 	return nil
 }
 
+// supportsSlowStart reports whether the policy supports slow start, the
+// hash policies and least connections don't.
+func (lb LoadBalance) supportsSlowStart() bool {
+	switch lb.Policy {
+	case PolicyRoundRobin, PolicyRandom, PolicyWeightedRandom, PolicyWeightedRoundRobin:
+		return true
+	}
+	return false
+}
+
 func newServers(super *supervisor.Supervisor, poolSpec *PoolSpec) *servers {
 	s := &servers{
 		poolSpec: poolSpec,
 		super:    super,
 		done:     make(chan struct{}),
+		updated:  make(chan struct{}, 1),
 	}
 
 	s.useStaticServers()
+	watchDraining(s)
+
+	if poolSpec.DNS != nil {
+		go s.watchDNS(defaultDNSResolver)
+		return s
+	}
+
+	if poolSpec.ServerGroup != "" {
+		// NOTE: Watch before getting the group to not miss any change.
+		s.groupWatcher = upstream.NewWatcher(poolSpec.ServerGroup)
+		s.useGroup()
+		go s.watchGroup()
+		return s
+	}
 
 	if poolSpec.ServiceRegistry == "" || poolSpec.ServiceName == "" {
 		return s
@@ -133,11 +267,12 @@ func (s *servers) handleEvent(event *serviceregistry.ServiceEvent) {
 }
 
 func (s *servers) tryUseService() {
-	serviceInstanceSpecs, err := s.serviceRegistry.ListServiceInstances(s.poolSpec.ServiceRegistry, s.poolSpec.ServiceName)
+	poolSpec := s.spec()
+	serviceInstanceSpecs, err := s.serviceRegistry.ListServiceInstances(poolSpec.ServiceRegistry, poolSpec.ServiceName)
 
 	if err != nil {
 		logger.Warnf("first try to use service %s/%s failed(will try again): %v",
-			s.poolSpec.ServiceRegistry, s.poolSpec.ServiceName, err)
+			poolSpec.ServiceRegistry, poolSpec.ServiceName, err)
 		s.useStaticServers()
 		return
 	}
@@ -146,6 +281,7 @@ func (s *servers) tryUseService() {
 }
 
 func (s *servers) useService(serviceInstanceSpecs map[string]*serviceregistry.ServiceInstanceSpec) {
+	poolSpec := s.spec()
 	var servers []*Server
 	for _, instance := range serviceInstanceSpecs {
 		servers = append(servers, &Server{
@@ -156,29 +292,289 @@ func (s *servers) useService(serviceInstanceSpecs map[string]*serviceregistry.Se
 	}
 	if len(servers) == 0 {
 		logger.Warnf("%s/%s: empty service instance",
-			s.poolSpec.ServiceRegistry, s.poolSpec.ServiceName)
+			poolSpec.ServiceRegistry, poolSpec.ServiceName)
 		s.useStaticServers()
 		return
 	}
 
-	dynamicServers := newStaticServers(servers, s.poolSpec.ServersTags, s.poolSpec.LoadBalance)
+	dynamicServers := newStaticServers(servers, poolSpec.ServersTags, poolSpec.LoadBalance)
 	if dynamicServers.len() == 0 {
 		logger.Warnf("%s/%s: no service instance satisfy tags: %v",
-			s.poolSpec.ServiceRegistry, s.poolSpec.ServiceName, s.poolSpec.ServersTags)
+			poolSpec.ServiceRegistry, poolSpec.ServiceName, poolSpec.ServersTags)
 		s.useStaticServers()
 	}
 
-	logger.Infof("use dynamic service: %s/%s", s.poolSpec.ServiceRegistry, s.poolSpec.ServiceName)
+	logger.Infof("use dynamic service: %s/%s", poolSpec.ServiceRegistry, poolSpec.ServiceName)
 
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	s.static = dynamicServers
+	s.updateAvailable()
+}
+
+func (s *servers) watchGroup() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.groupWatcher.Watch():
+			s.useGroup()
+		}
+	}
+}
+
+// useGroup uses the servers of the ServerGroup, it falls back to the
+// static servers if the group doesn't exist or none of its servers
+// satisfies the tags.
+func (s *servers) useGroup() {
+	poolSpec := s.spec()
+	group, exists := upstream.Get(poolSpec.ServerGroup)
+	if !exists {
+		logger.Warnf("server group %s not found", poolSpec.ServerGroup)
+		s.useStaticServers()
+		return
+	}
+
+	servers := make([]*Server, 0, len(group))
+	for _, server := range group {
+		servers = append(servers, &Server{
+			URL:      server.URL,
+			Tags:     server.Tags,
+			Weight:   server.Weight,
+			Priority: server.Priority,
+		})
+	}
+
+	groupServers := newStaticServers(servers, poolSpec.ServersTags, poolSpec.LoadBalance)
+	if groupServers.len() == 0 {
+		logger.Warnf("server group %s: no server satisfy tags: %v",
+			poolSpec.ServerGroup, poolSpec.ServersTags)
+		s.useStaticServers()
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.static = groupServers
+	s.updateAvailable()
+}
+
+// spec returns the pool spec, which may be replaced by update.
+func (s *servers) spec() *PoolSpec {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.poolSpec
 }
 
 func (s *servers) useStaticServers() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	s.static = newStaticServers(s.poolSpec.Servers, s.poolSpec.ServersTags, s.poolSpec.LoadBalance)
+	s.updateAvailable()
+}
+
+// setDown sets the servers marked down by health check.
+func (s *servers) setDown(down map[string]bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if sameURLs(down, s.down) {
+		return
+	}
+
+	s.down = down
+	s.updateAvailable()
+}
+
+// setEjected sets the servers ejected by outlier detection.
+func (s *servers) setEjected(ejected map[string]bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if sameURLs(ejected, s.ejected) {
+		return
+	}
+
+	s.ejected = ejected
+	s.updateAvailable()
+}
+
+func sameURLs(a, b map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for url := range a {
+		if !b[url] {
+			return false
+		}
+	}
+	return true
+}
+
+// setDraining sets the servers being drained.
+func (s *servers) setDraining(draining map[string]bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if sameURLs(draining, s.draining) {
+		return
+	}
+
+	s.draining = draining
+	s.updateAvailable()
+}
+
+// downServers returns the URLs of the servers marked down in order.
+func (s *servers) downServers() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return sortedURLs(s.down)
+}
+
+// ejectedServers returns the URLs of the servers ejected in order.
+func (s *servers) ejectedServers() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return sortedURLs(s.ejected)
+}
+
+func sortedURLs(m map[string]bool) []string {
+	urls := make([]string, 0, len(m))
+	for url := range m {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	return urls
+}
+
+// updateAvailable updates the available servers and the ones of the
+// traffic groups, it must be called with the lock.
+func (s *servers) updateAvailable() {
+	prev := s.available
+	s.available = s.upServers()
+
+	slowStart := s.slowStart()
+	if slowStart > 0 {
+		s.updateWarming(prev, slowStart)
+	}
+	if len(s.warming) > 0 {
+		// NOTE: The static servers may be shared, so copy them.
+		lb := s.available.lb
+		s.available = newStaticServers(s.available.servers, nil, &lb)
+		s.available.warmUp(s.warming, slowStart)
+	}
+
+	if s.poolSpec == nil || len(s.poolSpec.TrafficGroups) == 0 {
+		return
+	}
+
+	lb := s.available.lb
+	s.groups = make([]*staticServers, len(s.poolSpec.TrafficGroups))
+	for i, group := range s.poolSpec.TrafficGroups {
+		s.groups[i] = newStaticServers(s.available.servers, group.ServersTags, &lb)
+		s.groups[i].warmUp(s.warming, slowStart)
+	}
+}
+
+func (s *servers) slowStart() time.Duration {
+	if s.poolSpec == nil || s.poolSpec.LoadBalance == nil {
+		return 0
+	}
+	// NOTE: It has been validated by format=duration.
+	d, _ := time.ParseDuration(s.poolSpec.LoadBalance.SlowStart)
+	return d
+}
+
+// updateWarming starts the slow start of the servers which are not in
+// the previous available servers, the ones at the creation of the pool
+// are not warmed up. It must be called with the lock.
+func (s *servers) updateWarming(prev *staticServers, slowStart time.Duration) {
+	now := time.Now()
+	warming := make(map[string]time.Time)
+	for url, since := range s.warming {
+		if now.Sub(since) < slowStart {
+			warming[url] = since
+		}
+	}
+
+	if prev != nil {
+		prevURLs := make(map[string]bool, len(prev.servers))
+		for _, server := range prev.servers {
+			prevURLs[server.URL] = true
+		}
+		for _, server := range s.available.servers {
+			if !prevURLs[server.URL] {
+				warming[server.URL] = now
+			}
+		}
+	}
+
+	s.warming = warming
+}
+
+// upServers returns the servers of the highest priority which are not
+// down, ejected or draining, all servers are considered up if all of them
+// are excluded. The up servers of lower priorities are set to backups.
+func (s *servers) upServers() *staticServers {
+	s.backups = nil
+
+	up := s.static.servers
+	if len(s.down) > 0 || len(s.ejected) > 0 || len(s.draining) > 0 {
+		up = make([]*Server, 0, len(s.static.servers))
+		for _, server := range s.static.servers {
+			if !s.down[server.URL] && !s.ejected[server.URL] && !s.draining[server.URL] {
+				up = append(up, server)
+			}
+		}
+		if len(up) == 0 {
+			up = s.static.servers
+		}
+	}
+
+	levels := priorityLevels(up)
+	if len(levels) == 0 {
+		return s.static
+	}
+	lb := s.static.lb
+	for _, level := range levels[1:] {
+		s.backups = append(s.backups, newStaticServers(level, nil, &lb))
+	}
+	if len(levels[0]) == len(s.static.servers) {
+		return s.static
+	}
+
+	return newStaticServers(levels[0], nil, &lb)
+}
+
+// priorityLevels groups the servers by priority, from the highest one.
+func priorityLevels(servers []*Server) [][]*Server {
+	byPriority := make(map[int][]*Server)
+	priorities := []int{}
+	for _, server := range servers {
+		if _, exists := byPriority[server.Priority]; !exists {
+			priorities = append(priorities, server.Priority)
+		}
+		byPriority[server.Priority] = append(byPriority[server.Priority], server)
+	}
+	sort.Ints(priorities)
+
+	levels := make([][]*Server, 0, len(priorities))
+	for _, priority := range priorities {
+		levels = append(levels, byPriority[priority])
+	}
+	return levels
+}
+
+// backupServers returns the backup servers in the order of priority.
+func (s *servers) backupServers() []*staticServers {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.backups
 }
 
 func (s *servers) snapshot() *staticServers {
@@ -195,7 +591,9 @@ func (s *servers) len() int {
 }
 
 func (s *servers) next(ctx context.HTTPContext) (*Server, error) {
-	static := s.snapshot()
+	s.mutex.Lock()
+	static := s.available
+	s.mutex.Unlock()
 
 	if static.len() == 0 {
 		return nil, fmt.Errorf("no server available")
@@ -204,12 +602,46 @@ func (s *servers) next(ctx context.HTTPContext) (*Server, error) {
 	return static.next(ctx), nil
 }
 
+// nextExcept returns the next server of the traffic group which is not
+// excluded, the group is ignored if it's negative or has no available
+// server. It falls back to the first one not excluded in order, e.g. for
+// hash policies, and to the next one if all of them are excluded.
+func (s *servers) nextExcept(ctx context.HTTPContext, group int, excluded map[*Server]bool) (*Server, error) {
+	s.mutex.Lock()
+	static := s.available
+	if group >= 0 && group < len(s.groups) && s.groups[group].len() > 0 {
+		static = s.groups[group]
+	}
+	s.mutex.Unlock()
+
+	if static.len() == 0 {
+		return nil, fmt.Errorf("no server available")
+	}
+
+	server := static.next(ctx)
+	if !excluded[server] {
+		return server, nil
+	}
+
+	for _, candidate := range static.servers {
+		if !excluded[candidate] {
+			return candidate, nil
+		}
+	}
+
+	return server, nil
+}
+
 func (s *servers) close() {
 	close(s.done)
+	unwatchDraining(s)
 
 	if s.serviceWatcher != nil {
 		s.serviceWatcher.Stop()
 	}
+	if s.groupWatcher != nil {
+		s.groupWatcher.Stop()
+	}
 }
 
 func newStaticServers(servers []*Server, tags []string, lb *LoadBalance) *staticServers {
@@ -245,6 +677,59 @@ func newStaticServers(servers []*Server, tags []string, lb *LoadBalance) *static
 	return ss
 }
 
+// warmUp sets the servers in slow start.
+func (ss *staticServers) warmUp(warming map[string]time.Time, slowStart time.Duration) {
+	for _, server := range ss.servers {
+		since, exists := warming[server.URL]
+		if !exists {
+			continue
+		}
+		if ss.warming == nil {
+			ss.slowStart = slowStart
+			ss.warming = make(map[string]time.Time)
+		}
+		ss.warming[server.URL] = since
+		if warmedUp := since.Add(slowStart); warmedUp.After(ss.warmedUp) {
+			ss.warmedUp = warmedUp
+		}
+	}
+}
+
+// slowStartWeights returns the effective weights of the servers, or nil
+// if none of them is in slow start. The weight of a server in slow start
+// ramps up from 1 to full linearly, the servers without weight have the
+// same full weight.
+func (ss *staticServers) slowStartWeights() []int {
+	if ss.warming == nil {
+		return nil
+	}
+	now := time.Now()
+	if !now.Before(ss.warmedUp) {
+		return nil
+	}
+
+	weighted := ss.weightsSum > 0 &&
+		(ss.lb.Policy == PolicyWeightedRandom || ss.lb.Policy == PolicyWeightedRoundRobin)
+	weights := make([]int, len(ss.servers))
+	for i, server := range ss.servers {
+		weight := slowStartScale
+		if weighted {
+			weight *= server.Weight
+		}
+		if since, exists := ss.warming[server.URL]; exists && weight > 0 {
+			if elapsed := now.Sub(since); elapsed < ss.slowStart {
+				weight = int(int64(weight) * int64(elapsed) / int64(ss.slowStart))
+				if weight < 1 {
+					weight = 1
+				}
+			}
+		}
+		weights[i] = weight
+	}
+
+	return weights
+}
+
 func (ss *staticServers) prepare() {
 	for _, server := range ss.servers {
 		ss.weightsSum += server.Weight
@@ -256,6 +741,21 @@ func (ss *staticServers) len() int {
 }
 
 func (ss *staticServers) next(ctx context.HTTPContext) *Server {
+	if ss.lb.StickySession != nil {
+		if server := ss.stickyServer(ctx); server != nil {
+			return server
+		}
+	}
+
+	if weights := ss.slowStartWeights(); weights != nil {
+		switch ss.lb.Policy {
+		case PolicyRoundRobin, PolicyWeightedRoundRobin:
+			return ss.smoothWeighted(weights)
+		case PolicyRandom, PolicyWeightedRandom:
+			return ss.randomWeighted(weights)
+		}
+	}
+
 	switch ss.lb.Policy {
 	case PolicyRoundRobin:
 		return ss.roundRobin(ctx)
@@ -263,6 +763,10 @@ func (ss *staticServers) next(ctx context.HTTPContext) *Server {
 		return ss.random(ctx)
 	case PolicyWeightedRandom:
 		return ss.weightedRandom(ctx)
+	case PolicyWeightedRoundRobin:
+		return ss.weightedRoundRobin(ctx)
+	case PolicyLeastConnections:
+		return ss.leastConnections(ctx)
 	case PolicyIPHash:
 		return ss.ipHash(ctx)
 	case PolicyHeaderHash:
@@ -300,13 +804,162 @@ func (ss *staticServers) weightedRandom(ctx context.HTTPContext) *Server {
 	return ss.random(ctx)
 }
 
+// weightedRoundRobin picks servers by smooth weighted round-robin, which
+// spreads the picks of a server evenly, e.g. weights 5, 1, 1 get the
+// sequence a, a, b, a, c, a, a rather than a, a, a, a, a, b, c.
+// Reference: https://github.com/phusion/nginx/commit/27e94984486058d73157038f7950a0a36ecc6e35
+func (ss *staticServers) weightedRoundRobin(ctx context.HTTPContext) *Server {
+	if ss.weightsSum == 0 {
+		return ss.roundRobin(ctx)
+	}
+
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	if ss.currentWeights == nil {
+		ss.currentWeights = make([]int, len(ss.servers))
+	}
+
+	best := 0
+	for i, server := range ss.servers {
+		ss.currentWeights[i] += server.Weight
+		if ss.currentWeights[i] > ss.currentWeights[best] {
+			best = i
+		}
+	}
+	ss.currentWeights[best] -= ss.weightsSum
+
+	return ss.servers[best]
+}
+
+// smoothWeighted picks servers by smooth weighted round-robin with the
+// weights in slow start.
+func (ss *staticServers) smoothWeighted(weights []int) *Server {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	if ss.currentWeights == nil {
+		ss.currentWeights = make([]int, len(ss.servers))
+	}
+
+	best, sum := 0, 0
+	for i, weight := range weights {
+		sum += weight
+		ss.currentWeights[i] += weight
+		if ss.currentWeights[i] > ss.currentWeights[best] {
+			best = i
+		}
+	}
+	ss.currentWeights[best] -= sum
+
+	return ss.servers[best]
+}
+
+// randomWeighted picks servers by weighted random with the weights in
+// slow start.
+func (ss *staticServers) randomWeighted(weights []int) *Server {
+	sum := 0
+	for _, weight := range weights {
+		sum += weight
+	}
+
+	randomWeight := rand.Intn(sum)
+	for i, weight := range weights {
+		randomWeight -= weight
+		if randomWeight < 0 {
+			return ss.servers[i]
+		}
+	}
+
+	return ss.servers[len(ss.servers)-1]
+}
+
+// leastConnections picks the server with the fewest in-flight requests,
+// which suits the servers with variable response times. The servers are
+// scanned from a round-robin start, so the ties are spread evenly.
+func (ss *staticServers) leastConnections(ctx context.HTTPContext) *Server {
+	count := atomic.AddUint64(&ss.count, 1)
+	// NOTE: start from 0.
+	count--
+
+	start := int(count % uint64(len(ss.servers)))
+	best := ss.servers[start]
+	least := best.inflightRequests()
+	for i := 1; i < len(ss.servers) && least > 0; i++ {
+		server := ss.servers[(start+i)%len(ss.servers)]
+		if inflight := server.inflightRequests(); inflight < least {
+			best, least = server, inflight
+		}
+	}
+
+	return best
+}
+
 func (ss *staticServers) ipHash(ctx context.HTTPContext) *Server {
-	sum32 := int(hashtool.Hash32(ctx.Request().RealIP()))
-	return ss.servers[sum32%len(ss.servers)]
+	return ss.hashRing().get(ctx.Request().RealIP())
 }
 
 func (ss *staticServers) headerHash(ctx context.HTTPContext) *Server {
 	value := ctx.Request().Header().Get(ss.lb.HeaderHashKey)
-	sum32 := int(hashtool.Hash32(value))
-	return ss.servers[sum32%len(ss.servers)]
+	return ss.hashRing().get(value)
+}
+
+func (ss *staticServers) hashRing() *hashRing {
+	ss.ringOnce.Do(func() {
+		ss.ring = newHashRing(ss.servers, ss.lb.VirtualNodes)
+	})
+	return ss.ring
+}
+
+// newHashRing creates the ring like ketama, every md5 digest of
+// "<url>-<i>" places 4 virtual nodes of the server.
+func newHashRing(servers []*Server, virtualNodes int) *hashRing {
+	if virtualNodes <= 0 {
+		virtualNodes = defaultVirtualNodes
+	}
+
+	type node struct {
+		point  uint32
+		server *Server
+	}
+
+	nodes := make([]node, 0, len(servers)*virtualNodes)
+	for _, server := range servers {
+		var digest [md5.Size]byte
+		for i := 0; i < virtualNodes; i++ {
+			if i%4 == 0 {
+				digest = md5.Sum([]byte(server.URL + "-" + strconv.Itoa(i/4)))
+			}
+			nodes = append(nodes, node{
+				point:  binary.LittleEndian.Uint32(digest[i%4*4:]),
+				server: server,
+			})
+		}
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].point < nodes[j].point
+	})
+
+	ring := &hashRing{
+		points:  make([]uint32, len(nodes)),
+		servers: make([]*Server, len(nodes)),
+	}
+	for i, n := range nodes {
+		ring.points[i], ring.servers[i] = n.point, n.server
+	}
+
+	return ring
+}
+
+// get returns the server of the first virtual node clockwise from the key.
+func (r *hashRing) get(key string) *Server {
+	sum32 := hashtool.Hash32(key)
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i] >= sum32
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.servers[i]
 }
@@ -23,11 +23,13 @@ import (
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/megaease/easegress/pkg/context/contexttest"
 	"github.com/megaease/easegress/pkg/object/serviceregistry"
-	"github.com/megaease/easegress/pkg/util/hashtool"
 	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/upstream"
+	"github.com/megaease/easegress/pkg/v"
 )
 
 func TestPickservers(t *testing.T) {
@@ -275,6 +277,17 @@ func TestStaticServers(t *testing.T) {
 		ss.next(ctx)
 	}
 
+	ss.lb.Policy = PolicyWeightedRoundRobin
+	picks := map[*Server]int{}
+	for i := 0; i < ss.weightsSum*10; i++ {
+		picks[ss.next(ctx)]++
+	}
+	for _, s := range servers {
+		if picks[s] != s.Weight*10 {
+			t.Errorf("server %s picked %d times, want %d", s.URL, picks[s], s.Weight*10)
+		}
+	}
+
 	ip := ""
 	ctx.MockedRequest.MockedRealIP = func() string {
 		return ip
@@ -282,8 +295,7 @@ func TestStaticServers(t *testing.T) {
 	ss.lb.Policy = PolicyIPHash
 	for i := 0; i < len(servers)*5; i++ {
 		ip = fmt.Sprintf("111.222.111.%d", i)
-		sum32 := int(hashtool.Hash32(ip))
-		s := servers[sum32%len(servers)]
+		s := ss.hashRing().get(ip)
 		if ss.next(ctx) != s {
 			t.Errorf("ss.next() returns unexpected server")
 		}
@@ -305,14 +317,102 @@ func TestStaticServers(t *testing.T) {
 	for i := 0; i < len(servers)*5; i++ {
 		v := fmt.Sprintf("value-%d", i)
 		header.Set(ss.lb.HeaderHashKey, v)
-		sum32 := int(hashtool.Hash32(v))
-		s := servers[sum32%len(servers)]
+		s := ss.hashRing().get(v)
 		if ss.next(ctx) != s {
 			t.Errorf("ss.next() returns unexpected server")
 		}
 	}
 }
 
+func TestWeightedRoundRobin(t *testing.T) {
+	a := &Server{URL: "http://127.0.0.1:9090", Weight: 5}
+	b := &Server{URL: "http://127.0.0.1:9091", Weight: 1}
+	c := &Server{URL: "http://127.0.0.1:9092", Weight: 1}
+	ss := newStaticServers([]*Server{a, b, c}, nil, &LoadBalance{Policy: PolicyWeightedRoundRobin})
+
+	ctx := &contexttest.MockedHTTPContext{}
+	want := []*Server{a, a, b, a, c, a, a}
+	for round := 0; round < 2; round++ {
+		for i, s := range want {
+			if got := ss.next(ctx); got != s {
+				t.Fatalf("round %d pick %d: want %s, got %s", round, i, s.URL, got.URL)
+			}
+		}
+	}
+
+	// servers without weight are picked in turn
+	ss = newStaticServers([]*Server{{URL: a.URL}, {URL: b.URL}}, nil, &LoadBalance{Policy: PolicyWeightedRoundRobin})
+	if ss.next(ctx).URL != a.URL || ss.next(ctx).URL != b.URL {
+		t.Errorf("servers without weight should be picked by round-robin")
+	}
+}
+
+func TestLeastConnections(t *testing.T) {
+	a := &Server{URL: "http://127.0.0.1:9090"}
+	b := &Server{URL: "http://127.0.0.1:9091"}
+	c := &Server{URL: "http://127.0.0.1:9092"}
+	ss := newStaticServers([]*Server{a, b, c}, nil, &LoadBalance{Policy: PolicyLeastConnections})
+
+	ctx := &contexttest.MockedHTTPContext{}
+	for i := 0; i < 3; i++ {
+		ss.next(ctx).acquire()
+	}
+	if a.inflightRequests() != 1 || b.inflightRequests() != 1 || c.inflightRequests() != 1 {
+		t.Fatalf("ties should be spread evenly: %d, %d, %d", a.inflight, b.inflight, c.inflight)
+	}
+
+	a.acquire()
+	c.acquire()
+	for i := 0; i < 3; i++ {
+		if got := ss.next(ctx); got != b {
+			t.Errorf("want %s, got %s", b.URL, got.URL)
+		}
+	}
+
+	a.release()
+	a.release()
+	if got := ss.next(ctx); got != a {
+		t.Errorf("want %s, got %s", a.URL, got.URL)
+	}
+}
+
+func TestHashRing(t *testing.T) {
+	servers := []*Server{}
+	for i := 0; i < 5; i++ {
+		servers = append(servers, &Server{URL: fmt.Sprintf("http://127.0.0.1:%d", 9090+i)})
+	}
+
+	const keys = 10000
+	ring := newHashRing(servers, 0)
+	if len(ring.points) != len(servers)*defaultVirtualNodes {
+		t.Fatalf("want %d virtual nodes, got %d", len(servers)*defaultVirtualNodes, len(ring.points))
+	}
+
+	picks := map[*Server]int{}
+	for i := 0; i < keys; i++ {
+		picks[ring.get(fmt.Sprintf("key-%d", i))]++
+	}
+	for _, s := range servers {
+		if picks[s] < keys/len(servers)/2 {
+			t.Errorf("server %s picked %d times, the ring is unbalanced", s.URL, picks[s])
+		}
+	}
+
+	// removing a server only remaps its own keys
+	smaller := newHashRing(servers[:4], 0)
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if s := ring.get(key); s != servers[4] && smaller.get(key) != s {
+			t.Fatalf("key %s remapped from %s to %s", key, s.URL, smaller.get(key).URL)
+		}
+	}
+
+	ring = newHashRing(servers, 10)
+	if len(ring.points) != len(servers)*10 {
+		t.Errorf("want %d virtual nodes, got %d", len(servers)*10, len(ring.points))
+	}
+}
+
 func TestDynamicService(t *testing.T) {
 	loadBalance := &LoadBalance{Policy: PolicyRandom}
 	configServers := []*Server{
@@ -407,3 +507,156 @@ func TestDynamicService(t *testing.T) {
 		t.Fatalf("want: %+v\ngot :%+v\n", wantStatic, s.static)
 	}
 }
+
+func TestServerGroup(t *testing.T) {
+	poolSpec := &PoolSpec{
+		LoadBalance: &LoadBalance{Policy: PolicyRoundRobin},
+		Servers:     []*Server{{URL: "http://127.0.0.1:8888"}},
+		ServerGroup: "fleet",
+	}
+	if vr := v.Validate(poolSpec); !vr.Valid() {
+		t.Fatalf("references should not be rejected without groups, but got %v", vr)
+	}
+
+	s := newServers(nil, poolSpec)
+	defer s.close()
+
+	urls := func() []string {
+		var result []string
+		for _, server := range s.snapshot().servers {
+			result = append(result, server.URL)
+		}
+		return result
+	}
+	waitURLs := func(want ...string) {
+		for i := 0; i < 100; i++ {
+			if reflect.DeepEqual(urls(), want) {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("servers want %v, got %v", want, urls())
+	}
+
+	waitURLs("http://127.0.0.1:8888")
+
+	upstream.Set("fleet", []*upstream.Server{
+		{URL: "http://127.0.0.1:1111"},
+		{URL: "http://127.0.0.1:2222"},
+	})
+	defer upstream.Delete("fleet")
+	waitURLs("http://127.0.0.1:1111", "http://127.0.0.1:2222")
+
+	upstream.Set("fleet", []*upstream.Server{{URL: "http://127.0.0.1:3333"}})
+	waitURLs("http://127.0.0.1:3333")
+
+	if vr := v.Validate(poolSpec); !vr.Valid() {
+		t.Errorf("fleet should exist, but got %v", vr)
+	}
+	poolSpec.ServerGroup = "other"
+	if vr := v.Validate(poolSpec); vr.Valid() {
+		t.Error("other should not exist")
+	}
+	poolSpec.ServerGroup = "fleet"
+
+	upstream.Delete("fleet")
+	waitURLs("http://127.0.0.1:8888")
+}
+
+func TestSlowStart(t *testing.T) {
+	lb := LoadBalance{Policy: PolicyIPHash, SlowStart: "1s"}
+	if lb.Validate() == nil {
+		t.Errorf("slowStart should not be supported by ipHash")
+	}
+
+	s := newServers(nil, &PoolSpec{
+		LoadBalance: &LoadBalance{Policy: PolicyRoundRobin, SlowStart: "10s"},
+		Servers: []*Server{
+			{URL: "http://127.0.0.1:9091"},
+			{URL: "http://127.0.0.1:9092"},
+		},
+	})
+	defer s.close()
+
+	ctx := &contexttest.MockedHTTPContext{}
+	count := func() map[string]int {
+		counts := make(map[string]int)
+		for i := 0; i < 100; i++ {
+			server, err := s.next(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			counts[server.URL]++
+		}
+		return counts
+	}
+
+	// the servers at the creation are not warmed up
+	if counts := count(); counts["http://127.0.0.1:9091"] != 50 {
+		t.Errorf("want the requests spread evenly, got %v", counts)
+	}
+
+	// the server returning from down is warmed up
+	s.setDown(map[string]bool{"http://127.0.0.1:9091": true})
+	s.setDown(nil)
+	s.mutex.Lock()
+	s.warming["http://127.0.0.1:9091"] = time.Now().Add(-5 * time.Second)
+	s.updateAvailable()
+	s.mutex.Unlock()
+	if counts := count(); counts["http://127.0.0.1:9091"] < 30 || counts["http://127.0.0.1:9091"] > 40 {
+		t.Errorf("want about 1/3 of the requests to the warming server, got %v", counts)
+	}
+
+	s.mutex.Lock()
+	s.warming["http://127.0.0.1:9091"] = time.Now().Add(-10 * time.Second)
+	s.updateAvailable()
+	s.mutex.Unlock()
+	if len(s.warming) != 0 {
+		t.Errorf("want no warming server, got %v", s.warming)
+	}
+	if counts := count(); counts["http://127.0.0.1:9091"] != 50 {
+		t.Errorf("want the requests spread evenly, got %v", counts)
+	}
+}
+
+func TestServerPriority(t *testing.T) {
+	s := newServers(nil, &PoolSpec{
+		LoadBalance: &LoadBalance{Policy: PolicyRoundRobin},
+		Servers: []*Server{
+			{URL: "http://127.0.0.1:9091"},
+			{URL: "http://127.0.0.1:9092", Priority: 2},
+			{URL: "http://127.0.0.1:9093", Priority: 1},
+		},
+	})
+	defer s.close()
+
+	ctx := &contexttest.MockedHTTPContext{}
+	want := func(url string) {
+		for i := 0; i < 3; i++ {
+			server, err := s.next(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if server.URL != url {
+				t.Fatalf("want server %s, got %s", url, server.URL)
+			}
+		}
+	}
+
+	want("http://127.0.0.1:9091")
+	backups := s.backupServers()
+	if len(backups) != 2 || backups[0].servers[0].URL != "http://127.0.0.1:9093" {
+		t.Errorf("want the backups in the order of priority, got %+v", backups)
+	}
+
+	s.setDown(map[string]bool{"http://127.0.0.1:9091": true})
+	want("http://127.0.0.1:9093")
+	s.setEjected(map[string]bool{"http://127.0.0.1:9093": true})
+	want("http://127.0.0.1:9092")
+	if backups := s.backupServers(); len(backups) != 0 {
+		t.Errorf("want no backup, got %+v", backups)
+	}
+
+	s.setDown(nil)
+	want("http://127.0.0.1:9091")
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/codecounter"
+)
+
+// defaultDurationBuckets are the default upper bounds of the buckets of
+// the duration histograms of servers.
+var defaultDurationBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+type (
+	// ServerStatsSpec describes the statistics of each server of a pool,
+	// i.e. the codes, the duration histograms and the classes of errors.
+	ServerStatsSpec struct {
+		// DurationBuckets are the ascending upper bounds of the buckets
+		// of the duration histograms.
+		DurationBuckets []string `yaml:"durationBuckets,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+	}
+
+	serverStats struct {
+		buckets []time.Duration
+
+		mutex    sync.Mutex
+		counters map[string]*codecounter.CodeCounter
+	}
+)
+
+// Validate validates ServerStatsSpec.
+func (spec ServerStatsSpec) Validate() error {
+	_, err := spec.durationBuckets()
+	return err
+}
+
+func (spec *ServerStatsSpec) durationBuckets() ([]time.Duration, error) {
+	if len(spec.DurationBuckets) == 0 {
+		return defaultDurationBuckets, nil
+	}
+
+	buckets := make([]time.Duration, 0, len(spec.DurationBuckets))
+	for i, s := range spec.DurationBuckets {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration bucket %s: %v", s, err)
+		}
+		if i > 0 && d <= buckets[i-1] {
+			return nil, fmt.Errorf("duration buckets are not ascending: %s", s)
+		}
+		buckets = append(buckets, d)
+	}
+	return buckets, nil
+}
+
+func newServerStats(spec *ServerStatsSpec) *serverStats {
+	// NOTE: It has been validated.
+	buckets, _ := spec.durationBuckets()
+
+	return &serverStats{
+		buckets:  buckets,
+		counters: make(map[string]*codecounter.CodeCounter),
+	}
+}
+
+func (ss *serverStats) counter(url string) *codecounter.CodeCounter {
+	cc := ss.counters[url]
+	if cc == nil {
+		cc = codecounter.NewWithBuckets(ss.buckets)
+		ss.counters[url] = cc
+	}
+	return cc
+}
+
+// count counts the response of the server.
+func (ss *serverStats) count(url string, code int, d time.Duration) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	cc := ss.counter(url)
+	cc.Count(code)
+	cc.CountDuration(d)
+}
+
+// countError counts the error of sending the request to the server.
+func (ss *serverStats) countError(url string, err error, d time.Duration) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	cc := ss.counter(url)
+	cc.CountError(codecounter.ErrorClass(err))
+	cc.CountDuration(d)
+}
+
+// countTiming counts the durations of the phases of the request to the
+// server.
+func (ss *serverStats) countTiming(url string, t *timing) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	cc := ss.counter(url)
+	t.each(cc.CountPhase)
+}
+
+func (ss *serverStats) status() map[string]*codecounter.Stats {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	status := make(map[string]*codecounter.Stats, len(ss.counters))
+	for url, cc := range ss.counters {
+		status[url] = cc.Stats()
+	}
+	return status
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/codecounter"
+)
+
+func TestServerStats(t *testing.T) {
+	spec := &ServerStatsSpec{DurationBuckets: []string{"100ms", "10ms"}}
+	if spec.Validate() == nil {
+		t.Errorf("descending buckets should be invalid")
+	}
+	spec.DurationBuckets = []string{"10ms", "abc"}
+	if spec.Validate() == nil {
+		t.Errorf("invalid duration should be invalid")
+	}
+	spec.DurationBuckets = []string{"10ms", "100ms"}
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ss := newServerStats(spec)
+	ss.count("http://127.0.0.1:9091", 200, time.Millisecond)
+	ss.count("http://127.0.0.1:9091", 503, 50*time.Millisecond)
+	ss.countError("http://127.0.0.1:9092", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, time.Second)
+
+	status := ss.status()
+	stats := status["http://127.0.0.1:9091"]
+	if stats == nil || stats.Codes[200] != 1 || stats.Codes[503] != 1 {
+		t.Fatalf("want the codes of 9091 counted, got %+v", stats)
+	}
+	if len(stats.Durations) != 3 || stats.Durations[0].Count != 1 || stats.Durations[1].Count != 1 {
+		t.Errorf("want the durations of 9091 counted, got %+v", stats.Durations)
+	}
+	stats = status["http://127.0.0.1:9092"]
+	if stats == nil || stats.Errors[codecounter.ErrorDial] != 1 || stats.Durations[2].Count != 1 {
+		t.Errorf("want the dial error of 9092 counted, got %+v", stats)
+	}
+
+	if buckets, _ := (&ServerStatsSpec{}).durationBuckets(); len(buckets) != len(defaultDurationBuckets) {
+		t.Errorf("want the default buckets, got %v", buckets)
+	}
+}
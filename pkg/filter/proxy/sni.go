@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+// maxSNIClients is the max number of the cached clients of server names,
+// the clients beyond it don't keep the connections alive.
+const maxSNIClients = 1024
+
+type (
+	// sniClients are the clients of the servers whose TLS server names
+	// are overridden, there is one client per server name, so that the
+	// connections of different server names are not mixed up.
+	sniClients struct {
+		base *http.Client
+
+		mutex   sync.Mutex
+		clients map[string]*http.Client
+	}
+)
+
+// usesSNI reports whether any static server of the proxy overrides the
+// TLS server name.
+func (s *Spec) usesSNI() bool {
+	for _, pool := range s.poolSpecs() {
+		for _, server := range pool.Servers {
+			if server.SNI != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func newSNIClients(base *http.Client) *sniClients {
+	return &sniClients{
+		base:    base,
+		clients: make(map[string]*http.Client),
+	}
+}
+
+// get returns the client of the server name.
+func (sc *sniClients) get(serverName string) *http.Client {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	if client, exists := sc.clients[serverName]; exists {
+		return client
+	}
+
+	transport := sc.base.Transport.(*http.Transport).Clone()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = globalClient.Transport.(*http.Transport).TLSClientConfig.Clone()
+	}
+	transport.TLSClientConfig.ServerName = serverName
+	client := &http.Client{
+		Timeout:       sc.base.Timeout,
+		Transport:     transport,
+		CheckRedirect: sc.base.CheckRedirect,
+	}
+
+	if len(sc.clients) >= maxSNIClients {
+		transport.DisableKeepAlives = true
+		return client
+	}
+	sc.clients[serverName] = client
+	return client
+}
+
+func (sc *sniClients) close() {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	for _, client := range sc.clients {
+		client.CloseIdleConnections()
+	}
+}
+
+// renderServerOption renders the templates in the option of the server,
+// the option is used as is if it fails to render.
+func renderServerOption(ctx context.HTTPContext, option string) string {
+	te := ctx.Template()
+	if te == nil || !te.HasTemplates(option) {
+		return option
+	}
+
+	rendered, err := te.Render(option)
+	if err != nil {
+		ctx.Logger().Warnf("render %s failed: %v", option, err)
+		return option
+	}
+	return rendered
+}
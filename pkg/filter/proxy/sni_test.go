@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/texttemplate"
+)
+
+func TestHostHeaderAndSNI(t *testing.T) {
+	te, err := texttemplate.NewDefault([]string{"filter.{}.req.host"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	te.SetDict("filter.requestAdaptor.req.host", "www.megaease.com")
+
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedMethod = func() string {
+		return http.MethodGet
+	}
+	ctx.MockedRequest.MockedHost = func() string {
+		return "megaease.com"
+	}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(http.Header{})
+	}
+	ctx.MockedTemplate = func() texttemplate.TemplateEngine {
+		return te
+	}
+
+	server := &Server{
+		URL:        "https://192.168.1.2",
+		HostHeader: "origin.megaease.com",
+		SNI:        "[[filter.requestAdaptor.req.host]]",
+	}
+	p := &pool{}
+	req, _ := p.newRequest(ctx, server, nil)
+	if req.std.Host != "origin.megaease.com" {
+		t.Errorf("want host origin.megaease.com, got %s", req.std.Host)
+	}
+	if req.sni != "www.megaease.com" {
+		t.Errorf("want sni www.megaease.com, got %s", req.sni)
+	}
+
+	var serverName string
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverName = r.TLS.ServerName
+	}))
+	defer ts.Close()
+
+	clients := newSNIClients(globalClient)
+	defer clients.close()
+	client := clients.get(req.sni)
+	if clients.get(req.sni) != client {
+		t.Errorf("the client of the same server name should be reused")
+	}
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if serverName != "www.megaease.com" {
+		t.Errorf("want server name www.megaease.com, got %s", serverName)
+	}
+	if globalClient.Transport.(*http.Transport).TLSClientConfig.ServerName != "" {
+		t.Errorf("the server name of the global client should not be changed")
+	}
+}
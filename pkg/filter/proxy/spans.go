@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+// keyTraceParent is the header of the W3C trace context.
+const keyTraceParent = "traceparent"
+
+// injectTraceParent sets the W3C traceparent header of the span, so the
+// servers not speaking the headers of Zipkin are traced too.
+func injectTraceParent(header http.Header, span tracing.Span) {
+	if tp := tracing.TraceParent(span); tp != "" {
+		header.Set(keyTraceParent, tp)
+	}
+}
+
+// withSpanEvents returns the context logging the events of the connection
+// and the request as the events of the span of the attempt.
+func withSpanEvents(ctx stdcontext.Context, span tracing.Span) stdcontext.Context {
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			span.LogKV("event", "dnsStart", "host", info.Host)
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			if info.Err != nil {
+				span.LogKV("event", "dnsDone", "error", info.Err.Error())
+				return
+			}
+			span.LogKV("event", "dnsDone")
+		},
+		ConnectStart: func(network, addr string) {
+			span.LogKV("event", "connectStart", "addr", addr)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err != nil {
+				span.LogKV("event", "connectDone", "addr", addr, "error", err.Error())
+				return
+			}
+			span.LogKV("event", "connectDone", "addr", addr)
+		},
+		TLSHandshakeStart: func() {
+			span.LogKV("event", "tlsHandshakeStart")
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err != nil {
+				span.LogKV("event", "tlsHandshakeDone", "error", err.Error())
+				return
+			}
+			span.LogKV("event", "tlsHandshakeDone")
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			span.LogKV("event", "gotConn", "reused", info.Reused)
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			span.LogKV("event", "wroteRequest")
+		},
+		GotFirstResponseByte: func() {
+			span.LogKV("event", "gotFirstResponseByte")
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace)
+}
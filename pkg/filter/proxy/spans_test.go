@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/tracing/zipkin"
+)
+
+func TestSpanEvents(t *testing.T) {
+	var traceParent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceParent = r.Header.Get(keyTraceParent)
+	}))
+	defer server.Close()
+
+	tracer, err := tracing.New(&tracing.Spec{
+		ServiceName: "test",
+		Zipkin: &zipkin.Spec{
+			ServerURL:  "http://127.0.0.1:9411/api/v2/spans",
+			SampleRate: 1,
+		},
+	})
+	if err != nil {
+		t.Fatalf("create tracing failed: %v", err)
+	}
+	defer tracer.Close()
+
+	span := tracing.NewSpan(tracer, "attempt")
+	defer func() {
+		span.Cancel()
+		span.Finish()
+	}()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	injectTraceParent(req.Header, span)
+	req = req.WithContext(withSpanEvents(req.Context(), span))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if want := tracing.TraceParent(span); want == "" || traceParent != want {
+		t.Errorf("want traceparent %q, got %q", want, traceParent)
+	}
+
+	header := http.Header{}
+	injectTraceParent(header, tracing.NewSpan(tracing.NoopTracing, "noop"))
+	if header.Get(keyTraceParent) != "" {
+		t.Errorf("want no traceparent if the tracing is disabled")
+	}
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+const defaultStickyCookieName = "EG_STICKY"
+
+type (
+	// StickySessionSpec describes the sticky session by the affinity
+	// cookie, the requests carrying it go to the same server as long as
+	// the server is available, the others are balanced by the policy and
+	// get the cookie of the chosen server in the response.
+	StickySessionSpec struct {
+		CookieName string `yaml:"cookieName,omitempty" jsonschema:"omitempty"`
+		// CookieTTL is the max age of the cookie, it's a session cookie
+		// if empty.
+		CookieTTL string `yaml:"cookieTTL,omitempty" jsonschema:"omitempty,format=duration"`
+		HTTPOnly  bool   `yaml:"httpOnly,omitempty" jsonschema:"omitempty"`
+		Secure    bool   `yaml:"secure,omitempty" jsonschema:"omitempty"`
+	}
+)
+
+func (spec *StickySessionSpec) cookieName() string {
+	if spec.CookieName == "" {
+		return defaultStickyCookieName
+	}
+	return spec.CookieName
+}
+
+// stickyID is the value of the affinity cookie for the server, which
+// doesn't expose the URL of the server.
+func stickyID(server *Server) string {
+	sum := md5.Sum([]byte(server.URL))
+	return hex.EncodeToString(sum[:8])
+}
+
+// stickyServer returns the server of the affinity cookie of the request,
+// it returns nil if there's no cookie or the server is not available.
+func (ss *staticServers) stickyServer(ctx context.HTTPContext) *Server {
+	cookie, err := ctx.Request().Cookie(ss.lb.StickySession.cookieName())
+	if err != nil || cookie == nil {
+		return nil
+	}
+
+	ss.stickyOnce.Do(func() {
+		ss.stickyServers = make(map[string]*Server, len(ss.servers))
+		for _, server := range ss.servers {
+			ss.stickyServers[stickyID(server)] = server
+		}
+	})
+
+	return ss.stickyServers[cookie.Value]
+}
+
+// setStickyCookie sets the affinity cookie of the server in the response
+// if the request doesn't carry it already.
+func setStickyCookie(ctx context.HTTPContext, spec *StickySessionSpec, server *Server) {
+	id := stickyID(server)
+	name := spec.cookieName()
+	if cookie, err := ctx.Request().Cookie(name); err == nil && cookie != nil && cookie.Value == id {
+		return
+	}
+
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    id,
+		Path:     "/",
+		HttpOnly: spec.HTTPOnly,
+		Secure:   spec.Secure,
+	}
+	if spec.CookieTTL != "" {
+		// NOTE: It's validated by the format.
+		ttl, _ := time.ParseDuration(spec.CookieTTL)
+		cookie.MaxAge = int(ttl.Seconds())
+		cookie.Expires = time.Now().Add(ttl)
+	}
+
+	ctx.Response().SetCookie(cookie)
+}
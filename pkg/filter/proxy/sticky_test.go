@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+)
+
+func TestStickySession(t *testing.T) {
+	a := &Server{URL: "http://127.0.0.1:9090"}
+	b := &Server{URL: "http://127.0.0.1:9091"}
+	c := &Server{URL: "http://127.0.0.1:9092"}
+	spec := &StickySessionSpec{CookieTTL: "1h", HTTPOnly: true}
+	ss := newStaticServers([]*Server{a, b, c}, nil, &LoadBalance{
+		Policy:        PolicyRoundRobin,
+		StickySession: spec,
+	})
+
+	var reqCookie *http.Cookie
+	var respCookie *http.Cookie
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedCookie = func(name string) (*http.Cookie, error) {
+		if reqCookie == nil || reqCookie.Name != name {
+			return nil, http.ErrNoCookie
+		}
+		return reqCookie, nil
+	}
+	ctx.MockedResponse.MockedSetCookie = func(cookie *http.Cookie) {
+		respCookie = cookie
+	}
+
+	// without the cookie, the servers are picked by the policy
+	if got := ss.next(ctx); got != a {
+		t.Fatalf("want %s, got %s", a.URL, got.URL)
+	}
+	setStickyCookie(ctx, spec, a)
+	if respCookie == nil || respCookie.Name != defaultStickyCookieName ||
+		respCookie.Value != stickyID(a) || respCookie.MaxAge != 3600 || !respCookie.HttpOnly {
+		t.Fatalf("unexpected cookie: %+v", respCookie)
+	}
+
+	// with the cookie, the same server is picked
+	reqCookie = respCookie
+	for i := 0; i < 5; i++ {
+		if got := ss.next(ctx); got != a {
+			t.Fatalf("want %s, got %s", a.URL, got.URL)
+		}
+	}
+
+	// the cookie is not set again if it's the same
+	respCookie = nil
+	setStickyCookie(ctx, spec, a)
+	if respCookie != nil {
+		t.Errorf("cookie should not be set again")
+	}
+
+	// the server of the cookie is not available
+	ss = newStaticServers([]*Server{b, c}, nil, &LoadBalance{
+		Policy:        PolicyRoundRobin,
+		StickySession: spec,
+	})
+	if got := ss.next(ctx); got != b {
+		t.Fatalf("want %s, got %s", b.URL, got.URL)
+	}
+	setStickyCookie(ctx, spec, b)
+	if respCookie == nil || respCookie.Value != stickyID(b) {
+		t.Errorf("unexpected cookie: %+v", respCookie)
+	}
+
+	// invalid cookie
+	reqCookie = &http.Cookie{Name: defaultStickyCookieName, Value: "invalid"}
+	if got := ss.next(ctx); got != c {
+		t.Fatalf("want %s, got %s", c.URL, got.URL)
+	}
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import "time"
+
+const defaultDialTimeout = 30 * time.Second
+
+type (
+	// TimeoutSpec describes the timeouts of the requests to servers,
+	// the default values of globalClient are used for the empty ones.
+	TimeoutSpec struct {
+		Dial           string `yaml:"dial" jsonschema:"omitempty,format=duration"`
+		TLSHandshake   string `yaml:"tlsHandshake" jsonschema:"omitempty,format=duration"`
+		ResponseHeader string `yaml:"responseHeader" jsonschema:"omitempty,format=duration"`
+		// Idle is the timeout of the idle keep-alive connections.
+		Idle string `yaml:"idle" jsonschema:"omitempty,format=duration"`
+		// Request is the total timeout of a request, including the
+		// retries and reading the response body.
+		Request string `yaml:"request" jsonschema:"omitempty,format=duration"`
+	}
+)
+
+// transportCustomized reports whether the spec needs a transport
+// other than the one of globalClient.
+func (spec *TimeoutSpec) transportCustomized() bool {
+	return spec != nil && (spec.Dial != "" || spec.TLSHandshake != "" ||
+		spec.ResponseHeader != "" || spec.Idle != "")
+}
+
+// requestTimeout returns the total timeout of a request, 0 means no limit.
+func (spec *TimeoutSpec) requestTimeout() time.Duration {
+	if spec == nil {
+		return 0
+	}
+	// NOTE: It has been validated by format=duration.
+	d, _ := time.ParseDuration(spec.Request)
+	return d
+}
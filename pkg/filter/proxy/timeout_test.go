@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/yamltool"
+)
+
+func TestTimeoutClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	client := newClient(&Spec{Timeout: &TimeoutSpec{ResponseHeader: "10ms"}})
+	defer client.CloseIdleConnections()
+
+	_, err := client.Get(server.URL)
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		t.Errorf("request should time out, but got %v", err)
+	}
+
+	if (&TimeoutSpec{Request: "1s"}).transportCustomized() {
+		t.Error("request timeout should not customize the transport")
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	const yamlSpec = `
+name: proxy
+kind: Proxy
+mainPool:
+  servers:
+  - url: http://127.0.0.1:9095
+  - url: http://127.0.0.2:9095
+  loadBalance:
+    policy: roundRobin
+  retry:
+    maxAttempts: 5
+    perTryTimeout: 20ms
+    baseInterval: 1ms
+timeout:
+  request: 50ms
+`
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, e := httppipeline.NewFilterSpec(rawSpec, nil)
+	if e != nil {
+		t.Fatalf("unexpected error: %v", e)
+	}
+
+	proxy := &Proxy{}
+	proxy.Init(spec)
+	defer proxy.Close()
+
+	if proxy.client != globalClient {
+		t.Error("request timeout should use globalClient")
+	}
+
+	attempts := 0
+	oldSendRequest := fnSendRequest
+	defer func() { fnSendRequest = oldSendRequest }()
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		attempts++
+		<-r.Context().Done()
+		return nil, &net.OpError{Op: "read", Err: r.Context().Err()}
+	}
+
+	statusCode := 0
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedMethod = func() string {
+		return http.MethodGet
+	}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(http.Header{})
+	}
+	ctx.MockedResponse.MockedSetStatusCode = func(code int) {
+		statusCode = code
+	}
+
+	start := time.Now()
+	if result := proxy.handle(ctx); result != resultServerError {
+		t.Errorf("result should be %s, but got %s", resultServerError, result)
+	}
+	if statusCode != http.StatusGatewayTimeout {
+		t.Errorf("status code should be %d, but got %d", http.StatusGatewayTimeout, statusCode)
+	}
+	if d := time.Since(start); d > 200*time.Millisecond {
+		t.Errorf("request should stop at the deadline, but took %v", d)
+	}
+	if attempts < 2 || attempts > 3 {
+		t.Errorf("attempts should be limited by the deadline, but got %d", attempts)
+	}
+}
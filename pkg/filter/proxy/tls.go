@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"sync/atomic"
+)
+
+type (
+	// TLSSpec describes the TLS of the connections to servers, the
+	// servers are verified unless InsecureSkipVerify is true.
+	TLSSpec struct {
+		// CACertBase64 is the PEM bundle of the CAs verifying servers,
+		// the system CAs are used if it's empty.
+		CACertBase64 string `yaml:"caCertBase64" jsonschema:"omitempty,format=base64"`
+		// CertBase64 and KeyBase64 are the client certificate and key
+		// for mutual TLS.
+		CertBase64 string `yaml:"certBase64" jsonschema:"omitempty,format=base64"`
+		KeyBase64  string `yaml:"keyBase64" jsonschema:"omitempty,format=base64"`
+		// ServerName overrides the hostname of servers for SNI and
+		// verification.
+		ServerName         string `yaml:"serverName" jsonschema:"omitempty"`
+		InsecureSkipVerify bool   `yaml:"insecureSkipVerify" jsonschema:"omitempty"`
+		// SessionCacheSize is the number of TLS sessions cached for
+		// resumption, the sessions are not resumed if it's zero.
+		SessionCacheSize int `yaml:"sessionCacheSize,omitempty" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// TLSStatus is the status of the TLS handshakes with servers.
+	TLSStatus struct {
+		Handshakes     uint64  `yaml:"handshakes"`
+		Resumed        uint64  `yaml:"resumed"`
+		ResumptionRate float64 `yaml:"resumptionRate"`
+	}
+
+	// tlsStats counts the TLS handshakes and the resumed ones.
+	tlsStats struct {
+		handshakes uint64
+		resumed    uint64
+	}
+)
+
+// Validate validates TLSSpec.
+func (spec *TLSSpec) Validate() error {
+	if (spec.CertBase64 == "") != (spec.KeyBase64 == "") {
+		return fmt.Errorf("certBase64 and keyBase64 must be specified together")
+	}
+
+	_, err := spec.tlsConfig()
+	return err
+}
+
+func (spec *TLSSpec) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         spec.ServerName,
+		InsecureSkipVerify: spec.InsecureSkipVerify,
+	}
+
+	// NOTE: They have been validated by format=base64.
+	if spec.CACertBase64 != "" {
+		caPem, _ := base64.StdEncoding.DecodeString(spec.CACertBase64)
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(caPem) {
+			return nil, fmt.Errorf("no certificate found in caCertBase64")
+		}
+	}
+
+	if spec.CertBase64 != "" {
+		certPem, _ := base64.StdEncoding.DecodeString(spec.CertBase64)
+		keyPem, _ := base64.StdEncoding.DecodeString(spec.KeyBase64)
+		cert, err := tls.X509KeyPair(certPem, keyPem)
+		if err != nil {
+			return nil, fmt.Errorf("generate x509 key pair failed: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if spec.SessionCacheSize > 0 {
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(spec.SessionCacheSize)
+	}
+
+	return config, nil
+}
+
+// newTLSStats returns the stats of the handshakes of the config.
+// NOTE: VerifyConnection is called for the resumed connections too.
+func newTLSStats(config *tls.Config) *tlsStats {
+	stats := &tlsStats{}
+	verify := config.VerifyConnection
+	config.VerifyConnection = func(cs tls.ConnectionState) error {
+		atomic.AddUint64(&stats.handshakes, 1)
+		if cs.DidResume {
+			atomic.AddUint64(&stats.resumed, 1)
+		}
+		if verify != nil {
+			return verify(cs)
+		}
+		return nil
+	}
+	return stats
+}
+
+func (stats *tlsStats) status() *TLSStatus {
+	s := &TLSStatus{
+		Handshakes: atomic.LoadUint64(&stats.handshakes),
+		Resumed:    atomic.LoadUint64(&stats.resumed),
+	}
+	if s.Handshakes > 0 {
+		s.ResumptionRate = float64(s.Resumed) / float64(s.Handshakes)
+	}
+	return s
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newClientCert(t *testing.T) (certPem, keyPem []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key failed: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate failed: %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key failed: %v", err)
+	}
+
+	certPem = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return
+}
+
+func TestTLSSpec(t *testing.T) {
+	clientCert, clientKey := newClientCert(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM(clientCert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	caCert := base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.Certificate().Raw,
+	}))
+
+	tests := []struct {
+		spec *TLSSpec
+		ok   bool
+	}{
+		{&TLSSpec{}, false},
+		{&TLSSpec{InsecureSkipVerify: true}, true},
+		{&TLSSpec{CACertBase64: caCert}, true},
+		{&TLSSpec{CACertBase64: caCert, ServerName: "example.com"}, true},
+		{&TLSSpec{CACertBase64: caCert, ServerName: "other.com"}, false},
+		{&TLSSpec{
+			CACertBase64: caCert,
+			CertBase64:   base64.StdEncoding.EncodeToString(clientCert),
+			KeyBase64:    base64.StdEncoding.EncodeToString(clientKey),
+		}, true},
+	}
+
+	for i, test := range tests {
+		if err := test.spec.Validate(); err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		client := newClient(&Spec{TLS: test.spec})
+
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if test.ok != (err == nil) {
+			t.Errorf("case %d: want ok %v, but got %v", i, test.ok, err)
+		}
+		client.CloseIdleConnections()
+	}
+
+	server.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+	client := newClient(&Spec{TLS: &TLSSpec{CACertBase64: caCert}})
+	if _, err := client.Get(server.URL); err == nil {
+		t.Error("request without client certificate should fail")
+	}
+
+	invalid := []*TLSSpec{
+		{CertBase64: base64.StdEncoding.EncodeToString(clientCert)},
+		{CACertBase64: base64.StdEncoding.EncodeToString([]byte("not a pem"))},
+		{
+			CertBase64: base64.StdEncoding.EncodeToString(clientCert),
+			KeyBase64:  base64.StdEncoding.EncodeToString(clientCert),
+		},
+	}
+	for i, spec := range invalid {
+		if err := spec.Validate(); err == nil {
+			t.Errorf("case %d: invalid spec should fail", i)
+		}
+	}
+}
+
+func TestTLSSessionResumption(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	for _, cacheSize := range []int{0, 8} {
+		spec := &Spec{
+			TLS:    &TLSSpec{InsecureSkipVerify: true, SessionCacheSize: cacheSize},
+			Client: &ClientSpec{DisableKeepAlives: true},
+		}
+		client := newClient(spec)
+		stats := newTLSStats(client.Transport.(*http.Transport).TLSClientConfig)
+
+		for i := 0; i < 3; i++ {
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			resp.Body.Close()
+		}
+
+		status := stats.status()
+		if status.Handshakes != 3 {
+			t.Errorf("cache size %d: expect 3 handshakes, got %d", cacheSize, status.Handshakes)
+		}
+		if cacheSize == 0 && status.Resumed != 0 {
+			t.Errorf("expect no resumed session without session cache, got %d", status.Resumed)
+		}
+		if cacheSize > 0 && status.Resumed != 2 {
+			t.Errorf("expect 2 resumed sessions, got %d", status.Resumed)
+		}
+	}
+}
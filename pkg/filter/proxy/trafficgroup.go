@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/codecounter"
+	"github.com/megaease/easegress/pkg/util/urlrule"
+)
+
+type (
+	// TrafficGroupSpec describes a named group of the servers of the pool,
+	// e.g. main and canary, which are picked by tags. The requests
+	// matching the headers and cookies of a group go to it, the others
+	// are split among the groups by the weights.
+	TrafficGroupSpec struct {
+		Name        string   `yaml:"name" jsonschema:"required"`
+		ServersTags []string `yaml:"serversTags" jsonschema:"required,minItems=1,uniqueItems=true"`
+		// Weight is the percentage of the traffic to the group.
+		Weight  int                             `yaml:"weight" jsonschema:"omitempty,minimum=0,maximum=100"`
+		Headers map[string]*urlrule.StringMatch `yaml:"headers,omitempty" jsonschema:"omitempty"`
+		Cookies map[string]*urlrule.StringMatch `yaml:"cookies,omitempty" jsonschema:"omitempty"`
+	}
+
+	trafficGroups struct {
+		groups []*trafficGroup
+	}
+
+	trafficGroup struct {
+		spec *TrafficGroupSpec
+
+		mutex sync.Mutex
+		codes *codecounter.CodeCounter
+	}
+)
+
+func validateTrafficGroups(groups []*TrafficGroupSpec) error {
+	if len(groups) == 0 {
+		return nil
+	}
+
+	names := map[string]bool{}
+	weights := 0
+	for _, group := range groups {
+		if names[group.Name] {
+			return fmt.Errorf("traffic group %s is duplicated", group.Name)
+		}
+		names[group.Name] = true
+		weights += group.Weight
+	}
+
+	if weights != 100 {
+		return fmt.Errorf("sum of weights of traffic groups is %d, not 100", weights)
+	}
+
+	return nil
+}
+
+func newTrafficGroups(specs []*TrafficGroupSpec) *trafficGroups {
+	tg := &trafficGroups{}
+	for _, spec := range specs {
+		for _, sm := range spec.Headers {
+			sm.Init()
+		}
+		for _, sm := range spec.Cookies {
+			sm.Init()
+		}
+		tg.groups = append(tg.groups, &trafficGroup{
+			spec:  spec,
+			codes: codecounter.New(),
+		})
+	}
+
+	return tg
+}
+
+// pick returns the index of the group for the request, the groups
+// matching the request take precedence over the weights.
+func (tg *trafficGroups) pick(ctx context.HTTPContext) int {
+	for i, group := range tg.groups {
+		if group.match(ctx) {
+			return i
+		}
+	}
+
+	n := rand.Intn(100)
+	for i, group := range tg.groups {
+		n -= group.spec.Weight
+		if n < 0 {
+			return i
+		}
+	}
+
+	// NOTE: Unreachable since the sum of weights is 100.
+	return len(tg.groups) - 1
+}
+
+func (tg *trafficGroups) name(index int) string {
+	return tg.groups[index].spec.Name
+}
+
+func (tg *trafficGroups) count(index, code int) {
+	group := tg.groups[index]
+	group.mutex.Lock()
+	group.codes.Count(code)
+	group.mutex.Unlock()
+}
+
+func (tg *trafficGroups) status() map[string]map[int]uint64 {
+	status := make(map[string]map[int]uint64, len(tg.groups))
+	for _, group := range tg.groups {
+		group.mutex.Lock()
+		status[group.spec.Name] = group.codes.Codes()
+		group.mutex.Unlock()
+	}
+	return status
+}
+
+// match reports whether the request matches all headers and cookies of
+// the group, the group without them matches nothing.
+func (g *trafficGroup) match(ctx context.HTTPContext) bool {
+	if len(g.spec.Headers) == 0 && len(g.spec.Cookies) == 0 {
+		return false
+	}
+
+	req := ctx.Request()
+	for name, sm := range g.spec.Headers {
+		if !sm.Match(req.Header().Get(name)) {
+			return false
+		}
+	}
+	for name, sm := range g.spec.Cookies {
+		cookie, err := req.Cookie(name)
+		if err != nil || cookie == nil || !sm.Match(cookie.Value) {
+			return false
+		}
+	}
+
+	return true
+}
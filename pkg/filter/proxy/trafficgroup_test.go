@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/urlrule"
+)
+
+func TestTrafficGroups(t *testing.T) {
+	main := &Server{URL: "http://127.0.0.1:9090", Tags: []string{"main"}}
+	canary := &Server{URL: "http://127.0.0.1:9091", Tags: []string{"canary"}}
+	groups := []*TrafficGroupSpec{
+		{Name: "main", ServersTags: []string{"main"}, Weight: 90},
+		{
+			Name:        "canary",
+			ServersTags: []string{"canary"},
+			Weight:      10,
+			Headers:     map[string]*urlrule.StringMatch{"X-Canary": {Exact: "true"}},
+			Cookies:     map[string]*urlrule.StringMatch{"user": {Prefix: "beta-"}},
+		},
+	}
+	spec := &PoolSpec{
+		LoadBalance:   &LoadBalance{Policy: PolicyRoundRobin},
+		Servers:       []*Server{main, canary},
+		TrafficGroups: groups,
+	}
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s := &servers{poolSpec: spec}
+	s.useStaticServers()
+	tg := newTrafficGroups(groups)
+
+	header := http.Header{}
+	cookies := map[string]string{}
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(header)
+	}
+	ctx.MockedRequest.MockedCookie = func(name string) (*http.Cookie, error) {
+		if v, ok := cookies[name]; ok {
+			return &http.Cookie{Name: name, Value: v}, nil
+		}
+		return nil, http.ErrNoCookie
+	}
+
+	picks := map[*Server]int{}
+	for i := 0; i < 10000; i++ {
+		group := tg.pick(ctx)
+		server, err := s.nextExcept(ctx, group, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		picks[server]++
+		tg.count(group, 200)
+	}
+	if picks[canary] < 700 || picks[canary] > 1300 {
+		t.Errorf("canary should get about 10%% traffic, got %d", picks[canary])
+	}
+
+	// the header alone doesn't match
+	header.Set("X-Canary", "true")
+	if tg.groups[1].match(ctx) {
+		t.Errorf("the group should not match without the cookie")
+	}
+
+	cookies["user"] = "beta-1"
+	for i := 0; i < 10; i++ {
+		group := tg.pick(ctx)
+		if group != 1 {
+			t.Fatalf("want group canary, got %s", tg.name(group))
+		}
+		if server, _ := s.nextExcept(ctx, group, nil); server != canary {
+			t.Fatalf("want %s, got %s", canary.URL, server.URL)
+		}
+	}
+
+	status := tg.status()
+	if status["main"][200]+status["canary"][200] != 10000 {
+		t.Errorf("unexpected status: %v", status)
+	}
+
+	// falls back to all servers if the group has no available server
+	s.setDown(map[string]bool{canary.URL: true})
+	if server, _ := s.nextExcept(ctx, 1, nil); server != main {
+		t.Errorf("want %s, got %s", main.URL, server.URL)
+	}
+
+	groups[1].Weight = 20
+	if spec.Validate() == nil {
+		t.Errorf("validate should fail for the sum of weights")
+	}
+	groups[1].Weight = 10
+	groups[1].Name = "main"
+	if spec.Validate() == nil {
+		t.Errorf("validate should fail for the duplicated name")
+	}
+	groups[1].Name = "canary"
+	groups[1].ServersTags = []string{"nothing"}
+	if spec.Validate() == nil {
+		t.Errorf("validate should fail for the group without server")
+	}
+}
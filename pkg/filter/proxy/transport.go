@@ -0,0 +1,187 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+)
+
+// transportStatsMap holds the transportStats of the servers keyed by
+// their URLs, so the statistics of the connections shared by the
+// proxies and their generations are accurate.
+var transportStatsMap sync.Map
+
+type (
+	// TransportStatus is the status of the connections to a server.
+	TransportStatus struct {
+		OpenConns   int64  `yaml:"openConns"`
+		IdleConns   int64  `yaml:"idleConns"`
+		Dials       uint64 `yaml:"dials"`
+		DialErrors  uint64 `yaml:"dialErrors"`
+		NewConns    uint64 `yaml:"newConns"`
+		ReusedConns uint64 `yaml:"reusedConns"`
+	}
+
+	transportStats struct {
+		openConns   int64
+		idleConns   int64
+		dials       uint64
+		dialErrors  uint64
+		newConns    uint64
+		reusedConns uint64
+	}
+
+	transportStatsKey struct{}
+
+	dialFunc = func(ctx stdcontext.Context, network, addr string) (net.Conn, error)
+
+	// trackedConn is the connection counted in the transportStats of
+	// the server using it.
+	trackedConn struct {
+		net.Conn
+
+		mutex  sync.Mutex
+		stats  *transportStats
+		idle   bool
+		closed bool
+	}
+)
+
+func transportStatsOf(url string) *transportStats {
+	v, _ := transportStatsMap.LoadOrStore(url, &transportStats{})
+	return v.(*transportStats)
+}
+
+func (ts *transportStats) status() *TransportStatus {
+	return &TransportStatus{
+		OpenConns:   atomic.LoadInt64(&ts.openConns),
+		IdleConns:   atomic.LoadInt64(&ts.idleConns),
+		Dials:       atomic.LoadUint64(&ts.dials),
+		DialErrors:  atomic.LoadUint64(&ts.dialErrors),
+		NewConns:    atomic.LoadUint64(&ts.newConns),
+		ReusedConns: atomic.LoadUint64(&ts.reusedConns),
+	}
+}
+
+// withTransportTrace returns the context tracing the connections of the
+// request to the server of the stats.
+func withTransportTrace(ctx stdcontext.Context, stats *transportStats) stdcontext.Context {
+	var conn *trackedConn
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddUint64(&stats.reusedConns, 1)
+			} else {
+				atomic.AddUint64(&stats.newConns, 1)
+			}
+			conn = asTrackedConn(info.Conn)
+			if conn != nil {
+				conn.use(stats)
+			}
+		},
+		PutIdleConn: func(err error) {
+			if err == nil && conn != nil {
+				conn.putIdle()
+			}
+		},
+	}
+
+	ctx = stdcontext.WithValue(ctx, transportStatsKey{}, stats)
+	return httptrace.WithClientTrace(ctx, trace)
+}
+
+// trackConns wraps the dial function to track the connections, the dials
+// are counted for the server of the context if there is one, otherwise
+// the connection is counted for the server using it first.
+func trackConns(dial dialFunc) dialFunc {
+	return func(ctx stdcontext.Context, network, addr string) (net.Conn, error) {
+		stats, _ := ctx.Value(transportStatsKey{}).(*transportStats)
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			if stats != nil {
+				atomic.AddUint64(&stats.dials, 1)
+				atomic.AddUint64(&stats.dialErrors, 1)
+			}
+			return nil, err
+		}
+
+		tc := &trackedConn{Conn: conn}
+		if stats != nil {
+			tc.use(stats)
+		}
+		return tc, nil
+	}
+}
+
+func asTrackedConn(conn net.Conn) *trackedConn {
+	// NOTE: The TLS connections wrap the dialed ones.
+	if c, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		conn = c.NetConn()
+	}
+	tc, _ := conn.(*trackedConn)
+	return tc
+}
+
+// use marks the connection in use by the server of the stats.
+func (c *trackedConn) use(stats *transportStats) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return
+	}
+	if c.stats == nil {
+		c.stats = stats
+		atomic.AddUint64(&stats.dials, 1)
+		atomic.AddInt64(&stats.openConns, 1)
+	}
+	if c.idle {
+		c.idle = false
+		atomic.AddInt64(&c.stats.idleConns, -1)
+	}
+}
+
+// putIdle marks the connection idle in the pool of the transport.
+func (c *trackedConn) putIdle() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed || c.stats == nil || c.idle {
+		return
+	}
+	c.idle = true
+	atomic.AddInt64(&c.stats.idleConns, 1)
+}
+
+func (c *trackedConn) Close() error {
+	c.mutex.Lock()
+	if !c.closed && c.stats != nil {
+		atomic.AddInt64(&c.stats.openConns, -1)
+		if c.idle {
+			atomic.AddInt64(&c.stats.idleConns, -1)
+		}
+	}
+	c.closed, c.idle = true, false
+	c.mutex.Unlock()
+
+	return c.Conn.Close()
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTransportStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	client := newClient(&Spec{Client: &ClientSpec{}})
+	defer client.CloseIdleConnections()
+
+	stats := &transportStats{}
+	for i := 0; i < 3; i++ {
+		ctx := withTransportTrace(stdcontext.Background(), stats)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	want := TransportStatus{OpenConns: 1, IdleConns: 1, Dials: 1, NewConns: 1, ReusedConns: 2}
+	if got := *stats.status(); got != want {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+
+	client.CloseIdleConnections()
+	if got := stats.status(); got.OpenConns != 0 || got.IdleConns != 0 {
+		t.Errorf("want no connections after closing, got %+v", got)
+	}
+
+	// dial the closed port
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	l.Close()
+
+	ctx := withTransportTrace(stdcontext.Background(), stats)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr, nil)
+	if _, err := client.Do(req); err == nil {
+		t.Fatal("want dial error")
+	}
+	if got := stats.status(); got.Dials != 2 || got.DialErrors != 1 {
+		t.Errorf("want 2 dials and 1 error, got %+v", got)
+	}
+}
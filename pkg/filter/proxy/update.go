@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Update applies the servers and the load balance of the pools in spec to
+// the proxy in place, the clients, the statistics and the in-flight
+// requests are preserved. It returns an error if spec changes any other
+// option, the proxy has to be recreated for it then.
+func (b *Proxy) Update(spec *Spec) error {
+	if !reflect.DeepEqual(b.spec.withoutServers(), spec.withoutServers()) {
+		return fmt.Errorf("options other than servers and load balance changed")
+	}
+	if b.h2Client == nil && spec.usesHTTP2() {
+		return fmt.Errorf("servers requiring HTTP/2 added")
+	}
+	if b.ppClient == nil && spec.usesProxyProtocol() {
+		return fmt.Errorf("servers requiring PROXY protocol added")
+	}
+	if b.sniClients == nil && spec.usesSNI() {
+		return fmt.Errorf("servers overriding SNI added")
+	}
+
+	pools := b.pools()
+	for i, poolSpec := range spec.poolSpecs() {
+		pools[i].servers.update(poolSpec)
+	}
+
+	return nil
+}
+
+// poolSpecs returns the specs of all pools in the order of Proxy.pools.
+func (s *Spec) poolSpecs() []*PoolSpec {
+	pools := []*PoolSpec{s.MainPool}
+	pools = append(pools, s.CandidatePools...)
+	if s.MirrorPool != nil {
+		pools = append(pools, s.MirrorPool)
+	}
+	if s.Failover != nil {
+		pools = append(pools, s.Failover.Pools...)
+	}
+	return pools
+}
+
+// withoutServers returns a copy of the spec whose pools have neither
+// servers nor load balance.
+func (s *Spec) withoutServers() *Spec {
+	spec := *s
+	spec.MainPool = s.MainPool.withoutServers()
+	spec.MirrorPool = s.MirrorPool.withoutServers()
+
+	spec.CandidatePools = nil
+	for _, p := range s.CandidatePools {
+		spec.CandidatePools = append(spec.CandidatePools, p.withoutServers())
+	}
+
+	if s.Failover != nil {
+		failover := *s.Failover
+		failover.Pools = nil
+		for _, p := range s.Failover.Pools {
+			failover.Pools = append(failover.Pools, p.withoutServers())
+		}
+		spec.Failover = &failover
+	}
+
+	return &spec
+}
+
+func (s *PoolSpec) withoutServers() *PoolSpec {
+	if s == nil {
+		return nil
+	}
+
+	spec := *s
+	spec.Servers, spec.LoadBalance = nil, nil
+	return &spec
+}
+
+// update replaces the pool spec and uses its servers at once. The servers
+// not changed are carried over to keep their in-flight requests counted.
+func (s *servers) update(poolSpec *PoolSpec) {
+	s.mutex.Lock()
+	previous := make(map[string]*Server, len(s.poolSpec.Servers))
+	for _, server := range s.poolSpec.Servers {
+		previous[server.URL] = server
+	}
+	for i, server := range poolSpec.Servers {
+		p := previous[server.URL]
+		if p != nil && p.String() == server.String() &&
+			p.Protocol == server.Protocol && p.Priority == server.Priority &&
+			p.ProxyProtocol == server.ProxyProtocol &&
+			p.HostHeader == server.HostHeader && p.SNI == server.SNI {
+			poolSpec.Servers[i] = p
+		}
+	}
+	s.poolSpec = poolSpec
+	s.mutex.Unlock()
+
+	switch {
+	case poolSpec.DNS != nil:
+		select {
+		case s.updated <- struct{}{}:
+		default:
+		}
+	case s.groupWatcher != nil:
+		s.useGroup()
+	case s.serviceRegistry != nil:
+		s.tryUseService()
+	default:
+		s.useStaticServers()
+	}
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/yamltool"
+)
+
+func newUpdateFilterSpec(t *testing.T, servers, policy, extra string) *httppipeline.FilterSpec {
+	yamlSpec := fmt.Sprintf(`
+name: proxy
+kind: Proxy
+mainPool:
+  servers:
+%s
+  loadBalance:
+    policy: %s
+%s`, servers, policy, extra)
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, e := httppipeline.NewFilterSpec(rawSpec, nil)
+	if e != nil {
+		t.Fatalf("unexpected error: %v", e)
+	}
+	return spec
+}
+
+func TestProxyUpdate(t *testing.T) {
+	spec := newUpdateFilterSpec(t, `
+  - url: http://127.0.0.1:9095
+  - url: http://127.0.0.1:9096`, "roundRobin", "")
+	proxy := &Proxy{}
+	proxy.Init(spec)
+
+	kept := proxy.mainPool.servers.snapshot().servers[0]
+	kept.acquire()
+	pool := proxy.mainPool
+
+	next := &Proxy{}
+	next.Inherit(newUpdateFilterSpec(t, `
+  - url: http://127.0.0.1:9095
+  - url: http://127.0.0.1:9097`, "random", ""), proxy)
+
+	if next.mainPool != pool {
+		t.Fatalf("the pool should be taken over")
+	}
+	static := next.mainPool.servers.snapshot()
+	if static.lb.Policy != PolicyRandom {
+		t.Errorf("want policy %s, got %s", PolicyRandom, static.lb.Policy)
+	}
+	if static.len() != 2 || static.servers[1].URL != "http://127.0.0.1:9097" {
+		t.Errorf("servers are not updated: %v", static.servers)
+	}
+	if static.servers[0] != kept || kept.inflightRequests() != 1 {
+		t.Errorf("the server not changed should keep its counter")
+	}
+
+	last := &Proxy{}
+	last.Inherit(newUpdateFilterSpec(t, `
+  - url: http://127.0.0.1:9095`, "random", "failureCodes: [503]"), next)
+	if last.mainPool == pool {
+		t.Errorf("the proxy should be recreated for other options")
+	}
+	last.Close()
+}
+
+func TestProxyUpdateDNS(t *testing.T) {
+	s := &servers{
+		poolSpec: &PoolSpec{
+			Servers:     []*Server{{URL: "http://127.0.0.1:9095"}},
+			LoadBalance: &LoadBalance{Policy: PolicyRoundRobin},
+			DNS:         &DNSSpec{},
+		},
+		done:    make(chan struct{}),
+		updated: make(chan struct{}, 1),
+	}
+	s.useStaticServers()
+
+	resolver := &fakeDNSResolver{}
+	go s.watchDNS(resolver)
+	defer s.close()
+
+	s.update(&PoolSpec{
+		Servers:     []*Server{{URL: "http://127.0.0.1:9096"}},
+		LoadBalance: &LoadBalance{Policy: PolicyRoundRobin},
+		DNS:         &DNSSpec{},
+	})
+
+	for i := 0; i < 100; i++ {
+		if static := s.snapshot(); static.servers[0].URL == "http://127.0.0.1:9096" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("the DNS watcher should use the updated servers at once")
+}
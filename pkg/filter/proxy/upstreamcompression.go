@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+type (
+	// UpstreamCompressionSpec describes the compression between the
+	// proxy and the servers.
+	UpstreamCompressionSpec struct {
+		// GzipRequestBody compresses the request bodies which are not
+		// encoded yet by gzip.
+		GzipRequestBody bool `yaml:"gzipRequestBody" jsonschema:"omitempty"`
+		// AcceptEncoding overrides Accept-Encoding of the requests to
+		// the servers, e.g. identity to get the plain responses.
+		AcceptEncoding string `yaml:"acceptEncoding,omitempty" jsonschema:"omitempty"`
+		// DecompressResponse decompresses the gzip responses, so the
+		// subsequent filters get the plain bodies.
+		DecompressResponse bool `yaml:"decompressResponse" jsonschema:"omitempty"`
+	}
+
+	// gunzipBody decompresses the body at the first read, so a broken
+	// body fails the reading instead of the request.
+	gunzipBody struct {
+		body io.ReadCloser
+		zr   *gzip.Reader
+		err  error
+	}
+)
+
+// prepareRequest sets Accept-Encoding and compresses the body of the
+// request to the server, its header must not be shared.
+func (spec *UpstreamCompressionSpec) prepareRequest(req *http.Request, hasBody bool) {
+	if spec.AcceptEncoding != "" {
+		req.Header.Set(httpheader.KeyAcceptEncoding, spec.AcceptEncoding)
+	}
+
+	if !spec.GzipRequestBody || !hasBody || req.Body == nil || req.Body == http.NoBody {
+		return
+	}
+	if req.Header.Get(httpheader.KeyContentEncoding) != "" {
+		return
+	}
+
+	req.Body = ioutil.NopCloser(newGzipBody(req.Body))
+	req.GetBody = nil
+	req.ContentLength = -1
+	req.Header.Set(httpheader.KeyContentEncoding, "gzip")
+	req.Header.Del(httpheader.KeyContentLength)
+}
+
+// prepareResponse decompresses the gzip response from the server.
+func (spec *UpstreamCompressionSpec) prepareResponse(resp *http.Response) {
+	if !spec.DecompressResponse || resp.Body == nil || resp.Body == http.NoBody {
+		return
+	}
+	if !strings.EqualFold(resp.Header.Get(httpheader.KeyContentEncoding), "gzip") {
+		return
+	}
+
+	resp.Body = &gunzipBody{body: resp.Body}
+	resp.ContentLength = -1
+	resp.Header.Del(httpheader.KeyContentEncoding)
+	resp.Header.Del(httpheader.KeyContentLength)
+}
+
+func (gb *gunzipBody) Read(p []byte) (int, error) {
+	if gb.zr == nil && gb.err == nil {
+		gb.zr, gb.err = gzip.NewReader(gb.body)
+	}
+	if gb.err != nil {
+		return 0, gb.err
+	}
+
+	return gb.zr.Read(p)
+}
+
+func (gb *gunzipBody) Close() error {
+	return gb.body.Close()
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+)
+
+func TestUpstreamCompression(t *testing.T) {
+	body := strings.Repeat("easegress ", 10000)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ce := r.Header.Get("Content-Encoding"); ce != "gzip" {
+			t.Errorf("want request encoded by gzip, got %q", ce)
+		}
+		if ae := r.Header.Get("Accept-Encoding"); ae != "gzip" {
+			t.Errorf("want Accept-Encoding gzip, got %q", ae)
+		}
+
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("read gzip request failed: %v", err)
+			return
+		}
+		data, _ := ioutil.ReadAll(zr)
+		if string(data) != body {
+			t.Errorf("request body mismatched: %d bytes", len(data))
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		zw.Write(data)
+		zw.Close()
+	}))
+	defer server.Close()
+
+	spec := &UpstreamCompressionSpec{
+		GzipRequestBody:    true,
+		AcceptEncoding:     "gzip",
+		DecompressResponse: true,
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader([]byte(body)))
+	spec.prepareRequest(req, true)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	spec.prepareResponse(resp)
+	if ce := resp.Header.Get("Content-Encoding"); ce != "" {
+		t.Errorf("want response decompressed, got Content-Encoding %q", ce)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read response failed: %v", err)
+	}
+	if string(data) != body {
+		t.Errorf("response body mismatched: %d bytes", len(data))
+	}
+}
+
+func TestUpstreamCompressionSkip(t *testing.T) {
+	spec := &UpstreamCompressionSpec{GzipRequestBody: true, DecompressResponse: true}
+
+	req, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1", strings.NewReader("data"))
+	req.Header.Set("Content-Encoding", "br")
+	spec.prepareRequest(req, true)
+	if req.Header.Get("Content-Encoding") != "br" || req.ContentLength != 4 {
+		t.Errorf("the encoded request body should be untouched")
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "http://127.0.0.1", nil)
+	spec.prepareRequest(req, false)
+	if req.Header.Get("Content-Encoding") != "" {
+		t.Errorf("the request without body should be untouched")
+	}
+
+	resp := &http.Response{Header: http.Header{"Content-Encoding": []string{"gzip"}}, Body: http.NoBody}
+	spec.prepareResponse(resp)
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Errorf("the response without body should be untouched")
+	}
+}
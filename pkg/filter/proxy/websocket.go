@@ -0,0 +1,252 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/httpstat"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+type (
+	// WebSocketSpec describes the WebSocket connections proxied to the
+	// servers, the upgraded connections are tunneled to the servers
+	// until either side closes them.
+	WebSocketSpec struct {
+		// IdleTimeout closes the connections without data in either
+		// direction for the duration, they are never closed for being
+		// idle if it's empty.
+		IdleTimeout string `yaml:"idleTimeout,omitempty" jsonschema:"omitempty,format=duration"`
+		// MaxConnections is the max number of the WebSocket connections,
+		// the ones beyond it are rejected with 503, it's unlimited if
+		// it's zero.
+		MaxConnections int32 `yaml:"maxConnections,omitempty" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// WebSocketStatus is the status of the WebSocket connections.
+	WebSocketStatus struct {
+		Connections int32  `yaml:"connections"`
+		Rejected    uint64 `yaml:"rejected"`
+	}
+
+	webSocket struct {
+		spec        *WebSocketSpec
+		idleTimeout time.Duration
+
+		connections int32
+		rejected    uint64
+	}
+
+	// bufferedConn is the hijacked connection of the client, whose data
+	// may have been buffered by the HTTP server.
+	bufferedConn struct {
+		net.Conn
+		r *bufio.Reader
+	}
+)
+
+// Validate validates WebSocketSpec.
+func (spec WebSocketSpec) Validate() error {
+	if spec.MaxConnections < 0 {
+		return fmt.Errorf("maxConnections must not be negative")
+	}
+	return nil
+}
+
+func newWebSocket(spec *WebSocketSpec) *webSocket {
+	if spec == nil {
+		spec = &WebSocketSpec{}
+	}
+	ws := &webSocket{spec: spec}
+	// NOTE: It has been validated by format=duration.
+	ws.idleTimeout, _ = time.ParseDuration(spec.IdleTimeout)
+	return ws
+}
+
+// acquire counts a new connection, it returns false if the connections
+// reach the limit.
+func (ws *webSocket) acquire() bool {
+	n := atomic.AddInt32(&ws.connections, 1)
+	if ws.spec.MaxConnections > 0 && n > ws.spec.MaxConnections {
+		atomic.AddInt32(&ws.connections, -1)
+		atomic.AddUint64(&ws.rejected, 1)
+		return false
+	}
+	return true
+}
+
+func (ws *webSocket) release() {
+	atomic.AddInt32(&ws.connections, -1)
+}
+
+func (ws *webSocket) status() *WebSocketStatus {
+	return &WebSocketStatus{
+		Connections: atomic.LoadInt32(&ws.connections),
+		Rejected:    atomic.LoadUint64(&ws.rejected),
+	}
+}
+
+// isWebSocketRequest reports whether the request asks for upgrading the
+// connection to WebSocket.
+func isWebSocketRequest(ctx context.HTTPContext) bool {
+	h := ctx.Request().Header()
+	if !strings.EqualFold(h.Get(httpheader.KeyUpgrade), "websocket") {
+		return false
+	}
+	for _, v := range strings.Split(h.Get(httpheader.KeyConnection), ",") {
+		if strings.EqualFold(strings.TrimSpace(v), "upgrade") {
+			return true
+		}
+	}
+	return false
+}
+
+// serveWebSocket hijacks the connection of the client and tunnels it to
+// the upgraded connection of the server, it blocks until the tunnel ends.
+func (p *pool) serveWebSocket(ctx context.HTTPContext, group int, req *request,
+	resp *http.Response, upstream io.ReadWriteCloser, span tracing.Span) string {
+
+	defer p.release(req.server)
+
+	ctx.Lock()
+	ctx.Response().SetStatusCode(resp.StatusCode)
+	ctx.Response().Header().AddFromStd(resp.Header)
+	conn, brw, err := ctx.Response().Hijack()
+	if err != nil {
+		ctx.SetKV(stringtool.Cat(p.tagPrefix, "#hijackErr"), err.Error())
+		ctx.Response().SetStatusCode(http.StatusInternalServerError)
+	}
+	ctx.Unlock()
+
+	if err != nil {
+		upstream.Close()
+		req.finish()
+		span.Finish()
+		return resultInternalError
+	}
+
+	var client net.Conn = conn
+	if brw.Reader.Buffered() > 0 {
+		client = &bufferedConn{Conn: conn, r: brw.Reader}
+	}
+
+	head := bytes.NewBuffer(nil)
+	fmt.Fprintf(head, "HTTP/1.1 %d %s\r\n", resp.StatusCode, http.StatusText(resp.StatusCode))
+	resp.Header.Write(head)
+	head.WriteString("\r\n")
+
+	var sent, received int64
+	if _, err = client.Write(head.Bytes()); err != nil {
+		client.Close()
+		upstream.Close()
+	} else {
+		sent, received = tunnel(client, upstream, p.webSocket.idleTimeout)
+	}
+
+	req.finish()
+	span.Finish()
+
+	ctx.Lock()
+	ctx.SetKV(stringtool.Cat(p.tagPrefix, "#duration"), req.total())
+	ctx.SetKV(context.KeyBackendDuration, req.total())
+	ctx.Unlock()
+
+	p.httpStat.Stat(&httpstat.Metric{
+		StatusCode: resp.StatusCode,
+		Duration:   req.total(),
+		ReqSize:    ctx.Request().Size() + uint64(sent),
+		RespSize:   uint64(responseMetaSize(resp)) + uint64(received),
+	})
+	if group >= 0 {
+		p.groups.count(group, resp.StatusCode)
+	}
+
+	return ""
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// tunnel copies the data between the client and the server until one
+// of them is closed or the tunnel is idle for idleTimeout, it returns
+// the bytes sent to the server and the client.
+func tunnel(client net.Conn, server io.ReadWriteCloser, idleTimeout time.Duration) (sent, received int64) {
+	var closeOnce sync.Once
+	closeBoth := func() {
+		closeOnce.Do(func() {
+			client.Close()
+			server.Close()
+		})
+	}
+
+	var idle *time.Timer
+	if idleTimeout > 0 {
+		idle = time.AfterFunc(idleTimeout, closeBoth)
+		defer idle.Stop()
+	}
+
+	pipe := func(dst io.Writer, src io.Reader, written *int64) {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := src.Read(buf)
+			if n > 0 {
+				if idle != nil {
+					idle.Reset(idleTimeout)
+				}
+				if _, werr := dst.Write(buf[:n]); werr != nil {
+					break
+				}
+				*written += int64(n)
+			}
+			if err != nil {
+				break
+			}
+		}
+		// NOTE: WebSocket has its own closing handshake, so there is no
+		// half-closed connection, the tunnel ends once either side ends.
+		closeBoth()
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		pipe(server, client, &sent)
+	}()
+	go func() {
+		defer wg.Done()
+		pipe(client, server, &received)
+	}()
+	wg.Wait()
+
+	return sent, received
+}
@@ -0,0 +1,236 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/yamltool"
+)
+
+func newWebSocketEchoServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("hijack failed: %v", err)
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		brw.Flush()
+		io.Copy(conn, brw)
+	}))
+}
+
+func newWebSocketProxy(t *testing.T, url, extra string) *Proxy {
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		return client.Do(r)
+	}
+
+	yamlSpec := fmt.Sprintf(`
+name: proxy
+kind: Proxy
+mainPool:
+  servers:
+  - url: %s
+  loadBalance:
+    policy: roundRobin
+%s`, url, extra)
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, e := httppipeline.NewFilterSpec(rawSpec, nil)
+	if e != nil {
+		t.Fatalf("unexpected error: %v", e)
+	}
+
+	proxy := &Proxy{}
+	proxy.Init(spec)
+	return proxy
+}
+
+// newWebSocketContext returns a context of a WebSocket request, whose
+// connection is hijacked as the returned client side of a pipe.
+func newWebSocketContext() (*contexttest.MockedHTTPContext, net.Conn, *int) {
+	client, conn := net.Pipe()
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	statusCode := 0
+	header := http.Header{}
+
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedMethod = func() string {
+		return http.MethodGet
+	}
+	ctx.MockedRequest.MockedPath = func() string {
+		return "/chat"
+	}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(http.Header{
+			"Connection": []string{"Upgrade"},
+			"Upgrade":    []string{"websocket"},
+		})
+	}
+	ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(header)
+	}
+	ctx.MockedResponse.MockedSetStatusCode = func(code int) {
+		statusCode = code
+	}
+	ctx.MockedResponse.MockedStatusCode = func() int {
+		return statusCode
+	}
+	ctx.MockedResponse.MockedHijack = func() (net.Conn, *bufio.ReadWriter, error) {
+		return conn, bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)), nil
+	}
+	return ctx, client, &statusCode
+}
+
+func TestWebSocket(t *testing.T) {
+	server := newWebSocketEchoServer(t)
+	defer server.Close()
+
+	proxy := newWebSocketProxy(t, server.URL, `
+timeout:
+  request: 100ms
+`)
+	defer proxy.Close()
+
+	ctx, client, statusCode := newWebSocketContext()
+	done := make(chan string)
+	go func() {
+		done <- proxy.handle(ctx)
+	}()
+
+	br := bufio.NewReader(client)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("read response failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("want %d, got %d", http.StatusSwitchingProtocols, resp.StatusCode)
+	}
+
+	// The tunnel outlives the request timeout.
+	time.Sleep(200 * time.Millisecond)
+
+	client.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err = io.ReadFull(br, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("unexpected echo: %q, %v", buf, err)
+	}
+	if got := proxy.webSocket.status().Connections; got != 1 {
+		t.Errorf("want 1 connection, got %d", got)
+	}
+
+	client.Close()
+	select {
+	case result := <-done:
+		if result != "" {
+			t.Errorf("unexpected result %q", result)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("tunnel should be closed with the client")
+	}
+	if *statusCode != http.StatusSwitchingProtocols {
+		t.Errorf("want %d, got %d", http.StatusSwitchingProtocols, *statusCode)
+	}
+	if got := proxy.webSocket.status().Connections; got != 0 {
+		t.Errorf("want 0 connections, got %d", got)
+	}
+}
+
+func TestWebSocketLimits(t *testing.T) {
+	server := newWebSocketEchoServer(t)
+	defer server.Close()
+
+	proxy := newWebSocketProxy(t, server.URL, `
+webSocket:
+  idleTimeout: 200ms
+  maxConnections: 1
+`)
+	defer proxy.Close()
+
+	ctx, client, _ := newWebSocketContext()
+	defer client.Close()
+	done := make(chan string)
+	go func() {
+		done <- proxy.handle(ctx)
+	}()
+	if _, err := http.ReadResponse(bufio.NewReader(client), nil); err != nil {
+		t.Fatalf("read response failed: %v", err)
+	}
+
+	ctx2, client2, statusCode := newWebSocketContext()
+	defer client2.Close()
+	if result := proxy.handle(ctx2); result != resultServerError {
+		t.Errorf("want result %q, got %q", resultServerError, result)
+	}
+	if *statusCode != http.StatusServiceUnavailable {
+		t.Errorf("want %d, got %d", http.StatusServiceUnavailable, *statusCode)
+	}
+
+	// The idle tunnel is closed.
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("idle tunnel should be closed")
+	}
+
+	status := proxy.Status().(*Status).WebSocket
+	if status.Connections != 0 || status.Rejected != 1 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
+
+func TestIsWebSocketRequest(t *testing.T) {
+	cases := []struct {
+		connection, upgrade string
+		want                bool
+	}{
+		{"Upgrade", "websocket", true},
+		{"keep-alive, upgrade", "WebSocket", true},
+		{"keep-alive", "websocket", false},
+		{"Upgrade", "h2c", false},
+	}
+	for _, c := range cases {
+		ctx := &contexttest.MockedHTTPContext{}
+		ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+			return httpheader.New(http.Header{
+				"Connection": []string{c.connection},
+				"Upgrade":    []string{c.upgrade},
+			})
+		}
+		if got := isWebSocketRequest(ctx); got != c.want {
+			t.Errorf("%s/%s: want %v, got %v", c.connection, c.upgrade, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+const (
+	defaultPenaltyHalfLife    = time.Minute
+	defaultPenaltyBanDuration = time.Minute
+	defaultPenaltyMaxBan      = time.Hour
+
+	// penaltyPruneInterval is the min interval of removing the idle clients.
+	penaltyPruneInterval = time.Minute
+	// penaltyIdleScore is the score below which a client is treated as idle.
+	penaltyIdleScore = 0.01
+)
+
+var defaultPenaltyStatusCodes = []int{
+	http.StatusUnauthorized,
+	http.StatusForbidden,
+	http.StatusNotFound,
+}
+
+type (
+	// PenaltySpec describes penalizing the clients which generate many
+	// responses of the status codes, e.g. credential stuffing generates
+	// 401 and enumeration generates 404. Every such response adds 1 to the
+	// score of the client, which decays by half every halfLife. The client
+	// is banned once the score reaches threshold, and every ban within
+	// maxBanDuration after the previous one doubles the duration.
+	PenaltySpec struct {
+		StatusCodes []int `yaml:"statusCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
+		// ClientHeader is the header identifying clients, the real IP is used if it's empty.
+		ClientHeader   string `yaml:"clientHeader" jsonschema:"omitempty"`
+		Threshold      int    `yaml:"threshold" jsonschema:"required,minimum=1"`
+		HalfLife       string `yaml:"halfLife" jsonschema:"omitempty,format=duration"`
+		BanDuration    string `yaml:"banDuration" jsonschema:"omitempty,format=duration"`
+		MaxBanDuration string `yaml:"maxBanDuration" jsonschema:"omitempty,format=duration"`
+	}
+
+	penalty struct {
+		spec           *PenaltySpec
+		statusCodes    map[int]struct{}
+		halfLife       time.Duration
+		banDuration    time.Duration
+		maxBanDuration time.Duration
+
+		mutex     sync.Mutex
+		clients   map[string]*penaltyClient
+		lastPrune time.Time
+	}
+
+	penaltyClient struct {
+		score       float64
+		updatedAt   time.Time
+		bannedUntil time.Time
+		// strikes is the number of bans in a row, it doubles the ban duration.
+		strikes int
+	}
+)
+
+func parseDurationOr(s string, d time.Duration) time.Duration {
+	if s == "" {
+		return d
+	}
+	// NOTE: It has been validated by format=duration.
+	result, _ := time.ParseDuration(s)
+	return result
+}
+
+func newPenalty(spec *PenaltySpec) *penalty {
+	p := &penalty{
+		spec:           spec,
+		statusCodes:    map[int]struct{}{},
+		halfLife:       parseDurationOr(spec.HalfLife, defaultPenaltyHalfLife),
+		banDuration:    parseDurationOr(spec.BanDuration, defaultPenaltyBanDuration),
+		maxBanDuration: parseDurationOr(spec.MaxBanDuration, defaultPenaltyMaxBan),
+		clients:        map[string]*penaltyClient{},
+		lastPrune:      time.Now(),
+	}
+
+	codes := spec.StatusCodes
+	if len(codes) == 0 {
+		codes = defaultPenaltyStatusCodes
+	}
+	for _, code := range codes {
+		p.statusCodes[code] = struct{}{}
+	}
+
+	return p
+}
+
+func (p *penalty) clientKey(ctx context.HTTPContext) string {
+	if p.spec.ClientHeader != "" {
+		if key := ctx.Request().Header().Get(p.spec.ClientHeader); key != "" {
+			return key
+		}
+	}
+	return ctx.Request().RealIP()
+}
+
+// banned returns the remaining duration of the ban of the client.
+func (p *penalty) banned(key string, now time.Time) (time.Duration, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	c := p.clients[key]
+	if c == nil || !now.Before(c.bannedUntil) {
+		return 0, false
+	}
+	return c.bannedUntil.Sub(now), true
+}
+
+// record records the response status code of the client, it returns
+// the duration of the ban if the client gets banned by the response.
+func (p *penalty) record(key string, code int, now time.Time) time.Duration {
+	if _, exists := p.statusCodes[code]; !exists {
+		return 0
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.prune(now)
+
+	c := p.clients[key]
+	if c == nil {
+		c = &penaltyClient{updatedAt: now}
+		p.clients[key] = c
+	}
+
+	// the responses of in-flight requests don't extend the ban.
+	if now.Before(c.bannedUntil) {
+		return 0
+	}
+	if c.strikes > 0 && now.Sub(c.bannedUntil) > p.maxBanDuration {
+		c.strikes = 0
+	}
+
+	c.score = p.decay(c, now) + 1
+	c.updatedAt = now
+	if c.score < float64(p.spec.Threshold) {
+		return 0
+	}
+
+	d := p.banDuration << uint(c.strikes)
+	if d > p.maxBanDuration || d <= 0 {
+		d = p.maxBanDuration
+	} else {
+		c.strikes++
+	}
+	c.score = 0
+	c.bannedUntil = now.Add(d)
+
+	return d
+}
+
+func (p *penalty) decay(c *penaltyClient, now time.Time) float64 {
+	elapsed := now.Sub(c.updatedAt)
+	if elapsed <= 0 || p.halfLife <= 0 {
+		return c.score
+	}
+	return c.score * math.Pow(0.5, float64(elapsed)/float64(p.halfLife))
+}
+
+// prune removes the clients which are neither banned nor remembered,
+// it must be called with the lock held.
+func (p *penalty) prune(now time.Time) {
+	if now.Sub(p.lastPrune) < penaltyPruneInterval {
+		return
+	}
+	p.lastPrune = now
+
+	for key, c := range p.clients {
+		if now.Sub(c.bannedUntil) > p.maxBanDuration && p.decay(c, now) < penaltyIdleScore {
+			delete(p.clients, key)
+		}
+	}
+}
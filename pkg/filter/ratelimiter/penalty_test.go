@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPenalty(t *testing.T) {
+	p := newPenalty(&PenaltySpec{
+		Threshold:      3,
+		HalfLife:       "10s",
+		BanDuration:    "1m",
+		MaxBanDuration: "3m",
+	})
+
+	now := time.Now()
+	const key = "192.168.1.1"
+
+	for i := 0; i < 10; i++ {
+		if d := p.record(key, http.StatusOK, now); d != 0 {
+			t.Fatalf("status 200 should not be penalized")
+		}
+	}
+
+	p.record(key, http.StatusNotFound, now)
+	p.record(key, http.StatusUnauthorized, now)
+	if _, banned := p.banned(key, now); banned {
+		t.Fatalf("client should not be banned below the threshold")
+	}
+
+	// the score decays to 0.5 after 2 half lives
+	now = now.Add(20 * time.Second)
+	p.record(key, http.StatusForbidden, now)
+	if _, banned := p.banned(key, now); banned {
+		t.Fatalf("client should not be banned after the score decays")
+	}
+
+	p.record(key, http.StatusForbidden, now)
+	if d := p.record(key, http.StatusForbidden, now); d != time.Minute {
+		t.Fatalf("client should be banned for 1m, but got %s", d)
+	}
+	if d, banned := p.banned(key, now.Add(30*time.Second)); !banned || d != 30*time.Second {
+		t.Fatalf("client should be banned for another 30s, but got %v %s", banned, d)
+	}
+	if _, banned := p.banned("192.168.1.2", now); banned {
+		t.Fatalf("other clients should not be banned")
+	}
+
+	// the ban is doubled for the next strike, and capped by maxBanDuration
+	now = now.Add(time.Minute)
+	for _, expected := range []time.Duration{2 * time.Minute, 3 * time.Minute} {
+		var d time.Duration
+		for i := 0; i < 3; i++ {
+			d = p.record(key, http.StatusNotFound, now)
+		}
+		if d != expected {
+			t.Fatalf("client should be banned for %s, but got %s", expected, d)
+		}
+		now = now.Add(d)
+	}
+
+	// the strikes are forgotten after maxBanDuration
+	now = now.Add(4 * time.Minute)
+	var d time.Duration
+	for i := 0; i < 3; i++ {
+		d = p.record(key, http.StatusNotFound, now)
+	}
+	if d != time.Minute {
+		t.Fatalf("client should be banned for 1m, but got %s", d)
+	}
+
+	// idle clients are pruned
+	now = now.Add(time.Hour)
+	p.record("192.168.1.2", http.StatusNotFound, now)
+	if _, exists := p.clients[key]; exists {
+		t.Fatalf("idle client should be pruned")
+	}
+}
@@ -19,14 +19,17 @@ package ratelimiter
 
 import (
 	"fmt"
+	"math"
 	"net/http"
 	"reflect"
+	"strconv"
 	"time"
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
 	librl "github.com/megaease/easegress/pkg/util/ratelimiter"
+	"github.com/megaease/easegress/pkg/util/rejection"
 	"github.com/megaease/easegress/pkg/util/urlrule"
 )
 
@@ -63,12 +66,18 @@ type (
 		Policies         []*Policy  `yaml:"policies" jsonschema:"required"`
 		DefaultPolicyRef string     `yaml:"defaultPolicyRef" jsonschema:"omitempty"`
 		URLs             []*URLRule `yaml:"urls" jsonschema:"required"`
+		// Penalty bans the clients generating many error responses.
+		Penalty *PenaltySpec `yaml:"penalty,omitempty" jsonschema:"omitempty"`
+		// RejectionResponse is the name of the RejectionResponse
+		// responded when the requests are rate limited.
+		RejectionResponse string `yaml:"rejectionResponse,omitempty" jsonschema:"omitempty,format=rejectionresponse"`
 	}
 
 	// RateLimiter defines the rate limiter
 	RateLimiter struct {
 		filterSpec *httppipeline.FilterSpec
 		spec       *Spec
+		penalty    *penalty
 	}
 )
 
@@ -196,6 +205,8 @@ func isSamePolicy(spec1, spec2 *Spec, policyName string) bool {
 }
 
 func (rl *RateLimiter) reload(previousGeneration *RateLimiter) {
+	rl.reloadPenalty(previousGeneration)
+
 	if previousGeneration == nil {
 		for _, u := range rl.spec.URLs {
 			rl.createRateLimiterForURL(u)
@@ -224,6 +235,21 @@ OuterLoop:
 	}
 }
 
+// reloadPenalty inherits the penalized clients if the penalty is not changed.
+func (rl *RateLimiter) reloadPenalty(previousGeneration *RateLimiter) {
+	if rl.spec.Penalty == nil {
+		return
+	}
+
+	if previousGeneration != nil && previousGeneration.penalty != nil &&
+		reflect.DeepEqual(rl.spec.Penalty, previousGeneration.spec.Penalty) {
+		rl.penalty = previousGeneration.penalty
+		return
+	}
+
+	rl.penalty = newPenalty(rl.spec.Penalty)
+}
+
 // Init initializes RateLimiter.
 func (rl *RateLimiter) Init(filterSpec *httppipeline.FilterSpec) {
 	rl.filterSpec, rl.spec = filterSpec, filterSpec.FilterSpec().(*Spec)
@@ -238,8 +264,29 @@ func (rl *RateLimiter) Inherit(filterSpec *httppipeline.FilterSpec, previousGene
 
 // Handle handles HTTP request
 func (rl *RateLimiter) Handle(ctx context.HTTPContext) string {
+	if rl.penalty == nil {
+		result := rl.handle(ctx)
+		return ctx.CallNextHandler(result)
+	}
+
+	key := rl.penalty.clientKey(ctx)
+	if d, banned := rl.penalty.banned(key, time.Now()); banned {
+		ctx.AddTag("rateLimiter: client banned")
+		ctx.Response().SetStatusCode(http.StatusTooManyRequests)
+		ctx.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+		ctx.Response().Header().Set("X-EG-Rate-Limiter", "client-banned")
+		rejection.Respond(ctx, rl.spec.RejectionResponse, "client banned")
+		return ctx.CallNextHandler(resultRateLimited)
+	}
+
 	result := rl.handle(ctx)
-	return ctx.CallNextHandler(result)
+	result = ctx.CallNextHandler(result)
+
+	if d := rl.penalty.record(key, ctx.Response().StatusCode(), time.Now()); d > 0 {
+		logger.Warnf("rate limiter '%s' banned client %s for %s", rl.filterSpec.Name(), key, d)
+	}
+
+	return result
 }
 
 func (rl *RateLimiter) handle(ctx context.HTTPContext) string {
@@ -253,6 +300,7 @@ func (rl *RateLimiter) handle(ctx context.HTTPContext) string {
 			ctx.AddTag("rateLimiter: too many requests")
 			ctx.Response().SetStatusCode(http.StatusTooManyRequests)
 			ctx.Response().Std().Header().Set("X-EG-Rate-Limiter", "too-many-requests")
+			rejection.Respond(ctx, rl.spec.RejectionResponse, "too many requests")
 			return resultRateLimited
 		}
 
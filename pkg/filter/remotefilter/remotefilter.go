@@ -31,6 +31,7 @@ import (
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/egress"
 	"github.com/megaease/easegress/pkg/util/stringtool"
 )
 
@@ -60,11 +61,11 @@ var globalClient = &http.Client{
 	Timeout: 0,
 	Transport: &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
+		DialContext: egress.Dialer((&net.Dialer{
 			Timeout:   30 * time.Second,
 			KeepAlive: 60 * time.Second,
 			DualStack: true,
-		}).DialContext,
+		}).DialContext),
 		TLSClientConfig: &tls.Config{
 			// NOTE: Could make it an paramenter,
 			// when the requests need cross WAN.
@@ -110,7 +111,7 @@ type (
 
 	// Spec describes RemoteFilter.
 	Spec struct {
-		URL     string `yaml:"url" jsonschema:"required,format=uri"`
+		URL     string `yaml:"url" jsonschema:"required,format=egress-url"`
 		Timeout string `yaml:"timeout" jsonschema:"omitempty,format=duration"`
 
 		timeout time.Duration
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package requestadaptor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	defaultExtractMaxBodySize = 1024 * 1024
+	defaultExtractContentType = "application/json"
+)
+
+type (
+	// BodyExtractorSpec describes the extraction of the fields of the JSON
+	// request body into headers, so routing and upstream services could
+	// rely on headers instead of parsing bodies again.
+	BodyExtractorSpec struct {
+		// Headers are the gjson paths keyed by the header names.
+		Headers      map[string]string `yaml:"headers" jsonschema:"required"`
+		MaxBodySize  int64             `yaml:"maxBodySize" jsonschema:"omitempty,minimum=0"`
+		ContentTypes []string          `yaml:"contentTypes" jsonschema:"omitempty,uniqueItems=true"`
+	}
+
+	bodyExtractor struct {
+		headers      map[string]string
+		maxBodySize  int64
+		contentTypes []string
+	}
+)
+
+// Validate validates BodyExtractorSpec.
+func (spec BodyExtractorSpec) Validate() error {
+	if len(spec.Headers) == 0 {
+		return fmt.Errorf("empty headers")
+	}
+
+	for _, ct := range spec.ContentTypes {
+		if _, _, err := mime.ParseMediaType(ct); err != nil {
+			return fmt.Errorf("invalid content type %s: %v", ct, err)
+		}
+	}
+
+	return nil
+}
+
+func newBodyExtractor(spec *BodyExtractorSpec) *bodyExtractor {
+	be := &bodyExtractor{
+		headers:      spec.Headers,
+		maxBodySize:  spec.MaxBodySize,
+		contentTypes: spec.ContentTypes,
+	}
+	if be.maxBodySize == 0 {
+		be.maxBodySize = defaultExtractMaxBodySize
+	}
+	if len(be.contentTypes) == 0 {
+		be.contentTypes = []string{defaultExtractContentType}
+	}
+
+	return be
+}
+
+// extract sets the headers by the fields of the request body, the body
+// is kept for the following handlers. The fields not existed are skipped.
+func (be *bodyExtractor) extract(ctx context.HTTPContext) {
+	r := ctx.Request()
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header().Get(httpheader.KeyContentType))
+	if !stringtool.StrInSlice(mediaType, be.contentTypes) {
+		return
+	}
+
+	if r.Std().ContentLength > be.maxBodySize {
+		ctx.AddTag("requestAdaptor: body too large to extract")
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body(), be.maxBodySize+1))
+	if err != nil {
+		ctx.AddTag(stringtool.Cat("requestAdaptor: read body failed: ", err.Error()))
+		r.SetBody(bytes.NewReader(body))
+		return
+	}
+
+	if int64(len(body)) > be.maxBodySize {
+		ctx.AddTag("requestAdaptor: body too large to extract")
+		r.SetBody(io.MultiReader(bytes.NewReader(body), r.Body()))
+		return
+	}
+	r.SetBody(bytes.NewReader(body))
+
+	if !gjson.ValidBytes(body) {
+		ctx.AddTag("requestAdaptor: invalid json body to extract")
+		return
+	}
+
+	for key, path := range be.headers {
+		if value := gjson.GetBytes(body, path); value.Exists() {
+			r.Header().Set(key, value.String())
+		}
+	}
+}
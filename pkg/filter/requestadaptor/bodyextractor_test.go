@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package requestadaptor
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+func TestBodyExtractor(t *testing.T) {
+	be := newBodyExtractor(&BodyExtractorSpec{
+		Headers: map[string]string{
+			"X-Tenant": "tenant.id",
+			"X-First":  "items.0.name",
+			"X-None":   "missing",
+		},
+		MaxBodySize: 64,
+	})
+
+	extract := func(contentType, body string) (*httpheader.HTTPHeader, string) {
+		header := httpheader.New(http.Header{})
+		header.Set(httpheader.KeyContentType, contentType)
+
+		var reader io.Reader = strings.NewReader(body)
+		ctx := &contexttest.MockedHTTPContext{}
+		ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader { return header }
+		ctx.MockedRequest.MockedBody = func() io.Reader { return reader }
+		ctx.MockedRequest.MockedSetBody = func(r io.Reader) { reader = r }
+
+		be.extract(ctx)
+
+		data, _ := ioutil.ReadAll(reader)
+		return header, string(data)
+	}
+
+	body := `{"tenant":{"id":"megaease"},"items":[{"name":"a"}]}`
+	header, kept := extract("application/json; charset=utf-8", body)
+	if header.Get("X-Tenant") != "megaease" || header.Get("X-First") != "a" {
+		t.Errorf("unexpected extracted headers: %v", header.Std())
+	}
+	if len(header.GetAll("X-None")) != 0 {
+		t.Errorf("missing field should not be extracted")
+	}
+	if kept != body {
+		t.Errorf("body should be kept, got %s", kept)
+	}
+
+	header, _ = extract("text/plain", body)
+	if header.Get("X-Tenant") != "" {
+		t.Errorf("content type not matched should not be extracted")
+	}
+
+	large := `{"tenant":{"id":"megaease"},"padding":"` + strings.Repeat("x", 64) + `"}`
+	header, kept = extract("application/json", large)
+	if header.Get("X-Tenant") != "" {
+		t.Errorf("body too large should not be extracted")
+	}
+	if kept != large {
+		t.Errorf("body too large should be kept, got %s", kept)
+	}
+}
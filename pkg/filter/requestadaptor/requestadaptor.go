@@ -21,11 +21,11 @@ import (
 	"bytes"
 
 	"github.com/megaease/easegress/pkg/context"
-	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
 	"github.com/megaease/easegress/pkg/util/httpheader"
 	"github.com/megaease/easegress/pkg/util/pathadaptor"
 	"github.com/megaease/easegress/pkg/util/stringtool"
+	"github.com/megaease/easegress/pkg/util/texttemplate"
 )
 
 const (
@@ -46,6 +46,7 @@ type (
 		spec       *Spec
 
 		pa *pathadaptor.PathAdaptor
+		be *bodyExtractor
 	}
 
 	// Spec is HTTPAdaptor Spec.
@@ -55,6 +56,14 @@ type (
 		Path   *pathadaptor.Spec     `yaml:"path,omitempty" jsonschema:"omitempty"`
 		Header *httpheader.AdaptSpec `yaml:"header,omitempty" jsonschema:"omitempty"`
 		Body   string                `yaml:"body" jsonschema:"omitempty"`
+
+		BodyExtractor *BodyExtractorSpec `yaml:"bodyExtractor,omitempty" jsonschema:"omitempty"`
+
+		// RenderMode is the mode of rendering the templates of host and
+		// body, the templates failing to render are rendered to
+		// Placeholder and reported in tags in bestEffort mode.
+		RenderMode  string `yaml:"renderMode,omitempty" jsonschema:"omitempty,enum=,enum=strict,enum=bestEffort"`
+		Placeholder string `yaml:"placeholder,omitempty" jsonschema:"omitempty"`
 	}
 )
 
@@ -95,6 +104,9 @@ func (ra *RequestAdaptor) reload() {
 	if ra.spec.Path != nil {
 		ra.pa = pathadaptor.New(ra.spec.Path)
 	}
+	if ra.spec.BodyExtractor != nil {
+		ra.be = newBodyExtractor(ra.spec.BodyExtractor)
+	}
 }
 
 // Handle adapts request.
@@ -121,39 +133,56 @@ func (ra *RequestAdaptor) handle(ctx context.HTTPContext) string {
 		}
 		r.SetPath(adaptedPath)
 	}
+	// NOTE: The fields are extracted before adapting, so the extracted
+	// headers could be adapted too.
+	if ra.be != nil {
+		ra.be.extract(ctx)
+	}
+
 	hte := ctx.Template()
 	if ra.spec.Header != nil {
 		header.Adapt(ra.spec.Header, hte)
 	}
 
 	if len(ra.spec.Body) != 0 {
-		if hte.HasTemplates(ra.spec.Body) {
-			if body, err := hte.Render(ra.spec.Body); err != nil {
-				logger.Errorf("BUG request render body failed, template %s, err %v",
-					ra.spec.Body, err)
-			} else {
-				ctx.Request().SetBody(bytes.NewReader([]byte(body)))
-			}
-		} else {
-			ctx.Request().SetBody(bytes.NewReader([]byte(ra.spec.Body)))
+		if body, ok := ra.render(ctx, "body", ra.spec.Body); ok {
+			ctx.Request().SetBody(bytes.NewReader([]byte(body)))
 		}
 	}
 
 	if len(ra.spec.Host) != 0 {
-		if hte.HasTemplates(ra.spec.Host) {
-			if host, err := hte.Render(ra.spec.Host); err != nil {
-				logger.Errorf("BUG request render host failed, template %s, err %v",
-					ra.spec.Host, err)
-			} else {
-				ctx.Request().SetHost(host)
-			}
-		} else {
-			ctx.Request().SetHost(ra.spec.Host)
+		if host, ok := ra.render(ctx, "host", ra.spec.Host); ok {
+			ctx.Request().SetHost(host)
 		}
 	}
 	return ""
 }
 
+// render renders the templates of the field, it returns false if the
+// templates fail to render in strict mode.
+func (ra *RequestAdaptor) render(ctx context.HTTPContext, field, input string) (string, bool) {
+	hte := ctx.Template()
+	if !hte.HasTemplates(input) {
+		return input, true
+	}
+
+	if ra.spec.RenderMode == texttemplate.RenderModeBestEffort {
+		output, warnings := hte.RenderBestEffort(input, ra.spec.Placeholder)
+		for _, warning := range warnings {
+			ctx.AddTag(stringtool.Cat("requestAdaptor: render ", field, " warning: ", warning))
+		}
+		return output, true
+	}
+
+	output, err := hte.Render(input)
+	if err != nil {
+		ctx.Logger().Errorf("BUG request render %s failed, template %s, err %v",
+			field, input, err)
+		return "", false
+	}
+	return output, true
+}
+
 // Status returns status.
 func (ra *RequestAdaptor) Status() interface{} { return nil }
 
@@ -21,9 +21,10 @@ import (
 	"bytes"
 
 	"github.com/megaease/easegress/pkg/context"
-	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
 	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+	"github.com/megaease/easegress/pkg/util/texttemplate"
 )
 
 const (
@@ -49,6 +50,12 @@ type (
 		Header *httpheader.AdaptSpec `yaml:"header" jsonschema:"required"`
 
 		Body string `yaml:"body" jsonschema:"omitempty"`
+
+		// RenderMode is the mode of rendering the templates of body,
+		// the templates failing to render are rendered to Placeholder
+		// and reported in tags in bestEffort mode.
+		RenderMode  string `yaml:"renderMode,omitempty" jsonschema:"omitempty,enum=,enum=strict,enum=bestEffort"`
+		Placeholder string `yaml:"placeholder,omitempty" jsonschema:"omitempty"`
 	}
 )
 
@@ -104,8 +111,14 @@ func (ra *ResponseAdaptor) handle(ctx context.HTTPContext) string {
 
 	if !hte.HasTemplates(ra.spec.Body) {
 		ctx.Response().SetBody(bytes.NewReader([]byte(ra.spec.Body)))
+	} else if ra.spec.RenderMode == texttemplate.RenderModeBestEffort {
+		body, warnings := hte.RenderBestEffort(ra.spec.Body, ra.spec.Placeholder)
+		for _, warning := range warnings {
+			ctx.AddTag(stringtool.Cat("responseAdaptor: render body warning: ", warning))
+		}
+		ctx.Response().SetBody(bytes.NewReader([]byte(body)))
 	} else if body, err := hte.Render(ra.spec.Body); err != nil {
-		logger.Errorf("BUG responseadaptor render body failed, template %s , err %v", ra.spec.Body, err)
+		ctx.Logger().Errorf("BUG responseadaptor render body failed, template %s , err %v", ra.spec.Body, err)
 	} else {
 		ctx.Response().SetBody(bytes.NewReader([]byte(body)))
 	}
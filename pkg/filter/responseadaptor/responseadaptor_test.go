@@ -72,6 +72,57 @@ header:
 	doTest(t, yamlSpec, nil)
 }
 
+func TestResponseAdaptorBestEffort(t *testing.T) {
+	yamlSpec := `
+kind: ResponseAdaptor
+name: ra
+header:
+  del: ["X-Del"]
+renderMode: bestEffort
+placeholder: unknown
+body: "copyright [[name]], [[filter.proxy.rsp.body.owner]]"
+`
+	rawSpec := make(map[string]interface{})
+	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
+	spec, err := httppipeline.NewFilterSpec(rawSpec, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ra := &ResponseAdaptor{}
+	ra.Init(spec)
+
+	tt, _ := texttemplate.NewDefault([]string{"name", "filter.{}.rsp.body", "filter.{}.rsp.body.{gjson}"})
+	tt.SetDict("name", "megaease")
+	tt.SetDict("filter.proxy.rsp.body", `{"id":1}`)
+
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedTemplate = func() texttemplate.TemplateEngine {
+		return tt
+	}
+	resp := httptest.NewRecorder()
+	ctx.MockedResponse.MockedSetBody = func(body io.Reader) {
+		data, _ := io.ReadAll(body)
+		resp.Write(data)
+	}
+	ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(resp.Header())
+	}
+	tags := []string{}
+	ctx.MockedAddTag = func(tag string) {
+		tags = append(tags, tag)
+	}
+
+	ra.handle(ctx)
+
+	if v := resp.Body.String(); v != "copyright megaease, unknown" {
+		t.Errorf("unexpected body: %s", v)
+	}
+	if len(tags) != 1 {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+}
+
 func doTest(t *testing.T, yamlSpec string, prev *ResponseAdaptor) *ResponseAdaptor {
 	rawSpec := make(map[string]interface{})
 	yamltool.Unmarshal([]byte(yamlSpec), &rawSpec)
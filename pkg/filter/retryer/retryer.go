@@ -26,7 +26,6 @@ import (
 	"time"
 
 	"github.com/megaease/easegress/pkg/context"
-	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
 	"github.com/megaease/easegress/pkg/util/urlrule"
 )
@@ -200,7 +199,7 @@ func (r *Retryer) handle(ctx context.HTTPContext, u *URLRule) string {
 			return result
 		}
 
-		logger.Infof("attempts %d of retryer %s on URL(%s) failed at %d, result is '%s'",
+		ctx.Logger().Infof("attempts %d of retryer %s on URL(%s) failed at %d, result is '%s'",
 			attempt,
 			r.filterSpec.Name(),
 			u.ID(),
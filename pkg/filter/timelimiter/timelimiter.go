@@ -23,7 +23,6 @@ import (
 	"time"
 
 	"github.com/megaease/easegress/pkg/context"
-	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
 	"github.com/megaease/easegress/pkg/util/urlrule"
 )
@@ -118,7 +117,7 @@ func (tl *TimeLimiter) handle(ctx context.HTTPContext, u *URLRule) string {
 	result := ctx.CallNextHandler("")
 	if !timer.Stop() {
 		ctx.AddTag("timeLimiter: timed out")
-		logger.Infof("time limiter %s timed out on URL(%s)", tl.filterSpec.Name(), u.ID())
+		ctx.Logger().Infof("time limiter %s timed out on URL(%s)", tl.filterSpec.Name(), u.ID())
 		ctx.Response().SetStatusCode(http.StatusRequestTimeout)
 		ctx.Response().Std().Header().Set("X-EG-Time-Limiter", "timed-out")
 		result = resultTimeout
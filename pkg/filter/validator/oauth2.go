@@ -19,16 +19,19 @@ package validator
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt"
 
 	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/decisioncache"
 )
 
 type (
@@ -39,6 +42,8 @@ type (
 		ClientID     string `yaml:"clientId" jsonschema:"omitempty"`
 		ClientSecret string `yaml:"clientSecret" jsonschema:"omitempty"`
 		InsecureTLS  bool   `yaml:"insecureTls"`
+		// Cache caches the introspection results by the tokens.
+		Cache *decisioncache.Spec `yaml:"cache,omitempty" jsonschema:"omitempty"`
 	}
 
 	// OAuth2JWT defines the validator configuration for OAuth2 self encoded access token
@@ -59,6 +64,7 @@ type (
 	OAuth2Validator struct {
 		spec   *OAuth2ValidatorSpec
 		client *http.Client
+		cache  *decisioncache.DecisionCache
 	}
 
 	tokenInfo struct {
@@ -89,6 +95,9 @@ func NewOAuth2Validator(spec *OAuth2ValidatorSpec) *OAuth2Validator {
 		} else {
 			v.client = http.DefaultClient
 		}
+		if spec.TokenIntrospect.Cache != nil {
+			v.cache = decisioncache.New(spec.TokenIntrospect.Cache)
+		}
 	}
 	return v
 }
@@ -137,6 +146,39 @@ func (v *OAuth2Validator) introspectToken(tokenStr string) (*tokenInfo, error) {
 	return &ti.tokenInfo, nil
 }
 
+// introspectTokenCached introspects the token through the cache, the
+// inactive tokens are cached as denials.
+func (v *OAuth2Validator) introspectTokenCached(tokenStr string) (*tokenInfo, error) {
+	if v.cache == nil {
+		return v.introspectToken(tokenStr)
+	}
+
+	// NOTE: The tokens are not kept in memory.
+	sum := sha256.Sum256([]byte(tokenStr))
+	decision, err := v.cache.Get(hex.EncodeToString(sum[:]), func() (*decisioncache.Decision, error) {
+		ti, err := v.introspectToken(tokenStr)
+		if err != nil {
+			return nil, err
+		}
+
+		decision := &decisioncache.Decision{Allowed: ti.Active, Value: ti}
+		if ti.ExpiresAt > 0 {
+			decision.TTL = time.Until(time.Unix(ti.ExpiresAt, 0))
+			if decision.TTL <= 0 {
+				decision.Allowed = false
+			}
+		}
+		return decision, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ti := *decision.Value.(*tokenInfo)
+	ti.Active = decision.Allowed
+	return &ti, nil
+}
+
 // Validate validates the access token of a http request
 func (v *OAuth2Validator) Validate(req context.HTTPRequest) error {
 	const prefix = "Bearer "
@@ -150,7 +192,7 @@ func (v *OAuth2Validator) Validate(req context.HTTPRequest) error {
 
 	var subject, scope string
 	if v.spec.TokenIntrospect != nil {
-		ti, e := v.introspectToken(tokenStr)
+		ti, e := v.introspectTokenCached(tokenStr)
 		if e != nil {
 			return e
 		}
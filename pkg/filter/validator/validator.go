@@ -19,10 +19,14 @@ package validator
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/util/decisioncache"
+	"github.com/megaease/easegress/pkg/util/gatewaychain"
 	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/rejection"
 	"github.com/megaease/easegress/pkg/util/signer"
 	"github.com/megaease/easegress/pkg/util/stringtool"
 )
@@ -50,6 +54,7 @@ type (
 		jwt     *JWTValidator
 		signer  *signer.Signer
 		oauth2  *OAuth2Validator
+		chain   *gatewaychain.Chain
 	}
 
 	// Spec describes the Validator.
@@ -58,6 +63,17 @@ type (
 		JWT       *JWTValidatorSpec         `yaml:"jwt,omitempty" jsonschema:"omitempty"`
 		Signature *signer.Spec              `yaml:"signature,omitempty" jsonschema:"omitempty"`
 		OAuth2    *OAuth2ValidatorSpec      `yaml:"oauth2,omitempty" jsonschema:"omitempty"`
+		// GatewayChain verifies the requests are from the upstream
+		// Easegress tiers, and trusts their claims.
+		GatewayChain *gatewaychain.Spec `yaml:"gatewayChain,omitempty" jsonschema:"omitempty"`
+		// RejectionResponse is the name of the RejectionResponse
+		// responded when the requests are invalid.
+		RejectionResponse string `yaml:"rejectionResponse,omitempty" jsonschema:"omitempty,format=rejectionresponse"`
+	}
+
+	// Status is the status of Validator.
+	Status struct {
+		OAuth2Cache *decisioncache.Status `yaml:"oauth2Cache,omitempty"`
 	}
 )
 
@@ -109,6 +125,10 @@ func (v *Validator) reload() {
 	if v.spec.OAuth2 != nil {
 		v.oauth2 = NewOAuth2Validator(v.spec.OAuth2)
 	}
+
+	if v.spec.GatewayChain != nil {
+		v.chain = gatewaychain.New(v.spec.GatewayChain)
+	}
 }
 
 // Handle validates HTTPContext.
@@ -117,42 +137,60 @@ func (v *Validator) Handle(ctx context.HTTPContext) string {
 	return ctx.CallNextHandler(result)
 }
 
+// reject rejects the request with the status code, the reason is
+// responded to clients while the error is only in the tag.
+func (v *Validator) reject(ctx context.HTTPContext, statusCode int, validator, reason string, err error) string {
+	ctx.Response().SetStatusCode(statusCode)
+	ctx.AddTag(stringtool.Cat(validator, ": ", err.Error()))
+	rejection.Respond(ctx, v.spec.RejectionResponse, reason)
+	return resultInvalid
+}
+
 func (v *Validator) handle(ctx context.HTTPContext) string {
 	req := ctx.Request()
 
 	if v.headers != nil {
 		err := v.headers.Validate(req.Header())
 		if err != nil {
-			ctx.Response().SetStatusCode(http.StatusBadRequest)
-			ctx.AddTag(stringtool.Cat("header validator: ", err.Error()))
-			return resultInvalid
+			return v.reject(ctx, http.StatusBadRequest, "header validator", "invalid header", err)
 		}
 	}
 
 	if v.jwt != nil {
 		err := v.jwt.Validate(req)
 		if err != nil {
-			ctx.Response().SetStatusCode(http.StatusForbidden)
-			ctx.AddTag(stringtool.Cat("JWT validator: ", err.Error()))
-			return resultInvalid
+			return v.reject(ctx, http.StatusForbidden, "JWT validator", "invalid JWT", err)
 		}
 	}
 
 	if v.signer != nil {
 		err := v.signer.Verify(req.Std())
 		if err != nil {
-			ctx.Response().SetStatusCode(http.StatusForbidden)
-			ctx.AddTag(stringtool.Cat("signature validator: ", err.Error()))
-			return resultInvalid
+			return v.reject(ctx, http.StatusForbidden, "signature validator", "invalid signature", err)
 		}
 	}
 
 	if v.oauth2 != nil {
 		err := v.oauth2.Validate(req)
 		if err != nil {
-			ctx.Response().SetStatusCode(http.StatusForbidden)
-			ctx.AddTag(stringtool.Cat("oauth2 validator: ", err.Error()))
-			return resultInvalid
+			return v.reject(ctx, http.StatusForbidden, "oauth2 validator", "invalid OAuth2 token", err)
+		}
+	}
+
+	if v.chain != nil {
+		std := req.Std()
+		claims, err := v.chain.Verify(std.Header, std.Method, std.URL.Path, time.Now())
+		if err != nil {
+			return v.reject(ctx, http.StatusForbidden, "gateway chain validator", "invalid gateway chain", err)
+		}
+
+		// NOTE: The identity header is overridden by the trusted claim.
+		if header := v.chain.IdentityHeader(); header != "" {
+			if claims.Identity != "" {
+				req.Header().Set(header, claims.Identity)
+			} else {
+				req.Header().Del(header)
+			}
 		}
 	}
 
@@ -160,7 +198,12 @@ func (v *Validator) handle(ctx context.HTTPContext) string {
 }
 
 // Status returns status.
-func (v *Validator) Status() interface{} { return nil }
+func (v *Validator) Status() interface{} {
+	if v.oauth2 == nil || v.oauth2.cache == nil {
+		return nil
+	}
+	return &Status{OAuth2Cache: v.oauth2.cache.Status()}
+}
 
 // Close closes Validator.
 func (v *Validator) Close() {}
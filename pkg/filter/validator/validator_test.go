@@ -20,15 +20,22 @@ package validator
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/context/contexttest"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/gatewaychain"
 	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/rejection"
 	"github.com/megaease/easegress/pkg/util/yamltool"
 )
 
@@ -266,6 +273,78 @@ oauth2:
 	}
 }
 
+func TestOAuth2TokenIntrospectCache(t *testing.T) {
+	yamlSpec := `
+kind: Validator
+name: validator
+oauth2:
+  tokenIntrospect:
+    endPoint: http://oauth2.megaease.com/
+    clientId: megaease
+    clientSecret: secret
+    cache:
+      ttl: 1m
+      negativeTTL: 1m
+`
+	v := createValidator(yamlSpec, nil)
+	ctx := &contexttest.MockedHTTPContext{}
+
+	header := http.Header{}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(header)
+	}
+
+	requests := 0
+	active := true
+	fnSendRequest = func(client *http.Client, r *http.Request) (*http.Response, error) {
+		requests++
+		body := fmt.Sprintf(`{"sub":"megaease.com","active":%v}`, active)
+		return &http.Response{
+			Body: io.NopCloser(strings.NewReader(body)),
+		}, nil
+	}
+
+	header.Set("Authorization", "Bearer token1")
+	for i := 0; i < 3; i++ {
+		if result := v.Handle(ctx); result == resultInvalid {
+			t.Fatalf("OAuth/2 Authorization should succeed")
+		}
+	}
+	if requests != 1 {
+		t.Errorf("want 1 introspection, got %d", requests)
+	}
+
+	active = false
+	header.Set("Authorization", "Bearer token2")
+	for i := 0; i < 3; i++ {
+		if result := v.Handle(ctx); result != resultInvalid {
+			t.Fatalf("OAuth/2 Authorization should fail")
+		}
+	}
+	if requests != 2 {
+		t.Errorf("want 2 introspections, got %d", requests)
+	}
+
+	status := v.Status().(*Status)
+	if status.OAuth2Cache.Entries != 2 || status.OAuth2Cache.Hits != 4 {
+		t.Errorf("unexpected status: %+v", status.OAuth2Cache)
+	}
+
+	fnSendRequest = func(client *http.Client, r *http.Request) (*http.Response, error) {
+		requests++
+		return nil, fmt.Errorf("unavailable")
+	}
+	header.Set("Authorization", "Bearer token3")
+	for i := 0; i < 2; i++ {
+		if result := v.Handle(ctx); result != resultInvalid {
+			t.Fatalf("OAuth/2 Authorization should fail")
+		}
+	}
+	if requests != 4 {
+		t.Errorf("errors should not be cached")
+	}
+}
+
 func TestSignature(t *testing.T) {
 	// This test is almost covered by signer
 
@@ -289,3 +368,79 @@ signature:
 		t.Errorf("OAuth/2 Authorization should fail")
 	}
 }
+
+func TestGatewayChain(t *testing.T) {
+	const yamlSpec = `
+kind: Validator
+name: validator
+gatewayChain:
+  keyId: k1
+  keys:
+    k1: secret
+  identityHeader: X-User
+`
+	v := createValidator(yamlSpec, nil)
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://megaease.com/api", nil)
+	stdr.Header.Set("X-User", "mallory")
+
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedStd = func() *http.Request {
+		return stdr
+	}
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(stdr.Header)
+	}
+
+	result := v.Handle(ctx)
+	if result != resultInvalid {
+		t.Errorf("request without signature should be invalid")
+	}
+
+	claims := &gatewaychain.Claims{RealIP: "1.2.3.4", Identity: "alice"}
+	v.chain.Sign(stdr.Header, http.MethodGet, "/api", claims, time.Now())
+	result = v.Handle(ctx)
+	if result != "" {
+		t.Errorf("request with signature should be valid")
+	}
+	if user := stdr.Header.Get("X-User"); user != "alice" {
+		t.Errorf("identity header should be overridden by the claim, but got %s", user)
+	}
+}
+
+func TestRejectionResponse(t *testing.T) {
+	r, err := rejection.New(&rejection.Spec{
+		StatusCode: http.StatusUnauthorized,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       `{"error":"{{.Reason}}"}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rejection.Set("json-rejection", r)
+	defer rejection.Delete("json-rejection")
+
+	const yamlSpec = `
+kind: Validator
+name: validator
+rejectionResponse: json-rejection
+headers:
+  Is-Valid:
+    values: ["abc"]
+`
+	v := createValidator(yamlSpec, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	ctx := context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "")
+	if result := v.handle(ctx); result != resultInvalid {
+		t.Fatalf("request should be invalid")
+	}
+
+	if code := ctx.Response().StatusCode(); code != http.StatusUnauthorized {
+		t.Errorf("expect status 401, got %d", code)
+	}
+	body, _ := ioutil.ReadAll(ctx.Response().Body())
+	if string(body) != `{"error":"invalid header"}` {
+		t.Errorf("unexpected body %s", body)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger
+
+import "go.uber.org/zap"
+
+// ContextLogger is the logger attaching the fields of a request, e.g. the
+// trace_id and span_id, to every line, so the logs can be joined with the
+// traces and metrics of the request. The nil ContextLogger logs as the
+// default logger.
+type ContextLogger struct {
+	fields []interface{}
+}
+
+// WithFields returns a ContextLogger attaching the key-value pairs.
+func WithFields(kvs ...interface{}) *ContextLogger {
+	return &ContextLogger{fields: kvs}
+}
+
+// With returns a ContextLogger attaching the key-value pairs in addition.
+func (l *ContextLogger) With(kvs ...interface{}) *ContextLogger {
+	if l == nil {
+		return WithFields(kvs...)
+	}
+
+	fields := make([]interface{}, 0, len(l.fields)+len(kvs))
+	fields = append(fields, l.fields...)
+	return &ContextLogger{fields: append(fields, kvs...)}
+}
+
+// NOTE: The logger with fields is created only when logging, since most
+// requests log nothing.
+func (l *ContextLogger) logger() *zap.SugaredLogger {
+	if l == nil || len(l.fields) == 0 {
+		return defaultLogger
+	}
+	return defaultLogger.With(l.fields...)
+}
+
+// Debugf is the wrapper of default logger Debugf with the fields.
+func (l *ContextLogger) Debugf(template string, args ...interface{}) {
+	l.logger().Debugf(template, args...)
+}
+
+// Infof is the wrapper of default logger Infof with the fields.
+func (l *ContextLogger) Infof(template string, args ...interface{}) {
+	l.logger().Infof(template, args...)
+}
+
+// Warnf is the wrapper of default logger Warnf with the fields.
+func (l *ContextLogger) Warnf(template string, args ...interface{}) {
+	l.logger().Warnf(template, args...)
+}
+
+// Errorf is the wrapper of default logger Errorf with the fields.
+func (l *ContextLogger) Errorf(template string, args ...interface{}) {
+	l.logger().Errorf(template, args...)
+}
@@ -54,6 +54,7 @@ const (
 	filterHTTPAccessFilename = "filter_http_access.log"
 	filterHTTPDumpFilename   = "filter_http_dump.log"
 	adminAPIFilename         = "admin_api.log"
+	filterHTTPAccessWALDir   = "access_log_wal"
 
 	// EtcdClientFilename is the filename of etcd client log.
 	EtcdClientFilename = "etcd_client.log"
@@ -141,7 +142,11 @@ func initDefault(opt *option.Options) {
 }
 
 func initHTTPFilter(opt *option.Options) {
-	httpFilterAccessLogger = newPlainLogger(opt, filterHTTPAccessFilename, trafficLogMaxCacheCount)
+	if opt.AccessLogSinkURL != "" {
+		httpFilterAccessLogger = newWALLogger(opt, filterHTTPAccessWALDir)
+	} else {
+		httpFilterAccessLogger = newPlainLogger(opt, filterHTTPAccessFilename, trafficLogMaxCacheCount)
+	}
 	httpFilterDumpLogger = newPlainLogger(opt, filterHTTPDumpFilename, trafficLogMaxCacheCount)
 }
 
@@ -149,8 +154,8 @@ func initRestAPI(opt *option.Options) {
 	restAPILogger = newPlainLogger(opt, adminAPIFilename, systemLogMaxCacheCount)
 }
 
-func newPlainLogger(opt *option.Options, filename string, maxCacheCount uint32) *zap.Logger {
-	encoderConfig := zapcore.EncoderConfig{
+func plainEncoderConfig() zapcore.EncoderConfig {
+	return zapcore.EncoderConfig{
 		TimeKey:       "",
 		LevelKey:      "",
 		NameKey:       "",
@@ -159,6 +164,10 @@ func newPlainLogger(opt *option.Options, filename string, maxCacheCount uint32)
 		StacktraceKey: "",
 		LineEnding:    zapcore.DefaultLineEnding,
 	}
+}
+
+func newPlainLogger(opt *option.Options, filename string, maxCacheCount uint32) *zap.Logger {
+	encoderConfig := plainEncoderConfig()
 
 	fr, err := newLogFile(filepath.Join(opt.AbsLogDir, filename), maxCacheCount)
 	if err != nil {
@@ -170,3 +179,18 @@ func newPlainLogger(opt *option.Options, filename string, maxCacheCount uint32)
 
 	return zap.New(core)
 }
+
+// newWALLogger creates a plain logger whose entries are delivered to
+// the access log sink through a write-ahead log in the data directory.
+func newWALLogger(opt *option.Options, dirname string) *zap.Logger {
+	encoderConfig := plainEncoderConfig()
+
+	ws, err := newWALSink(filepath.Join(opt.AbsDataDir, dirname), opt.AccessLogSinkURL, opt.AccessLogWALFsync)
+	if err != nil {
+		common.Exit(1, err.Error())
+	}
+
+	core := zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), ws, zap.DebugLevel)
+
+	return zap.New(core)
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/wal"
+)
+
+const (
+	walSegmentSize = 64 * 1024 * 1024
+	walBatchSize   = 512
+
+	walShipTimeout     = 10 * time.Second
+	walMinRetryBackoff = time.Second
+	walMaxRetryBackoff = 30 * time.Second
+)
+
+type (
+	// walSink writes logs into a local write-ahead log and ships them
+	// to an HTTP sink in the background. The records are committed only
+	// after the sink responds with 2xx, the ones not committed are shipped
+	// again after restart, so no record is lost but it may be duplicated.
+	walSink struct {
+		wal     *wal.WAL
+		sinkURL string
+		client  *http.Client
+	}
+)
+
+func newWALSink(dir, sinkURL string, fsync bool) (*walSink, error) {
+	w, err := wal.Open(dir, walSegmentSize, fsync)
+	if err != nil {
+		return nil, err
+	}
+
+	ws := &walSink{
+		wal:     w,
+		sinkURL: sinkURL,
+		client:  &http.Client{Timeout: walShipTimeout},
+	}
+
+	go ws.run()
+
+	return ws, nil
+}
+
+// Write appends p as one record, zap calls it once per entry.
+func (ws *walSink) Write(p []byte) (int, error) {
+	err := ws.wal.Append(p)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Sync syncs the write-ahead log to disk.
+func (ws *walSink) Sync() error {
+	return ws.wal.Sync()
+}
+
+func (ws *walSink) run() {
+	pos := ws.wal.Committed()
+	backoff := walMinRetryBackoff
+
+	for {
+		records, next, err := ws.wal.Read(pos, walBatchSize)
+		if err != nil {
+			Errorf("read access log wal failed: %v", err)
+		}
+
+		if len(records) == 0 {
+			if err != nil {
+				time.Sleep(backoff)
+				continue
+			}
+			<-ws.wal.Notify()
+			continue
+		}
+
+		err = ws.ship(records)
+		if err != nil {
+			Warnf("ship %d access logs to %s failed, retry after %v: %v",
+				len(records), ws.sinkURL, backoff, err)
+			time.Sleep(backoff)
+			backoff *= 2
+			if backoff > walMaxRetryBackoff {
+				backoff = walMaxRetryBackoff
+			}
+			continue
+		}
+		backoff = walMinRetryBackoff
+
+		err = ws.wal.Commit(next)
+		if err != nil {
+			Errorf("commit access log wal failed: %v", err)
+		}
+		pos = next
+	}
+}
+
+func (ws *walSink) ship(records [][]byte) error {
+	body := bytes.Join(records, nil)
+	resp, err := ws.client.Post(ws.sinkURL, "text/plain", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("sink responded %d", resp.StatusCode)
+	}
+
+	return nil
+}
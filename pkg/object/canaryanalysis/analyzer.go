@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package canaryanalysis
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/httpstat"
+)
+
+const (
+	phaseProgressing = "progressing"
+	phasePromoted    = "promoted"
+	phaseRolledBack  = "rolledBack"
+)
+
+type (
+	// analyzer decides the weight of the canary by comparing the stats of
+	// the canary with the baseline since the beginning of the current step.
+	analyzer struct {
+		steps             []uint32
+		stepInterval      time.Duration
+		minRequests       uint64
+		maxErrorRate      float64
+		maxErrorRateDelta float64
+		maxLatencyDelta   float64
+
+		phase         string
+		step          int
+		stepStartedAt time.Time
+		reason        string
+
+		// baseline and canary are the stats at the beginning of the step.
+		baseline *httpstat.Status
+		canary   *httpstat.Status
+	}
+)
+
+func newAnalyzer(spec *Spec, now time.Time) *analyzer {
+	a := &analyzer{
+		steps:             spec.Steps,
+		stepInterval:      parseDuration(spec.StepInterval),
+		minRequests:       spec.MinRequests,
+		maxErrorRate:      spec.MaxErrorRate,
+		maxErrorRateDelta: spec.MaxErrorRateDelta,
+		phase:             phaseProgressing,
+		stepStartedAt:     now,
+	}
+
+	if a.minRequests == 0 {
+		a.minRequests = defaultMinRequests
+	}
+	if spec.MaxLatencyDelta != "" {
+		a.maxLatencyDelta = float64(parseDuration(spec.MaxLatencyDelta)) / float64(time.Millisecond)
+	}
+
+	return a
+}
+
+func parseDuration(s string) time.Duration {
+	// NOTE: It has been validated by format=duration.
+	d, _ := time.ParseDuration(s)
+	return d
+}
+
+// weight returns the per-mill weight of the canary.
+func (a *analyzer) weight() uint32 {
+	if a.phase == phaseRolledBack {
+		return 0
+	}
+	return a.steps[a.step]
+}
+
+// analyze analyzes the current stats of the baseline and the canary,
+// it returns true if the weight is changed.
+func (a *analyzer) analyze(baseline, canary *httpstat.Status, now time.Time) bool {
+	if a.phase != phaseProgressing {
+		return false
+	}
+
+	// NOTE: The stats are reset if the pipeline is updated.
+	if a.baseline == nil || a.canary == nil ||
+		baseline.Count < a.baseline.Count || canary.Count < a.canary.Count {
+		a.baseline, a.canary = baseline, canary
+		return false
+	}
+
+	canaryCount := canary.Count - a.canary.Count
+	if canaryCount < a.minRequests {
+		return false
+	}
+
+	if reason := a.violation(baseline, canary); reason != "" {
+		a.phase, a.reason = phaseRolledBack, reason
+		return true
+	}
+
+	if now.Sub(a.stepStartedAt) < a.stepInterval {
+		return false
+	}
+
+	if a.step == len(a.steps)-1 {
+		a.phase = phasePromoted
+		return false
+	}
+
+	a.step++
+	a.stepStartedAt = now
+	a.baseline, a.canary = baseline, canary
+
+	return true
+}
+
+// violation returns the reason if the canary violates the thresholds.
+func (a *analyzer) violation(baseline, canary *httpstat.Status) string {
+	if a.maxErrorRate > 0 {
+		rate := errorRate(canary, a.canary)
+		if rate > a.maxErrorRate {
+			return fmt.Sprintf("error rate of canary is %.2f%%, exceeds the budget %.2f%%",
+				rate, a.maxErrorRate)
+		}
+	}
+
+	if a.maxErrorRateDelta > 0 {
+		delta := errorRate(canary, a.canary) - errorRate(baseline, a.baseline)
+		if delta > a.maxErrorRateDelta {
+			return fmt.Sprintf("error rate of canary is %.2f%% higher than baseline, exceeds %.2f%%",
+				delta, a.maxErrorRateDelta)
+		}
+	}
+
+	if a.maxLatencyDelta > 0 && baseline.Count > a.baseline.Count {
+		delta := canary.P99 - baseline.P99
+		if delta > a.maxLatencyDelta {
+			return fmt.Sprintf("p99 latency of canary is %.2fms higher than baseline, exceeds %.2fms",
+				delta, a.maxLatencyDelta)
+		}
+	}
+
+	return ""
+}
+
+// errorRate returns the error percentage of the requests between the stats.
+func errorRate(current, begin *httpstat.Status) float64 {
+	count := current.Count - begin.Count
+	if count == 0 {
+		return 0
+	}
+	return float64(current.ErrCount-begin.ErrCount) * 100 / float64(count)
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package canaryanalysis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/httpstat"
+)
+
+func stat(count, errCount uint64, p99 float64) *httpstat.Status {
+	return &httpstat.Status{Count: count, ErrCount: errCount, P99: p99}
+}
+
+func TestAnalyzerPromote(t *testing.T) {
+	now := time.Now()
+	a := newAnalyzer(&Spec{
+		Steps:             []uint32{100, 500, 1000},
+		StepInterval:      "1m",
+		MinRequests:       10,
+		MaxErrorRateDelta: 5,
+		MaxLatencyDelta:   "100ms",
+	}, now)
+
+	if a.weight() != 100 {
+		t.Fatalf("expected weight 100, but got %d", a.weight())
+	}
+
+	// the first stats are the beginning of the step
+	a.analyze(stat(1000, 10, 50), stat(0, 0, 0), now)
+
+	// not enough requests of canary
+	now = now.Add(2 * time.Minute)
+	if a.analyze(stat(2000, 20, 50), stat(5, 0, 60), now) {
+		t.Fatalf("weight should not be changed without enough requests")
+	}
+
+	var count uint64 = 2000
+	for _, expected := range []uint32{500, 1000} {
+		count += 100
+		if !a.analyze(stat(count*10, count/10, 50), stat(count, count/50, 60), now) || a.weight() != expected {
+			t.Fatalf("expected weight %d, but got %d", expected, a.weight())
+		}
+		count += 100
+		if a.analyze(stat(count*10, count/10, 50), stat(count, count/50, 60), now.Add(30*time.Second)) {
+			t.Fatalf("weight should not be changed within step interval")
+		}
+		now = now.Add(time.Minute)
+	}
+
+	count += 100
+	if a.analyze(stat(count*10, count/10, 50), stat(count, count/50, 60), now) || a.phase != phasePromoted {
+		t.Fatalf("canary should be promoted, but got phase %s", a.phase)
+	}
+	if a.weight() != 1000 {
+		t.Fatalf("expected weight 1000, but got %d", a.weight())
+	}
+}
+
+func TestAnalyzerRollback(t *testing.T) {
+	now := time.Now()
+	spec := &Spec{
+		Steps:             []uint32{100, 1000},
+		StepInterval:      "1m",
+		MinRequests:       10,
+		MaxErrorRateDelta: 5,
+		MaxLatencyDelta:   "100ms",
+	}
+
+	// error rate: canary 10% vs baseline 1%
+	a := newAnalyzer(spec, now)
+	a.analyze(stat(1000, 10, 50), stat(0, 0, 0), now)
+	if !a.analyze(stat(2000, 20, 50), stat(100, 10, 50), now) || a.phase != phaseRolledBack {
+		t.Fatalf("canary should be rolled back, but got phase %s", a.phase)
+	}
+	if a.weight() != 0 || a.reason == "" {
+		t.Fatalf("expected weight 0 with reason, but got %d %q", a.weight(), a.reason)
+	}
+	if a.analyze(stat(3000, 20, 50), stat(200, 10, 50), now.Add(time.Hour)) {
+		t.Fatalf("rolled back canary should not be changed")
+	}
+
+	// latency: canary 200ms vs baseline 50ms
+	a = newAnalyzer(spec, now)
+	a.analyze(stat(1000, 10, 50), stat(0, 0, 0), now)
+	if !a.analyze(stat(2000, 20, 50), stat(100, 1, 200), now) || a.phase != phaseRolledBack {
+		t.Fatalf("canary should be rolled back, but got phase %s", a.phase)
+	}
+
+	// error budget: canary 3% exceeds 2% even if the baseline is worse
+	a = newAnalyzer(&Spec{
+		Steps:        []uint32{100, 1000},
+		StepInterval: "1m",
+		MinRequests:  10,
+		MaxErrorRate: 2,
+	}, now)
+	a.analyze(stat(1000, 100, 50), stat(0, 0, 0), now)
+	if a.analyze(stat(2000, 200, 50), stat(100, 2, 50), now) {
+		t.Fatalf("canary within the error budget should not be rolled back")
+	}
+	if !a.analyze(stat(3000, 300, 50), stat(200, 6, 50), now) || a.phase != phaseRolledBack {
+		t.Fatalf("canary should be rolled back, but got phase %s", a.phase)
+	}
+
+	// the stats are reset by updating the pipeline
+	a = newAnalyzer(spec, now)
+	a.analyze(stat(1000, 10, 50), stat(500, 0, 50), now)
+	if a.analyze(stat(100, 1, 50), stat(20, 20, 50), now) {
+		t.Fatalf("reset stats should be the new beginning")
+	}
+	if !a.analyze(stat(200, 2, 50), stat(40, 40, 50), now) || a.phase != phaseRolledBack {
+		t.Fatalf("canary should be rolled back, but got phase %s", a.phase)
+	}
+}
@@ -0,0 +1,326 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package canaryanalysis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/filter/proxy"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+	"github.com/megaease/easegress/pkg/object/trafficcontroller"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/httpstat"
+)
+
+const (
+	// Category is the category of CanaryAnalysis.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of CanaryAnalysis.
+	Kind = "CanaryAnalysis"
+
+	defaultNamespace   = "default"
+	defaultMinRequests = 100
+
+	analysisInterval = 5 * time.Second
+	alertTimeout     = 10 * time.Second
+)
+
+func init() {
+	supervisor.Register(&CanaryAnalysis{})
+}
+
+type (
+	// CanaryAnalysis is a business controller increasing the weight of a
+	// candidate pool of a proxy step by step, it rolls the weight back to 0
+	// if the canary is worse than the main pool, which is the baseline.
+	// The canary could also be a pipeline with the new version of the
+	// spec of the pipeline, which is the baseline then.
+	CanaryAnalysis struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		tc     *trafficcontroller.TrafficController
+		weight *int32
+
+		mutex    sync.Mutex
+		analyzer *analyzer
+
+		done chan struct{}
+	}
+
+	// Spec describes CanaryAnalysis.
+	Spec struct {
+		// Namespace is the namespace of the pipeline in TrafficController,
+		// it's the namespace of the pipelines created by admin by default.
+		Namespace     string   `yaml:"namespace" jsonschema:"omitempty"`
+		Pipeline      string   `yaml:"pipeline" jsonschema:"required"`
+		Proxy         string   `yaml:"proxy" jsonschema:"omitempty"`
+		CandidatePool int      `yaml:"candidatePool" jsonschema:"omitempty,minimum=0"`
+		Steps         []uint32 `yaml:"steps" jsonschema:"required,minItems=1"`
+		StepInterval  string   `yaml:"stepInterval" jsonschema:"required,format=duration"`
+		MinRequests   uint64   `yaml:"minRequests" jsonschema:"omitempty"`
+		// CanaryPipeline is the pipeline in the same namespace, which
+		// serves the weight of the traffic of the pipeline instead of it.
+		CanaryPipeline string `yaml:"canaryPipeline" jsonschema:"omitempty"`
+		// MaxErrorRate is the error budget of the canary in percentage.
+		MaxErrorRate float64 `yaml:"maxErrorRate" jsonschema:"omitempty,minimum=0,maximum=100"`
+		// MaxErrorRateDelta is in percentage points, e.g. 5 means 5%.
+		MaxErrorRateDelta float64 `yaml:"maxErrorRateDelta" jsonschema:"omitempty,minimum=0,maximum=100"`
+		MaxLatencyDelta   string  `yaml:"maxLatencyDelta" jsonschema:"omitempty,format=duration"`
+		AlertURL          string  `yaml:"alertURL" jsonschema:"omitempty,format=url"`
+	}
+
+	// Status is the status of CanaryAnalysis.
+	Status struct {
+		Phase  string `yaml:"phase"`
+		Step   int    `yaml:"step"`
+		Weight uint32 `yaml:"weight"`
+		Reason string `yaml:"reason,omitempty"`
+	}
+
+	// Alert is the body posted to the alert URL on rolling back.
+	Alert struct {
+		Name           string `json:"name"`
+		Pipeline       string `json:"pipeline"`
+		Proxy          string `json:"proxy,omitempty"`
+		CandidatePool  int    `json:"candidatePool"`
+		CanaryPipeline string `json:"canaryPipeline,omitempty"`
+		Reason         string `json:"reason"`
+		Timestamp      int64  `json:"timestamp"`
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	if (spec.Proxy == "") == (spec.CanaryPipeline == "") {
+		return fmt.Errorf("one and only one of proxy and canaryPipeline must be specified")
+	}
+	if spec.CanaryPipeline == spec.Pipeline {
+		return fmt.Errorf("canaryPipeline must be different from pipeline")
+	}
+
+	for i, step := range spec.Steps {
+		if step == 0 || step > 1000 {
+			return fmt.Errorf("step %d out of range (0, 1000]", step)
+		}
+		if i > 0 && step <= spec.Steps[i-1] {
+			return fmt.Errorf("steps must be in ascending order")
+		}
+	}
+
+	if spec.MaxErrorRate == 0 && spec.MaxErrorRateDelta == 0 && spec.MaxLatencyDelta == "" {
+		return fmt.Errorf("none of maxErrorRate, maxErrorRateDelta and maxLatencyDelta is specified")
+	}
+
+	return nil
+}
+
+// Category returns the category of CanaryAnalysis.
+func (ca *CanaryAnalysis) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of CanaryAnalysis.
+func (ca *CanaryAnalysis) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of CanaryAnalysis.
+func (ca *CanaryAnalysis) DefaultSpec() interface{} {
+	return &Spec{
+		Namespace:   defaultNamespace,
+		MinRequests: defaultMinRequests,
+	}
+}
+
+// Init initializes CanaryAnalysis.
+func (ca *CanaryAnalysis) Init(superSpec *supervisor.Spec) {
+	ca.superSpec, ca.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	ca.reload()
+}
+
+// Inherit inherits previous generation of CanaryAnalysis.
+func (ca *CanaryAnalysis) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	previousGeneration.Close()
+	ca.Init(superSpec)
+}
+
+func (ca *CanaryAnalysis) reload() {
+	entity, exists := ca.superSpec.Super().GetSystemController(trafficcontroller.Kind)
+	if !exists {
+		panic(fmt.Errorf("BUG: traffic controller not found"))
+	}
+
+	tc, ok := entity.Instance().(*trafficcontroller.TrafficController)
+	if !ok {
+		panic(fmt.Errorf("BUG: want *TrafficController, got %T", entity.Instance()))
+	}
+
+	if ca.spec.Namespace == "" {
+		ca.spec.Namespace = defaultNamespace
+	}
+
+	ca.tc = tc
+	if ca.spec.CanaryPipeline != "" {
+		rollout := httppipeline.GetRollout(ca.spec.Pipeline)
+		rollout.Start(ca.spec.CanaryPipeline)
+		ca.weight = rollout.Weight()
+	} else {
+		ca.weight = proxy.CanaryWeight(ca.spec.Pipeline, ca.spec.Proxy, ca.spec.CandidatePool)
+	}
+	ca.analyzer = newAnalyzer(ca.spec, time.Now())
+	atomic.StoreInt32(ca.weight, int32(ca.analyzer.weight()))
+	ca.done = make(chan struct{})
+
+	go ca.run()
+}
+
+func (ca *CanaryAnalysis) run() {
+	ticker := time.NewTicker(analysisInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ca.done:
+			return
+		case now := <-ticker.C:
+			ca.analyze(now)
+		}
+	}
+}
+
+func (ca *CanaryAnalysis) analyze(now time.Time) {
+	baseline, canary := ca.getStats()
+	if baseline == nil || canary == nil {
+		return
+	}
+
+	ca.mutex.Lock()
+	defer ca.mutex.Unlock()
+
+	a := ca.analyzer
+	if !a.analyze(baseline, canary, now) {
+		if a.phase == phasePromoted && a.reason == "" {
+			a.reason = "all steps passed"
+			logger.Infof("canary analysis %s promoted the canary to weight %d",
+				ca.superSpec.Name(), a.weight())
+		}
+		return
+	}
+
+	atomic.StoreInt32(ca.weight, int32(a.weight()))
+	if a.phase == phaseRolledBack {
+		logger.Errorf("canary analysis %s rolled back the canary: %s", ca.superSpec.Name(), a.reason)
+		ca.alert(a.reason, now)
+		return
+	}
+
+	logger.Infof("canary analysis %s increased the weight of the canary to %d",
+		ca.superSpec.Name(), a.weight())
+}
+
+// getStats returns the stats of the baseline and the canary, they are
+// nil if the pipeline, the proxy or the candidate pool doesn't exist.
+func (ca *CanaryAnalysis) getStats() (baseline, canary *httpstat.Status) {
+	if ca.spec.CanaryPipeline != "" {
+		return httppipeline.GetRollout(ca.spec.Pipeline).Stats()
+	}
+
+	entity, exists := ca.tc.GetHTTPPipeline(ca.spec.Namespace, ca.spec.Pipeline)
+	if !exists {
+		return nil, nil
+	}
+
+	pipelineStatus, ok := entity.Instance().Status().ObjectStatus.(*httppipeline.Status)
+	if !ok {
+		return nil, nil
+	}
+
+	proxyStatus, ok := pipelineStatus.Filters[ca.spec.Proxy].(*proxy.Status)
+	if !ok || proxyStatus.MainPool == nil || ca.spec.CandidatePool >= len(proxyStatus.CandidatePools) {
+		return nil, nil
+	}
+
+	return proxyStatus.MainPool.Stat, proxyStatus.CandidatePools[ca.spec.CandidatePool].Stat
+}
+
+func (ca *CanaryAnalysis) alert(reason string, now time.Time) {
+	if ca.spec.AlertURL == "" {
+		return
+	}
+
+	body, err := json.Marshal(&Alert{
+		Name:           ca.superSpec.Name(),
+		Pipeline:       ca.spec.Pipeline,
+		Proxy:          ca.spec.Proxy,
+		CandidatePool:  ca.spec.CandidatePool,
+		CanaryPipeline: ca.spec.CanaryPipeline,
+		Reason:         reason,
+		Timestamp:      now.Unix(),
+	})
+	if err != nil {
+		logger.Errorf("BUG: marshal alert failed: %v", err)
+		return
+	}
+
+	go func() {
+		client := &http.Client{Timeout: alertTimeout}
+		resp, err := client.Post(ca.spec.AlertURL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			logger.Errorf("canary analysis %s post alert failed: %v", ca.superSpec.Name(), err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			logger.Errorf("canary analysis %s post alert got status code %d",
+				ca.superSpec.Name(), resp.StatusCode)
+		}
+	}()
+}
+
+// Status returns the status of CanaryAnalysis.
+func (ca *CanaryAnalysis) Status() *supervisor.Status {
+	ca.mutex.Lock()
+	defer ca.mutex.Unlock()
+
+	a := ca.analyzer
+	return &supervisor.Status{
+		ObjectStatus: &Status{
+			Phase:  a.phase,
+			Step:   a.step,
+			Weight: a.weight(),
+			Reason: a.reason,
+		},
+	}
+}
+
+// Close closes CanaryAnalysis, the candidate pool is chosen by its filter
+// again after closing, and the canary pipeline serves no traffic of the
+// pipeline.
+func (ca *CanaryAnalysis) Close() {
+	close(ca.done)
+	atomic.StoreInt32(ca.weight, -1)
+}
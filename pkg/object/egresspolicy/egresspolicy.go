@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package egresspolicy
+
+import (
+	"fmt"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/egress"
+)
+
+const (
+	// Category is the category of EgressPolicy.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of EgressPolicy.
+	Kind = "EgressPolicy"
+)
+
+func init() {
+	supervisor.Register(&EgressPolicy{})
+}
+
+type (
+	// EgressPolicy is a business controller listing the only upstream
+	// addresses the gateway is allowed to dial, the addresses allowed by
+	// any EgressPolicy of the cluster are allowed. The URLs of servers
+	// are checked against it when validating specs, and the addresses
+	// are checked again when dialing.
+	EgressPolicy struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+		err       error
+	}
+
+	// Spec describes EgressPolicy.
+	Spec struct {
+		Hosts []string `yaml:"hosts" jsonschema:"omitempty,uniqueItems=true"`
+		CIDRs []string `yaml:"cidrs" jsonschema:"omitempty,uniqueItems=true,format=ipcidr-array"`
+		Ports []int    `yaml:"ports" jsonschema:"omitempty,uniqueItems=true"`
+	}
+
+	// Status is the status of EgressPolicy.
+	Status struct {
+		Error string `yaml:"error,omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	if len(spec.Hosts) == 0 && len(spec.CIDRs) == 0 {
+		return fmt.Errorf("empty hosts and cidrs")
+	}
+
+	return spec.allowlist().Validate()
+}
+
+func (spec *Spec) allowlist() *egress.Allowlist {
+	return &egress.Allowlist{
+		Hosts: spec.Hosts,
+		CIDRs: spec.CIDRs,
+		Ports: spec.Ports,
+	}
+}
+
+// Category returns the category of EgressPolicy.
+func (ep *EgressPolicy) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of EgressPolicy.
+func (ep *EgressPolicy) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of EgressPolicy.
+func (ep *EgressPolicy) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Init initializes EgressPolicy.
+func (ep *EgressPolicy) Init(superSpec *supervisor.Spec) {
+	ep.superSpec, ep.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	ep.reload()
+}
+
+// Inherit inherits previous generation of EgressPolicy.
+func (ep *EgressPolicy) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	// NOTE: The previous generation is not closed, otherwise nothing
+	// is restricted until the allowlist is set again.
+	ep.Init(superSpec)
+}
+
+func (ep *EgressPolicy) reload() {
+	ep.err = egress.Set(ep.superSpec.Name(), ep.spec.allowlist())
+	if ep.err != nil {
+		logger.Errorf("set egress allowlist of %s failed: %v", ep.superSpec.Name(), ep.err)
+	}
+}
+
+// Status returns the status of EgressPolicy.
+func (ep *EgressPolicy) Status() *supervisor.Status {
+	s := &Status{}
+	if ep.err != nil {
+		s.Error = ep.err.Error()
+	}
+	return &supervisor.Status{ObjectStatus: s}
+}
+
+// Close closes EgressPolicy.
+func (ep *EgressPolicy) Close() {
+	egress.Delete(ep.superSpec.Name())
+}
@@ -20,13 +20,13 @@ package eserviceregistry
 import (
 	"fmt"
 	"path"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/serviceregistry"
 	"github.com/megaease/easegress/pkg/supervisor"
-	"github.com/megaease/easegress/pkg/util/contexttool"
 
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"gopkg.in/yaml.v2"
@@ -42,6 +42,10 @@ const (
 	requestTimeout = 5 * time.Second
 )
 
+// reservedPrefixes are the prefixes used by the cluster of Easegress,
+// which can't be used to store the service instances.
+var reservedPrefixes = []string{"/leases/", "/status/", "/config/", "/wasm/", "/eg/", "/mesh/"}
+
 func init() {
 	supervisor.Register(&EtcdServiceRegistry{})
 }
@@ -57,8 +61,8 @@ type (
 		instances       map[string]*serviceregistry.ServiceInstanceSpec
 		notify          chan *serviceregistry.RegistryEvent
 
-		clientMutex sync.RWMutex
-		client      *clientv3.Client
+		storeMutex sync.RWMutex
+		store      store
 
 		statusMutex  sync.Mutex
 		instancesNum map[string]int
@@ -68,7 +72,9 @@ type (
 
 	// Spec describes the EtcdServiceRegistry.
 	Spec struct {
-		Endpoints    []string `yaml:"endpoints" jsonschema:"required,uniqueItems=true"`
+		// Endpoints is the endpoints of the external etcd, the cluster
+		// of Easegress is used if it is empty.
+		Endpoints    []string `yaml:"endpoints" jsonschema:"omitempty,uniqueItems=true"`
 		Prefix       string   `yaml:"prefix" jsonschema:"required,pattern=^/"`
 		CacheTimeout string   `yaml:"cacheTimeout" jsonschema:"required,format=duration"`
 	}
@@ -80,6 +86,22 @@ type (
 	}
 )
 
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	if len(spec.Endpoints) != 0 {
+		return nil
+	}
+
+	prefix := path.Clean(spec.Prefix) + "/"
+	for _, reserved := range reservedPrefixes {
+		if strings.HasPrefix(prefix, reserved) {
+			return fmt.Errorf("prefix %s is reserved by the cluster", reserved)
+		}
+	}
+
+	return nil
+}
+
 // Category returns the category of EtcdServiceRegistry.
 func (e *EtcdServiceRegistry) Category() supervisor.ObjectCategory {
 	return Category
@@ -119,7 +141,7 @@ func (e *EtcdServiceRegistry) reload() {
 	e.instancesNum = map[string]int{}
 	e.done = make(chan struct{})
 
-	_, err := e.getClient()
+	_, err := e.getStore()
 	if err != nil {
 		logger.Errorf("%s get etcd client failed: %v", e.superSpec.Name(), err)
 	}
@@ -129,25 +151,30 @@ func (e *EtcdServiceRegistry) reload() {
 	go e.run()
 }
 
-func (e *EtcdServiceRegistry) getClient() (*clientv3.Client, error) {
-	e.clientMutex.RLock()
-	if e.client != nil {
-		client := e.client
-		e.clientMutex.RUnlock()
-		return client, nil
+func (e *EtcdServiceRegistry) getStore() (store, error) {
+	e.storeMutex.RLock()
+	if e.store != nil {
+		s := e.store
+		e.storeMutex.RUnlock()
+		return s, nil
 	}
-	e.clientMutex.RUnlock()
+	e.storeMutex.RUnlock()
 
-	return e.buildClient()
+	return e.buildStore()
 }
 
-func (e *EtcdServiceRegistry) buildClient() (*clientv3.Client, error) {
-	e.clientMutex.Lock()
-	defer e.clientMutex.Unlock()
+func (e *EtcdServiceRegistry) buildStore() (store, error) {
+	e.storeMutex.Lock()
+	defer e.storeMutex.Unlock()
 
 	// DCL
-	if e.client != nil {
-		return e.client, nil
+	if e.store != nil {
+		return e.store, nil
+	}
+
+	if len(e.spec.Endpoints) == 0 {
+		e.store = &clusterStore{cluster: e.superSpec.Super().Cluster()}
+		return e.store, nil
 	}
 
 	client, err := clientv3.New(clientv3.Config{
@@ -163,27 +190,27 @@ func (e *EtcdServiceRegistry) buildClient() (*clientv3.Client, error) {
 		return nil, err
 	}
 
-	e.client = client
+	e.store = &clientStore{client: client}
 
-	return client, nil
+	return e.store, nil
 }
 
-func (e *EtcdServiceRegistry) closeClient() {
-	e.clientMutex.Lock()
-	defer e.clientMutex.Unlock()
+func (e *EtcdServiceRegistry) closeStore() {
+	e.storeMutex.Lock()
+	defer e.storeMutex.Unlock()
 
-	if e.client == nil {
+	if e.store == nil {
 		return
 	}
-	err := e.client.Close()
+	err := e.store.close()
 	if err != nil {
 		logger.Errorf("%s close etcd client failed: %v", e.superSpec.Name(), err)
 	}
-	e.client = nil
+	e.store = nil
 }
 
 func (e *EtcdServiceRegistry) run() {
-	defer e.closeClient()
+	defer e.closeStore()
 
 	cacheTimeout, err := time.ParseDuration(e.spec.CacheTimeout)
 	if err != nil {
@@ -194,16 +221,58 @@ func (e *EtcdServiceRegistry) run() {
 
 	e.update()
 
+	// The watch makes the changes take effect at once, and the periodical
+	// update is kept as the fallback in case of the watch is broken.
+	var (
+		watchCh     <-chan struct{}
+		cancelWatch func()
+	)
+	defer func() {
+		if cancelWatch != nil {
+			cancelWatch()
+		}
+	}()
+
 	for {
+		if watchCh == nil {
+			watchCh, cancelWatch = e.watch()
+		}
+
 		select {
 		case <-e.done:
 			return
+		case _, ok := <-watchCh:
+			if !ok {
+				logger.Warnf("%s watch %s broken", e.superSpec.Name(), e.spec.Prefix)
+				cancelWatch()
+				watchCh, cancelWatch = nil, nil
+				continue
+			}
+			e.update()
 		case <-time.After(cacheTimeout):
 			e.update()
 		}
 	}
 }
 
+// watch watches the prefix of the spec, it returns nil channel and cancel
+// function if failed, so the caller falls back to the periodical update.
+func (e *EtcdServiceRegistry) watch() (<-chan struct{}, func()) {
+	s, err := e.getStore()
+	if err != nil {
+		logger.Errorf("%s get etcd client failed: %v", e.superSpec.Name(), err)
+		return nil, nil
+	}
+
+	ch, cancel, err := s.watchPrefix(e.spec.Prefix)
+	if err != nil {
+		logger.Errorf("%s watch %s failed: %v", e.superSpec.Name(), e.spec.Prefix, err)
+		return nil, nil
+	}
+
+	return ch, cancel
+}
+
 func (e *EtcdServiceRegistry) update() {
 	instances, err := e.ListAllServiceInstances()
 	if err != nil {
@@ -244,7 +313,7 @@ func (e *EtcdServiceRegistry) update() {
 func (e *EtcdServiceRegistry) Status() *supervisor.Status {
 	s := &Status{}
 
-	_, err := e.getClient()
+	_, err := e.getStore()
 	if err != nil {
 		s.Health = err.Error()
 	} else {
@@ -281,13 +350,13 @@ func (e *EtcdServiceRegistry) Notify() <-chan *serviceregistry.RegistryEvent {
 
 // ApplyServiceInstances applies service instances to the registry.
 func (e *EtcdServiceRegistry) ApplyServiceInstances(instances map[string]*serviceregistry.ServiceInstanceSpec) error {
-	client, err := e.getClient()
+	s, err := e.getStore()
 	if err != nil {
 		return fmt.Errorf("%s get etcd client failed: %v",
 			e.superSpec.Name(), err)
 	}
 
-	ops := []clientv3.Op{}
+	kvs := make(map[string]*string, len(instances))
 	for _, instance := range instances {
 		err := instance.Validate()
 		if err != nil {
@@ -299,61 +368,50 @@ func (e *EtcdServiceRegistry) ApplyServiceInstances(instances map[string]*servic
 			return fmt.Errorf("marshal %+v to yaml failed: %v", instance, err)
 		}
 
-		key := e.serviceInstanceEtcdKey(instance)
-		ops = append(ops, clientv3.OpPut(key, string(buff)))
+		value := string(buff)
+		kvs[e.serviceInstanceEtcdKey(instance)] = &value
 	}
 
-	_, err = client.Txn(contexttool.TimeoutContext(requestTimeout)).Then(ops...).Commit()
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return s.putAndDelete(kvs)
 }
 
 // DeleteServiceInstances applies service instances to the registry.
 func (e *EtcdServiceRegistry) DeleteServiceInstances(instances map[string]*serviceregistry.ServiceInstanceSpec) error {
-	client, err := e.getClient()
+	s, err := e.getStore()
 	if err != nil {
 		return fmt.Errorf("%s get etcd client failed: %v",
 			e.superSpec.Name(), err)
 	}
 
-	ops := []clientv3.Op{}
+	kvs := make(map[string]*string, len(instances))
 	for _, instance := range instances {
-		key := e.serviceInstanceEtcdKey(instance)
-		ops = append(ops, clientv3.OpDelete(key))
+		kvs[e.serviceInstanceEtcdKey(instance)] = nil
 	}
 
-	_, err = client.Txn(contexttool.TimeoutContext(requestTimeout)).Then(ops...).Commit()
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return s.putAndDelete(kvs)
 }
 
 // GetServiceInstance get service instance from the registry.
 func (e *EtcdServiceRegistry) GetServiceInstance(serviceName, instanceID string) (*serviceregistry.ServiceInstanceSpec, error) {
-	client, err := e.getClient()
+	s, err := e.getStore()
 	if err != nil {
 		return nil, fmt.Errorf("%s get etcd client failed: %v",
 			e.superSpec.Name(), err)
 	}
 
-	resp, err := client.Get(contexttool.TimeoutContext(requestTimeout), e.serviceInstanceEtcdKeyFromRaw(serviceName, instanceID))
+	value, err := s.get(e.serviceInstanceEtcdKeyFromRaw(serviceName, instanceID))
 	if err != nil {
 		return nil, err
 	}
 
-	if len(resp.Kvs) == 0 {
+	if value == nil {
 		return nil, fmt.Errorf("%s/%s not found", serviceName, instanceID)
 	}
 
 	instance := &serviceregistry.ServiceInstanceSpec{}
-	err = yaml.Unmarshal(resp.Kvs[0].Value, instance)
+	err = yaml.Unmarshal([]byte(*value), instance)
 	if err != nil {
-		return nil, fmt.Errorf("unmarshal %s to yaml failed: %v", resp.Kvs[0].Value, err)
+		return nil, fmt.Errorf("unmarshal %s to yaml failed: %v", *value, err)
 	}
 
 	err = instance.Validate()
@@ -366,23 +424,23 @@ func (e *EtcdServiceRegistry) GetServiceInstance(serviceName, instanceID string)
 
 // ListServiceInstances list service instances of one service from the registry.
 func (e *EtcdServiceRegistry) ListServiceInstances(serviceName string) (map[string]*serviceregistry.ServiceInstanceSpec, error) {
-	client, err := e.getClient()
+	s, err := e.getStore()
 	if err != nil {
 		return nil, fmt.Errorf("%s get etcd client failed: %v",
 			e.superSpec.Name(), err)
 	}
 
-	resp, err := client.Get(contexttool.TimeoutContext(requestTimeout), e.serviceEtcdPrefix(serviceName), clientv3.WithPrefix())
+	kvs, err := s.getPrefix(e.serviceEtcdPrefix(serviceName))
 	if err != nil {
 		return nil, err
 	}
 
 	instances := make(map[string]*serviceregistry.ServiceInstanceSpec)
-	for _, kv := range resp.Kvs {
+	for _, value := range kvs {
 		instance := &serviceregistry.ServiceInstanceSpec{}
-		err = yaml.Unmarshal(kv.Value, instance)
+		err = yaml.Unmarshal([]byte(value), instance)
 		if err != nil {
-			return nil, fmt.Errorf("unmarshal %s to yaml failed: %v", kv.Value, err)
+			return nil, fmt.Errorf("unmarshal %s to yaml failed: %v", value, err)
 		}
 
 		err = instance.Validate()
@@ -398,23 +456,23 @@ func (e *EtcdServiceRegistry) ListServiceInstances(serviceName string) (map[stri
 
 // ListAllServiceInstances list all service instances from the registry.
 func (e *EtcdServiceRegistry) ListAllServiceInstances() (map[string]*serviceregistry.ServiceInstanceSpec, error) {
-	client, err := e.getClient()
+	s, err := e.getStore()
 	if err != nil {
 		return nil, fmt.Errorf("%s get etcd client failed: %v",
 			e.superSpec.Name(), err)
 	}
 
-	resp, err := client.Get(contexttool.TimeoutContext(requestTimeout), e.spec.Prefix, clientv3.WithPrefix())
+	kvs, err := s.getPrefix(e.spec.Prefix)
 	if err != nil {
 		return nil, err
 	}
 
 	instances := make(map[string]*serviceregistry.ServiceInstanceSpec)
-	for _, kv := range resp.Kvs {
+	for _, value := range kvs {
 		instance := &serviceregistry.ServiceInstanceSpec{}
-		err = yaml.Unmarshal(kv.Value, instance)
+		err = yaml.Unmarshal([]byte(value), instance)
 		if err != nil {
-			return nil, fmt.Errorf("unmarshal %s to yaml failed: %v", kv.Value, err)
+			return nil, fmt.Errorf("unmarshal %s to yaml failed: %v", value, err)
 		}
 
 		err = instance.Validate()
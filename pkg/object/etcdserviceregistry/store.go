@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eserviceregistry
+
+import (
+	"context"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/util/contexttool"
+)
+
+type (
+	// store is the etcd storing the service instances, which is either
+	// an external etcd or the cluster of Easegress.
+	store interface {
+		get(key string) (*string, error)
+		getPrefix(prefix string) (map[string]string, error)
+		// putAndDelete puts the keys with values and deletes the keys
+		// with nil values in one transaction.
+		putAndDelete(kvs map[string]*string) error
+		// watchPrefix notifies the changes under the prefix until the
+		// cancel function is called, the channel is closed if the watch
+		// is broken.
+		watchPrefix(prefix string) (ch <-chan struct{}, cancel func(), err error)
+		close() error
+	}
+
+	clientStore struct {
+		client *clientv3.Client
+	}
+
+	clusterStore struct {
+		cluster cluster.Cluster
+	}
+)
+
+func (s *clientStore) get(key string) (*string, error) {
+	resp, err := s.client.Get(contexttool.TimeoutContext(requestTimeout), key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+
+	value := string(resp.Kvs[0].Value)
+	return &value, nil
+}
+
+func (s *clientStore) getPrefix(prefix string) (map[string]string, error) {
+	resp, err := s.client.Get(contexttool.TimeoutContext(requestTimeout), prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	kvs := make(map[string]string, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		kvs[string(kv.Key)] = string(kv.Value)
+	}
+	return kvs, nil
+}
+
+func (s *clientStore) putAndDelete(kvs map[string]*string) error {
+	ops := []clientv3.Op{}
+	for key, value := range kvs {
+		if value != nil {
+			ops = append(ops, clientv3.OpPut(key, *value))
+		} else {
+			ops = append(ops, clientv3.OpDelete(key))
+		}
+	}
+
+	_, err := s.client.Txn(contexttool.TimeoutContext(requestTimeout)).Then(ops...).Commit()
+	return err
+}
+
+func (s *clientStore) watchPrefix(prefix string) (<-chan struct{}, func(), error) {
+	// NOTE: Can't use Context with timeout here.
+	ctx, cancel := context.WithCancel(context.Background())
+	watchResp := s.client.Watch(ctx, prefix, clientv3.WithPrefix())
+
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer close(ch)
+
+		for resp := range watchResp {
+			if resp.Canceled || resp.Err() != nil {
+				return
+			}
+			notify(ch)
+		}
+	}()
+
+	return ch, cancel, nil
+}
+
+func (s *clientStore) close() error {
+	return s.client.Close()
+}
+
+func (s *clusterStore) get(key string) (*string, error) {
+	return s.cluster.Get(key)
+}
+
+func (s *clusterStore) getPrefix(prefix string) (map[string]string, error) {
+	return s.cluster.GetPrefix(prefix)
+}
+
+func (s *clusterStore) putAndDelete(kvs map[string]*string) error {
+	return s.cluster.PutAndDelete(kvs)
+}
+
+func (s *clusterStore) watchPrefix(prefix string) (<-chan struct{}, func(), error) {
+	watcher, err := s.cluster.Watcher()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	events, err := watcher.WatchPrefix(prefix)
+	if err != nil {
+		watcher.Close()
+		return nil, nil, err
+	}
+
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer close(ch)
+
+		for range events {
+			notify(ch)
+		}
+	}()
+
+	return ch, watcher.Close, nil
+}
+
+// close does nothing since the cluster is not owned by the registry.
+func (s *clusterStore) close() error {
+	return nil
+}
+
+// notify notifies the channel, the notification is merged into the
+// pending one if there is.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
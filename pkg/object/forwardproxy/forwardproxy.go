@@ -0,0 +1,218 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package forwardproxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"path"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Category is the category of ForwardProxy.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of ForwardProxy.
+	Kind = "ForwardProxy"
+)
+
+func init() {
+	supervisor.Register(&ForwardProxy{})
+}
+
+type (
+	// ForwardProxy is a business controller serving HTTP and SOCKS5
+	// forward proxy on the same port, so the internal clients egress
+	// through the gateway under its control. The destinations are
+	// checked against the rules of the spec and the user, and the
+	// allowlists of EgressPolicy.
+	ForwardProxy struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+		server    *server
+	}
+
+	// Spec describes ForwardProxy.
+	Spec struct {
+		Port           uint16 `yaml:"port" jsonschema:"required,minimum=1"`
+		MaxConnections uint32 `yaml:"maxConnections" jsonschema:"omitempty"`
+		DialTimeout    string `yaml:"dialTimeout" jsonschema:"omitempty,format=duration"`
+
+		// AllowHosts and DenyHosts are the hostname patterns of the
+		// destinations, e.g. "*.example.com", denying wins.
+		AllowHosts []string `yaml:"allowHosts" jsonschema:"omitempty,uniqueItems=true"`
+		DenyHosts  []string `yaml:"denyHosts" jsonschema:"omitempty,uniqueItems=true"`
+		// Users are required to authenticate if it's not empty.
+		Users []*User `yaml:"users" jsonschema:"omitempty"`
+		// MITM intercepts the TLS of CONNECT tunnels, it's disabled by default.
+		MITM *MITMSpec `yaml:"mitm,omitempty" jsonschema:"omitempty"`
+	}
+
+	// User is a user of ForwardProxy, its rules of destinations apply
+	// after the ones of the spec.
+	User struct {
+		Username string `yaml:"username" jsonschema:"required"`
+		Password string `yaml:"password" jsonschema:"required"`
+		// Rate is the bytes per second transferred by all connections of the user.
+		Rate       uint64   `yaml:"rate" jsonschema:"omitempty"`
+		AllowHosts []string `yaml:"allowHosts" jsonschema:"omitempty,uniqueItems=true"`
+		DenyHosts  []string `yaml:"denyHosts" jsonschema:"omitempty,uniqueItems=true"`
+	}
+
+	// MITMSpec describes the CA signing the certificates of intercepted hosts.
+	MITMSpec struct {
+		CertBase64 string `yaml:"certBase64" jsonschema:"required,format=base64"`
+		KeyBase64  string `yaml:"keyBase64" jsonschema:"required,format=base64"`
+		// Hosts are the hostname patterns to intercept, all hosts are
+		// intercepted if it's empty.
+		Hosts []string `yaml:"hosts" jsonschema:"omitempty,uniqueItems=true"`
+	}
+
+	// Status is the status of ForwardProxy.
+	Status struct {
+		Connections       uint64 `yaml:"connections"`
+		ActiveConnections int64  `yaml:"activeConnections"`
+		Denied            uint64 `yaml:"denied"`
+		// Users are the bytes transferred by every user.
+		Users map[string]uint64 `yaml:"users,omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	if err := validatePatterns(spec.AllowHosts, spec.DenyHosts); err != nil {
+		return err
+	}
+
+	usernames := map[string]struct{}{}
+	for _, u := range spec.Users {
+		if _, exists := usernames[u.Username]; exists {
+			return fmt.Errorf("user %s is duplicated", u.Username)
+		}
+		usernames[u.Username] = struct{}{}
+
+		if err := validatePatterns(u.AllowHosts, u.DenyHosts); err != nil {
+			return fmt.Errorf("user %s: %v", u.Username, err)
+		}
+	}
+
+	if spec.MITM != nil {
+		if err := validatePatterns(spec.MITM.Hosts); err != nil {
+			return fmt.Errorf("mitm: %v", err)
+		}
+		if _, err := spec.MITM.ca(); err != nil {
+			return fmt.Errorf("mitm: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func validatePatterns(patternsList ...[]string) error {
+	for _, patterns := range patternsList {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid host pattern %s: %v", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ca parses the CA certificate and its key.
+func (spec *MITMSpec) ca() (*tls.Certificate, error) {
+	certPem, err := base64.StdEncoding.DecodeString(spec.CertBase64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certBase64: %v", err)
+	}
+	keyPem, err := base64.StdEncoding.DecodeString(spec.KeyBase64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keyBase64: %v", err)
+	}
+
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return nil, fmt.Errorf("generate x509 key pair failed: %v", err)
+	}
+
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate failed: %v", err)
+	}
+	if !cert.Leaf.IsCA {
+		return nil, fmt.Errorf("certificate is not a ca")
+	}
+
+	return &cert, nil
+}
+
+// Category returns the category of ForwardProxy.
+func (fp *ForwardProxy) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of ForwardProxy.
+func (fp *ForwardProxy) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of ForwardProxy.
+func (fp *ForwardProxy) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Init initializes ForwardProxy.
+func (fp *ForwardProxy) Init(superSpec *supervisor.Spec) {
+	fp.superSpec, fp.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	fp.reload()
+}
+
+// Inherit inherits previous generation of ForwardProxy.
+func (fp *ForwardProxy) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	// NOTE: The previous generation must release the port first.
+	previousGeneration.Close()
+	fp.Init(superSpec)
+}
+
+func (fp *ForwardProxy) reload() {
+	fp.server = newServer(fp.superSpec.Name(), fp.spec)
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", fp.spec.Port))
+	if err != nil {
+		logger.Errorf("%s listen on port %d failed: %v", fp.superSpec.Name(), fp.spec.Port, err)
+		return
+	}
+
+	go fp.server.serve(listener)
+}
+
+// Status returns the status of ForwardProxy.
+func (fp *ForwardProxy) Status() *supervisor.Status {
+	return &supervisor.Status{ObjectStatus: fp.server.status()}
+}
+
+// Close closes ForwardProxy.
+func (fp *ForwardProxy) Close() {
+	fp.server.close()
+}
@@ -0,0 +1,311 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package forwardproxy
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func TestRules(t *testing.T) {
+	r := newRules([]string{"*.Example.com", "10.0.0.*"}, []string{"secret.example.com"})
+
+	cases := map[string]bool{
+		"www.example.com":    true,
+		"WWW.EXAMPLE.COM":    true,
+		"secret.example.com": false,
+		"example.org":        false,
+		"10.0.0.1":           true,
+		"10.0.1.1":           false,
+	}
+	for host, allowed := range cases {
+		if r.allowed(host) != allowed {
+			t.Errorf("host %s should be allowed: %v", host, allowed)
+		}
+	}
+
+	if !newRules(nil, nil).allowed("example.org") {
+		t.Error("all hosts should be allowed without rules")
+	}
+}
+
+func TestBucket(t *testing.T) {
+	now := time.Now()
+	b := newBucket(1000, now)
+
+	if d := b.reserve(1000, now); d != 0 {
+		t.Errorf("burst should not wait, but got %v", d)
+	}
+	if d := b.reserve(500, now); d != 500*time.Millisecond {
+		t.Errorf("should wait 500ms, but got %v", d)
+	}
+	if d := b.reserve(500, now.Add(time.Second)); d != 0 {
+		t.Errorf("refilled bucket should not wait, but got %v", d)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	spec := Spec{Port: 8080, AllowHosts: []string{"["}}
+	if spec.Validate() == nil {
+		t.Error("invalid pattern should fail")
+	}
+
+	spec = Spec{Port: 8080, Users: []*User{{Username: "a"}, {Username: "a"}}}
+	if spec.Validate() == nil {
+		t.Error("duplicated users should fail")
+	}
+
+	spec = Spec{Port: 8080, MITM: &MITMSpec{CertBase64: "bm8=", KeyBase64: "bm8="}}
+	if spec.Validate() == nil {
+		t.Error("invalid ca should fail")
+	}
+}
+
+// startEcho starts a TCP server echoing the data, it returns the address.
+func startEcho(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func startServer(t *testing.T, spec *Spec) (*server, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+
+	s := newServer("test", spec)
+	go s.serve(l)
+	t.Cleanup(s.close)
+
+	return s, l.Addr().String()
+}
+
+func assertEcho(t *testing.T, conn io.ReadWriter) {
+	if _, err := io.WriteString(conn, "ping"); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	buff := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buff); err != nil || string(buff) != "ping" {
+		t.Fatalf("should echo ping, but got %q, %v", buff, err)
+	}
+}
+
+func TestHTTPConnect(t *testing.T) {
+	echoAddr := startEcho(t)
+	s, addr := startServer(t, &Spec{
+		DenyHosts: []string{"denied.example.com"},
+		Users:     []*User{{Username: "alice", Password: "secret", Rate: 1 << 20}},
+	})
+
+	connect := func(target, username, password string) (net.Conn, *bufio.Reader, int) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		req := "CONNECT " + target + " HTTP/1.1\r\nHost: " + target + "\r\n"
+		if username != "" {
+			credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+			req += "Proxy-Authorization: Basic " + credentials + "\r\n"
+		}
+		io.WriteString(conn, req+"\r\n")
+
+		r := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(r, &http.Request{Method: http.MethodConnect})
+		if err != nil {
+			t.Fatalf("read response failed: %v", err)
+		}
+		return conn, r, resp.StatusCode
+	}
+
+	if _, _, code := connect(echoAddr, "", ""); code != http.StatusProxyAuthRequired {
+		t.Errorf("status code should be %d, but got %d", http.StatusProxyAuthRequired, code)
+	}
+	if _, _, code := connect(echoAddr, "alice", "wrong"); code != http.StatusProxyAuthRequired {
+		t.Errorf("status code should be %d, but got %d", http.StatusProxyAuthRequired, code)
+	}
+	if _, _, code := connect("denied.example.com:443", "alice", "secret"); code != http.StatusForbidden {
+		t.Errorf("status code should be %d, but got %d", http.StatusForbidden, code)
+	}
+
+	conn, r, code := connect(echoAddr, "alice", "secret")
+	if code != http.StatusOK {
+		t.Fatalf("status code should be %d, but got %d", http.StatusOK, code)
+	}
+	assertEcho(t, struct {
+		io.Reader
+		io.Writer
+	}{r, conn})
+
+	status := s.status()
+	if status.Denied != 1 || status.Users["alice"] != 8 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
+
+func TestSOCKS5(t *testing.T) {
+	echoAddr := startEcho(t)
+	_, addr := startServer(t, &Spec{
+		AllowHosts: []string{"127.0.0.1"},
+		Users:      []*User{{Username: "bob", Password: "secret"}},
+	})
+
+	connect := func(host string, port int, password string) (net.Conn, byte) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		conn.Write([]byte{socks5Version, 1, socks5AuthPassword})
+		reply := make([]byte, 2)
+		if _, err := io.ReadFull(conn, reply); err != nil || reply[1] != socks5AuthPassword {
+			t.Fatalf("negotiate method failed: %v, %v", reply, err)
+		}
+
+		auth := []byte{socks5PasswordVersion, 3}
+		auth = append(auth, "bob"...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		conn.Write(auth)
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			t.Fatalf("read auth reply failed: %v", err)
+		}
+		if reply[1] != 0 {
+			return conn, 0xff
+		}
+
+		req := []byte{socks5Version, socks5CmdConnect, 0, socks5AddrDomain, byte(len(host))}
+		req = append(req, host...)
+		req = append(req, 0, 0)
+		binary.BigEndian.PutUint16(req[len(req)-2:], uint16(port))
+		conn.Write(req)
+
+		reply = make([]byte, 10)
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			t.Fatalf("read reply failed: %v", err)
+		}
+		return conn, reply[1]
+	}
+
+	echoHost, echoPortStr, _ := net.SplitHostPort(echoAddr)
+	echoPort, _ := net.LookupPort("tcp", echoPortStr)
+
+	if _, code := connect(echoHost, echoPort, "wrong"); code != 0xff {
+		t.Errorf("authentication should fail")
+	}
+	if _, code := connect("example.com", 80, "secret"); code != socks5ReplyNotAllowed {
+		t.Errorf("reply should be %d, but got %d", socks5ReplyNotAllowed, code)
+	}
+
+	conn, code := connect(echoHost, echoPort, "secret")
+	if code != socks5ReplySucceeded {
+		t.Fatalf("reply should be %d, but got %d", socks5ReplySucceeded, code)
+	}
+	assertEcho(t, conn)
+}
+
+func TestMITMCertificate(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+
+	spec := &MITMSpec{
+		CertBase64: base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		KeyBase64:  base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})),
+		Hosts:      []string{"*.example.com"},
+	}
+	if err := (Spec{Port: 8080, MITM: spec}).Validate(); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+
+	m, err := newMITM(spec)
+	if err != nil {
+		t.Fatalf("new mitm failed: %v", err)
+	}
+	if !m.match("www.example.com") || m.match("example.org") {
+		t.Error("unexpected match result")
+	}
+
+	now := time.Now()
+	cert, err := m.certificate("www.example.com", now)
+	if err != nil {
+		t.Fatalf("generate certificate failed: %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(m.ca.Leaf)
+	_, err = cert.Leaf.Verify(x509.VerifyOptions{DNSName: "www.example.com", Roots: roots})
+	if err != nil {
+		t.Errorf("verify certificate failed: %v", err)
+	}
+
+	if cached, _ := m.certificate("WWW.example.com", now); cached != cert {
+		t.Error("certificate should be cached")
+	}
+	if renewed, _ := m.certificate("www.example.com", now.Add(mitmCertValidity)); renewed == cert {
+		t.Error("certificate should be renewed before expired")
+	}
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package forwardproxy
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	mitmCertValidity = 24 * time.Hour
+	// mitmCertRenewBefore renews the cached certificates before they expire.
+	mitmCertRenewBefore = time.Hour
+)
+
+type (
+	// mitm intercepts the TLS of tunnels by the certificates signed by
+	// the CA on the fly, and forwards the decrypted HTTP requests.
+	mitm struct {
+		ca    *tls.Certificate
+		hosts []string
+
+		mutex sync.Mutex
+		certs map[string]*tls.Certificate
+	}
+
+	// transferWriter accounts and limits the bytes written by the user.
+	transferWriter struct {
+		u *user
+		w net.Conn
+	}
+)
+
+func newMITM(spec *MITMSpec) (*mitm, error) {
+	ca, err := spec.ca()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &mitm{
+		ca:    ca,
+		certs: map[string]*tls.Certificate{},
+	}
+	for _, host := range spec.Hosts {
+		m.hosts = append(m.hosts, strings.ToLower(host))
+	}
+
+	return m, nil
+}
+
+func (m *mitm) match(host string) bool {
+	return len(m.hosts) == 0 || matchAny(m.hosts, strings.ToLower(strings.Trim(host, "[]")))
+}
+
+// certificate returns the certificate of the host signed by the CA.
+func (m *mitm) certificate(host string, now time.Time) (*tls.Certificate, error) {
+	host = strings.ToLower(host)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if cert := m.certs[host]; cert != nil && now.Add(mitmCertRenewBefore).Before(cert.Leaf.NotAfter) {
+		return cert, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate key failed: %v", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generate serial number failed: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(mitmCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, m.ca.Leaf, &key.PublicKey, m.ca.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("create certificate failed: %v", err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate failed: %v", err)
+	}
+
+	cert := &tls.Certificate{
+		Certificate: [][]byte{der, m.ca.Certificate[0]},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+	m.certs[host] = cert
+
+	return cert, nil
+}
+
+// serve terminates the TLS of the client, and forwards the requests
+// to the address by HTTPS.
+func (m *mitm) serve(s *server, client net.Conn, addr string, u *user) {
+	defer client.Close()
+
+	host, _, _ := net.SplitHostPort(addr)
+	conn := tls.Server(client, &tls.Config{
+		NextProtos: []string{"http/1.1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			name := hello.ServerName
+			if name == "" {
+				name = host
+			}
+			return m.certificate(name, time.Now())
+		},
+	})
+
+	r := bufio.NewReader(conn)
+	w := &transferWriter{u: u, w: conn}
+	for {
+		req, err := http.ReadRequest(r)
+		if err != nil {
+			return
+		}
+
+		req.URL.Scheme = "https"
+		req.URL.Host = addr
+		req.RequestURI = ""
+		removeHopHeaders(req.Header)
+		logger.Debugf("%s intercepted %s %s", s.name, req.Method, req.URL)
+
+		resp, err := s.transport.RoundTrip(req)
+		if err != nil {
+			logger.Debugf("%s forward request to %s failed: %v", s.name, addr, err)
+			resp = &http.Response{
+				StatusCode: http.StatusBadGateway,
+				ProtoMajor: 1,
+				ProtoMinor: 1,
+				Close:      true,
+			}
+		}
+
+		err = resp.Write(w)
+		if resp.Body != nil {
+			resp.Body.Close()
+		}
+		if err != nil || req.Close || resp.Close {
+			return
+		}
+	}
+}
+
+func (tw *transferWriter) Write(p []byte) (int, error) {
+	if tw.u != nil {
+		tw.u.transfer(len(p))
+	}
+	return tw.w.Write(p)
+}
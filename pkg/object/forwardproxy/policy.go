@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package forwardproxy
+
+import (
+	"crypto/subtle"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// rules checks the hostnames of destinations by patterns.
+	rules struct {
+		allow []string
+		deny  []string
+	}
+
+	user struct {
+		name     string
+		password string
+		rules    *rules
+		// bucket is nil if the rate is not limited.
+		bucket *bucket
+		bytes  uint64
+	}
+
+	// bucket is the token bucket limiting the bytes per second.
+	bucket struct {
+		rate float64
+
+		mutex     sync.Mutex
+		tokens    float64
+		updatedAt time.Time
+	}
+)
+
+func newRules(allow, deny []string) *rules {
+	lower := func(patterns []string) []string {
+		result := make([]string, 0, len(patterns))
+		for _, pattern := range patterns {
+			result = append(result, strings.ToLower(pattern))
+		}
+		return result
+	}
+
+	return &rules{allow: lower(allow), deny: lower(deny)}
+}
+
+func matchAny(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, host); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed reports whether the host is allowed, it's denied if it
+// matches any deny pattern, or none of the allow patterns.
+func (r *rules) allowed(host string) bool {
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	if matchAny(r.deny, host) {
+		return false
+	}
+	return len(r.allow) == 0 || matchAny(r.allow, host)
+}
+
+func newUser(u *User) *user {
+	result := &user{
+		name:     u.Username,
+		password: u.Password,
+		rules:    newRules(u.AllowHosts, u.DenyHosts),
+	}
+	if u.Rate != 0 {
+		result.bucket = newBucket(u.Rate, time.Now())
+	}
+	return result
+}
+
+func (u *user) authenticate(password string) bool {
+	return subtle.ConstantTimeCompare([]byte(u.password), []byte(password)) == 1
+}
+
+// transfer accounts n bytes transferred by the user, and waits until
+// the bytes are allowed by the rate.
+func (u *user) transfer(n int) {
+	atomic.AddUint64(&u.bytes, uint64(n))
+	if u.bucket == nil {
+		return
+	}
+
+	if d := u.bucket.reserve(n, time.Now()); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+func newBucket(rate uint64, now time.Time) *bucket {
+	return &bucket{
+		rate:      float64(rate),
+		tokens:    float64(rate),
+		updatedAt: now,
+	}
+}
+
+// reserve takes n tokens, it returns how long to wait before
+// transferring the n bytes. The tokens could go negative, so a chunk
+// larger than the rate is delayed instead of rejected.
+func (b *bucket) reserve(n int, now time.Time) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if elapsed := now.Sub(b.updatedAt); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+		b.updatedAt = now
+	}
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
@@ -0,0 +1,534 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package forwardproxy
+
+import (
+	"bufio"
+	stdcontext "context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/egress"
+	"github.com/megaease/easegress/pkg/util/limitlistener"
+)
+
+const (
+	defaultDialTimeout = 10 * time.Second
+	handshakeTimeout   = 10 * time.Second
+	copyBufferSize     = 32 * 1024
+
+	socks5Version = 0x05
+)
+
+// hopHeaders are the hop-by-hop headers removed before forwarding.
+var hopHeaders = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate",
+	"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+type (
+	server struct {
+		name  string
+		rules *rules
+		// users is empty if authentication is not required.
+		users map[string]*user
+		mitm  *mitm
+
+		dial      egress.DialFunc
+		transport *http.Transport
+
+		maxConnections uint32
+		listener       net.Listener
+		httpListener   *connListener
+		httpServer     *http.Server
+
+		connections uint64
+		active      int64
+		denied      uint64
+
+		mutex  sync.Mutex
+		conns  map[net.Conn]struct{}
+		closed bool
+	}
+
+	// connListener is the listener of the HTTP server, which accepts
+	// the connections sniffed as HTTP.
+	connListener struct {
+		addr      net.Addr
+		conns     chan net.Conn
+		done      chan struct{}
+		closeOnce sync.Once
+	}
+
+	// trackedConn is the connection removed from the tracked ones when closed.
+	trackedConn struct {
+		net.Conn
+		s         *server
+		closeOnce sync.Once
+	}
+
+	// peekedConn reads from the buffered reader which may have peeked the connection.
+	peekedConn struct {
+		net.Conn
+		r *bufio.Reader
+	}
+)
+
+func newServer(name string, spec *Spec) *server {
+	dialTimeout := defaultDialTimeout
+	if spec.DialTimeout != "" {
+		// NOTE: It has been validated by format=duration.
+		dialTimeout, _ = time.ParseDuration(spec.DialTimeout)
+	}
+
+	s := &server{
+		name:           name,
+		rules:          newRules(spec.AllowHosts, spec.DenyHosts),
+		users:          map[string]*user{},
+		maxConnections: spec.MaxConnections,
+		conns:          map[net.Conn]struct{}{},
+	}
+
+	for _, u := range spec.Users {
+		s.users[u.Username] = newUser(u)
+	}
+
+	if spec.MITM != nil {
+		m, err := newMITM(spec.MITM)
+		if err != nil {
+			logger.Errorf("BUG: %s create mitm failed: %v", name, err)
+		} else {
+			s.mitm = m
+		}
+	}
+
+	s.dial = egress.Dialer((&net.Dialer{Timeout: dialTimeout}).DialContext)
+	s.transport = &http.Transport{
+		DialContext:           s.dial,
+		MaxIdleConnsPerHost:   16,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   handshakeTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	s.httpServer = &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: handshakeTimeout,
+	}
+
+	return s
+}
+
+func (s *server) serve(listener net.Listener) {
+	if s.maxConnections > 0 {
+		listener = limitlistener.NewLimitListener(listener, s.maxConnections)
+	}
+
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		listener.Close()
+		return
+	}
+	s.listener = listener
+	s.httpListener = newConnListener(listener.Addr())
+	s.mutex.Unlock()
+
+	go s.httpServer.Serve(s.httpListener)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mutex.Lock()
+			closed := s.closed
+			s.mutex.Unlock()
+			if !closed {
+				logger.Errorf("%s accept failed: %v", s.name, err)
+			}
+			return
+		}
+
+		if tc := s.track(conn); tc != nil {
+			go s.serveConn(tc)
+		}
+	}
+}
+
+// track tracks the connection to close it when the server is closed,
+// it returns nil if the server has been closed.
+func (s *server) track(conn net.Conn) net.Conn {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		conn.Close()
+		return nil
+	}
+
+	s.conns[conn] = struct{}{}
+	atomic.AddUint64(&s.connections, 1)
+	atomic.AddInt64(&s.active, 1)
+
+	return &trackedConn{Conn: conn, s: s}
+}
+
+func (c *trackedConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.s.mutex.Lock()
+		delete(c.s.conns, c.Conn)
+		c.s.mutex.Unlock()
+		atomic.AddInt64(&c.s.active, -1)
+	})
+	return c.Conn.Close()
+}
+
+func (c *peekedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// serveConn sniffs the protocol by the first byte, which is the
+// version of SOCKS5, or a letter of an HTTP method.
+func (s *server) serveConn(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	r := bufio.NewReader(conn)
+	first, err := r.Peek(1)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	pc := &peekedConn{Conn: conn, r: r}
+	if first[0] == socks5Version {
+		s.serveSOCKS5(pc)
+		return
+	}
+
+	conn.SetReadDeadline(time.Time{})
+	if !s.httpListener.push(pc) {
+		conn.Close()
+	}
+}
+
+// authenticate returns the user, it returns nil and true if
+// authentication is not required.
+func (s *server) authenticate(username, password string) (*user, bool) {
+	if len(s.users) == 0 {
+		return nil, true
+	}
+
+	u := s.users[username]
+	if u == nil || !u.authenticate(password) {
+		return nil, false
+	}
+	return u, true
+}
+
+// allowed reports whether the user is allowed to connect to the host.
+func (s *server) allowed(u *user, host string) bool {
+	if s.rules.allowed(host) && (u == nil || u.rules.allowed(host)) {
+		return true
+	}
+
+	atomic.AddUint64(&s.denied, 1)
+	return false
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.authenticateHTTP(r)
+	if !ok {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="easegress"`)
+		http.Error(w, http.StatusText(http.StatusProxyAuthRequired), http.StatusProxyAuthRequired)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		s.serveConnect(w, r, u)
+		return
+	}
+
+	if !r.URL.IsAbs() || r.URL.Scheme != "http" {
+		http.Error(w, "only absolute http urls are supported", http.StatusBadRequest)
+		return
+	}
+
+	s.forward(w, r, r.URL.Host, u)
+}
+
+func (s *server) authenticateHTTP(r *http.Request) (*user, bool) {
+	if len(s.users) == 0 {
+		return nil, true
+	}
+
+	auth := r.Header.Get("Proxy-Authorization")
+	const prefix = "Basic "
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return nil, false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(auth[len(prefix):])
+	if err != nil {
+		return nil, false
+	}
+
+	credentials := string(decoded)
+	i := strings.IndexByte(credentials, ':')
+	if i < 0 {
+		return nil, false
+	}
+
+	return s.authenticate(credentials[:i], credentials[i+1:])
+}
+
+func (s *server) serveConnect(w http.ResponseWriter, r *http.Request, u *user) {
+	addr := r.Host
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid address %s", addr), http.StatusBadRequest)
+		return
+	}
+
+	if !s.allowed(u, host) {
+		http.Error(w, fmt.Sprintf("destination %s is not allowed", host), http.StatusForbidden)
+		return
+	}
+
+	var target net.Conn
+	intercept := s.mitm != nil && s.mitm.match(host)
+	if !intercept {
+		target, err = s.dial(r.Context(), "tcp", addr)
+		if err != nil {
+			logger.Debugf("%s dial %s failed: %v", s.name, addr, err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		logger.Errorf("BUG: %s response writer is not a hijacker", s.name)
+		http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+		if target != nil {
+			target.Close()
+		}
+		return
+	}
+
+	conn, brw, err := hijacker.Hijack()
+	if err != nil {
+		logger.Errorf("%s hijack connection failed: %v", s.name, err)
+		if target != nil {
+			target.Close()
+		}
+		return
+	}
+
+	var client net.Conn = conn
+	if brw.Reader.Buffered() > 0 {
+		client = &peekedConn{Conn: conn, r: brw.Reader}
+	}
+
+	_, err = io.WriteString(client, "HTTP/1.1 200 Connection Established\r\n\r\n")
+	if err != nil {
+		client.Close()
+		if target != nil {
+			target.Close()
+		}
+		return
+	}
+
+	if intercept {
+		s.mitm.serve(s, client, addr, u)
+		return
+	}
+
+	s.tunnel(client, target, u)
+}
+
+// forward forwards the request to the address, and writes back the response.
+func (s *server) forward(w http.ResponseWriter, r *http.Request, addr string, u *user) {
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+
+	if !s.allowed(u, host) {
+		http.Error(w, fmt.Sprintf("destination %s is not allowed", host), http.StatusForbidden)
+		return
+	}
+
+	req := r.Clone(r.Context())
+	req.RequestURI = ""
+	removeHopHeaders(req.Header)
+
+	resp, err := s.transport.RoundTrip(req)
+	if err != nil {
+		logger.Debugf("%s forward request to %s failed: %v", s.name, addr, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	removeHopHeaders(resp.Header)
+	for key, values := range resp.Header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	s.copy(w, resp.Body, u)
+}
+
+func removeHopHeaders(h http.Header) {
+	for _, key := range h["Connection"] {
+		for _, name := range strings.Split(key, ",") {
+			h.Del(strings.TrimSpace(name))
+		}
+	}
+	for _, key := range hopHeaders {
+		h.Del(key)
+	}
+}
+
+// tunnel copies the data between the client and the target until one
+// of them is closed.
+func (s *server) tunnel(client, target net.Conn, u *user) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	pipe := func(dst, src net.Conn) {
+		defer wg.Done()
+		s.copy(dst, src, u)
+		// NOTE: Unblock the other direction.
+		dst.Close()
+		src.Close()
+	}
+
+	go pipe(target, client)
+	go pipe(client, target)
+
+	wg.Wait()
+}
+
+// copy copies from src to dst, the bytes are accounted and limited
+// by the rate of the user.
+func (s *server) copy(dst io.Writer, src io.Reader, u *user) {
+	buff := make([]byte, copyBufferSize)
+	for {
+		n, err := src.Read(buff)
+		if n > 0 {
+			if u != nil {
+				u.transfer(n)
+			}
+			if _, werr := dst.Write(buff[:n]); werr != nil {
+				return
+			}
+			if f, ok := dst.(http.Flusher); ok {
+				f.Flush()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *server) status() *Status {
+	st := &Status{
+		Connections:       atomic.LoadUint64(&s.connections),
+		ActiveConnections: atomic.LoadInt64(&s.active),
+		Denied:            atomic.LoadUint64(&s.denied),
+	}
+
+	if len(s.users) != 0 {
+		st.Users = make(map[string]uint64, len(s.users))
+		for name, u := range s.users {
+			st.Users[name] = atomic.LoadUint64(&u.bytes)
+		}
+	}
+
+	return st
+}
+
+func (s *server) close() {
+	s.mutex.Lock()
+	s.closed = true
+	listener, httpListener := s.listener, s.httpListener
+	conns := s.conns
+	s.conns = map[net.Conn]struct{}{}
+	s.mutex.Unlock()
+
+	if listener != nil {
+		listener.Close()
+		httpListener.Close()
+	}
+
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), time.Second)
+	defer cancel()
+	s.httpServer.Shutdown(ctx)
+
+	// NOTE: The hijacked connections are not closed by the HTTP server.
+	for conn := range conns {
+		conn.Close()
+	}
+
+	s.transport.CloseIdleConnections()
+}
+
+func newConnListener(addr net.Addr) *connListener {
+	return &connListener{
+		addr:  addr,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+// push pushes the connection to be accepted, it returns false if the
+// listener has been closed.
+func (l *connListener) push(conn net.Conn) bool {
+	select {
+	case l.conns <- conn:
+		return true
+	case <-l.done:
+		return false
+	}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, fmt.Errorf("listener closed")
+	}
+}
+
+func (l *connListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.addr
+}
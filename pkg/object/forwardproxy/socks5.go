@@ -0,0 +1,240 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package forwardproxy
+
+import (
+	stdcontext "context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+// The constants of SOCKS5, refer to RFC 1928 and RFC 1929.
+const (
+	socks5AuthNone         = 0x00
+	socks5AuthPassword     = 0x02
+	socks5AuthNoAcceptable = 0xff
+
+	socks5PasswordVersion = 0x01
+
+	socks5CmdConnect = 0x01
+
+	socks5AddrIPv4   = 0x01
+	socks5AddrDomain = 0x03
+	socks5AddrIPv6   = 0x04
+
+	socks5ReplySucceeded           = 0x00
+	socks5ReplyNotAllowed          = 0x02
+	socks5ReplyHostUnreachable     = 0x04
+	socks5ReplyCmdNotSupported     = 0x07
+	socks5ReplyAddrTypeUnsupported = 0x08
+)
+
+// serveSOCKS5 serves the CONNECT command of SOCKS5, the username and
+// password authentication is required if there are users.
+func (s *server) serveSOCKS5(conn net.Conn) {
+	u, err := s.socks5Handshake(conn)
+	if err != nil {
+		logger.Debugf("%s socks5 handshake with %s failed: %v", s.name, conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+
+	addr, err := s.socks5Request(conn)
+	if err != nil {
+		logger.Debugf("%s socks5 request from %s failed: %v", s.name, conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+
+	host, _, _ := net.SplitHostPort(addr)
+	if !s.allowed(u, host) {
+		socks5Reply(conn, socks5ReplyNotAllowed, nil)
+		conn.Close()
+		return
+	}
+
+	if s.mitm != nil && s.mitm.match(host) {
+		if err := socks5Reply(conn, socks5ReplySucceeded, nil); err != nil {
+			conn.Close()
+			return
+		}
+		conn.SetDeadline(time.Time{})
+		s.mitm.serve(s, conn, addr, u)
+		return
+	}
+
+	target, err := s.dial(stdcontext.Background(), "tcp", addr)
+	if err != nil {
+		logger.Debugf("%s dial %s failed: %v", s.name, addr, err)
+		socks5Reply(conn, socks5ReplyHostUnreachable, nil)
+		conn.Close()
+		return
+	}
+
+	if err := socks5Reply(conn, socks5ReplySucceeded, target.LocalAddr()); err != nil {
+		conn.Close()
+		target.Close()
+		return
+	}
+
+	conn.SetDeadline(time.Time{})
+	s.tunnel(conn, target, u)
+}
+
+// socks5Handshake negotiates the authentication method and authenticates.
+func (s *server) socks5Handshake(conn net.Conn) (*user, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return nil, err
+	}
+
+	method := byte(socks5AuthNone)
+	if len(s.users) != 0 {
+		method = socks5AuthPassword
+	}
+
+	supported := false
+	for _, m := range methods {
+		if m == method {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		conn.Write([]byte{socks5Version, socks5AuthNoAcceptable})
+		return nil, fmt.Errorf("no acceptable authentication method")
+	}
+
+	if _, err := conn.Write([]byte{socks5Version, method}); err != nil {
+		return nil, err
+	}
+
+	if method == socks5AuthNone {
+		return nil, nil
+	}
+
+	// VER ULEN UNAME PLEN PASSWD
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	if header[0] != socks5PasswordVersion {
+		return nil, fmt.Errorf("invalid version %d of password authentication", header[0])
+	}
+	username := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, username); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(conn, header[:1]); err != nil {
+		return nil, err
+	}
+	password := make([]byte, header[0])
+	if _, err := io.ReadFull(conn, password); err != nil {
+		return nil, err
+	}
+
+	u, ok := s.authenticate(string(username), string(password))
+	if !ok {
+		conn.Write([]byte{socks5PasswordVersion, 0x01})
+		return nil, fmt.Errorf("authenticate user %s failed", username)
+	}
+
+	if _, err := conn.Write([]byte{socks5PasswordVersion, 0x00}); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// socks5Request reads the request and returns the destination address.
+func (s *server) socks5Request(conn net.Conn) (string, error) {
+	// VER CMD RSV ATYP
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", err
+	}
+	if header[0] != socks5Version {
+		return "", fmt.Errorf("invalid version %d", header[0])
+	}
+	if header[1] != socks5CmdConnect {
+		socks5Reply(conn, socks5ReplyCmdNotSupported, nil)
+		return "", fmt.Errorf("command %d not supported", header[1])
+	}
+
+	var host string
+	switch header[3] {
+	case socks5AddrIPv4, socks5AddrIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if header[3] == socks5AddrIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case socks5AddrDomain:
+		if _, err := io.ReadFull(conn, header[:1]); err != nil {
+			return "", err
+		}
+		domain := make([]byte, header[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		socks5Reply(conn, socks5ReplyAddrTypeUnsupported, nil)
+		return "", fmt.Errorf("address type %d not supported", header[3])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", err
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// socks5Reply writes the reply with the bound address, which is
+// 0.0.0.0:0 if it's nil or not a TCP address.
+func socks5Reply(conn net.Conn, code byte, bound net.Addr) error {
+	ip, port := net.IPv4zero.To4(), 0
+	if addr, ok := bound.(*net.TCPAddr); ok {
+		ip, port = addr.IP, addr.Port
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+	}
+
+	reply := []byte{socks5Version, code, 0x00, socks5AddrIPv4}
+	if len(ip) == net.IPv6len {
+		reply[3] = socks5AddrIPv6
+	}
+	reply = append(reply, ip...)
+	reply = append(reply, byte(port>>8), byte(port))
+
+	_, err := conn.Write(reply)
+	return err
+}
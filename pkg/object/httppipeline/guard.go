@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+type (
+	// GuardSpec describes the allowlists checked before any filter runs.
+	GuardSpec struct {
+		Methods      []string `yaml:"methods,omitempty" jsonschema:"omitempty,uniqueItems=true,format=httpmethod-array"`
+		ContentTypes []string `yaml:"contentTypes,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+		// AnswerOptions answers OPTIONS requests with the Allow header
+		// directly instead of passing them to filters.
+		AnswerOptions bool `yaml:"answerOptions" jsonschema:"omitempty"`
+	}
+
+	guard struct {
+		spec         *GuardSpec
+		allow        string
+		contentTypes []string
+	}
+)
+
+func newGuard(spec *GuardSpec) *guard {
+	g := &guard{spec: spec}
+
+	if len(spec.Methods) != 0 {
+		methods := make([]string, 0, len(spec.Methods)+1)
+		for _, method := range spec.Methods {
+			methods = append(methods, strings.ToUpper(method))
+		}
+		if spec.AnswerOptions && !stringtool.StrInSlice(http.MethodOptions, methods) {
+			methods = append(methods, http.MethodOptions)
+		}
+		g.allow = strings.Join(methods, ", ")
+	}
+
+	for _, ct := range spec.ContentTypes {
+		g.contentTypes = append(g.contentTypes, strings.ToLower(ct))
+	}
+
+	return g
+}
+
+// handle checks the request against the allowlists, it returns true if
+// the request has been answered by the guard and must not go further.
+func (g *guard) handle(ctx context.HTTPContext) bool {
+	method := ctx.Request().Method()
+
+	if method == http.MethodOptions && g.spec.AnswerOptions {
+		if g.allow != "" {
+			ctx.Response().Header().Set("Allow", g.allow)
+		}
+		ctx.Response().SetStatusCode(http.StatusNoContent)
+		ctx.AddTag("guard: options answered")
+		return true
+	}
+
+	if g.allow != "" && !g.methodAllowed(method) {
+		ctx.Response().Header().Set("Allow", g.allow)
+		ctx.Response().SetStatusCode(http.StatusMethodNotAllowed)
+		ctx.AddTag(stringtool.Cat("guard: method ", method, " not allowed"))
+		return true
+	}
+
+	if len(g.contentTypes) != 0 {
+		contentType := ctx.Request().Header().Get("Content-Type")
+		if !g.contentTypeAllowed(contentType) {
+			ctx.Response().SetStatusCode(http.StatusUnsupportedMediaType)
+			ctx.AddTag(stringtool.Cat("guard: content type ", contentType, " not allowed"))
+			return true
+		}
+	}
+
+	return false
+}
+
+func (g *guard) methodAllowed(method string) bool {
+	for _, m := range g.spec.Methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// contentTypeAllowed reports whether contentType matches the allowlist,
+// requests without body are always allowed. An entry like "text/*" matches
+// all subtypes of "text".
+func (g *guard) contentTypeAllowed(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, ct := range g.contentTypes {
+		if ct == mediaType || ct == "*/*" {
+			return true
+		}
+		if strings.HasSuffix(ct, "/*") && strings.HasPrefix(mediaType, ct[:len(ct)-1]) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+const (
+	// HeaderPolicyAllow keeps only the response headers matching the policy.
+	HeaderPolicyAllow = "allow"
+	// HeaderPolicyDeny removes the response headers matching the policy.
+	HeaderPolicyDeny = "deny"
+)
+
+type (
+	// HeaderPolicySpec describes the response headers delivered to clients,
+	// it is applied after all filters, so the headers used between filters
+	// never leak. A header name could be a wildcard like "X-Internal-*".
+	HeaderPolicySpec struct {
+		Mode    string   `yaml:"mode" jsonschema:"required,enum=allow,enum=deny"`
+		Headers []string `yaml:"headers" jsonschema:"required,minItems=1,uniqueItems=true"`
+	}
+
+	headerPolicy struct {
+		allow    bool
+		patterns []string
+	}
+)
+
+// Validate validates HeaderPolicySpec.
+func (spec *HeaderPolicySpec) Validate() error {
+	for _, h := range spec.Headers {
+		if _, err := path.Match(strings.ToLower(h), ""); err != nil {
+			return fmt.Errorf("invalid header pattern %s: %v", h, err)
+		}
+	}
+	return nil
+}
+
+func newHeaderPolicy(spec *HeaderPolicySpec) *headerPolicy {
+	hp := &headerPolicy{allow: spec.Mode == HeaderPolicyAllow}
+	for _, h := range spec.Headers {
+		hp.patterns = append(hp.patterns, strings.ToLower(h))
+	}
+	return hp
+}
+
+// match reports whether the header key matches any pattern, header keys
+// are case-insensitive.
+func (hp *headerPolicy) match(key string) bool {
+	key = strings.ToLower(key)
+	for _, p := range hp.patterns {
+		if matched, _ := path.Match(p, key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// handle removes the response headers rejected by the policy.
+func (hp *headerPolicy) handle(ctx context.HTTPContext) {
+	header := ctx.Response().Header()
+
+	var keys []string
+	header.VisitAll(func(key, value string) {
+		if hp.match(key) != hp.allow {
+			keys = append(keys, key)
+		}
+	})
+
+	for _, key := range keys {
+		header.Del(key)
+	}
+}
@@ -28,7 +28,10 @@ import (
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/protocol"
 	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/expression"
+	"github.com/megaease/easegress/pkg/util/matcher"
 	"github.com/megaease/easegress/pkg/util/stringtool"
+	"github.com/megaease/easegress/pkg/util/texttemplate"
 	"github.com/megaease/easegress/pkg/util/yamltool"
 )
 
@@ -56,25 +59,36 @@ type (
 		muxMapper      protocol.MuxMapper
 		runningFilters []*runningFilter
 		ht             *context.HTTPTemplate
+		guard          *guard
+		headerPolicy   *headerPolicy
 	}
 
 	runningFilter struct {
 		spec       *FilterSpec
 		jumpIf     map[string]string
+		when       string
+		condition  *expression.Expression
 		rootFilter Filter
 		filter     Filter
 	}
 
 	// Spec describes the HTTPPipeline.
 	Spec struct {
-		Flow    []Flow                   `yaml:"flow" jsonschema:"omitempty"`
-		Filters []map[string]interface{} `yaml:"filters" jsonschema:"required"`
+		Guard                *GuardSpec               `yaml:"guard,omitempty" jsonschema:"omitempty"`
+		ResponseHeaderPolicy *HeaderPolicySpec        `yaml:"responseHeaderPolicy,omitempty" jsonschema:"omitempty"`
+		Flow                 []Flow                   `yaml:"flow" jsonschema:"omitempty"`
+		Filters              []map[string]interface{} `yaml:"filters" jsonschema:"required"`
 	}
 
 	// Flow controls the flow of pipeline.
 	Flow struct {
 		Filter string            `yaml:"filter" jsonschema:"required,format=urlname"`
 		JumpIf map[string]string `yaml:"jumpIf" jsonschema:"omitempty"`
+		// If is an expression, the filter is skipped if it's evaluated to false.
+		If string `yaml:"if,omitempty" jsonschema:"omitempty"`
+		// When is the name of a RequestMatcher, the filter is skipped if
+		// the request doesn't match it.
+		When string `yaml:"when,omitempty" jsonschema:"omitempty,format=requestmatcher"`
 	}
 
 	// Status is the status of HTTPPipeline.
@@ -82,6 +96,9 @@ type (
 		Health string `yaml:"health"`
 
 		Filters map[string]interface{} `yaml:"filters"`
+
+		// Template is the statistics of the templates of all filters.
+		Template *texttemplate.Stats `yaml:"template"`
 	}
 
 	// PipelineContext contains the context of the HTTPPipeline.
@@ -214,6 +231,17 @@ func (meta *FilterMetaSpec) Validate() error {
 	return nil
 }
 
+// withFlowCondition appends the condition of the filter in flow to its
+// buff, so the templates referenced by the condition are saved too.
+func withFlowCondition(buff []byte, flow []Flow, filterName string) []byte {
+	for _, f := range flow {
+		if f.Filter == filterName && f.If != "" {
+			buff = append(append(buff[:len(buff):len(buff)], '\n'), f.If...)
+		}
+	}
+	return buff
+}
+
 // Validate validates Spec.
 func (s Spec) Validate() (err error) {
 	errPrefix := "filters"
@@ -247,7 +275,7 @@ func (s Spec) Validate() (err error) {
 
 		templateFilterBuffs = append(templateFilterBuffs, context.FilterBuff{
 			Name: spec.Name(),
-			Buff: filterBuffs[spec.Name()],
+			Buff: withFlowCondition(filterBuffs[spec.Name()], s.Flow, spec.Name()),
 		})
 	}
 
@@ -285,6 +313,12 @@ func (s Spec) Validate() (err error) {
 			}
 		}
 		labelsValid[f.Filter] = struct{}{}
+
+		if f.If != "" {
+			if _, err := expression.Parse(f.If); err != nil {
+				panic(fmt.Errorf("filter %s: %v", f.Filter, err))
+			}
+		}
 	}
 
 	return nil
@@ -352,9 +386,16 @@ func (hp *HTTPPipeline) reload(previousGeneration *HTTPPipeline) {
 				panic(fmt.Errorf("flow filter %s not found in filters", f.Filter))
 			}
 
+			var condition *expression.Expression
+			if f.If != "" {
+				condition = expression.MustParse(f.If)
+			}
+
 			runningFilters = append(runningFilters, &runningFilter{
-				spec:   spec,
-				jumpIf: f.JumpIf,
+				spec:      spec,
+				jumpIf:    f.JumpIf,
+				when:      f.When,
+				condition: condition,
 			})
 		}
 	}
@@ -388,7 +429,7 @@ func (hp *HTTPPipeline) reload(previousGeneration *HTTPPipeline) {
 
 		filterBuffs = append(filterBuffs, context.FilterBuff{
 			Name: name,
-			Buff: []byte(runningFilter.spec.YAMLConfig()),
+			Buff: withFlowCondition([]byte(runningFilter.spec.YAMLConfig()), hp.spec.Flow, name),
 		})
 	}
 
@@ -400,6 +441,16 @@ func (hp *HTTPPipeline) reload(previousGeneration *HTTPPipeline) {
 	}
 
 	hp.runningFilters = runningFilters
+
+	hp.guard = nil
+	if hp.spec.Guard != nil {
+		hp.guard = newGuard(hp.spec.Guard)
+	}
+
+	hp.headerPolicy = nil
+	if hp.spec.ResponseHeaderPolicy != nil {
+		hp.headerPolicy = newHeaderPolicy(hp.spec.ResponseHeaderPolicy)
+	}
 }
 
 func (hp *HTTPPipeline) getNextFilterIndex(index int, result string) int {
@@ -436,26 +487,66 @@ func (hp *HTTPPipeline) getNextFilterIndex(index int, result string) int {
 	return -1
 }
 
+// skipUnsatisfiedFilters returns the index of the first filter starting
+// from index whose condition is satisfied.
+func (hp *HTTPPipeline) skipUnsatisfiedFilters(ctx context.HTTPContext, index int) int {
+	if index == -1 {
+		return index
+	}
+
+	for ; index < len(hp.runningFilters); index++ {
+		filter := hp.runningFilters[index]
+		if filter.when != "" && !matcher.Match(ctx, filter.when) {
+			continue
+		}
+		if filter.condition == nil {
+			return index
+		}
+
+		ok, err := filter.condition.EvalBool(expression.NewHTTPEnv(ctx))
+		if err != nil {
+			ctx.AddTag(stringtool.Cat("filter ", filter.spec.Name(), " condition error: ", err.Error()))
+			continue
+		}
+		if ok {
+			return index
+		}
+	}
+
+	return index
+}
+
 // Handle is the handler to deal with HTTP
 func (hp *HTTPPipeline) Handle(ctx context.HTTPContext) {
+	if hp.handleRollout(ctx) {
+		return
+	}
+
 	pipeCtx := newAndSetPipelineContext(ctx)
 	defer deletePipelineContext(ctx)
 	ctx.SetTemplate(hp.ht)
 
+	if hp.guard != nil && hp.guard.handle(ctx) {
+		return
+	}
+
 	filterIndex := -1
 	filterStat := &FilterStat{}
 
 	handle := func(lastResult string) string {
 		// For saving the `filterIndex`'s filter generated HTTP Response.
 		// Note: the sequence of pipeline is stack-liked, we save the filter's response into template
-		// at the beginning of the next filter.
+		// at the beginning of the next filter, so is the result passed to the next handler.
 		if filterIndex != -1 {
 			name := hp.runningFilters[filterIndex].spec.Name()
 			if err := ctx.SaveRspToTemplate(name); err != nil {
 				format := "save http rsp failed, dict is %#v err is %v"
-				logger.Errorf(format, ctx.Template().GetDict(), err)
+				ctx.Logger().Errorf(format, ctx.Template().GetDict(), err)
+			}
+			if err := hp.ht.SaveResult(name, lastResult); err != nil {
+				ctx.Logger().Errorf("save result of filter %s failed: %v", name, err)
 			}
-			logger.Debugf("filter %s, saved response dict %v", name, ctx.Template().GetDict())
+			ctx.Logger().Debugf("filter %s, saved response dict %v", name, ctx.Template().GetDict())
 		}
 
 		// Filters are called recursively as a stack, so we need to save current
@@ -468,6 +559,7 @@ func (hp *HTTPPipeline) Handle(ctx context.HTTPContext) {
 		}()
 
 		filterIndex = hp.getNextFilterIndex(filterIndex, lastResult)
+		filterIndex = hp.skipUnsatisfiedFilters(ctx, filterIndex)
 		if filterIndex == len(hp.runningFilters) {
 			return "" // reach the end of pipeline
 		} else if filterIndex == -1 {
@@ -479,10 +571,10 @@ func (hp *HTTPPipeline) Handle(ctx context.HTTPContext) {
 
 		if err := ctx.SaveReqToTemplate(name); err != nil {
 			format := "save http req failed, dict is %#v err is %v"
-			logger.Errorf(format, ctx.Template().GetDict(), err)
+			ctx.Logger().Errorf(format, ctx.Template().GetDict(), err)
 		}
 
-		logger.Debugf("filter %s saved request dict %v", name, ctx.Template().GetDict())
+		ctx.Logger().Debugf("filter %s saved request dict %v", name, ctx.Template().GetDict())
 		filterStat = &FilterStat{Name: name, Kind: filter.spec.Kind()}
 
 		startTime := time.Now()
@@ -498,6 +590,10 @@ func (hp *HTTPPipeline) Handle(ctx context.HTTPContext) {
 	ctx.SetHandlerCaller(handle)
 	handle("")
 
+	if hp.headerPolicy != nil {
+		hp.headerPolicy.handle(ctx)
+	}
+
 	if len(filterStat.Next) > 0 {
 		pipeCtx.FilterStats = filterStat.Next[0]
 	}
@@ -517,7 +613,8 @@ func (hp *HTTPPipeline) getRunningFilter(name string) *runningFilter {
 // Status returns Status generated by Runtime.
 func (hp *HTTPPipeline) Status() *supervisor.Status {
 	s := &Status{
-		Filters: make(map[string]interface{}),
+		Filters:  make(map[string]interface{}),
+		Template: hp.ht.Engine.Stats(),
 	}
 
 	for _, runningFilter := range hp.runningFilters {
@@ -22,6 +22,7 @@ import (
 	"reflect"
 
 	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/capability"
 )
 
 type (
@@ -104,6 +105,7 @@ func Register(f Filter) {
 	}
 
 	filterRegistry[f.Kind()] = f
+	capability.Register(capability.Filter, f.Kind())
 }
 
 // GetFilterRegistry get the filter registry.
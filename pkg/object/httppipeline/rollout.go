@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httppipeline
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/httpstat"
+)
+
+// rollouts holds the rollouts of pipelines keyed by the pipeline name,
+// they are shared by all generations of the pipelines.
+var rollouts sync.Map
+
+type (
+	// Rollout routes a part of the traffic of a pipeline to the canary
+	// pipeline, which is the new version of its spec, e.g. rolled out
+	// progressively by canary analysis.
+	Rollout struct {
+		// weight is the per-mill weight of the canary, it's not rolling
+		// out if the weight is negative.
+		weight int32
+		target atomic.Value
+	}
+
+	rolloutTarget struct {
+		canary   string
+		baseline *httpstat.HTTPStat
+		// NOTE: The stat of canary is recorded by the baseline pipeline,
+		// so the canary pipeline could serve other traffic as usual.
+		canaryStat *httpstat.HTTPStat
+	}
+)
+
+// GetRollout returns the rollout of the pipeline.
+func GetRollout(pipeline string) *Rollout {
+	if r, exists := rollouts.Load(pipeline); exists {
+		return r.(*Rollout)
+	}
+
+	r, _ := rollouts.LoadOrStore(pipeline, &Rollout{weight: -1})
+	return r.(*Rollout)
+}
+
+// Start starts rolling out to the canary pipeline in the same namespace
+// with the stats reset, the weight must be set to route traffic.
+func (r *Rollout) Start(canary string) {
+	r.target.Store(&rolloutTarget{
+		canary:     canary,
+		baseline:   httpstat.New(),
+		canaryStat: httpstat.New(),
+	})
+}
+
+// Weight returns the per-mill weight of the canary.
+func (r *Rollout) Weight() *int32 {
+	return &r.weight
+}
+
+// Stats returns the stats of the baseline and the canary since the
+// rollout started, they are nil if it's not started.
+func (r *Rollout) Stats() (baseline, canary *httpstat.Status) {
+	t, ok := r.target.Load().(*rolloutTarget)
+	if !ok {
+		return nil, nil
+	}
+	return t.baseline.Status(), t.canaryStat.Status()
+}
+
+// handleRollout routes the request to the canary pipeline if it's chosen,
+// it returns true if the request has been handled by the canary.
+func (hp *HTTPPipeline) handleRollout(ctx context.HTTPContext) bool {
+	entry, exists := rollouts.Load(hp.superSpec.Name())
+	if !exists {
+		return false
+	}
+
+	r := entry.(*Rollout)
+	w := atomic.LoadInt32(&r.weight)
+	t, ok := r.target.Load().(*rolloutTarget)
+	if w < 0 || !ok {
+		return false
+	}
+
+	if w > 0 && hp.muxMapper != nil && rand.Int31n(1000) < w {
+		if handler, exists := hp.muxMapper.GetHandler(t.canary); exists {
+			ctx.OnFinish(func() {
+				t.canaryStat.Stat(ctx.StatMetric())
+			})
+			handler.Handle(ctx)
+			return true
+		}
+	}
+
+	ctx.OnFinish(func() {
+		t.baseline.Stat(ctx.StatMetric())
+	})
+
+	return false
+}
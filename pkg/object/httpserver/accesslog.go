@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/accesslog"
+)
+
+// newAccessLogEntry returns the entry of the finished request, the
+// backend is the last server tried by the proxies.
+func newAccessLogEntry(ctx context.HTTPContext, ci *cacheItem) *accesslog.Entry {
+	r, w := ctx.Request(), ctx.Response()
+	stdr := r.Std()
+	metric := ctx.StatMetric()
+
+	// NOTE: It's called by the finish of the context, whose end time is
+	// set just before.
+	e := &accesslog.Entry{
+		StartTime:  time.Now().Add(-metric.Duration),
+		RemoteAddr: stdr.RemoteAddr,
+		RealIP:     r.RealIP(),
+		Method:     stdr.Method,
+		Host:       stdr.Host,
+		URI:        stdr.RequestURI,
+		Proto:      stdr.Proto,
+		StatusCode: w.StatusCode(),
+		Duration:   metric.Duration,
+		ReqSize:    metric.ReqSize,
+		RespSize:   metric.RespSize,
+		Header:     stdr.Header,
+		Tags:       ctx.Tags(),
+		KVs:        ctx.KVs(),
+	}
+	if ci != nil && ci.path != nil {
+		e.Pipeline = ci.path.backend
+	}
+	e.Backend, _ = e.KVs[context.KeyBackend].(string)
+	e.BackendDuration, _ = e.KVs[context.KeyBackendDuration].(time.Duration)
+	return e
+}
@@ -30,11 +30,14 @@ import (
 	"github.com/megaease/easegress/pkg/protocol"
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/accesslog"
 	"github.com/megaease/easegress/pkg/util/httpheader"
 	"github.com/megaease/easegress/pkg/util/httpstat"
 	"github.com/megaease/easegress/pkg/util/ipfilter"
+	"github.com/megaease/easegress/pkg/util/matcher"
 	"github.com/megaease/easegress/pkg/util/stringtool"
 	"github.com/megaease/easegress/pkg/util/topn"
+	"github.com/megaease/easegress/pkg/util/toptalkers"
 )
 
 type (
@@ -56,6 +59,8 @@ type (
 		tracer       *tracing.Tracing
 		ipFilter     *ipfilter.IPFilter
 		ipFilterChan *ipfilter.IPFilters
+		topTalkers   *toptalkers.Tracker
+		accessLog    *accesslog.AccessLog
 
 		rules []*muxRule
 	}
@@ -82,6 +87,7 @@ type (
 		rewriteTarget string
 		backend       string
 		headers       []*Header
+		matcher       string
 	}
 )
 
@@ -143,6 +149,18 @@ func (mr *muxRules) putCacheItem(ctx context.HTTPContext, ci *cacheItem) {
 	mr.cache.put(key, ci)
 }
 
+func (mr *muxRules) recordTopTalkers(ctx context.HTTPContext, metric *httpstat.Metric) {
+	r := ctx.Request()
+
+	consumer := ""
+	if header := mr.topTalkers.ConsumerHeader(); header != "" {
+		consumer = r.Header().Get(header)
+	}
+
+	mr.topTalkers.Record(r.RealIP(), r.Path(), consumer,
+		metric.Duration, metric.ReqSize+metric.RespSize)
+}
+
 func newMuxRule(parentIPFilters *ipfilter.IPFilters, rule *Rule, paths []*muxPath) *muxRule {
 	var hostRE *regexp.Regexp
 
@@ -223,6 +241,7 @@ func newMuxPath(parentIPFilters *ipfilter.IPFilters, path *Path) *muxPath {
 		methods:       path.Methods,
 		backend:       path.Backend,
 		headers:       path.Headers,
+		matcher:       path.Matcher,
 	}
 }
 
@@ -262,6 +281,10 @@ func (mp *muxPath) matchMethod(ctx context.HTTPContext) bool {
 	return stringtool.StrInSlice(ctx.Request().Method(), mp.methods)
 }
 
+func (mp *muxPath) matchMatcher(ctx context.HTTPContext) bool {
+	return mp.matcher == "" || matcher.Match(ctx, mp.matcher)
+}
+
 func (mp *muxPath) hasHeaders() bool {
 	return len(mp.headers) > 0
 }
@@ -328,6 +351,35 @@ func (m *mux) reloadRules(superSpec *supervisor.Spec, muxMapper protocol.MuxMapp
 		tracer:       tracer,
 	}
 
+	// NOTE: Keep the tracker to not lose the window if it's unchanged.
+	switch {
+	case spec.TopTalkers == nil:
+		toptalkers.Unregister(superSpec.Name())
+	case oldRules.topTalkers != nil && reflect.DeepEqual(oldRules.spec.TopTalkers, spec.TopTalkers):
+		rules.topTalkers = oldRules.topTalkers
+	default:
+		rules.topTalkers = toptalkers.New(spec.TopTalkers)
+		toptalkers.Register(superSpec.Name(), rules.topTalkers)
+	}
+
+	// NOTE: Keep the access log to not reopen the file if it's unchanged,
+	// the old one is closed after the new rules are stored.
+	switch {
+	case spec.AccessLog == nil:
+	case oldRules.accessLog != nil && reflect.DeepEqual(oldRules.spec.AccessLog, spec.AccessLog):
+		rules.accessLog = oldRules.accessLog
+	default:
+		accessLog, err := accesslog.New(spec.AccessLog, superSpec.Super().Options().AbsLogDir)
+		if err != nil {
+			logger.Errorf("%s: create access log failed: %v", superSpec.Name(), err)
+		} else {
+			rules.accessLog = accessLog
+		}
+	}
+	if oldRules.accessLog != nil && oldRules.accessLog != rules.accessLog {
+		defer oldRules.accessLog.Close()
+	}
+
 	if spec.CacheSize > 0 {
 		rules.cache = newCache(spec.CacheSize)
 	}
@@ -356,11 +408,20 @@ func (m *mux) ServeHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 	defer ctx.Finish()
 	ctx.OnFinish(func() {
 		ctx.Span().Finish()
-		m.httpStat.Stat(ctx.StatMetric())
+		metric := ctx.StatMetric()
+		m.httpStat.Stat(metric)
 		m.topN.Stat(ctx)
+		if rules.topTalkers != nil {
+			rules.recordTopTalkers(ctx, metric)
+		}
 	})
 
 	ci := rules.getCacheItem(ctx)
+	if rules.accessLog != nil {
+		ctx.OnFinish(func() {
+			rules.accessLog.Log(newAccessLogEntry(ctx, ci))
+		})
+	}
 	if ci != nil {
 		m.handleRequestWithCache(rules, ctx, ci)
 		return
@@ -371,6 +432,15 @@ func (m *mux) ServeHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 		return
 	}
 
+	// NOTE: The result of the request is not cached once a path with a
+	// matcher is checked, since the matcher may depend on anything.
+	noCache := false
+	putCacheItem := func(ci *cacheItem) {
+		if !noCache {
+			rules.putCacheItem(ctx, ci)
+		}
+	}
+
 	for _, host := range rules.rules {
 		if !host.match(ctx) {
 			continue
@@ -388,7 +458,7 @@ func (m *mux) ServeHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 
 			if !path.matchMethod(ctx) {
 				ci = &cacheItem{ipFilterChan: path.ipFilterChain, methodNotAllowed: true}
-				rules.putCacheItem(ctx, ci)
+				putCacheItem(ci)
 				m.handleRequestWithCache(rules, ctx, ci)
 				return
 			}
@@ -398,9 +468,16 @@ func (m *mux) ServeHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 				return
 			}
 
+			if path.matcher != "" {
+				noCache = true
+				if !path.matchMatcher(ctx) {
+					continue
+				}
+			}
+
 			if !path.hasHeaders() {
 				ci = &cacheItem{ipFilterChan: path.ipFilterChain, path: path}
-				rules.putCacheItem(ctx, ci)
+				putCacheItem(ci)
 				m.handleRequestWithCache(rules, ctx, ci)
 				return
 			}
@@ -415,7 +492,7 @@ func (m *mux) ServeHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 	}
 
 	ci = &cacheItem{ipFilterChan: rules.ipFilterChan, notFound: true}
-	rules.putCacheItem(ctx, ci)
+	putCacheItem(ci)
 	m.handleRequestWithCache(rules, ctx, ci)
 }
 
@@ -475,6 +552,12 @@ func (m *mux) appendXForwardedFor(ctx context.HTTPContext) {
 
 func (m *mux) close() {
 	rules := m.rules.Load().(*muxRules)
+	if rules.topTalkers != nil {
+		toptalkers.Unregister(rules.superSpec.Name())
+	}
+	if rules.accessLog != nil {
+		rules.accessLog.Close()
+	}
 	err := rules.tracer.Close()
 	if err != nil {
 		logger.Errorf("%s close tracer failed: %v",
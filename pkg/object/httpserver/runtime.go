@@ -19,6 +19,7 @@ package httpserver
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"reflect"
 	"sync/atomic"
@@ -40,12 +41,15 @@ const (
 
 	checkFailedTimeout = 10 * time.Second
 
+	drainCheckInterval = 100 * time.Millisecond
+
 	topNum = 10
 
-	stateNil     stateType = "nil"
-	stateFailed  stateType = "failed"
-	stateRunning stateType = "running"
-	stateClosed  stateType = "closed"
+	stateNil      stateType = "nil"
+	stateFailed   stateType = "failed"
+	stateRunning  stateType = "running"
+	stateDraining stateType = "draining"
+	stateClosed   stateType = "closed"
 )
 
 var (
@@ -83,6 +87,11 @@ type (
 		httpStat      *httpstat.HTTPStat
 		topN          *topn.TopN
 		limitListener *limitlistener.LimitListener
+
+		// draining is 1 if the server is asking the clients to close
+		// their connections, and conns is the number of them.
+		draining int32
+		conns    *int64
 	}
 
 	// Status contains all status generated by runtime, for displaying to users.
@@ -228,6 +237,8 @@ func (r *runtime) needRestartServer(nextSpec *Spec) bool {
 	x.Tracing, y.Tracing = nil, nil
 	x.IPFilter, y.IPFilter = nil, nil
 	x.Rules, y.Rules = nil, nil
+	x.DrainTimeout, y.DrainTimeout = "", ""
+	x.AccessLog, y.AccessLog = nil, nil
 
 	// The update of rules need not to shutdown server.
 	return !reflect.DeepEqual(x, y)
@@ -245,12 +256,23 @@ func (r *runtime) startServer() {
 		}
 	}
 
+	conns := new(int64)
 	srv := &http.Server{
 		Addr:        fmt.Sprintf(":%d", r.spec.Port),
-		Handler:     r.mux,
+		Handler:     http.HandlerFunc(r.serveHTTP),
 		IdleTimeout: keepAliveTimeout,
+		ConnState: func(conn net.Conn, state http.ConnState) {
+			switch state {
+			case http.StateNew:
+				atomic.AddInt64(conns, 1)
+			case http.StateHijacked, http.StateClosed:
+				atomic.AddInt64(conns, -1)
+			}
+		},
 	}
 	srv.SetKeepAlivesEnabled(r.spec.KeepAlive)
+	atomic.StoreInt32(&r.draining, 0)
+	r.conns = conns
 
 	if r.spec.HTTPS {
 		tlsConfig, _ := r.spec.tlsConfig()
@@ -282,6 +304,44 @@ func (r *runtime) startServer() {
 	}
 }
 
+func (r *runtime) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	// NOTE: The HTTP/2 server sends GOAWAY for it instead.
+	if atomic.LoadInt32(&r.draining) == 1 {
+		w.Header().Set("Connection", "close")
+	}
+	r.mux.ServeHTTP(w, req)
+}
+
+// drain asks the clients to move their connections off the server before
+// it's closed, so the long-lived connections aren't cut forcibly. It keeps
+// serving until all connections are closed or the drain timeout expires.
+func (r *runtime) drain() {
+	if r.server == nil || r.server3 != nil || r.getState() != stateRunning {
+		return
+	}
+	timeout := r.spec.drainTimeout()
+	if timeout <= 0 {
+		return
+	}
+
+	logger.Infof("drain http server %s for at most %s", r.superSpec.Name(), timeout)
+	r.setState(stateDraining)
+	atomic.StoreInt32(&r.draining, 1)
+	r.server.SetKeepAlivesEnabled(false)
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+	for atomic.LoadInt64(r.conns) > 0 {
+		select {
+		case <-deadline.C:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 func (r *runtime) runHTTP3Server(startNum uint64) {
 	err := r.server3.ListenAndServe()
 	if err != http.ErrServerClosed {
@@ -362,6 +422,7 @@ func (r *runtime) handleEventReload(e *eventReload) {
 }
 
 func (r *runtime) handleEventClose(e *eventClose) {
+	r.drain()
 	r.closeServer()
 	r.mux.close()
 	close(e.done)
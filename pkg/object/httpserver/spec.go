@@ -22,9 +22,12 @@ import (
 	"encoding/base64"
 	"fmt"
 	"regexp"
+	"time"
 
 	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/accesslog"
 	"github.com/megaease/easegress/pkg/util/ipfilter"
+	"github.com/megaease/easegress/pkg/util/toptalkers"
 )
 
 type (
@@ -52,6 +55,14 @@ type (
 
 		IPFilter *ipfilter.Spec `yaml:"ipFilter,omitempty" jsonschema:"omitempty"`
 		Rules    []*Rule        `yaml:"rules" jsonschema:"omitempty"`
+
+		// TopTalkers tracks the top talkers for the admin API.
+		TopTalkers *toptalkers.Spec `yaml:"topTalkers,omitempty" jsonschema:"omitempty"`
+		// DrainTimeout is how long the server keeps serving while asking
+		// the clients to close their connections before it's closed.
+		DrainTimeout string `yaml:"drainTimeout,omitempty" jsonschema:"omitempty,format=duration"`
+		// AccessLog writes the access logs of the server to its own file.
+		AccessLog *accesslog.Spec `yaml:"accessLog,omitempty" jsonschema:"omitempty"`
 	}
 
 	// Rule is first level entry of router.
@@ -79,6 +90,9 @@ type (
 		Methods       []string       `yaml:"methods,omitempty" jsonschema:"omitempty,uniqueItems=true,format=httpmethod-array"`
 		Backend       string         `yaml:"backend" jsonschema:"required"`
 		Headers       []*Header      `yaml:"headers" jsonschema:"omitempty"`
+		// Matcher is the name of a RequestMatcher, the path is skipped
+		// if the request doesn't match it.
+		Matcher string `yaml:"matcher,omitempty" jsonschema:"omitempty,format=requestmatcher"`
 	}
 
 	// Header is the third level entry of router. A header entry is always under a specific path entry, that is to mean
@@ -113,6 +127,12 @@ func (spec *Spec) Validate() error {
 	return nil
 }
 
+func (spec *Spec) drainTimeout() time.Duration {
+	// NOTE: It has been validated by format=duration.
+	d, _ := time.ParseDuration(spec.DrainTimeout)
+	return d
+}
+
 func (spec *Spec) tlsConfig() (*tls.Config, error) {
 	var certificates []tls.Certificate
 	if spec.CertBase64 != "" && spec.KeyBase64 != "" {
@@ -0,0 +1,443 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetesserviceregistry
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	apicorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corev1 "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	listerv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/serviceregistry"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Category is the category of KubernetesServiceRegistry.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of KubernetesServiceRegistry.
+	Kind = "KubernetesServiceRegistry"
+
+	resyncPeriod  = 10 * time.Minute
+	retryInterval = 10 * time.Second
+)
+
+func init() {
+	supervisor.Register(&KubernetesServiceRegistry{})
+}
+
+type (
+	// KubernetesServiceRegistry is Object KubernetesServiceRegistry,
+	// it discovers the ready endpoints of Kubernetes services by
+	// watching the Endpoints. It's read-only, the service instances
+	// can't be applied to it.
+	KubernetesServiceRegistry struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		serviceRegistry *serviceregistry.ServiceRegistry
+		firstDone       bool
+		instances       map[string]*serviceregistry.ServiceInstanceSpec
+		notify          chan *serviceregistry.RegistryEvent
+
+		listersMutex sync.RWMutex
+		listers      []listerv1.EndpointsNamespaceLister
+
+		statusMutex  sync.Mutex
+		health       string
+		instancesNum map[string]int
+
+		done chan struct{}
+		wg   sync.WaitGroup
+	}
+
+	// Spec describes the KubernetesServiceRegistry. The in-cluster
+	// config is used if both KubeConfig and MasterURL are empty.
+	Spec struct {
+		KubeConfig string   `yaml:"kubeConfig" jsonschema:"omitempty"`
+		MasterURL  string   `yaml:"masterURL" jsonschema:"omitempty"`
+		Namespaces []string `yaml:"namespaces" jsonschema:"omitempty,uniqueItems=true"`
+	}
+
+	// Status is the status of KubernetesServiceRegistry.
+	Status struct {
+		Health              string         `yaml:"health"`
+		ServiceInstancesNum map[string]int `yaml:"instancesNum"`
+	}
+)
+
+// Category returns the category of KubernetesServiceRegistry.
+func (k *KubernetesServiceRegistry) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of KubernetesServiceRegistry.
+func (k *KubernetesServiceRegistry) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of KubernetesServiceRegistry.
+func (k *KubernetesServiceRegistry) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Init initializes KubernetesServiceRegistry.
+func (k *KubernetesServiceRegistry) Init(superSpec *supervisor.Spec) {
+	k.superSpec, k.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	k.reload()
+}
+
+// Inherit inherits previous generation of KubernetesServiceRegistry.
+func (k *KubernetesServiceRegistry) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	previousGeneration.Close()
+	k.Init(superSpec)
+}
+
+func (k *KubernetesServiceRegistry) reload() {
+	k.serviceRegistry = k.superSpec.Super().MustGetSystemController(serviceregistry.Kind).
+		Instance().(*serviceregistry.ServiceRegistry)
+	k.notify = make(chan *serviceregistry.RegistryEvent, 10)
+	k.firstDone = false
+
+	k.health = "connecting"
+	k.instancesNum = map[string]int{}
+	k.done = make(chan struct{})
+
+	k.serviceRegistry.RegisterRegistry(k)
+
+	k.wg.Add(1)
+	go k.run()
+}
+
+func (k *KubernetesServiceRegistry) setHealth(health string) {
+	k.statusMutex.Lock()
+	k.health = health
+	k.statusMutex.Unlock()
+}
+
+// sleep waits for the retry interval, it returns false if the registry
+// is closed.
+func (k *KubernetesServiceRegistry) sleep() bool {
+	select {
+	case <-k.done:
+		return false
+	case <-time.After(retryInterval):
+		return true
+	}
+}
+
+func (k *KubernetesServiceRegistry) run() {
+	defer k.wg.Done()
+
+	var clientset kubernetes.Interface
+	for {
+		cfg, err := clientcmd.BuildConfigFromFlags(k.spec.MasterURL, k.spec.KubeConfig)
+		if err == nil {
+			clientset, err = kubernetes.NewForConfig(cfg)
+		}
+		if err == nil {
+			break
+		}
+		logger.Errorf("%s: create kubernetes client failed: %v", k.superSpec.Name(), err)
+		k.setHealth(err.Error())
+
+		if !k.sleep() {
+			return
+		}
+	}
+
+	var (
+		stopCh chan struct{}
+		err    error
+	)
+	eventCh := make(chan struct{}, 1)
+	for {
+		stopCh, err = k.watch(clientset, eventCh)
+		if err == nil {
+			break
+		}
+		logger.Errorf("%s: watch endpoints failed: %v", k.superSpec.Name(), err)
+		k.setHealth(err.Error())
+
+		if !k.sleep() {
+			return
+		}
+	}
+	defer close(stopCh)
+	k.setHealth("ready")
+
+	for {
+		k.update()
+
+		select {
+		case <-k.done:
+			return
+		case <-eventCh:
+		}
+	}
+}
+
+// watch starts the informers of the Endpoints, an event is sent to
+// eventCh if there is no pending one when any Endpoints changes.
+func (k *KubernetesServiceRegistry) watch(clientset kubernetes.Interface, eventCh chan struct{}) (chan struct{}, error) {
+	stopCh := make(chan struct{})
+
+	namespaces := k.spec.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	notify := func(interface{}) {
+		select {
+		case eventCh <- struct{}{}:
+		default:
+		}
+	}
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    notify,
+		UpdateFunc: func(oldObj, newObj interface{}) { notify(newObj) },
+		DeleteFunc: notify,
+	}
+
+	factory := informers.NewSharedInformerFactory(clientset, resyncPeriod)
+	var listers []listerv1.EndpointsNamespaceLister
+	for _, ns := range namespaces {
+		endpoints := corev1.New(factory, ns, nil).Endpoints()
+		endpoints.Informer().AddEventHandler(handler)
+		listers = append(listers, endpoints.Lister().Endpoints(ns))
+	}
+
+	factory.Start(stopCh)
+	for typ, ok := range factory.WaitForCacheSync(stopCh) {
+		if !ok {
+			close(stopCh)
+			return nil, fmt.Errorf("timed out waiting for caches to sync %s", typ)
+		}
+	}
+
+	k.listersMutex.Lock()
+	k.listers = listers
+	k.listersMutex.Unlock()
+
+	return stopCh, nil
+}
+
+func (k *KubernetesServiceRegistry) update() {
+	instances, err := k.ListAllServiceInstances()
+	if err != nil {
+		logger.Errorf("list all service instances failed: %v", err)
+		return
+	}
+
+	instancesNum := make(map[string]int)
+	for _, instance := range instances {
+		instancesNum[instance.ServiceName]++
+	}
+
+	var event *serviceregistry.RegistryEvent
+	if !k.firstDone {
+		k.firstDone = true
+		event = &serviceregistry.RegistryEvent{
+			SourceRegistryName: k.Name(),
+			UseReplace:         true,
+			Replace:            instances,
+		}
+	} else {
+		event = serviceregistry.NewRegistryEventFromDiff(k.Name(), k.instances, instances)
+	}
+
+	if event.Empty() {
+		return
+	}
+
+	k.notify <- event
+	k.instances = instances
+
+	k.statusMutex.Lock()
+	k.instancesNum = instancesNum
+	k.statusMutex.Unlock()
+}
+
+// Status returns status of KubernetesServiceRegistry.
+func (k *KubernetesServiceRegistry) Status() *supervisor.Status {
+	k.statusMutex.Lock()
+	s := &Status{
+		Health:              k.health,
+		ServiceInstancesNum: k.instancesNum,
+	}
+	k.statusMutex.Unlock()
+
+	return &supervisor.Status{
+		ObjectStatus: s,
+	}
+}
+
+// Close closes KubernetesServiceRegistry.
+func (k *KubernetesServiceRegistry) Close() {
+	k.serviceRegistry.DeregisterRegistry(k.Name())
+
+	close(k.done)
+	k.wg.Wait()
+}
+
+// Name returns name.
+func (k *KubernetesServiceRegistry) Name() string {
+	return k.superSpec.Name()
+}
+
+// Notify returns notify channel.
+func (k *KubernetesServiceRegistry) Notify() <-chan *serviceregistry.RegistryEvent {
+	return k.notify
+}
+
+// ApplyServiceInstances applies service instances to the registry.
+func (k *KubernetesServiceRegistry) ApplyServiceInstances(instances map[string]*serviceregistry.ServiceInstanceSpec) error {
+	return fmt.Errorf("%s is read-only", k.superSpec.Name())
+}
+
+// DeleteServiceInstances applies service instances to the registry.
+func (k *KubernetesServiceRegistry) DeleteServiceInstances(instances map[string]*serviceregistry.ServiceInstanceSpec) error {
+	return fmt.Errorf("%s is read-only", k.superSpec.Name())
+}
+
+// GetServiceInstance get service instance from the registry.
+func (k *KubernetesServiceRegistry) GetServiceInstance(serviceName, instanceID string) (*serviceregistry.ServiceInstanceSpec, error) {
+	instances, err := k.ListServiceInstances(serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, instance := range instances {
+		if instance.InstanceID == instanceID {
+			return instance, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s/%s not found", serviceName, instanceID)
+}
+
+// ListServiceInstances list service instances of one service from the registry.
+func (k *KubernetesServiceRegistry) ListServiceInstances(serviceName string) (map[string]*serviceregistry.ServiceInstanceSpec, error) {
+	all, err := k.ListAllServiceInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make(map[string]*serviceregistry.ServiceInstanceSpec)
+	for key, instance := range all {
+		if instance.ServiceName == serviceName {
+			instances[key] = instance
+		}
+	}
+
+	return instances, nil
+}
+
+// ListAllServiceInstances list all service instances from the registry.
+func (k *KubernetesServiceRegistry) ListAllServiceInstances() (map[string]*serviceregistry.ServiceInstanceSpec, error) {
+	k.listersMutex.RLock()
+	listers := k.listers
+	k.listersMutex.RUnlock()
+
+	if listers == nil {
+		return nil, fmt.Errorf("%s is not connected to kubernetes", k.superSpec.Name())
+	}
+
+	instances := make(map[string]*serviceregistry.ServiceInstanceSpec)
+	for _, lister := range listers {
+		list, err := lister.List(labels.Everything())
+		if err != nil {
+			return nil, fmt.Errorf("%s list endpoints failed: %v", k.superSpec.Name(), err)
+		}
+
+		for _, endpoints := range list {
+			for _, instance := range endpointsToInstances(k.Name(), endpoints) {
+				instances[instance.Key()] = instance
+			}
+		}
+	}
+
+	return instances, nil
+}
+
+// endpointsToInstances converts the ready addresses of the Endpoints to
+// service instances. Every port is published as service
+// namespace/name:port, the port is the name of it, or the number if it
+// has no name. The service namespace/name is also published if the
+// Endpoints has only one port.
+func endpointsToInstances(registryName string, endpoints *apicorev1.Endpoints) []*serviceregistry.ServiceInstanceSpec {
+	baseName := endpoints.Namespace + "/" + endpoints.Name
+
+	ports := map[string]bool{}
+	for _, subset := range endpoints.Subsets {
+		for _, port := range subset.Ports {
+			ports[port.Name] = true
+		}
+	}
+
+	var instances []*serviceregistry.ServiceInstanceSpec
+	for _, subset := range endpoints.Subsets {
+		for _, port := range subset.Ports {
+			if port.Protocol != "" && port.Protocol != apicorev1.ProtocolTCP {
+				continue
+			}
+
+			portName := port.Name
+			if portName == "" {
+				portName = strconv.Itoa(int(port.Port))
+			}
+			serviceNames := []string{baseName + ":" + portName}
+			if len(ports) == 1 {
+				serviceNames = append(serviceNames, baseName)
+			}
+
+			scheme := "http"
+			if port.Name == "https" || (port.AppProtocol != nil && *port.AppProtocol == "https") {
+				scheme = "https"
+			}
+
+			// NOTE: NotReadyAddresses are skipped.
+			for _, address := range subset.Addresses {
+				for _, serviceName := range serviceNames {
+					instances = append(instances, &serviceregistry.ServiceInstanceSpec{
+						RegistryName: registryName,
+						ServiceName:  serviceName,
+						InstanceID:   fmt.Sprintf("%s:%d", address.IP, port.Port),
+						Address:      address.IP,
+						Port:         uint16(port.Port),
+						Scheme:       scheme,
+					})
+				}
+			}
+		}
+	}
+
+	return instances
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetesserviceregistry
+
+import (
+	"sort"
+	"testing"
+
+	apicorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEndpointsToInstances(t *testing.T) {
+	https := "https"
+	endpoints := &apicorev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo"},
+		Subsets: []apicorev1.EndpointSubset{{
+			Addresses:         []apicorev1.EndpointAddress{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}},
+			NotReadyAddresses: []apicorev1.EndpointAddress{{IP: "10.0.0.3"}},
+			Ports: []apicorev1.EndpointPort{
+				{Name: "web", Port: 8080, Protocol: apicorev1.ProtocolTCP},
+				{Name: "admin", Port: 8443, Protocol: apicorev1.ProtocolTCP, AppProtocol: &https},
+				{Name: "dns", Port: 53, Protocol: apicorev1.ProtocolUDP},
+			},
+		}},
+	}
+
+	var urls []string
+	for _, instance := range endpointsToInstances("k8s", endpoints) {
+		if err := instance.Validate(); err != nil {
+			t.Fatalf("invalid instance %+v: %v", instance, err)
+		}
+		urls = append(urls, instance.ServiceName+" "+instance.URL())
+	}
+	sort.Strings(urls)
+
+	expected := []string{
+		"default/foo:admin https://10.0.0.1:8443",
+		"default/foo:admin https://10.0.0.2:8443",
+		"default/foo:web http://10.0.0.1:8080",
+		"default/foo:web http://10.0.0.2:8080",
+	}
+	if len(urls) != len(expected) {
+		t.Fatalf("expect %v, got %v", expected, urls)
+	}
+	for i := range urls {
+		if urls[i] != expected[i] {
+			t.Fatalf("expect %v, got %v", expected, urls)
+		}
+	}
+
+	// the service without port name is also published without port
+	endpoints.Subsets[0].Ports = []apicorev1.EndpointPort{{Port: 80}}
+	names := map[string]int{}
+	for _, instance := range endpointsToInstances("k8s", endpoints) {
+		names[instance.ServiceName]++
+	}
+	if names["default/foo:80"] != 2 || names["default/foo"] != 2 || len(names) != 2 {
+		t.Fatalf("unexpected services %v", names)
+	}
+}
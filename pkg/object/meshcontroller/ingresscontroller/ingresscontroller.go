@@ -251,16 +251,18 @@ func (ic *IngressController) Status() *supervisor.Status {
 
 	ic.tc.WalkHTTPServers(ic.namespace, func(entity *supervisor.ObjectEntity) bool {
 		status.HTTPServers[entity.Spec().Name()] = &trafficcontroller.HTTPServerStatus{
-			Spec:   entity.Spec().RawSpec(),
-			Status: entity.Instance().Status().ObjectStatus.(*httpserver.Status),
+			Spec:       entity.Spec().RawSpec(),
+			Generation: entity.Generation(),
+			Status:     entity.Instance().Status().ObjectStatus.(*httpserver.Status),
 		}
 		return true
 	})
 
 	ic.tc.WalkHTTPPipelines(ic.namespace, func(entity *supervisor.ObjectEntity) bool {
 		status.HTTPPipelines[entity.Spec().Name()] = &trafficcontroller.HTTPPipelineStatus{
-			Spec:   entity.Spec().RawSpec(),
-			Status: entity.Instance().Status().ObjectStatus.(*httppipeline.Status),
+			Spec:       entity.Spec().RawSpec(),
+			Generation: entity.Generation(),
+			Status:     entity.Instance().Status().ObjectStatus.(*httppipeline.Status),
 		}
 		return true
 	})
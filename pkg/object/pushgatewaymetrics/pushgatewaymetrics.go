@@ -0,0 +1,313 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pushgatewaymetrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/filter/proxy"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/trafficcontroller"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/exposition"
+)
+
+const (
+	// Category is the category of PushgatewayMetrics.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of PushgatewayMetrics.
+	Kind = "PushgatewayMetrics"
+
+	defaultJob      = "easegress"
+	defaultInterval = 15 * time.Second
+
+	pushTimeout = 10 * time.Second
+	contentType = "text/plain; version=0.0.4"
+)
+
+func init() {
+	supervisor.Register(&PushgatewayMetrics{})
+}
+
+type (
+	// PushgatewayMetrics is a business controller pushing the metrics of
+	// HTTP servers and proxies to Prometheus Pushgateway periodically, it's
+	// for the short-lived deployments which can't be scraped. The metrics
+	// are pushed once more when it's closed, e.g. at the shutdown.
+	PushgatewayMetrics struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		pushURL  string
+		interval time.Duration
+		client   *http.Client
+
+		mutex        sync.Mutex
+		lastPushedAt time.Time
+		lastErr      error
+
+		done    chan struct{}
+		stopped chan struct{}
+	}
+
+	// Spec describes PushgatewayMetrics.
+	Spec struct {
+		URL      string `yaml:"url" jsonschema:"required,format=url"`
+		Job      string `yaml:"job" jsonschema:"omitempty"`
+		Interval string `yaml:"interval" jsonschema:"omitempty,format=duration"`
+		// Labels are added to the grouping key besides job and instance,
+		// which is the name of the member.
+		Labels map[string]string `yaml:"labels" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of PushgatewayMetrics.
+	Status struct {
+		Health       string `yaml:"health"`
+		LastPushedAt string `yaml:"lastPushedAt,omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	for name := range spec.Labels {
+		if name == "job" || name == "instance" {
+			return fmt.Errorf("label %s is reserved", name)
+		}
+	}
+
+	return nil
+}
+
+// Category returns the category of PushgatewayMetrics.
+func (pm *PushgatewayMetrics) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of PushgatewayMetrics.
+func (pm *PushgatewayMetrics) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of PushgatewayMetrics.
+func (pm *PushgatewayMetrics) DefaultSpec() interface{} {
+	return &Spec{
+		Job:      defaultJob,
+		Interval: defaultInterval.String(),
+	}
+}
+
+// Init initializes PushgatewayMetrics.
+func (pm *PushgatewayMetrics) Init(superSpec *supervisor.Spec) {
+	pm.superSpec, pm.spec, pm.super = superSpec, superSpec.ObjectSpec().(*Spec), superSpec.Super()
+	pm.reload()
+}
+
+// Inherit inherits previous generation of PushgatewayMetrics.
+func (pm *PushgatewayMetrics) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	previousGeneration.Close()
+	pm.Init(superSpec)
+}
+
+func (pm *PushgatewayMetrics) reload() {
+	// NOTE: It has been validated by format=duration.
+	pm.interval, _ = time.ParseDuration(pm.spec.Interval)
+	if pm.interval <= 0 {
+		pm.interval = defaultInterval
+	}
+
+	job := pm.spec.Job
+	if job == "" {
+		job = defaultJob
+	}
+	pm.pushURL = groupingURL(pm.spec.URL, job, pm.super.Options().Name, pm.spec.Labels)
+	pm.client = &http.Client{Timeout: pushTimeout}
+
+	pm.done = make(chan struct{})
+	pm.stopped = make(chan struct{})
+
+	go pm.run()
+}
+
+// groupingURL returns the URL of the group of the metrics.
+// Reference: https://github.com/prometheus/pushgateway#url
+func groupingURL(baseURL, job, instance string, labels map[string]string) string {
+	buff := &strings.Builder{}
+	buff.WriteString(strings.TrimSuffix(baseURL, "/"))
+	buff.WriteString("/metrics/job/" + url.PathEscape(job))
+	buff.WriteString("/instance/" + url.PathEscape(instance))
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		buff.WriteString("/" + url.PathEscape(name) + "/" + url.PathEscape(labels[name]))
+	}
+
+	return buff.String()
+}
+
+func (pm *PushgatewayMetrics) run() {
+	defer close(pm.stopped)
+
+	ticker := time.NewTicker(pm.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pm.done:
+			// NOTE: Flush the metrics at the last moment.
+			pm.push()
+			return
+		case <-ticker.C:
+			pm.push()
+		}
+	}
+}
+
+func (pm *PushgatewayMetrics) push() {
+	err := pm.doPush(pm.collect())
+
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	pm.lastErr = err
+	if err != nil {
+		logger.Errorf("%s push metrics failed: %v", pm.superSpec.Name(), err)
+		return
+	}
+	pm.lastPushedAt = time.Now()
+}
+
+// doPush replaces the metrics of the group by PUT.
+func (pm *PushgatewayMetrics) doPush(metrics []byte) error {
+	req, err := http.NewRequest(http.MethodPut, pm.pushURL, bytes.NewReader(metrics))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := pm.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("status code %d: %s", resp.StatusCode, body)
+	}
+
+	return nil
+}
+
+// collect collects the metrics of HTTP servers and the pools of proxies
+// in all namespaces.
+func (pm *PushgatewayMetrics) collect() []byte {
+	e := exposition.New()
+
+	pm.super.WalkControllers(func(entity *supervisor.ObjectEntity) bool {
+		status, ok := entity.Instance().Status().ObjectStatus.(*trafficcontroller.StatusInSameNamespace)
+		if ok {
+			addNamespace(e, status)
+		}
+		return true
+	})
+
+	return e.Bytes()
+}
+
+func addNamespace(e *exposition.Exposition, status *trafficcontroller.StatusInSameNamespace) {
+	for name, server := range status.HTTPServers {
+		if server.Status == nil || server.Status.Status == nil {
+			continue
+		}
+		e.AddHTTPStat([]exposition.Label{
+			{Name: "namespace", Value: status.Namespace},
+			{Name: "kind", Value: "HTTPServer"},
+			{Name: "name", Value: name},
+		}, server.Status.Status)
+	}
+
+	for name, pipeline := range status.HTTPPipelines {
+		if pipeline.Status == nil {
+			continue
+		}
+		for filterName, filterStatus := range pipeline.Status.Filters {
+			proxyStatus, ok := filterStatus.(*proxy.Status)
+			if !ok {
+				continue
+			}
+			addProxy(e, []exposition.Label{
+				{Name: "namespace", Value: status.Namespace},
+				{Name: "kind", Value: "Proxy"},
+				{Name: "name", Value: name},
+				{Name: "filter", Value: filterName},
+			}, proxyStatus)
+		}
+	}
+}
+
+func addProxy(e *exposition.Exposition, labels []exposition.Label, status *proxy.Status) {
+	addPool := func(pool string, poolStatus *proxy.PoolStatus) {
+		if poolStatus == nil || poolStatus.Stat == nil {
+			return
+		}
+		e.AddHTTPStat(exposition.WithLabel(labels, "pool", pool), poolStatus.Stat)
+	}
+
+	addPool("mainPool", status.MainPool)
+	for i, pool := range status.CandidatePools {
+		addPool(fmt.Sprintf("candidatePool%d", i), pool)
+	}
+	addPool("mirrorPool", status.MirrorPool)
+}
+
+// Status returns the status of PushgatewayMetrics.
+func (pm *PushgatewayMetrics) Status() *supervisor.Status {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	s := &Status{Health: "ready"}
+	if pm.lastErr != nil {
+		s.Health = pm.lastErr.Error()
+	}
+	if !pm.lastPushedAt.IsZero() {
+		s.LastPushedAt = pm.lastPushedAt.Format(time.RFC3339)
+	}
+
+	return &supervisor.Status{ObjectStatus: s}
+}
+
+// Close closes PushgatewayMetrics, it waits for the final push.
+func (pm *PushgatewayMetrics) Close() {
+	close(pm.done)
+	<-pm.stopped
+}
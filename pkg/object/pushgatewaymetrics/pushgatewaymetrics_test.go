@@ -0,0 +1,33 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pushgatewaymetrics
+
+import (
+	"testing"
+)
+
+func TestGroupingURL(t *testing.T) {
+	got := groupingURL("http://127.0.0.1:9091/", "easegress", "eg/1", map[string]string{
+		"zone": "a",
+		"env":  "prod",
+	})
+	want := "http://127.0.0.1:9091/metrics/job/easegress/instance/eg%2F1/env/prod/zone/a"
+	if got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
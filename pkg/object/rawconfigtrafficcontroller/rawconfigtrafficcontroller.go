@@ -199,16 +199,18 @@ func (rctc *RawConfigTrafficController) Status() *supervisor.Status {
 
 	rctc.tc.WalkHTTPServers(rctc.namespace, func(entity *supervisor.ObjectEntity) bool {
 		status.HTTPServers[entity.Spec().Name()] = &trafficcontroller.HTTPServerStatus{
-			Spec:   entity.Spec().RawSpec(),
-			Status: entity.Instance().Status().ObjectStatus.(*httpserver.Status),
+			Spec:       entity.Spec().RawSpec(),
+			Generation: entity.Generation(),
+			Status:     entity.Instance().Status().ObjectStatus.(*httpserver.Status),
 		}
 		return true
 	})
 
 	rctc.tc.WalkHTTPPipelines(rctc.namespace, func(entity *supervisor.ObjectEntity) bool {
 		status.HTTPPipelines[entity.Spec().Name()] = &trafficcontroller.HTTPPipelineStatus{
-			Spec:   entity.Spec().RawSpec(),
-			Status: entity.Instance().Status().ObjectStatus.(*httppipeline.Status),
+			Spec:       entity.Spec().RawSpec(),
+			Generation: entity.Generation(),
+			Status:     entity.Instance().Status().ObjectStatus.(*httppipeline.Status),
 		}
 		return true
 	})
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rejectionresponse
+
+import (
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/rejection"
+)
+
+const (
+	// Category is the category of RejectionResponse.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of RejectionResponse.
+	Kind = "RejectionResponse"
+)
+
+func init() {
+	supervisor.Register(&RejectionResponse{})
+}
+
+type (
+	// RejectionResponse is a business controller holding a response
+	// template, the filters referencing it by rejectionResponse respond
+	// it when they reject requests.
+	RejectionResponse struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+	}
+
+	// Spec describes RejectionResponse.
+	Spec struct {
+		rejection.Spec `yaml:",inline"`
+	}
+)
+
+// Category returns the category of RejectionResponse.
+func (rr *RejectionResponse) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of RejectionResponse.
+func (rr *RejectionResponse) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of RejectionResponse.
+func (rr *RejectionResponse) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Init initializes RejectionResponse.
+func (rr *RejectionResponse) Init(superSpec *supervisor.Spec) {
+	rr.superSpec, rr.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+
+	// NOTE: It has been validated.
+	r, _ := rejection.New(&rr.spec.Spec)
+	rejection.Set(rr.superSpec.Name(), r)
+}
+
+// Inherit inherits previous generation of RejectionResponse.
+func (rr *RejectionResponse) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	// NOTE: The previous generation is not closed, otherwise the filters
+	// respond empty bodies until the response is set again.
+	rr.Init(superSpec)
+}
+
+// Status returns the status of RejectionResponse.
+func (rr *RejectionResponse) Status() *supervisor.Status {
+	return &supervisor.Status{}
+}
+
+// Close closes RejectionResponse.
+func (rr *RejectionResponse) Close() {
+	rejection.Delete(rr.superSpec.Name())
+}
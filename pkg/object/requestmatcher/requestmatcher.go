@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package requestmatcher
+
+import (
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/matcher"
+)
+
+const (
+	// Category is the category of RequestMatcher.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of RequestMatcher.
+	Kind = "RequestMatcher"
+)
+
+func init() {
+	supervisor.Register(&RequestMatcher{})
+}
+
+type (
+	// RequestMatcher is a business controller holding a request matcher,
+	// the routing rules and the pipeline flows referencing it by name
+	// share the compiled matcher.
+	RequestMatcher struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+	}
+
+	// Spec describes RequestMatcher.
+	Spec struct {
+		matcher.Spec `yaml:",inline"`
+	}
+)
+
+// Category returns the category of RequestMatcher.
+func (rm *RequestMatcher) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of RequestMatcher.
+func (rm *RequestMatcher) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of RequestMatcher.
+func (rm *RequestMatcher) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Init initializes RequestMatcher.
+func (rm *RequestMatcher) Init(superSpec *supervisor.Spec) {
+	rm.superSpec, rm.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+
+	// NOTE: It has been validated.
+	m, _ := matcher.New(&rm.spec.Spec)
+	matcher.Set(rm.superSpec.Name(), m)
+}
+
+// Inherit inherits previous generation of RequestMatcher.
+func (rm *RequestMatcher) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	// NOTE: The previous generation is not closed, otherwise the requests
+	// don't match until the matcher is set again.
+	rm.Init(superSpec)
+}
+
+// Status returns the status of RequestMatcher.
+func (rm *RequestMatcher) Status() *supervisor.Status {
+	return &supervisor.Status{}
+}
+
+// Close closes RequestMatcher.
+func (rm *RequestMatcher) Close() {
+	matcher.Delete(rm.superSpec.Name())
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package servergroup
+
+import (
+	"fmt"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/upstream"
+)
+
+const (
+	// Category is the category of ServerGroup.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of ServerGroup.
+	Kind = "ServerGroup"
+)
+
+func init() {
+	supervisor.Register(&ServerGroup{})
+}
+
+type (
+	// ServerGroup is a business controller holding a named group of
+	// servers, the pools of Proxy referencing it by serverGroup are
+	// updated together when it changes.
+	ServerGroup struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+	}
+
+	// Spec describes ServerGroup.
+	Spec struct {
+		Servers []*upstream.Server `yaml:"servers" jsonschema:"required,minItems=1"`
+	}
+
+	// Status is the status of ServerGroup.
+	Status struct {
+		Servers int `yaml:"servers"`
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	serversGotWeight := 0
+	for _, server := range spec.Servers {
+		if server.Weight > 0 {
+			serversGotWeight++
+		}
+	}
+	if serversGotWeight > 0 && serversGotWeight < len(spec.Servers) {
+		return fmt.Errorf("not all servers have weight(%d/%d)",
+			serversGotWeight, len(spec.Servers))
+	}
+
+	return nil
+}
+
+// Category returns the category of ServerGroup.
+func (sg *ServerGroup) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of ServerGroup.
+func (sg *ServerGroup) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of ServerGroup.
+func (sg *ServerGroup) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Init initializes ServerGroup.
+func (sg *ServerGroup) Init(superSpec *supervisor.Spec) {
+	sg.superSpec, sg.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	upstream.Set(sg.superSpec.Name(), sg.spec.Servers)
+}
+
+// Inherit inherits previous generation of ServerGroup.
+func (sg *ServerGroup) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	// NOTE: The previous generation is not closed, otherwise the pools
+	// fall back to their own servers until the group is set again.
+	sg.Init(superSpec)
+}
+
+// Status returns the status of ServerGroup.
+func (sg *ServerGroup) Status() *supervisor.Status {
+	return &supervisor.Status{ObjectStatus: &Status{Servers: len(sg.spec.Servers)}}
+}
+
+// Close closes ServerGroup.
+func (sg *ServerGroup) Close() {
+	upstream.Delete(sg.superSpec.Name())
+}
@@ -81,6 +81,7 @@ func marshalStatus(status *supervisor.Status) ([]byte, error) {
 	}
 
 	m["timestamp"] = status.Timestamp
+	m["generation"] = status.Generation
 
 	buff, err = yaml.Marshal(m)
 	if err != nil {
@@ -171,6 +172,7 @@ func (ssc *StatusSyncController) handleStatus(unixTimestamp int64) {
 
 		status := entity.Instance().Status()
 		status.Timestamp = unixTimestamp
+		status.Generation = entity.Generation()
 
 		statusesRecord.Statuses[name] = status
 
@@ -76,14 +76,16 @@ type (
 
 	// HTTPServerStatus is the HTTP server status
 	HTTPServerStatus struct {
-		Spec   map[string]interface{} `yaml:"spec"`
-		Status *httpserver.Status     `yaml:"status"`
+		Spec       map[string]interface{} `yaml:"spec"`
+		Generation uint64                 `yaml:"generation"`
+		Status     *httpserver.Status     `yaml:"status"`
 	}
 
 	// HTTPPipelineStatus is the HTTP pipeline status
 	HTTPPipelineStatus struct {
-		Spec   map[string]interface{} `yaml:"spec"`
-		Status *httppipeline.Status   `yaml:"status"`
+		Spec       map[string]interface{} `yaml:"spec"`
+		Generation uint64                 `yaml:"generation"`
+		Status     *httppipeline.Status   `yaml:"status"`
 	}
 
 	// StatusInSameNamespace is the universal status in one space.
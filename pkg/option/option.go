@@ -23,6 +23,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -31,6 +32,7 @@ import (
 	"github.com/spf13/viper"
 	yaml "gopkg.in/yaml.v2"
 
+	"github.com/megaease/easegress/pkg/cluster/discovery"
 	"github.com/megaease/easegress/pkg/common"
 	"github.com/megaease/easegress/pkg/version"
 )
@@ -48,6 +50,7 @@ type Options struct {
 	ConfigFile      string `yaml:"-"`
 	ForceNewCluster bool   `yaml:"-"`
 	SignalUpgrade   bool   `yaml:"-"`
+	ValidateOnly    string `yaml:"-"`
 
 	// If a config file is specified, below command line flags will be ignored.
 
@@ -62,9 +65,19 @@ type Options struct {
 	ClusterAdvertiseClientURLs      []string          `yaml:"cluster-advertise-client-urls"`
 	ClusterInitialAdvertisePeerURLs []string          `yaml:"cluster-initial-advertise-peer-urls"`
 	ClusterJoinURLs                 []string          `yaml:"cluster-join-urls"`
+	ClusterDiscovery                string            `yaml:"cluster-discovery"`
+	ClusterDiscoverySRVName         string            `yaml:"cluster-discovery-srv-name"`
+	ClusterDiscoveryTag             string            `yaml:"cluster-discovery-tag"`
+	ClusterDiscoveryTimeout         string            `yaml:"cluster-discovery-timeout"`
 	APIAddr                         string            `yaml:"api-addr"`
 	Debug                           bool              `yaml:"debug"`
 	InitialObjectConfigFiles        []string          `yaml:"initial-object-config-files"`
+	InitialObjectConfigURL          string            `yaml:"initial-object-config-url"`
+	InitialObjectConfigSignatureURL string            `yaml:"initial-object-config-signature-url"`
+	InitialObjectConfigPublicKey    string            `yaml:"initial-object-config-public-key"`
+	AccessLogSinkURL                string            `yaml:"access-log-sink-url"`
+	AccessLogWALFsync               bool              `yaml:"access-log-wal-fsync"`
+	PluginDir                       string            `yaml:"plugin-dir"`
 
 	// Path.
 	HomeDir   string `yaml:"home-dir"`
@@ -98,6 +111,7 @@ func New() *Options {
 	opt.flags.StringVarP(&opt.ConfigFile, "config-file", "f", "", "Load server configuration from a file(yaml format), other command line flags will be ignored if specified.")
 	opt.flags.BoolVar(&opt.ForceNewCluster, "force-new-cluster", false, "Force to create a new one-member cluster.")
 	opt.flags.BoolVar(&opt.SignalUpgrade, "signal-upgrade", false, "Send an upgrade signal to the server based on the local pid file, then exit. The original server will start a graceful upgrade after signal received.")
+	opt.flags.StringVar(&opt.ValidateOnly, "validate-only", "", "Validate the object specs in the yaml files under the directory without running them, then print the report in JSON and exit, the exit code is nonzero if any spec is invalid.")
 	opt.flags.StringVar(&opt.Name, "name", "eg-default-name", "Human-readable name for this member.")
 	opt.flags.StringToStringVar(&opt.Labels, "labels", nil, "The labels for the instance of Easegress.")
 	opt.flags.StringVar(&opt.ClusterName, "cluster-name", "eg-cluster-default-name", "Human-readable name for the new cluster, ignored while joining an existed cluster.")
@@ -108,9 +122,19 @@ func New() *Options {
 	opt.flags.StringSliceVar(&opt.ClusterAdvertiseClientURLs, "cluster-advertise-client-urls", []string{"http://localhost:2379"}, "List of this member’s client URLs to advertise to the rest of the cluster.")
 	opt.flags.StringSliceVar(&opt.ClusterInitialAdvertisePeerURLs, "cluster-initial-advertise-peer-urls", []string{"http://localhost:2380"}, "List of this member’s peer URLs to advertise to the rest of the cluster.")
 	opt.flags.StringSliceVar(&opt.ClusterJoinURLs, "cluster-join-urls", nil, "List of URLs to join, when the first url is the same with any one of cluster-initial-advertise-peer-urls, it means to join itself, and this config will be treated empty.")
+	opt.flags.StringVar(&opt.ClusterDiscovery, "cluster-discovery", "", "Mode to discover cluster-join-urls when it is empty (dns-srv, ec2, gce).")
+	opt.flags.StringVar(&opt.ClusterDiscoverySRVName, "cluster-discovery-srv-name", "", "Full name of the DNS SRV record of peers for dns-srv discovery, e.g. _eg-peer._tcp.example.com.")
+	opt.flags.StringVar(&opt.ClusterDiscoveryTag, "cluster-discovery-tag", "", "The key=value tag(ec2) or label(gce) of instances for ec2/gce discovery.")
+	opt.flags.StringVar(&opt.ClusterDiscoveryTimeout, "cluster-discovery-timeout", "60s", "Max duration to wait for discovering at least one peer.")
 	opt.flags.StringVar(&opt.APIAddr, "api-addr", "localhost:2381", "Address([host]:port) to listen on for administration traffic.")
 	opt.flags.BoolVar(&opt.Debug, "debug", false, "Flag to set lowest log level from INFO downgrade DEBUG.")
 	opt.flags.StringSliceVar(&opt.InitialObjectConfigFiles, "initial-object-config-files", nil, "List of configuration files for initial objects, these objects will be created at startup if not already exist.")
+	opt.flags.StringVar(&opt.InitialObjectConfigURL, "initial-object-config-url", "", "URL(https, s3 or gs) of the configuration of initial objects fetched at startup, they are created only if the signature is verified by initial-object-config-public-key.")
+	opt.flags.StringVar(&opt.InitialObjectConfigSignatureURL, "initial-object-config-signature-url", "", "URL of the detached signature of initial-object-config-url, default is the URL with the suffix .sig.")
+	opt.flags.StringVar(&opt.InitialObjectConfigPublicKey, "initial-object-config-public-key", "", "Path to the PEM public key(Ed25519, RSA or ECDSA) verifying the signature of initial-object-config-url.")
+	opt.flags.StringVar(&opt.AccessLogSinkURL, "access-log-sink-url", "", "HTTP URL to ship HTTP access logs to through a local write-ahead log, the logs are kept and replayed until the sink acknowledges them with 2xx. Empty means writing access logs to the log file.")
+	opt.flags.BoolVar(&opt.AccessLogWALFsync, "access-log-wal-fsync", true, "Flag to sync the access log write-ahead log to disk on every record.")
+	opt.flags.StringVar(&opt.PluginDir, "plugin-dir", "", "Path to the directory of Go plugins (*.so) providing external filters, they are loaded at startup.")
 
 	opt.flags.StringVar(&opt.HomeDir, "home-dir", "./", "Path to the home directory.")
 	opt.flags.StringVar(&opt.DataDir, "data-dir", "data", "Path to the data directory.")
@@ -176,6 +200,11 @@ func (opt *Options) Parse() (string, error) {
 		c.TagName = "yaml"
 	})
 
+	err = opt.discover()
+	if err != nil {
+		return "", err
+	}
+
 	err = opt.validate()
 	if err != nil {
 		return "", err
@@ -224,6 +253,50 @@ func (opt *Options) adjust() {
 	}
 }
 
+// discover fills cluster-join-urls by discovering peers if it is empty.
+// The scheme and port of peers are taken from the first of
+// cluster-initial-advertise-peer-urls, because the members started
+// from the same configuration listen on the same port.
+func (opt *Options) discover() error {
+	if opt.ClusterDiscovery == "" || len(opt.ClusterJoinURLs) != 0 {
+		return nil
+	}
+
+	timeout, err := time.ParseDuration(opt.ClusterDiscoveryTimeout)
+	if err != nil {
+		return fmt.Errorf("invalid cluster-discovery-timeout: %v", err)
+	}
+
+	spec := &discovery.Spec{
+		Mode:       opt.ClusterDiscovery,
+		SRVName:    opt.ClusterDiscoverySRVName,
+		Tag:        opt.ClusterDiscoveryTag,
+		PeerScheme: "http",
+		PeerPort:   2380,
+		Timeout:    timeout,
+	}
+	if len(opt.ClusterInitialAdvertisePeerURLs) != 0 {
+		u, err := url.Parse(opt.ClusterInitialAdvertisePeerURLs[0])
+		if err != nil {
+			return fmt.Errorf("invalid cluster-initial-advertise-peer-urls: %v", err)
+		}
+		spec.PeerScheme = u.Scheme
+		if port, err := strconv.Atoi(u.Port()); err == nil {
+			spec.PeerPort = port
+		}
+	}
+
+	urls, err := discovery.Discover(spec)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("cluster-join-urls discovered by %s: %v\n", opt.ClusterDiscovery, urls)
+	opt.ClusterJoinURLs = urls
+
+	return nil
+}
+
 func (opt *Options) validate() error {
 	if opt.ClusterName == "" {
 		return fmt.Errorf("empty cluster-name")
@@ -313,6 +386,34 @@ func (opt *Options) validate() error {
 		return fmt.Errorf("invalid api-url: %v", err)
 	}
 
+	if opt.AccessLogSinkURL != "" {
+		u, err := url.Parse(opt.AccessLogSinkURL)
+		if err != nil {
+			return fmt.Errorf("invalid access-log-sink-url: %v", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("invalid access-log-sink-url: unsupported scheme %s", u.Scheme)
+		}
+	}
+
+	if opt.InitialObjectConfigURL != "" {
+		if opt.InitialObjectConfigPublicKey == "" {
+			return fmt.Errorf("initial-object-config-url needs initial-object-config-public-key")
+		}
+		for _, rawURL := range []string{opt.InitialObjectConfigURL, opt.InitialObjectConfigSignatureURL} {
+			if rawURL == "" {
+				continue
+			}
+			u, err := url.Parse(rawURL)
+			if err != nil {
+				return fmt.Errorf("invalid url %s: %v", rawURL, err)
+			}
+			if u.Scheme != "https" && u.Scheme != "s3" && u.Scheme != "gs" {
+				return fmt.Errorf("invalid url %s: unsupported scheme %s", rawURL, u.Scheme)
+			}
+		}
+	}
+
 	// dirs
 	if opt.HomeDir == "" {
 		return fmt.Errorf("empty home-dir")
@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package plugin loads the filters developed out of the tree from Go
+// plugins, the loaded filters are registered as the built-in ones, so
+// they are used in pipelines and their specs are validated as usual.
+//
+// A plugin is built with `go build -buildmode=plugin` against the same
+// version of Easegress and Go, and exports a function named Filters:
+//
+//	func Filters() []httppipeline.Filter
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	goplugin "plugin"
+	"sort"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+)
+
+// FiltersSymbol is the name of the function exported by the plugins.
+const FiltersSymbol = "Filters"
+
+// Load loads all plugins (*.so) in the directory in the order of their
+// names, and returns the kinds of the registered filters.
+func Load(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read plugin dir %s failed: %v", dir, err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".so") {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+
+	var kinds []string
+	for _, file := range files {
+		filters, err := open(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range filters {
+			if err := register(f); err != nil {
+				return nil, fmt.Errorf("plugin %s: %v", file, err)
+			}
+			kinds = append(kinds, f.Kind())
+		}
+	}
+
+	return kinds, nil
+}
+
+func open(file string) ([]httppipeline.Filter, error) {
+	p, err := goplugin.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("open plugin %s failed: %v", file, err)
+	}
+
+	sym, err := p.Lookup(FiltersSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %v", file, err)
+	}
+
+	filters, ok := sym.(func() []httppipeline.Filter)
+	if !ok {
+		return nil, fmt.Errorf("plugin %s: want %s of func() []httppipeline.Filter, got %T",
+			file, FiltersSymbol, sym)
+	}
+
+	return filters(), nil
+}
+
+// register registers the filter, the panic of invalid filters is turned
+// into an error to report which plugin it comes from.
+func register(f httppipeline.Filter) (err error) {
+	if f == nil {
+		return fmt.Errorf("nil filter")
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("register filter failed: %v", r)
+		}
+	}()
+
+	httppipeline.Register(f)
+	return nil
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/httppipeline"
+)
+
+type (
+	mockFilter struct{}
+	mockSpec   struct{}
+)
+
+func (f *mockFilter) Kind() string                                          { return "PluginMockFilter" }
+func (f *mockFilter) DefaultSpec() interface{}                              { return &mockSpec{} }
+func (f *mockFilter) Description() string                                   { return "mock" }
+func (f *mockFilter) Results() []string                                     { return nil }
+func (f *mockFilter) Init(filterSpec *httppipeline.FilterSpec)              {}
+func (f *mockFilter) Inherit(*httppipeline.FilterSpec, httppipeline.Filter) {}
+func (f *mockFilter) Handle(ctx context.HTTPContext) string                 { return "" }
+func (f *mockFilter) Status() interface{}                                   { return nil }
+func (f *mockFilter) Close()                                                {}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	kinds, err := Load(dir)
+	if err != nil || len(kinds) != 0 {
+		t.Fatalf("want no kinds and no error, got %v, %v", kinds, err)
+	}
+
+	// files without the suffix are ignored
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("readme"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "bad.so"), []byte("not a plugin"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir); err == nil {
+		t.Fatal("want an error for an invalid plugin")
+	}
+
+	if _, err := Load(filepath.Join(dir, "not-exist")); err == nil {
+		t.Fatal("want an error for a missing dir")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	if err := register(nil); err == nil {
+		t.Error("want an error for a nil filter")
+	}
+
+	if err := register(&mockFilter{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, exists := httppipeline.GetFilterRegistry()["PluginMockFilter"]; !exists {
+		t.Error("filter is not registered")
+	}
+
+	if err := register(&mockFilter{}); err == nil {
+		t.Error("want an error for a duplicated kind")
+	}
+}
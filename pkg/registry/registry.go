@@ -21,6 +21,7 @@ import (
 
 	// Filters
 	_ "github.com/megaease/easegress/pkg/filter/apiaggregator"
+	_ "github.com/megaease/easegress/pkg/filter/bandwidthlimiter"
 	_ "github.com/megaease/easegress/pkg/filter/bridge"
 	_ "github.com/megaease/easegress/pkg/filter/circuitbreaker"
 	_ "github.com/megaease/easegress/pkg/filter/corsadaptor"
@@ -37,18 +38,26 @@ import (
 	_ "github.com/megaease/easegress/pkg/filter/wasmhost"
 
 	// Objects
+	_ "github.com/megaease/easegress/pkg/object/canaryanalysis"
 	_ "github.com/megaease/easegress/pkg/object/consulserviceregistry"
 	_ "github.com/megaease/easegress/pkg/object/easemonitormetrics"
+	_ "github.com/megaease/easegress/pkg/object/egresspolicy"
 	_ "github.com/megaease/easegress/pkg/object/etcdserviceregistry"
 	_ "github.com/megaease/easegress/pkg/object/eurekaserviceregistry"
+	_ "github.com/megaease/easegress/pkg/object/forwardproxy"
 	_ "github.com/megaease/easegress/pkg/object/function"
 	_ "github.com/megaease/easegress/pkg/object/httppipeline"
 	_ "github.com/megaease/easegress/pkg/object/httpserver"
 	_ "github.com/megaease/easegress/pkg/object/ingresscontroller"
+	_ "github.com/megaease/easegress/pkg/object/kubernetesserviceregistry"
 	_ "github.com/megaease/easegress/pkg/object/meshcontroller"
 	_ "github.com/megaease/easegress/pkg/object/mqttproxy"
 	_ "github.com/megaease/easegress/pkg/object/nacosserviceregistry"
+	_ "github.com/megaease/easegress/pkg/object/pushgatewaymetrics"
 	_ "github.com/megaease/easegress/pkg/object/rawconfigtrafficcontroller"
+	_ "github.com/megaease/easegress/pkg/object/rejectionresponse"
+	_ "github.com/megaease/easegress/pkg/object/requestmatcher"
+	_ "github.com/megaease/easegress/pkg/object/servergroup"
 	_ "github.com/megaease/easegress/pkg/object/trafficcontroller"
 	_ "github.com/megaease/easegress/pkg/object/websocketserver"
 	_ "github.com/megaease/easegress/pkg/object/zookeeperserviceregistry"
@@ -0,0 +1,250 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package supervisor
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+const (
+	bootstrapAttempts      = 3
+	bootstrapRetryInterval = 2 * time.Second
+	// maxBootstrapSize is the max size of the bootstrap config and the
+	// signature.
+	maxBootstrapSize = 16 << 20
+)
+
+var bootstrapClient = &http.Client{Timeout: 30 * time.Second}
+
+// loadBootstrapObjects fetches the specs of the initial objects from the
+// remote URL, they are applied only if the detached signature is verified
+// by the public key, so the immutable images don't need baked-in specs.
+func loadBootstrapObjects(s *Supervisor, opt *option.Options) map[string]string {
+	objs := map[string]string{}
+	if opt.InitialObjectConfigURL == "" {
+		return objs
+	}
+
+	configs, err := fetchBootstrapConfigs(opt.InitialObjectConfigURL,
+		opt.InitialObjectConfigSignatureURL, opt.InitialObjectConfigPublicKey)
+	if err != nil {
+		logger.Errorf("failed to bootstrap initial objects from %s: %v", opt.InitialObjectConfigURL, err)
+		return objs
+	}
+
+	for i, config := range configs {
+		spec, err := s.NewSpec(config)
+		if err != nil {
+			logger.Errorf("failed to create spec for bootstrap object %d: %v", i, err)
+			continue
+		}
+		objs[spec.Name()] = spec.YAMLConfig()
+	}
+	logger.Infof("bootstrap %d initial objects from %s", len(objs), opt.InitialObjectConfigURL)
+
+	return objs
+}
+
+// fetchBootstrapConfigs fetches the config and its signature, and returns
+// the specs in the config after the signature is verified. The signature
+// is fetched from the URL of the config with the suffix .sig by default.
+func fetchBootstrapConfigs(configURL, signatureURL, publicKeyFile string) ([]string, error) {
+	pemData, err := os.ReadFile(publicKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read public key failed: %v", err)
+	}
+	publicKey, err := parsePublicKey(pemData)
+	if err != nil {
+		return nil, err
+	}
+
+	if signatureURL == "" {
+		signatureURL = configURL + ".sig"
+	}
+	data, err := fetchBootstrap(configURL)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := fetchBootstrap(signatureURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifySignature(publicKey, data, decodeSignature(signature)); err != nil {
+		return nil, err
+	}
+
+	return splitConfigs(data)
+}
+
+// bootstrapURL returns the HTTPS URL of the object, the objects of S3
+// (s3://bucket/key) and GCS (gs://bucket/object) are fetched from their
+// public endpoints, the private ones need presigned HTTPS URLs.
+func bootstrapURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	switch u.Scheme {
+	case "https":
+		return rawURL, nil
+	case "s3":
+		return fmt.Sprintf("https://%s.s3.amazonaws.com%s", u.Host, u.EscapedPath()), nil
+	case "gs":
+		return fmt.Sprintf("https://storage.googleapis.com/%s%s", u.Host, u.EscapedPath()), nil
+	default:
+		return "", fmt.Errorf("unsupported scheme %s, want https, s3 or gs", u.Scheme)
+	}
+}
+
+func fetchBootstrap(rawURL string) ([]byte, error) {
+	fetchURL, err := bootstrapURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		var data []byte
+		data, err = fetchBootstrapOnce(fetchURL)
+		if err == nil || attempt == bootstrapAttempts {
+			return data, err
+		}
+		logger.Warnf("fetch %s failed, retry in %s: %v", rawURL, bootstrapRetryInterval, err)
+		time.Sleep(bootstrapRetryInterval)
+	}
+}
+
+func fetchBootstrapOnce(fetchURL string) ([]byte, error) {
+	resp, err := bootstrapClient.Get(fetchURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s failed: status code %d", fetchURL, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBootstrapSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read %s failed: %v", fetchURL, err)
+	}
+	if len(data) > maxBootstrapSize {
+		return nil, fmt.Errorf("%s exceeds %d bytes", fetchURL, maxBootstrapSize)
+	}
+	return data, nil
+}
+
+// parsePublicKey parses the PEM encoded PKIX public key of Ed25519, RSA
+// or ECDSA.
+func parsePublicKey(pemData []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in public key")
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse public key failed: %v", err)
+	}
+
+	switch publicKey.(type) {
+	case ed25519.PublicKey, *rsa.PublicKey, *ecdsa.PublicKey:
+		return publicKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key %T", publicKey)
+	}
+}
+
+// decodeSignature decodes the signature in base64, or returns it as is
+// if it's binary.
+func decodeSignature(signature []byte) []byte {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return signature
+	}
+	return decoded
+}
+
+// verifySignature verifies the signature of the data, the RSA (PKCS #1
+// v1.5) and ECDSA (ASN.1) signatures are of the SHA-256 digest.
+func verifySignature(publicKey crypto.PublicKey, data, signature []byte) error {
+	digest := sha256.Sum256(data)
+
+	var ok bool
+	switch key := publicKey.(type) {
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(key, digest[:], signature)
+	}
+
+	if !ok {
+		return fmt.Errorf("verify signature failed")
+	}
+	return nil
+}
+
+// splitConfigs splits the specs separated by `---` in the data.
+func splitConfigs(data []byte) ([]string, error) {
+	configs := []string{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc map[string]interface{}
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return configs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decode yaml failed: %v", err)
+		}
+		if doc == nil {
+			continue
+		}
+
+		config, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("marshal to yaml failed: %v", err)
+		}
+		configs = append(configs, string(config))
+	}
+}
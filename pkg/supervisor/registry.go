@@ -23,6 +23,7 @@ import (
 	"sort"
 
 	"github.com/megaease/easegress/pkg/protocol"
+	"github.com/megaease/easegress/pkg/util/capability"
 )
 
 type (
@@ -49,12 +50,16 @@ type (
 	// Status is the universal status for all objects.
 	Status struct {
 		// ObjectStatus must be a map or struct (empty is allowed),
-		// If the ObjectStatus contains field `timestamp`,
-		// it will be covered by the top-level Timestamp here.
+		// If the ObjectStatus contains field `timestamp` or `generation`,
+		// it will be covered by the top-level Timestamp or Generation here.
 		ObjectStatus interface{}
 		// Timestamp is the global unix timestamp, the object
 		// needs not to set it on its own.
 		Timestamp int64
+		// Generation is the generation of the object reporting the status,
+		// it's increased by every update of the spec, the object needs not
+		// to set it on its own.
+		Generation uint64
 	}
 
 	// TrafficObject is the object of Traffic
@@ -203,4 +208,5 @@ func Register(o Object) {
 
 	objectRegistry[o.Kind()] = o
 	objectRegistryOrderByDependency = append(objectRegistryOrderByDependency, o)
+	capability.Register(capability.Kind, o.Kind())
 }
@@ -40,6 +40,10 @@ type (
 	MetaSpec struct {
 		Name string `yaml:"name" jsonschema:"required,format=urlname"`
 		Kind string `yaml:"kind" jsonschema:"required"`
+		// Requires are the capabilities like filter/Proxy the spec
+		// requires, the spec is rejected by the binaries not supporting
+		// them instead of ignoring the unknown fields.
+		Requires []string `yaml:"requires,omitempty" jsonschema:"omitempty,uniqueItems=true,format=capability-array"`
 	}
 )
 
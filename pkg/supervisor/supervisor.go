@@ -88,6 +88,9 @@ func MustNew(opt *option.Options, cls cluster.Cluster) *Supervisor {
 	}
 
 	initObjs := loadInitialObjects(s, opt.InitialObjectConfigFiles)
+	for name, config := range loadBootstrapObjects(s, opt) {
+		initObjs[name] = config
+	}
 
 	s.objectRegistry = newObjectRegistry(s, initObjs)
 	s.watcher = s.objectRegistry.NewWatcher(watcherName, FilterCategory(
@@ -0,0 +1,169 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package supervisor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/megaease/easegress/pkg/v"
+)
+
+type (
+	// ValidationReport is the report of validating the specs in a directory.
+	ValidationReport struct {
+		Valid   bool                `json:"valid"`
+		Objects []*ValidationResult `json:"objects"`
+	}
+
+	// ValidationResult is the result of validating one spec.
+	ValidationResult struct {
+		File   string   `json:"file"`
+		Index  int      `json:"index"`
+		Name   string   `json:"name,omitempty"`
+		Kind   string   `json:"kind,omitempty"`
+		Valid  bool     `json:"valid"`
+		Errors []string `json:"errors,omitempty"`
+	}
+
+	validationDoc struct {
+		result *ValidationResult
+		config string
+	}
+)
+
+// ValidateDir validates the specs in the yaml files under the directory
+// without running them, which could be used as a pre-deploy gate. A file
+// could contain multiple specs separated by `---`. Besides the validation
+// of every spec, the names must be unique, and the references to other
+// objects such as ServerGroup must be satisfied by the specs in the
+// directory.
+func ValidateDir(dir string) (*ValidationReport, error) {
+	docs, err := loadValidationDocs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]*ValidationResult{}
+	kindNames := map[string][]string{}
+	for _, doc := range docs {
+		meta := &MetaSpec{}
+		err := yaml.Unmarshal([]byte(doc.config), meta)
+		if err != nil {
+			doc.result.addError(fmt.Errorf("unmarshal to yaml failed: %v", err))
+			continue
+		}
+
+		doc.result.Name, doc.result.Kind = meta.Name, meta.Kind
+		if meta.Name == "" {
+			continue
+		}
+
+		if prev, exists := names[meta.Name]; exists {
+			doc.result.addError(fmt.Errorf("name %s conflicts with %s[%d]",
+				meta.Name, prev.File, prev.Index))
+			continue
+		}
+		names[meta.Name] = doc.result
+		kindNames[meta.Kind] = append(kindNames[meta.Kind], meta.Name)
+	}
+
+	v.UseObjectNames(kindNames)
+	defer v.UseObjectNames(nil)
+
+	s := &Supervisor{}
+	report := &ValidationReport{Valid: true}
+	for _, doc := range docs {
+		if len(doc.result.Errors) == 0 {
+			_, err := s.NewSpec(doc.config)
+			if err != nil {
+				doc.result.addError(err)
+			}
+		}
+
+		doc.result.Valid = len(doc.result.Errors) == 0
+		if !doc.result.Valid {
+			report.Valid = false
+		}
+		report.Objects = append(report.Objects, doc.result)
+	}
+
+	return report, nil
+}
+
+func (r *ValidationResult) addError(err error) {
+	r.Errors = append(r.Errors, err.Error())
+}
+
+func loadValidationDocs(dir string) ([]*validationDoc, error) {
+	docs := []*validationDoc{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		ext := strings.ToLower(filepath.Ext(path))
+		if d.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			return nil
+		}
+
+		buff, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		decoder := yaml.NewDecoder(bytes.NewReader(buff))
+		for index := 0; ; index++ {
+			result := &ValidationResult{File: path, Index: index}
+
+			var doc map[string]interface{}
+			err := decoder.Decode(&doc)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				// The decoder can't continue after a syntax error.
+				result.addError(fmt.Errorf("decode yaml failed: %v", err))
+				docs = append(docs, &validationDoc{result: result})
+				return nil
+			}
+			if doc == nil {
+				continue
+			}
+
+			config, err := yaml.Marshal(doc)
+			if err != nil {
+				result.addError(fmt.Errorf("marshal to yaml failed: %v", err))
+			}
+			docs = append(docs, &validationDoc{result: result, config: string(config)})
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load specs from %s failed: %v", dir, err)
+	}
+
+	return docs, nil
+}
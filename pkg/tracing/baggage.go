@@ -0,0 +1,236 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	// Limits of W3C Baggage.
+	// Reference: https://www.w3.org/TR/baggage/#limits
+	baggageMaxMembers    = 180
+	baggageMaxBytes      = 8192
+	baggageMaxMemberSize = 4096
+)
+
+type (
+	// Baggage is the W3C Baggage, the business context propagated across
+	// services, e.g. tenant, experiment bucket. It is not goroutine-safe
+	// like HTTPContext, callers must protect it by themselves.
+	// Reference: https://www.w3.org/TR/baggage/
+	Baggage struct {
+		members []*baggageMember
+	}
+
+	baggageMember struct {
+		key   string
+		value string
+		// properties are the raw properties after the value,
+		// they are propagated as is.
+		properties string
+	}
+)
+
+// NewBaggage creates an empty baggage.
+func NewBaggage() *Baggage {
+	return &Baggage{}
+}
+
+// ParseBaggage parses the values of the baggage headers, the invalid
+// members and the members exceeding the limits are dropped and reported
+// by the error, the valid ones are always returned.
+func ParseBaggage(values []string) (*Baggage, error) {
+	b := NewBaggage()
+
+	invalid := []string{}
+	for _, value := range values {
+		for _, raw := range strings.Split(value, ",") {
+			raw = strings.TrimSpace(raw)
+			if raw == "" {
+				continue
+			}
+
+			m, err := parseBaggageMember(raw)
+			if err == nil {
+				err = b.add(m)
+			}
+			if err != nil {
+				invalid = append(invalid, err.Error())
+			}
+		}
+	}
+
+	if len(invalid) != 0 {
+		return b, fmt.Errorf("dropped baggage members: %s", strings.Join(invalid, "; "))
+	}
+
+	return b, nil
+}
+
+func parseBaggageMember(raw string) (*baggageMember, error) {
+	properties := ""
+	if i := strings.IndexByte(raw, ';'); i != -1 {
+		raw, properties = raw[:i], strings.TrimSpace(raw[i+1:])
+	}
+
+	i := strings.IndexByte(raw, '=')
+	if i == -1 {
+		return nil, fmt.Errorf("%s: missing =", raw)
+	}
+
+	key := strings.TrimSpace(raw[:i])
+	if !validBaggageKey(key) {
+		return nil, fmt.Errorf("%s: invalid key", raw)
+	}
+
+	value, err := url.PathUnescape(strings.TrimSpace(raw[i+1:]))
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid value: %v", raw, err)
+	}
+
+	return &baggageMember{key: key, value: value, properties: properties}, nil
+}
+
+// validBaggageKey reports whether the key is a token of RFC 7230.
+func validBaggageKey(key string) bool {
+	if key == "" {
+		return false
+	}
+
+	for _, c := range key {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func (m *baggageMember) String() string {
+	s := m.key + "=" + url.PathEscape(m.value)
+	if m.properties != "" {
+		s += ";" + m.properties
+	}
+	return s
+}
+
+// Get returns the value of the key.
+func (b *Baggage) Get(key string) (string, bool) {
+	for _, m := range b.members {
+		if m.key == key {
+			return m.value, true
+		}
+	}
+	return "", false
+}
+
+// Keys returns the keys in order.
+func (b *Baggage) Keys() []string {
+	keys := make([]string, 0, len(b.members))
+	for _, m := range b.members {
+		keys = append(keys, m.key)
+	}
+	return keys
+}
+
+// Set sets the value of the key, the properties of the existed key are
+// dropped. It fails if the key is invalid or the limits are exceeded.
+func (b *Baggage) Set(key, value string) error {
+	if !validBaggageKey(key) {
+		return fmt.Errorf("invalid baggage key: %s", key)
+	}
+
+	m := &baggageMember{key: key, value: value}
+	for i, old := range b.members {
+		if old.key != key {
+			continue
+		}
+
+		b.members[i] = m
+		if err := b.checkLimits(); err != nil {
+			b.members[i] = old
+			return err
+		}
+		return nil
+	}
+
+	return b.add(m)
+}
+
+// Delete deletes the key.
+func (b *Baggage) Delete(key string) {
+	for i, m := range b.members {
+		if m.key == key {
+			b.members = append(b.members[:i], b.members[i+1:]...)
+			return
+		}
+	}
+}
+
+// Len returns the number of members.
+func (b *Baggage) Len() int {
+	return len(b.members)
+}
+
+// String returns the value of the baggage header.
+func (b *Baggage) String() string {
+	members := make([]string, 0, len(b.members))
+	for _, m := range b.members {
+		members = append(members, m.String())
+	}
+	return strings.Join(members, ",")
+}
+
+func (b *Baggage) add(m *baggageMember) error {
+	b.members = append(b.members, m)
+	if err := b.checkLimits(); err != nil {
+		b.members = b.members[:len(b.members)-1]
+		return err
+	}
+	return nil
+}
+
+func (b *Baggage) checkLimits() error {
+	if len(b.members) > baggageMaxMembers {
+		return fmt.Errorf("baggage members exceed %d", baggageMaxMembers)
+	}
+
+	size := 0
+	for i, m := range b.members {
+		memberSize := len(m.String())
+		if memberSize > baggageMaxMemberSize {
+			return fmt.Errorf("baggage member %s exceeds %d bytes", m.key, baggageMaxMemberSize)
+		}
+		if i > 0 {
+			// NOTE: The comma between members.
+			size++
+		}
+		size += memberSize
+	}
+	if size > baggageMaxBytes {
+		return fmt.Errorf("baggage exceeds %d bytes", baggageMaxBytes)
+	}
+
+	return nil
+}
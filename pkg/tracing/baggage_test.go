@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseBaggage(t *testing.T) {
+	b, err := ParseBaggage([]string{
+		"tenant=megaease, bucket = a%20b;ttl=60",
+		"=bad,missing,user=x",
+	})
+	if err == nil {
+		t.Errorf("invalid members should be reported")
+	}
+	if b.Len() != 3 {
+		t.Fatalf("want 3 members, got %d: %s", b.Len(), b)
+	}
+
+	if v, _ := b.Get("bucket"); v != "a b" {
+		t.Errorf("want value 'a b', got %q", v)
+	}
+	if want := "tenant=megaease,bucket=a%20b;ttl=60,user=x"; b.String() != want {
+		t.Errorf("want %s, got %s", want, b)
+	}
+
+	b.Delete("tenant")
+	if err := b.Set("bucket", "c,d"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if want := "bucket=c%2Cd,user=x"; b.String() != want {
+		t.Errorf("want %s, got %s", want, b)
+	}
+}
+
+func TestBaggageLimits(t *testing.T) {
+	b := NewBaggage()
+	if b.Set("a b", "x") == nil {
+		t.Errorf("invalid key should fail")
+	}
+
+	if b.Set("big", strings.Repeat("x", baggageMaxMemberSize)) == nil {
+		t.Errorf("member exceeding the limit should fail")
+	}
+
+	value := strings.Repeat("x", baggageMaxMemberSize/2)
+	for i := 0; i < 3; i++ {
+		if err := b.Set(string(rune('a'+i)), value); err != nil {
+			t.Fatalf("set failed: %v", err)
+		}
+	}
+	if b.Set("d", value) == nil {
+		t.Errorf("baggage exceeding the limit should fail")
+	}
+	if b.Len() != 3 {
+		t.Errorf("failed set should not change the baggage: %d members", b.Len())
+	}
+
+	b = NewBaggage()
+	for i := 0; i < baggageMaxMembers; i++ {
+		if err := b.Set(fmt.Sprintf("k%d", i), ""); err != nil {
+			t.Fatalf("set failed: %v", err)
+		}
+	}
+	if b.Set("z", "") == nil {
+		t.Errorf("members exceeding the limit should fail")
+	}
+}
@@ -24,6 +24,7 @@ import (
 	opentracing "github.com/opentracing/opentracing-go"
 
 	"github.com/megaease/easegress/pkg/tracing/base"
+	"github.com/megaease/easegress/pkg/tracing/zipkin"
 )
 
 type (
@@ -49,6 +50,9 @@ type (
 		// SetName changes the span name.
 		SetName(name string)
 
+		// SetTag sets the tag of the span.
+		SetTag(key string, value interface{})
+
 		// LogKV logs key:value for the span.
 		//
 		// The keys must all be strings. The values may be strings, numeric types,
@@ -71,6 +75,18 @@ type (
 	}
 )
 
+// SpanIDs returns the IDs of the trace and the span in hex, they're empty
+// if the tracing is disabled.
+func SpanIDs(s Span) (traceID, spanID string) {
+	return zipkin.SpanIDs(s.Context())
+}
+
+// TraceParent returns the W3C traceparent header of the span, it's empty
+// if the tracing is disabled.
+func TraceParent(s Span) string {
+	return zipkin.TraceParent(s.Context())
+}
+
 // NewSpan creates a span.
 func NewSpan(tracer *Tracing, name string) Span {
 	return newSpanWithStart(tracer, name, time.Now())
@@ -135,6 +151,10 @@ func (s *span) SetName(name string) {
 	s.span.SetOperationName(name)
 }
 
+func (s *span) SetTag(key string, value interface{}) {
+	s.span.SetTag(key, value)
+}
+
 func (s *span) LogKV(kv ...interface{}) {
 	s.span.LogKV(kv...)
 }
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/tracing/zipkin"
+)
+
+func TestSpanIDs(t *testing.T) {
+	span := NewSpan(NoopTracing, "noop")
+	if traceID, spanID := SpanIDs(span); traceID != "" || spanID != "" {
+		t.Errorf("want empty IDs for noop tracing, got %q, %q", traceID, spanID)
+	}
+	span.Cancel()
+	span.Finish()
+
+	tracer, err := New(&Spec{
+		ServiceName: "test",
+		Zipkin: &zipkin.Spec{
+			ServerURL:  "http://127.0.0.1:9411/api/v2/spans",
+			SampleRate: 1,
+		},
+	})
+	if err != nil {
+		t.Fatalf("create tracing failed: %v", err)
+	}
+	defer tracer.Close()
+
+	span = NewSpan(tracer, "parent")
+	traceID, spanID := SpanIDs(span)
+	if traceID == "" || spanID == "" {
+		t.Fatalf("want non-empty IDs, got %q, %q", traceID, spanID)
+	}
+
+	child := span.NewChild("child")
+	childTraceID, childSpanID := SpanIDs(child)
+	if childTraceID != traceID {
+		t.Errorf("want trace ID %s, got %s", traceID, childTraceID)
+	}
+	if childSpanID == spanID {
+		t.Errorf("child span should have its own ID")
+	}
+
+	child.Cancel()
+	child.Finish()
+	span.Cancel()
+	span.Finish()
+}
+
+func TestTraceParent(t *testing.T) {
+	span := NewSpan(NoopTracing, "noop")
+	if tp := TraceParent(span); tp != "" {
+		t.Errorf("want empty traceparent for noop tracing, got %q", tp)
+	}
+	span.Cancel()
+	span.Finish()
+
+	tracer, err := New(&Spec{
+		ServiceName: "test",
+		Zipkin: &zipkin.Spec{
+			ServerURL:  "http://127.0.0.1:9411/api/v2/spans",
+			SampleRate: 1,
+		},
+	})
+	if err != nil {
+		t.Fatalf("create tracing failed: %v", err)
+	}
+	defer tracer.Close()
+
+	span = NewSpan(tracer, "parent")
+	traceID, spanID := SpanIDs(span)
+	want := "00-" + strings.Repeat("0", 32-len(traceID)) + traceID + "-" + spanID + "-01"
+	if tp := TraceParent(span); tp != want {
+		t.Errorf("want traceparent %s, got %s", want, tp)
+	}
+	span.Cancel()
+	span.Finish()
+}
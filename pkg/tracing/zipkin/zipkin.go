@@ -18,6 +18,7 @@
 package zipkin
 
 import (
+	"fmt"
 	"io"
 	"time"
 
@@ -95,3 +96,30 @@ func New(serviceName string, spec *Spec) (opentracing.Tracer, io.Closer, error)
 
 	return zipkinot.Wrap(nativeTracer), reporter, nil
 }
+
+// SpanIDs returns the IDs of the trace and the span in hex, they're empty
+// if the span context is not of Zipkin.
+func SpanIDs(ctx opentracing.SpanContext) (traceID, spanID string) {
+	sc, ok := ctx.(zipkinot.SpanContext)
+	if !ok {
+		return "", ""
+	}
+	return sc.TraceID.String(), sc.ID.String()
+}
+
+// TraceParent returns the W3C traceparent header of the span context, the
+// 64-bit trace ID is padded with zeros. It's empty if the span context is
+// not of Zipkin.
+// Reference: https://www.w3.org/TR/trace-context/#traceparent-header
+func TraceParent(ctx opentracing.SpanContext) string {
+	sc, ok := ctx.(zipkinot.SpanContext)
+	if !ok {
+		return ""
+	}
+
+	flags := "00"
+	if sc.Debug || (sc.Sampled != nil && *sc.Sampled) {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%016x%016x-%s-%s", sc.TraceID.High, sc.TraceID.Low, sc.ID.String(), flags)
+}
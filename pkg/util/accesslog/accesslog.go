@@ -0,0 +1,246 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package accesslog writes the access logs of the requests in the format
+// of templates or in JSON to the files, asynchronously and rotated by size.
+package accesslog
+
+import (
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// EncoderText encodes the lines in the format of the tags.
+	EncoderText = "text"
+	// EncoderJSON encodes the lines in JSON objects of the fields.
+	EncoderJSON = "json"
+
+	// DefaultFormat is the default format of the lines.
+	DefaultFormat = `[[time]] [[realIP]] "[[method]] [[uri]] [[proto]]" [[status]] [[duration]] ` +
+		`[[reqSize]] [[respSize]] [[pipeline]] [[backend]] [[backendDuration]]`
+	// DefaultBufferSize is the default number of the lines buffered.
+	DefaultBufferSize = 1024
+
+	// headerTagPrefix is the prefix of the tags of the request headers,
+	// e.g. [[header.User-Agent]].
+	headerTagPrefix = "header."
+	// emptyValue is written for the empty values of the text lines.
+	emptyValue = "-"
+)
+
+// DefaultFields are the default fields of the JSON lines.
+var DefaultFields = []string{
+	"time", "realIP", "method", "host", "uri", "proto", "status", "duration",
+	"reqSize", "respSize", "pipeline", "backend", "backendDuration", "kvs",
+}
+
+type (
+	// Spec describes the access log.
+	Spec struct {
+		// Filename is the file of the access log, it's relative to the
+		// log directory if it isn't absolute.
+		Filename string `yaml:"filename" jsonschema:"required"`
+		// Encoder is the encoder of the lines, text or json.
+		Encoder string `yaml:"encoder,omitempty" jsonschema:"omitempty,enum=,enum=text,enum=json"`
+		// Format is the format of the text lines, e.g. [[method]] [[uri]] [[status]].
+		Format string `yaml:"format,omitempty" jsonschema:"omitempty"`
+		// Fields are the tags written as the fields of the JSON lines.
+		Fields []string `yaml:"fields,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+		// Sampling samples the entries, all are logged if it's nil.
+		Sampling *SamplingSpec `yaml:"sampling,omitempty" jsonschema:"omitempty"`
+		// BufferSize is the number of the lines buffered, the lines are
+		// dropped if the buffer is full.
+		BufferSize uint32 `yaml:"bufferSize,omitempty" jsonschema:"omitempty,minimum=1"`
+		// MaxSize is the max size of the file in MB before it's rotated,
+		// it's never rotated if it's zero.
+		MaxSize uint32 `yaml:"maxSize,omitempty" jsonschema:"omitempty"`
+		// MaxBackups is the max number of the rotated files kept.
+		MaxBackups uint32 `yaml:"maxBackups,omitempty" jsonschema:"omitempty"`
+	}
+
+	// SamplingSpec describes the sampling of the entries.
+	SamplingSpec struct {
+		// Rate is the ratio of the entries logged.
+		Rate float64 `yaml:"rate" jsonschema:"required,minimum=0,maximum=1"`
+		// AlwaysLogErrors logs all entries whose status codes are not
+		// 2xx regardless of the rate.
+		AlwaysLogErrors bool `yaml:"alwaysLogErrors,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Entry is the information of a request to log.
+	Entry struct {
+		StartTime       time.Time
+		RemoteAddr      string
+		RealIP          string
+		Method          string
+		Host            string
+		URI             string
+		Proto           string
+		StatusCode      int
+		Duration        time.Duration
+		ReqSize         uint64
+		RespSize        uint64
+		Header          http.Header
+		Pipeline        string
+		Backend         string
+		BackendDuration time.Duration
+		Tags            []string
+		KVs             map[string]interface{}
+	}
+
+	// AccessLog writes the entries to the file asynchronously.
+	AccessLog struct {
+		encoder  encoder
+		sampling *SamplingSpec
+
+		mutex   sync.RWMutex
+		closed  bool
+		lines   chan []byte
+		done    chan struct{}
+		dropped uint64
+
+		file *rotatingFile
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	_, err := newEncoder(&spec)
+	return err
+}
+
+func (spec *Spec) format() string {
+	if spec.Format == "" {
+		return DefaultFormat
+	}
+	return spec.Format
+}
+
+func (spec *Spec) fields() []string {
+	if len(spec.Fields) == 0 {
+		return DefaultFields
+	}
+	return spec.Fields
+}
+
+// sampled reports whether the entry is logged, the errors are always
+// logged if alwaysLogErrors is set.
+func (spec *SamplingSpec) sampled(e *Entry) bool {
+	if spec.AlwaysLogErrors && (e.StatusCode < 200 || e.StatusCode >= 300) {
+		return true
+	}
+	return rand.Float64() < spec.Rate
+}
+
+// New creates an AccessLog writing to the file of spec, the relative
+// filename is joined to dir.
+func New(spec *Spec, dir string) (*AccessLog, error) {
+	encoder, err := newEncoder(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := openRotatingFile(spec, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	bufferSize := spec.BufferSize
+	if bufferSize == 0 {
+		bufferSize = DefaultBufferSize
+	}
+
+	al := &AccessLog{
+		encoder:  encoder,
+		sampling: spec.Sampling,
+		lines:    make(chan []byte, bufferSize),
+		done:     make(chan struct{}),
+		file:     file,
+	}
+	go al.run()
+
+	return al, nil
+}
+
+// Format formats the entry into a line without the line ending.
+func (al *AccessLog) Format(e *Entry) string {
+	return string(al.encoder.encode(e))
+}
+
+// Log logs the entry asynchronously if it's sampled, it's dropped if the
+// buffer is full or the access log is closed.
+func (al *AccessLog) Log(e *Entry) {
+	if al.sampling != nil && !al.sampling.sampled(e) {
+		return
+	}
+	line := append(al.encoder.encode(e), '\n')
+
+	al.mutex.RLock()
+	defer al.mutex.RUnlock()
+
+	if al.closed {
+		return
+	}
+	select {
+	case al.lines <- line:
+	default:
+		atomic.AddUint64(&al.dropped, 1)
+	}
+}
+
+// Dropped returns the number of the lines dropped for the full buffer.
+func (al *AccessLog) Dropped() uint64 {
+	return atomic.LoadUint64(&al.dropped)
+}
+
+func (al *AccessLog) run() {
+	defer close(al.done)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case line, ok := <-al.lines:
+			if !ok {
+				al.file.close()
+				return
+			}
+			al.file.write(line)
+		case <-ticker.C:
+			al.file.flush()
+		}
+	}
+}
+
+// Close closes the access log after the buffered lines are written.
+func (al *AccessLog) Close() {
+	al.mutex.Lock()
+	if al.closed {
+		al.mutex.Unlock()
+		return
+	}
+	al.closed = true
+	close(al.lines)
+	al.mutex.Unlock()
+
+	<-al.done
+}
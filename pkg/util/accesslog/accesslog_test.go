@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	for _, format := range []string{"[[status", "[[unknown]]", "[[header.]]"} {
+		if (Spec{Filename: "access.log", Format: format}).Validate() == nil {
+			t.Errorf("format %q should be invalid", format)
+		}
+	}
+
+	dir := t.TempDir()
+	al, err := New(&Spec{
+		Filename: "access.log",
+		Format:   `[[method]] [[uri]] [[status]] [[duration]]ms [[header.user-agent]] [[backend]] {[[tags]]} {[[kvs]]}`,
+	}, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer al.Close()
+
+	got := al.Format(&Entry{
+		Method:     http.MethodGet,
+		URI:        "/api?a=1",
+		StatusCode: http.StatusOK,
+		Duration:   1500 * time.Microsecond,
+		Header:     http.Header{"User-Agent": {"curl"}},
+		Tags:       []string{"a", "b"},
+		KVs:        map[string]interface{}{"retry": 2, "code": 502},
+	})
+	want := "GET /api?a=1 200 1.500ms curl - {a | b} {code: 502 | retry: 2}"
+	if got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestJSONEncoder(t *testing.T) {
+	for _, spec := range []Spec{
+		{Filename: "access.log", Encoder: "xml"},
+		{Filename: "access.log", Encoder: EncoderJSON, Format: "[[status]]"},
+		{Filename: "access.log", Fields: []string{"status"}},
+		{Filename: "access.log", Encoder: EncoderJSON, Fields: []string{"unknown"}},
+	} {
+		if spec.Validate() == nil {
+			t.Errorf("spec %+v should be invalid", spec)
+		}
+	}
+
+	dir := t.TempDir()
+	al, err := New(&Spec{
+		Filename: "access.log",
+		Encoder:  EncoderJSON,
+		Fields:   []string{"method", "uri", "status", "duration", "backend", "header.User-Agent", "backendDuration", "kvs"},
+	}, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer al.Close()
+
+	got := al.Format(&Entry{
+		Method:     http.MethodGet,
+		URI:        `/api?a="1"`,
+		StatusCode: http.StatusOK,
+		Duration:   1500 * time.Microsecond,
+		Header:     http.Header{"User-Agent": {"curl"}},
+		KVs:        map[string]interface{}{"retry": 2, "err": fmt.Errorf("timeout"), "duration": time.Millisecond},
+	})
+	want := `{"method":"GET","uri":"/api?a=\"1\"","status":200,"duration":1.500,"header.User-Agent":"curl",` +
+		`"kvs":{"duration":"1ms","err":"timeout","retry":2}}`
+	if got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	dir := t.TempDir()
+	al, err := New(&Spec{
+		Filename: "access.log",
+		Format:   "[[status]]",
+		Sampling: &SamplingSpec{Rate: 0, AlwaysLogErrors: true},
+	}, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, code := range []int{http.StatusOK, http.StatusNotFound, http.StatusNoContent, http.StatusBadGateway} {
+		al.Log(&Entry{StatusCode: code})
+	}
+	al.Close()
+
+	data, err := os.ReadFile(filepath.Join(dir, "access.log"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := string(data), "404\n502\n"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	spec := &SamplingSpec{Rate: 1}
+	if !spec.sampled(&Entry{StatusCode: http.StatusOK}) {
+		t.Errorf("entry should be sampled with rate 1")
+	}
+}
+
+func TestLog(t *testing.T) {
+	dir := t.TempDir()
+	al, err := New(&Spec{Filename: "logs/access.log", Format: "[[method]] [[status]]"}, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	al.Log(&Entry{Method: http.MethodGet, StatusCode: http.StatusOK})
+	al.Log(&Entry{Method: http.MethodPost, StatusCode: http.StatusCreated})
+	al.Close()
+	al.Close()
+	// NOTE: The entries after closing are dropped silently.
+	al.Log(&Entry{Method: http.MethodPut, StatusCode: http.StatusOK})
+
+	data, err := os.ReadFile(filepath.Join(dir, "logs/access.log"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := string(data), "GET 200\nPOST 201\n"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	rf, err := openRotatingFile(&Spec{Filename: "access.log", MaxBackups: 2}, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rf.maxSize = 10
+
+	for _, line := range []string{"line-1\n", "line-2\n", "line-3\n", "line-4\n"} {
+		rf.write([]byte(line))
+	}
+	rf.close()
+
+	filename := filepath.Join(dir, "access.log")
+	for name, want := range map[string]string{
+		filename:        "line-4\n",
+		filename + ".1": "line-3\n",
+		filename + ".2": "line-2\n",
+	} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(data) != want {
+			t.Errorf("want %q in %s, got %q", want, name, data)
+		}
+	}
+	if _, err := os.Stat(filename + ".3"); !os.IsNotExist(err) {
+		t.Errorf("want the oldest backup removed")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 3 || !strings.HasPrefix(entries[0].Name(), "access.log") {
+		t.Errorf("want 3 files, got %v", entries)
+	}
+}
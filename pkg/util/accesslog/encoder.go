@@ -0,0 +1,257 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/texttemplate"
+	"github.com/megaease/easegress/pkg/util/timetool"
+)
+
+type (
+	encoder interface {
+		// encode encodes the entry into a line without the line ending.
+		encode(e *Entry) []byte
+	}
+
+	// field is the value of a tag, number is true if it's written as a
+	// number in JSON, json is set if it's written as other JSON values.
+	field struct {
+		value  func(e *Entry) string
+		number bool
+		json   func(e *Entry) []byte
+	}
+
+	textEncoder struct {
+		segments []segment
+	}
+
+	// segment is a literal of the format, or a tag if value is set.
+	segment struct {
+		literal string
+		value   func(e *Entry) string
+	}
+
+	jsonEncoder struct {
+		names  []string
+		fields []field
+	}
+)
+
+var fields = map[string]field{
+	"time":       {value: func(e *Entry) string { return e.StartTime.Format(timetool.RFC3339Milli) }},
+	"remoteAddr": {value: func(e *Entry) string { return e.RemoteAddr }},
+	"realIP":     {value: func(e *Entry) string { return e.RealIP }},
+	"method":     {value: func(e *Entry) string { return e.Method }},
+	"host":       {value: func(e *Entry) string { return e.Host }},
+	"uri":        {value: func(e *Entry) string { return e.URI }},
+	"proto":      {value: func(e *Entry) string { return e.Proto }},
+	"status":     {value: func(e *Entry) string { return strconv.Itoa(e.StatusCode) }, number: true},
+	"duration":   {value: func(e *Entry) string { return formatMilliseconds(e.Duration) }, number: true},
+	"reqSize":    {value: func(e *Entry) string { return strconv.FormatUint(e.ReqSize, 10) }, number: true},
+	"respSize":   {value: func(e *Entry) string { return strconv.FormatUint(e.RespSize, 10) }, number: true},
+	"pipeline":   {value: func(e *Entry) string { return e.Pipeline }},
+	"backend":    {value: func(e *Entry) string { return e.Backend }},
+	"backendDuration": {value: func(e *Entry) string {
+		if e.BackendDuration == 0 {
+			return ""
+		}
+		return formatMilliseconds(e.BackendDuration)
+	}, number: true},
+	"tags": {value: func(e *Entry) string { return strings.Join(e.Tags, " | ") }},
+	"kvs":  {value: formatKVs, json: marshalKVs},
+}
+
+func formatMilliseconds(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/1e6, 'f', 3, 64)
+}
+
+// formatKVs formats the structured tags in the order of the keys, e.g.
+// a: 1 | b: 2.
+func formatKVs(e *Entry) string {
+	keys := make([]string, 0, len(e.KVs))
+	for k := range e.KVs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteString(" | ")
+		}
+		fmt.Fprintf(&b, "%s: %v", k, e.KVs[k])
+	}
+	return b.String()
+}
+
+// marshalKVs marshals the structured tags into a JSON object, the values
+// not marshaled into JSON are written as strings.
+func marshalKVs(e *Entry) []byte {
+	if len(e.KVs) == 0 {
+		return nil
+	}
+
+	kvs := make(map[string]interface{}, len(e.KVs))
+	for k, v := range e.KVs {
+		switch v := v.(type) {
+		case error:
+			kvs[k] = v.Error()
+		case fmt.Stringer:
+			kvs[k] = v.String()
+		default:
+			if _, err := json.Marshal(v); err != nil {
+				kvs[k] = fmt.Sprint(v)
+			} else {
+				kvs[k] = v
+			}
+		}
+	}
+	data, _ := json.Marshal(kvs)
+	return data
+}
+
+func newEncoder(spec *Spec) (encoder, error) {
+	switch spec.Encoder {
+	case "", EncoderText:
+		if len(spec.Fields) != 0 {
+			return nil, fmt.Errorf("fields are only for the json encoder")
+		}
+		segments, err := compile(spec.format())
+		if err != nil {
+			return nil, err
+		}
+		return &textEncoder{segments: segments}, nil
+	case EncoderJSON:
+		if spec.Format != "" {
+			return nil, fmt.Errorf("format is only for the text encoder")
+		}
+		je := &jsonEncoder{}
+		for _, name := range spec.fields() {
+			f, err := tagField(name)
+			if err != nil {
+				return nil, err
+			}
+			je.names = append(je.names, name)
+			je.fields = append(je.fields, f)
+		}
+		return je, nil
+	default:
+		return nil, fmt.Errorf("unknown encoder %s", spec.Encoder)
+	}
+}
+
+// compile splits the format into the literals and the tags, the tags are
+// in the default tokens of texttemplate, e.g. [[status]].
+func compile(format string) ([]segment, error) {
+	var segments []segment
+	begin, end := texttemplate.DefaultBeginToken, texttemplate.DefaultEndToken
+	for format != "" {
+		i := strings.Index(format, begin)
+		if i < 0 {
+			segments = append(segments, segment{literal: format})
+			break
+		}
+		if i > 0 {
+			segments = append(segments, segment{literal: format[:i]})
+		}
+		format = format[i+len(begin):]
+
+		j := strings.Index(format, end)
+		if j < 0 {
+			return nil, fmt.Errorf("unterminated tag in format")
+		}
+		tag := format[:j]
+		format = format[j+len(end):]
+
+		f, err := tagField(tag)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, segment{value: f.value})
+	}
+	return segments, nil
+}
+
+func tagField(tag string) (field, error) {
+	if f, exists := fields[tag]; exists {
+		return f, nil
+	}
+	if strings.HasPrefix(tag, headerTagPrefix) && len(tag) > len(headerTagPrefix) {
+		key := http.CanonicalHeaderKey(tag[len(headerTagPrefix):])
+		return field{value: func(e *Entry) string { return e.Header.Get(key) }}, nil
+	}
+	return field{}, fmt.Errorf("unknown tag %s", tag)
+}
+
+func (te *textEncoder) encode(e *Entry) []byte {
+	var b []byte
+	for _, s := range te.segments {
+		if s.value == nil {
+			b = append(b, s.literal...)
+			continue
+		}
+		v := s.value(e)
+		if v == "" {
+			v = emptyValue
+		}
+		b = append(b, v...)
+	}
+	return b
+}
+
+// encode writes the fields in the order of the spec, the empty fields are
+// omitted.
+func (je *jsonEncoder) encode(e *Entry) []byte {
+	b := []byte{'{'}
+	for i, f := range je.fields {
+		var v string
+		if f.json != nil {
+			v = string(f.json(e))
+		} else {
+			v = f.value(e)
+		}
+		if v == "" {
+			continue
+		}
+		if len(b) > 1 {
+			b = append(b, ',')
+		}
+		b = appendJSONString(b, je.names[i])
+		b = append(b, ':')
+		if f.number || f.json != nil {
+			b = append(b, v...)
+		} else {
+			b = appendJSONString(b, v)
+		}
+	}
+	return append(b, '}')
+}
+
+func appendJSONString(b []byte, s string) []byte {
+	// NOTE: Marshaling a string never fails.
+	data, _ := json.Marshal(s)
+	return append(b, data...)
+}
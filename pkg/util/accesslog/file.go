@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+// rotatingFile is the buffered file rotated by size, the rotated files
+// are renamed with the suffixes .1, .2 and so on, .1 is the latest one.
+// It's only accessed by the goroutine of AccessLog.
+type rotatingFile struct {
+	filename   string
+	maxSize    int64
+	maxBackups int
+
+	file   *os.File
+	writer *bufio.Writer
+	size   int64
+}
+
+func openRotatingFile(spec *Spec, dir string) (*rotatingFile, error) {
+	filename := spec.Filename
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(dir, filename)
+	}
+
+	rf := &rotatingFile{
+		filename:   filename,
+		maxSize:    int64(spec.MaxSize) * 1024 * 1024,
+		maxBackups: int(spec.MaxBackups),
+	}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(rf.filename), 0o750); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(rf.filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	rf.file, rf.size = file, info.Size()
+	rf.writer = bufio.NewWriter(file)
+	return nil
+}
+
+func (rf *rotatingFile) write(line []byte) {
+	if rf.file == nil {
+		return
+	}
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(line)) > rf.maxSize {
+		rf.rotate()
+		if rf.file == nil {
+			return
+		}
+	}
+
+	n, err := rf.writer.Write(line)
+	rf.size += int64(n)
+	if err != nil {
+		logger.Errorf("write access log %s failed: %v", rf.filename, err)
+	}
+}
+
+func (rf *rotatingFile) flush() {
+	if rf.file == nil {
+		return
+	}
+	if err := rf.writer.Flush(); err != nil {
+		logger.Errorf("flush access log %s failed: %v", rf.filename, err)
+	}
+}
+
+// rotate renames the current file to .1 after shifting the backups, the
+// oldest one is removed.
+func (rf *rotatingFile) rotate() {
+	rf.close()
+
+	if rf.maxBackups == 0 {
+		os.Remove(rf.filename)
+	} else {
+		os.Remove(backupName(rf.filename, rf.maxBackups))
+		for i := rf.maxBackups - 1; i >= 1; i-- {
+			os.Rename(backupName(rf.filename, i), backupName(rf.filename, i+1))
+		}
+		if err := os.Rename(rf.filename, backupName(rf.filename, 1)); err != nil {
+			logger.Errorf("rotate access log %s failed: %v", rf.filename, err)
+		}
+	}
+
+	if err := rf.open(); err != nil {
+		logger.Errorf("open access log %s failed: %v", rf.filename, err)
+	}
+}
+
+func (rf *rotatingFile) close() {
+	if rf.file == nil {
+		return
+	}
+	rf.flush()
+	if err := rf.file.Close(); err != nil {
+		logger.Errorf("close access log %s failed: %v", rf.filename, err)
+	}
+	rf.file, rf.writer = nil, nil
+}
+
+func backupName(filename string, i int) string {
+	return fmt.Sprintf("%s.%d", filename, i)
+}
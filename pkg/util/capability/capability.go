@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package capability holds the capabilities of this binary, i.e. the
+// object kinds, filters, load balance policies and spec formats, so the
+// tooling could discover them and the specs could require them.
+package capability
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// Kind is the category of object kinds.
+	Kind = "kind"
+	// Filter is the category of filter kinds of HTTPPipeline.
+	Filter = "filter"
+	// LoadBalance is the category of load balance policies of Proxy.
+	LoadBalance = "loadBalance"
+	// Format is the category of formats of spec fields.
+	Format = "format"
+)
+
+var (
+	mutex        sync.Mutex
+	capabilities = map[string]map[string]struct{}{}
+)
+
+// Register registers the capability of the category.
+func Register(category, name string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if capabilities[category] == nil {
+		capabilities[category] = map[string]struct{}{}
+	}
+	capabilities[category][name] = struct{}{}
+}
+
+// List returns the sorted names of the capabilities by categories.
+func List() map[string][]string {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	result := make(map[string][]string, len(capabilities))
+	for category, names := range capabilities {
+		list := make([]string, 0, len(names))
+		for name := range names {
+			list = append(list, name)
+		}
+		sort.Strings(list)
+		result[category] = list
+	}
+
+	return result
+}
+
+// Check checks whether the capability in the form of category/name,
+// e.g. filter/Proxy, is supported.
+func Check(capability string) error {
+	i := strings.IndexByte(capability, '/')
+	if i <= 0 || i == len(capability)-1 {
+		return fmt.Errorf("invalid capability %s, want category/name", capability)
+	}
+	category, name := capability[:i], capability[i+1:]
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	names, exists := capabilities[category]
+	if !exists {
+		return fmt.Errorf("unknown capability category %s", category)
+	}
+	if _, exists := names[name]; !exists {
+		return fmt.Errorf("capability %s is not supported by this binary", capability)
+	}
+	return nil
+}
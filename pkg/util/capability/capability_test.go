@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package capability
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCapability(t *testing.T) {
+	Register(Filter, "Proxy")
+	Register(Filter, "Mock")
+	Register(Filter, "Proxy")
+	Register(LoadBalance, "roundRobin")
+
+	list := List()
+	if !reflect.DeepEqual(list[Filter], []string{"Mock", "Proxy"}) {
+		t.Errorf("unexpected filters %v", list[Filter])
+	}
+
+	if err := Check("filter/Proxy"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := Check("loadBalance/roundRobin"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for _, c := range []string{"filter/WAF", "unknown/Proxy", "Proxy", "filter/", "/Proxy"} {
+		if err := Check(c); err == nil {
+			t.Errorf("expect error of %s", c)
+		}
+	}
+}
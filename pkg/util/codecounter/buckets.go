@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package codecounter
+
+import (
+	"time"
+)
+
+const (
+	// DefaultBucketWidth is the default time span of a bucket.
+	DefaultBucketWidth = time.Second
+	// DefaultBucketCount is the default number of buckets, which keeps
+	// the codes of the last 5 minutes with DefaultBucketWidth.
+	DefaultBucketCount = 300
+)
+
+var nowFunc = time.Now
+
+type (
+	// BucketCounter is the goroutine unsafe code counter with a ring
+	// buffer of time buckets, the buckets out of the span are rolled
+	// over, so it answers the queries of the recent codes, e.g. the
+	// current rate of 5xx.
+	BucketCounter struct {
+		width   time.Duration
+		buckets []bucket
+	}
+
+	bucket struct {
+		// index is the index of the time span of the bucket since
+		// the epoch, it's stale if it doesn't match the time.
+		index   int64
+		counter map[int]uint64
+	}
+)
+
+// NewBuckets creates a BucketCounter with count buckets of the width.
+func NewBuckets(width time.Duration, count int) *BucketCounter {
+	if width <= 0 {
+		width = DefaultBucketWidth
+	}
+	if count <= 0 {
+		count = DefaultBucketCount
+	}
+
+	return &BucketCounter{
+		width:   width,
+		buckets: make([]bucket, count),
+	}
+}
+
+// Span returns the time span covered by all buckets.
+func (bc *BucketCounter) Span() time.Duration {
+	return bc.width * time.Duration(len(bc.buckets))
+}
+
+// Count counts a new code in the current bucket.
+func (bc *BucketCounter) Count(code int) {
+	index := nowFunc().UnixNano() / int64(bc.width)
+	b := &bc.buckets[index%int64(len(bc.buckets))]
+	if b.index != index || b.counter == nil {
+		b.index, b.counter = index, make(map[int]uint64)
+	}
+	b.counter[code]++
+}
+
+// Codes returns the codes in the last window including the current
+// bucket, the window is rounded up to buckets and capped by the span.
+func (bc *BucketCounter) Codes(window time.Duration) map[int]uint64 {
+	n := int64((window + bc.width - 1) / bc.width)
+	if n > int64(len(bc.buckets)) {
+		n = int64(len(bc.buckets))
+	}
+
+	current := nowFunc().UnixNano() / int64(bc.width)
+	codes := make(map[int]uint64)
+	for i := range bc.buckets {
+		b := &bc.buckets[i]
+		if b.counter == nil || b.index > current || b.index <= current-n {
+			continue
+		}
+		for code, count := range b.counter {
+			codes[code] += count
+		}
+	}
+
+	return codes
+}
+
+// Rate returns the per second rate of the codes in [min, max] in the
+// last window.
+func (bc *BucketCounter) Rate(window time.Duration, min, max int) float64 {
+	if window <= 0 {
+		return 0
+	}
+	if span := bc.Span(); window > span {
+		window = span
+	}
+
+	var total uint64
+	for code, count := range bc.Codes(window) {
+		if code >= min && code <= max {
+			total += count
+		}
+	}
+
+	return float64(total) / window.Seconds()
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package codecounter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketCounter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	bc := NewBuckets(time.Second, 10)
+	if bc.Span() != 10*time.Second {
+		t.Fatalf("want span 10s, got %s", bc.Span())
+	}
+
+	for i := 0; i < 10; i++ {
+		bc.Count(200)
+		if i%2 == 0 {
+			bc.Count(503)
+		}
+		now = now.Add(time.Second)
+	}
+	now = now.Add(-time.Second)
+
+	codes := bc.Codes(10 * time.Second)
+	if codes[200] != 10 || codes[503] != 5 {
+		t.Errorf("unexpected codes: %v", codes)
+	}
+	codes = bc.Codes(2 * time.Second)
+	if codes[200] != 2 || codes[503] != 1 {
+		t.Errorf("unexpected codes: %v", codes)
+	}
+	if r := bc.Rate(10*time.Second, 500, 599); r != 0.5 {
+		t.Errorf("want rate 0.5, got %v", r)
+	}
+	if r := bc.Rate(time.Minute, 200, 299); r != 1 {
+		t.Errorf("the window should be capped by the span, got rate %v", r)
+	}
+
+	// the stale buckets are rolled over
+	now = now.Add(5 * time.Second)
+	bc.Count(404)
+	codes = bc.Codes(10 * time.Second)
+	if codes[200] != 5 || codes[503] != 2 || codes[404] != 1 {
+		t.Errorf("unexpected codes: %v", codes)
+	}
+
+	now = now.Add(time.Hour)
+	if codes = bc.Codes(10 * time.Second); len(codes) != 0 {
+		t.Errorf("want no codes, got %v", codes)
+	}
+}
@@ -17,11 +17,62 @@
 
 package codecounter
 
-// CodeCounter is the goroutine unsafe code counter.
-type CodeCounter struct {
-	//      code:count
-	counter map[int]uint64
-}
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// ErrorDial is the class of the errors failing to connect.
+	ErrorDial = "dial"
+	// ErrorTimeout is the class of the errors timing out.
+	ErrorTimeout = "timeout"
+	// ErrorReset is the class of the errors of the connections reset or
+	// closed unexpectedly by the peer.
+	ErrorReset = "reset"
+	// ErrorOther is the class of the other errors.
+	ErrorOther = "other"
+)
+
+type (
+	// CodeCounter is the goroutine unsafe code counter, it also counts
+	// the durations in the histogram and the classes of errors.
+	CodeCounter struct {
+		//      code:count
+		counter map[int]uint64
+
+		// bounds are the upper bounds of the buckets of the duration
+		// histogram, durations has one more bucket for the rest.
+		bounds    []time.Duration
+		durations []uint64
+		// phases are the duration histograms of the phases of the
+		// requests, e.g. dns and connect.
+		phases map[string][]uint64
+		errors map[string]uint64
+	}
+
+	// Stats is the statistics of CodeCounter.
+	Stats struct {
+		Codes     map[int]uint64    `yaml:"codes"`
+		Durations []*DurationBucket `yaml:"durations,omitempty"`
+		// Phases are the duration histograms by the phases.
+		Phases map[string][]*DurationBucket `yaml:"phases,omitempty"`
+		Errors map[string]uint64            `yaml:"errors,omitempty"`
+	}
+
+	// DurationBucket is a bucket of the duration histogram, Count is the
+	// number of the durations less than or equal to LE, but greater than
+	// the LE of the previous bucket. LE of the last bucket is +Inf.
+	DurationBucket struct {
+		LE    string `yaml:"le"`
+		Count uint64 `yaml:"count"`
+	}
+)
 
 // New creates a CodeCounter.
 func New() *CodeCounter {
@@ -30,11 +81,64 @@ func New() *CodeCounter {
 	}
 }
 
+// NewWithBuckets creates a CodeCounter counting the durations in the
+// buckets of the ascending upper bounds.
+func NewWithBuckets(bounds []time.Duration) *CodeCounter {
+	cc := New()
+	cc.bounds = bounds
+	cc.durations = make([]uint64, len(bounds)+1)
+	return cc
+}
+
 // Count counts a new code.
 func (cc *CodeCounter) Count(code int) {
 	cc.counter[code]++
 }
 
+// CountDuration counts a new duration in the histogram, it does nothing
+// if the CodeCounter is created without buckets.
+func (cc *CodeCounter) CountDuration(d time.Duration) {
+	if cc.durations == nil {
+		return
+	}
+
+	cc.durations[cc.bucket(d)]++
+}
+
+// CountPhase counts a new duration of the phase in its histogram, it does
+// nothing if the CodeCounter is created without buckets.
+func (cc *CodeCounter) CountPhase(phase string, d time.Duration) {
+	if cc.durations == nil {
+		return
+	}
+
+	if cc.phases == nil {
+		cc.phases = make(map[string][]uint64)
+	}
+	durations := cc.phases[phase]
+	if durations == nil {
+		durations = make([]uint64, len(cc.bounds)+1)
+		cc.phases[phase] = durations
+	}
+	durations[cc.bucket(d)]++
+}
+
+func (cc *CodeCounter) bucket(d time.Duration) int {
+	i := 0
+	for i < len(cc.bounds) && d > cc.bounds[i] {
+		i++
+	}
+	return i
+}
+
+// CountError counts a new error of the class.
+func (cc *CodeCounter) CountError(class string) {
+	if cc.errors == nil {
+		cc.errors = make(map[string]uint64)
+	}
+	cc.errors[class]++
+}
+
 // Codes returns the codes.
 func (cc *CodeCounter) Codes() map[int]uint64 {
 	codes := make(map[int]uint64)
@@ -44,3 +148,60 @@ func (cc *CodeCounter) Codes() map[int]uint64 {
 
 	return codes
 }
+
+// Stats returns the codes, the duration histogram and the errors.
+func (cc *CodeCounter) Stats() *Stats {
+	stats := &Stats{
+		Codes:     cc.Codes(),
+		Durations: cc.histogram(cc.durations),
+	}
+
+	if len(cc.phases) > 0 {
+		stats.Phases = make(map[string][]*DurationBucket, len(cc.phases))
+		for phase, durations := range cc.phases {
+			stats.Phases[phase] = cc.histogram(durations)
+		}
+	}
+
+	if len(cc.errors) > 0 {
+		stats.Errors = make(map[string]uint64, len(cc.errors))
+		for class, count := range cc.errors {
+			stats.Errors[class] = count
+		}
+	}
+
+	return stats
+}
+
+func (cc *CodeCounter) histogram(durations []uint64) []*DurationBucket {
+	var buckets []*DurationBucket
+	for i, count := range durations {
+		le := "+Inf"
+		if i < len(cc.bounds) {
+			le = cc.bounds[i].String()
+		}
+		buckets = append(buckets, &DurationBucket{LE: le, Count: count})
+	}
+	return buckets
+}
+
+// ErrorClass returns the class of the error of sending a request.
+func ErrorClass(err error) string {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return ErrorDial
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorTimeout
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		strings.Contains(err.Error(), "connection reset") {
+		return ErrorReset
+	}
+
+	return ErrorOther
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package codecounter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCodeCounterStats(t *testing.T) {
+	cc := NewWithBuckets([]time.Duration{10 * time.Millisecond, 100 * time.Millisecond})
+	cc.Count(200)
+	cc.Count(200)
+	cc.Count(503)
+	cc.CountDuration(time.Millisecond)
+	cc.CountDuration(10 * time.Millisecond)
+	cc.CountDuration(50 * time.Millisecond)
+	cc.CountDuration(time.Second)
+	cc.CountError(ErrorTimeout)
+	cc.CountPhase("dns", time.Millisecond)
+	cc.CountPhase("dns", time.Second)
+
+	want := &Stats{
+		Codes: map[int]uint64{200: 2, 503: 1},
+		Durations: []*DurationBucket{
+			{LE: "10ms", Count: 2},
+			{LE: "100ms", Count: 1},
+			{LE: "+Inf", Count: 1},
+		},
+		Phases: map[string][]*DurationBucket{
+			"dns": {
+				{LE: "10ms", Count: 1},
+				{LE: "100ms", Count: 0},
+				{LE: "+Inf", Count: 1},
+			},
+		},
+		Errors: map[string]uint64{ErrorTimeout: 1},
+	}
+	if got := cc.Stats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+
+	cc = New()
+	cc.Count(200)
+	cc.CountDuration(time.Second)
+	cc.CountPhase("dns", time.Second)
+	want = &Stats{Codes: map[int]uint64{200: 1}}
+	if got := cc.Stats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, ErrorDial},
+		{fmt.Errorf("send: %w", context.DeadlineExceeded), ErrorTimeout},
+		{&net.OpError{Op: "read", Err: syscall.ECONNRESET}, ErrorReset},
+		{fmt.Errorf("read: %w", errors.New("connection reset by peer")), ErrorReset},
+		{errors.New("something wrong"), ErrorOther},
+	}
+
+	for _, c := range cases {
+		if got := ErrorClass(c.err); got != c.want {
+			t.Errorf("%v: want %s, got %s", c.err, c.want, got)
+		}
+	}
+}
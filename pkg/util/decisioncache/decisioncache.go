@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package decisioncache caches the decisions of the access control relying
+// on the external services, e.g. the token introspection, so the slow
+// services don't slow down every request.
+package decisioncache
+
+import (
+	"sync/atomic"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const defaultMaxEntries = 10000
+
+type (
+	// DecisionCache is the cache of the decisions. The allowances and the
+	// denials are cached with their own TTLs, the errors of deciding, e.g.
+	// the external service is unavailable, are never cached. The decisions
+	// of the same key are made only once at the same time, the other
+	// callers wait for and share the result.
+	DecisionCache struct {
+		spec *Spec
+
+		ttl         time.Duration
+		negativeTTL time.Duration
+
+		cache *lru.Cache
+		group singleflight.Group
+
+		hits      uint64
+		misses    uint64
+		coalesced uint64
+	}
+
+	// Spec describes the DecisionCache.
+	Spec struct {
+		TTL string `yaml:"ttl" jsonschema:"required,format=duration"`
+		// NegativeTTL is the TTL of the denials, they are not cached if
+		// it's empty.
+		NegativeTTL string `yaml:"negativeTTL,omitempty" jsonschema:"omitempty,format=duration"`
+		MaxEntries  int    `yaml:"maxEntries,omitempty" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// Decision is the decision of the access control.
+	Decision struct {
+		Allowed bool
+		// Value is the extra information of the decision, e.g. the
+		// subject of the token.
+		Value interface{}
+		// TTL overrides the TTL of the spec if it's positive and shorter,
+		// e.g. the remaining lifetime of the token.
+		TTL time.Duration
+	}
+
+	// Status is the status of DecisionCache.
+	Status struct {
+		Entries int    `yaml:"entries"`
+		Hits    uint64 `yaml:"hits"`
+		Misses  uint64 `yaml:"misses"`
+		// Coalesced is the number of the misses sharing the decision
+		// with others.
+		Coalesced uint64 `yaml:"coalesced"`
+	}
+
+	entry struct {
+		decision  *Decision
+		expiresAt time.Time
+	}
+)
+
+// New creates a DecisionCache.
+func New(spec *Spec) *DecisionCache {
+	dc := &DecisionCache{spec: spec}
+
+	var err error
+	dc.ttl, err = time.ParseDuration(spec.TTL)
+	if err != nil {
+		logger.Errorf("BUG: parse duration %s failed: %v", spec.TTL, err)
+	}
+	if spec.NegativeTTL != "" {
+		dc.negativeTTL, err = time.ParseDuration(spec.NegativeTTL)
+		if err != nil {
+			logger.Errorf("BUG: parse duration %s failed: %v", spec.NegativeTTL, err)
+		}
+	}
+
+	maxEntries := spec.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxEntries
+	}
+	// NOTE: It returns error only if the size is not positive.
+	dc.cache, _ = lru.New(maxEntries)
+
+	return dc
+}
+
+// Get returns the decision of the key, it calls decide to make the
+// decision if it's not cached or expired.
+func (dc *DecisionCache) Get(key string, decide func() (*Decision, error)) (*Decision, error) {
+	if v, ok := dc.cache.Get(key); ok {
+		e := v.(*entry)
+		if time.Now().Before(e.expiresAt) {
+			atomic.AddUint64(&dc.hits, 1)
+			return e.decision, nil
+		}
+		dc.cache.Remove(key)
+	}
+
+	atomic.AddUint64(&dc.misses, 1)
+	v, err, shared := dc.group.Do(key, func() (interface{}, error) {
+		decision, err := decide()
+		if err != nil {
+			return nil, err
+		}
+		dc.put(key, decision)
+		return decision, nil
+	})
+	if shared {
+		atomic.AddUint64(&dc.coalesced, 1)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*Decision), nil
+}
+
+func (dc *DecisionCache) put(key string, decision *Decision) {
+	ttl := dc.ttl
+	if !decision.Allowed {
+		ttl = dc.negativeTTL
+	}
+	if decision.TTL > 0 && decision.TTL < ttl {
+		ttl = decision.TTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	dc.cache.Add(key, &entry{
+		decision:  decision,
+		expiresAt: time.Now().Add(ttl),
+	})
+}
+
+// Status returns the status of DecisionCache.
+func (dc *DecisionCache) Status() *Status {
+	return &Status{
+		Entries:   dc.cache.Len(),
+		Hits:      atomic.LoadUint64(&dc.hits),
+		Misses:    atomic.LoadUint64(&dc.misses),
+		Coalesced: atomic.LoadUint64(&dc.coalesced),
+	}
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package decisioncache
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDecisionCache(t *testing.T) {
+	dc := New(&Spec{TTL: "1m", NegativeTTL: "50ms", MaxEntries: 2})
+
+	calls := 0
+	decide := func(allowed bool) func() (*Decision, error) {
+		return func() (*Decision, error) {
+			calls++
+			return &Decision{Allowed: allowed}, nil
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		d, err := dc.Get("allowed", decide(true))
+		if err != nil || !d.Allowed {
+			t.Fatalf("want allowed, got %+v, %v", d, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("want 1 call, got %d", calls)
+	}
+
+	for i := 0; i < 3; i++ {
+		d, _ := dc.Get("denied", decide(false))
+		if d.Allowed {
+			t.Fatalf("want denied")
+		}
+	}
+	if calls != 2 {
+		t.Errorf("want 2 calls, got %d", calls)
+	}
+
+	// the denial expires earlier
+	time.Sleep(100 * time.Millisecond)
+	dc.Get("denied", decide(false))
+	dc.Get("allowed", decide(true))
+	if calls != 3 {
+		t.Errorf("want 3 calls, got %d", calls)
+	}
+
+	// the errors are not cached
+	for i := 0; i < 2; i++ {
+		_, err := dc.Get("error", func() (*Decision, error) {
+			calls++
+			return nil, fmt.Errorf("unavailable")
+		})
+		if err == nil {
+			t.Fatalf("want error")
+		}
+	}
+	if calls != 5 {
+		t.Errorf("want 5 calls, got %d", calls)
+	}
+
+	// the decision TTL shortens the TTL
+	dc.Get("short", func() (*Decision, error) {
+		return &Decision{Allowed: true, TTL: time.Millisecond}, nil
+	})
+	time.Sleep(10 * time.Millisecond)
+	dc.Get("short", decide(true))
+	if calls != 6 {
+		t.Errorf("want 6 calls, got %d", calls)
+	}
+
+	// the size is bounded
+	if n := dc.Status().Entries; n != 2 {
+		t.Errorf("want 2 entries, got %d", n)
+	}
+
+	// the denials are not cached without negative TTL
+	dc = New(&Spec{TTL: "1m"})
+	calls = 0
+	dc.Get("denied", decide(false))
+	dc.Get("denied", decide(false))
+	if calls != 2 {
+		t.Errorf("want 2 calls, got %d", calls)
+	}
+}
+
+func TestDecisionCacheStampede(t *testing.T) {
+	dc := New(&Spec{TTL: "1m"})
+
+	var calls int32
+	release := make(chan struct{})
+	decide := func() (*Decision, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &Decision{Allowed: true}, nil
+	}
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dc.Get("key", decide)
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("want 1 call, got %d", n)
+	}
+}
@@ -0,0 +1,259 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package egress holds the allowlists of the upstream addresses the
+// gateway is allowed to dial. No address is restricted if there is no
+// allowlist, otherwise an address must be allowed by one of them.
+package egress
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type (
+	// Allowlist lists the upstream addresses allowed to dial.
+	Allowlist struct {
+		// Hosts are the hostname patterns, e.g. "*.example.com".
+		Hosts []string
+		// CIDRs are the IPs or CIDRs.
+		CIDRs []string
+		// Ports are the allowed ports, all ports are allowed if it's empty.
+		Ports []int
+	}
+
+	// DialFunc is the function dialing the address.
+	DialFunc = func(ctx stdcontext.Context, network, addr string) (net.Conn, error)
+
+	allowlist struct {
+		hosts []string
+		nets  []*net.IPNet
+		ports map[int]struct{}
+	}
+)
+
+var (
+	mutex      sync.Mutex
+	allowlists = map[string]*allowlist{}
+	// current is the []*allowlist of allowlists, for checking without lock.
+	current atomic.Value
+)
+
+func init() {
+	current.Store([]*allowlist{})
+}
+
+// Validate validates the allowlist.
+func (a *Allowlist) Validate() error {
+	for _, host := range a.Hosts {
+		if _, err := path.Match(host, ""); err != nil {
+			return fmt.Errorf("invalid host pattern %s: %v", host, err)
+		}
+	}
+
+	for _, cidr := range a.CIDRs {
+		if _, err := parseCIDR(cidr); err != nil {
+			return err
+		}
+	}
+
+	for _, port := range a.Ports {
+		if port <= 0 || port > 65535 {
+			return fmt.Errorf("invalid port %d", port)
+		}
+	}
+
+	return nil
+}
+
+func parseCIDR(s string) (*net.IPNet, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		bits := 8 * net.IPv4len
+		if ip.To4() == nil {
+			bits = 8 * net.IPv6len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ip or cidr %s", s)
+	}
+	return ipNet, nil
+}
+
+// Set sets the allowlist of the owner, it replaces the previous one of the owner.
+func Set(owner string, a *Allowlist) error {
+	if err := a.Validate(); err != nil {
+		return err
+	}
+
+	al := &allowlist{ports: map[int]struct{}{}}
+	for _, host := range a.Hosts {
+		al.hosts = append(al.hosts, strings.ToLower(host))
+	}
+	for _, cidr := range a.CIDRs {
+		ipNet, _ := parseCIDR(cidr)
+		al.nets = append(al.nets, ipNet)
+	}
+	for _, port := range a.Ports {
+		al.ports[port] = struct{}{}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	allowlists[owner] = al
+	publish()
+
+	return nil
+}
+
+// Delete deletes the allowlist of the owner.
+func Delete(owner string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	delete(allowlists, owner)
+	publish()
+}
+
+// publish stores the allowlists into current in the order of owners,
+// it must be called with the lock held.
+func publish() {
+	owners := make([]string, 0, len(allowlists))
+	for owner := range allowlists {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+
+	all := make([]*allowlist, 0, len(owners))
+	for _, owner := range owners {
+		all = append(all, allowlists[owner])
+	}
+	current.Store(all)
+}
+
+// Enabled reports whether there is any allowlist.
+func Enabled() bool {
+	return len(current.Load().([]*allowlist)) != 0
+}
+
+// Check checks whether the host and port are allowed, the port is not
+// checked if it's 0. A hostname must match the host patterns, it's never
+// resolved to check against the CIDRs, and an IP must be in the CIDRs.
+func Check(host string, port int) error {
+	all := current.Load().([]*allowlist)
+	if len(all) == 0 {
+		return nil
+	}
+
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	ip := net.ParseIP(host)
+	for _, al := range all {
+		if al.allow(host, ip, port) {
+			return nil
+		}
+	}
+
+	if port == 0 {
+		return fmt.Errorf("egress to %s is not allowed", host)
+	}
+	return fmt.Errorf("egress to %s is not allowed",
+		net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+// CheckURL checks whether the host and port of the URL are allowed,
+// the default port of the scheme is used if the port is missing.
+func CheckURL(rawURL string) error {
+	if !Enabled() {
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %v", err)
+	}
+
+	port := 0
+	switch {
+	case u.Port() != "":
+		port, err = strconv.Atoi(u.Port())
+		if err != nil {
+			return fmt.Errorf("invalid port of url %s", rawURL)
+		}
+	case u.Scheme == "http" || u.Scheme == "ws":
+		port = 80
+	case u.Scheme == "https" || u.Scheme == "wss":
+		port = 443
+	}
+
+	return Check(u.Hostname(), port)
+}
+
+// Dialer wraps dial to refuse the addresses which are not allowed.
+func Dialer(dial DialFunc) DialFunc {
+	return func(ctx stdcontext.Context, network, addr string) (net.Conn, error) {
+		host, portStr, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port of address %s", addr)
+		}
+
+		if err := Check(host, port); err != nil {
+			return nil, err
+		}
+
+		return dial(ctx, network, addr)
+	}
+}
+
+func (al *allowlist) allow(host string, ip net.IP, port int) bool {
+	if port != 0 && len(al.ports) != 0 {
+		if _, exists := al.ports[port]; !exists {
+			return false
+		}
+	}
+
+	if ip != nil {
+		for _, ipNet := range al.nets {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, pattern := range al.hosts {
+		if matched, _ := path.Match(pattern, host); matched {
+			return true
+		}
+	}
+	return false
+}
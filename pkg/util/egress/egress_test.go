@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package egress
+
+import (
+	stdcontext "context"
+	"net"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	if err := CheckURL("http://anywhere.com"); err != nil {
+		t.Fatalf("nothing should be restricted without allowlists, but got %v", err)
+	}
+
+	if err := Set("a", &Allowlist{CIDRs: []string{"10.0.0.0/8"}, Ports: []int{80}}); err != nil {
+		t.Fatalf("set allowlist failed: %v", err)
+	}
+	if err := Set("b", &Allowlist{Hosts: []string{"*.Example.com"}, CIDRs: []string{"::1"}}); err != nil {
+		t.Fatalf("set allowlist failed: %v", err)
+	}
+	if err := Set("c", &Allowlist{Hosts: []string{"[a"}}); err == nil {
+		t.Fatalf("invalid host pattern should fail")
+	}
+	defer Delete("a")
+	defer Delete("b")
+
+	allowed := []string{
+		"http://10.1.2.3",
+		"http://10.1.2.3:80/path",
+		"https://api.example.com:8443",
+		"wss://API.EXAMPLE.COM",
+		"http://[::1]:9090",
+	}
+	for _, u := range allowed {
+		if err := CheckURL(u); err != nil {
+			t.Errorf("%s should be allowed, but got %v", u, err)
+		}
+	}
+
+	denied := []string{
+		"https://10.1.2.3",
+		"http://10.1.2.3:8080",
+		"http://192.168.1.1",
+		"http://example.com",
+		"http://api.example.org",
+	}
+	for _, u := range denied {
+		if err := CheckURL(u); err == nil {
+			t.Errorf("%s should be denied", u)
+		}
+	}
+
+	if err := Check("10.0.0.1", 0); err != nil {
+		t.Errorf("port 0 should not be checked, but got %v", err)
+	}
+
+	dialed := ""
+	dial := Dialer(func(ctx stdcontext.Context, network, addr string) (net.Conn, error) {
+		dialed = addr
+		return nil, nil
+	})
+	if _, err := dial(stdcontext.Background(), "tcp", "192.168.1.1:80"); err == nil || dialed != "" {
+		t.Errorf("dialing 192.168.1.1:80 should be denied")
+	}
+	if _, err := dial(stdcontext.Background(), "tcp", "10.0.0.1:80"); err != nil || dialed != "10.0.0.1:80" {
+		t.Errorf("dialing 10.0.0.1:80 should be allowed, but got %v", err)
+	}
+
+	Delete("a")
+	Delete("b")
+	if Enabled() {
+		t.Errorf("allowlists should be deleted")
+	}
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package exposition
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/util/httpstat"
+)
+
+const (
+	// TypeCounter is the type of the counter metrics.
+	TypeCounter = "counter"
+	// TypeGauge is the type of the gauge metrics.
+	TypeGauge = "gauge"
+	// TypeHistogram is the type of the histogram metrics.
+	TypeHistogram = "histogram"
+)
+
+type (
+	// Exposition builds the metrics in the text format of Prometheus,
+	// the samples of a metric family are written together.
+	// Reference: https://prometheus.io/docs/instrumenting/exposition_formats/
+	Exposition struct {
+		families map[string]*family
+	}
+
+	family struct {
+		typ     string
+		samples []string
+	}
+
+	// Label is a label of the samples.
+	Label struct {
+		Name  string
+		Value string
+	}
+)
+
+// New creates an Exposition.
+func New() *Exposition {
+	return &Exposition{families: map[string]*family{}}
+}
+
+// Add adds a sample of the metric family.
+func (e *Exposition) Add(name, typ string, labels []Label, value float64) {
+	e.addSample(name, typ, name, labels, value)
+}
+
+func (e *Exposition) addSample(familyName, typ, name string, labels []Label, value float64) {
+	f, exists := e.families[familyName]
+	if !exists {
+		f = &family{typ: typ}
+		e.families[familyName] = f
+	}
+
+	buff := &bytes.Buffer{}
+	buff.WriteString(name)
+	if len(labels) != 0 {
+		buff.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				buff.WriteByte(',')
+			}
+			buff.WriteString(l.Name)
+			buff.WriteString(`="`)
+			buff.WriteString(escapeLabelValue(l.Value))
+			buff.WriteByte('"')
+		}
+		buff.WriteByte('}')
+	}
+	buff.WriteByte(' ')
+	buff.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+
+	f.samples = append(f.samples, buff.String())
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+// AddHistogram adds the buckets and the count of the histogram, les are
+// the upper bounds of the buckets and counts are the numbers of samples
+// in each bucket, they are accumulated here. The last bucket should be
+// +Inf, whose count is also the count of the histogram.
+func (e *Exposition) AddHistogram(name string, labels []Label, les []string, counts []uint64) {
+	var total uint64
+	for i, le := range les {
+		total += counts[i]
+		e.addSample(name, TypeHistogram, name+"_bucket", WithLabel(labels, "le", le), float64(total))
+	}
+	e.addSample(name, TypeHistogram, name+"_count", labels, float64(total))
+}
+
+// AddHTTPStat adds the metrics of the HTTP statistics with the labels.
+func (e *Exposition) AddHTTPStat(labels []Label, s *httpstat.Status) {
+	e.Add("easegress_http_requests_total", TypeCounter, labels, float64(s.Count))
+	e.Add("easegress_http_errors_total", TypeCounter, labels, float64(s.ErrCount))
+	e.Add("easegress_http_request_bytes_total", TypeCounter, labels, float64(s.ReqSize))
+	e.Add("easegress_http_response_bytes_total", TypeCounter, labels, float64(s.RespSize))
+
+	codes := make([]int, 0, len(s.Codes))
+	for code := range s.Codes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		e.Add("easegress_http_responses_total", TypeCounter,
+			WithLabel(labels, "code", strconv.Itoa(code)), float64(s.Codes[code]))
+	}
+
+	for _, q := range []struct {
+		quantile string
+		value    float64
+	}{
+		{"0.25", s.P25}, {"0.5", s.P50}, {"0.75", s.P75}, {"0.95", s.P95},
+		{"0.98", s.P98}, {"0.99", s.P99}, {"0.999", s.P999},
+	} {
+		e.Add("easegress_http_request_duration_milliseconds", TypeGauge,
+			WithLabel(labels, "quantile", q.quantile), q.value)
+	}
+}
+
+// WithLabel returns a copy of the labels with the label appended.
+func WithLabel(labels []Label, name, value string) []Label {
+	result := make([]Label, len(labels), len(labels)+1)
+	copy(result, labels)
+	return append(result, Label{Name: name, Value: value})
+}
+
+// Bytes returns the metrics with the families sorted by names.
+func (e *Exposition) Bytes() []byte {
+	names := make([]string, 0, len(e.families))
+	for name := range e.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buff := &bytes.Buffer{}
+	for _, name := range names {
+		f := e.families[name]
+		buff.WriteString("# TYPE " + name + " " + f.typ + "\n")
+		for _, sample := range f.samples {
+			buff.WriteString(sample)
+			buff.WriteByte('\n')
+		}
+	}
+
+	return buff.Bytes()
+}
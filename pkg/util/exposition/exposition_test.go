@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package exposition
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/util/httpstat"
+)
+
+func TestExposition(t *testing.T) {
+	e := New()
+	labels := []Label{{"namespace", "default"}, {"name", `a"b`}}
+	e.AddHTTPStat(labels, &httpstat.Status{
+		Count:    10,
+		ErrCount: 2,
+		P99:      12.5,
+		Codes:    map[int]uint64{500: 2, 200: 8},
+	})
+	e.AddHTTPStat([]Label{{"namespace", "default"}, {"name", "c"}}, &httpstat.Status{Count: 1})
+
+	text := string(e.Bytes())
+	for _, want := range []string{
+		"# TYPE easegress_http_requests_total counter\n" +
+			`easegress_http_requests_total{namespace="default",name="a\"b"} 10` + "\n" +
+			`easegress_http_requests_total{namespace="default",name="c"} 1` + "\n",
+		`easegress_http_responses_total{namespace="default",name="a\"b",code="200"} 8` + "\n" +
+			`easegress_http_responses_total{namespace="default",name="a\"b",code="500"} 2` + "\n",
+		"# TYPE easegress_http_request_duration_milliseconds gauge\n",
+		`easegress_http_request_duration_milliseconds{namespace="default",name="a\"b",quantile="0.99"} 12.5` + "\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("want %q in metrics:\n%s", want, text)
+		}
+	}
+
+	if strings.Count(text, "# TYPE easegress_http_errors_total") != 1 {
+		t.Errorf("the samples of a family should be written together:\n%s", text)
+	}
+}
+
+func TestExpositionHistogram(t *testing.T) {
+	e := New()
+	e.AddHistogram("latency_seconds", []Label{{"server", "a"}},
+		[]string{"0.1", "1", "+Inf"}, []uint64{2, 3, 1})
+
+	want := "# TYPE latency_seconds histogram\n" +
+		`latency_seconds_bucket{server="a",le="0.1"} 2` + "\n" +
+		`latency_seconds_bucket{server="a",le="1"} 5` + "\n" +
+		`latency_seconds_bucket{server="a",le="+Inf"} 6` + "\n" +
+		`latency_seconds_count{server="a"} 6` + "\n"
+	if got := string(e.Bytes()); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
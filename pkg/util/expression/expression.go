@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package expression implements a small and safe expression language for
+// conditions and key construction, e.g.
+//
+//   req.method == "POST" && hasPrefix(req.path, "/api/") && [[filter.auth.rsp.statuscode]] != 401
+//
+// It supports string, number and boolean literals, comparisons, boolean
+// operators, string concatenation by "+", a few built-in string functions,
+// variables like req.header.X-User and template references like
+// [[filter.x.req.body.{gjson}]]. There are no loops and no side effects,
+// so evaluating an expression always terminates.
+package expression
+
+import (
+	"fmt"
+)
+
+type (
+	// Env provides the values referenced by an expression.
+	Env interface {
+		// Variable returns the value of a variable such as req.method,
+		// the bool is false if the variable is unknown.
+		Variable(name string) (interface{}, bool)
+
+		// Template renders a template reference, the tag is the content
+		// between the begin and end token, e.g. filter.x.req.body.
+		Template(tag string) (string, error)
+	}
+
+	// Expression is a parsed expression, it is safe for concurrent use.
+	Expression struct {
+		src  string
+		root node
+	}
+)
+
+// Parse parses an expression.
+func Parse(src string) (*Expression, error) {
+	root, err := parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("parse expression %q failed: %v", src, err)
+	}
+
+	return &Expression{src: src, root: root}, nil
+}
+
+// MustParse is like Parse but panics if the expression can't be parsed.
+func MustParse(src string) *Expression {
+	e, err := Parse(src)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// String returns the source of the expression.
+func (e *Expression) String() string {
+	return e.src
+}
+
+// Eval evaluates the expression, the result is one of string, float64 and bool.
+func (e *Expression) Eval(env Env) (interface{}, error) {
+	return e.root.eval(env)
+}
+
+// EvalBool evaluates the expression as a condition. Non-empty strings
+// and non-zero numbers are true.
+func (e *Expression) EvalBool(env Env) (bool, error) {
+	value, err := e.root.eval(env)
+	if err != nil {
+		return false, err
+	}
+	return toBool(value), nil
+}
+
+// EvalString evaluates the expression and converts the result to string,
+// it is useful for building keys.
+func (e *Expression) EvalString(env Env) (string, error) {
+	value, err := e.root.eval(env)
+	if err != nil {
+		return "", err
+	}
+	return toString(value), nil
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package expression
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+type mapEnv map[string]interface{}
+
+func (e mapEnv) Variable(name string) (interface{}, bool) {
+	v, ok := e[name]
+	return v, ok
+}
+
+func (e mapEnv) Template(tag string) (string, error) {
+	if v, ok := e["[["+tag+"]]"]; ok {
+		return v.(string), nil
+	}
+	return "", fmt.Errorf("template %s not found", tag)
+}
+
+func TestEval(t *testing.T) {
+	env := mapEnv{
+		"req.method":        "POST",
+		"req.path":          "/api/users",
+		"req.header.X-Id":   "42",
+		"[[filter.a.code]]": "401",
+	}
+
+	cases := []struct {
+		src    string
+		expect interface{}
+	}{
+		{`req.method == "POST"`, true},
+		{`req.method != 'POST'`, false},
+		{`hasPrefix(req.path, "/api/") && !contains(req.path, "admin")`, true},
+		{`req.header.X-Id > 9`, true},
+		{`req.header.X-Id > "9"`, false},
+		{`[[filter.a.code]] == 401 || false`, true},
+		{`lower("ABC") + "-" + upper('def')`, "abc-DEF"},
+		{`len(req.path)`, float64(10)},
+		{`matches(req.path, "^/api/[a-z]+$")`, true},
+		{`(1 < 2) == true`, true},
+		{`"a\"b"`, `a"b`},
+	}
+
+	for _, c := range cases {
+		e, err := Parse(c.src)
+		if err != nil {
+			t.Fatalf("parse %s failed: %v", c.src, err)
+		}
+		got, err := e.Eval(env)
+		if err != nil {
+			t.Fatalf("eval %s failed: %v", c.src, err)
+		}
+		if got != c.expect {
+			t.Errorf("eval %s: expect %v, got %v", c.src, c.expect, got)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`a ==`,
+		`(a == b`,
+		`unknown(a)`,
+		`contains(a)`,
+		`matches(a, "[")`,
+		`"abc`,
+		`[[abc`,
+		`a # b`,
+		`a b`,
+	} {
+		if _, err := Parse(src); err == nil {
+			t.Errorf("parse %s should fail", src)
+		}
+	}
+}
+
+func TestEvalError(t *testing.T) {
+	e := MustParse(`unknown == "a"`)
+	if _, err := e.EvalBool(mapEnv{}); err == nil {
+		t.Errorf("unknown variable should fail")
+	}
+
+	// short circuit skips the unknown variable.
+	e = MustParse(`false && unknown`)
+	if ok, err := e.EvalBool(mapEnv{}); ok || err != nil {
+		t.Errorf("short circuit failed: %v, %v", ok, err)
+	}
+}
+
+func TestHTTPEnv(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/abc?x=1", nil)
+	req.Header.Set("X-User", "bob")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "s1"})
+	ctx := context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "")
+
+	e := MustParse(`req.method + ":" + req.path + ":" + req.query.x + ":" + req.header.X-User + ":" + req.cookie.session`)
+	s, err := e.EvalString(NewHTTPEnv(ctx))
+	if err != nil {
+		t.Fatalf("eval failed: %v", err)
+	}
+	if s != "GET:/abc:1:bob:s1" {
+		t.Errorf("unexpected result %s", s)
+	}
+
+	e = MustParse(`[[filter.a.req.path]] == "/abc"`)
+	if _, err := e.EvalBool(NewHTTPEnv(ctx)); err == nil {
+		t.Errorf("template should fail without template engine")
+	}
+}
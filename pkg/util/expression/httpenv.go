@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package expression
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+	"github.com/megaease/easegress/pkg/util/texttemplate"
+)
+
+const (
+	headerPrefix = "req.header."
+	queryPrefix  = "req.query."
+	cookiePrefix = "req.cookie."
+)
+
+// httpEnv is the Env of an HTTPContext, the variables are:
+//
+//   req.method, req.path, req.host, req.scheme, req.proto, req.query, req.realIP,
+//   req.header.<name>, req.query.<name>, req.cookie.<name>
+//
+// template references are rendered by the template engine of the context.
+type httpEnv struct {
+	ctx context.HTTPContext
+}
+
+// NewHTTPEnv creates an Env for the HTTPContext.
+func NewHTTPEnv(ctx context.HTTPContext) Env {
+	return &httpEnv{ctx: ctx}
+}
+
+func (e *httpEnv) Variable(name string) (interface{}, bool) {
+	req := e.ctx.Request()
+
+	switch name {
+	case "req.method":
+		return req.Method(), true
+	case "req.path":
+		return req.Path(), true
+	case "req.host":
+		return req.Host(), true
+	case "req.scheme":
+		return req.Scheme(), true
+	case "req.proto":
+		return req.Proto(), true
+	case "req.query":
+		return req.Query(), true
+	case "req.realIP":
+		return req.RealIP(), true
+	}
+
+	switch {
+	case strings.HasPrefix(name, headerPrefix):
+		return req.Header().Get(name[len(headerPrefix):]), true
+	case strings.HasPrefix(name, queryPrefix):
+		return req.Std().URL.Query().Get(name[len(queryPrefix):]), true
+	case strings.HasPrefix(name, cookiePrefix):
+		cookie, err := req.Cookie(name[len(cookiePrefix):])
+		if err != nil {
+			return "", true
+		}
+		return cookie.Value, true
+	}
+
+	return nil, false
+}
+
+func (e *httpEnv) Template(tag string) (string, error) {
+	input := stringtool.Cat(texttemplate.DefaultBeginToken, tag, texttemplate.DefaultEndToken)
+
+	te := e.ctx.Template()
+	if !te.HasTemplates(input) {
+		return "", fmt.Errorf("no template matches %s", tag)
+	}
+
+	return te.Render(input)
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package expression
+
+import (
+	"fmt"
+	"strings"
+)
+
+type (
+	tokenKind int
+
+	token struct {
+		kind  tokenKind
+		text  string
+		value interface{}
+		pos   int
+	}
+
+	lexer struct {
+		src    string
+		pos    int
+		tokens []*token
+	}
+)
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenBool
+	tokenTemplate
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+const (
+	templateBegin = "[["
+	templateEnd   = "]]"
+)
+
+// operators must be ordered by length descending for greedy matching.
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+"}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '.' || c == '-'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func tokenize(src string) ([]*token, error) {
+	l := &lexer{src: src}
+	if err := l.run(); err != nil {
+		return nil, err
+	}
+	return l.tokens, nil
+}
+
+func (l *lexer) emit(kind tokenKind, text string, value interface{}, pos int) {
+	l.tokens = append(l.tokens, &token{kind: kind, text: text, value: value, pos: pos})
+}
+
+func (l *lexer) run() error {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		start := l.pos
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			l.pos++
+		case c == '(':
+			l.emit(tokenLParen, "(", nil, start)
+			l.pos++
+		case c == ')':
+			l.emit(tokenRParen, ")", nil, start)
+			l.pos++
+		case c == ',':
+			l.emit(tokenComma, ",", nil, start)
+			l.pos++
+		case c == '\'' || c == '"':
+			if err := l.lexString(c); err != nil {
+				return err
+			}
+		case strings.HasPrefix(l.src[l.pos:], templateBegin):
+			end := strings.Index(l.src[l.pos+len(templateBegin):], templateEnd)
+			if end == -1 {
+				return fmt.Errorf("unterminated template at %d", start)
+			}
+			tag := l.src[l.pos+len(templateBegin) : l.pos+len(templateBegin)+end]
+			if strings.TrimSpace(tag) == "" {
+				return fmt.Errorf("empty template at %d", start)
+			}
+			l.pos += len(templateBegin) + end + len(templateEnd)
+			l.emit(tokenTemplate, l.src[start:l.pos], strings.TrimSpace(tag), start)
+		case isDigit(c):
+			l.lexNumber()
+		case isIdentStart(c):
+			for l.pos < len(l.src) && isIdentPart(l.src[l.pos]) {
+				l.pos++
+			}
+			text := l.src[start:l.pos]
+			switch text {
+			case "true":
+				l.emit(tokenBool, text, true, start)
+			case "false":
+				l.emit(tokenBool, text, false, start)
+			default:
+				l.emit(tokenIdent, text, nil, start)
+			}
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(l.src[l.pos:], op) {
+					l.emit(tokenOperator, op, nil, start)
+					l.pos += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return fmt.Errorf("unexpected character %q at %d", c, start)
+			}
+		}
+	}
+
+	l.emit(tokenEOF, "", nil, l.pos)
+	return nil
+}
+
+func (l *lexer) lexString(quote byte) error {
+	start := l.pos
+	l.pos++
+
+	var sb strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch c {
+		case '\\':
+			if l.pos+1 >= len(l.src) {
+				return fmt.Errorf("unterminated string at %d", start)
+			}
+			l.pos++
+			switch esc := l.src[l.pos]; esc {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			default:
+				sb.WriteByte(esc)
+			}
+			l.pos++
+		case quote:
+			l.pos++
+			l.emit(tokenString, l.src[start:l.pos], sb.String(), start)
+			return nil
+		default:
+			sb.WriteByte(c)
+			l.pos++
+		}
+	}
+
+	return fmt.Errorf("unterminated string at %d", start)
+}
+
+func (l *lexer) lexNumber() {
+	start := l.pos
+	for l.pos < len(l.src) && (isDigit(l.src[l.pos]) || l.src[l.pos] == '.') {
+		l.pos++
+	}
+	text := l.src[start:l.pos]
+	l.emit(tokenNumber, text, text, start)
+}
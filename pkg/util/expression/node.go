@@ -0,0 +1,324 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package expression
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type (
+	// node is a node of the syntax tree, the value it evaluates to is
+	// one of string, float64 and bool.
+	node interface {
+		eval(env Env) (interface{}, error)
+	}
+
+	literalNode struct {
+		value interface{}
+	}
+
+	variableNode struct {
+		name string
+	}
+
+	templateNode struct {
+		tag string
+		raw string
+	}
+
+	notNode struct {
+		operand node
+	}
+
+	logicalNode struct {
+		op    string
+		left  node
+		right node
+	}
+
+	compareNode struct {
+		op    string
+		left  node
+		right node
+	}
+
+	concatNode struct {
+		left  node
+		right node
+	}
+
+	callNode struct {
+		name string
+		fn   *function
+		args []node
+		re   *regexp.Regexp
+	}
+
+	function struct {
+		argc    int
+		prepare func(call *callNode) error
+		call    func(call *callNode, args []interface{}) (interface{}, error)
+	}
+)
+
+var functions = map[string]*function{
+	"contains": {
+		argc: 2,
+		call: func(_ *callNode, args []interface{}) (interface{}, error) {
+			return strings.Contains(toString(args[0]), toString(args[1])), nil
+		},
+	},
+	"hasPrefix": {
+		argc: 2,
+		call: func(_ *callNode, args []interface{}) (interface{}, error) {
+			return strings.HasPrefix(toString(args[0]), toString(args[1])), nil
+		},
+	},
+	"hasSuffix": {
+		argc: 2,
+		call: func(_ *callNode, args []interface{}) (interface{}, error) {
+			return strings.HasSuffix(toString(args[0]), toString(args[1])), nil
+		},
+	},
+	"lower": {
+		argc: 1,
+		call: func(_ *callNode, args []interface{}) (interface{}, error) {
+			return strings.ToLower(toString(args[0])), nil
+		},
+	},
+	"upper": {
+		argc: 1,
+		call: func(_ *callNode, args []interface{}) (interface{}, error) {
+			return strings.ToUpper(toString(args[0])), nil
+		},
+	},
+	"len": {
+		argc: 1,
+		call: func(_ *callNode, args []interface{}) (interface{}, error) {
+			return float64(len(toString(args[0]))), nil
+		},
+	},
+	"matches": {
+		argc: 2,
+		// NOTE: Compile the pattern at parsing phase if it's a literal,
+		// so the invalid pattern could be reported early.
+		prepare: func(call *callNode) error {
+			lit, ok := call.args[1].(*literalNode)
+			if !ok {
+				return nil
+			}
+			re, err := regexp.Compile(toString(lit.value))
+			if err != nil {
+				return fmt.Errorf("function matches: %v", err)
+			}
+			call.re = re
+			return nil
+		},
+		call: func(call *callNode, args []interface{}) (interface{}, error) {
+			re := call.re
+			if re == nil {
+				var err error
+				re, err = regexp.Compile(toString(args[1]))
+				if err != nil {
+					return nil, fmt.Errorf("function matches: %v", err)
+				}
+			}
+			return re.MatchString(toString(args[0])), nil
+		},
+	},
+}
+
+func (n *literalNode) eval(env Env) (interface{}, error) {
+	return n.value, nil
+}
+
+func (n *variableNode) eval(env Env) (interface{}, error) {
+	value, ok := env.Variable(n.name)
+	if !ok {
+		return nil, fmt.Errorf("unknown variable %s", n.name)
+	}
+	return value, nil
+}
+
+func (n *templateNode) eval(env Env) (interface{}, error) {
+	value, err := env.Template(n.tag)
+	if err != nil {
+		return nil, fmt.Errorf("render %s failed: %v", n.raw, err)
+	}
+	return value, nil
+}
+
+func (n *notNode) eval(env Env) (interface{}, error) {
+	value, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return !toBool(value), nil
+}
+
+func (n *logicalNode) eval(env Env) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// Short circuit.
+	if n.op == "&&" && !toBool(left) {
+		return false, nil
+	}
+	if n.op == "||" && toBool(left) {
+		return true, nil
+	}
+
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return toBool(right), nil
+}
+
+func (n *compareNode) eval(env Env) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// Compare as numbers if any side is a number and the other side could
+	// be converted to a number, otherwise compare as strings.
+	_, leftIsNum := left.(float64)
+	_, rightIsNum := right.(float64)
+	if leftIsNum || rightIsNum {
+		l, lok := toNumber(left)
+		r, rok := toNumber(right)
+		if lok && rok {
+			return compareNumbers(n.op, l, r), nil
+		}
+	}
+
+	return compareStrings(n.op, toString(left), toString(right)), nil
+}
+
+func compareNumbers(op string, l, r float64) bool {
+	switch op {
+	case "==":
+		return l == r
+	case "!=":
+		return l != r
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	default:
+		return l >= r
+	}
+}
+
+func compareStrings(op string, l, r string) bool {
+	switch op {
+	case "==":
+		return l == r
+	case "!=":
+		return l != r
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	default:
+		return l >= r
+	}
+}
+
+func (n *concatNode) eval(env Env) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return toString(left) + toString(right), nil
+}
+
+func (n *callNode) eval(env Env) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	return n.fn.call(n, args)
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+func toBool(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	default:
+		return false
+	}
+}
@@ -0,0 +1,245 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package expression
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type parser struct {
+	tokens []*token
+	pos    int
+}
+
+// The grammar is:
+//
+//   expr    = or
+//   or      = and { "||" and }
+//   and     = unary { "&&" unary }
+//   unary   = "!" unary | compare
+//   compare = concat [ ( "==" | "!=" | "<" | "<=" | ">" | ">=" ) concat ]
+//   concat  = primary { "+" primary }
+//   primary = literal | variable | template | call | "(" expr ")"
+//   call    = ident "(" [ expr { "," expr } ] ")"
+func parse(src string) (node, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+
+	return n, nil
+}
+
+func (p *parser) peek() *token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() *token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isOperator(ops ...string) bool {
+	t := p.peek()
+	if t.kind != tokenOperator {
+		return false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOperator("||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "||", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOperator("&&") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "&&", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.isOperator("!") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (node, error) {
+	left, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.isOperator("==", "!=", "<", "<=", ">", ">=") {
+		op := p.next().text
+		right, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		return &compareNode{op: op, left: left, right: right}, nil
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseConcat() (node, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOperator("+") {
+		p.next()
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		left = &concatNode{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokenString, tokenBool:
+		return &literalNode{value: t.value}, nil
+	case tokenNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", t.text, t.pos)
+		}
+		return &literalNode{value: f}, nil
+	case tokenTemplate:
+		return &templateNode{tag: t.value.(string), raw: t.text}, nil
+	case tokenIdent:
+		if p.peek().kind == tokenLParen {
+			return p.parseCall(t)
+		}
+		return &variableNode{name: t.text}, nil
+	case tokenLParen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if r := p.next(); r.kind != tokenRParen {
+			return nil, fmt.Errorf("expect ) at %d, got %q", r.pos, r.text)
+		}
+		return n, nil
+	case tokenEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+func (p *parser) parseCall(name *token) (node, error) {
+	fn, exists := functions[name.text]
+	if !exists {
+		return nil, fmt.Errorf("unknown function %s at %d", name.text, name.pos)
+	}
+
+	p.next() // skip "("
+
+	var args []node
+	if p.peek().kind != tokenRParen {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+
+			if p.peek().kind != tokenComma {
+				break
+			}
+			p.next()
+		}
+	}
+
+	if r := p.next(); r.kind != tokenRParen {
+		return nil, fmt.Errorf("expect ) at %d, got %q", r.pos, r.text)
+	}
+
+	if len(args) != fn.argc {
+		return nil, fmt.Errorf("function %s wants %d arguments, got %d",
+			name.text, fn.argc, len(args))
+	}
+
+	call := &callNode{name: name.text, fn: fn, args: args}
+	if fn.prepare != nil {
+		if err := fn.prepare(call); err != nil {
+			return nil, err
+		}
+	}
+
+	return call, nil
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package gatewaychain signs the claims of a gateway tier about the
+// requests, e.g. the real IP and the authenticated identity of clients,
+// so the downstream tiers of the chain could trust them without
+// re-authenticating the clients.
+package gatewaychain
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The headers carrying the claims and the signature.
+const (
+	HeaderRealIP    = "X-Eg-Chain-Real-Ip"
+	HeaderIdentity  = "X-Eg-Chain-Identity"
+	HeaderTimestamp = "X-Eg-Chain-Timestamp"
+	HeaderSignature = "X-Eg-Chain-Signature"
+
+	defaultTTL = 5 * time.Minute
+)
+
+type (
+	// Spec describes the keys shared by the tiers of the chain.
+	Spec struct {
+		// KeyID is the ID of the key signing the claims.
+		KeyID string `yaml:"keyId" jsonschema:"required"`
+		// Keys are the secrets by IDs, the signatures by any of them are
+		// verified, so the keys could be rotated tier by tier.
+		Keys map[string]string `yaml:"keys" jsonschema:"required"`
+		// IdentityHeader is the header of the authenticated identity,
+		// e.g. the one set by the validation of tokens.
+		IdentityHeader string `yaml:"identityHeader" jsonschema:"omitempty"`
+		// TTL is the maximum difference between the time of signing and
+		// verifying, default is 5m.
+		TTL string `yaml:"ttl" jsonschema:"omitempty,format=duration"`
+	}
+
+	// Claims are the claims of a tier about the request.
+	Claims struct {
+		RealIP   string
+		Identity string
+	}
+
+	// Chain signs and verifies the claims.
+	Chain struct {
+		spec *Spec
+		ttl  time.Duration
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	if _, exists := spec.Keys[spec.KeyID]; !exists {
+		return fmt.Errorf("key %s not found", spec.KeyID)
+	}
+
+	for id, secret := range spec.Keys {
+		if strings.Contains(id, ":") {
+			return fmt.Errorf("key id %s contains ':'", id)
+		}
+		if secret == "" {
+			return fmt.Errorf("secret of key %s is empty", id)
+		}
+	}
+
+	return nil
+}
+
+// New creates a Chain.
+func New(spec *Spec) *Chain {
+	ttl := defaultTTL
+	if spec.TTL != "" {
+		// NOTE: It has been validated by format=duration.
+		ttl, _ = time.ParseDuration(spec.TTL)
+	}
+
+	return &Chain{spec: spec, ttl: ttl}
+}
+
+// IdentityHeader returns the header of the authenticated identity.
+func (c *Chain) IdentityHeader() string {
+	return c.spec.IdentityHeader
+}
+
+// Sign sets the claims and the signature into the header, the
+// signature covers the method and path of the request too.
+func (c *Chain) Sign(h http.Header, method, path string, claims *Claims, now time.Time) {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	h.Set(HeaderRealIP, claims.RealIP)
+	h.Set(HeaderTimestamp, timestamp)
+	if claims.Identity != "" {
+		h.Set(HeaderIdentity, claims.Identity)
+	} else {
+		h.Del(HeaderIdentity)
+	}
+
+	secret := c.spec.Keys[c.spec.KeyID]
+	signature := sign(secret, method, path, claims, timestamp)
+	h.Set(HeaderSignature, c.spec.KeyID+":"+signature)
+}
+
+// Verify verifies the signature in the header, and returns the claims.
+func (c *Chain) Verify(h http.Header, method, path string, now time.Time) (*Claims, error) {
+	value := h.Get(HeaderSignature)
+	if value == "" {
+		return nil, fmt.Errorf("signature not found")
+	}
+
+	i := strings.IndexByte(value, ':')
+	if i < 0 {
+		return nil, fmt.Errorf("invalid signature")
+	}
+	secret, exists := c.spec.Keys[value[:i]]
+	if !exists {
+		return nil, fmt.Errorf("key %s not found", value[:i])
+	}
+
+	timestamp := h.Get(HeaderTimestamp)
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp %s", timestamp)
+	}
+	if d := now.Sub(time.Unix(unix, 0)); d > c.ttl || d < -c.ttl {
+		return nil, fmt.Errorf("signature expired")
+	}
+
+	claims := &Claims{
+		RealIP:   h.Get(HeaderRealIP),
+		Identity: h.Get(HeaderIdentity),
+	}
+
+	expected := sign(secret, method, path, claims, timestamp)
+	if !hmac.Equal([]byte(value[i+1:]), []byte(expected)) {
+		return nil, fmt.Errorf("signature mismatch")
+	}
+
+	return claims, nil
+}
+
+func sign(secret, method, path string, claims *Claims, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	for _, s := range []string{method, path, claims.RealIP, claims.Identity, timestamp} {
+		mac.Write([]byte(s))
+		mac.Write([]byte{'\n'})
+	}
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
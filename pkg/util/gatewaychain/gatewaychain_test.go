@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gatewaychain
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	spec := &Spec{
+		KeyID: "k2",
+		Keys:  map[string]string{"k1": "old-secret", "k2": "new-secret"},
+		TTL:   "1m",
+	}
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+
+	now := time.Now()
+	chain := New(spec)
+	h := http.Header{}
+	chain.Sign(h, http.MethodGet, "/api", &Claims{RealIP: "1.2.3.4", Identity: "alice"}, now)
+
+	claims, err := chain.Verify(h, http.MethodGet, "/api", now.Add(time.Second))
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if claims.RealIP != "1.2.3.4" || claims.Identity != "alice" {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+
+	// the tiers not rotated yet still sign with the old key
+	old := New(&Spec{KeyID: "k1", Keys: map[string]string{"k1": "old-secret"}})
+	oldHeader := http.Header{}
+	old.Sign(oldHeader, http.MethodGet, "/api", &Claims{RealIP: "1.2.3.4"}, now)
+	if _, err := chain.Verify(oldHeader, http.MethodGet, "/api", now); err != nil {
+		t.Errorf("verify signature of old key failed: %v", err)
+	}
+
+	if _, err := chain.Verify(h, http.MethodPost, "/api", now); err == nil {
+		t.Error("signature of another method should fail")
+	}
+	if _, err := chain.Verify(h, http.MethodGet, "/api", now.Add(2*time.Minute)); err == nil {
+		t.Error("expired signature should fail")
+	}
+
+	h.Set(HeaderIdentity, "mallory")
+	if _, err := chain.Verify(h, http.MethodGet, "/api", now); err == nil {
+		t.Error("tampered claims should fail")
+	}
+
+	if _, err := chain.Verify(http.Header{}, http.MethodGet, "/api", now); err == nil {
+		t.Error("missing signature should fail")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if (Spec{KeyID: "k", Keys: map[string]string{"a": "s"}}).Validate() == nil {
+		t.Error("missing signing key should fail")
+	}
+	if (Spec{KeyID: "k", Keys: map[string]string{"k": ""}}).Validate() == nil {
+		t.Error("empty secret should fail")
+	}
+	if (Spec{KeyID: "k:1", Keys: map[string]string{"k:1": "s"}}).Validate() == nil {
+		t.Error("key id with ':' should fail")
+	}
+}
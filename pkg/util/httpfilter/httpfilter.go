@@ -24,6 +24,7 @@ import (
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/expression"
 	"github.com/megaease/easegress/pkg/util/hashtool"
 	"github.com/megaease/easegress/pkg/util/urlrule"
 )
@@ -44,11 +45,13 @@ type (
 		Headers     map[string]*urlrule.StringMatch `yaml:"headers" jsonschema:"omitempty"`
 		URLs        []*urlrule.URLRule              `yaml:"urls" jsonschema:"omitempty"`
 		Probability *Probability                    `yaml:"probability,omitempty" jsonschema:"omitempty"`
+		Expression  string                          `yaml:"expression,omitempty" jsonschema:"omitempty"`
 	}
 
 	// HTTPFilter filters HTTP traffic.
 	HTTPFilter struct {
 		spec *Spec
+		expr *expression.Expression
 	}
 
 	// Probability filters HTTP traffic by probability.
@@ -70,8 +73,14 @@ func (p Probability) Validate() error {
 
 // Validate validates Spec
 func (s Spec) Validate() error {
-	if len(s.Headers) == 0 && s.Probability == nil {
-		return fmt.Errorf("none of headers and probability is specified")
+	if s.Expression != "" {
+		if _, err := expression.Parse(s.Expression); err != nil {
+			return err
+		}
+	}
+
+	if len(s.Headers) == 0 && s.Probability == nil && s.Expression == "" {
+		return fmt.Errorf("none of headers, probability and expression is specified")
 	}
 
 	if len(s.Headers) > 0 && s.Probability != nil {
@@ -95,11 +104,29 @@ func New(spec *Spec) *HTTPFilter {
 		url.Init()
 	}
 
+	if spec.Expression != "" {
+		hf.expr = expression.MustParse(spec.Expression)
+	}
+
 	return hf
 }
 
 // Filter filters HTTPContext.
 func (hf *HTTPFilter) Filter(ctx context.HTTPContext) bool {
+	if hf.expr != nil {
+		ok, err := hf.expr.EvalBool(expression.NewHTTPEnv(ctx))
+		if err != nil {
+			logger.Warnf("evaluate expression %s failed: %v", hf.expr, err)
+			return false
+		}
+		if !ok {
+			return false
+		}
+		if len(hf.spec.Headers) == 0 && hf.spec.Probability == nil {
+			return true
+		}
+	}
+
 	if len(hf.spec.Headers) > 0 {
 		matchHeader := hf.filterHeader(ctx)
 		if matchHeader && len(hf.spec.URLs) > 0 {
@@ -144,9 +171,24 @@ func (hf *HTTPFilter) filterURL(ctx context.HTTPContext) bool {
 	return urlMatch
 }
 
+// FilterPerMill filters HTTPContext by the probability of perMill instead of
+// the spec, the policy of the probability in the spec is used if it exists,
+// otherwise it's random.
+func (hf *HTTPFilter) FilterPerMill(ctx context.HTTPContext, perMill uint32) bool {
+	if hf.spec.Probability == nil {
+		return uint32(rand.Int31n(1000)) < perMill
+	}
+
+	prob := *hf.spec.Probability
+	prob.PerMill = perMill
+	return hf.probability(ctx, &prob)
+}
+
 func (hf *HTTPFilter) filterProbability(ctx context.HTTPContext) bool {
-	prob := hf.spec.Probability
+	return hf.probability(ctx, hf.spec.Probability)
+}
 
+func (hf *HTTPFilter) probability(ctx context.HTTPContext, prob *Probability) bool {
 	var result uint32
 	switch prob.Policy {
 	case policyIPHash:
@@ -40,6 +40,20 @@ type (
 		// NOTE: Set and Add allow empty value.
 		Set map[string]string `yaml:"set" jsonschema:"omitempty"`
 		Add map[string]string `yaml:"add" jsonschema:"omitempty"`
+
+		// NOTE: The prefix operations are applied before Del, Set and Add,
+		// in the order of CopyPrefix, MovePrefix and DelPrefix.
+		CopyPrefix []*PrefixRule `yaml:"copyPrefix" jsonschema:"omitempty"`
+		MovePrefix []*PrefixRule `yaml:"movePrefix" jsonschema:"omitempty"`
+		DelPrefix  []string      `yaml:"delPrefix" jsonschema:"omitempty,uniqueItems=true"`
+	}
+
+	// PrefixRule describes renaming the headers whose names start with From
+	// to the ones start with To, e.g. X-Internal-Id to X-Fwd-Internal-Id
+	// by From X-Internal- and To X-Fwd-Internal-.
+	PrefixRule struct {
+		From string `yaml:"from" jsonschema:"required"`
+		To   string `yaml:"to" jsonschema:"required"`
 	}
 )
 
@@ -165,9 +179,74 @@ func renderTemplate(input string, te texttemplate.TemplateEngine) (output string
 	return
 }
 
+// keysWithPrefix returns the keys starting with prefix case-insensitively.
+func (h *HTTPHeader) keysWithPrefix(prefix string) []string {
+	prefix = strings.ToLower(prefix)
+
+	var keys []string
+	for key := range h.h {
+		if strings.HasPrefix(strings.ToLower(key), prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// renamePrefix copies the headers matching the rule, and deletes
+// the original ones if move is true. The existing values of the
+// new names are replaced.
+func (h *HTTPHeader) renamePrefix(rule *PrefixRule, move bool, te texttemplate.TemplateEngine) {
+	from, to := rule.From, rule.To
+	if newFrom, ok := renderTemplate(from, te); ok {
+		from = newFrom
+	}
+	if newTo, ok := renderTemplate(to, te); ok {
+		to = newTo
+	}
+	if from == "" || strings.EqualFold(from, to) {
+		return
+	}
+
+	// NOTE: Collect the keys before changing them, in case
+	// the new names match the prefix too.
+	keys := h.keysWithPrefix(from)
+	values := make([][]string, len(keys))
+	for i, key := range keys {
+		values[i] = h.h[key]
+		if move {
+			h.Del(key)
+		}
+	}
+
+	for i, key := range keys {
+		newKey := textproto.CanonicalMIMEHeaderKey(to + key[len(from):])
+		h.h[newKey] = append([]string(nil), values[i]...)
+	}
+}
+
 // Adapt adapts HTTPHeader according to AdaptSpec. Using templateEngine if value contain
 // any valid template
 func (h *HTTPHeader) Adapt(as *AdaptSpec, te texttemplate.TemplateEngine) {
+	for _, rule := range as.CopyPrefix {
+		h.renamePrefix(rule, false, te)
+	}
+
+	for _, rule := range as.MovePrefix {
+		h.renamePrefix(rule, true, te)
+	}
+
+	for _, prefix := range as.DelPrefix {
+		if newPrefix, ok := renderTemplate(prefix, te); ok {
+			prefix = newPrefix
+		}
+		if prefix == "" {
+			continue
+		}
+		for _, key := range h.keysWithPrefix(prefix) {
+			h.Del(key)
+		}
+	}
+
 	for _, key := range as.Del {
 		if newKey, ok := renderTemplate(key, te); ok {
 			key = newKey
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpheader
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/util/texttemplate"
+)
+
+func TestAdaptPrefix(t *testing.T) {
+	h := New(http.Header{})
+	h.Add("X-Internal-Id", "1001")
+	h.Add("X-Internal-Trace", "a")
+	h.Add("X-Internal-Trace", "b")
+	h.Add("X-Debug-Level", "3")
+	h.Add("X-Debug-Dump", "true")
+	h.Add("X-Tenant-Id", "t1")
+
+	tt, err := texttemplate.NewDefault([]string{"tenant"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt.SetDict("tenant", "acme")
+
+	h.Adapt(&AdaptSpec{
+		CopyPrefix: []*PrefixRule{{From: "x-tenant-", To: "X-[[tenant]]-"}},
+		MovePrefix: []*PrefixRule{{From: "X-Internal-", To: "X-Fwd-Internal-"}},
+		DelPrefix:  []string{"X-Debug-"},
+	}, tt)
+
+	expected := http.Header{
+		"X-Fwd-Internal-Id":    {"1001"},
+		"X-Fwd-Internal-Trace": {"a", "b"},
+		"X-Tenant-Id":          {"t1"},
+		"X-Acme-Id":            {"t1"},
+	}
+	if len(h.Std()) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, h.Std())
+	}
+	for key, values := range expected {
+		if got := h.GetAll(key); len(got) != len(values) || got[0] != values[0] {
+			t.Errorf("header %s: expected %v, got %v", key, values, got)
+		}
+	}
+}
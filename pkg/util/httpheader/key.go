@@ -24,11 +24,45 @@ const (
 	KeyAcceptEncoding = "Accept-Encoding"
 	// KeyContentEncoding is the key of Content-Encoding.
 	KeyContentEncoding = "Content-Encoding"
+	// KeyContentType is the key of Content-Type.
+	KeyContentType = "Content-Type"
 	// KeyContentLength is the key of Content-Length.
 	KeyContentLength = "Content-Length"
+	// KeyRange is the key of Range.
+	KeyRange = "Range"
+	// KeyIfRange is the key of If-Range.
+	KeyIfRange = "If-Range"
+	// KeyContentRange is the key of Content-Range.
+	KeyContentRange = "Content-Range"
 	// KeyVary is the key of Vary.
 	KeyVary = "Vary"
+	// KeyExpires is the key of Expires.
+	KeyExpires = "Expires"
+	// KeyAge is the key of Age.
+	KeyAge = "Age"
+	// KeyDate is the key of Date.
+	KeyDate = "Date"
+	// KeyETag is the key of ETag.
+	KeyETag = "Etag"
+	// KeyLastModified is the key of Last-Modified.
+	KeyLastModified = "Last-Modified"
+	// KeyIfNoneMatch is the key of If-None-Match.
+	KeyIfNoneMatch = "If-None-Match"
+	// KeyIfModifiedSince is the key of If-Modified-Since.
+	KeyIfModifiedSince = "If-Modified-Since"
+	// KeyConnection is the key of Connection.
+	KeyConnection = "Connection"
+	// KeyUpgrade is the key of Upgrade.
+	KeyUpgrade = "Upgrade"
 
+	// KeyBaggage is the key of W3C Baggage.
+	KeyBaggage = "Baggage"
 	// KeyXForwardedFor is the key of X-Forwarded-For.
 	KeyXForwardedFor = "X-Forwarded-For"
+	// KeyXForwardedProto is the key of X-Forwarded-Proto.
+	KeyXForwardedProto = "X-Forwarded-Proto"
+	// KeyXForwardedHost is the key of X-Forwarded-Host.
+	KeyXForwardedHost = "X-Forwarded-Host"
+	// KeyForwarded is the key of Forwarded.
+	KeyForwarded = "Forwarded"
 )
@@ -57,6 +57,8 @@ type (
 		respSize uint64
 
 		cc *codecounter.CodeCounter
+		// buckets keeps the codes of the last 5 minutes.
+		buckets *codecounter.BucketCounter
 	}
 
 	// Metric is the package of statistics at once.
@@ -99,6 +101,10 @@ type (
 		RespSize uint64 `yaml:"respSize"`
 
 		Codes map[int]uint64 `yaml:"codes"`
+		// M1Codes are the codes in the last minute, and M1Rate5xx is
+		// the per second rate of 5xx in it.
+		M1Codes   map[int]uint64 `yaml:"m1Codes"`
+		M1Rate5xx float64        `yaml:"m1Rate5xx"`
 	}
 )
 
@@ -119,7 +125,8 @@ func New() *HTTPStat {
 
 		durationSampler: sampler.NewDurationSampler(),
 
-		cc: codecounter.New(),
+		cc:      codecounter.New(),
+		buckets: codecounter.NewBuckets(codecounter.DefaultBucketWidth, codecounter.DefaultBucketCount),
 	}
 
 	return hs
@@ -166,6 +173,7 @@ func (hs *HTTPStat) Stat(m *Metric) {
 	hs.respSize += m.RespSize
 
 	hs.cc.Count(m.StatusCode)
+	hs.buckets.Count(m.StatusCode)
 }
 
 // Status returns HTTPStat Status, It assumes it is called every five seconds.
@@ -226,7 +234,9 @@ func (hs *HTTPStat) Status() *Status {
 		ReqSize:  hs.reqSize,
 		RespSize: hs.respSize,
 
-		Codes: hs.cc.Codes(),
+		Codes:     hs.cc.Codes(),
+		M1Codes:   hs.buckets.Codes(time.Minute),
+		M1Rate5xx: hs.buckets.Rate(time.Minute, 500, 599),
 	}
 
 	return status
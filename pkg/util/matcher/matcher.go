@@ -0,0 +1,284 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package matcher holds the named request matchers shared by the routing
+// rules and the pipelines, they are compiled once and referenced by names.
+package matcher
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sync"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/expression"
+	"github.com/megaease/easegress/pkg/util/ipfilter"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+type (
+	// Spec describes the request matcher, a request matches if it
+	// satisfies all the conditions specified.
+	Spec struct {
+		Methods []string `yaml:"methods,omitempty" jsonschema:"omitempty,uniqueItems=true,format=httpmethod-array"`
+		// Paths are the globs of the path, e.g. /api/*/users, the path
+		// matches if it matches any of them.
+		Paths      []string     `yaml:"paths,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+		PathRegexp string       `yaml:"pathRegexp,omitempty" jsonschema:"omitempty,format=regexp"`
+		Headers    []*FieldSpec `yaml:"headers,omitempty" jsonschema:"omitempty"`
+		Query      []*FieldSpec `yaml:"query,omitempty" jsonschema:"omitempty"`
+		// IPs are the IPs or CIDRs of the clients.
+		IPs []string `yaml:"ips,omitempty" jsonschema:"omitempty,uniqueItems=true,format=ipcidr-array"`
+		// Expression is evaluated with the request, it could reference
+		// the templates like the conditions of the pipeline flow.
+		Expression string `yaml:"expression,omitempty" jsonschema:"omitempty"`
+	}
+
+	// FieldSpec describes the predicate of a header or a query parameter.
+	// The field matches if any of its values equals one of Values or
+	// matches Regexp, it only needs to be present if neither is given.
+	FieldSpec struct {
+		Key    string   `yaml:"key" jsonschema:"required"`
+		Values []string `yaml:"values,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+		Regexp string   `yaml:"regexp,omitempty" jsonschema:"omitempty,format=regexp"`
+		// Absent makes the field match only if it's not present.
+		Absent bool `yaml:"absent,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Matcher is the compiled request matcher, it is safe for concurrent use.
+	Matcher struct {
+		spec       *Spec
+		methods    map[string]struct{}
+		pathRegexp *regexp.Regexp
+		headers    []*field
+		query      []*field
+		ips        *ipfilter.IPFilter
+		expression *expression.Expression
+	}
+
+	field struct {
+		spec   *FieldSpec
+		regexp *regexp.Regexp
+	}
+)
+
+var (
+	mutex    sync.Mutex
+	matchers = map[string]*Matcher{}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	_, err := New(&spec)
+	return err
+}
+
+// New creates a Matcher.
+func New(spec *Spec) (*Matcher, error) {
+	m := &Matcher{spec: spec}
+
+	if len(spec.Methods) > 0 {
+		m.methods = make(map[string]struct{}, len(spec.Methods))
+		for _, method := range spec.Methods {
+			m.methods[method] = struct{}{}
+		}
+	}
+
+	for _, p := range spec.Paths {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid path glob %s: %v", p, err)
+		}
+	}
+
+	var err error
+	if spec.PathRegexp != "" {
+		if m.pathRegexp, err = regexp.Compile(spec.PathRegexp); err != nil {
+			return nil, fmt.Errorf("compile pathRegexp failed: %v", err)
+		}
+	}
+
+	if m.headers, err = newFields(spec.Headers); err != nil {
+		return nil, fmt.Errorf("invalid headers: %v", err)
+	}
+	if m.query, err = newFields(spec.Query); err != nil {
+		return nil, fmt.Errorf("invalid query: %v", err)
+	}
+
+	if len(spec.IPs) > 0 {
+		m.ips = ipfilter.New(&ipfilter.Spec{BlockByDefault: true, AllowIPs: spec.IPs})
+	}
+
+	if spec.Expression != "" {
+		if m.expression, err = expression.Parse(spec.Expression); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func newFields(specs []*FieldSpec) ([]*field, error) {
+	fields := make([]*field, 0, len(specs))
+	for _, spec := range specs {
+		f := &field{spec: spec}
+		if spec.Absent && (len(spec.Values) > 0 || spec.Regexp != "") {
+			return nil, fmt.Errorf("%s: absent conflicts with values and regexp", spec.Key)
+		}
+		if spec.Regexp != "" {
+			var err error
+			if f.regexp, err = regexp.Compile(spec.Regexp); err != nil {
+				return nil, fmt.Errorf("%s: compile regexp failed: %v", spec.Key, err)
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func (f *field) match(values []string) bool {
+	if f.spec.Absent {
+		return len(values) == 0
+	}
+	if len(f.spec.Values) == 0 && f.regexp == nil {
+		return len(values) > 0
+	}
+
+	for _, v := range values {
+		if stringtool.StrInSlice(v, f.spec.Values) {
+			return true
+		}
+		if f.regexp != nil && f.regexp.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns whether the request of the context matches. The cheap
+// conditions are checked first, and the expression is the last.
+func (m *Matcher) Match(ctx context.HTTPContext) bool {
+	r := ctx.Request()
+
+	if m.methods != nil {
+		if _, exists := m.methods[r.Method()]; !exists {
+			return false
+		}
+	}
+
+	if !m.matchPath(r.Path()) {
+		return false
+	}
+
+	for _, f := range m.headers {
+		if !f.match(r.Header().GetAll(f.spec.Key)) {
+			return false
+		}
+	}
+
+	if len(m.query) > 0 {
+		query, _ := url.ParseQuery(r.Query())
+		for _, f := range m.query {
+			if !f.match(query[f.spec.Key]) {
+				return false
+			}
+		}
+	}
+
+	if m.ips != nil && !m.ips.AllowHTTPContext(ctx) {
+		return false
+	}
+
+	if m.expression != nil {
+		ok, err := m.expression.EvalBool(expression.NewHTTPEnv(ctx))
+		if err != nil {
+			ctx.AddTag(stringtool.Cat("matcher expression error: ", err.Error()))
+			return false
+		}
+		return ok
+	}
+
+	return true
+}
+
+func (m *Matcher) matchPath(p string) bool {
+	if len(m.spec.Paths) == 0 && m.pathRegexp == nil {
+		return true
+	}
+
+	for _, glob := range m.spec.Paths {
+		// NOTE: The globs have been validated.
+		if ok, _ := path.Match(glob, p); ok {
+			return true
+		}
+	}
+
+	return m.pathRegexp != nil && m.pathRegexp.MatchString(p)
+}
+
+// Set sets the matcher of the name.
+func Set(name string, m *Matcher) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	matchers[name] = m
+}
+
+// Delete deletes the matcher of the name.
+func Delete(name string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	delete(matchers, name)
+}
+
+// Get returns the matcher of the name with the existing flag.
+func Get(name string) (*Matcher, bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	m, exists := matchers[name]
+	return m, exists
+}
+
+// Check checks whether the matcher exists. Like rejection responses,
+// nothing is restricted before any matcher is set, so the references
+// aren't rejected while the objects are being loaded at startup.
+func Check(name string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(matchers) == 0 {
+		return nil
+	}
+	if _, exists := matchers[name]; !exists {
+		return fmt.Errorf("request matcher %s not found", name)
+	}
+	return nil
+}
+
+// Match returns whether the request of the context matches the matcher
+// of the name, it's false if the matcher doesn't exist.
+func Match(ctx context.HTTPContext, name string) bool {
+	m, exists := Get(name)
+	if !exists {
+		return false
+	}
+
+	return m.Match(ctx)
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package matcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+func newContext(method, url string, header map[string]string) context.HTTPContext {
+	req := httptest.NewRequest(method, url, nil)
+	req.RemoteAddr = "192.168.1.10:1234"
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	return context.New(httptest.NewRecorder(), req, tracing.NoopTracing, "")
+}
+
+func TestMatcher(t *testing.T) {
+	m, err := New(&Spec{
+		Methods: []string{http.MethodGet, http.MethodPost},
+		Paths:   []string{"/api/*/users"},
+		Headers: []*FieldSpec{
+			{Key: "X-Tenant", Values: []string{"megaease"}, Regexp: "^test-"},
+			{Key: "X-Debug", Absent: true},
+		},
+		Query:      []*FieldSpec{{Key: "page"}},
+		IPs:        []string{"192.168.1.0/24"},
+		Expression: `req.header.X-Version != "v1"`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := map[string]string{"X-Tenant": "test-1"}
+	cases := []struct {
+		method string
+		url    string
+		header map[string]string
+		want   bool
+	}{
+		{http.MethodGet, "http://example.com/api/v2/users?page=1", header, true},
+		{http.MethodPost, "http://example.com/api/v2/users?page=1", map[string]string{"X-Tenant": "megaease"}, true},
+		{http.MethodPut, "http://example.com/api/v2/users?page=1", header, false},
+		{http.MethodGet, "http://example.com/api/v2/v3/users?page=1", header, false},
+		{http.MethodGet, "http://example.com/api/v2/users?page=1", map[string]string{"X-Tenant": "other"}, false},
+		{http.MethodGet, "http://example.com/api/v2/users?page=1", map[string]string{"X-Tenant": "test-1", "X-Debug": "1"}, false},
+		{http.MethodGet, "http://example.com/api/v2/users", header, false},
+		{http.MethodGet, "http://example.com/api/v2/users?page=1", map[string]string{"X-Tenant": "test-1", "X-Version": "v1"}, false},
+	}
+	for i, c := range cases {
+		if got := m.Match(newContext(c.method, c.url, c.header)); got != c.want {
+			t.Errorf("case %d: want %v, got %v", i, c.want, got)
+		}
+	}
+
+	m, _ = New(&Spec{IPs: []string{"10.0.0.1"}})
+	if m.Match(newContext(http.MethodGet, "http://example.com/", nil)) {
+		t.Errorf("the IP should not match")
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	for _, spec := range []Spec{
+		{Paths: []string{"/api/["}},
+		{PathRegexp: "(["},
+		{Headers: []*FieldSpec{{Key: "X-Tenant", Regexp: "(["}}},
+		{Query: []*FieldSpec{{Key: "page", Values: []string{"1"}, Absent: true}}},
+		{Expression: "req.method =="},
+	} {
+		if spec.Validate() == nil {
+			t.Errorf("spec %+v should be invalid", spec)
+		}
+	}
+
+	if err := (Spec{}).Validate(); err != nil {
+		t.Errorf("empty spec should match all requests: %v", err)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	ctx := newContext(http.MethodGet, "http://example.com/", nil)
+	if err := Check("get"); err != nil {
+		t.Errorf("nothing should be restricted before any matcher is set: %v", err)
+	}
+	if Match(ctx, "get") {
+		t.Errorf("the matcher not existing should not match")
+	}
+
+	m, _ := New(&Spec{Methods: []string{http.MethodGet}})
+	Set("get", m)
+	defer Delete("get")
+
+	if !Match(ctx, "get") {
+		t.Errorf("the request should match")
+	}
+	if Check("post") == nil {
+		t.Errorf("the matcher not existing should be reported")
+	}
+}
@@ -0,0 +1,193 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package memorycache
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cache "github.com/patrickmn/go-cache"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+const (
+	// adaptiveDecay is the weight of the latest response in the moving
+	// averages of the latency and the error rate.
+	adaptiveDecay = 0.2
+	// endpointStatsExpiration is how long the statistics of an endpoint
+	// are kept after its last response.
+	endpointStatsExpiration = 10 * time.Minute
+)
+
+type (
+	// AdaptiveSpec extends the expiration of the entries whose servers
+	// are degraded, i.e. slow or failing, so the stale responses are
+	// served longer rather than hitting the struggling servers.
+	AdaptiveSpec struct {
+		// MaxExpiration is the upper bound of the extended expiration,
+		// while the expiration in Spec is the lower bound.
+		MaxExpiration string `yaml:"maxExpiration" jsonschema:"required,format=duration"`
+		// LatencyThreshold is the average latency beyond which the
+		// endpoint is degraded, latency is ignored if it's empty.
+		LatencyThreshold string `yaml:"latencyThreshold,omitempty" jsonschema:"omitempty,format=duration"`
+		// ErrorRateThreshold is the average error rate in (0, 1] beyond
+		// which the endpoint is degraded, errors are ignored if it's zero.
+		ErrorRateThreshold float64 `yaml:"errorRateThreshold,omitempty" jsonschema:"omitempty,minimum=0,maximum=1"`
+	}
+
+	// AdaptiveStatus is the status of the adaptive expiration.
+	AdaptiveStatus struct {
+		DegradedEndpoints int    `yaml:"degradedEndpoints"`
+		ExtendedStores    uint64 `yaml:"extendedStores"`
+	}
+
+	adaptive struct {
+		spec             *AdaptiveSpec
+		minExpiration    time.Duration
+		maxExpiration    time.Duration
+		latencyThreshold time.Duration
+
+		// stats are the endpointStats keyed by the keys of the entries.
+		stats          *cache.Cache
+		extendedStores uint64
+	}
+
+	endpointStats struct {
+		mutex     sync.Mutex
+		latency   float64
+		errorRate float64
+	}
+)
+
+// Validate validates AdaptiveSpec.
+func (spec AdaptiveSpec) Validate() error {
+	if spec.LatencyThreshold == "" && spec.ErrorRateThreshold == 0 {
+		return fmt.Errorf("latencyThreshold or errorRateThreshold is required")
+	}
+	if spec.ErrorRateThreshold < 0 || spec.ErrorRateThreshold > 1 {
+		return fmt.Errorf("errorRateThreshold must be in [0, 1]")
+	}
+	return nil
+}
+
+func newAdaptive(spec *AdaptiveSpec, expiration time.Duration) *adaptive {
+	a := &adaptive{
+		spec:          spec,
+		minExpiration: expiration,
+		stats:         cache.New(endpointStatsExpiration, endpointStatsExpiration),
+	}
+	// NOTE: They have been validated by format=duration.
+	a.maxExpiration, _ = time.ParseDuration(spec.MaxExpiration)
+	a.latencyThreshold, _ = time.ParseDuration(spec.LatencyThreshold)
+	if a.maxExpiration < a.minExpiration {
+		a.maxExpiration = a.minExpiration
+	}
+	return a
+}
+
+func (a *adaptive) endpoint(key string) *endpointStats {
+	if v, ok := a.stats.Get(key); ok {
+		return v.(*endpointStats)
+	}
+	es := &endpointStats{}
+	if err := a.stats.Add(key, es, cache.DefaultExpiration); err != nil {
+		// NOTE: It has been added by another request.
+		if v, ok := a.stats.Get(key); ok {
+			return v.(*endpointStats)
+		}
+	}
+	return es
+}
+
+func (a *adaptive) observe(key string, latency time.Duration, failed bool) {
+	es := a.endpoint(key)
+	// NOTE: Touch it to keep the statistics of the active endpoints.
+	a.stats.SetDefault(key, es)
+
+	errorValue := 0.0
+	if failed {
+		errorValue = 1
+	}
+
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	es.latency += adaptiveDecay * (float64(latency) - es.latency)
+	es.errorRate += adaptiveDecay * (errorValue - es.errorRate)
+}
+
+// degradation returns how many times the statistics of the endpoint are
+// beyond the thresholds, it's not degraded if it's not greater than 1.
+func (a *adaptive) degradation(es *endpointStats) float64 {
+	es.mutex.Lock()
+	latency, errorRate := es.latency, es.errorRate
+	es.mutex.Unlock()
+
+	factor := 0.0
+	if a.latencyThreshold > 0 {
+		factor = latency / float64(a.latencyThreshold)
+	}
+	if a.spec.ErrorRateThreshold > 0 {
+		if f := errorRate / a.spec.ErrorRateThreshold; f > factor {
+			factor = f
+		}
+	}
+	return factor
+}
+
+// expiration returns the expiration of the entry of the key, which is
+// extended in proportion to the degradation of the endpoint.
+func (a *adaptive) expiration(key string) time.Duration {
+	v, ok := a.stats.Get(key)
+	if !ok {
+		return a.minExpiration
+	}
+
+	factor := a.degradation(v.(*endpointStats))
+	if factor <= 1 {
+		return a.minExpiration
+	}
+
+	atomic.AddUint64(&a.extendedStores, 1)
+	d := time.Duration(float64(a.minExpiration) * factor)
+	if d > a.maxExpiration {
+		d = a.maxExpiration
+	}
+	return d
+}
+
+func (a *adaptive) status() *AdaptiveStatus {
+	s := &AdaptiveStatus{ExtendedStores: atomic.LoadUint64(&a.extendedStores)}
+	for _, item := range a.stats.Items() {
+		if a.degradation(item.Object.(*endpointStats)) > 1 {
+			s.DegradedEndpoints++
+		}
+	}
+	return s
+}
+
+// Observe records the latency and whether the servers failed for the
+// response of the HTTPContext, which adapts the expiration of its entry.
+func (mc *MemoryCache) Observe(ctx context.HTTPContext, latency time.Duration, failed bool) {
+	if mc.adaptive == nil || !mc.matchMethod(ctx.Request().Method()) {
+		return
+	}
+	mc.adaptive.observe(mc.key(ctx), latency, failed)
+}
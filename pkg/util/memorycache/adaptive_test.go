@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package memorycache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveExpiration(t *testing.T) {
+	a := newAdaptive(&AdaptiveSpec{
+		MaxExpiration:      "1m",
+		LatencyThreshold:   "100ms",
+		ErrorRateThreshold: 0.1,
+	}, 10*time.Second)
+
+	if d := a.expiration("unknown"); d != 10*time.Second {
+		t.Errorf("want 10s for unknown endpoint, got %s", d)
+	}
+
+	for i := 0; i < 20; i++ {
+		a.observe("fast", 10*time.Millisecond, false)
+	}
+	if d := a.expiration("fast"); d != 10*time.Second {
+		t.Errorf("want 10s for healthy endpoint, got %s", d)
+	}
+
+	// The moving average of latency converges to 300ms.
+	for i := 0; i < 50; i++ {
+		a.observe("slow", 300*time.Millisecond, false)
+	}
+	if d := a.expiration("slow"); d < 29*time.Second || d > 30*time.Second {
+		t.Errorf("want about 30s for slow endpoint, got %s", d)
+	}
+
+	for i := 0; i < 50; i++ {
+		a.observe("failing", 10*time.Millisecond, true)
+	}
+	if d := a.expiration("failing"); d != time.Minute {
+		t.Errorf("want 1m for failing endpoint, got %s", d)
+	}
+
+	s := a.status()
+	if s.DegradedEndpoints != 2 || s.ExtendedStores != 2 {
+		t.Errorf("unexpected status: %+v", s)
+	}
+}
+
+func TestAdaptiveSpecValidate(t *testing.T) {
+	spec := AdaptiveSpec{MaxExpiration: "1m"}
+	if spec.Validate() == nil {
+		t.Error("spec without thresholds should be invalid")
+	}
+	spec.ErrorRateThreshold = 1.5
+	if spec.Validate() == nil {
+		t.Error("error rate threshold above 1 should be invalid")
+	}
+	spec.ErrorRateThreshold = 0.5
+	if err := spec.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package memorycache
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+const (
+	encodingIdentity = ""
+	encodingGzip     = "gzip"
+	encodingZstd     = "zstd"
+)
+
+var (
+	// NOTE: EncodeAll and DecodeAll are safe for concurrent use.
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+type (
+	cacheEntry struct {
+		statusCode int
+		header     *httpheader.HTTPHeader
+		body       []byte
+
+		// encoding is the encoding of body. The body of an opaque entry
+		// is stored as the response, which is encoded by a coding we
+		// don't support, its header keeps the Content-Encoding.
+		encoding string
+		opaque   bool
+		// gzipped reports whether the original response is in gzip, so
+		// the clients accepting gzip are served in gzip as before.
+		gzipped bool
+		// size is the size of the body without encoding.
+		size int
+		// expires is the time until which the entry is fresh.
+		expires time.Time
+	}
+)
+
+// newCacheEntry creates an entry storing the body compressed by zstd, the
+// body in gzip is decoded before compressing, the entry is opaque if
+// the body is encoded by other codings.
+func newCacheEntry(statusCode int, header *httpheader.HTTPHeader, body []byte) *cacheEntry {
+	entry := &cacheEntry{
+		statusCode: statusCode,
+		header:     header,
+	}
+
+	contentEncoding := strings.TrimSpace(header.Get(httpheader.KeyContentEncoding))
+	switch contentEncoding {
+	case encodingIdentity:
+	case encodingGzip:
+		decoded, err := decodeGzip(body)
+		if err != nil {
+			return newOpaqueEntry(entry, body)
+		}
+		body, entry.gzipped = decoded, true
+	default:
+		return newOpaqueEntry(entry, body)
+	}
+
+	header.Del(httpheader.KeyContentEncoding)
+	header.Del(httpheader.KeyContentLength)
+	header.Add(httpheader.KeyVary, httpheader.KeyAcceptEncoding)
+
+	entry.size = len(body)
+	entry.body, entry.encoding = body, encodingIdentity
+	if compressed := zstdEncoder.EncodeAll(body, nil); len(compressed) < len(body) {
+		entry.body, entry.encoding = compressed, encodingZstd
+	}
+
+	return entry
+}
+
+func newOpaqueEntry(entry *cacheEntry, body []byte) *cacheEntry {
+	entry.body, entry.size, entry.opaque = body, len(body), true
+	entry.encoding = entry.header.Get(httpheader.KeyContentEncoding)
+	return entry
+}
+
+func decodeGzip(body []byte) ([]byte, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	return ioutil.ReadAll(gr)
+}
+
+func encodeGzip(body []byte) ([]byte, error) {
+	buff := bytes.NewBuffer(nil)
+	gw := gzip.NewWriter(buff)
+	if _, err := gw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
+}
+
+// identity returns the body without encoding, it's not for opaque entries.
+func (e *cacheEntry) identity() ([]byte, error) {
+	if e.encoding != encodingZstd {
+		return e.body, nil
+	}
+	return zstdDecoder.DecodeAll(e.body, make([]byte, 0, e.size))
+}
+
+// encode returns the body and its encoding for the client accepting the
+// encodings, the zstd body is served as is if the client accepts zstd.
+func (e *cacheEntry) encode(acceptEncodings []string) (body []byte, encoding string, err error) {
+	if e.opaque {
+		return e.body, e.encoding, nil
+	}
+
+	if e.encoding == encodingZstd && acceptEncoding(acceptEncodings, encodingZstd) {
+		return e.body, encodingZstd, nil
+	}
+
+	identity, err := e.identity()
+	if err != nil {
+		return nil, "", fmt.Errorf("decode zstd failed: %v", err)
+	}
+
+	if e.gzipped && acceptEncoding(acceptEncodings, encodingGzip) {
+		body, err := encodeGzip(identity)
+		if err != nil {
+			return nil, "", fmt.Errorf("encode gzip failed: %v", err)
+		}
+		return body, encodingGzip, nil
+	}
+
+	return identity, encodingIdentity, nil
+}
+
+// acceptEncoding reports whether the values of Accept-Encoding accept the encoding.
+// NOTE: The qvalue is not parsed for performance like the compression of proxy.
+func acceptEncoding(acceptEncodings []string, encoding string) bool {
+	for _, ae := range acceptEncodings {
+		for _, coding := range strings.Split(ae, ",") {
+			if i := strings.IndexByte(coding, ';'); i != -1 {
+				coding = coding[:i]
+			}
+			coding = strings.TrimSpace(coding)
+			if coding == encoding || coding == "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package memorycache
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+func TestCacheEntryEncoding(t *testing.T) {
+	body := []byte(strings.Repeat("easegress ", 1000))
+
+	header := httpheader.New(http.Header{})
+	header.Set(httpheader.KeyContentLength, "10000")
+	entry := newCacheEntry(http.StatusOK, header, body)
+	if entry.encoding != encodingZstd || entry.size != len(body) || len(entry.body) >= len(body) {
+		t.Fatalf("expect body compressed by zstd, got %s %d/%d", entry.encoding, len(entry.body), entry.size)
+	}
+	if entry.header.Get(httpheader.KeyContentLength) != "" {
+		t.Errorf("Content-Length should be removed from cached header")
+	}
+
+	got, encoding, err := entry.encode([]string{"gzip, zstd;q=0.8"})
+	if err != nil || encoding != encodingZstd || !bytes.Equal(got, entry.body) {
+		t.Errorf("expect zstd body served as is, got %s %v", encoding, err)
+	}
+	got, encoding, err = entry.encode([]string{"gzip"})
+	if err != nil || encoding != encodingIdentity || !bytes.Equal(got, body) {
+		t.Errorf("expect identity body for the response not in gzip, got %s %v", encoding, err)
+	}
+
+	gzipped, _ := encodeGzip(body)
+	header = httpheader.New(http.Header{})
+	header.Set(httpheader.KeyContentEncoding, "gzip")
+	entry = newCacheEntry(http.StatusOK, header, gzipped)
+	if entry.encoding != encodingZstd || !entry.gzipped || entry.opaque {
+		t.Fatalf("expect gzip body decoded and compressed by zstd, got %s", entry.encoding)
+	}
+	got, encoding, err = entry.encode([]string{"gzip, deflate"})
+	if err != nil || encoding != encodingGzip {
+		t.Fatalf("expect gzip body, got %s %v", encoding, err)
+	}
+	if decoded, _ := decodeGzip(got); !bytes.Equal(decoded, body) {
+		t.Errorf("gzip body mismatched")
+	}
+	if got, encoding, _ = entry.encode(nil); encoding != encodingIdentity || !bytes.Equal(got, body) {
+		t.Errorf("expect identity body without Accept-Encoding, got %s", encoding)
+	}
+
+	header = httpheader.New(http.Header{})
+	header.Set(httpheader.KeyContentEncoding, "br")
+	entry = newCacheEntry(http.StatusOK, header, body)
+	if !entry.opaque || entry.header.Get(httpheader.KeyContentEncoding) != "br" {
+		t.Fatalf("expect opaque entry for br")
+	}
+	if got, encoding, _ = entry.encode(nil); encoding != "br" || !bytes.Equal(got, body) {
+		t.Errorf("expect opaque body served as is, got %s", encoding)
+	}
+
+	// incompressible body is stored as is
+	entry = newCacheEntry(http.StatusOK, httpheader.New(http.Header{}), []byte("a"))
+	if entry.encoding != encodingIdentity {
+		t.Errorf("expect identity body, got %s", entry.encoding)
+	}
+}
@@ -0,0 +1,217 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package memorycache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+// revalidatedHeaders are the headers of the entry updated by the 304
+// response of the revalidation.
+var revalidatedHeaders = []string{
+	httpheader.KeyCacheControl,
+	httpheader.KeyExpires,
+	httpheader.KeyDate,
+	httpheader.KeyETag,
+	httpheader.KeyLastModified,
+}
+
+// freshness returns the freshness lifetime of the response in its
+// Cache-Control or Expires, s-maxage takes precedence over max-age, and
+// then Expires. It returns false if the response doesn't specify one.
+func freshness(header *httpheader.HTTPHeader, now time.Time) (time.Duration, bool) {
+	var maxAge, sMaxAge string
+	for _, value := range header.GetAll(httpheader.KeyCacheControl) {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg := directive, ""
+			if i := strings.Index(directive, "="); i >= 0 {
+				name, arg = directive[:i], strings.Trim(strings.TrimSpace(directive[i+1:]), `"`)
+			}
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "max-age":
+				maxAge = arg
+			case "s-maxage":
+				sMaxAge = arg
+			}
+		}
+	}
+
+	var lifetime time.Duration
+	if seconds, err := strconv.ParseInt(sMaxAge, 10, 64); err == nil {
+		lifetime = time.Duration(seconds) * time.Second
+	} else if seconds, err := strconv.ParseInt(maxAge, 10, 64); err == nil {
+		lifetime = time.Duration(seconds) * time.Second
+	} else if expires := header.Get(httpheader.KeyExpires); expires != "" {
+		// NOTE: The invalid Expires, e.g. 0, means already expired.
+		expiresAt, err := http.ParseTime(expires)
+		if err != nil {
+			return 0, true
+		}
+		date, err := http.ParseTime(header.Get(httpheader.KeyDate))
+		if err != nil {
+			date = now
+		}
+		lifetime = expiresAt.Sub(date)
+	} else {
+		return 0, false
+	}
+
+	if age, err := strconv.ParseInt(header.Get(httpheader.KeyAge), 10, 64); err == nil {
+		lifetime -= time.Duration(age) * time.Second
+	}
+	if lifetime < 0 {
+		lifetime = 0
+	}
+	return lifetime, true
+}
+
+// hasConditions reports whether the request is conditional by itself.
+func hasConditions(r context.HTTPRequest) bool {
+	return r.Header().Get(httpheader.KeyIfNoneMatch) != "" ||
+		r.Header().Get(httpheader.KeyIfModifiedSince) != ""
+}
+
+// notModified reports whether the entry satisfies the conditions of the
+// request, so 304 is responded instead, If-None-Match takes precedence
+// over If-Modified-Since.
+func notModified(r context.HTTPRequest, entry *cacheEntry) bool {
+	if entry.statusCode != http.StatusOK {
+		return false
+	}
+
+	if values := r.Header().GetAll(httpheader.KeyIfNoneMatch); len(values) > 0 {
+		etag := entry.header.Get(httpheader.KeyETag)
+		if etag == "" {
+			return false
+		}
+		for _, value := range values {
+			for _, tag := range strings.Split(value, ",") {
+				tag = strings.TrimSpace(tag)
+				if tag == "*" || weakETag(tag) == weakETag(etag) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header().Get(httpheader.KeyIfModifiedSince))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(entry.header.Get(httpheader.KeyLastModified))
+	return err == nil && !modified.After(since)
+}
+
+// weakETag returns the opaque tag of the ETag, since If-None-Match uses
+// the weak comparison.
+func weakETag(etag string) string {
+	return strings.TrimPrefix(etag, "W/")
+}
+
+// validated reports whether the entry could be revalidated.
+func (e *cacheEntry) validated() bool {
+	return e.header.Get(httpheader.KeyETag) != "" || e.header.Get(httpheader.KeyLastModified) != ""
+}
+
+// fresh reports whether the entry could be served without revalidation.
+func (e *cacheEntry) fresh(now time.Time) bool {
+	return now.Before(e.expires)
+}
+
+// revalidated returns a copy of the entry whose headers are updated by
+// the 304 response.
+func (e *cacheEntry) revalidated(header *httpheader.HTTPHeader) *cacheEntry {
+	entry := *e
+	entry.header = e.header.Copy()
+	for _, key := range revalidatedHeaders {
+		if values := header.GetAll(key); len(values) > 0 {
+			entry.header.Del(key)
+			for _, value := range values {
+				entry.header.Add(key, value)
+			}
+		}
+	}
+	return &entry
+}
+
+// ConditionalHeader returns the conditional headers to revalidate the
+// stale entry of the request, it returns nil if there is no such entry or
+// the request is conditional by itself.
+func (mc *MemoryCache) ConditionalHeader(ctx context.HTTPContext) http.Header {
+	r := ctx.Request()
+	if mc.revalidation == 0 || !mc.matchMethod(r.Method()) || hasConditions(r) {
+		return nil
+	}
+
+	v, ok := mc.cache.Get(mc.entryKey(ctx))
+	if !ok {
+		return nil
+	}
+	entry := v.(*cacheEntry)
+	if entry.fresh(time.Now()) {
+		return nil
+	}
+
+	header := http.Header{}
+	if etag := entry.header.Get(httpheader.KeyETag); etag != "" {
+		header.Set(httpheader.KeyIfNoneMatch, etag)
+	}
+	if lastModified := entry.header.Get(httpheader.KeyLastModified); lastModified != "" {
+		header.Set(httpheader.KeyIfModifiedSince, lastModified)
+	}
+	return header
+}
+
+// refresh refreshes the stale entry revalidated by the 304 response of
+// the server, and serves the entry to the client.
+func (mc *MemoryCache) refresh(ctx context.HTTPContext) {
+	r, w := ctx.Request(), ctx.Response()
+
+	// NOTE: The 304 response is for the client if it's conditional.
+	if mc.revalidation == 0 || hasConditions(r) {
+		return
+	}
+
+	key := mc.key(ctx)
+	entryKey := mc.entryKey(ctx)
+	v, ok := mc.cache.Get(entryKey)
+	if !ok {
+		return
+	}
+
+	// NOTE: The entry is served even if it's not stored again, since
+	// it has been validated.
+	entry := v.(*cacheEntry).revalidated(w.Header())
+	if _, expiration, ok := mc.setFresh(key, entryKey, entry); ok {
+		if vary, ok := mc.varies.Get(key); ok {
+			mc.setVary(key, vary.([]string), expiration)
+		}
+	}
+
+	w.Header().Reset(http.Header{})
+	if mc.serve(ctx, entryKey, entry) {
+		ctx.AddTag("cacheRevalidated")
+	}
+}
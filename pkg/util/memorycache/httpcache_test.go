@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package memorycache
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+func TestFreshness(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		header   http.Header
+		lifetime time.Duration
+		ok       bool
+	}{
+		{http.Header{}, 0, false},
+		{http.Header{"Cache-Control": {"public, max-age=60"}}, time.Minute, true},
+		{http.Header{"Cache-Control": {"max-age=60, s-maxage=10"}}, 10 * time.Second, true},
+		{http.Header{"Cache-Control": {"max-age=60"}, "Age": {"20"}}, 40 * time.Second, true},
+		{http.Header{"Cache-Control": {"max-age=60"}, "Age": {"100"}}, 0, true},
+		{http.Header{
+			"Date":    {now.UTC().Format(http.TimeFormat)},
+			"Expires": {now.Add(time.Hour).UTC().Format(http.TimeFormat)},
+		}, time.Hour, true},
+		{http.Header{"Expires": {"0"}}, 0, true},
+	}
+
+	for _, c := range cases {
+		lifetime, ok := freshness(httpheader.New(c.header), now)
+		if lifetime != c.lifetime || ok != c.ok {
+			t.Errorf("%v: want %s %v, got %s %v", c.header, c.lifetime, c.ok, lifetime, ok)
+		}
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	entry := newCacheEntry(http.StatusOK, httpheader.New(http.Header{
+		"Etag":          {`W/"v1"`},
+		"Last-Modified": {"Mon, 02 Jan 2006 15:04:05 GMT"},
+	}), []byte("body"))
+
+	cases := []struct {
+		header      http.Header
+		notModified bool
+	}{
+		{http.Header{}, false},
+		{http.Header{"If-None-Match": {`"v0", "v1"`}}, true},
+		{http.Header{"If-None-Match": {"*"}}, true},
+		{http.Header{"If-None-Match": {`"v2"`}, "If-Modified-Since": {"Mon, 02 Jan 2006 15:04:05 GMT"}}, false},
+		{http.Header{"If-Modified-Since": {"Mon, 02 Jan 2006 15:04:05 GMT"}}, true},
+		{http.Header{"If-Modified-Since": {"Sun, 01 Jan 2006 15:04:05 GMT"}}, false},
+	}
+	for _, c := range cases {
+		ctx := newKeyTestContext(http.MethodGet, "/", "", c.header)
+		if got := notModified(ctx.Request(), entry); got != c.notModified {
+			t.Errorf("%v: want %v, got %v", c.header, c.notModified, got)
+		}
+	}
+}
+
+func TestRevalidation(t *testing.T) {
+	mc := New(&Spec{
+		Expiration:    "1m",
+		MaxEntryBytes: 1024,
+		Codes:         []int{http.StatusOK},
+		Methods:       []string{http.MethodGet},
+		Revalidation:  "1m",
+	})
+
+	respond := func(code int, header http.Header, body string) (*httpheader.HTTPHeader, *string) {
+		ctx := newKeyTestContext(http.MethodGet, "/api", "", http.Header{})
+		respHeader := httpheader.New(header)
+		var got string
+		ctx.MockedResponse.MockedStatusCode = func() int { return code }
+		ctx.MockedResponse.MockedSetStatusCode = func(c int) { code = c }
+		ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader { return respHeader }
+		ctx.MockedResponse.MockedOnFlushBody = func(fn func(body []byte, complete bool) []byte) {
+			fn([]byte(body), true)
+		}
+		ctx.MockedResponse.MockedSetBody = func(r io.Reader) {
+			data, _ := io.ReadAll(r)
+			got = string(data)
+		}
+		mc.Store(ctx)
+		return respHeader, &got
+	}
+	load := func(header http.Header) (int, bool) {
+		ctx := newKeyTestContext(http.MethodGet, "/api", "", header)
+		code := 0
+		ctx.MockedResponse.MockedSetStatusCode = func(c int) { code = c }
+		ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader {
+			return httpheader.New(http.Header{})
+		}
+		return code, mc.Load(ctx)
+	}
+
+	respond(http.StatusOK, http.Header{"Cache-Control": {"max-age=0"}, "Etag": {`"v1"`}}, "body")
+	if _, loaded := load(http.Header{}); loaded {
+		t.Errorf("the stale entry should not be loaded")
+	}
+
+	ctx := newKeyTestContext(http.MethodGet, "/api", "", http.Header{})
+	conditions := mc.ConditionalHeader(ctx)
+	if conditions.Get(httpheader.KeyIfNoneMatch) != `"v1"` {
+		t.Fatalf("want If-None-Match of the stale entry, got %v", conditions)
+	}
+	ctx = newKeyTestContext(http.MethodGet, "/api", "", http.Header{"If-None-Match": {`"v0"`}})
+	if mc.ConditionalHeader(ctx) != nil {
+		t.Errorf("the conditional requests of clients should be sent as is")
+	}
+
+	header, body := respond(http.StatusNotModified, http.Header{"Cache-Control": {"max-age=60"}}, "")
+	if *body != "body" || header.Get(httpheader.KeyETag) != `"v1"` {
+		t.Errorf("want the revalidated entry served, got %q %v", *body, header.Std())
+	}
+	if _, loaded := load(http.Header{}); !loaded {
+		t.Errorf("the revalidated entry should be fresh")
+	}
+	if code, loaded := load(http.Header{"If-None-Match": {`"v1"`}}); !loaded || code != http.StatusNotModified {
+		t.Errorf("want 304 for the matched conditional request, got %d", code)
+	}
+
+	respond(http.StatusOK, http.Header{"Cache-Control": {"private, max-age=60"}}, "private")
+	if s := mc.Status(); s.Entries != 1 {
+		t.Errorf("the private response should not be stored")
+	}
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package memorycache
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+	"github.com/megaease/easegress/pkg/util/texttemplate"
+)
+
+const (
+	// keyHeaderPrefix and keyQueryPrefix are the prefixes of the tags of
+	// the key for the request headers and query parameters, e.g.
+	// [[header.X-Tenant]] and [[query.lang]].
+	keyHeaderPrefix = "header."
+	keyQueryPrefix  = "query."
+)
+
+type (
+	// keySegment is a literal of the key, or a tag if value is set.
+	keySegment struct {
+		literal string
+		value   func(r context.HTTPRequest) string
+	}
+)
+
+var keyTags = map[string]func(r context.HTTPRequest) string{
+	"method": func(r context.HTTPRequest) string { return r.Method() },
+	"scheme": func(r context.HTTPRequest) string { return r.Scheme() },
+	"host":   func(r context.HTTPRequest) string { return r.Host() },
+	"path":   func(r context.HTTPRequest) string { return r.Path() },
+	"query":  func(r context.HTTPRequest) string { return r.Query() },
+}
+
+// compileKey splits the key into the literals and the tags, the tags are
+// in the default tokens of texttemplate, e.g. [[method]] [[path]].
+func compileKey(key string) ([]keySegment, error) {
+	var segments []keySegment
+	begin, end := texttemplate.DefaultBeginToken, texttemplate.DefaultEndToken
+	for key != "" {
+		i := strings.Index(key, begin)
+		if i < 0 {
+			segments = append(segments, keySegment{literal: key})
+			break
+		}
+		if i > 0 {
+			segments = append(segments, keySegment{literal: key[:i]})
+		}
+		key = key[i+len(begin):]
+
+		j := strings.Index(key, end)
+		if j < 0 {
+			return nil, fmt.Errorf("unterminated tag in key")
+		}
+		tag := key[:j]
+		key = key[j+len(end):]
+
+		value, err := keyTagValue(tag)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, keySegment{value: value})
+	}
+	return segments, nil
+}
+
+func keyTagValue(tag string) (func(r context.HTTPRequest) string, error) {
+	if value, exists := keyTags[tag]; exists {
+		return value, nil
+	}
+
+	if strings.HasPrefix(tag, keyHeaderPrefix) && len(tag) > len(keyHeaderPrefix) {
+		name := tag[len(keyHeaderPrefix):]
+		return func(r context.HTTPRequest) string {
+			return strings.Join(r.Header().GetAll(name), ",")
+		}, nil
+	}
+
+	if strings.HasPrefix(tag, keyQueryPrefix) && len(tag) > len(keyQueryPrefix) {
+		name := tag[len(keyQueryPrefix):]
+		return func(r context.HTTPRequest) string {
+			// NOTE: The invalid pairs are skipped.
+			query, _ := url.ParseQuery(r.Query())
+			return strings.Join(query[name], ",")
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown tag %s in key", tag)
+}
+
+func renderKey(segments []keySegment, r context.HTTPRequest) string {
+	var b strings.Builder
+	for _, s := range segments {
+		if s.value == nil {
+			b.WriteString(s.literal)
+		} else {
+			b.WriteString(s.value(r))
+		}
+	}
+	return b.String()
+}
+
+// parseVary returns the sorted names of the request headers the response
+// varies by, it returns false if the response varies by anything, i.e. *.
+func parseVary(values []string) ([]string, bool) {
+	var names []string
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil, false
+			}
+			if name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+
+	unique := names[:0]
+	for i, name := range names {
+		if i == 0 || name != names[i-1] {
+			unique = append(unique, name)
+		}
+	}
+	return unique, true
+}
+
+// withoutAcceptEncoding removes Accept-Encoding from the names, since the
+// encodings of the entries not opaque are negotiated by the cache.
+func withoutAcceptEncoding(names []string) []string {
+	var result []string
+	for _, name := range names {
+		if name != httpheader.KeyAcceptEncoding {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// variantKey returns the key of the variant of the request, which is the
+// key with the values of the headers the responses vary by.
+func variantKey(key string, vary []string, r context.HTTPRequest) string {
+	var b strings.Builder
+	b.WriteString(key)
+	for _, name := range vary {
+		b.WriteString("\n")
+		b.WriteString(name)
+		b.WriteString(": ")
+		b.WriteString(strings.Join(r.Header().GetAll(name), ","))
+	}
+	return b.String()
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package memorycache
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+func newKeyTestContext(method, path, query string, reqHeader http.Header) *contexttest.MockedHTTPContext {
+	ctx := &contexttest.MockedHTTPContext{}
+	ctx.MockedRequest.MockedMethod = func() string { return method }
+	ctx.MockedRequest.MockedScheme = func() string { return "http" }
+	ctx.MockedRequest.MockedHost = func() string { return "example.com" }
+	ctx.MockedRequest.MockedPath = func() string { return path }
+	ctx.MockedRequest.MockedQuery = func() string { return query }
+	ctx.MockedRequest.MockedHeader = func() *httpheader.HTTPHeader {
+		return httpheader.New(reqHeader)
+	}
+	return ctx
+}
+
+func TestKey(t *testing.T) {
+	for _, key := range []string{"[[method", "[[unknown]]", "[[header.]]", "[[query.]]"} {
+		if (Spec{Key: key}).Validate() == nil {
+			t.Errorf("key %q should be invalid", key)
+		}
+	}
+
+	mc := New(&Spec{
+		Key:           "[[method]] [[path]] [[query.lang]] [[header.x-tenant]]",
+		Expiration:    "1m",
+		MaxEntryBytes: 1024,
+	})
+	ctx := newKeyTestContext(http.MethodGet, "/api", "lang=en&page=2",
+		http.Header{"X-Tenant": {"megaease"}})
+	if got, want := mc.key(ctx), "GET /api en megaease"; got != want {
+		t.Errorf("want key %q, got %q", want, got)
+	}
+
+	mc = New(&Spec{Expiration: "1m", MaxEntryBytes: 1024})
+	if got, want := mc.key(ctx), "httpexample.com/apiGET"; got != want {
+		t.Errorf("want default key %q, got %q", want, got)
+	}
+}
+
+func TestVary(t *testing.T) {
+	if _, ok := parseVary([]string{"Accept-Language, *"}); ok {
+		t.Errorf("vary * should not be cached")
+	}
+	if vary, _ := parseVary([]string{"x-tenant, accept-language", "X-Tenant"}); len(vary) != 2 ||
+		vary[0] != "Accept-Language" || vary[1] != "X-Tenant" {
+		t.Errorf("unexpected vary: %v", vary)
+	}
+
+	mc := New(&Spec{
+		Expiration:    "1m",
+		MaxEntryBytes: 1024,
+		Codes:         []int{http.StatusOK},
+		Methods:       []string{http.MethodGet},
+	})
+
+	store := func(tenant, body string) {
+		ctx := newKeyTestContext(http.MethodGet, "/api", "", http.Header{"X-Tenant": {tenant}})
+		ctx.MockedResponse.MockedStatusCode = func() int { return http.StatusOK }
+		ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader {
+			return httpheader.New(http.Header{"Vary": {"X-Tenant, Accept-Encoding"}})
+		}
+		ctx.MockedResponse.MockedOnFlushBody = func(fn func(body []byte, complete bool) []byte) {
+			fn([]byte(body), true)
+		}
+		mc.Store(ctx)
+	}
+	load := func(tenant string) string {
+		ctx := newKeyTestContext(http.MethodGet, "/api", "", http.Header{"X-Tenant": {tenant}})
+		header := httpheader.New(http.Header{})
+		ctx.MockedResponse.MockedHeader = func() *httpheader.HTTPHeader { return header }
+		var body string
+		ctx.MockedResponse.MockedSetBody = func(r io.Reader) {
+			data, _ := io.ReadAll(r)
+			body = string(data)
+		}
+		if !mc.Load(ctx) {
+			return ""
+		}
+		return body
+	}
+
+	store("a", "body of a")
+	store("b", "body of b")
+	if got := load("a"); got != "body of a" {
+		t.Errorf("want body of a, got %q", got)
+	}
+	if got := load("b"); got != "body of b" {
+		t.Errorf("want body of b, got %q", got)
+	}
+	if got := load("c"); got != "" {
+		t.Errorf("want no entry for c, got %q", got)
+	}
+	if s := mc.Status(); s.Entries != 2 {
+		t.Errorf("want 2 variants, got %d", s.Entries)
+	}
+}
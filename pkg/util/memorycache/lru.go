@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package memorycache
+
+import (
+	"container/list"
+	"sync"
+)
+
+type (
+	// lru tracks the recency and the sizes of the entries of the cache,
+	// to evict the least recently used ones beyond the bounds.
+	lru struct {
+		maxEntries int
+		maxBytes   uint64
+
+		mutex     sync.Mutex
+		list      *list.List // front is the most recently used
+		elements  map[string]*list.Element
+		bytes     uint64
+		evictions uint64
+	}
+
+	lruItem struct {
+		key  string
+		size uint64
+	}
+)
+
+func newLRU(maxEntries uint32, maxBytes uint64) *lru {
+	return &lru{
+		maxEntries: int(maxEntries),
+		maxBytes:   maxBytes,
+		list:       list.New(),
+		elements:   make(map[string]*list.Element),
+	}
+}
+
+// fits reports whether an entry of the size could be stored.
+func (l *lru) fits(size uint64) bool {
+	return l.maxBytes == 0 || size <= l.maxBytes
+}
+
+// add adds or updates the entry as the most recently used, and returns
+// the keys of the entries evicted to keep the bounds.
+func (l *lru) add(key string, size uint64) []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if e, exists := l.elements[key]; exists {
+		item := e.Value.(*lruItem)
+		l.bytes = l.bytes - item.size + size
+		item.size = size
+		l.list.MoveToFront(e)
+	} else {
+		l.elements[key] = l.list.PushFront(&lruItem{key: key, size: size})
+		l.bytes += size
+	}
+
+	var evicted []string
+	for l.exceeded() {
+		item := l.list.Back().Value.(*lruItem)
+		l.removeItem(item.key)
+		l.evictions++
+		evicted = append(evicted, item.key)
+	}
+	return evicted
+}
+
+func (l *lru) exceeded() bool {
+	return l.maxEntries > 0 && l.list.Len() > l.maxEntries ||
+		l.maxBytes > 0 && l.bytes > l.maxBytes
+}
+
+// touch marks the entry as the most recently used.
+func (l *lru) touch(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if e, exists := l.elements[key]; exists {
+		l.list.MoveToFront(e)
+	}
+}
+
+// remove removes the entry deleted or expired from the cache.
+func (l *lru) remove(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.removeItem(key)
+}
+
+func (l *lru) removeItem(key string) {
+	e, exists := l.elements[key]
+	if !exists {
+		return
+	}
+	l.list.Remove(e)
+	delete(l.elements, key)
+	l.bytes -= e.Value.(*lruItem).size
+}
+
+func (l *lru) status() (bytes uint64, evictions uint64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.bytes, l.evictions
+}
+
+// memorySize returns the approximate size of the entry in memory,
+// including its key and header.
+func (e *cacheEntry) memorySize(key string) uint64 {
+	size := len(key) + len(e.body)
+	for k, values := range e.header.Std() {
+		size += len(k)
+		for _, v := range values {
+			size += len(v)
+		}
+	}
+	return uint64(size)
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package memorycache
+
+import (
+	"net/http"
+	"testing"
+
+	cache "github.com/patrickmn/go-cache"
+
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+func TestLRU(t *testing.T) {
+	mc := New(&Spec{Expiration: "1m", MaxEntryBytes: 1024, MaxEntries: 2})
+	newEntry := func(body string) *cacheEntry {
+		return newCacheEntry(http.StatusOK, httpheader.New(http.Header{}), []byte(body))
+	}
+
+	a := newEntry("a")
+	mc.set("a", a, cache.DefaultExpiration)
+	mc.set("b", newEntry("b"), cache.DefaultExpiration)
+	mc.lru.touch("a")
+	mc.set("c", newEntry("c"), cache.DefaultExpiration)
+	if _, ok := mc.cache.Get("b"); ok {
+		t.Errorf("the least recently used entry should be evicted")
+	}
+	if _, ok := mc.cache.Get("a"); !ok {
+		t.Errorf("the recently used entry should be kept")
+	}
+	if s := mc.Status(); s.Entries != 2 || s.Evictions != 1 || s.MemoryBytes != 2*a.memorySize("a") {
+		t.Errorf("unexpected status: %+v", s)
+	}
+
+	mc.cache.Delete("a")
+	if s := mc.Status(); s.Entries != 1 || s.MemoryBytes != a.memorySize("a") {
+		t.Errorf("the deleted entry should be removed from the lru: %+v", s)
+	}
+
+	b := newEntry("012")
+	mc = New(&Spec{Expiration: "1m", MaxEntryBytes: 1024, MaxBytes: a.memorySize("a") + b.memorySize("b")})
+	if mc.set("large", newEntry("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"), cache.DefaultExpiration) {
+		t.Errorf("the entry larger than maxBytes should not be stored")
+	}
+	mc.set("a", a, cache.DefaultExpiration)
+	mc.set("b", b, cache.DefaultExpiration)
+	if s := mc.Status(); s.Entries != 2 || s.Evictions != 0 {
+		t.Errorf("unexpected status: %+v", s)
+	}
+	mc.set("a", newEntry("01"), cache.DefaultExpiration)
+	if _, ok := mc.cache.Get("b"); ok {
+		t.Errorf("the entries beyond maxBytes should be evicted")
+	}
+	if s := mc.Status(); s.Entries != 1 || s.Evictions != 1 || s.MemoryBytes != newEntry("01").memorySize("a") {
+		t.Errorf("unexpected status: %+v", s)
+	}
+
+	mc = New(&Spec{Expiration: "1m", MaxEntryBytes: 1024})
+	if mc.lru != nil || !mc.set("a", newEntry("a"), cache.DefaultExpiration) {
+		t.Errorf("the cache should be unbounded by default")
+	}
+}
@@ -19,6 +19,8 @@ package memorycache
 
 import (
 	"bytes"
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -41,23 +43,64 @@ type (
 		spec *Spec
 
 		cache *cache.Cache
+		// varies are the names of the request headers the responses
+		// of the keys vary by.
+		varies      *cache.Cache
+		keyTemplate []keySegment
+		expiration  time.Duration
+		// revalidation is how long the stale entries are kept for the
+		// conditional revalidation, 0 means they're removed when stale.
+		revalidation time.Duration
+		adaptive     *adaptive
+		// lru is nil if the cache is unbounded.
+		lru *lru
 	}
 
 	// Spec describes the MemoryCache.
 	Spec struct {
+		// Key is the template of the cache key, e.g. [[method]] [[path]]
+		// [[header.X-Tenant]], default is the scheme, host, path and method.
+		Key           string   `yaml:"key,omitempty" jsonschema:"omitempty"`
 		Expiration    string   `yaml:"expiration" jsonschema:"required,format=duration"`
 		MaxEntryBytes uint32   `yaml:"maxEntryBytes" jsonschema:"required,minimum=1"`
 		Codes         []int    `yaml:"codes" jsonschema:"required,minItems=1,uniqueItems=true,format=httpcode-array"`
 		Methods       []string `yaml:"methods" jsonschema:"required,minItems=1,uniqueItems=true,format=httpmethod-array"`
+		RangeMode     string   `yaml:"rangeMode" jsonschema:"omitempty,enum=,enum=bypass,enum=slice,enum=coalesce"`
+		// Adaptive extends the expiration for the degraded servers.
+		Adaptive *AdaptiveSpec `yaml:"adaptive,omitempty" jsonschema:"omitempty"`
+		// Revalidation keeps the stale entries with ETag or Last-Modified
+		// for the duration, to be revalidated by conditional requests.
+		Revalidation string `yaml:"revalidation,omitempty" jsonschema:"omitempty,format=duration"`
+		// MaxEntries and MaxBytes bound the cache, the least recently
+		// used entries are evicted beyond them, 0 means unbounded.
+		MaxEntries uint32 `yaml:"maxEntries,omitempty" jsonschema:"omitempty"`
+		MaxBytes   uint64 `yaml:"maxBytes,omitempty" jsonschema:"omitempty"`
 	}
 
-	cacheEntry struct {
-		statusCode int
-		header     *httpheader.HTTPHeader
-		body       []byte
+	// Status is the status of MemoryCache.
+	Status struct {
+		Entries int `yaml:"entries"`
+		// StoredBytes is the size of the bodies in memory, which are
+		// compressed, and LogicalBytes is the size of them decoded.
+		StoredBytes  uint64 `yaml:"storedBytes"`
+		LogicalBytes uint64 `yaml:"logicalBytes"`
+
+		// MemoryBytes is the approximate size of the entries in memory
+		// accounted for MaxBytes, and Evictions is the number of the
+		// entries evicted, they're reported only if the cache is bounded.
+		MemoryBytes uint64 `yaml:"memoryBytes,omitempty"`
+		Evictions   uint64 `yaml:"evictions,omitempty"`
+
+		Adaptive *AdaptiveStatus `yaml:"adaptive,omitempty"`
 	}
 )
 
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	_, err := compileKey(spec.Key)
+	return err
+}
+
 // New creates a MemoryCache.
 func New(spec *Spec) *MemoryCache {
 	expiration, err := time.ParseDuration(spec.Expiration)
@@ -66,21 +109,80 @@ func New(spec *Spec) *MemoryCache {
 		expiration = 10 * time.Second
 	}
 
+	var revalidation time.Duration
+	if spec.Revalidation != "" {
+		revalidation, err = time.ParseDuration(spec.Revalidation)
+		if err != nil {
+			logger.Errorf("BUG: parse duration %s failed: %v", spec.Revalidation, err)
+		}
+	}
+
+	mc := &MemoryCache{
+		spec:         spec,
+		expiration:   expiration,
+		revalidation: revalidation,
+	}
+
+	if spec.Adaptive != nil {
+		mc.adaptive = newAdaptive(spec.Adaptive, expiration)
+		// NOTE: The cleanup is for the longest entries.
+		expiration = mc.adaptive.maxExpiration
+	}
+
 	cleanupInterval := expiration * cleanupIntervalFactor
 	if cleanupInterval < cleanupIntervalMin {
 		cleanupInterval = cleanupIntervalMin
 	}
-	cache := cache.New(expiration, cleanupInterval)
+	mc.cache = cache.New(expiration, cleanupInterval)
+	mc.varies = cache.New(expiration, cleanupInterval)
+
+	mc.keyTemplate, err = compileKey(spec.Key)
+	if err != nil {
+		logger.Errorf("BUG: compile key %s failed: %v", spec.Key, err)
+	}
 
-	return &MemoryCache{
-		spec:  spec,
-		cache: cache,
+	if spec.MaxEntries > 0 || spec.MaxBytes > 0 {
+		mc.lru = newLRU(spec.MaxEntries, spec.MaxBytes)
+		mc.cache.OnEvicted(func(key string, _ interface{}) {
+			mc.lru.remove(key)
+		})
 	}
+
+	return mc
 }
 
 func (mc *MemoryCache) key(ctx context.HTTPContext) string {
 	r := ctx.Request()
-	return stringtool.Cat(r.Scheme(), r.Host(), r.Path(), r.Method())
+	if mc.keyTemplate == nil {
+		return stringtool.Cat(r.Scheme(), r.Host(), r.Path(), r.Method())
+	}
+	return renderKey(mc.keyTemplate, r)
+}
+
+// entryKey returns the key of the entry of the request, it's the key of
+// the variant if the responses vary by the request headers.
+func (mc *MemoryCache) entryKey(ctx context.HTTPContext) string {
+	key := mc.key(ctx)
+	if vary, ok := mc.varies.Get(key); ok {
+		return variantKey(key, vary.([]string), ctx.Request())
+	}
+	return key
+}
+
+func (mc *MemoryCache) matchMethod(method string) bool {
+	for _, m := range mc.spec.Methods {
+		if method == m {
+			return true
+		}
+	}
+	return false
+}
+
+func (mc *MemoryCache) rangeMode() string {
+	if mc.spec.RangeMode == "" {
+		return RangeModeBypass
+	}
+	return mc.spec.RangeMode
 }
 
 // Load tries to load cache for HTTPContext.
@@ -88,14 +190,11 @@ func (mc *MemoryCache) Load(ctx context.HTTPContext) (loaded bool) {
 	// Reference: https://tools.ietf.org/html/rfc7234#section-5.2
 	r, w := ctx.Request(), ctx.Response()
 
-	matchMethod := false
-	for _, method := range mc.spec.Methods {
-		if r.Method() == method {
-			matchMethod = true
-			break
-		}
+	if !mc.matchMethod(r.Method()) {
+		return false
 	}
-	if !matchMethod {
+
+	if r.Header().Get(httpheader.KeyRange) != "" && mc.rangeMode() == RangeModeBypass {
 		return false
 	}
 
@@ -105,30 +204,106 @@ func (mc *MemoryCache) Load(ctx context.HTTPContext) (loaded bool) {
 		}
 	}
 
-	v, ok := mc.cache.Get(mc.key(ctx))
-	if ok {
-		entry := v.(*cacheEntry)
-		w.SetStatusCode(entry.statusCode)
-		w.Header().AddFrom(entry.header)
-		w.SetBody(bytes.NewReader(entry.body))
-		ctx.AddTag("cacheLoad")
+	key := mc.entryKey(ctx)
+	v, ok := mc.cache.Get(key)
+	if !ok {
+		return false
+	}
+
+	entry := v.(*cacheEntry)
+	if !entry.fresh(time.Now()) {
+		return false
+	}
+
+	if mc.lru != nil {
+		mc.lru.touch(key)
 	}
 
-	return ok
+	if notModified(r, entry) {
+		w.SetStatusCode(http.StatusNotModified)
+		for _, k := range revalidatedHeaders {
+			for _, value := range entry.header.GetAll(k) {
+				w.Header().Add(k, value)
+			}
+		}
+		w.SetBody(bytes.NewReader(nil))
+		ctx.AddTag("cacheNotModified")
+		return true
+	}
+
+	if !mc.serve(ctx, key, entry) {
+		return false
+	}
+	ctx.AddTag("cacheLoad")
+
+	return true
+}
+
+// serve serves the entry to the client.
+func (mc *MemoryCache) serve(ctx context.HTTPContext, key string, entry *cacheEntry) bool {
+	r, w := ctx.Request(), ctx.Response()
+
+	rangeHeader := rangeRequested(r)
+	ranged := rangeHeader != "" && entry.statusCode == http.StatusOK
+
+	// NOTE: The ranges are sliced from the body without encoding.
+	var body []byte
+	var encoding string
+	var err error
+	if ranged && !entry.opaque {
+		body, err = entry.identity()
+	} else {
+		body, encoding, err = entry.encode(r.Header().GetAll(httpheader.KeyAcceptEncoding))
+	}
+	if err != nil {
+		logger.Errorf("BUG: load cache %s failed: %v", key, err)
+		return false
+	}
+
+	w.SetStatusCode(entry.statusCode)
+	w.Header().AddFrom(entry.header)
+	if !entry.opaque {
+		if encoding != encodingIdentity {
+			w.Header().Set(httpheader.KeyContentEncoding, encoding)
+		}
+		w.Header().Set(httpheader.KeyContentLength, strconv.Itoa(len(body)))
+	}
+
+	if ranged {
+		start, end, ok := setRangeResponse(w, rangeHeader, int64(len(body)))
+		if ok {
+			body = body[start : end+1]
+		}
+	}
+	w.SetBody(bytes.NewReader(body))
+
+	return true
 }
 
 // Store tries to store cache for HTTPContext.
 func (mc *MemoryCache) Store(ctx context.HTTPContext) {
 	r, w := ctx.Request(), ctx.Response()
 
-	matchMethod := false
-	for _, method := range mc.spec.Methods {
-		if r.Method() == method {
-			matchMethod = true
-			break
-		}
+	if mc.CoalesceRange(ctx) {
+		// NOTE: It must be called after the full body is stored,
+		// because the flushing functions are called in order.
+		defer mc.sliceResponse(ctx)
 	}
-	if !matchMethod {
+
+	if !mc.matchMethod(r.Method()) {
+		return
+	}
+
+	if w.StatusCode() == http.StatusNotModified {
+		mc.refresh(ctx)
+		return
+	}
+
+	// NOTE: A partial response must never be stored as the full one.
+	if w.StatusCode() == http.StatusPartialContent {
+		return
+	}
+	if r.Header().Get(httpheader.KeyRange) != "" && mc.rangeMode() == RangeModeBypass {
 		return
 	}
 
@@ -152,16 +327,20 @@ func (mc *MemoryCache) Store(ctx context.HTTPContext) {
 	for _, value := range w.Header().GetAll(httpheader.KeyCacheControl) {
 		if strings.Contains(value, "no-store") ||
 			strings.Contains(value, "no-cache") ||
-			strings.Contains(value, "must-revalidate") {
+			strings.Contains(value, "must-revalidate") ||
+			strings.Contains(value, "private") {
 			return
 		}
 	}
 
-	key := mc.key(ctx)
-	entry := &cacheEntry{
-		statusCode: w.StatusCode(),
-		header:     w.Header().Copy(),
+	vary, ok := parseVary(w.Header().GetAll(httpheader.KeyVary))
+	if !ok {
+		return
 	}
+
+	key := mc.key(ctx)
+	statusCode, header := w.StatusCode(), w.Header().Copy()
+	var buff []byte
 	bodyLength := 0
 	ctx.Response().OnFlushBody(func(body []byte, complete bool) []byte {
 		bodyLength += len(body)
@@ -169,12 +348,112 @@ func (mc *MemoryCache) Store(ctx context.HTTPContext) {
 			return body
 		}
 
-		entry.body = append(entry.body, body...)
+		buff = append(buff, body...)
 		if complete {
-			mc.cache.SetDefault(key, entry)
-			ctx.AddTag("cacheStore")
+			mc.store(ctx, key, vary, newCacheEntry(statusCode, header, buff))
 		}
 
 		return body
 	})
 }
+
+// store stores the entry of the key, or of its variant if the response
+// varies by the request headers.
+func (mc *MemoryCache) store(ctx context.HTTPContext, key string, vary []string, entry *cacheEntry) {
+	if !entry.opaque {
+		vary = withoutAcceptEncoding(vary)
+	}
+
+	entryKey := key
+	if len(vary) == 0 {
+		mc.varies.Delete(key)
+	} else {
+		entryKey = variantKey(key, vary, ctx.Request())
+	}
+
+	lifetime, expiration, ok := mc.setFresh(key, entryKey, entry)
+	if !ok {
+		return
+	}
+	if len(vary) != 0 {
+		mc.setVary(key, vary, expiration)
+	}
+	if mc.adaptive == nil {
+		ctx.AddTag("cacheStore")
+	} else {
+		ctx.AddTag(stringtool.Cat("cacheStore: ", lifetime.String()))
+	}
+}
+
+// setVary sets the names of the request headers the responses of the key
+// vary by, it's kept as long as the longest variants.
+func (mc *MemoryCache) setVary(key string, vary []string, expiration time.Duration) {
+	_, expires, ok := mc.varies.GetWithExpiration(key)
+	if ok && time.Until(expires) > expiration {
+		expiration = time.Until(expires)
+	}
+	mc.varies.Set(key, vary, expiration)
+}
+
+// setFresh stores the entry with its freshness lifetime, which is the one
+// specified by the response, or the expiration, and extended by adaptive.
+// The entries with validators are kept longer for the revalidation.
+func (mc *MemoryCache) setFresh(key, entryKey string, entry *cacheEntry) (lifetime, expiration time.Duration, ok bool) {
+	now := time.Now()
+	lifetime, ok = freshness(entry.header, now)
+	if !ok {
+		lifetime = mc.expiration
+	}
+	if mc.adaptive != nil {
+		if extended := mc.adaptive.expiration(key); extended > lifetime {
+			lifetime = extended
+		}
+	}
+	entry.expires = now.Add(lifetime)
+
+	expiration = lifetime
+	if mc.revalidation > 0 && entry.validated() {
+		expiration += mc.revalidation
+	}
+	if expiration <= 0 {
+		return 0, 0, false
+	}
+	return lifetime, expiration, mc.set(entryKey, entry, expiration)
+}
+
+// set stores the entry and evicts the least recently used entries beyond
+// the bounds, it returns false if the entry is larger than MaxBytes.
+func (mc *MemoryCache) set(key string, entry *cacheEntry, expiration time.Duration) bool {
+	if mc.lru == nil {
+		mc.cache.Set(key, entry, expiration)
+		return true
+	}
+
+	size := entry.memorySize(key)
+	if !mc.lru.fits(size) {
+		return false
+	}
+	mc.cache.Set(key, entry, expiration)
+	for _, evicted := range mc.lru.add(key, size) {
+		mc.cache.Delete(evicted)
+	}
+	return true
+}
+
+// Status returns the status of MemoryCache.
+func (mc *MemoryCache) Status() *Status {
+	s := &Status{}
+	for _, item := range mc.cache.Items() {
+		entry := item.Object.(*cacheEntry)
+		s.Entries++
+		s.StoredBytes += uint64(len(entry.body))
+		s.LogicalBytes += uint64(entry.size)
+	}
+	if mc.lru != nil {
+		s.MemoryBytes, s.Evictions = mc.lru.status()
+	}
+	if mc.adaptive != nil {
+		s.Adaptive = mc.adaptive.status()
+	}
+	return s
+}
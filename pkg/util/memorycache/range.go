@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package memorycache
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+const (
+	// RangeModeBypass never loads or stores responses for Range requests.
+	RangeModeBypass = "bypass"
+	// RangeModeSlice serves Range requests by slicing the cached full response.
+	RangeModeSlice = "slice"
+	// RangeModeCoalesce is RangeModeSlice, and fetches the full response
+	// from servers when missing the cache, so the later ranges hit it.
+	RangeModeCoalesce = "coalesce"
+)
+
+type rangeResult int
+
+const (
+	// rangeIgnored means the range should be ignored and the full
+	// response should be served, e.g. multiple ranges or invalid syntax.
+	rangeIgnored rangeResult = iota
+	rangeSatisfiable
+	rangeUnsatisfiable
+)
+
+// parseRange parses the Range header against the body size, the returned
+// start and end are inclusive. Only a single byte range is supported.
+// Reference: https://tools.ietf.org/html/rfc7233#section-2.1
+func parseRange(s string, size int64) (start, end int64, result rangeResult) {
+	const prefix = "bytes="
+
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, prefix) {
+		return 0, 0, rangeIgnored
+	}
+	s = strings.TrimSpace(s[len(prefix):])
+	if strings.Contains(s, ",") {
+		return 0, 0, rangeIgnored
+	}
+
+	i := strings.Index(s, "-")
+	if i == -1 {
+		return 0, 0, rangeIgnored
+	}
+	first, last := strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+
+	// suffix-byte-range-spec: the last n bytes.
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, rangeIgnored
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, rangeUnsatisfiable
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, rangeSatisfiable
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, rangeIgnored
+	}
+
+	end = size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, rangeIgnored
+		}
+		if end > size-1 {
+			end = size - 1
+		}
+	}
+
+	if start >= size {
+		return 0, 0, rangeUnsatisfiable
+	}
+
+	return start, end, rangeSatisfiable
+}
+
+// setRangeResponse sets the status code and headers of w for the range of
+// the body, it returns false if the range is ignored. The returned start
+// and end are inclusive, and end is less than start if w must be empty.
+func setRangeResponse(w context.HTTPResponse, rangeHeader string, size int64) (start, end int64, ok bool) {
+	start, end, result := parseRange(rangeHeader, size)
+	switch result {
+	case rangeSatisfiable:
+		w.SetStatusCode(http.StatusPartialContent)
+		w.Header().Set(httpheader.KeyContentRange, fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+		w.Header().Set(httpheader.KeyContentLength, strconv.FormatInt(end-start+1, 10))
+		return start, end, true
+	case rangeUnsatisfiable:
+		w.SetStatusCode(http.StatusRequestedRangeNotSatisfiable)
+		w.Header().Set(httpheader.KeyContentRange, fmt.Sprintf("bytes */%d", size))
+		w.Header().Set(httpheader.KeyContentLength, "0")
+		return 0, -1, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// rangeRequested returns the Range header of the request, it returns
+// empty if the request has no range, or has an If-Range which we don't
+// validate, in that case serving the full response is always correct.
+func rangeRequested(r context.HTTPRequest) string {
+	if r.Header().Get(httpheader.KeyIfRange) != "" {
+		return ""
+	}
+	return r.Header().Get(httpheader.KeyRange)
+}
+
+// CoalesceRange reports whether the Range header should be removed from
+// the request to servers, so the full response is fetched to fill the cache.
+func (mc *MemoryCache) CoalesceRange(ctx context.HTTPContext) bool {
+	r := ctx.Request()
+	return mc.spec.RangeMode == RangeModeCoalesce &&
+		r.Header().Get(httpheader.KeyRange) != "" &&
+		mc.matchMethod(r.Method())
+}
+
+// sliceResponse turns the full response fetched by CoalesceRange into
+// the range response for the client.
+func (mc *MemoryCache) sliceResponse(ctx context.HTTPContext) {
+	r, w := ctx.Request(), ctx.Response()
+
+	rangeHeader := rangeRequested(r)
+	if rangeHeader == "" || w.StatusCode() != http.StatusOK {
+		return
+	}
+
+	// NOTE: The range can't be located without the size,
+	// the full response is a valid response for it.
+	size, err := strconv.ParseInt(w.Header().Get(httpheader.KeyContentLength), 10, 64)
+	if err != nil {
+		return
+	}
+
+	start, end, ok := setRangeResponse(w, rangeHeader, size)
+	if !ok {
+		return
+	}
+
+	var offset int64
+	w.OnFlushBody(func(body []byte, complete bool) []byte {
+		begin := offset
+		offset += int64(len(body))
+
+		low, high := begin, offset
+		if low < start {
+			low = start
+		}
+		if high > end+1 {
+			high = end + 1
+		}
+		if low >= high {
+			return nil
+		}
+
+		return body[low-begin : high-begin]
+	})
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package memorycache
+
+import "testing"
+
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		header     string
+		start, end int64
+		result     rangeResult
+	}{
+		{"bytes=0-9", 0, 9, rangeSatisfiable},
+		{"bytes=10-", 10, 99, rangeSatisfiable},
+		{"bytes=-10", 90, 99, rangeSatisfiable},
+		{"bytes=-200", 0, 99, rangeSatisfiable},
+		{"bytes=90-200", 90, 99, rangeSatisfiable},
+		{"bytes=100-", 0, 0, rangeUnsatisfiable},
+		{"bytes=-0", 0, 0, rangeUnsatisfiable},
+		{"bytes=0-1,5-6", 0, 0, rangeIgnored},
+		{"bytes=9-1", 0, 0, rangeIgnored},
+		{"items=0-1", 0, 0, rangeIgnored},
+		{"bytes=a-b", 0, 0, rangeIgnored},
+	}
+
+	for _, c := range cases {
+		start, end, result := parseRange(c.header, 100)
+		if start != c.start || end != c.end || result != c.result {
+			t.Errorf("%s: expect %d-%d(%d), got %d-%d(%d)",
+				c.header, c.start, c.end, c.result, start, end, result)
+		}
+	}
+}
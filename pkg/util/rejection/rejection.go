@@ -0,0 +1,263 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package rejection holds the rejection responses shared by the filters,
+// the filters rejecting requests respond them instead of empty bodies.
+package rejection
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/httpheader"
+)
+
+type (
+	// Spec describes the rejection response. The bodies are Go
+	// templates executed with Data, they are HTML templates escaping
+	// the data if the Content-Type header contains html.
+	Spec struct {
+		// StatusCode overrides the status code of the filters.
+		StatusCode int               `yaml:"statusCode,omitempty" jsonschema:"omitempty,format=httpcode"`
+		Headers    map[string]string `yaml:"headers" jsonschema:"omitempty"`
+		Body       string            `yaml:"body" jsonschema:"omitempty"`
+		// LocalizedBodies are the bodies keyed by language tags, which
+		// are chosen by Accept-Language of the requests.
+		LocalizedBodies map[string]string `yaml:"localizedBodies" jsonschema:"omitempty"`
+	}
+
+	// Data is the data of the body templates.
+	Data struct {
+		StatusCode int
+		Reason     string
+		Method     string
+		Host       string
+		Path       string
+		RealIP     string
+	}
+
+	// Response is the compiled rejection response.
+	Response struct {
+		spec      *Spec
+		body      executor
+		localized map[string]executor
+	}
+
+	executor interface {
+		Execute(w io.Writer, data interface{}) error
+	}
+
+	language struct {
+		tag string
+		q   float64
+	}
+)
+
+var (
+	mutex     sync.Mutex
+	responses = map[string]*Response{}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	_, err := New(&spec)
+	return err
+}
+
+// New creates a Response.
+func New(spec *Spec) (*Response, error) {
+	html := false
+	for key, value := range spec.Headers {
+		if strings.EqualFold(key, httpheader.KeyContentType) && strings.Contains(value, "html") {
+			html = true
+		}
+	}
+
+	parse := func(name, text string) (executor, error) {
+		if html {
+			return htmltemplate.New(name).Parse(text)
+		}
+		return template.New(name).Parse(text)
+	}
+
+	r := &Response{spec: spec, localized: map[string]executor{}}
+
+	var err error
+	if r.body, err = parse("body", spec.Body); err != nil {
+		return nil, fmt.Errorf("parse body failed: %v", err)
+	}
+	for tag, body := range spec.LocalizedBodies {
+		if tag == "" {
+			return nil, fmt.Errorf("empty language tag in localizedBodies")
+		}
+		tag = strings.ToLower(tag)
+		if r.localized[tag], err = parse(tag, body); err != nil {
+			return nil, fmt.Errorf("parse body of %s failed: %v", tag, err)
+		}
+	}
+
+	return r, nil
+}
+
+// Respond writes the rejection response to the context, the status code
+// set by the filter is kept unless StatusCode is specified.
+func (r *Response) Respond(ctx context.HTTPContext, reason string) {
+	w, req := ctx.Response(), ctx.Request()
+
+	if r.spec.StatusCode != 0 {
+		w.SetStatusCode(r.spec.StatusCode)
+	}
+	for key, value := range r.spec.Headers {
+		w.Header().Set(key, value)
+	}
+
+	data := &Data{
+		StatusCode: w.StatusCode(),
+		Reason:     reason,
+		Method:     req.Method(),
+		Host:       req.Host(),
+		Path:       req.Path(),
+		RealIP:     req.RealIP(),
+	}
+
+	buff := &bytes.Buffer{}
+	if err := r.template(req.Header().Get("Accept-Language")).Execute(buff, data); err != nil {
+		// NOTE: The partial body is dropped.
+		buff.Reset()
+	}
+
+	w.Header().Set(httpheader.KeyContentLength, strconv.Itoa(buff.Len()))
+	w.SetBody(buff)
+}
+
+// template returns the body template of the most preferred language,
+// which falls back to the primary subtag, e.g. zh for zh-CN.
+func (r *Response) template(acceptLanguage string) executor {
+	if len(r.localized) == 0 || acceptLanguage == "" {
+		return r.body
+	}
+
+	for _, lang := range parseAcceptLanguage(acceptLanguage) {
+		if t, exists := r.localized[lang.tag]; exists {
+			return t
+		}
+		if i := strings.IndexByte(lang.tag, '-'); i > 0 {
+			if t, exists := r.localized[lang.tag[:i]]; exists {
+				return t
+			}
+		}
+	}
+
+	return r.body
+}
+
+// parseAcceptLanguage returns the languages sorted by quality, the ones
+// with zero quality or the wildcard are dropped.
+func parseAcceptLanguage(value string) []*language {
+	var langs []*language
+	for _, part := range strings.Split(value, ",") {
+		fields := strings.Split(part, ";")
+		lang := &language{tag: strings.ToLower(strings.TrimSpace(fields[0])), q: 1}
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					q = 0
+				}
+				lang.q = q
+			}
+		}
+
+		if lang.tag != "" && lang.tag != "*" && lang.q > 0 {
+			langs = append(langs, lang)
+		}
+	}
+
+	sort.SliceStable(langs, func(i, j int) bool {
+		return langs[i].q > langs[j].q
+	})
+
+	return langs
+}
+
+// Set sets the rejection response of the name.
+func Set(name string, r *Response) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	responses[name] = r
+}
+
+// Delete deletes the rejection response of the name.
+func Delete(name string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	delete(responses, name)
+}
+
+// Get returns the rejection response of the name with the existing flag.
+func Get(name string) (*Response, bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	r, exists := responses[name]
+	return r, exists
+}
+
+// Check checks whether the rejection response exists. Like server
+// groups, nothing is restricted before any response is set, so the
+// references aren't rejected while the objects are being loaded at
+// startup.
+func Check(name string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(responses) == 0 {
+		return nil
+	}
+	if _, exists := responses[name]; !exists {
+		return fmt.Errorf("rejection response %s not found", name)
+	}
+	return nil
+}
+
+// Respond writes the rejection response of the name to the context, it
+// returns false if the name is empty or the response doesn't exist, in
+// which case the context is untouched.
+func Respond(ctx context.HTTPContext, name, reason string) bool {
+	if name == "" {
+		return false
+	}
+
+	r, exists := Get(name)
+	if !exists {
+		return false
+	}
+
+	r.Respond(ctx, reason)
+	return true
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rejection
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+func respond(t *testing.T, r *Response, acceptLanguage string) (int, http.Header, string) {
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/api?<b>", nil)
+	req.URL.Path = "/<b>"
+	if acceptLanguage != "" {
+		req.Header.Set("Accept-Language", acceptLanguage)
+	}
+	w := httptest.NewRecorder()
+
+	ctx := context.New(w, req, tracing.NoopTracing, "")
+	ctx.Response().SetStatusCode(http.StatusTooManyRequests)
+	r.Respond(ctx, "too many requests")
+
+	body, err := ioutil.ReadAll(ctx.Response().Body())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ctx.Response().StatusCode(), ctx.Response().Std().Header(), string(body)
+}
+
+func TestResponse(t *testing.T) {
+	r, err := New(&Spec{
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Body:    `{"code":{{.StatusCode}},"reason":"{{.Reason}}"}`,
+		LocalizedBodies: map[string]string{
+			"zh":    `{"code":{{.StatusCode}},"reason":"请求过多"}`,
+			"fr-CA": `{"code":{{.StatusCode}},"reason":"trop de requêtes"}`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		acceptLanguage string
+		body           string
+	}{
+		{"", `{"code":429,"reason":"too many requests"}`},
+		{"de", `{"code":429,"reason":"too many requests"}`},
+		{"zh-CN,zh;q=0.9,en;q=0.8", `{"code":429,"reason":"请求过多"}`},
+		{"en;q=0.5, fr-ca", `{"code":429,"reason":"trop de requêtes"}`},
+		{"zh;q=0, fr;q=0.1", `{"code":429,"reason":"too many requests"}`},
+	}
+	for _, test := range tests {
+		code, header, body := respond(t, r, test.acceptLanguage)
+		if code != http.StatusTooManyRequests {
+			t.Errorf("expect status 429, got %d", code)
+		}
+		if header.Get("Content-Type") != "application/json" {
+			t.Errorf("expect json content type, got %s", header.Get("Content-Type"))
+		}
+		if body != test.body {
+			t.Errorf("accept language %q: expect body %s, got %s", test.acceptLanguage, test.body, body)
+		}
+	}
+}
+
+func TestHTMLResponse(t *testing.T) {
+	r, err := New(&Spec{
+		StatusCode: http.StatusServiceUnavailable,
+		Headers:    map[string]string{"content-type": "text/html; charset=utf-8"},
+		Body:       `<p>{{.Path}}</p>`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, body := respond(t, r, "")
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("expect status 503, got %d", code)
+	}
+	if body != `<p>/&lt;b&gt;</p>` {
+		t.Errorf("expect escaped body, got %s", body)
+	}
+
+	if _, err := New(&Spec{Body: "{{.Reason"}); err == nil {
+		t.Errorf("expect error of invalid template")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	if err := Check("foo"); err != nil {
+		t.Errorf("expect no error before any response is set, got %v", err)
+	}
+
+	r, _ := New(&Spec{Body: "rejected"})
+	Set("foo", r)
+	defer Delete("foo")
+
+	if err := Check("foo"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := Check("bar"); err == nil {
+		t.Errorf("expect error of missing response")
+	}
+	if _, exists := Get("foo"); !exists {
+		t.Errorf("expect foo exists")
+	}
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package texttemplate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// RenderModeStrict is the mode in which a template failing to render
+	// fails the whole rendering.
+	RenderModeStrict = "strict"
+	// RenderModeBestEffort is the mode in which a template failing to
+	// render is rendered to the placeholder, see RenderBestEffort.
+	RenderModeBestEffort = "bestEffort"
+)
+
+// RenderBestEffort renders input like Render, but the templates failing
+// to prepare, or having no value, e.g. a missing field of GJSON syntax,
+// are rendered to placeholder and reported as warnings instead of failing
+// the whole rendering. The input is rendered to placeholder as a whole if
+// its blocks are invalid.
+func (t TextTemplate) RenderBestEffort(input, placeholder string) (string, []string) {
+	defer t.stats.observeRender(time.Now())
+
+	var warnings []string
+	warn := func(format string, args ...interface{}) {
+		atomic.AddUint64(&t.stats.renderWarnings, 1)
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	input, err := t.resolveBlocks(input)
+	if err != nil {
+		warn("%v", err)
+		return placeholder, warnings
+	}
+
+	failed := map[string]bool{}
+	for name, metaTemplate := range t.ExtractTemplateRuleMap(input) {
+		if strings.HasSuffix(metaTemplate, GJSONTag) && !t.gjsonExists(name, metaTemplate) {
+			failed[name] = true
+			continue
+		}
+		if _, exists := t.dict.get(name); exists {
+			continue
+		}
+		if err := t.prepareTemplates(map[string]string{name: metaTemplate}); err != nil {
+			failed[name] = true
+		}
+	}
+
+	output := bytes.NewBuffer(nil)
+	t.compile(input).ExecuteFunc(output, func(w io.Writer, tag string) (int, error) {
+		if tag == escapeTag {
+			return io.WriteString(w, t.beginToken)
+		}
+
+		name, _ := SplitFormat(tag)
+		if _, exists := t.lookup(name); !exists || failed[name] {
+			warn("template %s has no value", name)
+			return io.WriteString(w, placeholder)
+		}
+
+		buff := bytes.NewBuffer(nil)
+		if _, err := t.writeTag(buff, tag); err != nil {
+			warn("template %s: %v", name, err)
+			return io.WriteString(w, placeholder)
+		}
+		return w.Write(buff.Bytes())
+	})
+
+	return output.String(), warnings
+}
+
+// gjsonExists reports whether the GJSON syntax of the template finds a
+// value, the template rendered to empty string can't tell it.
+func (t TextTemplate) gjsonExists(template, metaTemplate string) bool {
+	key, syntax := t.splitSyntax(template, metaTemplate, GJSONTag)
+	value, exists := t.stringValue(key)
+	return exists && gjson.Get(value, syntax).Exists()
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package texttemplate
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BuiltinNamespace is the first tag of the builtin templates, which are
+// resolved by the engine itself at every rendering instead of SetDict.
+const BuiltinNamespace = "sys"
+
+// builtinFuncs are the builtin templates joined by DefaultSeparator.
+var builtinFuncs = map[string]func() string{
+	"sys.time.unix": func() string {
+		return strconv.FormatInt(time.Now().Unix(), 10)
+	},
+	"sys.time.unixmilli": func() string {
+		return strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+	},
+	"sys.time.rfc3339": func() string {
+		return time.Now().Format(time.RFC3339)
+	},
+	"sys.uuid": uuid.NewString,
+	"sys.rand.int": func() string {
+		return strconv.FormatInt(rand.Int63(), 10)
+	},
+}
+
+// newBuiltins returns the builtin functions keyed by the templates joined by separator.
+func newBuiltins(separator string) map[string]func() string {
+	builtins := make(map[string]func() string, len(builtinFuncs))
+	for template, fn := range builtinFuncs {
+		builtins[strings.ReplaceAll(template, DefaultSeparator, separator)] = fn
+	}
+	return builtins
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package texttemplate
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// IfDirective begins a conditional block, e.g. [[if filter.abc.req.header.X-Debug]],
+	// the block is kept only if the value of the template is set and not empty.
+	IfDirective = "if "
+	// ElseDirective begins the block kept if the condition of the if is false.
+	ElseDirective = "else"
+	// EndDirective ends a conditional block.
+	EndDirective = "end"
+)
+
+type conditionFrame struct {
+	parentActive bool
+	condition    bool
+	inElse       bool
+}
+
+// conditionTemplate returns the template of the condition if tag is an if directive.
+func conditionTemplate(tag string) (string, bool) {
+	if !strings.HasPrefix(tag, IfDirective) {
+		return "", false
+	}
+	return strings.TrimSpace(tag[len(IfDirective):]), true
+}
+
+// resolveBlocks keeps the blocks of the satisfied conditions in input
+// and removes the others together with all directives, range blocks are
+// expanded for every element.
+func (t TextTemplate) resolveBlocks(input string) (string, error) {
+	if !strings.Contains(input, t.beginToken+IfDirective) &&
+		!strings.Contains(input, t.beginToken+RangeDirective) &&
+		!strings.Contains(input, t.beginToken+ElseDirective+t.endToken) &&
+		!strings.Contains(input, t.beginToken+SeparatorDirective+t.endToken) &&
+		!strings.Contains(input, t.beginToken+EndDirective+t.endToken) {
+		return input, nil
+	}
+
+	return t.resolve(input, nil)
+}
+
+// resolve resolves the blocks of input, scope is the element of the
+// innermost range block, it's nil if input is not in a range block.
+func (t TextTemplate) resolve(input string, scope *rangeScope) (string, error) {
+	var (
+		output strings.Builder
+		stack  []*conditionFrame
+	)
+	active := true
+
+	for len(input) != 0 {
+		bIdx := strings.Index(input, t.beginToken)
+		if bIdx == -1 {
+			break
+		}
+
+		if active {
+			output.WriteString(input[:bIdx])
+		}
+		input = input[bIdx+len(t.beginToken):]
+
+		if strings.HasPrefix(input, t.beginToken) {
+			// keep the escaped beginning token for rendering
+			if active {
+				output.WriteString(t.beginToken + t.beginToken)
+			}
+			input = input[len(t.beginToken):]
+			continue
+		}
+
+		eIdx := strings.Index(input, t.endToken)
+		if eIdx == -1 {
+			input = t.beginToken + input
+			break
+		}
+		tag := input[:eIdx]
+		input = input[eIdx+len(t.endToken):]
+
+		if condition, ok := conditionTemplate(tag); ok {
+			frame := &conditionFrame{parentActive: active}
+			frame.condition = active && t.evaluateCondition(condition, scope)
+			stack = append(stack, frame)
+			active = frame.condition
+			continue
+		}
+
+		if target, ok := rangeTemplate(tag); ok {
+			body, separator, rest, err := t.splitRange(input)
+			if err != nil {
+				return "", err
+			}
+			input = rest
+			if !active {
+				continue
+			}
+			if err := t.expandRange(&output, target, body, separator, scope); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		switch tag {
+		case ElseDirective:
+			if len(stack) == 0 || stack[len(stack)-1].inElse {
+				return "", fmt.Errorf("unexpected %s%s%s", t.beginToken, tag, t.endToken)
+			}
+			frame := stack[len(stack)-1]
+			frame.inElse = true
+			active = frame.parentActive && !frame.condition
+		case EndDirective:
+			if len(stack) == 0 {
+				return "", fmt.Errorf("unexpected %s%s%s", t.beginToken, tag, t.endToken)
+			}
+			active = stack[len(stack)-1].parentActive
+			stack = stack[:len(stack)-1]
+		case SeparatorDirective:
+			return "", fmt.Errorf("unexpected %s%s%s", t.beginToken, tag, t.endToken)
+		default:
+			if !active {
+				continue
+			}
+			if value, ok := scope.value(tag, t.separator); ok {
+				output.WriteString(t.quote(value))
+				continue
+			}
+			output.WriteString(t.beginToken + tag + t.endToken)
+		}
+	}
+
+	if len(stack) != 0 {
+		return "", fmt.Errorf("%d conditional blocks without %s%s%s",
+			len(stack), t.beginToken, EndDirective, t.endToken)
+	}
+
+	if active {
+		output.WriteString(input)
+	}
+
+	return output.String(), nil
+}
+
+// evaluateCondition reports whether the value of the template is set and not empty.
+func (t TextTemplate) evaluateCondition(template string, scope *rangeScope) bool {
+	value, exists := t.blockValue(template, scope)
+	return exists && value != ""
+}
+
+// blockValue returns the value of the template of a directive, the element
+// of scope is used for the item templates, otherwise it's looked up in
+// dictionary, GJSON, JSONPath or regexp syntax is evaluated if needed.
+func (t TextTemplate) blockValue(template string, scope *rangeScope) (string, bool) {
+	if value, ok := scope.value(template, t.separator); ok {
+		return value, true
+	}
+
+	metaTemplate := t.MatchMetaTemplate(template)
+	if metaTemplate == "" {
+		return "", false
+	}
+
+	name, _ := SplitFormat(template)
+	if err := t.prepareTemplates(map[string]string{name: metaTemplate}); err != nil {
+		return "", false
+	}
+
+	return t.stringValue(name)
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package texttemplate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TemplateIssue describes how a candidate template would be rendered,
+// Message is empty if it would be rendered with a value in dictionary, a builtin value or
+// the value of a resolver.
+type TemplateIssue struct {
+	Template     string `yaml:"template"`
+	MetaTemplate string `yaml:"metaTemplate"`
+	Matched      bool   `yaml:"matched"`
+	DictSet      bool   `yaml:"dictSet"`
+	Builtin      bool   `yaml:"builtin,omitempty"`
+	Resolved     bool   `yaml:"resolved,omitempty"`
+
+	// The fields below are only for templates ending with {gjson}, {jsonpath} or {regexp},
+	// the syntax is evaluated against the value of SyntaxTarget in dictionary.
+	SyntaxTag       string `yaml:"syntaxTag,omitempty"`
+	SyntaxTarget    string `yaml:"syntaxTarget,omitempty"`
+	SyntaxTargetSet bool   `yaml:"syntaxTargetSet,omitempty"`
+	Syntax          string `yaml:"syntax,omitempty"`
+
+	Message string `yaml:"message,omitempty"`
+}
+
+// Diagnose reports the candidate templates of input in the order of their
+// first appearance. It returns an error if input has an unterminated
+// beginning token, whose content is never treated as a template.
+func (t TextTemplate) Diagnose(input string) ([]TemplateIssue, error) {
+	issues := []TemplateIssue{}
+	seen := map[string]bool{}
+
+	for _, template := range t.extractVarsAroundToken(input) {
+		if seen[template] {
+			continue
+		}
+		seen[template] = true
+		issues = append(issues, t.diagnoseTemplate(template))
+	}
+
+	if t.hasUnterminatedToken(input) {
+		return issues, fmt.Errorf("unterminated %s in input", t.beginToken)
+	}
+
+	return issues, nil
+}
+
+func (t TextTemplate) diagnoseTemplate(template string) TemplateIssue {
+	issue := TemplateIssue{Template: template}
+
+	issue.MetaTemplate = t.MatchMetaTemplate(template)
+	issue.Matched = issue.MetaTemplate != ""
+	if !issue.Matched {
+		issue.Message = "matched none meta template, it is rendered as is"
+		return issue
+	}
+
+	name, _ := SplitFormat(template)
+	_, issue.Builtin = t.builtins[name]
+	_, issue.DictSet = t.dict.get(name)
+	_, issue.Resolved = t.resolver(name)
+
+	for _, tag := range []string{GJSONTag, JSONPathTag, RegexpTag} {
+		if strings.HasSuffix(issue.MetaTemplate, tag) {
+			issue.SyntaxTag = tag
+			issue.SyntaxTarget, issue.Syntax = t.splitSyntax(name, issue.MetaTemplate, tag)
+			_, issue.SyntaxTargetSet = t.dict.get(issue.SyntaxTarget)
+		}
+	}
+
+	switch {
+	case issue.Builtin, issue.DictSet, issue.Resolved:
+	case issue.SyntaxTag == "":
+		issue.Message = "value not set in dictionary, it is rendered empty"
+	case !issue.SyntaxTargetSet:
+		issue.Message = fmt.Sprintf("syntax target %s not set in dictionary, rendering fails", issue.SyntaxTarget)
+	default:
+		issue.Message = fmt.Sprintf("value is evaluated by %s syntax %s at rendering", issue.SyntaxTag, issue.Syntax)
+	}
+
+	return issue
+}
+
+// hasUnterminatedToken checks whether input has a beginning token, which
+// is not escaped, without an ending token after it.
+func (t TextTemplate) hasUnterminatedToken(input string) bool {
+	for {
+		bIdx := strings.Index(input, t.beginToken)
+		if bIdx == -1 {
+			return false
+		}
+
+		input = input[bIdx+len(t.beginToken):]
+		if strings.HasPrefix(input, t.beginToken) {
+			input = input[len(t.beginToken):]
+			continue
+		}
+
+		eIdx := strings.Index(input, t.endToken)
+		if eIdx == -1 {
+			return true
+		}
+		input = input[eIdx+len(t.endToken):]
+	}
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package texttemplate
+
+import (
+	"sync"
+
+	"github.com/megaease/easegress/pkg/util/hashtool"
+)
+
+const dictShardCount = 16
+
+type (
+	// dictionary is a goroutine-safe map sharded by the hash of keys,
+	// so that writers of different templates rarely block each other.
+	dictionary struct {
+		shards [dictShardCount]*dictShard
+	}
+
+	dictShard struct {
+		mutex sync.RWMutex
+		m     map[string]interface{}
+	}
+)
+
+func newDictionary() *dictionary {
+	d := &dictionary{}
+	for i := range d.shards {
+		d.shards[i] = &dictShard{m: map[string]interface{}{}}
+	}
+	return d
+}
+
+func (d *dictionary) shard(key string) *dictShard {
+	return d.shards[hashtool.Hash32(key)%dictShardCount]
+}
+
+func (d *dictionary) get(key string) (interface{}, bool) {
+	s := d.shard(key)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	value, exists := s.m[key]
+	return value, exists
+}
+
+func (d *dictionary) set(key string, value interface{}) {
+	s := d.shard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.m[key] = value
+}
+
+func (d *dictionary) delete(key string) {
+	s := d.shard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.m, key)
+}
+
+// clear removes all keys, the shards are cleared one by one, so the
+// keys set by other goroutines during clearing may be kept.
+func (d *dictionary) clear() {
+	for _, s := range d.shards {
+		s.mutex.Lock()
+		s.m = map[string]interface{}{}
+		s.mutex.Unlock()
+	}
+}
+
+// snapshot returns a copy of the whole dictionary.
+func (d *dictionary) snapshot() map[string]interface{} {
+	m := map[string]interface{}{}
+	for _, s := range d.shards {
+		s.mutex.RLock()
+		for k, v := range s.m {
+			m[k] = v
+		}
+		s.mutex.RUnlock()
+	}
+	return m
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package texttemplate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/valyala/fasttemplate"
+)
+
+// FormatSeparator separates a template and its format in fmt verbs,
+// e.g. [[filter.abc.rsp.latency|%.2f]], the format must start with '%',
+// so that the '|' in GJSON or regexp syntax is not treated as it.
+const FormatSeparator = "|"
+
+// SplitFormat splits the template into its name and format,
+// the format is empty if the template has none.
+func SplitFormat(template string) (name, format string) {
+	index := strings.LastIndex(template, FormatSeparator+"%")
+	if index == -1 {
+		return template, ""
+	}
+	return template[:index], template[index+len(FormatSeparator):]
+}
+
+// validateValue checks whether the value is supported in dictionary.
+func validateValue(value interface{}) error {
+	switch value.(type) {
+	case string, []byte, fasttemplate.TagFunc, bool,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64, fmt.Stringer:
+		return nil
+	default:
+		return fmt.Errorf("unsupported value type %T", value)
+	}
+}
+
+// lookup returns the value of the template name in builtins, dictionary
+// or by the registered resolver.
+func (t TextTemplate) lookup(name string) (interface{}, bool) {
+	if fn, exists := t.builtins[name]; exists {
+		return fn(), true
+	}
+	if value, exists := t.dict.get(name); exists {
+		return value, true
+	}
+	if value, exists := t.resolveValue(name); exists {
+		return value, true
+	}
+	return nil, false
+}
+
+// stringValue returns the value of the template name in string,
+// it's used as the target of GJSON, JSONPath or regexp syntax.
+func (t TextTemplate) stringValue(name string) (string, bool) {
+	value, exists := t.lookup(name)
+	if !exists {
+		return "", false
+	}
+
+	if fn, ok := value.(fasttemplate.TagFunc); ok {
+		buff := bytes.NewBuffer(nil)
+		fn(buff, name)
+		return buff.String(), true
+	}
+
+	return toString(value), true
+}
+
+// toString returns the value which is not a fasttemplate.TagFunc in string.
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// writeFormatted writes the value formatted by format into w, the string
+// value is formatted after rendered.
+func (t TextTemplate) writeFormatted(w io.Writer, name, format string, value interface{}, depth int) (int, error) {
+	switch value.(type) {
+	case string, []byte, fasttemplate.TagFunc:
+		buff := bytes.NewBuffer(nil)
+		t.writeLookedUp(buff, name, value, depth)
+		return fmt.Fprintf(w, format, buff.String())
+	default:
+		return fmt.Fprintf(w, format, value)
+	}
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package texttemplate
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// getJSONPath evaluates the JSONPath expression against the JSON document,
+// it follows gjson's output: a string is returned as is, other values are
+// returned in JSON, multiple results are returned as a JSON array, and
+// a missing path results in an empty string.
+func getJSONPath(doc, expr string) (string, error) {
+	jp := jsonpath.New("").AllowMissingKeys(true)
+	if err := jp.Parse("{" + expr + "}"); err != nil {
+		return "", fmt.Errorf("invalid jsonpath %s: %v", expr, err)
+	}
+
+	var data interface{}
+	if err := json.Unmarshal([]byte(doc), &data); err != nil {
+		// NOTE: Follow gjson, which returns empty for invalid JSON.
+		return "", nil
+	}
+
+	results, err := jp.FindResults(data)
+	if err != nil {
+		return "", nil
+	}
+
+	values := []interface{}{}
+	for _, result := range results {
+		for _, v := range result {
+			if v.IsValid() && v.CanInterface() {
+				values = append(values, v.Interface())
+			}
+		}
+	}
+
+	switch len(values) {
+	case 0:
+		return "", nil
+	case 1:
+		return jsonPathString(values[0])
+	default:
+		buff, err := json.Marshal(values)
+		if err != nil {
+			return "", err
+		}
+		return string(buff), nil
+	}
+}
+
+func jsonPathString(value interface{}) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+
+	if reflect.TypeOf(value).Kind() == reflect.String {
+		return reflect.ValueOf(value).String(), nil
+	}
+
+	buff, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(buff), nil
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package texttemplate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// RangeDirective begins a range block iterating a JSON array, e.g.
+	// [[range filter.abc.req.body.items.{gjson}]][[item.id]][[separator]],[[end]],
+	// the block before the optional separator directive is rendered for every
+	// element, and the part after it is rendered between the elements.
+	RangeDirective = "range "
+	// SeparatorDirective begins the separator of a range block.
+	SeparatorDirective = "separator"
+
+	// ItemTag is the element of the innermost range block, a string element
+	// is rendered as is and others in JSON, [[item.xxx]] renders the GJSON
+	// path xxx against the element.
+	ItemTag = "item"
+	// IndexTag is the index of the element of the innermost range block.
+	IndexTag = "index"
+)
+
+// rangeScope is the element iterated by a range block.
+type rangeScope struct {
+	item  gjson.Result
+	index int
+}
+
+// rangeTemplate returns the template of the array if tag is a range directive.
+func rangeTemplate(tag string) (string, bool) {
+	if !strings.HasPrefix(tag, RangeDirective) {
+		return "", false
+	}
+	return strings.TrimSpace(tag[len(RangeDirective):]), true
+}
+
+// isScopeTag reports whether tag references the element of a range block.
+func isScopeTag(tag, separator string) bool {
+	return tag == ItemTag || tag == IndexTag || strings.HasPrefix(tag, ItemTag+separator)
+}
+
+// value returns the value of the tag referencing the element.
+func (s *rangeScope) value(tag, separator string) (string, bool) {
+	if s == nil || !isScopeTag(tag, separator) {
+		return "", false
+	}
+
+	switch tag {
+	case IndexTag:
+		return strconv.Itoa(s.index), true
+	case ItemTag:
+		return s.item.String(), true
+	default:
+		return s.item.Get(tag[len(ItemTag+separator):]).String(), true
+	}
+}
+
+// splitRange splits input following a range directive into the body and
+// the separator of the block, and the rest after its end directive.
+func (t TextTemplate) splitRange(input string) (body, separator, rest string, err error) {
+	depth, offset, sepBegin, sepEnd := 0, 0, -1, -1
+
+	for {
+		bIdx := strings.Index(input[offset:], t.beginToken)
+		if bIdx == -1 {
+			break
+		}
+		tagBegin := offset + bIdx
+		offset = tagBegin + len(t.beginToken)
+
+		if strings.HasPrefix(input[offset:], t.beginToken) {
+			offset += len(t.beginToken)
+			continue
+		}
+
+		eIdx := strings.Index(input[offset:], t.endToken)
+		if eIdx == -1 {
+			break
+		}
+		tag := input[offset : offset+eIdx]
+		offset += eIdx + len(t.endToken)
+
+		_, isIf := conditionTemplate(tag)
+		_, isRange := rangeTemplate(tag)
+		switch {
+		case isIf, isRange:
+			depth++
+		case tag == SeparatorDirective && depth == 0:
+			if sepBegin != -1 {
+				return "", "", "", fmt.Errorf("unexpected %s%s%s", t.beginToken, tag, t.endToken)
+			}
+			sepBegin, sepEnd = tagBegin, offset
+		case tag == EndDirective && depth == 0:
+			if sepBegin == -1 {
+				return input[:tagBegin], "", input[offset:], nil
+			}
+			return input[:sepBegin], input[sepEnd:tagBegin], input[offset:], nil
+		case tag == EndDirective:
+			depth--
+		}
+	}
+
+	return "", "", "", fmt.Errorf("range block without %s%s%s", t.beginToken, EndDirective, t.endToken)
+}
+
+// expandRange writes the body of the range block for every element of the
+// array, which is the value of target. Nothing is written if the value is
+// not set or not a JSON array.
+func (t TextTemplate) expandRange(output *strings.Builder, target, body, separator string, scope *rangeScope) error {
+	value, exists := t.blockValue(target, scope)
+	if !exists {
+		return nil
+	}
+
+	array := gjson.Parse(value)
+	if !array.IsArray() {
+		return nil
+	}
+
+	for i, item := range array.Array() {
+		if i != 0 && separator != "" {
+			resolved, err := t.resolve(separator, scope)
+			if err != nil {
+				return err
+			}
+			output.WriteString(resolved)
+		}
+
+		resolved, err := t.resolve(body, &rangeScope{item: item, index: i})
+		if err != nil {
+			return err
+		}
+		output.WriteString(resolved)
+	}
+
+	return nil
+}
+
+// quote doubles the beginning tokens of value, so it's rendered literally.
+func (t TextTemplate) quote(value string) string {
+	return strings.ReplaceAll(value, t.beginToken, t.beginToken+t.beginToken)
+}
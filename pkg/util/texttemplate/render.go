@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package texttemplate
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// stringRef is a reference to a settable string found by RenderStruct.
+type stringRef struct {
+	value string
+	set   func(string)
+}
+
+// RenderMap renders every value of inputs, the templates of all values are
+// extracted and prepared in one pass, then each value is rendered by the
+// compiled fasttemplate. The keys of the returned map are the same as inputs.
+func (t TextTemplate) RenderMap(inputs map[string]string) (map[string]string, error) {
+	defer t.stats.observeRender(time.Now())
+
+	resolvedInputs := make(map[string]string, len(inputs))
+	for key, input := range inputs {
+		resolved, err := t.resolveBlocks(input)
+		if err != nil {
+			return nil, err
+		}
+		resolvedInputs[key] = resolved
+	}
+	inputs = resolvedInputs
+
+	hasTemplates := make(map[string]bool, len(inputs))
+	templateMap := map[string]string{}
+
+	for _, input := range inputs {
+		if _, exists := hasTemplates[input]; exists {
+			continue
+		}
+
+		m := t.ExtractTemplateRuleMap(input)
+		hasTemplates[input] = len(m) != 0
+		for k, v := range m {
+			templateMap[k] = v
+		}
+	}
+
+	if err := t.prepareTemplates(templateMap); err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]string, len(inputs))
+	for key, input := range inputs {
+		if !hasTemplates[input] {
+			results[key] = t.unescape(input)
+			continue
+		}
+		results[key] = t.compile(input).ExecuteFuncString(t.writeTag)
+	}
+
+	return results, nil
+}
+
+// RenderStruct renders the strings of the struct pointed by v in place by
+// RenderMap, only exported fields are rendered.
+func (t TextTemplate) RenderStruct(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("render struct needs a non-nil pointer to struct, got %T", v)
+	}
+
+	var refs []*stringRef
+	collectStrings(rv, map[uintptr]bool{}, &refs)
+	if len(refs) == 0 {
+		return nil
+	}
+
+	inputs := make(map[string]string, len(refs))
+	for i, ref := range refs {
+		inputs[strconv.Itoa(i)] = ref.value
+	}
+
+	results, err := t.RenderMap(inputs)
+	if err != nil {
+		return err
+	}
+
+	for i, ref := range refs {
+		if result := results[strconv.Itoa(i)]; result != ref.value {
+			ref.set(result)
+		}
+	}
+
+	return nil
+}
+
+// collectStrings walks v and collects the settable strings into refs,
+// visited records the pointers walked to avoid endless loop on cycles.
+func collectStrings(v reflect.Value, visited map[uintptr]bool, refs *[]*stringRef) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || visited[v.Pointer()] {
+			return
+		}
+		visited[v.Pointer()] = true
+		collectStrings(v.Elem(), visited, refs)
+	case reflect.Interface:
+		if !v.IsNil() {
+			collectStrings(v.Elem(), visited, refs)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			collectStrings(v.Field(i), visited, refs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			collectStrings(v.Index(i), visited, refs)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			key, value := iter.Key(), iter.Value()
+			if value.Kind() == reflect.String {
+				*refs = append(*refs, &stringRef{
+					value: value.String(),
+					set: func(s string) {
+						v.SetMapIndex(key, reflect.ValueOf(s).Convert(value.Type()))
+					},
+				})
+				continue
+			}
+			// NOTE: The values of map are not addressable,
+			// only the ones referenced by pointers could be set.
+			collectStrings(value, visited, refs)
+		}
+	case reflect.String:
+		if v.CanSet() {
+			*refs = append(*refs, &stringRef{
+				value: v.String(),
+				set:   v.SetString,
+			})
+		}
+	}
+}
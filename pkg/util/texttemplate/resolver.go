@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package texttemplate
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type (
+	// Resolver returns the value of the template at rendering, e.g. the
+	// resolver of "env.{}" returns the environment variable HOME for the
+	// template "env.HOME".
+	Resolver func(template string) (string, error)
+
+	// resolvers holds the resolvers keyed by meta template prefixes.
+	resolvers struct {
+		mutex    sync.RWMutex
+		prefixes map[string]Resolver
+	}
+)
+
+func newResolvers() *resolvers {
+	return &resolvers{prefixes: map[string]Resolver{}}
+}
+
+// RegisterResolver registers the resolver for the templates matching the
+// meta template prefix, the prefix must end at a tag of one of the meta
+// templates like RegisterValidator. The resolver is called lazily every
+// time a template not in dictionary is rendered, the value is never stored
+// into dictionary, so it could change between renderings. If more than one
+// prefix matches, the longest one wins, e.g. "secret.{}" wins "secret".
+func (t TextTemplate) RegisterResolver(metaTemplatePrefix string, fn Resolver) error {
+	if fn == nil {
+		return fmt.Errorf("nil resolver for %s", metaTemplatePrefix)
+	}
+
+	found := false
+	for _, mt := range t.metaTemplates {
+		if t.hasMetaPrefix(mt, metaTemplatePrefix) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("prefix %s matched none meta template", metaTemplatePrefix)
+	}
+
+	t.resolvers.mutex.Lock()
+	defer t.resolvers.mutex.Unlock()
+
+	if _, exists := t.resolvers.prefixes[metaTemplatePrefix]; exists {
+		return fmt.Errorf("resolver for %s existed", metaTemplatePrefix)
+	}
+	t.resolvers.prefixes[metaTemplatePrefix] = fn
+
+	return nil
+}
+
+// resolver returns the resolver of the longest prefix matched by the template.
+func (t TextTemplate) resolver(template string) (Resolver, bool) {
+	t.resolvers.mutex.RLock()
+	defer t.resolvers.mutex.RUnlock()
+
+	var resolver Resolver
+	longest := -1
+	for prefix, fn := range t.resolvers.prefixes {
+		if !t.matchPrefix(template, prefix) {
+			continue
+		}
+		if tags := strings.Count(prefix, t.separator); tags > longest {
+			resolver, longest = fn, tags
+		}
+	}
+
+	return resolver, resolver != nil
+}
+
+// resolveValue returns the value of the template by its resolver, it's not
+// existed if the resolver fails.
+func (t TextTemplate) resolveValue(template string) (string, bool) {
+	fn, exists := t.resolver(template)
+	if !exists {
+		return "", false
+	}
+
+	value, err := fn(template)
+	if err != nil {
+		atomic.AddUint64(&t.stats.resolverFailures, 1)
+		return "", false
+	}
+
+	return value, true
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package texttemplate
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/sampler"
+)
+
+type (
+	// Stats is the statistics of a template engine since it's created.
+	Stats struct {
+		Renders          uint64 `yaml:"renders"`
+		CacheHits        uint64 `yaml:"cacheHits"`
+		CacheMisses      uint64 `yaml:"cacheMisses"`
+		Unresolved       uint64 `yaml:"unresolved"`
+		GJSONFailures    uint64 `yaml:"gjsonFailures"`
+		ResolverFailures uint64 `yaml:"resolverFailures"`
+		MetaMatches      uint64 `yaml:"metaMatches"`
+		MetaMisses       uint64 `yaml:"metaMisses"`
+		// RenderWarnings is the number of the templates rendered to
+		// placeholders by best-effort rendering.
+		RenderWarnings uint64 `yaml:"renderWarnings"`
+
+		// The latencies of rendering in millisecond.
+		P50 float64 `yaml:"p50"`
+		P95 float64 `yaml:"p95"`
+		P99 float64 `yaml:"p99"`
+	}
+
+	// stats counts the events of the engine, the counters are updated
+	// atomically because the engine is shared by filters running in parallel.
+	stats struct {
+		renders          uint64
+		cacheHits        uint64
+		cacheMisses      uint64
+		unresolved       uint64
+		gjsonFailures    uint64
+		resolverFailures uint64
+		metaMatches      uint64
+		metaMisses       uint64
+		renderWarnings   uint64
+
+		// NOTE: The sample of go-metrics is goroutine-safe.
+		durationSampler *sampler.DurationSampler
+	}
+)
+
+func newStats() *stats {
+	return &stats{durationSampler: sampler.NewDurationSampler()}
+}
+
+// observeRender counts a rendering started at startAt.
+func (s *stats) observeRender(startAt time.Time) {
+	atomic.AddUint64(&s.renders, 1)
+	s.durationSampler.Update(time.Since(startAt))
+}
+
+func (s *stats) status() *Stats {
+	percentiles := s.durationSampler.Percentiles()
+
+	return &Stats{
+		Renders:          atomic.LoadUint64(&s.renders),
+		CacheHits:        atomic.LoadUint64(&s.cacheHits),
+		CacheMisses:      atomic.LoadUint64(&s.cacheMisses),
+		Unresolved:       atomic.LoadUint64(&s.unresolved),
+		GJSONFailures:    atomic.LoadUint64(&s.gjsonFailures),
+		ResolverFailures: atomic.LoadUint64(&s.resolverFailures),
+		MetaMatches:      atomic.LoadUint64(&s.metaMatches),
+		MetaMisses:       atomic.LoadUint64(&s.metaMisses),
+		RenderWarnings:   atomic.LoadUint64(&s.renderWarnings),
+
+		P50: percentiles[1],
+		P95: percentiles[3],
+		P99: percentiles[5],
+	}
+}
+
+// Stats returns the statistics of rendering.
+func (t TextTemplate) Stats() *Stats {
+	return t.stats.status()
+}
@@ -19,8 +19,13 @@ package texttemplate
 
 import (
 	"fmt"
+	"io"
+	"sort"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	lru "github.com/hashicorp/golang-lru"
 	"github.com/tidwall/gjson"
 	"github.com/valyala/fasttemplate"
 )
@@ -44,9 +49,25 @@ const (
 	// of one template, if chose "{GJSON}", should provide another tag value at that level
 	GJSONTag = "{gjson}"
 
+	// JSONPathTag is the special hardcode tag for indicating JSONPath syntax, it's an
+	// alternative of GJSONTag with the same constraints, e.g. [[filter.{}.req.body.$.items[0].id]]
+	JSONPathTag = "{jsonpath}"
+
+	// RegexpTag is the special hardcode tag for indicating a regular expression with the same
+	// constraints as GJSONTag, the first capture group of the expression is returned, or the
+	// whole match if there's no group, e.g. [[filter.{}.req.path./api/(\w+)/.*]]
+	RegexpTag = "{regexp}"
+
+	// escapeTag is the internal tag which a doubled beginToken is compiled into,
+	// e.g. "[[[[" is rendered as a literal "[[" instead of the beginning of a template
+	escapeTag = "\x00escape\x00"
+
 	DefaultBeginToken = "[["
 	DefaultEndToken   = "]]"
 	DefaultSeparator  = "."
+
+	// compiledCacheSize is the max number of compiled templates cached by one engine
+	compiledCacheSize = 1024
 )
 
 type node struct {
@@ -54,13 +75,36 @@ type node struct {
 	Children []*node
 }
 
-// TemplateEngine is the basic API collection for a template usage
+// TemplateEngine is the basic API collection for a template usage.
+// All methods of the implementers are safe for concurrent use, so the
+// filters running in parallel could share one engine.
 type TemplateEngine interface {
 	// Render Rendering e.g., [[xxx.xx.dd.xx]]'s value is 'value0', [[yyy.www.zzz]]'s value is 'value1'
 	// "aaa-[[xxx.xx.dd.xx]]-bbb 10101-[[yyy.wwww.zzz]]-9292" will be rendered to "aaa-value0-bbb 10101-value1-9292"
-	// Also support GJSON syntax at last tag
+	// Also support GJSON, JSONPath or regexp syntax at last tag
 	Render(input string) (string, error)
 
+	// RenderTo renders input like Render, but streams the result into w
+	// instead of building a string
+	RenderTo(w io.Writer, input string) error
+
+	// RenderMap renders every value of inputs like Render in one pass,
+	// the templates shared by the values are extracted only once
+	RenderMap(inputs map[string]string) (map[string]string, error)
+
+	// RenderStruct renders every string field, element and map value of
+	// the struct pointed by v in place, it walks into nested structs,
+	// pointers, slices and maps
+	RenderStruct(v interface{}) error
+
+	// RenderBestEffort renders input like Render, but the templates failing
+	// to render are rendered to placeholder and reported as warnings
+	RenderBestEffort(input, placeholder string) (string, []string)
+
+	// Diagnose reports how every candidate template in input would be rendered,
+	// it's for debugging and never changes the dictionary
+	Diagnose(input string) ([]TemplateIssue, error)
+
 	// ExtractTemplateRuleMap extracts templates from input string
 	// return map's key is the template, the value is the matched and rendered metaTemplate
 	ExtractTemplateRuleMap(input string) map[string]string
@@ -72,14 +116,44 @@ type TemplateEngine interface {
 	// HasTemplates checks whether it has templates in input string or not
 	HasTemplates(input string) bool
 
-	// MatchMetaTemplate return original template or replace with {gjson} at last tag, "" if not metaTemplate matched
+	// MatchMetaTemplate return original template or replace with {gjson} or {jsonpath} at last tag,
+	// "" if not metaTemplate matched, the format of template is ignored
 	MatchMetaTemplate(template string) string
 
-	// SetDict adds a temaplateRule and its value for later rendering
+	// SetMaxRenderDepth sets the max depth of rendering the templates in dictionary
+	// values recursively, 0 means the values are rendered as is
+	SetMaxRenderDepth(depth int)
+
+	// SetDict adds a temaplateRule and its value for later rendering, the value
+	// could be string, []byte, bool, numbers, fmt.Stringer or fasttemplate.TagFunc,
+	// which is rendered in the format suffix of the template if any, e.g. [[xxx.xx|%.2f]]
 	SetDict(template string, value interface{}) error
 
-	// GetDict returns the template's dictionary
+	// RegisterValidator registers a validator for the values of the meta templates
+	// with the prefix, SetDict rejects the value if the validator fails
+	RegisterValidator(metaTemplatePrefix string, fn ValueValidator) error
+
+	// RegisterResolver registers a resolver for the templates of the meta templates
+	// with the prefix, which is called lazily if the template is not in dictionary
+	RegisterResolver(metaTemplatePrefix string, fn Resolver) error
+
+	// DeleteDict removes the value of the template from the dictionary,
+	// the format of template is ignored
+	DeleteDict(template string)
+
+	// ClearDict removes all values from the dictionary, so a long-lived
+	// engine could be reset between requests
+	ClearDict()
+
+	// GetDict returns a snapshot of the template's dictionary
 	GetDict() map[string]interface{}
+
+	// Stats returns the statistics of rendering and matching meta templates
+	Stats() *Stats
+
+	// CloneDict returns a copy of the dictionary, which could be modified
+	// by the caller without affecting the engine
+	CloneDict() map[string]interface{}
 }
 
 // DummyTemplate return a empty implement
@@ -90,6 +164,31 @@ func (DummyTemplate) Render(input string) (string, error) {
 	return "", nil
 }
 
+// RenderTo dummy implement
+func (DummyTemplate) RenderTo(w io.Writer, input string) error {
+	return nil
+}
+
+// RenderMap dummy implement
+func (DummyTemplate) RenderMap(inputs map[string]string) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+// RenderStruct dummy implement
+func (DummyTemplate) RenderStruct(v interface{}) error {
+	return nil
+}
+
+// RenderBestEffort dummy implement
+func (DummyTemplate) RenderBestEffort(input, placeholder string) (string, []string) {
+	return input, nil
+}
+
+// Diagnose dummy implement
+func (DummyTemplate) Diagnose(input string) ([]TemplateIssue, error) {
+	return nil, nil
+}
+
 // ExtractTemplateRuleMap dummy implement
 func (DummyTemplate) ExtractTemplateRuleMap(input string) map[string]string {
 	m := make(map[string]string, 0)
@@ -102,11 +201,30 @@ func (DummyTemplate) ExtractRawTemplateRuleMap(input string) map[string]string {
 	return m
 }
 
+// SetMaxRenderDepth the dummy implement
+func (DummyTemplate) SetMaxRenderDepth(depth int) {}
+
+// RegisterValidator the dummy implement
+func (DummyTemplate) RegisterValidator(metaTemplatePrefix string, fn ValueValidator) error {
+	return nil
+}
+
+// RegisterResolver the dummy implement
+func (DummyTemplate) RegisterResolver(metaTemplatePrefix string, fn Resolver) error {
+	return nil
+}
+
 // SetDict the dummy implement
 func (DummyTemplate) SetDict(template string, value interface{}) error {
 	return nil
 }
 
+// DeleteDict the dummy implement
+func (DummyTemplate) DeleteDict(template string) {}
+
+// ClearDict the dummy implement
+func (DummyTemplate) ClearDict() {}
+
 // MatchMetaTemplate dummy implement
 func (DummyTemplate) MatchMetaTemplate(template string) string {
 	return ""
@@ -118,6 +236,16 @@ func (DummyTemplate) GetDict() map[string]interface{} {
 	return m
 }
 
+// CloneDict the dummy implement
+func (DummyTemplate) CloneDict() map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+// Stats the dummy implement
+func (DummyTemplate) Stats() *Stats {
+	return &Stats{}
+}
+
 // HasTemplates the dummy implement
 func (DummyTemplate) HasTemplates(input string) bool {
 	return false
@@ -127,14 +255,20 @@ func (DummyTemplate) HasTemplates(input string) bool {
 // template syntax tree for validation, the valid template and its
 // value can be added into dictionary for rendering
 type TextTemplate struct {
-	ft         *fasttemplate.Template
 	beginToken string
 	endToken   string
 	separator  string
 
-	metaTemplates []string               // the user raw input candidate templates
-	root          *node                  // The template syntax tree root node generated by use's input raw templates
-	dict          map[string]interface{} // using `interface{}` for fasttemplate's API
+	metaTemplates []string    // the user raw input candidate templates
+	root          *node       // The template syntax tree root node generated by use's input raw templates
+	dict          *dictionary // the values are using `interface{}` for fasttemplate's API
+	compiled      *lru.Cache  // the compiled fasttemplates keyed by the input string
+	maxDepth      *int32      // the max depth of rendering dictionary values recursively
+	validators    *validators // the validators of values keyed by meta template prefixes
+	resolvers     *resolvers  // the resolvers of values keyed by meta template prefixes
+	stats         *stats      // the statistics of rendering
+
+	builtins map[string]func() string // the builtin templates under BuiltinNamespace
 }
 
 // NewDefault returns Template interface implementer with default config and customize meatTemplates
@@ -144,7 +278,12 @@ func NewDefault(metaTemplates []string) (TemplateEngine, error) {
 		endToken:      DefaultEndToken,
 		separator:     DefaultSeparator,
 		metaTemplates: metaTemplates,
-		dict:          map[string]interface{}{},
+		dict:          newDictionary(),
+		compiled:      newCompiledCache(),
+		maxDepth:      new(int32),
+		validators:    newValidators(),
+		resolvers:     newResolvers(),
+		stats:         newStats(),
 	}
 
 	if err := t.buildTemplateTree(); err != nil {
@@ -166,7 +305,12 @@ func New(beginToken, endToken, separator string, metaTemplates []string) (Templa
 		endToken:      endToken,
 		separator:     separator,
 		metaTemplates: metaTemplates,
-		dict:          map[string]interface{}{},
+		dict:          newDictionary(),
+		compiled:      newCompiledCache(),
+		maxDepth:      new(int32),
+		validators:    newValidators(),
+		resolvers:     newResolvers(),
+		stats:         newStats(),
 	}
 
 	if err := t.buildTemplateTree(); err != nil {
@@ -181,9 +325,26 @@ func NewDummyTemplate() TemplateEngine {
 	return DummyTemplate{}
 }
 
-// GetDict return the dictionary of texttemplate
+// GetDict returns a snapshot of the dictionary of texttemplate
 func (t TextTemplate) GetDict() map[string]interface{} {
-	return t.dict
+	return t.dict.snapshot()
+}
+
+// CloneDict returns a copy of the dictionary of texttemplate
+func (t TextTemplate) CloneDict() map[string]interface{} {
+	return t.dict.snapshot()
+}
+
+// DeleteDict removes the value of the template from the dictionary,
+// the format of template is ignored.
+func (t TextTemplate) DeleteDict(template string) {
+	name, _ := SplitFormat(template)
+	t.dict.delete(name)
+}
+
+// ClearDict removes all values from the dictionary.
+func (t TextTemplate) ClearDict() {
+	t.dict.clear()
 }
 
 func (t *TextTemplate) indexChild(children []*node, target string) int {
@@ -234,6 +395,18 @@ func (t *TextTemplate) validateTree(root *node) error {
 		}
 	}
 
+	if index := t.indexChild(root.Children, JSONPathTag); index != -1 {
+		if len(root.Children) != 1 {
+			return fmt.Errorf("{jsonpath} JSONPath and other tags exist at the same level")
+		}
+	}
+
+	if index := t.indexChild(root.Children, RegexpTag); index != -1 {
+		if len(root.Children) != 1 {
+			return fmt.Errorf("{regexp} regexp and other tags exist at the same level")
+		}
+	}
+
 	for i := 0; i < len(root.Children); i++ {
 		if err := t.validateTree(root.Children[i]); err != nil {
 			return err
@@ -249,6 +422,15 @@ func (t *TextTemplate) buildTemplateTree() error {
 		return fmt.Errorf("empty templates")
 	}
 
+	// NOTE: Copy it to avoid modifying the caller's slice.
+	t.builtins = newBuiltins(t.separator)
+	metaTemplates := append([]string{}, t.metaTemplates...)
+	for template := range t.builtins {
+		metaTemplates = append(metaTemplates, template)
+	}
+	sort.Strings(metaTemplates[len(t.metaTemplates):])
+	t.metaTemplates = metaTemplates
+
 	for _, v := range t.metaTemplates {
 		arr := strings.Split(v, t.separator)
 		if len(arr) == 0 {
@@ -266,6 +448,16 @@ func (t *TextTemplate) buildTemplateTree() error {
 				return fmt.Errorf("invalid %s: GJSON tag should only appear at the ending if need",
 					v)
 			}
+
+			if tag == JSONPathTag && i != len(arr)-1 {
+				return fmt.Errorf("invalid %s: JSONPath tag should only appear at the ending if need",
+					v)
+			}
+
+			if tag == RegexpTag && i != len(arr)-1 {
+				return fmt.Errorf("invalid %s: regexp tag should only appear at the ending if need",
+					v)
+			}
 		}
 	}
 	// every single template is valid
@@ -286,10 +478,25 @@ func (t *TextTemplate) buildTemplateTree() error {
 // if matched found
 //   e.g. template is "filter.abc.req.body.friends.#(last=="Murphy").first" match "filter.{}.req.body.{gjson}"
 //   	will return "filter.abc.req.body.{gjson}"
+//   e.g. template is "filter.abc.req.body.$.friends[0].first" match "filter.{}.req.body.{jsonpath}"
+//   	will return "filter.abc.req.body.{jsonpath}"
+//   e.g. template is "filter.abc.req.path./v1/(\w+)" match "filter.{}.req.path.{regexp}"
+//   	will return "filter.abc.req.path.{regexp}"
 //   e.g. template is "filter.abc.req.body" match "filter.{}.req.body"
 //   	will return "filter.abc.req.body"
 // if not any template matched found, then return ""
 func (t TextTemplate) MatchMetaTemplate(template string) string {
+	metaTemplate := t.matchMetaTemplate(template)
+	if metaTemplate != "" {
+		atomic.AddUint64(&t.stats.metaMatches, 1)
+	} else {
+		atomic.AddUint64(&t.stats.metaMisses, 1)
+	}
+	return metaTemplate
+}
+
+func (t TextTemplate) matchMetaTemplate(template string) string {
+	template, _ = SplitFormat(template)
 	tags := strings.Split(template, t.separator)
 	if len(tags) == 0 {
 		return ""
@@ -297,7 +504,7 @@ func (t TextTemplate) MatchMetaTemplate(template string) string {
 
 	root := t.root
 	index := 0
-	hasGJSON := false
+	syntaxTag := ""
 
 	for ; index < len(tags); index++ {
 		// no tag remain to match, or it's an empty tag
@@ -306,8 +513,8 @@ func (t TextTemplate) MatchMetaTemplate(template string) string {
 		}
 
 		if len(root.Children) == 1 {
-			if root.Children[0].Value == GJSONTag {
-				hasGJSON = true
+			if v := root.Children[0].Value; v == GJSONTag || v == JSONPathTag || v == RegexpTag {
+				syntaxTag = root.Children[0].Value
 				break
 			}
 			if root.Children[0].Value == WidecardTag || root.Children[0].Value == tags[index] {
@@ -326,14 +533,16 @@ func (t TextTemplate) MatchMetaTemplate(template string) string {
 		}
 	}
 
-	if hasGJSON {
-		// replace left gjson syntax with GJSONTag
-		return strings.Join(tags[:index], t.separator) + t.separator + GJSONTag
+	if syntaxTag != "" {
+		// replace left gjson/jsonpath/regexp syntax with the tag
+		return strings.Join(tags[:index], t.separator) + t.separator + syntaxTag
 	}
 
 	return template
 }
 
+// extractVarsAroundToken extracts the candidate templates, the template of
+// a condition is extracted from its if directive, other directives are skipped.
 func (t TextTemplate) extractVarsAroundToken(input string) []string {
 	arr := []string{}
 	for len(input) != 0 {
@@ -343,21 +552,40 @@ func (t TextTemplate) extractVarsAroundToken(input string) []string {
 		}
 
 		input = input[bIdx+len(t.beginToken):] // jump over the beginning token
+		if strings.HasPrefix(input, t.beginToken) {
+			// a doubled beginning token is an escaped literal, not a template
+			input = input[len(t.beginToken):]
+			continue
+		}
+
 		eIdx := strings.Index(input, t.endToken)
 
 		if eIdx == -1 {
 			break
 		}
 
-		arr = append(arr, input[:eIdx])
+		tag := input[:eIdx]
 		input = input[eIdx:]
+
+		if condition, ok := conditionTemplate(tag); ok {
+			tag = condition
+		} else if target, ok := rangeTemplate(tag); ok {
+			tag = target
+		} else if tag == ElseDirective || tag == EndDirective || tag == SeparatorDirective {
+			continue
+		}
+		// the elements of range blocks are not in dictionary
+		if isScopeTag(tag, t.separator) {
+			continue
+		}
+		arr = append(arr, tag)
 	}
 
 	return arr
 }
 
 // ExtractTemplateRuleMap extracts candidate templates from input string
-// return map's key is the candidate template, the value is the matched template
+// return map's key is the candidate template without format, the value is the matched template
 func (t TextTemplate) ExtractTemplateRuleMap(input string) map[string]string {
 	results := t.extractVarsAroundToken(input)
 	m := map[string]string{}
@@ -366,7 +594,8 @@ func (t TextTemplate) ExtractTemplateRuleMap(input string) map[string]string {
 		metaTemplate := t.MatchMetaTemplate(v)
 
 		if len(metaTemplate) != 0 {
-			m[v] = metaTemplate
+			name, _ := SplitFormat(v)
+			m[name] = metaTemplate
 		}
 	}
 
@@ -374,49 +603,103 @@ func (t TextTemplate) ExtractTemplateRuleMap(input string) map[string]string {
 }
 
 // ExtractRawTemplateRuleMap extracts all candidate templates (valid/invalid)
-// from input string
+// without format from input string
 func (t TextTemplate) ExtractRawTemplateRuleMap(input string) map[string]string {
 	results := t.extractVarsAroundToken(input)
 	m := map[string]string{}
 
 	for _, v := range results {
 		metaTemplate := t.MatchMetaTemplate(v)
+		name, _ := SplitFormat(v)
 
 		if len(metaTemplate) != 0 {
-			m[v] = metaTemplate
+			m[name] = metaTemplate
 		} else {
-			m[v] = ""
+			m[name] = ""
 		}
 	}
 
 	return m
 }
 
-// SetDict adds a templateRule into dictionary if it contains any templates.
+// SetDict adds a templateRule into dictionary if it contains any templates,
+// the format of template is ignored.
 func (t TextTemplate) SetDict(template string, value interface{}) error {
+	if err := validateValue(value); err != nil {
+		return fmt.Errorf("template %s: %v", template, err)
+	}
+
 	if tmp := t.MatchMetaTemplate(template); len(tmp) != 0 {
-		t.dict[template] = value
+		if err := t.validate(template, value); err != nil {
+			return err
+		}
+		name, _ := SplitFormat(template)
+		t.dict.set(name, value)
 		return nil
 	}
 
 	return fmt.Errorf("matched none template , input %s ", template)
 }
 
+// splitSyntax splits the template matched a meta template ending with
+// syntaxTag into the key of the syntax target in dictionary and the syntax.
+func (t TextTemplate) splitSyntax(template, metaTemplate, syntaxTag string) (key, syntax string) {
+	key = strings.TrimSuffix(metaTemplate, t.separator+syntaxTag)
+	syntax = strings.TrimPrefix(template, key+t.separator)
+	return key, syntax
+}
+
 func (t *TextTemplate) setWithGJSON(template, metaTemplate string) error {
-	keyIndict := strings.TrimRight(metaTemplate, t.separator+GJSONTag)
-	gjsonSyntax := strings.TrimPrefix(template, keyIndict+t.separator)
+	keyIndict, gjsonSyntax := t.splitSyntax(template, metaTemplate, GJSONTag)
 
-	if valueForGJSON, exist := t.dict[keyIndict]; exist {
-		if err := t.SetDict(template, gjson.Get(valueForGJSON.(string), gjsonSyntax).String()); err != nil {
+	if valueForGJSON, exist := t.stringValue(keyIndict); exist {
+		result := gjson.Get(valueForGJSON, gjsonSyntax)
+		if !result.Exists() {
+			atomic.AddUint64(&t.stats.gjsonFailures, 1)
+		}
+		if err := t.SetDict(template, result.String()); err != nil {
 			return err
 		}
 	} else {
+		atomic.AddUint64(&t.stats.gjsonFailures, 1)
 		return fmt.Errorf("set gjson found no syntax target, template %s", template)
 	}
 
 	return nil
 }
 
+func (t *TextTemplate) setWithJSONPath(template, metaTemplate string) error {
+	keyIndict, jsonPathSyntax := t.splitSyntax(template, metaTemplate, JSONPathTag)
+
+	valueForJSONPath, exist := t.stringValue(keyIndict)
+	if !exist {
+		return fmt.Errorf("set jsonpath found no syntax target, template %s", template)
+	}
+
+	value, err := getJSONPath(valueForJSONPath, jsonPathSyntax)
+	if err != nil {
+		return fmt.Errorf("template %s: %v", template, err)
+	}
+
+	return t.SetDict(template, value)
+}
+
+func (t *TextTemplate) setWithRegexp(template, metaTemplate string) error {
+	keyIndict, regexpSyntax := t.splitSyntax(template, metaTemplate, RegexpTag)
+
+	valueForRegexp, exist := t.stringValue(keyIndict)
+	if !exist {
+		return fmt.Errorf("set regexp found no syntax target, template %s", template)
+	}
+
+	value, err := getRegexp(valueForRegexp, regexpSyntax)
+	if err != nil {
+		return fmt.Errorf("template %s: %v", template, err)
+	}
+
+	return t.SetDict(template, value)
+}
+
 // HasTemplates check a string contain any valid templates
 func (t TextTemplate) HasTemplates(input string) bool {
 	return len(t.ExtractTemplateRuleMap(input)) != 0
@@ -425,27 +708,212 @@ func (t TextTemplate) HasTemplates(input string) bool {
 // Render uses a fasttemplate and dictionary to rendering
 //  e.g., [[xxx.xx.dd.xx]]'s value in dictionary is 'value0', [[yyy.www.zzz]]'s value is 'value1'
 // "aaa-[[xxx.xx.dd.xx]]-bbb 10101-[[yyy.wwww.zzz]]-9292" will be rendered to "aaa-value0-bbb 10101-value1-9292"
-// if containers any new GJSON syntax, it will use 'gjson.Get' to extract result then store into dictionary before
+// a doubled beginning token is an escaped literal, "aaa-[[[[xxx.xx.dd.xx]]" will be rendered to "aaa-[[xxx.xx.dd.xx]]"
+// if containers any new GJSON, JSONPath or regexp syntax, it will extract the result then store into dictionary before
 // rendering
+// a conditional block "[[if xxx.xx]]aaa[[else]]bbb[[end]]" will be rendered to "aaa" if the value of [[xxx.xx]] is not empty,
+// otherwise "bbb", the else part is optional
+// a range block "[[range xxx.{gjson}]][[item]][[separator]],[[end]]" will be rendered to "a,b" if the value of
+// [[xxx.{gjson}]] is ["a","b"], [[index]] is the index of the element and [[item.yy]] is the GJSON path yy of the element
 func (t TextTemplate) Render(input string) (string, error) {
-	templateMap := t.ExtractTemplateRuleMap(input)
+	defer t.stats.observeRender(time.Now())
+
+	input, err := t.resolveBlocks(input)
+	if err != nil {
+		return "", err
+	}
+
+	hasTemplates, err := t.prepareDict(input)
+	if err != nil {
+		return "", err
+	}
 
 	// find no template to render
+	if !hasTemplates {
+		return t.unescape(input), nil
+	}
+
+	return t.compile(input).ExecuteFuncString(t.writeTag), nil
+}
+
+// RenderTo renders input like Render, but writes the result into w by
+// fasttemplate's Execute, which avoids building the whole output in memory.
+func (t TextTemplate) RenderTo(w io.Writer, input string) error {
+	defer t.stats.observeRender(time.Now())
+
+	input, err := t.resolveBlocks(input)
+	if err != nil {
+		return err
+	}
+
+	hasTemplates, err := t.prepareDict(input)
+	if err != nil {
+		return err
+	}
+
+	if !hasTemplates {
+		_, err = io.WriteString(w, t.unescape(input))
+		return err
+	}
+
+	_, err = t.compile(input).ExecuteFunc(w, t.writeTag)
+	return err
+}
+
+// prepareDict extracts the templates of input and stores the result of new
+// GJSON, JSONPath or regexp syntax into dictionary, it returns false if there's no template in input.
+func (t *TextTemplate) prepareDict(input string) (bool, error) {
+	templateMap := t.ExtractTemplateRuleMap(input)
 	if len(templateMap) == 0 {
-		return input, nil
+		return false, nil
 	}
 
+	if err := t.prepareTemplates(templateMap); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// prepareTemplates stores the result of new GJSON, JSONPath or regexp syntax
+// of the extracted templates into dictionary.
+func (t *TextTemplate) prepareTemplates(templateMap map[string]string) error {
 	for k, v := range templateMap {
-		// has new gjson syntax, add manually
-		if strings.Contains(v, GJSONTag) {
-			if _, exist := t.dict[k]; !exist {
-				if err := t.setWithGJSON(k, v); err != nil {
-					return "", err
-				}
+		if _, exist := t.dict.get(k); exist {
+			continue
+		}
+
+		// has new gjson/jsonpath/regexp syntax, add manually
+		switch {
+		case strings.HasSuffix(v, GJSONTag):
+			if err := t.setWithGJSON(k, v); err != nil {
+				return err
+			}
+		case strings.HasSuffix(v, JSONPathTag):
+			if err := t.setWithJSONPath(k, v); err != nil {
+				return err
+			}
+		case strings.HasSuffix(v, RegexpTag):
+			if err := t.setWithRegexp(k, v); err != nil {
+				return err
 			}
 		}
 	}
 
-	t.ft = fasttemplate.New(input, t.beginToken, t.endToken)
-	return t.ft.ExecuteString(t.dict), nil
+	return nil
+}
+
+func newCompiledCache() *lru.Cache {
+	cache, err := lru.New(compiledCacheSize)
+	if err != nil {
+		panic(fmt.Errorf("BUG: new lru cache failed: %v", err))
+	}
+	return cache
+}
+
+// compile returns the compiled fasttemplate of input, most filters render
+// the same small set of inputs, so the compiled ones are cached to avoid
+// parsing them on every rendering.
+func (t TextTemplate) compile(input string) *fasttemplate.Template {
+	if ft, exists := t.compiled.Get(input); exists {
+		atomic.AddUint64(&t.stats.cacheHits, 1)
+		return ft.(*fasttemplate.Template)
+	}
+	atomic.AddUint64(&t.stats.cacheMisses, 1)
+
+	ft := fasttemplate.New(t.escape(input), t.beginToken, t.endToken)
+	t.compiled.Add(input, ft)
+	return ft
+}
+
+// SetMaxRenderDepth sets the max depth of rendering dictionary values recursively,
+// e.g. with depth 1, the value "http://[[filter.abc.req.host]]/" of a template is
+// rendered with the value of filter.abc.req.host, but the templates in the latter
+// are rendered as is.
+func (t TextTemplate) SetMaxRenderDepth(depth int) {
+	if depth < 0 {
+		depth = 0
+	}
+	atomic.StoreInt32(t.maxDepth, int32(depth))
+}
+
+// writeValue writes the dictionary value into w, it's rendered as a template
+// if it contains templates and the max depth is not reached.
+func (t TextTemplate) writeValue(w io.Writer, value string, depth int) (int, error) {
+	if depth >= int(atomic.LoadInt32(t.maxDepth)) {
+		return io.WriteString(w, value)
+	}
+
+	// NOTE: fasttemplate panics on errors of the tag function,
+	// so the value is written as is if it fails to prepare.
+	resolved, err := t.resolveBlocks(value)
+	if err != nil {
+		return io.WriteString(w, value)
+	}
+	value = resolved
+
+	hasTemplates, err := t.prepareDict(value)
+	if err != nil {
+		return io.WriteString(w, value)
+	}
+	if !hasTemplates {
+		return io.WriteString(w, t.unescape(value))
+	}
+
+	n, err := t.compile(value).ExecuteFunc(w, func(w io.Writer, tag string) (int, error) {
+		return t.writeTagDepth(w, tag, depth+1)
+	})
+	return int(n), err
+}
+
+// escape replaces every doubled beginToken with the escapeTag, so that
+// fasttemplate treats it as a tag which writeTag renders as a literal beginToken.
+func (t TextTemplate) escape(input string) string {
+	return strings.ReplaceAll(input, t.beginToken+t.beginToken, t.beginToken+escapeTag+t.endToken)
+}
+
+// unescape replaces every doubled beginToken with a literal beginToken.
+func (t TextTemplate) unescape(input string) string {
+	return strings.ReplaceAll(input, t.beginToken+t.beginToken, t.beginToken)
+}
+
+// writeTag writes the value of tag in dictionary into w, it follows
+// the behavior of fasttemplate's map based executing but looks up the
+// dictionary under lock.
+func (t TextTemplate) writeTag(w io.Writer, tag string) (int, error) {
+	return t.writeTagDepth(w, tag, 0)
+}
+
+// writeTagDepth writes the value of tag like writeTag, the string value
+// containing templates is rendered recursively until the max depth.
+func (t TextTemplate) writeTagDepth(w io.Writer, tag string, depth int) (int, error) {
+	if tag == escapeTag {
+		return io.WriteString(w, t.beginToken)
+	}
+
+	name, format := SplitFormat(tag)
+	value, exists := t.lookup(name)
+	if !exists {
+		atomic.AddUint64(&t.stats.unresolved, 1)
+		return 0, nil
+	}
+
+	if format != "" {
+		return t.writeFormatted(w, name, format, value, depth)
+	}
+	return t.writeLookedUp(w, name, value, depth)
+}
+
+// writeLookedUp writes the value of the template name without format.
+func (t TextTemplate) writeLookedUp(w io.Writer, name string, value interface{}, depth int) (int, error) {
+	switch v := value.(type) {
+	case string:
+		return t.writeValue(w, v, depth)
+	case []byte:
+		return t.writeValue(w, string(v), depth)
+	case fasttemplate.TagFunc:
+		return v(w, name)
+	default:
+		return fmt.Fprintf(w, "%v", v)
+	}
 }
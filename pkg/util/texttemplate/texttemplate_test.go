@@ -18,7 +18,13 @@
 package texttemplate
 
 import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewFailed(t *testing.T) {
@@ -726,3 +732,817 @@ func TestNewTextTemplateExtractRawTemplateRuleMapEmpty(t *testing.T) {
 		t.Fatalf("extract from input %s no match expect, should extract two target", input)
 	}
 }
+
+func TestTextTemplate_renderTo(t *testing.T) {
+	tt, err := NewDefault([]string{
+		"filter.{}.req.body",
+		"filter.{}.req.body.{gjson}",
+	})
+	if err != nil {
+		t.Fatalf("new engine failed err %v", err)
+	}
+
+	if err = tt.SetDict("filter.abc.req.body", "{\"aaa\":\"bbb\"}"); err != nil {
+		t.Fatalf("set failed err %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	input := "001010-[[filter.abc.req.body.aaa]]--02020"
+	expect := "001010-bbb--02020"
+	if err := tt.RenderTo(buf, input); err != nil || buf.String() != expect {
+		t.Fatalf("input %s, expect %s , after rending %s, err %v", input, expect, buf.String(), err)
+	}
+
+	buf.Reset()
+	input = "nothing to render"
+	if err := tt.RenderTo(buf, input); err != nil || buf.String() != input {
+		t.Fatalf("input %s, expect %s , after rending %s, err %v", input, input, buf.String(), err)
+	}
+
+	if err := NewDummyTemplate().RenderTo(buf, input); err != nil {
+		t.Errorf("dummy template render failed: %v", err)
+	}
+}
+
+func TestTextTemplate_concurrent(t *testing.T) {
+	tt, err := NewDefault([]string{
+		"filter.{}.req.body",
+		"filter.{}.req.body.{gjson}",
+	})
+	if err != nil {
+		t.Fatalf("new engine failed err %v", err)
+	}
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("filter.f%d.req.body", i)
+			for j := 0; j < 100; j++ {
+				if err := tt.SetDict(name, fmt.Sprintf("{\"n\":%d}", j)); err != nil {
+					t.Errorf("set failed err %v", err)
+				}
+				if _, err := tt.Render("[[" + name + "]]-[[filter.f0.req.body]]"); err != nil {
+					t.Errorf("rendering failed err %v", err)
+				}
+				tt.GetDict()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if s, _ := tt.Render("[[filter.f1.req.body]]"); s != "{\"n\":99}" {
+		t.Errorf("unexpected rendering result %s", s)
+	}
+}
+
+func TestTextTemplate_compiledCache(t *testing.T) {
+	te, err := NewDefault([]string{"filter.{}.req.body"})
+	if err != nil {
+		t.Fatalf("new engine failed err %v", err)
+	}
+	tt := te.(TextTemplate)
+
+	if err = tt.SetDict("filter.abc.req.body", "kkk"); err != nil {
+		t.Fatalf("set failed err %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if s, _ := tt.Render("xxx-[[filter.abc.req.body]]"); s != "xxx-kkk" {
+			t.Fatalf("rendering fail , result is %s expect xxx-kkk", s)
+		}
+	}
+	if n := tt.compiled.Len(); n != 1 {
+		t.Errorf("expect 1 compiled template, got %d", n)
+	}
+
+	tt.Render("nothing to render")
+	if n := tt.compiled.Len(); n != 1 {
+		t.Errorf("input without templates should not be compiled, got %d", n)
+	}
+}
+
+func TestNewTextTemplateRenderJSONPath(t *testing.T) {
+	tt, err := NewDefault([]string{
+		"filter.{}.req.body",
+		"filter.{}.req.body.{jsonpath}",
+		"filter.{}.rsp.body",
+		"filter.{}.rsp.body.{gjson}",
+	})
+	if err != nil {
+		t.Fatalf("new engine failed err %v", err)
+	}
+
+	body := `{"store":{"book":[{"author":"Nigel","price":8},{"author":"Evelyn","price":12}],"name":"abc"}}`
+	if err = tt.SetDict("filter.abc.req.body", body); err != nil {
+		t.Fatalf("set failed err %v", err)
+	}
+	if err = tt.SetDict("filter.abc.rsp.body", body); err != nil {
+		t.Fatalf("set failed err %v", err)
+	}
+
+	cases := map[string]string{
+		"[[filter.abc.req.body.$.store.name]]":                                "abc",
+		"[[filter.abc.req.body.$.store.book[1].author]]":                      "Evelyn",
+		"[[filter.abc.req.body.$.store.book[*].author]]":                      `["Nigel","Evelyn"]`,
+		"[[filter.abc.req.body.$..price]]":                                    "[8,12]",
+		"[[filter.abc.req.body.$.store.book[?(@.author==\"Evelyn\")].price]]": "12",
+		"[[filter.abc.req.body.$.store.missing]]":                             "",
+		"[[filter.abc.rsp.body.store.book.1.author]]":                         "Evelyn",
+	}
+
+	for input, expect := range cases {
+		if s, err := tt.Render(input); s != expect || err != nil {
+			t.Errorf("input %s, expect %s, after rendering %s, err %v", input, expect, s, err)
+		}
+	}
+
+	if _, err := tt.Render("[[filter.abc.req.body.$.store.book[?(@.price<]]"); err == nil {
+		t.Errorf("render invalid jsonpath should failed")
+	}
+}
+
+func TestNewTextTemplateErrJSONPath(t *testing.T) {
+	for _, metaTemplates := range [][]string{
+		{"filter.{}.req.{jsonpath}.body"},
+		{"filter.{}.req.body.{jsonpath}", "filter.{}.req.body.{gjson}"},
+	} {
+		if tt, err := NewDefault(metaTemplates); err == nil {
+			t.Fatalf("new engine should failed, but succ %v, tt %v", err, tt)
+		}
+	}
+}
+
+func TestNewTextTemplateRenderEscape(t *testing.T) {
+	tt, err := NewDefault([]string{
+		"filter.{}.req.path",
+	})
+	if err != nil {
+		t.Fatalf("new engine failed err %v", err)
+	}
+
+	if err = tt.SetDict("filter.abc.req.path", "/pets"); err != nil {
+		t.Fatalf("set failed err %v", err)
+	}
+
+	cases := map[string]string{
+		"a-[[[[filter.abc.req.path]]-b":                       "a-[[filter.abc.req.path]]-b",
+		"a-[[[[filter.abc.req.path]]-[[filter.abc.req.path]]": "a-[[filter.abc.req.path]]-/pets",
+		"a-[[[[[[filter.abc.req.path]]-b":                     "a-[[/pets-b",
+		"[[[[ only literal":                                   "[[ only literal",
+	}
+
+	for input, expect := range cases {
+		if s, err := tt.Render(input); s != expect || err != nil {
+			t.Errorf("input %s, expect %s, after rendering %s, err %v", input, expect, s, err)
+		}
+
+		buff := bytes.NewBuffer(nil)
+		if err := tt.RenderTo(buff, input); buff.String() != expect || err != nil {
+			t.Errorf("input %s, expect %s, after rendering to writer %s, err %v", input, expect, buff.String(), err)
+		}
+	}
+
+	m := tt.ExtractTemplateRuleMap("a-[[[[filter.abc.req.path]]-b")
+	if len(m) != 0 {
+		t.Errorf("escaped template should not be extracted, but got %v", m)
+	}
+	if tt.HasTemplates("[[[[filter.abc.req.path]]") {
+		t.Errorf("escaped template should not be treated as template")
+	}
+}
+
+func TestRenderMapAndStruct(t *testing.T) {
+	tt, err := NewDefault([]string{
+		"filter.{}.req.path",
+		"filter.{}.req.body",
+		"filter.{}.req.body.{gjson}",
+	})
+	if err != nil {
+		t.Fatalf("new engine failed err %v", err)
+	}
+
+	tt.SetDict("filter.abc.req.path", "/pets")
+	tt.SetDict("filter.abc.req.body", `{"id":"1001","name":"kitty"}`)
+
+	results, err := tt.RenderMap(map[string]string{
+		"path":   "[[filter.abc.req.path]]/[[filter.abc.req.body.id]]",
+		"header": "[[filter.abc.req.body.name]]",
+		"plain":  "no [[[[templates]]",
+	})
+	if err != nil {
+		t.Fatalf("render map failed: %v", err)
+	}
+	expect := map[string]string{
+		"path":   "/pets/1001",
+		"header": "kitty",
+		"plain":  "no [[templates]]",
+	}
+	for k, v := range expect {
+		if results[k] != v {
+			t.Errorf("key %s: expect %s, got %s", k, v, results[k])
+		}
+	}
+
+	type inner struct {
+		Name string
+	}
+	type adaptor struct {
+		Path     string
+		Headers  map[string]string
+		Tags     []string
+		Inner    *inner
+		internal string
+	}
+
+	a := &adaptor{
+		Path:     "[[filter.abc.req.path]]",
+		Headers:  map[string]string{"X-Id": "[[filter.abc.req.body.id]]"},
+		Tags:     []string{"[[filter.abc.req.body.name]]", "static"},
+		Inner:    &inner{Name: "[[filter.abc.req.body.name]]"},
+		internal: "[[filter.abc.req.path]]",
+	}
+	if err := tt.RenderStruct(a); err != nil {
+		t.Fatalf("render struct failed: %v", err)
+	}
+	if a.Path != "/pets" || a.Headers["X-Id"] != "1001" || a.Tags[0] != "kitty" ||
+		a.Tags[1] != "static" || a.Inner.Name != "kitty" || a.internal != "[[filter.abc.req.path]]" {
+		t.Errorf("unexpected rendered struct: %+v, inner %+v", a, a.Inner)
+	}
+
+	if err := tt.RenderStruct(*a); err == nil {
+		t.Errorf("render struct by value should fail")
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	tt, err := NewDefault([]string{
+		"filter.{}.req.path",
+		"filter.{}.req.body",
+		"filter.{}.req.body.{gjson}",
+	})
+	if err != nil {
+		t.Fatalf("new engine failed err %v", err)
+	}
+
+	tt.SetDict("filter.abc.req.path", "/pets")
+	tt.SetDict("filter.abc.req.body", `{"id":"1001"}`)
+
+	issues, err := tt.Diagnose("[[filter.abc.req.path]] [[filter.xyz.req.path]] [[filter.abc.req.body.id]] " +
+		"[[filter.xyz.req.body.id]] [[unknown.tag]] [[filter.abc.req.path]]")
+	if err != nil {
+		t.Fatalf("diagnose failed: %v", err)
+	}
+	if len(issues) != 5 {
+		t.Fatalf("expect 5 issues, got %+v", issues)
+	}
+
+	if !issues[0].Matched || !issues[0].DictSet || issues[0].Message != "" {
+		t.Errorf("unexpected issue %+v", issues[0])
+	}
+	if !issues[1].Matched || issues[1].DictSet || issues[1].Message == "" {
+		t.Errorf("unexpected issue %+v", issues[1])
+	}
+	if issues[2].SyntaxTag != GJSONTag || issues[2].SyntaxTarget != "filter.abc.req.body" ||
+		issues[2].Syntax != "id" || !issues[2].SyntaxTargetSet {
+		t.Errorf("unexpected issue %+v", issues[2])
+	}
+	if issues[3].SyntaxTargetSet || issues[3].Message == "" {
+		t.Errorf("unexpected issue %+v", issues[3])
+	}
+	if issues[4].Matched || issues[4].Message == "" {
+		t.Errorf("unexpected issue %+v", issues[4])
+	}
+
+	if _, exists := tt.GetDict()["filter.abc.req.body.id"]; exists {
+		t.Errorf("diagnose should not change the dictionary")
+	}
+
+	if _, err := tt.Diagnose("[[[[escaped]] [[filter.abc.req.path"); err == nil {
+		t.Errorf("diagnose unterminated token should fail")
+	}
+}
+
+func TestRenderRecursively(t *testing.T) {
+	tt, err := NewDefault([]string{
+		"filter.{}.req.host",
+		"filter.{}.req.body",
+		"filter.{}.req.body.{gjson}",
+		"vars.{}",
+	})
+	if err != nil {
+		t.Fatalf("new engine failed err %v", err)
+	}
+
+	tt.SetDict("filter.abc.req.host", "example.com")
+	tt.SetDict("filter.abc.req.body", `{"id":"1001"}`)
+	tt.SetDict("vars.url", "http://[[filter.abc.req.host]]/pets/[[filter.abc.req.body.id]]")
+	tt.SetDict("vars.link", "<[[vars.url]]>")
+	tt.SetDict("vars.loop", "[[vars.loop]]!")
+
+	input := "[[vars.link]]"
+	if s, _ := tt.Render(input); s != "<[[vars.url]]>" {
+		t.Errorf("values should not be rendered by default, got %s", s)
+	}
+
+	tt.SetMaxRenderDepth(1)
+	if s, _ := tt.Render(input); s != "<http://[[filter.abc.req.host]]/pets/[[filter.abc.req.body.id]]>" {
+		t.Errorf("values should be rendered only once, got %s", s)
+	}
+
+	tt.SetMaxRenderDepth(2)
+	if s, _ := tt.Render(input); s != "<http://example.com/pets/1001>" {
+		t.Errorf("values should be rendered recursively, got %s", s)
+	}
+
+	tt.SetMaxRenderDepth(3)
+	if s, _ := tt.Render("[[vars.loop]]"); s != "[[vars.loop]]!!!!" {
+		t.Errorf("recursion should stop at the max depth, got %s", s)
+	}
+}
+
+func TestNewTextTemplateRenderRegexp(t *testing.T) {
+	tt, err := NewDefault([]string{
+		"filter.{}.req.path",
+		"filter.{}.req.path.{regexp}",
+		"filter.{}.req.header.{}",
+		"filter.{}.req.header.{}.{regexp}",
+	})
+	if err != nil {
+		t.Fatalf("new engine failed err %v", err)
+	}
+
+	if err = tt.SetDict("filter.abc.req.path", "/api/v2/pets/1001"); err != nil {
+		t.Fatalf("set failed err %v", err)
+	}
+	if err = tt.SetDict("filter.abc.req.header.Authorization", "Bearer abc.def"); err != nil {
+		t.Fatalf("set failed err %v", err)
+	}
+
+	cases := map[string]string{
+		"[[filter.abc.req.path]]":                              "/api/v2/pets/1001",
+		"[[filter.abc.req.path./api/(v\\d+)/]]":                "v2",
+		"[[filter.abc.req.path./pets/(\\d+)$]]":                "1001",
+		"[[filter.abc.req.path.\\d+$]]":                        "1001",
+		"[[filter.abc.req.path./users/(\\d+)]]":                "",
+		"[[filter.abc.req.header.Authorization.^Bearer (.+)]]": "abc.def",
+	}
+
+	for input, expect := range cases {
+		if s, err := tt.Render(input); s != expect || err != nil {
+			t.Errorf("input %s, expect %s, after rendering %s, err %v", input, expect, s, err)
+		}
+	}
+
+	if _, err := tt.Render("[[filter.abc.req.path./api/(v\\d+]]"); err == nil {
+		t.Errorf("render invalid regexp should failed")
+	}
+	if _, err := tt.Render("[[filter.abc.req.header.Cookie.(.*)]]"); err == nil {
+		t.Errorf("render regexp without syntax target should failed")
+	}
+}
+
+func TestNewTextTemplateErrRegexp(t *testing.T) {
+	for _, metaTemplates := range [][]string{
+		{"filter.{}.req.{regexp}.path"},
+		{"filter.{}.req.path.{regexp}", "filter.{}.req.path.{gjson}"},
+	} {
+		if tt, err := NewDefault(metaTemplates); err == nil {
+			t.Fatalf("new engine should failed, but succ %v, tt %v", err, tt)
+		}
+	}
+}
+
+func TestRenderBuiltin(t *testing.T) {
+	metaTemplates := []string{"filter.{}.req.path"}
+	tt, err := NewDefault(metaTemplates)
+	if err != nil {
+		t.Fatalf("new engine failed err %v", err)
+	}
+	if len(metaTemplates) != 1 {
+		t.Fatalf("meta templates of caller should not be modified, got %v", metaTemplates)
+	}
+
+	s, err := tt.Render("[[sys.time.unix]]")
+	if unix, _ := strconv.ParseInt(s, 10, 64); err != nil || time.Now().Unix()-unix > 1 {
+		t.Errorf("unexpected sys.time.unix %s, err %v", s, err)
+	}
+
+	s, err = tt.Render("[[sys.time.rfc3339]]")
+	if _, e := time.Parse(time.RFC3339, s); err != nil || e != nil {
+		t.Errorf("unexpected sys.time.rfc3339 %s, err %v", s, err)
+	}
+
+	s, err = tt.Render("[[sys.uuid]]/[[sys.uuid]]")
+	if ids := strings.Split(s, "/"); err != nil || len(ids[0]) != 36 || ids[0] == ids[1] {
+		t.Errorf("unexpected sys.uuid %s, err %v", s, err)
+	}
+
+	s, err = tt.Render("[[sys.rand.int]]")
+	if _, e := strconv.ParseInt(s, 10, 64); err != nil || e != nil {
+		t.Errorf("unexpected sys.rand.int %s, err %v", s, err)
+	}
+
+	if tt.MatchMetaTemplate("sys.time.unixmilli") == "" {
+		t.Errorf("sys.time.unixmilli should be matched")
+	}
+	if s, _ := tt.Render("[[sys.time.unknown]]"); s != "[[sys.time.unknown]]" {
+		t.Errorf("unknown builtin template should be rendered as is, got %s", s)
+	}
+
+	tt, err = New("{{", "}}", "/", []string{"filter/{}/req/path"})
+	if err != nil {
+		t.Fatalf("new engine failed err %v", err)
+	}
+	if s, _ := tt.Render("{{sys/uuid}}"); len(s) != 36 {
+		t.Errorf("unexpected sys/uuid %s", s)
+	}
+
+	if _, err = NewDefault([]string{"sys.{}"}); err == nil {
+		t.Errorf("new engine with conflicted builtin templates should fail")
+	}
+}
+
+type stringer struct{}
+
+func (stringer) String() string { return "stringer" }
+
+func TestRenderTypedValues(t *testing.T) {
+	tt, err := NewDefault([]string{
+		"filter.{}.rsp.{}",
+		"filter.{}.req.body.{gjson}",
+		"filter.{}.req.body",
+	})
+	if err != nil {
+		t.Fatalf("new engine failed err %v", err)
+	}
+
+	values := map[string]interface{}{
+		"filter.abc.rsp.code":    200,
+		"filter.abc.rsp.latency": 12.3456,
+		"filter.abc.rsp.ok":      true,
+		"filter.abc.rsp.size":    uint64(1024),
+		"filter.abc.rsp.data":    []byte("data"),
+		"filter.abc.rsp.name":    stringer{},
+		"filter.abc.req.body":    []byte(`{"id":"1001"}`),
+	}
+	for k, v := range values {
+		if err := tt.SetDict(k, v); err != nil {
+			t.Fatalf("set %s failed err %v", k, err)
+		}
+	}
+
+	if err := tt.SetDict("filter.abc.rsp.map", map[string]string{}); err == nil {
+		t.Errorf("set unsupported value should fail")
+	}
+	if err := tt.SetDict("filter.abc.rsp.format|%d", 1); err != nil {
+		t.Errorf("set with format failed err %v", err)
+	}
+
+	cases := map[string]string{
+		"[[filter.abc.rsp.code]]":             "200",
+		"[[filter.abc.rsp.code|%05d]]":        "00200",
+		"[[filter.abc.rsp.latency|%.2f]]":     "12.35",
+		"[[filter.abc.rsp.ok]]":               "true",
+		"[[filter.abc.rsp.size|%x]]":          "400",
+		"[[filter.abc.rsp.data]]":             "data",
+		"[[filter.abc.rsp.data|%q]]":          `"data"`,
+		"[[filter.abc.rsp.name|%8s]]":         "stringer",
+		"[[filter.abc.rsp.format]]":           "1",
+		"[[filter.abc.req.body.id]]":          "1001",
+		"[[filter.abc.req.body.id|%6s]]":      "  1001",
+		"[[filter.abc.req.body.@this|@ugly]]": `{"id":"1001"}`,
+	}
+	for input, expect := range cases {
+		if s, err := tt.Render(input); s != expect || err != nil {
+			t.Errorf("input %s, expect %q, after rendering %q, err %v", input, expect, s, err)
+		}
+	}
+
+	if name, format := SplitFormat("filter.abc.req.path./(a|b)"); name != "filter.abc.req.path./(a|b)" || format != "" {
+		t.Errorf("unexpected split result %s %s", name, format)
+	}
+}
+
+func TestRenderConditions(t *testing.T) {
+	tt, err := NewDefault([]string{
+		"filter.{}.req.header.{}",
+		"filter.{}.req.body",
+		"filter.{}.req.body.{gjson}",
+	})
+	if err != nil {
+		t.Fatalf("new engine failed err %v", err)
+	}
+
+	tt.SetDict("filter.abc.req.header.X-Debug", "1")
+	tt.SetDict("filter.abc.req.header.X-Empty", "")
+	tt.SetDict("filter.abc.req.body", `{"user":{"name":"bob"}}`)
+
+	cases := map[string]string{
+		"a[[if filter.abc.req.header.X-Debug]]-debug[[end]]":                              "a-debug",
+		"a[[if filter.abc.req.header.X-Empty]]-empty[[end]]":                              "a",
+		"a[[if filter.abc.req.header.X-None]]-none[[else]]-default[[end]]":                "a-default",
+		"[[if filter.abc.req.body.user.name]]hi [[filter.abc.req.body.user.name]][[end]]": "hi bob",
+		"[[if filter.abc.req.body.user.age]]age[[else]]no age[[end]]":                     "no age",
+		"[[if unknown.template]]unknown[[end]]":                                           "",
+		"[[if filter.abc.req.header.X-Debug]]" +
+			"[[if filter.abc.req.header.X-None]]none[[else]]debug[[end]]" +
+			"[[else]]" +
+			"[[if filter.abc.req.header.X-Debug]]never[[end]]" +
+			"[[end]]": "debug",
+		"[[[[if filter.abc.req.header.X-Debug]]": "[[if filter.abc.req.header.X-Debug]]",
+	}
+	for input, expect := range cases {
+		if s, err := tt.Render(input); s != expect || err != nil {
+			t.Errorf("input %s, expect %q, after rendering %q, err %v", input, expect, s, err)
+		}
+	}
+
+	for _, input := range []string{
+		"[[if filter.abc.req.header.X-Debug]]debug",
+		"debug[[end]]",
+		"[[else]]",
+		"[[if filter.abc.req.header.X-Debug]]a[[else]]b[[else]]c[[end]]",
+	} {
+		if _, err := tt.Render(input); err == nil {
+			t.Errorf("render %s should fail", input)
+		}
+	}
+
+	m := tt.ExtractRawTemplateRuleMap("[[if filter.abc.req.header.X-Debug]]debug[[end]]")
+	if len(m) != 1 || m["filter.abc.req.header.X-Debug"] == "" {
+		t.Errorf("the condition should be extracted, got %v", m)
+	}
+}
+
+func TestRenderRanges(t *testing.T) {
+	tt, err := NewDefault([]string{
+		"filter.{}.req.header.{}",
+		"filter.{}.req.body",
+		"filter.{}.req.body.{gjson}",
+	})
+	if err != nil {
+		t.Fatalf("new engine failed err %v", err)
+	}
+
+	tt.SetDict("filter.abc.req.header.X-Sep", ";")
+	tt.SetDict("filter.abc.req.body", `{"ids":["a","b","c"],"users":[{"name":"bob","tags":[1,2]},{"name":"[[x]]","tags":[]}],"empty":[]}`)
+
+	cases := map[string]string{
+		"[[range filter.abc.req.body.ids]][[item]][[separator]],[[end]]":                                      "a,b,c",
+		"[[range filter.abc.req.body.ids]][[index]]=[[item]] [[end]]":                                         "0=a 1=b 2=c ",
+		"[[range filter.abc.req.body.users]][[item.name]][[separator]][[filter.abc.req.header.X-Sep]][[end]]": "bob;[[x]]",
+		"[[range filter.abc.req.body.users.#.name]][[item]][[separator]],[[end]]":                             "bob,[[x]]",
+		"[[range filter.abc.req.body.users]][[if item.tags.0]][[item.name]][[else]]none[[end]] [[end]]":       "bob none ",
+		"[[range filter.abc.req.body.users]][[range item.tags]]<[[item]]>[[end]][[end]]":                      "<1><2>",
+		"a[[range filter.abc.req.body.empty]]never[[end]]b":                                                   "ab",
+		"a[[range filter.abc.req.body.none]]never[[end]]b":                                                    "ab",
+		"[[if filter.abc.req.header.X-None]][[range filter.abc.req.body.ids]][[item]][[end]][[end]]":          "",
+		"[[[[range filter.abc.req.body.ids]]":                                                                 "[[range filter.abc.req.body.ids]]",
+	}
+	for input, expect := range cases {
+		if s, err := tt.Render(input); s != expect || err != nil {
+			t.Errorf("input %s, expect %q, after rendering %q, err %v", input, expect, s, err)
+		}
+	}
+
+	for _, input := range []string{
+		"[[range filter.abc.req.body.ids]][[item]]",
+		"[[range filter.abc.req.body.ids]]a[[separator]]b[[separator]]c[[end]]",
+		"[[range filter.abc.req.body.ids]]a[[else]]b[[end]]",
+		"a[[separator]]b",
+	} {
+		if _, err := tt.Render(input); err == nil {
+			t.Errorf("render %s should fail", input)
+		}
+	}
+
+	m := tt.ExtractRawTemplateRuleMap("[[range filter.abc.req.body.ids]][[item.id]]-[[index]][[end]]")
+	if len(m) != 1 || m["filter.abc.req.body.ids"] == "" {
+		t.Errorf("only the array should be extracted, got %v", m)
+	}
+}
+
+func TestRegisterValidator(t *testing.T) {
+	tt, err := NewDefault([]string{
+		"plugin.{}.req.host",
+		"plugin.{}.req.port",
+		"plugin.{}.rsp.body",
+	})
+	if err != nil {
+		t.Fatalf("new engine failed err %v", err)
+	}
+
+	for _, prefix := range []string{"plugin.{}.re", "plugin.{}.req.host.x", "filter"} {
+		if err := tt.RegisterValidator(prefix, func(template, value string) error { return nil }); err == nil {
+			t.Errorf("prefix %s should be rejected", prefix)
+		}
+	}
+
+	notEmpty := func(template, value string) error {
+		if value == "" {
+			return fmt.Errorf("empty value")
+		}
+		return nil
+	}
+	noSpace := func(template, value string) error {
+		if strings.Contains(value, " ") {
+			return fmt.Errorf("%s contains space", template)
+		}
+		return nil
+	}
+	if err := tt.RegisterValidator("plugin.{}.req", notEmpty); err != nil {
+		t.Fatalf("register validator failed: %v", err)
+	}
+	if err := tt.RegisterValidator("plugin.{}.req.host", noSpace); err != nil {
+		t.Fatalf("register validator failed: %v", err)
+	}
+
+	if err := tt.SetDict("plugin.abc.req.host", "example.com"); err != nil {
+		t.Errorf("valid host should be set, but got %v", err)
+	}
+	if err := tt.SetDict("plugin.abc.req.host", "bad host"); err == nil {
+		t.Errorf("host with space should be rejected")
+	}
+	if err := tt.SetDict("plugin.abc.req.port", ""); err == nil {
+		t.Errorf("empty port should be rejected")
+	}
+	if err := tt.SetDict("plugin.abc.req.port", 8080); err != nil {
+		t.Errorf("int port should be set, but got %v", err)
+	}
+	if err := tt.SetDict("plugin.abc.rsp.body", ""); err != nil {
+		t.Errorf("the values of other meta templates should not be validated, but got %v", err)
+	}
+
+	if s, _ := tt.Render("[[plugin.abc.req.host]]:[[plugin.abc.req.port]]"); s != "example.com:8080" {
+		t.Errorf("the rejected value should not be set, got %s", s)
+	}
+}
+
+func TestDeleteAndClearDict(t *testing.T) {
+	tt, err := NewDefault([]string{
+		"filter.{}.req.path",
+		"filter.{}.req.header.{}",
+	})
+	if err != nil {
+		t.Fatalf("new engine failed err %v", err)
+	}
+
+	tt.SetDict("filter.abc.req.path", "/path")
+	tt.SetDict("filter.abc.req.header.X-Id", "1")
+
+	clone := tt.CloneDict()
+	clone["filter.abc.req.path"] = "/changed"
+	if s, _ := tt.Render("[[filter.abc.req.path]]"); s != "/path" {
+		t.Errorf("modifying the clone should not affect the engine, got %s", s)
+	}
+
+	tt.DeleteDict("filter.abc.req.path|%s")
+	if s, _ := tt.Render("[[filter.abc.req.path]]-[[filter.abc.req.header.X-Id]]"); s != "-1" {
+		t.Errorf("expect -1, got %s", s)
+	}
+
+	tt.ClearDict()
+	if dict := tt.GetDict(); len(dict) != 0 {
+		t.Errorf("expect empty dict, got %v", dict)
+	}
+	if len(clone) != 2 {
+		t.Errorf("clearing the engine should not affect the clone, got %v", clone)
+	}
+}
+
+func TestStats(t *testing.T) {
+	tt, err := NewDefault([]string{
+		"filter.{}.req.path",
+		"filter.{}.req.body",
+		"filter.{}.req.body.{gjson}",
+	})
+	if err != nil {
+		t.Fatalf("new engine failed err %v", err)
+	}
+
+	tt.SetDict("filter.abc.req.path", "/path")
+	tt.SetDict("filter.abc.req.body", `{"id":1}`)
+
+	for i := 0; i < 2; i++ {
+		tt.Render("[[filter.abc.req.path]]-[[filter.abc.req.body.id]]-[[filter.abc.req.body.name]]-[[filter.abc.req.host]]")
+	}
+
+	stats := tt.Stats()
+	if stats.Renders != 2 {
+		t.Errorf("expect 2 renders, got %d", stats.Renders)
+	}
+	if stats.CacheHits != 1 || stats.CacheMisses != 1 {
+		t.Errorf("expect 1 cache hit and 1 miss, got %d %d", stats.CacheHits, stats.CacheMisses)
+	}
+	if stats.Unresolved != 2 {
+		t.Errorf("expect 2 unresolved, got %d", stats.Unresolved)
+	}
+	if stats.GJSONFailures != 1 {
+		t.Errorf("expect 1 gjson failure, got %d", stats.GJSONFailures)
+	}
+	if stats.MetaMatches == 0 || stats.MetaMisses == 0 {
+		t.Errorf("expect meta matches and misses, got %d %d", stats.MetaMatches, stats.MetaMisses)
+	}
+}
+
+func TestRegisterResolver(t *testing.T) {
+	tt, err := NewDefault([]string{
+		"env.{}",
+		"secret.{}.{}",
+		"filter.{}.req.path",
+	})
+	if err != nil {
+		t.Fatalf("new engine failed err %v", err)
+	}
+
+	if err := tt.RegisterResolver("secret.db", func(string) (string, error) { return "", nil }); err == nil {
+		t.Errorf("prefix matched none meta template should fail")
+	}
+
+	version := 0
+	tt.RegisterResolver("env", func(template string) (string, error) {
+		version++
+		return fmt.Sprintf("%s-%d", template, version), nil
+	})
+	tt.RegisterResolver("secret", func(template string) (string, error) {
+		return "", fmt.Errorf("secret store unavailable")
+	})
+	tt.RegisterResolver("secret.{}", func(template string) (string, error) {
+		if strings.HasPrefix(template, "secret.db.") {
+			return "pass", nil
+		}
+		return "", fmt.Errorf("secret %s not found", template)
+	})
+	if err := tt.RegisterResolver("env", func(string) (string, error) { return "", nil }); err == nil {
+		t.Errorf("registering a prefix twice should fail")
+	}
+
+	if s, _ := tt.Render("[[env.HOME]]"); s != "env.HOME-1" {
+		t.Errorf("expect env.HOME-1, got %s", s)
+	}
+	if s, _ := tt.Render("[[env.HOME]]"); s != "env.HOME-2" {
+		t.Errorf("resolver should be called every rendering, got %s", s)
+	}
+
+	tt.SetDict("env.HOME", "/root")
+	if s, _ := tt.Render("[[env.HOME]]"); s != "/root" {
+		t.Errorf("value in dictionary should win, got %s", s)
+	}
+
+	if s, _ := tt.Render("[[secret.db.password]]-[[secret.mq.password]]"); s != "pass-" {
+		t.Errorf("expect pass-, got %s", s)
+	}
+	if n := tt.Stats().ResolverFailures; n != 1 {
+		t.Errorf("expect 1 resolver failure, got %d", n)
+	}
+
+	if s, _ := tt.Render("[[if secret.db.password]]yes[[end]]"); s != "yes" {
+		t.Errorf("resolved value should be used in conditions, got %s", s)
+	}
+}
+
+func TestRenderBestEffort(t *testing.T) {
+	tt, err := NewDefault([]string{
+		"filter.{}.req.path",
+		"filter.{}.req.body",
+		"filter.{}.req.body.{gjson}",
+		"filter.{}.req.header.{}",
+	})
+	if err != nil {
+		t.Fatalf("new engine failed err %v", err)
+	}
+
+	tt.SetDict("filter.abc.req.path", "/v1")
+	tt.SetDict("filter.abc.req.body", `{"name":"megaease","age":7}`)
+
+	input := `{"path":"[[filter.abc.req.path]]","name":"[[filter.abc.req.body.name]]","email":"[[filter.abc.req.body.email]]","host":"[[filter.abc.req.header.Host]]"}`
+	s, warnings := tt.RenderBestEffort(input, "N/A")
+	expect := `{"path":"/v1","name":"megaease","email":"N/A","host":"N/A"}`
+	if s != expect {
+		t.Errorf("expect %s, got %s", expect, s)
+	}
+	if len(warnings) != 2 {
+		t.Errorf("expect 2 warnings, got %v", warnings)
+	}
+	if n := tt.Stats().RenderWarnings; n != 2 {
+		t.Errorf("expect 2 render warnings, got %d", n)
+	}
+
+	// the missing field is rendered to empty string by Render
+	if s, err := tt.Render("[[filter.abc.req.body.email]]"); s != "" || err != nil {
+		t.Errorf("expect empty string, got %s, %v", s, err)
+	}
+	if s, _ := tt.RenderBestEffort("[[filter.abc.req.body.email]]", "N/A"); s != "N/A" {
+		t.Errorf("expect N/A, got %s", s)
+	}
+
+	if s, warnings := tt.RenderBestEffort("[[[[filter.abc.req.path]]-[[filter.abc.req.body.age]]", ""); s != "[[filter.abc.req.path]]-7" || len(warnings) != 0 {
+		t.Errorf("expect [[filter.abc.req.path]]-7, got %s, %v", s, warnings)
+	}
+
+	if s, warnings := tt.RenderBestEffort("[[if filter.abc.req.path]]yes", "N/A"); s != "N/A" || len(warnings) != 1 {
+		t.Errorf("expect N/A for invalid blocks, got %s, %v", s, warnings)
+	}
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package texttemplate
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/valyala/fasttemplate"
+)
+
+type (
+	// ValueValidator validates the value of the template set by SetDict,
+	// the value is in string, e.g. an int value 200 is validated as "200".
+	ValueValidator func(template, value string) error
+
+	// validators holds the validators keyed by meta template prefixes.
+	validators struct {
+		mutex    sync.RWMutex
+		prefixes map[string][]ValueValidator
+	}
+)
+
+func newValidators() *validators {
+	return &validators{prefixes: map[string][]ValueValidator{}}
+}
+
+// RegisterValidator registers the validator for the meta templates with the
+// prefix, e.g. the prefix "plugin.{}.req" covers "plugin.{}.req.host"
+// and "plugin.{}.req.path". The prefix must end at a tag of one of the meta
+// templates. The lazy values of fasttemplate.TagFunc are not validated.
+func (t TextTemplate) RegisterValidator(metaTemplatePrefix string, fn ValueValidator) error {
+	if fn == nil {
+		return fmt.Errorf("nil validator for %s", metaTemplatePrefix)
+	}
+
+	found := false
+	for _, mt := range t.metaTemplates {
+		if t.hasMetaPrefix(mt, metaTemplatePrefix) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("prefix %s matched none meta template", metaTemplatePrefix)
+	}
+
+	t.validators.mutex.Lock()
+	defer t.validators.mutex.Unlock()
+
+	t.validators.prefixes[metaTemplatePrefix] = append(t.validators.prefixes[metaTemplatePrefix], fn)
+
+	return nil
+}
+
+// hasMetaPrefix reports whether the meta template starts with the prefix by whole tags.
+func (t TextTemplate) hasMetaPrefix(metaTemplate, prefix string) bool {
+	if len(metaTemplate) < len(prefix) || metaTemplate[:len(prefix)] != prefix {
+		return false
+	}
+	return len(metaTemplate) == len(prefix) ||
+		metaTemplate[len(prefix):len(prefix)+len(t.separator)] == t.separator
+}
+
+// matchPrefix reports whether the template starts with the tags of the
+// meta template prefix, whose "{}" matches any tag.
+func (t TextTemplate) matchPrefix(template, prefix string) bool {
+	tags := strings.Split(template, t.separator)
+	prefixTags := strings.Split(prefix, t.separator)
+	if len(tags) < len(prefixTags) {
+		return false
+	}
+
+	for i, tag := range prefixTags {
+		if tag != "{}" && tag != tags[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// validate runs the validators of the prefixes matched by the template.
+func (t TextTemplate) validate(template string, value interface{}) error {
+	if _, ok := value.(fasttemplate.TagFunc); ok {
+		return nil
+	}
+
+	t.validators.mutex.RLock()
+	defer t.validators.mutex.RUnlock()
+
+	if len(t.validators.prefixes) == 0 {
+		return nil
+	}
+
+	name, _ := SplitFormat(template)
+	s := toString(value)
+	for prefix, fns := range t.validators.prefixes {
+		if !t.matchPrefix(name, prefix) {
+			continue
+		}
+		for _, fn := range fns {
+			if err := fn(name, s); err != nil {
+				return fmt.Errorf("template %s: invalid value: %v", name, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package toptalkers
+
+import (
+	"sort"
+	"sync"
+)
+
+var (
+	registryMutex sync.Mutex
+	trackers      = map[string]*Tracker{}
+)
+
+// Register registers the tracker of the owner, it replaces the previous
+// one of the owner.
+func Register(owner string, t *Tracker) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	trackers[owner] = t
+}
+
+// Unregister unregisters the tracker of the owner.
+func Unregister(owner string) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	delete(trackers, owner)
+}
+
+// Get returns the tracker of the owner with the existing flag.
+func Get(owner string) (*Tracker, bool) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	t, exists := trackers[owner]
+	return t, exists
+}
+
+// Owners returns the owners of the trackers in order.
+func Owners() []string {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	owners := make([]string, 0, len(trackers))
+	for owner := range trackers {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+
+	return owners
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package toptalkers
+
+import (
+	"math"
+	"math/bits"
+)
+
+const (
+	sketchDepth = 4
+	sketchWidth = 512
+
+	// hllPrecision is the number of bits indexing the registers of
+	// HyperLogLog, the standard error is 1.04/sqrt(2^hllPrecision).
+	hllPrecision = 10
+	hllRegisters = 1 << hllPrecision
+)
+
+type (
+	// countMinSketch estimates the sums of the values added by key, the
+	// estimations are never less than the real sums. The sketches with
+	// the same hash seed can be merged.
+	countMinSketch struct {
+		counters [sketchDepth][sketchWidth]uint64
+	}
+
+	// hyperLogLog estimates the number of distinct keys.
+	hyperLogLog struct {
+		registers [hllRegisters]uint8
+	}
+
+	// candidates holds the keys with the largest estimations seen, the
+	// key with the smallest estimation is replaced when it's full.
+	candidates struct {
+		max  int
+		keys map[string]uint64
+	}
+)
+
+// index returns the counter index of the row, the rows are hashed by
+// double hashing from the two halves of h.
+func index(h uint64, row int) uint32 {
+	h1, h2 := uint32(h), uint32(h>>32)
+	return (h1 + uint32(row)*h2) % sketchWidth
+}
+
+func (s *countMinSketch) add(h, value uint64) {
+	for row := 0; row < sketchDepth; row++ {
+		s.counters[row][index(h, row)] += value
+	}
+}
+
+func (s *countMinSketch) estimate(h uint64) uint64 {
+	var min uint64 = math.MaxUint64
+	for row := 0; row < sketchDepth; row++ {
+		if c := s.counters[row][index(h, row)]; c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+func (s *countMinSketch) merge(other *countMinSketch) {
+	for row := 0; row < sketchDepth; row++ {
+		for i := 0; i < sketchWidth; i++ {
+			s.counters[row][i] += other.counters[row][i]
+		}
+	}
+}
+
+func (l *hyperLogLog) add(h uint64) {
+	i := h >> (64 - hllPrecision)
+	// NOTE: The sentinel bit bounds the rank if the rest bits are zero.
+	rank := uint8(bits.LeadingZeros64(h<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > l.registers[i] {
+		l.registers[i] = rank
+	}
+}
+
+func (l *hyperLogLog) merge(other *hyperLogLog) {
+	for i, r := range other.registers {
+		if r > l.registers[i] {
+			l.registers[i] = r
+		}
+	}
+}
+
+func (l *hyperLogLog) estimate() uint64 {
+	sum, zeros := 0.0, 0
+	for _, r := range l.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	m := float64(hllRegisters)
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if e <= 2.5*m && zeros != 0 {
+		// Linear counting is more accurate for small cardinalities.
+		e = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(e + 0.5)
+}
+
+func newCandidates(max int) *candidates {
+	return &candidates{max: max, keys: make(map[string]uint64, max)}
+}
+
+func (c *candidates) offer(key string, estimation uint64) {
+	if _, exists := c.keys[key]; exists || len(c.keys) < c.max {
+		c.keys[key] = estimation
+		return
+	}
+
+	minKey, min := "", uint64(math.MaxUint64)
+	for k, e := range c.keys {
+		if e < min {
+			minKey, min = k, e
+		}
+	}
+	if estimation > min {
+		delete(c.keys, minKey)
+		c.keys[key] = estimation
+	}
+}
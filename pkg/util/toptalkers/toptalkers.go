@@ -0,0 +1,310 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package toptalkers tracks the top client IPs by requests, the top paths
+// by latency and the top consumers by bandwidth over a sliding window.
+// It's computed by count-min sketches and HyperLogLog instead of storing
+// every sample, so the memory is bounded whatever the traffic is.
+package toptalkers
+
+import (
+	"fmt"
+	"hash/maphash"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWindow is the default sliding window.
+	DefaultWindow = time.Minute
+	// DefaultTopN is the default number of items of every view.
+	DefaultTopN = 10
+
+	// bucketCount is the number of buckets of the sliding window, the
+	// oldest bucket is dropped when the window slides.
+	bucketCount = 6
+	// candidatesPerTopN is the ratio of the candidates to topN, the more
+	// candidates, the less likely a top key is missed.
+	candidatesPerTopN = 4
+)
+
+type (
+	// Spec describes the top talkers.
+	Spec struct {
+		Window string `yaml:"window,omitempty" jsonschema:"omitempty,format=duration"`
+		TopN   int    `yaml:"topN,omitempty" jsonschema:"omitempty,minimum=1"`
+		// ConsumerHeader is the header identifying the consumers, the
+		// client IP is the consumer if it's empty or missing.
+		ConsumerHeader string `yaml:"consumerHeader,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Tracker tracks the top talkers.
+	Tracker struct {
+		spec           *Spec
+		window         time.Duration
+		bucketDuration time.Duration
+		topN           int
+		seed           maphash.Seed
+		created        time.Time
+
+		mutex   sync.Mutex
+		buckets [bucketCount]*bucket
+	}
+
+	bucket struct {
+		slot int64
+
+		clients       countMinSketch
+		uniqueClients hyperLogLog
+		pathRequests  countMinSketch
+		pathLatency   countMinSketch
+		consumers     countMinSketch
+
+		clientKeys   *candidates
+		pathKeys     *candidates
+		consumerKeys *candidates
+	}
+
+	// Snapshot is the top talkers in the window.
+	Snapshot struct {
+		Window        string          `yaml:"window"`
+		UniqueClients uint64          `yaml:"uniqueClients"`
+		TopClients    []*ClientItem   `yaml:"topClients"`
+		TopPaths      []*PathItem     `yaml:"topPaths"`
+		TopConsumers  []*ConsumerItem `yaml:"topConsumers"`
+	}
+
+	// ClientItem is a client IP ranked by requests per second.
+	ClientItem struct {
+		IP       string  `yaml:"ip"`
+		Requests uint64  `yaml:"requests"`
+		RPS      float64 `yaml:"rps"`
+	}
+
+	// PathItem is a path ranked by average latency.
+	PathItem struct {
+		Path         string  `yaml:"path"`
+		Requests     uint64  `yaml:"requests"`
+		AvgLatencyMs float64 `yaml:"avgLatencyMs"`
+	}
+
+	// ConsumerItem is a consumer ranked by bytes per second.
+	ConsumerItem struct {
+		Consumer       string  `yaml:"consumer"`
+		Bytes          uint64  `yaml:"bytes"`
+		BytesPerSecond float64 `yaml:"bytesPerSecond"`
+	}
+)
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	if spec.Window == "" {
+		return nil
+	}
+
+	// NOTE: It has been validated by format=duration.
+	window, _ := time.ParseDuration(spec.Window)
+	if window < bucketCount*time.Second {
+		return fmt.Errorf("window %s is shorter than %ds", spec.Window, bucketCount)
+	}
+
+	return nil
+}
+
+// New creates a Tracker.
+func New(spec *Spec) *Tracker {
+	t := &Tracker{
+		spec:    spec,
+		window:  DefaultWindow,
+		topN:    DefaultTopN,
+		seed:    maphash.MakeSeed(),
+		created: time.Now(),
+	}
+
+	if spec.Window != "" {
+		t.window, _ = time.ParseDuration(spec.Window)
+	}
+	if spec.TopN > 0 {
+		t.topN = spec.TopN
+	}
+	t.bucketDuration = t.window / bucketCount
+
+	return t
+}
+
+// ConsumerHeader returns the header identifying the consumers.
+func (t *Tracker) ConsumerHeader() string {
+	return t.spec.ConsumerHeader
+}
+
+func (t *Tracker) hash(key string) uint64 {
+	var h maphash.Hash
+	h.SetSeed(t.seed)
+	h.WriteString(key)
+	return h.Sum64()
+}
+
+// bucket returns the bucket of the slot, it resets the bucket left by
+// an earlier slot. It must be called with the lock held.
+func (t *Tracker) bucket(slot int64) *bucket {
+	i := slot % bucketCount
+	b := t.buckets[i]
+	if b == nil || b.slot != slot {
+		max := t.topN * candidatesPerTopN
+		b = &bucket{
+			slot:         slot,
+			clientKeys:   newCandidates(max),
+			pathKeys:     newCandidates(max),
+			consumerKeys: newCandidates(max),
+		}
+		t.buckets[i] = b
+	}
+	return b
+}
+
+// Record records a request, the client IP is the consumer if consumer
+// is empty.
+func (t *Tracker) Record(clientIP, path, consumer string, latency time.Duration, bytes uint64) {
+	if consumer == "" {
+		consumer = clientIP
+	}
+
+	hClient, hPath, hConsumer := t.hash(clientIP), t.hash(path), t.hash(consumer)
+	slot := time.Now().UnixNano() / int64(t.bucketDuration)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	b := t.bucket(slot)
+
+	b.clients.add(hClient, 1)
+	b.uniqueClients.add(hClient)
+	b.clientKeys.offer(clientIP, b.clients.estimate(hClient))
+
+	b.pathRequests.add(hPath, 1)
+	b.pathLatency.add(hPath, uint64(latency/time.Microsecond))
+	b.pathKeys.offer(path, b.pathLatency.estimate(hPath))
+
+	b.consumers.add(hConsumer, bytes)
+	b.consumerKeys.offer(consumer, b.consumers.estimate(hConsumer))
+}
+
+// Snapshot returns the top talkers in the window.
+func (t *Tracker) Snapshot() *Snapshot {
+	now := time.Now()
+	slot := now.UnixNano() / int64(t.bucketDuration)
+
+	merged := &bucket{}
+	clientKeys, pathKeys, consumerKeys := map[string]bool{}, map[string]bool{}, map[string]bool{}
+
+	t.mutex.Lock()
+	for _, b := range t.buckets {
+		if b == nil || b.slot <= slot-bucketCount {
+			continue
+		}
+
+		merged.clients.merge(&b.clients)
+		merged.uniqueClients.merge(&b.uniqueClients)
+		merged.pathRequests.merge(&b.pathRequests)
+		merged.pathLatency.merge(&b.pathLatency)
+		merged.consumers.merge(&b.consumers)
+
+		for key := range b.clientKeys.keys {
+			clientKeys[key] = true
+		}
+		for key := range b.pathKeys.keys {
+			pathKeys[key] = true
+		}
+		for key := range b.consumerKeys.keys {
+			consumerKeys[key] = true
+		}
+	}
+	t.mutex.Unlock()
+
+	start := time.Unix(0, (slot-bucketCount+1)*int64(t.bucketDuration))
+	if t.created.After(start) {
+		start = t.created
+	}
+	seconds := now.Sub(start).Seconds()
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	s := &Snapshot{
+		Window:        t.window.String(),
+		UniqueClients: merged.uniqueClients.estimate(),
+		TopClients:    []*ClientItem{},
+		TopPaths:      []*PathItem{},
+		TopConsumers:  []*ConsumerItem{},
+	}
+
+	for ip := range clientKeys {
+		requests := merged.clients.estimate(t.hash(ip))
+		s.TopClients = append(s.TopClients, &ClientItem{
+			IP:       ip,
+			Requests: requests,
+			RPS:      float64(requests) / seconds,
+		})
+	}
+	sort.Slice(s.TopClients, func(i, j int) bool {
+		a, b := s.TopClients[i], s.TopClients[j]
+		return a.Requests > b.Requests || a.Requests == b.Requests && a.IP < b.IP
+	})
+	if len(s.TopClients) > t.topN {
+		s.TopClients = s.TopClients[:t.topN]
+	}
+
+	for path := range pathKeys {
+		h := t.hash(path)
+		requests := merged.pathRequests.estimate(h)
+		if requests == 0 {
+			continue
+		}
+		latency := merged.pathLatency.estimate(h)
+		s.TopPaths = append(s.TopPaths, &PathItem{
+			Path:         path,
+			Requests:     requests,
+			AvgLatencyMs: float64(latency) / float64(requests) / 1000,
+		})
+	}
+	sort.Slice(s.TopPaths, func(i, j int) bool {
+		a, b := s.TopPaths[i], s.TopPaths[j]
+		return a.AvgLatencyMs > b.AvgLatencyMs || a.AvgLatencyMs == b.AvgLatencyMs && a.Path < b.Path
+	})
+	if len(s.TopPaths) > t.topN {
+		s.TopPaths = s.TopPaths[:t.topN]
+	}
+
+	for consumer := range consumerKeys {
+		bytes := merged.consumers.estimate(t.hash(consumer))
+		s.TopConsumers = append(s.TopConsumers, &ConsumerItem{
+			Consumer:       consumer,
+			Bytes:          bytes,
+			BytesPerSecond: float64(bytes) / seconds,
+		})
+	}
+	sort.Slice(s.TopConsumers, func(i, j int) bool {
+		a, b := s.TopConsumers[i], s.TopConsumers[j]
+		return a.Bytes > b.Bytes || a.Bytes == b.Bytes && a.Consumer < b.Consumer
+	})
+	if len(s.TopConsumers) > t.topN {
+		s.TopConsumers = s.TopConsumers[:t.topN]
+	}
+
+	return s
+}
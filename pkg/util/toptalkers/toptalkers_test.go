@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package toptalkers
+
+import (
+	"fmt"
+	"hash/maphash"
+	"testing"
+	"time"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	seed := maphash.MakeSeed()
+	hash := func(key string) uint64 {
+		var h maphash.Hash
+		h.SetSeed(seed)
+		h.WriteString(key)
+		return h.Sum64()
+	}
+
+	for _, n := range []int{0, 100, 10000, 100000} {
+		l := &hyperLogLog{}
+		for i := 0; i < n; i++ {
+			l.add(hash(fmt.Sprintf("10.0.%d.%d", i/256, i%256)))
+			// Duplicates are not counted.
+			l.add(hash(fmt.Sprintf("10.0.%d.%d", i/256, i%256)))
+		}
+
+		got := float64(l.estimate())
+		if diff := got - float64(n); diff > 0.1*float64(n)+1 || diff < -0.1*float64(n)-1 {
+			t.Errorf("estimate of %d distinct keys is %v", n, got)
+		}
+	}
+}
+
+func TestTracker(t *testing.T) {
+	spec := &Spec{TopN: 3, ConsumerHeader: "X-Consumer"}
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := (Spec{Window: "1s"}).Validate(); err == nil {
+		t.Errorf("too short window should fail")
+	}
+
+	tracker := New(spec)
+	if tracker.ConsumerHeader() != "X-Consumer" {
+		t.Errorf("unexpected consumer header %s", tracker.ConsumerHeader())
+	}
+
+	// The hot client, the slow path and the heavy consumer are among
+	// many cold ones.
+	for i := 0; i < 1000; i++ {
+		tracker.Record("10.0.0.1", "/hot", "", time.Millisecond, 100)
+	}
+	for i := 0; i < 500; i++ {
+		tracker.Record("10.0.0.2", "/slow", "alice", 100*time.Millisecond, 10)
+	}
+	for i := 0; i < 10; i++ {
+		tracker.Record("10.0.0.3", "/hot", "bob", time.Millisecond, 1<<20)
+	}
+	for i := 0; i < 5000; i++ {
+		tracker.Record(fmt.Sprintf("10.1.%d.%d", i/256, i%256),
+			fmt.Sprintf("/cold/%d", i), "", time.Millisecond, 1)
+	}
+
+	s := tracker.Snapshot()
+	if s.Window != "1m0s" {
+		t.Errorf("unexpected window %s", s.Window)
+	}
+	if s.UniqueClients < 4500 || s.UniqueClients > 5500 {
+		t.Errorf("unexpected unique clients %d", s.UniqueClients)
+	}
+
+	if len(s.TopClients) != 3 || s.TopClients[0].IP != "10.0.0.1" || s.TopClients[1].IP != "10.0.0.2" {
+		t.Fatalf("unexpected top clients %+v", s.TopClients)
+	}
+	if s.TopClients[0].Requests < 1000 || s.TopClients[0].RPS <= 0 {
+		t.Errorf("unexpected top client %+v", s.TopClients[0])
+	}
+
+	if len(s.TopPaths) == 0 || s.TopPaths[0].Path != "/slow" {
+		t.Fatalf("unexpected top paths %+v", s.TopPaths)
+	}
+	if s.TopPaths[0].AvgLatencyMs < 99 || s.TopPaths[0].AvgLatencyMs > 110 {
+		t.Errorf("unexpected latency of /slow %+v", s.TopPaths[0])
+	}
+
+	if len(s.TopConsumers) != 3 || s.TopConsumers[0].Consumer != "bob" || s.TopConsumers[1].Consumer != "10.0.0.1" {
+		t.Fatalf("unexpected top consumers %+v", s.TopConsumers)
+	}
+
+	// The buckets out of the window are dropped.
+	tracker.mutex.Lock()
+	for _, b := range tracker.buckets {
+		if b != nil {
+			b.slot -= bucketCount
+		}
+	}
+	tracker.mutex.Unlock()
+
+	s = tracker.Snapshot()
+	if s.UniqueClients != 0 || len(s.TopClients) != 0 || len(s.TopPaths) != 0 || len(s.TopConsumers) != 0 {
+		t.Errorf("snapshot should be empty, but got %+v", s)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	a, b := New(&Spec{}), New(&Spec{})
+	Register("b", b)
+	Register("a", a)
+	defer Unregister("a")
+
+	if owners := Owners(); len(owners) != 2 || owners[0] != "a" || owners[1] != "b" {
+		t.Errorf("unexpected owners %v", owners)
+	}
+
+	Unregister("b")
+	if _, exists := Get("b"); exists {
+		t.Errorf("b should be unregistered")
+	}
+	if got, exists := Get("a"); !exists || got != a {
+		t.Errorf("a should be registered")
+	}
+}
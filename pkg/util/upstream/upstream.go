@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package upstream holds the server groups shared by the backends, the
+// backends referencing a group are updated together when it changes.
+package upstream
+
+import (
+	"fmt"
+	"sync"
+)
+
+type (
+	// Server is a server of the group.
+	Server struct {
+		URL    string   `yaml:"url" jsonschema:"required,format=egress-url"`
+		Tags   []string `yaml:"tags" jsonschema:"omitempty,uniqueItems=true"`
+		Weight int      `yaml:"weight" jsonschema:"omitempty,minimum=0,maximum=100"`
+		// Priority is the priority of the server, 0 is the highest.
+		Priority int `yaml:"priority,omitempty" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// Watcher notifies the changes of a group, the notifications are
+	// merged if they are not received in time.
+	Watcher struct {
+		name string
+		ch   chan struct{}
+	}
+)
+
+var (
+	mutex    sync.Mutex
+	groups   = map[string][]*Server{}
+	watchers = map[string]map[*Watcher]struct{}{}
+)
+
+// Set sets the servers of the group and notifies its watchers.
+func Set(name string, servers []*Server) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	groups[name] = servers
+	notify(name)
+}
+
+// Delete deletes the group and notifies its watchers.
+func Delete(name string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	delete(groups, name)
+	notify(name)
+}
+
+// notify notifies the watchers of the group, it must be called with
+// the lock held.
+func notify(name string) {
+	for w := range watchers[name] {
+		select {
+		case w.ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Get returns the servers of the group with the existing flag.
+func Get(name string) ([]*Server, bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	servers, exists := groups[name]
+	return servers, exists
+}
+
+// Check checks whether the group exists. Like the allowlists of egress,
+// nothing is restricted before any group is set, so the references
+// aren't rejected while the objects are being loaded at startup.
+func Check(name string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(groups) == 0 {
+		return nil
+	}
+	if _, exists := groups[name]; !exists {
+		return fmt.Errorf("server group %s not found", name)
+	}
+	return nil
+}
+
+// NewWatcher creates a watcher of the group.
+func NewWatcher(name string) *Watcher {
+	w := &Watcher{name: name, ch: make(chan struct{}, 1)}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if watchers[name] == nil {
+		watchers[name] = map[*Watcher]struct{}{}
+	}
+	watchers[name][w] = struct{}{}
+
+	return w
+}
+
+// Watch returns the channel to notify the changes.
+func (w *Watcher) Watch() <-chan struct{} {
+	return w.ch
+}
+
+// Stop stops the watcher.
+func (w *Watcher) Stop() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	delete(watchers[w.name], w)
+	if len(watchers[w.name]) == 0 {
+		delete(watchers, w.name)
+	}
+}
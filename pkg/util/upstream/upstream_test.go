@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package upstream
+
+import "testing"
+
+func TestGroup(t *testing.T) {
+	if err := Check("fleet"); err != nil {
+		t.Fatalf("nothing should be restricted without groups, but got %v", err)
+	}
+
+	w := NewWatcher("fleet")
+	defer w.Stop()
+
+	Set("fleet", []*Server{{URL: "http://127.0.0.1:8080"}})
+	defer Delete("fleet")
+
+	select {
+	case <-w.Watch():
+	default:
+		t.Fatal("watcher should be notified")
+	}
+
+	servers, exists := Get("fleet")
+	if !exists || len(servers) != 1 {
+		t.Fatalf("unexpected group: %v %v", servers, exists)
+	}
+	if err := Check("fleet"); err != nil {
+		t.Errorf("fleet should exist, but got %v", err)
+	}
+	if err := Check("other"); err == nil {
+		t.Error("other should not exist")
+	}
+
+	Set("fleet", nil)
+	Set("fleet", []*Server{{URL: "http://127.0.0.2:8080"}})
+	<-w.Watch()
+	select {
+	case <-w.Watch():
+		t.Error("notifications should be merged")
+	default:
+	}
+
+	Delete("fleet")
+	<-w.Watch()
+	if _, exists := Get("fleet"); exists {
+		t.Error("fleet should be deleted")
+	}
+}
@@ -0,0 +1,401 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package wal implements a local write-ahead log used as a persistent queue.
+// Records are appended to segment files, consumers read them from the
+// committed position and commit the position after the records are handled,
+// so the records which are not committed are replayed after restart.
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	segmentSuffix  = ".wal"
+	commitFilename = "commit"
+
+	// record layout: length(4 bytes) | crc32 of data(4 bytes) | data
+	recordHeaderSize = 8
+	maxRecordSize    = 16 * 1024 * 1024
+)
+
+type (
+	// WAL is a segmented write-ahead log, it is safe for concurrent use.
+	WAL struct {
+		dir         string
+		segmentSize int64
+		fsync       bool
+
+		mutex     sync.Mutex
+		segment   *os.File
+		writePos  Position
+		committed Position
+		notify    chan struct{}
+	}
+
+	// Position is the position of a record in the WAL.
+	Position struct {
+		Segment uint64
+		Offset  int64
+	}
+)
+
+// Open opens or creates the WAL in dir. A segment is rotated after its size
+// exceeds segmentSize. If fsync is true, every Append syncs the segment to
+// disk before returning.
+func Open(dir string, segmentSize int64, fsync bool) (*WAL, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	w := &WAL{
+		dir:         dir,
+		segmentSize: segmentSize,
+		fsync:       fsync,
+		notify:      make(chan struct{}, 1),
+	}
+
+	committed, err := w.readCommit()
+	if err != nil {
+		return nil, err
+	}
+	w.committed = committed
+
+	segments, err := w.segments()
+	if err != nil {
+		return nil, err
+	}
+
+	last := committed.Segment
+	if len(segments) != 0 && segments[len(segments)-1] > last {
+		last = segments[len(segments)-1]
+	}
+
+	// NOTE: The tail of the last segment may be a partial record
+	// written before crash, truncate it to the last complete record.
+	validSize, err := w.validSize(last)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(w.segmentPath(last), os.O_RDWR|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(validSize); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(validSize, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	w.segment = file
+	w.writePos = Position{Segment: last, Offset: validSize}
+
+	return w, nil
+}
+
+func (w *WAL) segmentPath(id uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%020d%s", id, segmentSuffix))
+}
+
+func (w *WAL) segments() ([]uint64, error) {
+	files, err := ioutil.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uint64
+	for _, f := range files {
+		name := f.Name()
+		if !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func (w *WAL) validSize(id uint64) (int64, error) {
+	file, err := os.Open(w.segmentPath(id))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	var size int64
+	for {
+		data, err := readRecord(r)
+		if err != nil {
+			return size, nil
+		}
+		size += int64(recordHeaderSize + len(data))
+	}
+}
+
+func (w *WAL) readCommit() (Position, error) {
+	buff, err := ioutil.ReadFile(filepath.Join(w.dir, commitFilename))
+	if os.IsNotExist(err) {
+		return Position{}, nil
+	}
+	if err != nil {
+		return Position{}, err
+	}
+
+	var pos Position
+	_, err = fmt.Sscanf(string(buff), "%d %d", &pos.Segment, &pos.Offset)
+	if err != nil {
+		return Position{}, fmt.Errorf("invalid commit file: %v", err)
+	}
+	return pos, nil
+}
+
+// Append appends a record to the WAL.
+func (w *WAL) Append(data []byte) error {
+	if len(data) > maxRecordSize {
+		return fmt.Errorf("record size %d exceeds %d", len(data), maxRecordSize)
+	}
+
+	buff := make([]byte, recordHeaderSize+len(data))
+	binary.BigEndian.PutUint32(buff[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(buff[4:8], crc32.ChecksumIEEE(data))
+	copy(buff[recordHeaderSize:], data)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.segment == nil {
+		return fmt.Errorf("wal closed")
+	}
+
+	if w.writePos.Offset >= w.segmentSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := w.segment.Write(buff)
+	w.writePos.Offset += int64(n)
+	if err != nil {
+		return err
+	}
+
+	if w.fsync {
+		if err := w.segment.Sync(); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+func (w *WAL) rotate() error {
+	if err := w.segment.Sync(); err != nil {
+		return err
+	}
+	w.segment.Close()
+
+	next := w.writePos.Segment + 1
+	file, err := os.OpenFile(w.segmentPath(next), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o640)
+	if err != nil {
+		w.segment = nil
+		return err
+	}
+
+	w.segment = file
+	w.writePos = Position{Segment: next}
+	return nil
+}
+
+// Notify returns a channel which receives a value after records appended.
+func (w *WAL) Notify() <-chan struct{} {
+	return w.notify
+}
+
+// Committed returns the committed position.
+func (w *WAL) Committed() Position {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.committed
+}
+
+// Read reads at most max records starting from pos, it returns the records
+// and the position after them.
+func (w *WAL) Read(pos Position, max int) ([][]byte, Position, error) {
+	w.mutex.Lock()
+	writePos := w.writePos
+	w.mutex.Unlock()
+
+	var records [][]byte
+	for len(records) < max {
+		if pos == writePos {
+			break
+		}
+
+		file, err := os.Open(w.segmentPath(pos.Segment))
+		if err != nil {
+			return records, pos, err
+		}
+
+		if _, err := file.Seek(pos.Offset, io.SeekStart); err != nil {
+			file.Close()
+			return records, pos, err
+		}
+
+		r := bufio.NewReader(file)
+		for len(records) < max {
+			if pos.Segment == writePos.Segment && pos.Offset >= writePos.Offset {
+				break
+			}
+
+			data, err := readRecord(r)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				file.Close()
+				return records, pos, fmt.Errorf("read %s at %d failed: %v",
+					w.segmentPath(pos.Segment), pos.Offset, err)
+			}
+
+			records = append(records, data)
+			pos.Offset += int64(recordHeaderSize + len(data))
+		}
+		file.Close()
+
+		if len(records) >= max || pos.Segment == writePos.Segment {
+			break
+		}
+
+		// The segment has been rotated, continue with the next one.
+		pos = Position{Segment: pos.Segment + 1}
+	}
+
+	return records, pos, nil
+}
+
+// Commit persists pos as the committed position and removes the segments
+// whose records are all committed.
+func (w *WAL) Commit(pos Position) error {
+	content := fmt.Sprintf("%d %d", pos.Segment, pos.Offset)
+	tmp := filepath.Join(w.dir, commitFilename+".tmp")
+	if err := ioutil.WriteFile(tmp, []byte(content), 0o640); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(w.dir, commitFilename)); err != nil {
+		return err
+	}
+
+	w.mutex.Lock()
+	w.committed = pos
+	w.mutex.Unlock()
+
+	segments, err := w.segments()
+	if err != nil {
+		return err
+	}
+	for _, id := range segments {
+		if id >= pos.Segment {
+			break
+		}
+		os.Remove(w.segmentPath(id))
+	}
+
+	return nil
+}
+
+// Sync syncs the current segment to disk.
+func (w *WAL) Sync() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.segment == nil {
+		return nil
+	}
+	return w.segment.Sync()
+}
+
+// Close closes the WAL.
+func (w *WAL) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.segment == nil {
+		return nil
+	}
+
+	err := w.segment.Sync()
+	w.segment.Close()
+	w.segment = nil
+
+	return err
+}
+
+func readRecord(r io.Reader) ([]byte, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("partial record header")
+		}
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > maxRecordSize {
+		return nil, fmt.Errorf("invalid record size %d", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("partial record: %v", err)
+	}
+
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, fmt.Errorf("record checksum mismatch")
+	}
+
+	return data, nil
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestAppendReadCommit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := Open(dir, 64, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := w.Append([]byte(fmt.Sprintf("record-%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, pos, err := w.Read(w.Committed(), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || string(records[0]) != "record-0" || string(records[3]) != "record-3" {
+		t.Fatalf("unexpected records: %q", records)
+	}
+	if err := w.Commit(pos); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	// Reopen, uncommitted records must be replayed.
+	w, err = Open(dir, 64, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	records, _, err = w.Read(w.Committed(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 6 || string(records[0]) != "record-4" || string(records[5]) != "record-9" {
+		t.Fatalf("unexpected records: %q", records)
+	}
+}
+
+func TestTornTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := Open(dir, 1024, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Append([]byte("complete"))
+	w.Close()
+
+	// Simulate a crash in the middle of writing a record.
+	f, err := os.OpenFile(w.segmentPath(0), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 9, 1, 2})
+	f.Close()
+
+	w, err = Open(dir, 1024, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	w.Append([]byte("next"))
+	records, _, err := w.Read(w.Committed(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || string(records[0]) != "complete" || string(records[1]) != "next" {
+		t.Fatalf("unexpected records: %q", records)
+	}
+}
@@ -24,29 +24,54 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"sync"
 	"time"
+
+	"github.com/megaease/easegress/pkg/util/capability"
+	"github.com/megaease/easegress/pkg/util/egress"
+	"github.com/megaease/easegress/pkg/util/matcher"
+	"github.com/megaease/easegress/pkg/util/rejection"
+	"github.com/megaease/easegress/pkg/util/upstream"
 )
 
 var (
+	objectNamesMutex sync.RWMutex
+	// objectNames is the names of the objects of each kind, see UseObjectNames.
+	objectNames map[string]map[string]struct{}
+
 	formatsFuncs = map[string]FormatFunc{
-		"urlname":          urlName,
-		"httpmethod":       httpMethod,
-		"httpmethod-array": httpMethodArray,
-		"httpcode":         httpCode,
-		"httpcode-array":   httpCodeArray,
-		"timerfc3339":      timerfc3339,
-		"duration":         duration,
-		"ipcidr":           ipcidr,
-		"ipcidr-array":     ipcidrArray,
-		"hostport":         hostport,
-		"regexp":           _regexp,
-		"base64":           _base64,
-		"url":              _url,
+		"urlname":           urlName,
+		"httpmethod":        httpMethod,
+		"httpmethod-array":  httpMethodArray,
+		"httpcode":          httpCode,
+		"httpcode-array":    httpCodeArray,
+		"timerfc3339":       timerfc3339,
+		"duration":          duration,
+		"ipcidr":            ipcidr,
+		"ipcidr-array":      ipcidrArray,
+		"hostport":          hostport,
+		"regexp":            _regexp,
+		"base64":            _base64,
+		"url":               _url,
+		"egress-url":        egressURL,
+		"servergroup":       serverGroup,
+		"rejectionresponse": rejectionResponse,
+		"requestmatcher":    requestMatcher,
+		"capability-array":  capabilityArray,
 	}
 
 	urlCharsRegexp = regexp.MustCompile(`^[A-Za-z0-9\-_\.~]{1,253}$`)
 )
 
+func init() {
+	for _, format := range []string{"date-time", "email", "hostname", "ipv4", "ipv6", "uri"} {
+		capability.Register(capability.Format, format)
+	}
+	for format := range formatsFuncs {
+		capability.Register(capability.Format, format)
+	}
+}
+
 func getFormatFunc(format string) (FormatFunc, bool) {
 	switch format {
 	case "date-time", "email", "hostname", "ipv4", "ipv6", "uri":
@@ -207,3 +232,87 @@ func _url(v interface{}) error {
 
 	return nil
 }
+
+// egressURL is the url of upstream, which must be allowed by the egress allowlists.
+func egressURL(v interface{}) error {
+	if err := _url(v); err != nil {
+		return err
+	}
+
+	return egress.CheckURL(v.(string))
+}
+
+// serverGroup is the name of a ServerGroup, which must exist.
+func serverGroup(v interface{}) error {
+	if err := urlName(v); err != nil {
+		return err
+	}
+
+	return checkObjectName("ServerGroup", v.(string), upstream.Check)
+}
+
+// rejectionResponse is the name of a RejectionResponse, which must exist.
+func rejectionResponse(v interface{}) error {
+	if err := urlName(v); err != nil {
+		return err
+	}
+
+	return checkObjectName("RejectionResponse", v.(string), rejection.Check)
+}
+
+// requestMatcher is the name of a RequestMatcher, which must exist.
+func requestMatcher(v interface{}) error {
+	if err := urlName(v); err != nil {
+		return err
+	}
+
+	return checkObjectName("RequestMatcher", v.(string), matcher.Check)
+}
+
+// UseObjectNames makes the formats referring to other objects check the
+// names against the given names of each kind instead of the running
+// objects, it's used to validate specs without running them. Nil names
+// restore the default behavior.
+func UseObjectNames(names map[string][]string) {
+	objectNamesMutex.Lock()
+	defer objectNamesMutex.Unlock()
+
+	if names == nil {
+		objectNames = nil
+		return
+	}
+
+	objectNames = map[string]map[string]struct{}{}
+	for kind, kindNames := range names {
+		objectNames[kind] = map[string]struct{}{}
+		for _, name := range kindNames {
+			objectNames[kind][name] = struct{}{}
+		}
+	}
+}
+
+func checkObjectName(kind, name string, check func(string) error) error {
+	objectNamesMutex.RLock()
+	defer objectNamesMutex.RUnlock()
+
+	if objectNames == nil {
+		return check(name)
+	}
+
+	if _, exists := objectNames[kind][name]; !exists {
+		return fmt.Errorf("%s %s not found", kind, name)
+	}
+	return nil
+}
+
+// capabilityArray is the capabilities like filter/Proxy, which must be
+// supported by this binary.
+func capabilityArray(v interface{}) error {
+	for _, c := range v.([]string) {
+		if err := capability.Check(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}